@@ -0,0 +1,32 @@
+// Payment channels, see internal/chain/channels.go
+
+package channels
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Prefix of the name of the channel accounts, followed by the channel ID
+const CHANNEL_ACCOUNT_PREFIX = chain.CHANNEL_ACCOUNT_PREFIX
+
+// Terms the payer and the payee agree on before opening a channel
+type ChannelSpec = chain.ChannelSpec
+
+// Payment signed by the payer, the settlement of the channel paying Paid to the payee
+type ChannelUpdate = chain.ChannelUpdate
+
+// Channel as seen by one of its parties
+type PaymentChannel = chain.PaymentChannel
+
+type ChannelStep = chain.ChannelStep
+
+func OpenChannel(spec ChannelSpec) (*PaymentChannel, error) {
+	return chain.OpenChannel(spec)
+}
+
+/*
+ * Open a channel from alice to bob, pay over it off chain, try the refund
+ * early, close it and try the refund again, each step recording whether
+ * the chain, or bob, accepted it
+ */
+func RunChannelDemo() ([]ChannelStep, error) {
+	return chain.RunChannelDemo()
+}
@@ -0,0 +1,6 @@
+/*
+ * Package channels is the payment channel app: two parties fund a channel
+ * account on chain, exchange signed updates off chain, and close it with the
+ * last one.
+ */
+package channels
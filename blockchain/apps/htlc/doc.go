@@ -0,0 +1,5 @@
+/*
+ * Package htlc is the hash time-locked contract app, and the atomic swap of
+ * coins across two chains built from a pair of HTLCs.
+ */
+package htlc
@@ -0,0 +1,28 @@
+// Hash time-locked contracts and atomic swaps, see internal/chain/htlc.go
+
+package htlc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Prefix of the name of the HTLC accounts, followed by the HTLC ID
+const HTLC_ACCOUNT_PREFIX = chain.HTLC_ACCOUNT_PREFIX
+
+// Terms the sender and the receiver agree on before funding an HTLC
+type HTLCSpec = chain.HTLCSpec
+
+type SwapStep = chain.SwapStep
+
+// Hash lock of a secret
+func HashSecret(secret []byte) []byte {
+	return chain.HashSecret(secret)
+}
+
+/*
+ * Swap coins of alice on chain A for coins of bob on chain B with two HTLCs,
+ * bob trying to claim without the secret and alice trying to take hers back
+ * early along the way, each step recording whether the chain, or the party,
+ * accepted it
+ */
+func RunSwapDemo() ([]SwapStep, error) {
+	return chain.RunSwapDemo()
+}
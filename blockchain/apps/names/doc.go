@@ -0,0 +1,6 @@
+/*
+ * Package names is the name registry app: NewNameRegistration binds a name
+ * to an address, which BlockChain.ResolveName and BlockChain.ResolveAccount
+ * of package core read back.
+ */
+package names
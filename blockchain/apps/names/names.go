@@ -0,0 +1,26 @@
+// Name registry, see internal/chain/names.go
+
+package names
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	NAME_NAMESPACE_PREFIX = chain.NAME_NAMESPACE_PREFIX
+	NAME_ADDRESS_KEY      = chain.NAME_ADDRESS_KEY
+
+	// Longest name, filling a key-value namespace
+	MAX_NAME_SIZE = chain.MAX_NAME_SIZE
+
+	// Prefix of names given for accounts, eg. @alice
+	NAME_SIGIL = chain.NAME_SIGIL
+)
+
+type NameRecord = chain.NameRecord
+
+// Point name at address as owner, claiming it if free, releasing it if address is empty
+func NewNameRegistration(owner string, nonce uint64, name, address string) (core.Transaction, error) {
+	return chain.NewNameRegistration(owner, nonce, name, address)
+}
@@ -0,0 +1,8 @@
+/*
+ * Package voting is the voting app, enabled by listing APP_VOTING in the
+ * apps of a genesis spec: an organizer opens a poll and registers its
+ * voters with NewPoll and NewPollVoter, each voter casts one Ballot with
+ * NewBallot, its registered nonce refusing a second one, and
+ * BlockChain.TallyPoll of package core counts the ballots on chain.
+ */
+package voting
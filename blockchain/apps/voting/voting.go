@@ -0,0 +1,44 @@
+// Voting, see internal/chain/voting.go
+
+package voting
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	// Name of the application in the apps of a genesis spec
+	APP_VOTING = chain.APP_VOTING
+
+	// Schema of the ballots
+	BALLOT_SCHEMA = chain.BALLOT_SCHEMA
+
+	POLL_NAMESPACE_PREFIX = chain.POLL_NAMESPACE_PREFIX
+	POLL_SPEC_KEY         = chain.POLL_SPEC_KEY
+	POLL_VOTER_PREFIX     = chain.POLL_VOTER_PREFIX // followed by the account, holding its ballot nonce
+)
+
+// Written by the organizer of a poll, at most MAX_KV_VALUE_SIZE bytes of JSON
+type PollSpec = chain.PollSpec
+
+type Ballot = chain.Ballot
+
+type PollChoice = chain.PollChoice
+
+type PollTally = chain.PollTally
+
+// Open the poll id, or change its spec, as organizer
+func NewPoll(organizer string, nonce uint64, id string, spec PollSpec) (core.Transaction, error) {
+	return chain.NewPoll(organizer, nonce, id, spec)
+}
+
+// Let voter cast a ballot in the poll id with its nonce ballotNonce, as organizer
+func NewPollVoter(organizer string, nonce uint64, id, voter string, ballotNonce uint64) core.Transaction {
+	return chain.NewPollVoter(organizer, nonce, id, voter, ballotNonce)
+}
+
+// Ballot of voter for choice in poll, nonce being the one it was registered with
+func NewBallot(voter string, nonce uint64, poll, choice string) (core.Transaction, error) {
+	return chain.NewBallot(voter, nonce, poll, choice)
+}
@@ -0,0 +1,51 @@
+package voting
+
+import (
+	"testing"
+
+	"github.com/sagardixit84/elements/blockchain/core"
+)
+
+// A registered voter casts one ballot, counted by the tally, and a second one is refused
+func TestVoteOnce(t *testing.T) {
+	g := core.DefaultGenesis(1)
+	g.Alloc = map[string]core.Amount{"alice": 10 * core.COIN, "bob": 10 * core.COIN}
+	g.Apps = []string{APP_VOTING}
+	bc := core.CreateBlockChain(g)
+	commit := func(txns ...core.Transaction) {
+		t.Helper()
+		for _, txn := range txns {
+			if err := bc.AddTxn(txn); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := bc.CommitBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll, err := NewPoll("bob", 0, "lunch", PollSpec{Choices: []string{"pizza", "salad"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit(poll, NewPollVoter("bob", 1, "lunch", "alice", 0))
+	ballot, err := NewBallot("alice", 0, "lunch", "salad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit(ballot)
+
+	again, err := NewBallot("alice", 1, "lunch", "pizza")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTxn(again); err == nil {
+		t.Fatal("second ballot of alice accepted")
+	}
+	tally, err := bc.TallyPoll("lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tally.Ballots != 1 || tally.Votes[0].Votes != 0 || tally.Votes[1].Votes != 1 {
+		t.Fatalf("tally %+v, expected one vote for salad", tally)
+	}
+}
@@ -0,0 +1,56 @@
+// Chain test helpers, see internal/chain/chaintest.go
+
+package chaintest
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	// Most transactions in a Block of Next, when the block limits allow more
+	TEST_CHAIN_BLOCK_TXNS = chain.TEST_CHAIN_BLOCK_TXNS
+
+	CORRUPT_PARENT     = chain.CORRUPT_PARENT     // extends another Block
+	CORRUPT_HASH       = chain.CORRUPT_HASH       // hash not of its header
+	CORRUPT_WORK       = chain.CORRUPT_WORK       // hash above the target of its difficulty
+	CORRUPT_DIFFICULTY = chain.CORRUPT_DIFFICULTY // mined at a difficulty other than the chain's
+	CORRUPT_MERKLE     = chain.CORRUPT_MERKLE     // transaction tampered with after mining
+	CORRUPT_TIMESTAMP  = chain.CORRUPT_TIMESTAMP  // stamped before the median time past
+	CORRUPT_OVERSPEND  = chain.CORRUPT_OVERSPEND  // transfer above the balance of its payer
+	CORRUPT_NONCE      = chain.CORRUPT_NONCE      // transfer skipping a nonce of its payer
+)
+
+var CORRUPTIONS = chain.CORRUPTIONS
+
+// Way of breaking a valid Block
+type Corruption = chain.Corruption
+
+// Chain growing random Blocks from a seed
+type TestChain = chain.TestChain
+
+// Genesis spec funding accounts, at least 2, with 1000 each at difficulty 2
+func TestGenesis(accounts int) core.Genesis {
+	return chain.TestGenesis(accounts)
+}
+
+// Chain of genesis, at least 2 accounts of its allocation, drawing from seed
+func NewTestChain(seed uint64, genesis core.Genesis) *TestChain {
+	return chain.NewTestChain(seed, genesis)
+}
+
+/*
+ * Copy of b with the bytes of its binary encoding xored with data in turn,
+ * false when they no longer decode
+ */
+func Mutate(b core.Block, data []byte) (core.Block, bool) {
+	return chain.Mutate(b, data)
+}
+
+/*
+ * Append blocks to a fresh chain of genesis, returning how many it accepted
+ * and the failure of the first refused
+ */
+func ReplayBlocks(genesis core.Genesis, blocks []core.Block) (int, error) {
+	return chain.ReplayBlocks(genesis, blocks)
+}
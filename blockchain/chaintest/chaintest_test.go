@@ -0,0 +1,31 @@
+package chaintest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Each Corruption of a valid Block is refused with its Err, through the public API
+func TestCorruptionsRefused(t *testing.T) {
+	for seed := uint64(1); seed <= 5; seed++ {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			tc := NewTestChain(seed, TestGenesis(4))
+			if err := tc.Extend(3); err != nil {
+				t.Fatal(err)
+			}
+			b := tc.Next()
+			if err := tc.Chain().Validate(b); err != nil {
+				t.Fatalf("valid block refused: %v", err)
+			}
+			for _, c := range CORRUPTIONS {
+				if err := tc.Chain().Validate(tc.Corrupt(b, c)); !errors.Is(err, c.Err()) {
+					t.Errorf("%v: got %v, expected %v", c, err, c.Err())
+				}
+			}
+			if n, err := ReplayBlocks(tc.Genesis(), tc.Blocks()); err != nil || n != len(tc.Blocks()) {
+				t.Fatalf("replayed %v blocks: %v", n, err)
+			}
+		})
+	}
+}
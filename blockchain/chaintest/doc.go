@@ -0,0 +1,12 @@
+/*
+ * Package chaintest builds chains to test code of the toy chain against:
+ * random valid chains and transactions drawn from a seed, and Blocks broken
+ * one rule at a time, for property tests and fuzzing of Validate.
+ *
+ *	tc := chaintest.NewTestChain(seed, chaintest.TestGenesis(4))
+ *	tc.Extend(10)                                // ten Blocks of random transfers
+ *	b := tc.Next()                               // a valid next Block, not appended
+ *	bad := tc.Corrupt(b, chaintest.CORRUPT_WORK) // refused with CORRUPT_WORK.Err()
+ *	err := tc.Chain().Validate(bad)
+ */
+package chaintest
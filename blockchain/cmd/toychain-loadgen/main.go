@@ -0,0 +1,81 @@
+/*
+ * The toychain-loadgen command: streams transfers between random wallets at
+ * the node API at -node, and reports acceptance, inclusion latency and
+ * throughput, see internal/chain/loadgen.go. The node mines the transfers
+ * itself, started with -mine or -dev:
+ *
+ *	toy_blockchain -dev -http :8080 &
+ *	toychain-loadgen -node http://localhost:8080 -tps 100 -duration 30s
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/rpc"
+)
+
+// Flag of an Amount in coins, eg. 0.01
+type amountFlag struct{ amt *core.Amount }
+
+func (f amountFlag) String() string {
+	if f.amt == nil {
+		return ""
+	}
+	return fmt.Sprint(*f.amt)
+}
+
+func (f amountFlag) Set(s string) error {
+	amt, err := core.ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*f.amt = amt
+	return nil
+}
+
+func main() {
+	cfg := rpc.DefaultLoadGenConfig("")
+	flag.StringVar(&cfg.Node, "node", "", "URL of the node API to send the transfers to, eg. http://localhost:8080")
+	flag.StringVar(&cfg.From, "from", cfg.From, "account of the node funding the wallets")
+	flag.IntVar(&cfg.Wallets, "wallets", cfg.Wallets, "random wallets sending transfers")
+	flag.Var(amountFlag{&cfg.Fund}, "fund", "coins sent to each wallet before the load")
+	flag.Var(amountFlag{&cfg.Amount}, "amount", "coins of each transfer")
+	flag.Var(amountFlag{&cfg.Fee}, "fee", "fee of each transfer, in coins")
+	flag.Float64Var(&cfg.TPS, "tps", cfg.TPS, "transfers sent per second")
+	flag.DurationVar(&cfg.Duration, "duration", cfg.Duration, "time spent sending transfers")
+	flag.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the payers and payees picked")
+	outputMode := flag.String("output", "table", "output of the report: table, json, csv or quiet, the key column only")
+	flag.Parse()
+	if cfg.Node == "" {
+		log.Fatal("-node is required")
+	}
+	mode, err := rpc.ParseOutputMode(*outputMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := rpc.NewOutput(mode, os.Stdout)
+
+	out.Note("%v wallets sending %v transfers/s to %v for %v", cfg.Wallets, cfg.TPS, cfg.Node, cfg.Duration)
+	r, err := rpc.RunLoadGen(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fields := [][2]string{
+		{"sent", fmt.Sprintf("%v, %.1f/s", r.Sent, r.SendRate)},
+		{"accepted", fmt.Sprintf("%v, %.1f%%", r.Accepted, 100*r.AcceptanceRate)},
+		{"included", fmt.Sprint(r.Included)},
+		{"throughput", fmt.Sprintf("%.1f txns/s", r.Throughput)},
+		{"latency", fmt.Sprintf("mean %.2fs, p95 %.2fs, max %.2fs", r.MeanLatency, r.P95Latency, r.MaxLatency)},
+	}
+	if r.FirstError != "" {
+		fields = append(fields, [2]string{"first error", r.FirstError})
+	}
+	if err := out.Record(fields, r); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+// BFT consensus among a committee of validators, Tendermint-style, see internal/chain/bft.go
+
+package consensus
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	// Rounds at a height before giving up with ErrNoQuorum
+	BFT_MAX_ROUNDS = chain.BFT_MAX_ROUNDS
+
+	// Time of the clock of the committee between two readings
+	BFT_CLOCK_STEP = chain.BFT_CLOCK_STEP
+
+	// Heights the committees of -bft-sim commit
+	BFT_SIM_HEIGHTS = chain.BFT_SIM_HEIGHTS
+
+	BFT_PREVOTE    = chain.BFT_PREVOTE
+	BFT_PRECOMMIT  = chain.BFT_PRECOMMIT
+	BFT_HONEST     = chain.BFT_HONEST
+	BFT_OFFLINE    = chain.BFT_OFFLINE
+	BFT_EQUIVOCATE = chain.BFT_EQUIVOCATE
+)
+
+// Behaviour of a validator, see above
+type BFTFault = chain.BFTFault
+
+type BFTVote = chain.BFTVote
+
+// Precommits of more than 2/3 of the committee for the Block committed at a height
+type BFTCommit = chain.BFTCommit
+
+type Committee = chain.Committee
+
+// Committee of n honest validators, validator0 to validator<n-1>, each on a replica of the chain of genesis
+func NewCommittee(n int, genesis core.Genesis) (*Committee, error) {
+	return chain.NewCommittee(n, genesis)
+}
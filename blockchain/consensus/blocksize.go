@@ -0,0 +1,10 @@
+// Block size limit, see internal/chain/blocksize.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const DEFAULT_MAX_BLOCK_BYTES = chain.DEFAULT_MAX_BLOCK_BYTES
+
+// Limits of the Blocks of a chain besides BLOCK_GAS_LIMIT
+type BlockLimits = chain.BlockLimits
@@ -0,0 +1,34 @@
+// Genesis ceremony for multi-party chains, see internal/chain/ceremony.go
+
+package consensus
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+type CeremonyContribution = chain.CeremonyContribution
+
+// Read every *.json contribution in dir
+func LoadContributions(dir string) ([]CeremonyContribution, error) {
+	return chain.LoadContributions(dir)
+}
+
+/*
+ * Merge contributions into base, independently of their order
+ * Two contributions allocating to the same account or registering the
+ * same validator are rejected rather than silently combined
+ */
+func AssembleGenesis(base core.Genesis, contributions []CeremonyContribution) (core.Genesis, error) {
+	return chain.AssembleGenesis(base, contributions)
+}
+
+// Check g produces the genesis Block hash everyone agreed on
+func VerifyGenesis(g core.Genesis, expectedHash string) error {
+	return chain.VerifyGenesis(g, expectedHash)
+}
+
+// Write the contribution of participant to dir/participant.json
+func WriteContribution(dir, participant string, alloc, validatorKey string) error {
+	return chain.WriteContribution(dir, participant, alloc, validatorKey)
+}
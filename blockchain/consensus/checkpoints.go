@@ -0,0 +1,13 @@
+// Trusted checkpoints, see internal/chain/checkpoints.go
+
+package consensus
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+// Parse comma separated checkpoints written HEIGHT:HASH
+func ParseCheckpoints(s string) ([]core.Checkpoint, error) {
+	return chain.ParseCheckpoints(s)
+}
@@ -0,0 +1,21 @@
+// Conformance suite for consensus rules, see internal/chain/conformance.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type ConformanceStep = chain.ConformanceStep
+
+type ConformanceFixture = chain.ConformanceFixture
+
+type ConformanceResult = chain.ConformanceResult
+
+// Run every *.json fixture in dir
+func RunConformance(dir string) ([]ConformanceResult, error) {
+	return chain.RunConformance(dir)
+}
+
+// Regenerate the fixture files in dir from the current rules
+func WriteConformance(dir string) error {
+	return chain.WriteConformance(dir)
+}
@@ -0,0 +1,10 @@
+// Devnets, see internal/chain/devnet.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MIN_DEV_DIFFICULTY = chain.MIN_DEV_DIFFICULTY
+	MAX_DEV_DIFFICULTY = chain.MAX_DEV_DIFFICULTY
+)
@@ -0,0 +1,7 @@
+/*
+ * Package consensus holds the rules a block must follow: proof of work,
+ * difficulty retargeting, timestamps, block limits, validators and policies,
+ * checkpoints, the BFT committee, the genesis ceremony, and the conformance
+ * fixtures and signing vectors other clients check themselves against.
+ */
+package consensus
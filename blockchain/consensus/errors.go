@@ -0,0 +1,13 @@
+// Errors of the API, see internal/chain/errors.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+var (
+	ErrWrongDifficulty  = chain.ErrWrongDifficulty  // see retarget.go
+	ErrInvalidTimestamp = chain.ErrInvalidTimestamp // see timestamps.go
+	ErrNoQuorum         = chain.ErrNoQuorum         // see bft.go
+	ErrForked           = chain.ErrForked           // see bft.go
+	ErrInvalidCommit    = chain.ErrInvalidCommit    // see bft.go
+)
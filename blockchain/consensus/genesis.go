@@ -0,0 +1,7 @@
+// Genesis specification of a BlockChain, see internal/chain/genesis.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type GenesisValidator = chain.GenesisValidator
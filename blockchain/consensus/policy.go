@@ -0,0 +1,10 @@
+// Node policies, see internal/chain/policy.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Rules of the JSON policy file at path
+func LoadPolicy(path string) ([]RuleSpec, error) {
+	return chain.LoadPolicy(path)
+}
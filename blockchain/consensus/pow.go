@@ -0,0 +1,23 @@
+// Proof Of Work algorithms, see internal/chain/pow.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	POW_SHA256   = chain.POW_SHA256
+	POW_SCRYPT   = chain.POW_SCRYPT
+	POW_SCRYPT_N = chain.POW_SCRYPT_N
+	POW_SCRYPT_R = chain.POW_SCRYPT_R
+	POW_SCRYPT_P = chain.POW_SCRYPT_P
+
+	// Most memory a scrypt try may take, 64MB
+	POW_SCRYPT_MAX_MEMORY = chain.POW_SCRYPT_MAX_MEMORY
+)
+
+type PowSpec = chain.PowSpec
+
+// Spec of the algorithm named name with its default parameters, nil for SHA-256
+func NewPowSpec(name string) (*PowSpec, error) {
+	return chain.NewPowSpec(name)
+}
@@ -0,0 +1,21 @@
+// Difficulty retargeting, see internal/chain/retarget.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	RETARGET_WINDOW         = chain.RETARGET_WINDOW
+	RETARGET_LWMA           = chain.RETARGET_LWMA
+	MIN_RETARGET_DIFFICULTY = chain.MIN_RETARGET_DIFFICULTY
+	MAX_RETARGET_DIFFICULTY = chain.MAX_RETARGET_DIFFICULTY
+	RETARGET_MAX_SOLVE      = chain.RETARGET_MAX_SOLVE // longest solve time counted, in intervals
+	RETARGET_MAX_WINDOW     = chain.RETARGET_MAX_WINDOW
+)
+
+type RetargetSpec = chain.RetargetSpec
+
+// Retarget of algorithm aiming at a Block a minute, averaging 45 Blocks
+func DefaultRetargetSpec(algorithm string) RetargetSpec {
+	return chain.DefaultRetargetSpec(algorithm)
+}
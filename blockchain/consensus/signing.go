@@ -0,0 +1,16 @@
+// Transaction signing test vectors, see internal/chain/signing.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type SigningVector = chain.SigningVector
+
+// Vectors covering every part of the payload, signed by the key of alice
+func SigningVectors() ([]SigningVector, error) {
+	return chain.SigningVectors()
+}
+
+func WriteSigningVectors(path string) error {
+	return chain.WriteSigningVectors(path)
+}
@@ -0,0 +1,13 @@
+// Block timestamp rules, see internal/chain/timestamps.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Blocks whose median time the next one must be past
+	MEDIAN_TIME_BLOCKS = chain.MEDIAN_TIME_BLOCKS
+
+	// Furthest a Block may be stamped ahead of the clock of the node checking it
+	MAX_FUTURE_BLOCK_TIME = chain.MAX_FUTURE_BLOCK_TIME
+)
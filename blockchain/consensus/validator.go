@@ -0,0 +1,21 @@
+// Pluggable transaction validation, see internal/chain/validator.go
+
+package consensus
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	RULE_MAX_AMOUNT  = chain.RULE_MAX_AMOUNT
+	RULE_ALLOW_LIST  = chain.RULE_ALLOW_LIST
+	RULE_DATA_FIELDS = chain.RULE_DATA_FIELDS
+	RULE_FREEZE      = chain.RULE_FREEZE
+	RULE_RECIPIENTS  = chain.RULE_RECIPIENTS
+)
+
+type Validator = chain.Validator
+
+// Function used as a Validator
+type ValidatorFunc = chain.ValidatorFunc
+
+// Built-in rule of a genesis spec
+type RuleSpec = chain.RuleSpec
@@ -0,0 +1,8 @@
+// Access lists and parallel execution, see internal/chain/accesslist.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Max keys of an access list
+const MAX_ACCESS_LIST = chain.MAX_ACCESS_LIST
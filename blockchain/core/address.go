@@ -0,0 +1,27 @@
+// Addresses derived from public keys, see internal/chain/address.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	ADDRESS_HASH_SIZE  = chain.ADDRESS_HASH_SIZE
+	ADDRESS_PREFIX     = chain.ADDRESS_PREFIX // prefix of -derive when no genesis is given
+	ADDRESS_PREFIX_MAX = chain.ADDRESS_PREFIX_MAX
+	BECH32_CHARSET     = chain.BECH32_CHARSET
+	BECH32_MAX_LENGTH  = chain.BECH32_MAX_LENGTH
+)
+
+// Address of pubKey on the network of prefix
+func NewAddress(pubKey []byte, prefix string) string {
+	return chain.NewAddress(pubKey, prefix)
+}
+
+/*
+ * Check address is a well formed address of the network of prefix,
+ * returning the public key hash it encodes
+ * Fails with ErrInvalidAddress
+ */
+func ParseAddress(address, prefix string) ([]byte, error) {
+	return chain.ParseAddress(address, prefix)
+}
@@ -0,0 +1,16 @@
+// Transaction history of accounts, see internal/chain/addressindex.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	HISTORY_IN   = chain.HISTORY_IN   // the account receives
+	HISTORY_OUT  = chain.HISTORY_OUT  // the account pays
+	HISTORY_SELF = chain.HISTORY_SELF // both, eg. a party to a swap or a transfer to oneself
+
+	// Most transactions GET /history returns
+	MAX_HISTORY_TXNS = chain.MAX_HISTORY_TXNS
+)
+
+type HistoryEntry = chain.HistoryEntry
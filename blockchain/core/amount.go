@@ -0,0 +1,26 @@
+// Amounts, see internal/chain/amount.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Base units of a coin
+	AMOUNT_DECIMALS = chain.AMOUNT_DECIMALS
+
+	COIN       = chain.COIN
+	MAX_AMOUNT = chain.MAX_AMOUNT // of a single amount, so that sums of a few do not overflow
+)
+
+// Quantity of an asset in base units
+type Amount = chain.Amount
+
+// Amount of the decimal coins s, eg. "1.5" or "2e-3"
+func ParseAmount(s string) (Amount, error) {
+	return chain.ParseAmount(s)
+}
+
+// Amount of coins, rounded to the nearest base unit, for amounts derived from ratios
+func CoinsAmount(coins float64) Amount {
+	return chain.CoinsAmount(coins)
+}
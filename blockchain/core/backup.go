@@ -0,0 +1,38 @@
+// Scheduled backups, see internal/chain/backup.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Default time between two backups
+	BACKUP_INTERVAL = chain.BACKUP_INTERVAL
+
+	// Key of the manifest in the backup store
+	BACKUP_MANIFEST = chain.BACKUP_MANIFEST
+)
+
+type BackupPolicy = chain.BackupPolicy
+
+type BackupPoint = chain.BackupPoint
+
+type BackupManifest = chain.BackupManifest
+
+// A backup every BACKUP_INTERVAL, keeping the restore points of a day
+func DefaultBackupPolicy() BackupPolicy {
+	return chain.DefaultBackupPolicy()
+}
+
+// Manifest of the backups in store, empty if there are none
+func ReadBackupManifest(store ObjectStore) (BackupManifest, error) {
+	return chain.ReadBackupManifest(store)
+}
+
+/*
+ * Rebuild the chain backed up in store up to the restore point at height,
+ * 0 for the latest, validating every Block and checking the state root of
+ * every restore point on the way
+ */
+func RestoreBackup(store ObjectStore, height int) (BlockChain, error) {
+	return chain.RestoreBackup(store, height)
+}
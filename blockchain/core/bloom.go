@@ -0,0 +1,10 @@
+// Address blooms, see internal/chain/bloom.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	BLOOM_SIZE   = chain.BLOOM_SIZE   // bytes, 2048 bits
+	BLOOM_HASHES = chain.BLOOM_HASHES // bits set per account
+)
@@ -0,0 +1,34 @@
+// Block assembly strategies, see internal/chain/builder.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	BUILDER_FEE    = chain.BUILDER_FEE
+	BUILDER_FIFO   = chain.BUILDER_FIFO
+	BUILDER_RANDOM = chain.BUILDER_RANDOM
+)
+
+type BlockBuilder = chain.BlockBuilder
+
+// Function used as a BlockBuilder
+type BlockBuilderFunc = chain.BlockBuilderFunc
+
+// Highest fee first, ties broken by arrival, the default
+type FeeBuilder = chain.FeeBuilder
+
+// First come first served
+type FIFOBuilder = chain.FIFOBuilder
+
+// Random order drawn from a seed
+type RandomBuilder = chain.RandomBuilder
+
+func NewRandomBuilder(seed uint64) *RandomBuilder {
+	return chain.NewRandomBuilder(seed)
+}
+
+// Built-in builder called name, a random one drawing from seed, or from the time if 0
+func NewBlockBuilder(name string, seed uint64) (BlockBuilder, error) {
+	return chain.NewBlockBuilder(name, seed)
+}
@@ -0,0 +1,13 @@
+// Lookup caches, see internal/chain/cache.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type CacheSizes = chain.CacheSizes
+
+type CacheStats = chain.CacheStats
+
+func DefaultCacheSizes() CacheSizes {
+	return chain.DefaultCacheSizes()
+}
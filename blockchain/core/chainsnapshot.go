@@ -0,0 +1,7 @@
+// Read-only chain snapshots, see internal/chain/chainsnapshot.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type ChainSnapshot = chain.ChainSnapshot
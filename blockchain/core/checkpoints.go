@@ -0,0 +1,7 @@
+// Trusted checkpoints, see internal/chain/checkpoints.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type Checkpoint = chain.Checkpoint
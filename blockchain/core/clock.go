@@ -0,0 +1,29 @@
+// Deterministic mode, see internal/chain/clock.go
+
+package core
+
+import (
+	"time"
+
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+type Clock = chain.Clock
+
+// Clock reading the system time
+type SystemClock = chain.SystemClock
+
+// Clock starting at a given time and moving by step at each reading
+type StepClock = chain.StepClock
+
+type NonceStrategy = chain.NonceStrategy
+
+// Nonces tried from 0, the default
+type SequentialNonces = chain.SequentialNonces
+
+// Nonces tried from a start drawn from seed and the Header
+type SeededNonces = chain.SeededNonces
+
+func NewStepClock(start time.Time, step time.Duration) *StepClock {
+	return chain.NewStepClock(start, step)
+}
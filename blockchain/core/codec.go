@@ -0,0 +1,13 @@
+// Binary encoding of Blocks and transactions, see internal/chain/codec.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	BINARY_V1 = chain.BINARY_V1 // protobuf messages of toychain.proto, amounts being doubles of coins
+	BINARY_V2 = chain.BINARY_V2 // amounts being int64 base units, see amount.go
+
+	// Largest binary body read from a request
+	MAX_BINARY_BODY = chain.MAX_BINARY_BODY
+)
@@ -0,0 +1,15 @@
+// Devnets, see internal/chain/devnet.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	DEV_ACCOUNT = chain.DEV_ACCOUNT
+	DEV_FUNDS   = chain.DEV_FUNDS
+)
+
+// Genesis of -dev nodes, a devnet of difficulty 0 funding DEV_ACCOUNT
+func DevGenesis() Genesis {
+	return chain.DevGenesis()
+}
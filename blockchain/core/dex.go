@@ -0,0 +1,29 @@
+// Order book exchange between assets, driven purely by chain state, see internal/chain/dex.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Trades kept per order book for display
+	MAX_TRADES_PER_BOOK = chain.MAX_TRADES_PER_BOOK
+
+	Buy  = chain.Buy  // buy base asset, paying with quote asset
+	Sell = chain.Sell // sell base asset for quote asset
+)
+
+type OrderSide = chain.OrderSide
+
+type Order = chain.Order
+
+type Trade = chain.Trade
+
+type OrderBook = chain.OrderBook
+
+func NewOrder(payer string, nonce uint64, side OrderSide, base, quote string, price, amount Amount) Transaction {
+	return chain.NewOrder(payer, nonce, side, base, quote, price, amount)
+}
+
+func NewCancelOrder(payer string, nonce uint64, orderID string) Transaction {
+	return chain.NewCancelOrder(payer, nonce, orderID)
+}
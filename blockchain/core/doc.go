@@ -0,0 +1,10 @@
+/*
+ * Package core is the ledger of the toy chain: transactions, blocks, the
+ * BlockChain with its state, mempool and stores, and the amounts, addresses
+ * and transaction kinds they are built from.
+ *
+ * The names are aliases of internal/chain, so a core.BlockChain is the value
+ * every other package of the module takes, and its methods are listed by
+ * API.md under the package they belong to.
+ */
+package core
@@ -0,0 +1,26 @@
+// Node self-diagnostics, see internal/chain/doctor.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MAX_CLOCK_SKEW = chain.MAX_CLOCK_SKEW // tolerated gap between clocks
+	MAX_PEER_LEAD  = chain.MAX_PEER_LEAD  // Blocks a peer may be ahead before we count as behind
+	Critical       = chain.Critical       // the node serves wrong data or cannot work
+	Warning        = chain.Warning        // the node works but needs attention
+	Notice         = chain.Notice         // worth knowing, nothing to fix
+)
+
+type Severity = chain.Severity
+
+type Finding = chain.Finding
+
+type DoctorReport = chain.DoctorReport
+
+type DoctorConfig = chain.DoctorConfig
+
+// Check bc and its surroundings, see doctor.go
+func Diagnose(bc *BlockChain, config DoctorConfig) DoctorReport {
+	return chain.Diagnose(bc, config)
+}
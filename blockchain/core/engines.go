@@ -0,0 +1,32 @@
+// Storage engines, see internal/chain/engines.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	STORE_MEMORY        = chain.STORE_MEMORY
+	STORE_FILE          = chain.STORE_FILE
+	STORE_LOG           = chain.STORE_LOG
+	STORE_BOLT          = chain.STORE_BOLT
+	STORE_JOURNAL       = chain.STORE_JOURNAL       // of the file engine, in its directory
+	STORE_LOG_FILE      = chain.STORE_LOG_FILE      // of the log engine, in its directory
+	STORE_BOLT_FILE     = chain.STORE_BOLT_FILE     // of the bolt engine, in its directory
+	STORE_BOLT_BUCKET   = chain.STORE_BOLT_BUCKET   // holding every key of the bolt engine
+	STORE_BOLT_TIMEOUT  = chain.STORE_BOLT_TIMEOUT  // waited for the lock of a BoltDB file another process holds
+	STORE_COMPACT_BYTES = chain.STORE_COMPACT_BYTES // overwritten bytes left in the log file before compacting it
+)
+
+var STORE_ENGINES = chain.STORE_ENGINES
+
+// ObjectStore writing batches all or none and iterating over its keys
+type Store = chain.Store
+
+// Store of engine, in the directory dir unless held in memory
+func OpenStore(engine, dir string) (Store, error) {
+	return chain.OpenStore(engine, dir)
+}
+
+func NewMemoryEngine() Store {
+	return chain.NewMemoryEngine()
+}
@@ -0,0 +1,90 @@
+// Errors of the API, see internal/chain/errors.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+var (
+	// Transaction admission and validation
+	ErrInvalidTxn = chain.ErrInvalidTxn // malformed, fails the stateless checks
+
+	ErrInvalidSignature  = chain.ErrInvalidSignature // missing, wrong or made with a key the signer does not own
+	ErrScriptFailed      = chain.ErrScriptFailed
+	ErrInvalidNonce      = chain.ErrInvalidNonce // not the next nonce of the payer
+	ErrNonceTaken        = chain.ErrNonceTaken   // double spend attempt in the Mempool
+	ErrInsufficientFunds = chain.ErrInsufficientFunds
+	ErrOutOfGas          = chain.ErrOutOfGas
+	ErrFeeAsset          = chain.ErrFeeAsset    // see feeassets.go
+	ErrWrongChain        = chain.ErrWrongChain  // see chainid.go
+	ErrTokenExists       = chain.ErrTokenExists // see tokens.go
+	ErrLocked            = chain.ErrLocked      // see timelocks.go
+	ErrFeeTooLow         = chain.ErrFeeTooLow   // see mempoollimits.go
+	ErrPolicy            = chain.ErrPolicy      // see policy.go
+	ErrUnderpriced       = chain.ErrUnderpriced // see replace.go
+
+	// Block validation
+	ErrBlockFull = chain.ErrBlockFull
+
+	ErrInvalidPrevHash   = chain.ErrInvalidPrevHash
+	ErrInvalidBlockHash  = chain.ErrInvalidBlockHash
+	ErrInvalidMerkleRoot = chain.ErrInvalidMerkleRoot
+	ErrInsufficientWork  = chain.ErrInsufficientWork
+	ErrCheckpoint        = chain.ErrCheckpoint
+	ErrInvalidProof      = chain.ErrInvalidProof
+	ErrInvalidRetarget   = chain.ErrInvalidRetarget
+	ErrInvalidAddress    = chain.ErrInvalidAddress // malformed, or of another network
+	ErrLighterBranch     = chain.ErrLighterBranch
+	ErrRuleViolation     = chain.ErrRuleViolation     // see validator.go
+	ErrStateRootMismatch = chain.ErrStateRootMismatch // see stateroots.go
+	ErrBloomMismatch     = chain.ErrBloomMismatch     // see bloom.go
+	ErrWrongVersion      = chain.ErrWrongVersion      // see upgrades.go
+
+	// Queries
+	ErrUnknownHeight = chain.ErrUnknownHeight
+
+	ErrPruned       = chain.ErrPruned       // see pruning.go
+	ErrUnknownPoll  = chain.ErrUnknownPoll  // see voting.go
+	ErrUnknownToken = chain.ErrUnknownToken // see tokens.go
+	ErrUnknownName  = chain.ErrUnknownName  // see names.go
+	ErrNotPending   = chain.ErrNotPending   // see replace.go
+
+	// Keystore
+	ErrAccountExists = chain.ErrAccountExists
+
+	ErrUnknownAccount  = chain.ErrUnknownAccount
+	ErrWrongPassphrase = chain.ErrWrongPassphrase
+	ErrFrozenOutput    = chain.ErrFrozenOutput
+	ErrSignerRefused   = chain.ErrSignerRefused
+	ErrSignerToken     = chain.ErrSignerToken
+
+	// HD wallets
+	ErrInvalidMnemonic = chain.ErrInvalidMnemonic
+
+	ErrInvalidPath = chain.ErrInvalidPath
+
+	// Node
+	ErrEmptyMempool = chain.ErrEmptyMempool
+
+	ErrMempoolFull      = chain.ErrMempoolFull
+	ErrRateLimited      = chain.ErrRateLimited // see ratelimit.go
+	ErrReadReplica      = chain.ErrReadReplica
+	ErrDevOnly          = chain.ErrDevOnly
+	ErrRelayDisabled    = chain.ErrRelayDisabled
+	ErrPlaintextPeer    = chain.ErrPlaintextPeer
+	ErrInvalidAlert     = chain.ErrInvalidAlert
+	ErrNoSnapshots      = chain.ErrNoSnapshots
+	ErrInvalidReceipt   = chain.ErrInvalidReceipt
+	ErrNoBackups        = chain.ErrNoBackups
+	ErrInvalidBackup    = chain.ErrInvalidBackup
+	ErrInvalidPeer      = chain.ErrInvalidPeer // malformed URL, or of another chain
+	ErrUnknownPeer      = chain.ErrUnknownPeer
+	ErrInvalidWebhook   = chain.ErrInvalidWebhook
+	ErrUnknownWebhook   = chain.ErrUnknownWebhook
+	ErrAdminToken       = chain.ErrAdminToken // see admin.go
+	ErrInvalidEventSink = chain.ErrInvalidEventSink
+	ErrOtherChain       = chain.ErrOtherChain       // see handshake.go
+	ErrIncompatiblePeer = chain.ErrIncompatiblePeer // see handshake.go
+
+	// Transport
+	ErrNoiseHandshake = chain.ErrNoiseHandshake
+)
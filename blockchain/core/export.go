@@ -0,0 +1,35 @@
+// Export and import of a full chain as JSON lines, see internal/chain/export.go
+
+package core
+
+import (
+	"io"
+
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	EXPORT_FORMAT = chain.EXPORT_FORMAT
+
+	// Version of the export format written by Export
+	EXPORT_VERSION = chain.EXPORT_VERSION
+
+	// Oldest version Import reads, Blocks of version 1 hash differently
+	MIN_EXPORT_VERSION = chain.MIN_EXPORT_VERSION
+)
+
+/*
+ * Rebuild a chain written by Export, validating every Block, but for the
+ * Proof Of Work of those up to the last of checkpoints
+ */
+func Import(r io.Reader, checkpoints ...Checkpoint) (BlockChain, error) {
+	return chain.Import(r, checkpoints...)
+}
+
+func ExportFile(bc BlockChain, path string) error {
+	return chain.ExportFile(bc, path)
+}
+
+func ImportFile(path string, checkpoints ...Checkpoint) (BlockChain, error) {
+	return chain.ImportFile(path, checkpoints...)
+}
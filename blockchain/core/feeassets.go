@@ -0,0 +1,13 @@
+// Fees paid in tokens, see internal/chain/feeassets.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Key-value namespace of the fee rates, owned by the fee oracle
+const FEE_RATES_NAMESPACE = chain.FEE_RATES_NAMESPACE
+
+// Write by oracle of the rate of asset, in coins per unit, 0 to withdraw it
+func NewFeeRate(oracle string, nonce uint64, asset string, rate float64) Transaction {
+	return chain.NewFeeRate(oracle, nonce, asset, rate)
+}
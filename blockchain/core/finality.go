@@ -0,0 +1,8 @@
+// Confirmations and finality, see internal/chain/finality.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Confirmations after which a transaction is considered final by default
+const FINALITY_DEPTH = chain.FINALITY_DEPTH
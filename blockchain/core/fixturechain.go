@@ -0,0 +1,12 @@
+// Fixture chain, see internal/chain/fixturechain.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const FIXTURE_CHAIN_FILE = chain.FIXTURE_CHAIN_FILE
+
+// The embedded fixture chain, a fresh copy on each call
+func LoadFixtureChain() (BlockChain, error) {
+	return chain.LoadFixtureChain()
+}
@@ -0,0 +1,16 @@
+// Gas accounting, see internal/chain/gas.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	GAS_TRANSFER     = chain.GAS_TRANSFER
+	GAS_SWAP_LEG     = chain.GAS_SWAP_LEG
+	GAS_ORDER        = chain.GAS_ORDER
+	GAS_CANCEL_ORDER = chain.GAS_CANCEL_ORDER
+	GAS_DATA_BYTE    = chain.GAS_DATA_BYTE // per byte of the data of a transaction
+
+	// Max bytes of the data of a transaction, enough for a hash or a short message
+	MAX_TXN_DATA = chain.MAX_TXN_DATA
+)
@@ -0,0 +1,17 @@
+// Genesis specification of a BlockChain, see internal/chain/genesis.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type Genesis = chain.Genesis
+
+// Empty genesis with the given difficulty
+func DefaultGenesis(difficulty int) Genesis {
+	return chain.DefaultGenesis(difficulty)
+}
+
+// Read a genesis spec from a JSON file
+func LoadGenesis(path string) (Genesis, error) {
+	return chain.LoadGenesis(path)
+}
@@ -0,0 +1,37 @@
+// On-chain governance of chain parameters, see internal/chain/governance.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Key-value namespace of a governor, followed by its name
+	GOVERNANCE_NAMESPACE_PREFIX = chain.GOVERNANCE_NAMESPACE_PREFIX
+
+	// Blocks at least from the write of a change to its height, unless the genesis says otherwise
+	GOVERNANCE_DELAY = chain.GOVERNANCE_DELAY
+
+	PARAM_REWARD      = chain.PARAM_REWARD
+	PARAM_BLOCK_BYTES = chain.PARAM_BLOCK_BYTES
+	PARAM_BLOCK_TXNS  = chain.PARAM_BLOCK_TXNS
+	PARAM_DIFFICULTY  = chain.PARAM_DIFFICULTY
+)
+
+var PARAMS = chain.PARAMS
+
+type GovernanceSpec = chain.GovernanceSpec
+
+// Change of a parameter holding from a height on
+type ParamChange = chain.ParamChange
+
+type ParamsInfo = chain.ParamsInfo
+
+// Write by governor of the change of param, other than the reward, to value from height on
+func NewParamChange(governor string, nonce uint64, param string, value float64, height int) Transaction {
+	return chain.NewParamChange(governor, nonce, param, value, height)
+}
+
+// Write by governor of the change of the reward to reward from height on
+func NewRewardChange(governor string, nonce uint64, reward Amount, height int) Transaction {
+	return chain.NewRewardChange(governor, nonce, reward, height)
+}
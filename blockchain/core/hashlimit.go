@@ -0,0 +1,8 @@
+// Hash rate limit, see internal/chain/hashlimit.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Waits of a limited miner per second, so the tries spread evenly
+const HASH_LIMIT_WAITS = chain.HASH_LIMIT_WAITS
@@ -0,0 +1,11 @@
+// Historic state queries, see internal/chain/history.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Blocks between two states kept in archive mode
+const ARCHIVE_INTERVAL = chain.ARCHIVE_INTERVAL
+
+// Read-only state as of a Block
+type StateView = chain.StateView
@@ -0,0 +1,12 @@
+// Block rewards and monetary policy, see internal/chain/issuance.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Halvings after which Blocks mint nothing
+const MAX_HALVINGS = chain.MAX_HALVINGS
+
+type IssuanceSpec = chain.IssuanceSpec
+
+type SupplyInfo = chain.SupplyInfo
@@ -0,0 +1,22 @@
+// Namespaced key-value store in chain state, see internal/chain/kv.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MAX_KV_NAMESPACE_SIZE = chain.MAX_KV_NAMESPACE_SIZE
+	MAX_KV_KEY_SIZE       = chain.MAX_KV_KEY_SIZE
+	MAX_KV_VALUE_SIZE     = chain.MAX_KV_VALUE_SIZE
+
+	// Gas of a key-value write, plus GAS_KV_BYTE per byte of key and value
+	GAS_KV_WRITE = chain.GAS_KV_WRITE
+
+	GAS_KV_BYTE = chain.GAS_KV_BYTE
+)
+
+type KVWrite = chain.KVWrite
+
+func NewKVWrite(payer string, nonce uint64, namespace, key string, value []byte) Transaction {
+	return chain.NewKVWrite(payer, nonce, namespace, key, value)
+}
@@ -0,0 +1,14 @@
+// Mempool of outstanding transactions waiting to be packed in a Block, see internal/chain/mempool.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Pending and queued transaction counts of an account
+type TxnCounts = chain.TxnCounts
+
+type Mempool = chain.Mempool
+
+func NewMempool() *Mempool {
+	return chain.NewMempool()
+}
@@ -0,0 +1,7 @@
+// Mempool limits and expiry, see internal/chain/mempoollimits.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type MempoolLimits = chain.MempoolLimits
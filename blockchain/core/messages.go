@@ -0,0 +1,30 @@
+// End-to-end encrypted direct messages, see internal/chain/messages.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Max bytes of the text of a message
+	MAX_MESSAGE_SIZE = chain.MAX_MESSAGE_SIZE
+
+	// Gas of a message, plus GAS_MESSAGE_BYTE per byte of one-time key and ciphertext
+	GAS_MESSAGE = chain.GAS_MESSAGE
+
+	GAS_MESSAGE_BYTE = chain.GAS_MESSAGE_BYTE
+
+	// Most messages GET /inbox returns
+	MAX_INBOX_MESSAGES = chain.MAX_INBOX_MESSAGES
+)
+
+type Message = chain.Message
+
+type InboxMessage = chain.InboxMessage
+
+/*
+ * Message from payer to payee, encrypted to payeeKey, the public key payee
+ * signs with
+ */
+func NewMessage(payer string, nonce uint64, payee string, payeeKey, text []byte) (Transaction, error) {
+	return chain.NewMessage(payer, nonce, payee, payeeKey, text)
+}
@@ -0,0 +1,10 @@
+// Per-Block metrics, see internal/chain/metrics.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Max Blocks returned by GET /metrics
+const MAX_METRICS = chain.MAX_METRICS
+
+type BlockMetrics = chain.BlockMetrics
@@ -0,0 +1,7 @@
+// Merkle Mountain Range of the Block hashes, see internal/chain/mmr.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type MMR = chain.MMR
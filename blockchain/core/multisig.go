@@ -0,0 +1,17 @@
+// M-of-N multisignature accounts, see internal/chain/multisig.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MAX_MULTISIG_KEYS = chain.MAX_MULTISIG_KEYS
+	GAS_MULTISIG_KEY  = chain.GAS_MULTISIG_KEY // per key declared by a TxnMultisig
+	GAS_COSIGNATURE   = chain.GAS_COSIGNATURE  // per signature carried by a transaction
+)
+
+type MultisigSpec = chain.MultisigSpec
+
+func NewMultisig(payer string, nonce uint64, threshold int, keys ...[]byte) Transaction {
+	return chain.NewMultisig(payer, nonce, threshold, keys...)
+}
@@ -0,0 +1,24 @@
+// Batch payouts, see internal/chain/payouts.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Max payouts of a transfer on top of its payee
+	MAX_PAYOUTS = chain.MAX_PAYOUTS
+
+	// Gas of each payout on top of GAS_TRANSFER
+	GAS_PAYOUT = chain.GAS_PAYOUT
+)
+
+type Payout = chain.Payout
+
+func NewPayout(payee string, amt Amount) Payout {
+	return chain.NewPayout(payee, amt)
+}
+
+// Transfer of asset from payer to the first payout's payee and all others
+func NewBatchTransfer(payer string, nonce uint64, asset string, payouts ...Payout) Transaction {
+	return chain.NewBatchTransfer(payer, nonce, asset, payouts...)
+}
@@ -0,0 +1,12 @@
+// Pruning with deletion receipts, see internal/chain/pruning.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Fewest bodies a pruned node prunes at once, so receipts come in batches
+const PRUNE_BATCH = chain.PRUNE_BATCH
+
+type PrunedBlock = chain.PrunedBlock
+
+type PruneReceipt = chain.PruneReceipt
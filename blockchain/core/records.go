@@ -0,0 +1,46 @@
+// Application-defined records, see internal/chain/records.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MAX_RECORD_SCHEMA_SIZE = chain.MAX_RECORD_SCHEMA_SIZE
+	MAX_RECORD_SIZE        = chain.MAX_RECORD_SIZE
+
+	// Gas of a record, plus GAS_RECORD_BYTE per byte of schema and JSON
+	GAS_RECORD = chain.GAS_RECORD
+
+	GAS_RECORD_BYTE = chain.GAS_RECORD_BYTE
+
+	// Most records GET /records returns
+	MAX_RECORDS = chain.MAX_RECORDS
+)
+
+// Applications built in, enabled by name in the genesis spec
+var RECORD_APPS = chain.RECORD_APPS
+
+// Application-defined content of a TxnRecord, encoded as JSON
+type Record = chain.Record
+
+type RecordTxn = chain.RecordTxn
+
+type ChainRecord = chain.ChainRecord
+
+/*
+ * Accept the records of schema, decoded as T, from now on. Registering a
+ * schema again replaces its type
+ */
+func RegisterRecord[T Record](bc *BlockChain, schema string) {
+	chain.RegisterRecord[T](bc, schema)
+}
+
+// Record of schema sent by payer
+func NewRecord[T Record](payer string, nonce uint64, schema string, record T) (Transaction, error) {
+	return chain.NewRecord[T](payer, nonce, schema, record)
+}
+
+// Record carried by txn, decoded as T
+func DecodeRecord[T Record](txn Transaction) (T, error) {
+	return chain.DecodeRecord[T](txn)
+}
@@ -0,0 +1,13 @@
+// ObjectStore backed by an S3-compatible API (AWS S3, MinIO, ...), see internal/chain/s3.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type S3Config = chain.S3Config
+
+type S3ObjectStore = chain.S3ObjectStore
+
+func NewS3ObjectStore(config S3Config, cache ObjectStore) *S3ObjectStore {
+	return chain.NewS3ObjectStore(config, cache)
+}
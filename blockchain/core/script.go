@@ -0,0 +1,18 @@
+// Transaction scripts, see internal/chain/script.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MAX_SCRIPT_OPS   = chain.MAX_SCRIPT_OPS
+	MAX_SCRIPT_STACK = chain.MAX_SCRIPT_STACK
+
+	// Gas per script token
+	GAS_SCRIPT_OP = chain.GAS_SCRIPT_OP
+
+	// Extra gas of a CHECKSIG on top of GAS_SCRIPT_OP
+	GAS_CHECKSIG = chain.GAS_CHECKSIG
+)
+
+type Script = chain.Script
@@ -0,0 +1,7 @@
+// Graceful shutdown, see internal/chain/shutdown.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const MEMPOOL_FILE_FORMAT = chain.MEMPOOL_FILE_FORMAT
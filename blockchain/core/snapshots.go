@@ -0,0 +1,8 @@
+// Mempool snapshots, see internal/chain/snapshots.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Most snapshots a query returns, the latest ones
+const MAX_SNAPSHOTS = chain.MAX_SNAPSHOTS
@@ -0,0 +1,11 @@
+// Account state derived by applying committed transactions in order, see internal/chain/state.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type State = chain.State
+
+func NewState() *State {
+	return chain.NewState()
+}
@@ -0,0 +1,27 @@
+// State snapshots, see internal/chain/statesnapshot.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	STATE_SNAPSHOT_FORMAT = chain.STATE_SNAPSHOT_FORMAT
+
+	// Version of the snapshots written by SnapshotState
+	STATE_SNAPSHOT_VERSION = chain.STATE_SNAPSHOT_VERSION
+)
+
+type StateSnapshot = chain.StateSnapshot
+
+/*
+ * Chain starting from the state of snap, its Blocks up to the snapshot
+ * known by their headers only, checked against checkpoints
+ */
+func BootstrapChain(snap StateSnapshot, checkpoints ...Checkpoint) (BlockChain, error) {
+	return chain.BootstrapChain(snap, checkpoints...)
+}
+
+// Chain bootstrapped from the state snapshot in the JSON file at path, see BootstrapChain
+func BootstrapChainFile(path string, checkpoints ...Checkpoint) (BlockChain, error) {
+	return chain.BootstrapChainFile(path, checkpoints...)
+}
@@ -0,0 +1,10 @@
+// Chain statistics, see internal/chain/stats.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Recent Blocks the interval and hash rate are averaged over
+const STATS_BLOCKS = chain.STATS_BLOCKS
+
+type ChainStats = chain.ChainStats
@@ -0,0 +1,31 @@
+// Block storage, see internal/chain/store.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type BlockStore = chain.BlockStore
+
+// Key-value blob storage, eg. files or a cloud object store
+type ObjectStore = chain.ObjectStore
+
+// ObjectStore keeping each object as a gzip compressed file in a directory
+type DirObjectStore = chain.DirObjectStore
+
+/*
+ * BlockStore keeping the last hotBlocks Blocks in memory and moving older
+ * ones to cold storage as they age
+ */
+type TieredStore = chain.TieredStore
+
+func NewMemoryStore() BlockStore {
+	return chain.NewMemoryStore()
+}
+
+func NewDirObjectStore(dir string) (*DirObjectStore, error) {
+	return chain.NewDirObjectStore(dir)
+}
+
+func NewTieredStore(cold ObjectStore, hotBlocks int) (*TieredStore, error) {
+	return chain.NewTieredStore(cold, hotBlocks)
+}
@@ -0,0 +1,25 @@
+// Atomic multi-party swaps, see internal/chain/swap.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Asset name of the chain's own coin
+const NATIVE_ASSET = chain.NATIVE_ASSET
+
+type SwapLeg = chain.SwapLeg
+
+type Swap = chain.Swap
+
+func NewSwapLeg(from string, to, asset string, amt Amount) SwapLeg {
+	return chain.NewSwapLeg(from, to, asset, amt)
+}
+
+/*
+ * Create an unsigned swap transaction
+ * The sender of the first leg proposes the swap, and the swap consumes
+ * their nonce
+ */
+func NewSwap(nonce uint64, legs ...SwapLeg) Transaction {
+	return chain.NewSwap(nonce, legs...)
+}
@@ -0,0 +1,27 @@
+// Tokens, see internal/chain/tokens.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MAX_TOKEN_SYMBOL_SIZE = chain.MAX_TOKEN_SYMBOL_SIZE
+	MAX_TOKEN_NAME_SIZE   = chain.MAX_TOKEN_NAME_SIZE
+	MAX_TOKEN_DECIMALS    = chain.MAX_TOKEN_DECIMALS
+
+	// Gas of the creation of a token
+	GAS_TOKEN = chain.GAS_TOKEN
+)
+
+// Name and decimals of a token created by a TxnToken, whose asset is the symbol and amt the supply
+type TokenSpec = chain.TokenSpec
+
+// Asset of the chain, as known to the state
+type Token = chain.Token
+
+type TokenHolder = chain.TokenHolder
+
+// Create the token symbol with a fixed supply credited to issuer
+func NewToken(issuer string, nonce uint64, symbol, name string, decimals int, supply Amount) Transaction {
+	return chain.NewToken(issuer, nonce, symbol, name, decimals, supply)
+}
@@ -0,0 +1,49 @@
+// Transactions, Blocks and the BlockChain, see internal/chain/toy_blockchain.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Max number of transactions to be packed in a Block, unless the genesis sets blockLimits
+	MAX_TXNS_PER_BLOCK = chain.MAX_TXNS_PER_BLOCK
+
+	TxnTransfer    = chain.TxnTransfer    // payer pays amt to payee
+	TxnSwap        = chain.TxnSwap        // atomic multi-party exchange of assets
+	TxnMint        = chain.TxnMint        // genesis allocation of amt to payee
+	TxnOrder       = chain.TxnOrder       // place a limit order on an asset pair
+	TxnCancelOrder = chain.TxnCancelOrder // cancel an open limit order of payer
+	TxnKV          = chain.TxnKV          // write a key-value pair in a namespace of payer
+	TxnUTXO        = chain.TxnUTXO        // spend unspent outputs into new ones
+	TxnMultisig    = chain.TxnMultisig    // make payer an M-of-N multisig account
+	TxnMessage     = chain.TxnMessage     // message from payer encrypted to payee
+	TxnRecord      = chain.TxnRecord      // application-defined record sent by payer
+	TxnToken       = chain.TxnToken       // create the token asset with a fixed supply amt held by payer
+)
+
+type TxnKind = chain.TxnKind
+
+type Transaction = chain.Transaction
+
+/*
+ * Header of a Block, the only part its hash covers: the transactions are
+ * committed to through the Merkle root, so mining re-hashes a few fixed
+ * size fields and light clients can follow the chain from headers alone
+ */
+type Header = chain.Header
+
+type Block = chain.Block
+
+type BlockChain = chain.BlockChain
+
+// Failure of one transaction of a Block
+type TxnError = chain.TxnError
+
+// Cryptographic Hash using SHA-256
+func SHA256(packedBytes []byte) string {
+	return chain.SHA256(packedBytes)
+}
+
+func CreateBlockChain(genesis Genesis) BlockChain {
+	return chain.CreateBlockChain(genesis)
+}
@@ -0,0 +1,11 @@
+// Block versions and upgrades, see internal/chain/upgrades.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Version of the Blocks before the first upgrade, carried by none of them
+const BASE_BLOCK_VERSION = chain.BASE_BLOCK_VERSION
+
+// Rules of a chain from a height on
+type Upgrade = chain.Upgrade
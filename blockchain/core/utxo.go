@@ -0,0 +1,29 @@
+// UTXO transactions, living side by side with account balances, see internal/chain/utxo.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	GAS_UTXO_INPUT  = chain.GAS_UTXO_INPUT
+	GAS_UTXO_OUTPUT = chain.GAS_UTXO_OUTPUT
+)
+
+// Output of a UTXO transaction, identified by txn hash and index
+type UTXO = chain.UTXO
+
+type UTXOOutput = chain.UTXOOutput
+
+type UTXOTxn = chain.UTXOTxn
+
+func NewUTXOOutput(owner string, amt Amount) UTXOOutput {
+	return chain.NewUTXOOutput(owner, amt)
+}
+
+/*
+ * Create an unsigned UTXO transaction. deposit is taken from payer's
+ * account balance, and inputs left over after the outputs go to payee
+ */
+func NewUTXOTxn(payer, payee string, nonce uint64, deposit Amount, inputs []string, outputs ...UTXOOutput) Transaction {
+	return chain.NewUTXOTxn(payer, payee, nonce, deposit, inputs, outputs...)
+}
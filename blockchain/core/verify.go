@@ -0,0 +1,19 @@
+// Offline chain verification, see internal/chain/verify.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// State root committed with a Block that the replayed state does not match
+type RootMismatch = chain.RootMismatch
+
+type VerifyReport = chain.VerifyReport
+
+/*
+ * Verify the chain of genesis persisted in cold, see above, trusting the
+ * work of the Blocks up to checkpoints. The error is for a storage that
+ * cannot be read, problems of the chain go in the report
+ */
+func VerifyChain(genesis Genesis, cold ObjectStore, checkpoints []Checkpoint) (VerifyReport, error) {
+	return chain.VerifyChain(genesis, cold, checkpoints)
+}
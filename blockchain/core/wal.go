@@ -0,0 +1,16 @@
+// Write-ahead log, see internal/chain/wal.go
+
+package core
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// ObjectStore logging its writes ahead of applying them
+type LoggedObjectStore = chain.LoggedObjectStore
+
+/*
+ * Log the writes to store in the file at path, redoing the batch a crash
+ * interrupted, if any, and returning the number of writes it held
+ */
+func OpenLoggedObjectStore(store ObjectStore, path string) (*LoggedObjectStore, int, error) {
+	return chain.OpenLoggedObjectStore(store, path)
+}
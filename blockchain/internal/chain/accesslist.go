@@ -0,0 +1,247 @@
+/*
+ * Access lists and parallel execution.
+ * A transaction may declare the state it touches as a list of keys:
+ *   account:<name>   balances, nonce, key and multisig of an account
+ *   kv:<namespace>   a key-value namespace
+ *   utxo:<id>        an unspent output
+ *   token:<symbol>   the creation of a token, see tokens.go
+ * Validation rejects a transaction touching anything it did not declare.
+ * When validating a Block, transactions are scheduled in waves: a wave
+ * holds transactions with disjoint access lists, which are applied in
+ * parallel, each on a scoped copy of the state merged back afterwards.
+ * Transactions without an access list run alone in their own wave, so
+ * the result is always the one of applying the Block in order.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Max keys of an access list
+const MAX_ACCESS_LIST = 64
+
+// Keys of the state the transaction touches
+func (txn Transaction) touched() []string {
+	keys := map[string]bool{"account:" + txn.payer: true}
+	account := func(name string) {
+		if name != "" {
+			keys["account:"+name] = true
+		}
+	}
+	account(txn.payee)
+	for _, p := range txn.payouts {
+		account(p.payee)
+	}
+	if txn.swap != nil {
+		for _, party := range txn.swap.parties() {
+			account(party)
+		}
+	}
+	if txn.kv != nil {
+		keys["kv:"+txn.kv.namespace] = true
+	}
+	if txn.feeAsset != NATIVE_ASSET {
+		keys["kv:"+FEE_RATES_NAMESPACE] = true // the rate must be published
+	}
+	if txn.token != nil {
+		keys["token:"+txn.asset] = true
+	}
+	if txn.utxo != nil {
+		for owner := range txn.utxo.sigs {
+			account(owner)
+		}
+		for _, id := range txn.utxo.inputs {
+			keys["utxo:"+id] = true
+		}
+	}
+	return sortedKeys(keys)
+}
+
+// Set the access list to exactly what the transaction touches
+func (txn Transaction) WithAccessList() Transaction {
+	txn.accessList = txn.touched()
+	return txn
+}
+
+func (txn Transaction) verifyAccessList() error {
+	if len(txn.accessList) == 0 {
+		return nil
+	}
+	if txn.kind == TxnOrder || txn.kind == TxnCancelOrder {
+		return errors.New("orders touch the accounts they match and cannot declare an access list")
+	}
+	if len(txn.accessList) > MAX_ACCESS_LIST {
+		return fmt.Errorf("access list longer than %v", MAX_ACCESS_LIST)
+	}
+	declared := make(map[string]bool)
+	for _, key := range txn.accessList {
+		declared[key] = true
+	}
+	for _, key := range txn.touched() {
+		if !declared[key] {
+			return fmt.Errorf("%v is not in the access list", key)
+		}
+	}
+	return nil
+}
+
+// Copy of the state restricted to keys
+func (s *State) scope(keys []string) *State {
+	scoped := NewState()
+	for _, key := range keys {
+		kind, name, _ := strings.Cut(key, ":")
+		switch kind {
+		case "account":
+			for asset, amt := range s.balances[name] {
+				scoped.credit(name, asset, amt)
+			}
+			if nonce, ok := s.nonces[name]; ok {
+				scoped.nonces[name] = nonce
+			}
+			if pubKey, ok := s.keys[name]; ok {
+				scoped.keys[name] = pubKey
+			}
+			if m, ok := s.multisigs[name]; ok {
+				scoped.multisigs[name] = m
+			}
+		case "kv":
+			if owner, ok := s.namespaces[name]; ok {
+				scoped.namespaces[name] = owner
+			}
+			if pairs, ok := s.kv[name]; ok {
+				scoped.kv[name] = make(map[string][]byte)
+				for k, v := range pairs {
+					scoped.kv[name][k] = v
+				}
+			}
+		case "utxo":
+			if u, ok := s.utxos[name]; ok {
+				scoped.utxos[name] = u
+			}
+		case "token":
+			if t, ok := s.tokens[name]; ok {
+				scoped.tokens[name] = t
+			}
+		}
+	}
+	return scoped
+}
+
+// Write back the keys of a scoped state, and the outputs it created
+func (s *State) merge(scoped *State, keys []string) {
+	for _, key := range keys {
+		kind, name, _ := strings.Cut(key, ":")
+		switch kind {
+		case "account":
+			delete(s.balances, name)
+			for asset, amt := range scoped.balances[name] {
+				s.credit(name, asset, amt)
+			}
+			if nonce, ok := scoped.nonces[name]; ok {
+				s.nonces[name] = nonce
+			}
+			if pubKey, ok := scoped.keys[name]; ok {
+				s.keys[name] = pubKey
+			}
+			if m, ok := scoped.multisigs[name]; ok {
+				s.multisigs[name] = m
+			}
+		case "kv":
+			if owner, ok := scoped.namespaces[name]; ok {
+				s.namespaces[name] = owner
+			}
+			if pairs, ok := scoped.kv[name]; ok {
+				s.kv[name] = pairs
+			}
+		case "utxo":
+			delete(s.utxos, name)
+		case "token":
+			if t, ok := scoped.tokens[name]; ok {
+				s.tokens[name] = t
+			}
+		}
+	}
+	for id, u := range scoped.utxos {
+		s.utxos[id] = u
+	}
+}
+
+/*
+ * Group transactions in waves of disjoint access lists, keeping every
+ * transaction after the ones it conflicts with
+ */
+func scheduleWaves(txns []Transaction) [][]int {
+	waves := [][]int{}
+	lastWave := make(map[string]int) // last wave touching each key
+	barrier := -1                    // last wave of a transaction without access list
+	for i, txn := range txns {
+		if len(txn.accessList) == 0 {
+			waves = append(waves, []int{i})
+			barrier = len(waves) - 1
+			continue
+		}
+		wave := barrier + 1
+		for _, key := range txn.accessList {
+			if w, ok := lastWave[key]; ok && w+1 > wave {
+				wave = w + 1
+			}
+		}
+		if wave == len(waves) {
+			waves = append(waves, nil)
+		}
+		waves[wave] = append(waves[wave], i)
+		for _, key := range txn.accessList {
+			lastWave[key] = wave
+		}
+	}
+	return waves
+}
+
+/*
+ * Apply txns to the state as applying them in order would, running the
+ * transactions of a wave in parallel. On error the state is left partially
+ * applied, so callers apply to a clone. A failing transaction is reported
+ * as a *TxnError
+ */
+func (s *State) applyParallel(txns []Transaction) error {
+	for _, wave := range scheduleWaves(txns) {
+		if len(wave) == 1 && len(txns[wave[0]].accessList) == 0 {
+			if err := s.apply(txns[wave[0]]); err != nil {
+				return &TxnError{wave[0], txns[wave[0]].Hash(), err}
+			}
+			continue
+		}
+		scoped := make([]*State, len(wave))
+		errs := make([]error, len(wave))
+		for j, i := range wave {
+			scoped[j] = s.scope(txns[i].accessList)
+		}
+		var wg sync.WaitGroup
+		for j, i := range wave {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = scoped[j].apply(txns[i])
+			}()
+		}
+		wg.Wait()
+		failed := -1
+		for j, i := range wave {
+			if errs[j] != nil && (failed < 0 || i < wave[failed]) {
+				failed = j
+			}
+		}
+		if failed >= 0 {
+			i := wave[failed]
+			return &TxnError{i, txns[i].Hash(), errs[failed]}
+		}
+		for j, i := range wave {
+			s.merge(scoped[j], txns[i].accessList)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+/*
+ * Addresses derived from public keys.
+ * An address is the first ADDRESS_HASH_SIZE bytes of the SHA-256 of a
+ * public key, encoded with bech32 (BIP-173) behind the address prefix of
+ * the network, eg. toy1... for a genesis declaring "addressPrefix": "toy".
+ * The checksum catches any typo of up to 4 characters, and the prefix
+ * keeps coins sent on one network from going to an address of another.
+ *
+ * Chains whose genesis declares a prefix only take transactions whose
+ * accounts are well formed addresses of that prefix. On every chain, an
+ * address account only binds to a key hashing to it, so whoever holds the
+ * key behind an address is the only one able to sign for it. Chains
+ * without a prefix keep plain account names such as alice.
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+const (
+	ADDRESS_HASH_SIZE  = 20
+	ADDRESS_PREFIX     = "toy" // prefix of -derive when no genesis is given
+	ADDRESS_PREFIX_MAX = 16
+	BECH32_CHARSET     = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	BECH32_MAX_LENGTH  = 90
+)
+
+// Address of pubKey on the network of prefix
+func NewAddress(pubKey []byte, prefix string) string {
+	sum := sha256.Sum256(pubKey)
+	return bech32Encode(prefix, convertBits(sum[:ADDRESS_HASH_SIZE], 8, 5, true))
+}
+
+// Address of the Wallet on the network of prefix
+func (w *Wallet) Address(prefix string) string {
+	return NewAddress(w.PublicKey(), prefix)
+}
+
+/*
+ * Check address is a well formed address of the network of prefix,
+ * returning the public key hash it encodes
+ * Fails with ErrInvalidAddress
+ */
+func ParseAddress(address, prefix string) ([]byte, error) {
+	hrp, hash, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != prefix {
+		return nil, fmt.Errorf("%w: %v is an address of network %v, expected %v", ErrInvalidAddress, address, hrp, prefix)
+	}
+	// bech32 also allows upper case, which would name another account
+	if address != strings.ToLower(address) {
+		return nil, fmt.Errorf("%w: %v is not lower case", ErrInvalidAddress, address)
+	}
+	return hash, nil
+}
+
+// Prefix and public key hash of address
+func decodeAddress(address string) (string, []byte, error) {
+	hrp, data, err := bech32Decode(address)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v: %v", ErrInvalidAddress, address, err)
+	}
+	hash, ok := convertBitsStrict(data)
+	if !ok || len(hash) != ADDRESS_HASH_SIZE {
+		return "", nil, fmt.Errorf("%w: %v does not encode a %v bytes key hash", ErrInvalidAddress, address, ADDRESS_HASH_SIZE)
+	}
+	return hrp, hash, nil
+}
+
+// Whether pubKey may sign for account: any key for a name, the key it hashes from for an address
+func ownsAccount(account string, pubKey []byte) bool {
+	_, hash, err := decodeAddress(account)
+	if err != nil {
+		return true
+	}
+	sum := sha256.Sum256(pubKey)
+	return string(sum[:ADDRESS_HASH_SIZE]) == string(hash)
+}
+
+// Accounts txn names, all of which must be addresses on chains with a prefix
+func (txn Transaction) accounts() []string {
+	accounts := []string{}
+	for _, key := range txn.touched() {
+		if name, ok := strings.CutPrefix(key, "account:"); ok {
+			accounts = append(accounts, name)
+		}
+	}
+	if txn.utxo != nil {
+		for _, o := range txn.utxo.outputs {
+			accounts = append(accounts, o.owner)
+		}
+	}
+	return accounts
+}
+
+// Refuse txn unless its accounts are addresses of the chain's prefix, if it has one
+func (bc *BlockChain) checkAddresses(txn Transaction) error {
+	if bc.genesis.AddressPrefix == "" {
+		return nil
+	}
+	for _, account := range txn.accounts() {
+		if _, err := ParseAddress(account, bc.genesis.AddressPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refuse allocations to anything but addresses of the prefix, if the spec has one
+func (g Genesis) checkAddresses() error {
+	if g.AddressPrefix == "" {
+		return nil
+	}
+	if len(g.AddressPrefix) > ADDRESS_PREFIX_MAX || strings.Trim(g.AddressPrefix, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+		return fmt.Errorf("address prefix %q is not up to %v lowercase letters and digits", g.AddressPrefix, ADDRESS_PREFIX_MAX)
+	}
+	accounts := sortedKeys(g.Alloc)
+	for _, asset := range sortedKeys(g.Assets) {
+		accounts = append(accounts, sortedKeys(g.Assets[asset])...)
+	}
+	for _, v := range g.Validators {
+		accounts = append(accounts, v.Name)
+	}
+	if g.FeeOracle != "" {
+		accounts = append(accounts, g.FeeOracle)
+	}
+	if g.Governance != nil && g.Governance.Admin != "" {
+		accounts = append(accounts, g.Governance.Admin)
+	}
+	for _, account := range accounts {
+		if _, err := ParseAddress(account, g.AddressPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if top>>i&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// The prefix as checksummed: high bits of each character, 0, low bits
+func bech32ExpandPrefix(hrp string) []byte {
+	expanded := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// Encode hrp and the 5 bits groups of data, with the 6 characters checksum
+func bech32Encode(hrp string, data []byte) string {
+	values := append(bech32ExpandPrefix(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, d := range data {
+		b.WriteByte(BECH32_CHARSET[d])
+	}
+	for i := range 6 {
+		b.WriteByte(BECH32_CHARSET[polymod>>(5*(5-i))&31])
+	}
+	return b.String()
+}
+
+// Prefix and 5 bits groups of s, after checking its characters and checksum
+func bech32Decode(s string) (string, []byte, error) {
+	if len(s) > BECH32_MAX_LENGTH {
+		return "", nil, fmt.Errorf("longer than %v characters", BECH32_MAX_LENGTH)
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("mixed case")
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 {
+		return "", nil, fmt.Errorf("no prefix")
+	}
+	if sep+7 > len(s) {
+		return "", nil, fmt.Errorf("too short")
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("invalid prefix character %q", hrp[i])
+		}
+	}
+	data := make([]byte, 0, len(s)-sep-1)
+	for _, c := range s[sep+1:] {
+		v := strings.IndexRune(BECH32_CHARSET, c)
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", c)
+		}
+		data = append(data, byte(v))
+	}
+	if bech32Polymod(append(bech32ExpandPrefix(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("checksum mismatch, mistyped")
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// Regroup the bits of data from groups of from bits to groups of to bits
+func convertBits(data []byte, from, to uint, pad bool) []byte {
+	var acc, bits uint
+	out := []byte{}
+	for _, v := range data {
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&(1<<to-1)))
+		}
+	}
+	if pad && bits > 0 {
+		out = append(out, byte(acc<<(to-bits)&(1<<to-1)))
+	}
+	return out
+}
+
+// Bytes of 5 bits groups, false unless the padding is under 5 zero bits
+func convertBitsStrict(data []byte) ([]byte, bool) {
+	out := convertBits(data, 5, 8, false)
+	padding := len(data)*5 - len(out)*8
+	if padding >= 5 || (len(data) > 0 && data[len(data)-1]&(1<<padding-1) != 0) {
+		return nil, false
+	}
+	return out, true
+}
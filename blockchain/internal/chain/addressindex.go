@@ -0,0 +1,145 @@
+/*
+ * Transaction history of accounts.
+ * The BlockChain indexes every committed transaction under each account
+ * it involves, with the direction of its coins for that account, so the
+ * history of an account is read off the index instead of scanning the
+ * whole chain. The index is kept in memory, built as Blocks are committed
+ * from genesis on and cut back along with the chain on a reorganization.
+ * Transactions of pruned Blocks stay indexed but are left out of
+ * histories, their bodies being gone.
+ *
+ *	GET /history/{account}?from=..  transactions of account from a height
+ *	                                on, oldest first
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Directions of a transaction for an account
+const (
+	HISTORY_IN   = "in"   // the account receives
+	HISTORY_OUT  = "out"  // the account pays
+	HISTORY_SELF = "self" // both, eg. a party to a swap or a transfer to oneself
+)
+
+// Most transactions GET /history returns
+const MAX_HISTORY_TXNS = 1000
+
+// Position of a transaction in the chain and its direction for an account
+type historyEntry struct {
+	height    int
+	index     int // in the Block
+	direction string
+}
+
+// Transactions of each account, in chain order
+type addressIndex map[string][]historyEntry
+
+/*
+ * Accounts txn involves with its direction for each: payers and swap legs
+ * sending pay, payees, payouts, swap legs receiving and UTXO owners receive
+ */
+func (txn Transaction) directions() map[string]string {
+	dirs := map[string]string{}
+	mark := func(account, direction string) {
+		if account == "" {
+			return
+		}
+		if d, ok := dirs[account]; ok && d != direction {
+			direction = HISTORY_SELF
+		}
+		dirs[account] = direction
+	}
+	mark(txn.payer, HISTORY_OUT)
+	mark(txn.payee, HISTORY_IN)
+	for _, p := range txn.payouts {
+		mark(p.payee, HISTORY_IN)
+	}
+	if txn.swap != nil {
+		for _, leg := range txn.swap.legs {
+			mark(leg.from, HISTORY_OUT)
+			mark(leg.to, HISTORY_IN)
+		}
+	}
+	if txn.utxo != nil {
+		for _, o := range txn.utxo.outputs {
+			mark(o.owner, HISTORY_IN)
+		}
+	}
+	return dirs
+}
+
+// Index the transactions of the Block at height
+func (idx addressIndex) add(height int, b Block) {
+	for i, txn := range b.data {
+		for account, direction := range txn.directions() {
+			idx[account] = append(idx[account], historyEntry{height, i, direction})
+		}
+	}
+}
+
+// Drop the transactions of the Blocks from height on, see reorg.go
+func (idx addressIndex) truncate(height int) {
+	for account, entries := range idx {
+		n := len(entries)
+		for n > 0 && entries[n-1].height >= height {
+			n--
+		}
+		if n == 0 {
+			delete(idx, account)
+		} else {
+			idx[account] = entries[:n:n]
+		}
+	}
+}
+
+type HistoryEntry struct {
+	Height    int     `json:"height"`
+	UnixTs    int64   `json:"unixTs"` // of the Block, unix microseconds
+	Hash      string  `json:"hash"`   // of the transaction
+	Direction string  `json:"direction"`
+	Txn       jsonTxn `json:"txn"`
+}
+
+// Transactions involving account from height from on, oldest first
+func (bc *BlockChain) History(account string, from int) []HistoryEntry {
+	history := []HistoryEntry{}
+	for _, e := range bc.accountTxns(account) {
+		if e.height < from || bc.isPruned(e.height) {
+			continue
+		}
+		b := bc.blockAt(e.height)
+		txn := b.data[e.index]
+		history = append(history, HistoryEntry{e.height, b.unixTs, txn.Hash(), e.direction, txn.toJSON()})
+	}
+	return history
+}
+
+// Print the history of account, returning the exit code
+func runHistory(bc *BlockChain, account string, out *Output) int {
+	history := bc.History(account, 0)
+	rows := make([][]string, len(history))
+	for i, e := range history {
+		rows[i] = []string{
+			e.Hash, fmt.Sprint(e.Height), TXN_KIND_NAMES[e.Txn.Kind], e.Direction,
+			e.Txn.Payer, e.Txn.Payee, fmt.Sprint(e.Txn.Amt),
+		}
+	}
+	if err := out.Table([]string{"txn", "height", "kind", "direction", "payer", "payee", "amount"}, rows, history); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	var history []HistoryEntry
+	s.node.withChain(func(bc *BlockChain) { history = bc.History(r.PathValue("account"), from) })
+	writeJSON(w, http.StatusOK, history[:min(len(history), MAX_HISTORY_TXNS)])
+}
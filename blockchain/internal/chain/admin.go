@@ -0,0 +1,330 @@
+/*
+ * Admin API.
+ * A node left running for weeks, eg. the one of a class, needs changing
+ * now and then: mining paused during an exercise, a stuck Mempool cleared,
+ * a peer added. Restarting it drops its clients, so -admin serves runtime
+ * controls on an address of their own, apart from the node API. Every
+ * request bears the token of -admin-token as
+ *
+ *	Authorization: Bearer <token>
+ *
+ * and the admin address is best kept to localhost or a private network.
+ *
+ * A few routes of the node API are the operator's too, though served on
+ * the node address for the explorer and the shell to reach them: mining a
+ * Block on demand, POST /blocks, the CPU-heavy parameter simulation,
+ * POST /sim/params, and the devnet controls of devnet.go, POST /dev/...
+ * They take the same token, unless requested in-process, eg. by the shell
+ * of the node, see shell.go, and are refused without one.
+ *
+ *	GET    /admin/status             miner, log level, height, Mempool and peers
+ *	POST   /admin/miner/start        start the background miner, see miner.go
+ *	POST   /admin/miner/stop         stop it, waiting for the Block being mined
+ *	POST   /admin/log-level          {"level": "debug"}: debug also logs every
+ *	                                 request of the node API, quiet logs nothing
+ *	POST   /admin/snapshot           write a snapshot of the state at the last
+ *	                                 Block to -state-snapshots, see statesnapshot.go
+ *	POST   /admin/commit             mine a Block of the pending transactions
+ *	                                 now, empty if none applies
+ *	POST   /admin/mempool/drop       drop every held transaction
+ *	POST   /admin/peers {"url": ..}  relay to a new peer, see peers.go
+ *	DELETE /admin/peers?url=..       stop relaying to a peer
+ *	GET    /admin/webhooks           webhooks and their deliveries, see webhooks.go
+ *	POST   /admin/webhooks           {"url": .., "secret": ..}: add a webhook
+ *	DELETE /admin/webhooks?url=..    remove a webhook
+ */
+package chain
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Log levels
+const (
+	LOG_DEBUG = "debug"
+	LOG_INFO  = "info" // the default
+	LOG_QUIET = "quiet"
+)
+
+// Current log level, see SetLogLevel
+var logLevel atomic.Value
+
+// Log as level says from now on
+func SetLogLevel(level string) error {
+	switch level {
+	case LOG_DEBUG, LOG_INFO:
+		log.SetOutput(os.Stderr)
+	case LOG_QUIET:
+		log.SetOutput(io.Discard)
+	default:
+		return fmt.Errorf("unknown log level %q, expected debug, info or quiet", level)
+	}
+	logLevel.Store(level)
+	return nil
+}
+
+func LogLevel() string {
+	if level, ok := logLevel.Load().(string); ok {
+		return level
+	}
+	return LOG_INFO
+}
+
+type AdminStatus struct {
+	Mining   bool   `json:"mining"`
+	LogLevel string `json:"logLevel"`
+	Height   int    `json:"height"`
+	Pending  int    `json:"pending"`
+	Queued   int    `json:"queued"`
+	Peers    int    `json:"peers"`
+}
+
+// Admin API of a Node, see above
+type AdminServer struct {
+	node      *Node
+	miner     *Miner
+	token     string
+	snapshots string // directory of the state snapshots
+	mux       *http.ServeMux
+}
+
+/*
+ * Admin API of node, starting and stopping miner, for requests bearing
+ * token, writing state snapshots to the directory snapshots
+ */
+func NewAdminServer(node *Node, miner *Miner, token, snapshots string) (*AdminServer, error) {
+	if token == "" {
+		return nil, errors.New("the admin API needs a token")
+	}
+	s := &AdminServer{node: node, miner: miner, token: token, snapshots: snapshots, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /admin/status", s.handleStatus)
+	s.mux.HandleFunc("POST /admin/miner/{action}", s.handleMiner)
+	s.mux.HandleFunc("POST /admin/log-level", s.handleLogLevel)
+	s.mux.HandleFunc("POST /admin/snapshot", s.handleSnapshot)
+	s.mux.HandleFunc("POST /admin/commit", s.handleCommit)
+	s.mux.HandleFunc("POST /admin/mempool/drop", s.handleDropMempool)
+	s.mux.HandleFunc("POST /admin/peers", s.handleAddPeer)
+	s.mux.HandleFunc("DELETE /admin/peers", s.handleRemovePeer)
+	s.mux.HandleFunc("GET /admin/webhooks", s.handleWebhooks)
+	s.mux.HandleFunc("POST /admin/webhooks", s.handleAddWebhook)
+	s.mux.HandleFunc("DELETE /admin/webhooks", s.handleRemoveWebhook)
+	return s, nil
+}
+
+// Serve s on addr, apart from the node API
+func (s *AdminServer) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+// Whether r bears token, never if token is empty
+func bearsToken(r *http.Request, token string) bool {
+	want := "Bearer " + token
+	return token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) == 1
+}
+
+func (s *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !bearsToken(r, s.token) {
+		writeError(w, http.StatusUnauthorized, ErrAdminToken.Error())
+		return
+	}
+	log.Printf("admin: %v %v from %v", r.Method, r.URL.Path, r.RemoteAddr)
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *AdminServer) status() AdminStatus {
+	status := AdminStatus{Mining: s.miner.Running(), LogLevel: LogLevel(), Peers: len(s.node.Peers())}
+	s.node.withChain(func(bc *BlockChain) {
+		status.Height = bc.blocks.Len() - 1
+		status.Pending = len(bc.mempool.pending)
+		for _, queue := range bc.mempool.queued {
+			status.Queued += len(queue)
+		}
+	})
+	return status
+}
+
+// Token of the operator routes of the node API, see above, none refusing them
+func (n *Node) SetAdminToken(token string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.adminToken = token
+}
+
+// Context key marking requests made in-process, see localOperator
+type operatorKey struct{}
+
+// Mark the requests to h as the operator's, for clients in-process
+func localOperator(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), operatorKey{}, true)))
+	})
+}
+
+// h for the requests of the operator only, see above
+func (s *Server) operator(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.fromOperator(r) {
+			writeError(w, http.StatusUnauthorized, ErrAdminToken.Error())
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Whether r is made in-process or bears the admin token
+func (s *Server) fromOperator(r *http.Request) bool {
+	s.node.mu.Lock()
+	token := s.node.adminToken
+	s.node.mu.Unlock()
+	return r.Context().Value(operatorKey{}) != nil || bearsToken(r, token)
+}
+
+// Drop every transaction held in the Mempool, returning how many
+func (bc *BlockChain) DropMempool(reason string) int {
+	mp := bc.mempool
+	held := mp.held()
+	for _, txn := range held {
+		bc.txnDropped(txn.Hash(), reason)
+	}
+	mp.pending = nil
+	clear(mp.queued)
+	clear(mp.nonces)
+	clear(mp.admitted)
+	return len(held)
+}
+
+/*
+ * Mine a Block now like the Miner, of the pending transactions or empty
+ * when none are pending, read replicas never mine
+ */
+func (n *Node) ForceCommit() (Block, error) {
+	if n.IsReplica() {
+		return Block{}, ErrReadReplica
+	}
+	var b Block
+	var err error
+	n.withChain(func(bc *BlockChain) {
+		err = bc.CommitBlock()
+		if errors.Is(err, ErrEmptyMempool) {
+			err = bc.CommitEmptyBlock()
+		}
+		if err == nil {
+			b = *bc.lastBlock()
+		}
+	})
+	return b, err
+}
+
+// GET /admin/status
+func (s *AdminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// POST /admin/miner/start and /admin/miner/stop
+func (s *AdminServer) handleMiner(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("action") {
+	case "start":
+		if err := s.miner.Start(); err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+	case "stop":
+		s.miner.Stop()
+	default:
+		writeError(w, http.StatusNotFound, "unknown miner action, expected start or stop")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// POST /admin/log-level
+func (s *AdminServer) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := SetLogLevel(req.Level); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// POST /admin/snapshot
+func (s *AdminServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	var snap StateSnapshot
+	var err error
+	s.node.withChain(func(bc *BlockChain) { snap, err = bc.SnapshotState(bc.blocks.Len() - 1) })
+	var raw []byte
+	if err == nil {
+		raw, err = json.Marshal(snap)
+	}
+	path := filepath.Join(s.snapshots, fmt.Sprintf("state-%v.json", snap.Height))
+	if err == nil {
+		err = os.MkdirAll(s.snapshots, 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, raw, 0o644)
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"path": path, "height": snap.Height, "blockHash": snap.BlockHash, "stateRoot": snap.StateRoot, "bytes": len(raw)})
+}
+
+// POST /admin/commit
+func (s *AdminServer) handleCommit(w http.ResponseWriter, r *http.Request) {
+	b, err := s.node.ForceCommit()
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, b.toJSON())
+}
+
+// POST /admin/mempool/drop
+func (s *AdminServer) handleDropMempool(w http.ResponseWriter, r *http.Request) {
+	var dropped int
+	s.node.withChain(func(bc *BlockChain) { dropped = bc.DropMempool("dropped by the operator") })
+	writeJSON(w, http.StatusOK, map[string]int{"dropped": dropped})
+}
+
+// POST /admin/peers
+func (s *AdminServer) handleAddPeer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	info, err := s.node.AddPeer(req.URL)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// DELETE /admin/peers
+func (s *AdminServer) handleRemovePeer(w http.ResponseWriter, r *http.Request) {
+	if err := s.node.RemovePeer(r.URL.Query().Get("url")); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.node.Peers())
+}
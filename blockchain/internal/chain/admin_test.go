@@ -0,0 +1,47 @@
+package chain
+
+import (
+	"errors"
+	"testing"
+)
+
+var errStoreFull = errors.New("store full")
+
+// Block store with room left for empty Blocks only
+type fullStore struct {
+	BlockStore
+}
+
+func (s fullStore) Append(b Block) error {
+	if len(b.data) > 0 {
+		return errStoreFull
+	}
+	return s.BlockStore.Append(b)
+}
+
+// ForceCommit mines an empty Block only when nothing is pending
+func TestForceCommit(t *testing.T) {
+	tc := NewTestChain(1, TestGenesis(4))
+	node := NewNode(tc.Chain())
+	b, err := node.ForceCommit()
+	if err != nil || len(b.data) != 0 || tc.Chain().blocks.Len() != 2 {
+		t.Fatalf("forced commit of an empty Mempool mined %v, %v at height %v", b.hash, err, tc.Chain().blocks.Len()-1)
+	}
+
+	txns := tc.RandomTxns(3)
+	for _, txn := range txns {
+		if err := node.AddTxn(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bc := tc.Chain()
+	blocks := bc.blocks
+	bc.blocks = fullStore{blocks}
+	if b, err := node.ForceCommit(); !errors.Is(err, errStoreFull) || b.hash != "" {
+		t.Fatalf("forced commit into a full store returned %v, %v, expected %v", b.hash, err, errStoreFull)
+	}
+	bc.blocks = blocks
+	if height := bc.blocks.Len() - 1; height != 1 {
+		t.Fatalf("height %v after a failed forced commit, expected 1", height)
+	}
+}
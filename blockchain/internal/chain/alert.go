@@ -0,0 +1,251 @@
+/*
+ * Double spend alerts.
+ * A payer spending the same coins twice signs two transactions with the
+ * same nonce, eg. one paying a merchant and one paying themselves back.
+ * A node getting the second while the first is pending or committed
+ * refuses it, as it refuses any reused nonce, and raises an Alert: both
+ * transactions and the confirmations of the first, signed with the key of
+ * the node. The node keeps the last ALERT_LOG_SIZE alerts for wallets,
+ * publishes them on its event bus, eg. to GET /ws?events=alert, and sends
+ * them to its relay peers. Peers check the signature, and that the two
+ * transactions do conflict, before keeping and relaying an alert in turn.
+ * A merchant seeing an alert on a payment to them waits for the payment
+ * to be final, see finality.go, before shipping.
+ *
+ * A committed payment can also be undone by a reorganization, see
+ * reorg.go; that is reported as a reverted-txn event rather than an alert,
+ * the branch having never seen the payment.
+ *
+ *	GET /alerts?account=..  alerts, newest first, only those involving
+ *	                        account if set
+ *	POST /alerts            alert relayed by a peer
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	ALERT_LOG_SIZE = 100              // alerts kept by a node
+	ALERT_MAX_AGE  = 10 * time.Minute // older alerts are dropped, which ends their flood
+)
+
+type Alert struct {
+	first         Transaction // pending or committed when the alert was raised
+	second        Transaction // spending the nonce of first again
+	confirmations int         // of first when the alert was raised, 0 if pending
+	unixTs        int64       // unix microseconds when the alert was raised
+	origin        []byte      // public key of the node raising the alert
+	sig           []byte
+}
+
+type jsonAlert struct {
+	Hash          string  `json:"hash,omitempty"` // ignored when relayed
+	First         jsonTxn `json:"first"`
+	Second        jsonTxn `json:"second"`
+	Confirmations int     `json:"confirmations"`
+	UnixTs        int64   `json:"unixTs"`
+	Origin        []byte  `json:"origin"`
+	Sig           []byte  `json:"sig"`
+}
+
+func (a Alert) toJSON() jsonAlert {
+	return jsonAlert{a.Hash(), a.first.toJSON(), a.second.toJSON(), a.confirmations, a.unixTs, a.origin, a.sig}
+}
+
+func (j jsonAlert) alert() Alert {
+	return Alert{j.First.transaction(), j.Second.transaction(), j.Confirmations, j.UnixTs, j.Origin, j.Sig}
+}
+
+func (a Alert) digest() []byte {
+	packed := fmt.Sprintf("alert|%v|%v|%v|%v|%x", a.first.Hash(), a.second.Hash(), a.confirmations, a.unixTs, a.origin)
+	hash := sha256.Sum256([]byte(packed))
+	return hash[:]
+}
+
+func (a Alert) Hash() string {
+	return fmt.Sprintf("%x", a.digest())
+}
+
+// Whether account pays or is paid by either transaction
+func (a Alert) involves(account string) bool {
+	return a.first.involves(account) || a.second.involves(account)
+}
+
+/*
+ * Check a relayed alert is signed by its origin and reports two distinct
+ * well formed transactions of the same payer and nonce
+ * Fails with ErrInvalidAlert
+ */
+func (a Alert) verify() error {
+	if !verifySignature(SchemeECDSA, a.origin, a.digest(), a.sig) {
+		return fmt.Errorf("%w: not signed by its origin", ErrInvalidAlert)
+	}
+	if a.first.payer == "" || a.first.payer != a.second.payer || a.first.nonce != a.second.nonce {
+		return fmt.Errorf("%w: transactions of different payers or nonces", ErrInvalidAlert)
+	}
+	if a.first.Hash() == a.second.Hash() {
+		return fmt.Errorf("%w: the same transaction twice", ErrInvalidAlert)
+	}
+	for _, txn := range []Transaction{a.first, a.second} {
+		if err := txn.verify(); err != nil {
+			return fmt.Errorf("%w: transaction %v: %v", ErrInvalidAlert, txn.Hash(), err)
+		}
+	}
+	if a.confirmations < 0 {
+		return fmt.Errorf("%w: negative confirmations", ErrInvalidAlert)
+	}
+	return nil
+}
+
+// Pending transaction of payer with nonce
+func (mp *Mempool) pendingTxn(payer string, nonce uint64) (Transaction, bool) {
+	for _, txn := range mp.pending {
+		if txn.payer == payer && txn.nonce == nonce {
+			return txn, true
+		}
+	}
+	return Transaction{}, false
+}
+
+// Committed transaction of payer with nonce, and its height
+func (bc *BlockChain) committedTxn(payer string, nonce uint64) (Transaction, int, bool) {
+	for height := bc.blocks.Len() - 1; height > 0; height-- {
+		for _, txn := range bc.blockAt(height).data {
+			if txn.kind != TxnMint && txn.payer == payer && txn.nonce == nonce {
+				return txn, height, true
+			}
+		}
+	}
+	return Transaction{}, 0, false
+}
+
+// Unsigned alert if txn, refused for its nonce, spends the nonce of another transaction
+func (bc *BlockChain) doubleSpend(txn Transaction) (Alert, bool) {
+	first, found := bc.mempool.pendingTxn(txn.payer, txn.nonce)
+	confirmations := 0
+	if !found {
+		var height int
+		if first, height, found = bc.committedTxn(txn.payer, txn.nonce); found {
+			confirmations = bc.confirmations(height)
+		}
+	}
+	if !found || first.Hash() == txn.Hash() {
+		return Alert{}, false
+	}
+	return Alert{first: first, second: txn, confirmations: confirmations}, true
+}
+
+// Sign an alert raised by the Node and spread it
+func (n *Node) raiseAlert(a Alert) {
+	n.mu.Lock()
+	if n.alertKey == nil {
+		key, err := NewWallet("node")
+		if err != nil {
+			n.mu.Unlock()
+			log.Printf("alert: %v", err)
+			return
+		}
+		n.alertKey = key
+	}
+	key := n.alertKey
+	a.unixTs = n.bc.now().UnixMicro()
+	n.mu.Unlock()
+	a.origin = key.PublicKey()
+	sig, err := key.Sign(a.digest())
+	if err != nil {
+		log.Printf("alert: %v", err)
+		return
+	}
+	a.sig = sig
+	log.Printf("alert %v: %v spent nonce %v twice, in %v and %v", a.Hash(), a.first.payer, a.first.nonce, a.first.Hash(), a.second.Hash())
+	n.acceptAlert(a)
+}
+
+/*
+ * Keep, publish and relay an alert unless it was seen already or is too
+ * old, which stops the flood
+ * Fails with ErrInvalidAlert
+ */
+func (n *Node) acceptAlert(a Alert) error {
+	if err := a.verify(); err != nil {
+		return err
+	}
+	if n.bc.now().Sub(time.UnixMicro(a.unixTs)) > ALERT_MAX_AGE {
+		return nil
+	}
+	hash := a.Hash()
+	n.mu.Lock()
+	for _, seen := range n.alerts {
+		if seen.Hash() == hash {
+			n.mu.Unlock()
+			return nil
+		}
+	}
+	n.alerts = append(n.alerts, a)
+	if len(n.alerts) > ALERT_LOG_SIZE {
+		n.alerts = n.alerts[1:]
+	}
+	r := n.relay
+	n.mu.Unlock()
+	n.events.publish(Event{Type: NewAlert, Alert: &a})
+	if r == nil {
+		return nil
+	}
+	for _, peer := range r.peerURLs() {
+		go func() {
+			if err := r.post(peer, "/alerts", a.toJSON()); err != nil {
+				log.Printf("relay: alert %v: %v", hash, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Alerts kept by the Node, newest first, only those involving account if set
+func (n *Node) Alerts(account string) []Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	alerts := []Alert{}
+	for i := len(n.alerts) - 1; i >= 0; i-- {
+		if account == "" || n.alerts[i].involves(account) {
+			alerts = append(alerts, n.alerts[i])
+		}
+	}
+	return alerts
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := []jsonAlert{}
+	for _, a := range s.node.Alerts(r.URL.Query().Get("account")) {
+		alerts = append(alerts, a.toJSON())
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func (s *Server) handleRelayAlert(w http.ResponseWriter, r *http.Request) {
+	var j jsonAlert
+	if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var err error
+	if s.node.relayer() == nil {
+		err = ErrRelayDisabled
+	} else if s.node.relayer().config.RequireNoise && noisePeerKey(r.Context()) == nil {
+		err = ErrPlaintextPeer
+	} else {
+		err = s.node.acceptAlert(j.alert())
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
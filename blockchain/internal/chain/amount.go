@@ -0,0 +1,172 @@
+/*
+ * Amounts.
+ * Amounts of any asset, balances, fees, rewards and prices alike, are
+ * integers of base units, 10^-AMOUNT_DECIMALS of a coin, as satoshis are
+ * of a bitcoin: sums never drift, and the text of an amount in a
+ * transaction payload, see signing/README.md, is the same on every
+ * client. They read and print as decimal coins, eg. 1.5 for 150000000
+ * base units, in JSON too, so the API takes and returns coins as before,
+ * and amounts with more decimals are rejected rather than rounded.
+ *
+ * Ratios, eg. the fee rates of fee assets or the fee per byte ordering
+ * the Mempool, stay float64: they rank or price, the amounts they lead to
+ * being rounded to base units where they are paid.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Base units of a coin
+const AMOUNT_DECIMALS = 8
+
+// Quantity of an asset in base units
+type Amount int64
+
+const (
+	COIN       Amount = 100_000_000
+	MAX_AMOUNT Amount = 10_000_000_000 * COIN // of a single amount, so that sums of a few do not overflow
+)
+
+/*
+ * Decimal coins, with an exponent of at most two digits: big.Rat alone
+ * would also take fractions, base prefixes and underscores, and spend
+ * seconds on exponents of millions
+ */
+var amountPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]{1,2})?$`)
+
+// Amount of the decimal coins s, eg. "1.5" or "2e-3"
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if !amountPattern.MatchString(s) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(int64(COIN)))
+	if !r.IsInt() {
+		return 0, fmt.Errorf("amount %v has more than %v decimals", s, AMOUNT_DECIMALS)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("amount %v out of range", s)
+	}
+	return Amount(r.Num().Int64()), nil
+}
+
+// Decimal coins, without trailing zeros
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign, u = "-", -u
+	}
+	whole, frac := u/uint64(COIN), u%uint64(COIN)
+	if frac == 0 {
+		return sign + strconv.FormatUint(whole, 10)
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", AMOUNT_DECIMALS, frac), "0")
+	return fmt.Sprintf("%v%v.%v", sign, whole, digits)
+}
+
+// Coins as a float, for ratios and charts
+func (a Amount) Coins() float64 {
+	return float64(a) / float64(COIN)
+}
+
+// Amount of coins, rounded to the nearest base unit, for amounts derived from ratios
+func CoinsAmount(coins float64) Amount {
+	units := math.Round(coins * float64(COIN))
+	switch {
+	case math.IsNaN(units):
+		return 0
+	case units >= math.MaxInt64:
+		return math.MaxInt64
+	case units <= math.MinInt64:
+		return math.MinInt64
+	}
+	return Amount(units)
+}
+
+// a*num/den rounded down, without overflowing in between, num and den being positive
+func (a Amount) mulDiv(num, den int64) (Amount, error) {
+	if num < 0 || den <= 0 {
+		return 0, errors.New("negative ratio")
+	}
+	u := uint64(a)
+	if a < 0 {
+		u = -u
+	}
+	hi, lo := bits.Mul64(u, uint64(num))
+	if hi >= uint64(den) {
+		return 0, fmt.Errorf("%v times %v/%v out of range", a, num, den)
+	}
+	q, _ := bits.Div64(hi, lo, uint64(den))
+	if q > math.MaxInt64 {
+		return 0, fmt.Errorf("%v times %v/%v out of range", a, num, den)
+	}
+	if a < 0 {
+		return -Amount(q), nil
+	}
+	return Amount(q), nil
+}
+
+// Whether a is a valid amount to move, positive and at most MAX_AMOUNT
+func (a Amount) valid() bool {
+	return a > 0 && a <= MAX_AMOUNT
+}
+
+// Refuse amounts of txn below 0 or above MAX_AMOUNT, so that no sum of a Block overflows
+func (txn Transaction) verifyAmounts() error {
+	amounts := []Amount{txn.amt, txn.fee, txn.gasPrice}
+	for _, p := range txn.payouts {
+		amounts = append(amounts, p.amt)
+	}
+	if txn.swap != nil {
+		for _, leg := range txn.swap.legs {
+			amounts = append(amounts, leg.amt)
+		}
+	}
+	if txn.utxo != nil {
+		for _, o := range txn.utxo.outputs {
+			amounts = append(amounts, o.amt)
+		}
+	}
+	for _, amt := range amounts {
+		if amt < 0 || amt > MAX_AMOUNT {
+			return fmt.Errorf("amount %v outside 0..%v", amt, MAX_AMOUNT)
+		}
+	}
+	return nil
+}
+
+// Decimal coins, a JSON number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// From a JSON number of coins, or a string of one
+func (a *Amount) UnmarshalJSON(raw []byte) error {
+	text := string(raw)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	amt, err := ParseAmount(text)
+	if err != nil {
+		return err
+	}
+	*a = amt
+	return nil
+}
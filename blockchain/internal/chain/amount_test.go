@@ -0,0 +1,52 @@
+package chain
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	for _, c := range []struct {
+		s   string
+		amt Amount
+		ok  bool
+	}{
+		{"1", COIN, true},
+		{"0.5", COIN / 2, true},
+		{" 2.25 ", 2*COIN + COIN/4, true},
+		{"-3", -3 * COIN, true},
+		{"1e2", 100 * COIN, true},
+		{"0.00000001", 1, true},
+		{"0.000000001", 0, false},
+		{"1/2", 0, false},
+		{"coin", 0, false},
+		{"1e30", 0, false},
+		{"2.5E-1", COIN / 4, true},
+		{"0x10", 0, false},
+		{"0b11", 0, false},
+		{"0o7", 0, false},
+		{"1_0", 0, false},
+		{".5", 0, false},
+		{"1e999999", 0, false},
+		{"1e-999999", 0, false},
+	} {
+		amt, err := ParseAmount(c.s)
+		if (err == nil) != c.ok || amt != c.amt {
+			t.Errorf("ParseAmount(%q) = %v, %v, expected %v", c.s, amt, err, c.amt)
+		}
+	}
+}
+
+// Amounts parsed print as decimal coins parsing back to them
+func FuzzParseAmount(f *testing.F) {
+	for _, s := range []string{"0", "1", "0.5", "-2.25", "1e3", "92233720368.54775807", "1/2", "0x10", "1_0", "1e999999", "x"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		amt, err := ParseAmount(s)
+		if err != nil {
+			return
+		}
+		again, err := ParseAmount(amt.String())
+		if err != nil || again != amt {
+			t.Fatalf("%q parsed as %v, which parses as %v, %v", s, amt, again, err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+/*
+ * Simulation of a 51% attack, the double-spend race of section 11 of the
+ * Bitcoin paper, played on real chains.
+ * Each trial starts an honest chain and the attacker's private chain from
+ * the same genesis. The attacker pays a merchant on the honest chain and
+ * pays itself the same coins, same nonce, on the private one. Every next
+ * Block goes to the attacker with the probability of its share of the hash
+ * power, and is mined and appended to the chain of its finder. Once the
+ * payment has the confirmations the merchant waits for and the private
+ * chain carries more work, the attacker releases it: the honest chain
+ * reorganizes onto it, see reorg.go, and the trial counts as a success if
+ * the payment to the merchant is undone. The attacker gives up once too
+ * many Blocks behind.
+ *
+ * Analytic is the probability of success of the same race without giving
+ * up. The paper's formula approximates the attacker's progress while the
+ * merchant waits as Poisson and counts a tie as a win, where Reorg wants
+ * one Block more, so it comes out somewhat higher.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+type AttackSimConfig struct {
+	Share         float64 // of the hash power held by the attacker
+	Confirmations int     // Blocks the merchant waits for, the one of the payment included
+	GiveUp        int     // Blocks behind the honest chain the attacker gives up at
+	Trials        int
+	Seed          uint64
+}
+
+type AttackSimResult struct {
+	Successes   int
+	Probability float64 // share of the trials whose double spend succeeded
+	Analytic    float64 // probability of success without giving up
+	MeanBlocks  float64 // mined per trial, by both sides
+}
+
+func DefaultAttackSimConfig(share float64, confirmations int) AttackSimConfig {
+	return AttackSimConfig{Share: share, Confirmations: confirmations, GiveUp: 15, Trials: 500, Seed: 1}
+}
+
+func attackGenesis() Genesis {
+	g := DefaultGenesis(1)
+	g.ChainID = "attack-sim"
+	g.UnixTs = 1_700_000_000_000_000
+	g.Alloc = map[string]Amount{"attacker": 50 * COIN}
+	return g
+}
+
+func SimulateAttack(cfg AttackSimConfig) (AttackSimResult, error) {
+	if !(cfg.Share >= 0 && cfg.Share <= 1) || cfg.Confirmations < 1 || cfg.GiveUp < 1 || cfg.Trials < 1 {
+		return AttackSimResult{}, errors.New("attack sim needs a share of 0 to 1 and positive confirmations, give up and trials")
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	pay := Transaction{payer: "attacker", payee: "merchant", amt: 50 * COIN, nonce: 0}
+	steal := Transaction{payer: "attacker", payee: "attacker-2", amt: 50 * COIN, nonce: 0}
+
+	result := AttackSimResult{Analytic: attackSuccess(cfg.Share, cfg.Confirmations)}
+	blocks := 0
+	for range cfg.Trials {
+		honest := newFixtureBuilder("honest", attackGenesis())
+		private := newFixtureBuilder("attacker", attackGenesis())
+		branch := []Block{}
+		for {
+			h, a := honest.bc.blocks.Len()-1, len(branch)
+			if h >= cfg.Confirmations && a > h {
+				if err := honest.bc.Reorg(0, branch); err != nil {
+					return result, fmt.Errorf("releasing the private chain: %w", err)
+				}
+				if honest.bc.Balance("merchant", NATIVE_ASSET) == 0 {
+					result.Successes++
+				}
+				break
+			}
+			if h-a >= cfg.GiveUp || h >= MAX_REORG_DEPTH {
+				break
+			}
+			blocks++
+			fb, txn := honest, pay
+			if rng.Float64() < cfg.Share {
+				fb, txn = private, steal
+			}
+			var b Block
+			if fb.bc.blocks.Len() == 1 {
+				b = fb.mine(txn)
+			} else {
+				b = fb.mine()
+			}
+			if err := fb.bc.appendBlock(b); err != nil {
+				return result, err
+			}
+			if fb == private {
+				branch = append(branch, b)
+			}
+		}
+	}
+	result.Probability = float64(result.Successes) / float64(cfg.Trials)
+	result.MeanBlocks = float64(blocks) / float64(cfg.Trials)
+	return result, nil
+}
+
+/*
+ * Probability an attacker with share q of the hash power ever gets ahead of
+ * the honest chain, once z honest Blocks confirm the payment: when the z-th
+ * honest Block is found the attacker has m Blocks, negative binomially
+ * distributed, and gains the z-m+1 Blocks it lacks with probability
+ * (q/p)^(z-m+1)
+ */
+func attackSuccess(q float64, z int) float64 {
+	p := 1 - q
+	if q >= p {
+		return 1
+	}
+	behind := 0.0 // probability the attacker has at most z Blocks
+	success := 0.0
+	for m := 0; m <= z; m++ {
+		pm := binomial(m+z-1, m) * math.Pow(p, float64(z)) * math.Pow(q, float64(m))
+		behind += pm
+		success += pm * math.Pow(q/p, float64(z-m+1))
+	}
+	return success + 1 - behind
+}
+
+func binomial(n, k int) float64 {
+	c := 1.0
+	for i := 1; i <= k; i++ {
+		c = c * float64(n-k+i) / float64(i)
+	}
+	return c
+}
+
+// Print the success rate of the attack by hash power share and confirmations
+func printAttackSim(out *Output) error {
+	cfg := DefaultAttackSimConfig(0, 0)
+	out.Note("%v double spends per row, the attacker giving up %v blocks behind", cfg.Trials, cfg.GiveUp)
+	type jsonRun struct {
+		Share         float64 `json:"share"`
+		Confirmations int     `json:"confirmations"`
+		Probability   float64 `json:"probability"`
+		Analytic      float64 `json:"analytic"`
+		MeanBlocks    float64 `json:"meanBlocks"`
+	}
+	rows, view := [][]string{}, []jsonRun{}
+	for _, share := range []float64{0.1, 0.2, 0.3, 0.4} {
+		for _, z := range []int{1, 3, 6} {
+			result, err := SimulateAttack(DefaultAttackSimConfig(share, z))
+			if err != nil {
+				return err
+			}
+			rows = append(rows, []string{fmt.Sprintf("%.0f%%", 100*share), fmt.Sprint(z),
+				fmt.Sprintf("%.1f%%", 100*result.Probability), fmt.Sprintf("%.1f%%", 100*result.Analytic),
+				fmt.Sprintf("%.1f", result.MeanBlocks)})
+			view = append(view, jsonRun{share, z, result.Probability, result.Analytic, result.MeanBlocks})
+		}
+	}
+	return out.Table([]string{"share", "confirmations", "success", "analytic", "blocks"}, rows, view)
+}
@@ -0,0 +1,435 @@
+/*
+ * Scheduled backups.
+ * A Node may back its chain up to an ObjectStore every so often. Backups
+ * are incremental: each one writes a segment object holding the Blocks
+ * committed since the previous one, in the binary encoding of codec.go,
+ * and lists it in a manifest object along with the digest of the segment,
+ * the hash of its last Block and the state root after it. As in
+ * recovery.go the state itself is never stored, it is replayed from the
+ * Blocks; the root recorded with each segment is the snapshot the replayed
+ * state is checked against.
+ *
+ * A segment is read back and checked before the manifest lists it: it
+ * must match its digest and decode to Blocks that hash right and link to
+ * the previous segment. A reorganization replacing backed up Blocks drops
+ * the segments holding them, and the next backup writes the new branch.
+ *
+ * The end of each segment is a restore point: RestoreBackup rebuilds the
+ * chain from genesis up to any of them, validating every Block like
+ * Import. The retention policy bounds how many restore points are kept and
+ * for how long, by merging the two oldest segments into one: the Blocks
+ * stay restorable, only the intermediate point is gone.
+ *
+ * Use a store without a cache for backups, as the manifest changes.
+ *
+ *	GET /backups  manifest of the backups of the node
+ */
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Default time between two backups
+const BACKUP_INTERVAL = 10 * time.Minute
+
+// Key of the manifest in the backup store
+const BACKUP_MANIFEST = "backup-manifest.json"
+
+type BackupPolicy struct {
+	Interval time.Duration // between two backups
+	Keep     int           // most restore points kept, 0 for no limit
+	MaxAge   time.Duration // restore points older than this are merged away, 0 for no limit
+}
+
+// A backup every BACKUP_INTERVAL, keeping the restore points of a day
+func DefaultBackupPolicy() BackupPolicy {
+	return BackupPolicy{Interval: BACKUP_INTERVAL, Keep: int(24 * time.Hour / BACKUP_INTERVAL)}
+}
+
+type BackupPoint struct {
+	From      int    `json:"from"`      // height of the first Block of the segment
+	To        int    `json:"to"`        // height of the last Block, the restore point
+	Hash      string `json:"hash"`      // of the Block at To
+	StateRoot string `json:"stateRoot"` // after the Block at To
+	Segment   string `json:"segment"`   // key of the segment object
+	Digest    string `json:"digest"`    // SHA256 of the segment object
+	UnixTs    int64  `json:"unixTs"`    // of the backup, unix microseconds
+}
+
+type BackupManifest struct {
+	Genesis     Genesis       `json:"genesis"`
+	GenesisHash string        `json:"genesisHash"`
+	Points      []BackupPoint `json:"points"` // oldest first, each segment following the previous one
+}
+
+func backupKey(from, to int) string {
+	return fmt.Sprintf("backup-%08d-%08d.bin", from, to)
+}
+
+// Manifest of the backups in store, empty if there are none
+func ReadBackupManifest(store ObjectStore) (BackupManifest, error) {
+	raw, err := store.Get(BACKUP_MANIFEST)
+	if errors.Is(err, os.ErrNotExist) {
+		return BackupManifest{Points: []BackupPoint{}}, nil
+	}
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	var m BackupManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return BackupManifest{}, fmt.Errorf("%w: %v: %w", ErrInvalidBackup, BACKUP_MANIFEST, err)
+	}
+	return m, nil
+}
+
+/*
+ * Blocks of the segment of p, checked against its digest and hashes,
+ * prevHash being the hash of the Block before the segment
+ * Fails with ErrInvalidBackup
+ */
+func readSegment(store ObjectStore, p BackupPoint, prevHash string) ([]Block, error) {
+	raw, err := store.Get(p.Segment)
+	if err != nil {
+		return nil, fmt.Errorf("reading segment %v: %w", p.Segment, err)
+	}
+	if SHA256(raw) != p.Digest {
+		return nil, fmt.Errorf("%w: segment %v does not match its digest", ErrInvalidBackup, p.Segment)
+	}
+	blocks, err := DecodeBlocks(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: segment %v: %w", ErrInvalidBackup, p.Segment, err)
+	}
+	if len(blocks) != p.To-p.From+1 {
+		return nil, fmt.Errorf("%w: segment %v holds %v blocks, expected %v", ErrInvalidBackup, p.Segment, len(blocks), p.To-p.From+1)
+	}
+	for i, b := range blocks {
+		if b.prevHash != prevHash || b.computeHash() != b.hash {
+			return nil, fmt.Errorf("%w: block %v at height %v of segment %v does not link", ErrInvalidBackup, b.hash, p.From+i, p.Segment)
+		}
+		prevHash = b.hash
+	}
+	if prevHash != p.Hash {
+		return nil, fmt.Errorf("%w: segment %v ends at %v, expected %v", ErrInvalidBackup, p.Segment, prevHash, p.Hash)
+	}
+	return blocks, nil
+}
+
+// Blocks to back up and the restore point they end at
+type backupSegment struct {
+	kept   int // restore points of the manifest still on the chain
+	blocks []Block
+	point  BackupPoint
+}
+
+/*
+ * Blocks of the chain past the last restore point of m still on it
+ * Fails with ErrPruned if some of them were pruned
+ */
+func (bc *BlockChain) pendingBackup(m BackupManifest) (backupSegment, error) {
+	if m.GenesisHash != "" && m.GenesisHash != bc.GenesisHash() {
+		return backupSegment{}, fmt.Errorf("%w: genesis %v, the chain has %v", ErrInvalidBackup, m.GenesisHash, bc.GenesisHash())
+	}
+	seg := backupSegment{kept: len(m.Points)}
+	for ; seg.kept > 0; seg.kept-- {
+		p := m.Points[seg.kept-1]
+		if p.To < bc.blocks.Len() && bc.blockAt(p.To).hash == p.Hash {
+			break
+		}
+	}
+	from, tip := 1, bc.blocks.Len()-1
+	if seg.kept > 0 {
+		from = m.Points[seg.kept-1].To + 1
+	}
+	if from > tip {
+		return seg, nil
+	}
+	if bc.isPruned(from) {
+		return backupSegment{}, fmt.Errorf("%w: bodies from height %v on were never backed up", ErrPruned, from)
+	}
+	for height := from; height <= tip; height++ {
+		seg.blocks = append(seg.blocks, bc.blockAt(height))
+	}
+	seg.point = BackupPoint{
+		From:      from,
+		To:        tip,
+		Hash:      bc.blockAt(tip).hash,
+		StateRoot: bc.state.Root(),
+		Segment:   backupKey(from, tip),
+		UnixTs:    bc.now().UnixMicro(),
+	}
+	return seg, nil
+}
+
+/*
+ * Write seg to store, list it in m and apply policy, then drop the
+ * segments m no longer lists
+ * Returns false if there was nothing to write
+ */
+func writeBackup(store ObjectStore, m *BackupManifest, seg backupSegment, policy BackupPolicy) (bool, error) {
+	dropped := m.Points[seg.kept:]
+	m.Points = m.Points[:seg.kept:seg.kept]
+	if len(seg.blocks) == 0 && len(dropped) == 0 {
+		return false, nil
+	}
+	if len(seg.blocks) > 0 {
+		raw := EncodeBlocks(seg.blocks)
+		seg.point.Digest = SHA256(raw)
+		if err := store.Put(seg.point.Segment, raw); err != nil {
+			return false, fmt.Errorf("writing segment %v: %w", seg.point.Segment, err)
+		}
+		if _, err := readSegment(store, seg.point, seg.blocks[0].prevHash); err != nil {
+			return false, err
+		}
+		m.Points = append(m.Points, seg.point)
+	}
+	merged, err := m.retain(store, policy, seg.point.UnixTs)
+	if err != nil {
+		return false, err
+	}
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := store.Put(BACKUP_MANIFEST, raw); err != nil {
+		return false, fmt.Errorf("writing %v: %w", BACKUP_MANIFEST, err)
+	}
+
+	// Delete once the manifest no longer lists them, sparing keys reused by a new segment
+	for _, p := range append(dropped, merged...) {
+		if !m.lists(p.Segment) {
+			if err := store.Delete(p.Segment); err != nil {
+				log.Printf("backups: deleting %v: %v", p.Segment, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+func (m *BackupManifest) lists(segment string) bool {
+	for _, p := range m.Points {
+		if p.Segment == segment {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Merge the two oldest segments while policy has too many restore points
+ * or too old ones as of unixTs, returning the points merged away
+ */
+func (m *BackupManifest) retain(store ObjectStore, policy BackupPolicy, unixTs int64) ([]BackupPoint, error) {
+	var merged []BackupPoint
+	for len(m.Points) > 1 {
+		first, second := m.Points[0], m.Points[1]
+		tooMany := policy.Keep > 0 && len(m.Points) > policy.Keep
+		tooOld := policy.MaxAge > 0 && time.Duration(unixTs-first.UnixTs)*time.Microsecond > policy.MaxAge
+		if !tooMany && !tooOld {
+			break
+		}
+		blocks, err := readSegment(store, first, m.GenesisHash)
+		if err != nil {
+			return nil, err
+		}
+		more, err := readSegment(store, second, first.Hash)
+		if err != nil {
+			return nil, err
+		}
+		raw := EncodeBlocks(append(blocks, more...))
+		p := second
+		p.From, p.Segment, p.Digest = first.From, backupKey(first.From, second.To), SHA256(raw)
+		if err := store.Put(p.Segment, raw); err != nil {
+			return nil, fmt.Errorf("writing segment %v: %w", p.Segment, err)
+		}
+		m.Points = append([]BackupPoint{p}, m.Points[2:]...)
+		merged = append(merged, first, second)
+	}
+	return merged, nil
+}
+
+/*
+ * Back the Blocks committed since the last backup in store up, applying
+ * policy, and return the new restore point, false if there was nothing
+ * new to back up
+ */
+func (bc *BlockChain) Backup(store ObjectStore, policy BackupPolicy) (BackupPoint, bool, error) {
+	m, err := ReadBackupManifest(store)
+	if err != nil {
+		return BackupPoint{}, false, err
+	}
+	m.Genesis, m.GenesisHash = bc.genesis, bc.GenesisHash()
+	seg, err := bc.pendingBackup(m)
+	if err != nil {
+		return BackupPoint{}, false, err
+	}
+	written, err := writeBackup(store, &m, seg, policy)
+	if err != nil || len(seg.blocks) == 0 {
+		return BackupPoint{}, false, err
+	}
+	return seg.point, written, nil
+}
+
+/*
+ * Rebuild the chain backed up in store up to the restore point at height,
+ * 0 for the latest, validating every Block and checking the state root of
+ * every restore point on the way
+ */
+func RestoreBackup(store ObjectStore, height int) (BlockChain, error) {
+	m, err := ReadBackupManifest(store)
+	if err != nil {
+		return BlockChain{}, err
+	}
+	if len(m.Points) == 0 {
+		return BlockChain{}, errors.New("no backup in the store")
+	}
+	last := len(m.Points) - 1
+	if height > 0 {
+		for last >= 0 && m.Points[last].To != height {
+			last--
+		}
+		if last < 0 {
+			return BlockChain{}, fmt.Errorf("height %v is not a restore point of the backup", height)
+		}
+	}
+	bc := CreateBlockChain(m.Genesis)
+	if bc.GenesisHash() != m.GenesisHash {
+		return BlockChain{}, fmt.Errorf("%w: genesis spec gives %v, the manifest has %v", ErrInvalidBackup, bc.GenesisHash(), m.GenesisHash)
+	}
+	for _, p := range m.Points[:last+1] {
+		blocks, err := readSegment(store, p, bc.lastBlock().hash)
+		if err != nil {
+			return BlockChain{}, err
+		}
+		for i, b := range blocks {
+			if err := bc.appendBlock(b); err != nil {
+				return BlockChain{}, fmt.Errorf("block %v: %w", p.From+i, err)
+			}
+		}
+		if root := bc.state.Root(); root != p.StateRoot {
+			return BlockChain{}, fmt.Errorf("%w: state root %v at height %v, the backup has %v", ErrInvalidBackup, root, p.To, p.StateRoot)
+		}
+	}
+	return bc, nil
+}
+
+// Backs the chain of a Node up at regular intervals
+type backupJob struct {
+	store  ObjectStore
+	policy BackupPolicy
+	stop   chan struct{} // closed to stop backing up
+	done   chan struct{} // closed when the loop exited
+}
+
+// Back the chain up to store every policy.Interval, until StopBackups
+func (n *Node) StartBackups(store ObjectStore, policy BackupPolicy) error {
+	if policy.Interval <= 0 {
+		return fmt.Errorf("backup interval %v is not positive", policy.Interval)
+	}
+	n.StopBackups()
+	job := &backupJob{store: store, policy: policy, stop: make(chan struct{}), done: make(chan struct{})}
+	n.mu.Lock()
+	n.backups = job
+	n.mu.Unlock()
+	go n.runBackups(job)
+	return nil
+}
+
+// Stop backing up, a no-op if not backing up
+func (n *Node) StopBackups() {
+	n.mu.Lock()
+	job := n.backups
+	n.backups = nil
+	n.mu.Unlock()
+	if job != nil {
+		close(job.stop)
+		<-job.done
+	}
+}
+
+func (n *Node) runBackups(job *backupJob) {
+	defer close(job.done)
+	ticker := time.NewTicker(job.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-job.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := n.backup(job); err != nil {
+			log.Printf("backups: %v", err)
+		}
+	}
+}
+
+// Collect the Blocks to back up with the chain locked, then write them unlocked
+func (n *Node) backup(job *backupJob) error {
+	m, err := ReadBackupManifest(job.store)
+	if err != nil {
+		return err
+	}
+	var seg backupSegment
+	n.withChain(func(bc *BlockChain) {
+		m.Genesis, m.GenesisHash = bc.genesis, bc.GenesisHash()
+		seg, err = bc.pendingBackup(m)
+	})
+	if err != nil {
+		return err
+	}
+	written, err := writeBackup(job.store, &m, seg, job.policy)
+	if written && len(seg.blocks) > 0 {
+		log.Printf("backups: blocks %v to %v backed up to %v", seg.point.From, seg.point.To, seg.point.Segment)
+	}
+	return err
+}
+
+/*
+ * Manifest of the backups of the Node
+ * Fails with ErrNoBackups if the Node does not back up
+ */
+func (n *Node) Backups() (BackupManifest, error) {
+	n.mu.Lock()
+	job := n.backups
+	n.mu.Unlock()
+	if job == nil {
+		return BackupManifest{}, ErrNoBackups
+	}
+	return ReadBackupManifest(job.store)
+}
+
+// Print the restore points of the backups in store, returning the exit code
+func runBackups(store ObjectStore, out *Output) int {
+	m, err := ReadBackupManifest(store)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	rows := make([][]string, len(m.Points))
+	for i, p := range m.Points {
+		rows[i] = []string{
+			fmt.Sprint(p.To), p.Hash, fmt.Sprintf("%v-%v", p.From, p.To), p.StateRoot,
+			time.UnixMicro(p.UnixTs).UTC().Format(time.RFC3339),
+		}
+	}
+	if err := out.Table([]string{"height", "hash", "segment", "state root", "time"}, rows, m); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleBackups(w http.ResponseWriter, r *http.Request) {
+	m, err := s.node.Backups()
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
@@ -0,0 +1,500 @@
+/*
+ * BFT consensus among a committee of validators, Tendermint-style.
+ * With Proof Of Work a Block is never final, only ever less likely to be
+ * reverted as Blocks pile on top of it, see finality.go and attacksim.go.
+ * A committee of n known validators can do better: once more than 2/3 of
+ * them sign for a Block, it is final at once, as long as less than a third
+ * of them are faulty. Each height goes through rounds of three steps:
+ *
+ *	propose    the proposer of the round, validator (height+round) mod n,
+ *	           sends its Block, or the one it is locked on
+ *	prevote    each validator votes for the proposal if valid, and if it
+ *	           is not locked on another Block, or votes nil
+ *	precommit  a validator seeing prevotes of more than 2/3 for the
+ *	           proposal locks on it and precommits it, or precommits nil
+ *
+ * A validator seeing precommits of more than 2/3 for a Block commits it:
+ * those precommits are the BFTCommit, which anyone knowing the keys of the
+ * committee checks, and the validators missing the last precommits catch
+ * up with it. A round without such precommits, eg. whose proposer is down,
+ * times out and the next proposer tries. The locks keep two Blocks from
+ * being committed at one height: a quorum precommitting one is locked on
+ * it, and any two quorums share an honest validator.
+ *
+ * The committee runs in the process, each validator on its own replica of
+ * the chain. Blocks are still mined, at the chain's difficulty, so every
+ * replica validates them as before; the committee decides which one the
+ * chain commits, and a reorganization never undoes it. Validators may be
+ * faulty:
+ *
+ *	offline     neither proposes nor votes, catching up on the commits
+ *	equivocate  proposes two Blocks, one to the validators of even index
+ *	            and one to the others, and votes to each validator for
+ *	            the proposal it received
+ *
+ * With f faults out of n >= 3f+1, every height commits, the offline
+ * proposers costing a round each. A third or more offline stops the chain,
+ * with ErrNoQuorum; a third or more equivocating forks it. -bft-sim N runs
+ * both cases, and compares the finality with Proof Of Work's.
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Rounds at a height before giving up with ErrNoQuorum
+const BFT_MAX_ROUNDS = 10
+
+// Time of the clock of the committee between two readings
+const BFT_CLOCK_STEP = time.Second
+
+// Heights the committees of -bft-sim commit
+const BFT_SIM_HEIGHTS = 5
+
+// Vote types
+const (
+	BFT_PREVOTE   = "prevote"
+	BFT_PRECOMMIT = "precommit"
+)
+
+// Behaviour of a validator, see above
+type BFTFault string
+
+const (
+	BFT_HONEST     BFTFault = ""
+	BFT_OFFLINE    BFTFault = "offline"
+	BFT_EQUIVOCATE BFTFault = "equivocate"
+)
+
+type BFTVote struct {
+	Type      string `json:"type"`
+	Height    int    `json:"height"`
+	Round     int    `json:"round"`
+	Block     string `json:"block,omitempty"` // hash voted for, empty for nil
+	Validator string `json:"validator"`
+	Sig       []byte `json:"sig"`
+}
+
+// Precommits of more than 2/3 of the committee for the Block committed at a height
+type BFTCommit struct {
+	Height     int       `json:"height"`
+	Round      int       `json:"round"`
+	Block      string    `json:"block"`
+	Precommits []BFTVote `json:"precommits"`
+}
+
+type bftValidator struct {
+	wallet *Wallet
+	bc     *BlockChain
+	fault  BFTFault
+	locked *Block // at the current height
+}
+
+type Committee struct {
+	validators []*bftValidator
+	keys       map[string][]byte // public keys by validator
+	chainID    string
+	commits    []BFTCommit // oldest first
+	rounds     int         // run so far, at all heights
+}
+
+// Committee of n honest validators, validator0 to validator<n-1>, each on a replica of the chain of genesis
+func NewCommittee(n int, genesis Genesis) (*Committee, error) {
+	if n < 1 {
+		return nil, errors.New("a committee needs a validator")
+	}
+	c := &Committee{keys: map[string][]byte{}, chainID: genesis.ChainID}
+	clock := NewStepClock(time.UnixMicro(genesis.UnixTs), BFT_CLOCK_STEP)
+	for i := range n {
+		w, err := NewWallet(fmt.Sprintf("validator%v", i))
+		if err != nil {
+			return nil, err
+		}
+		bc := CreateBlockChain(genesis)
+		bc.SetClock(clock)
+		bc.SetMiner(w.Account())
+		c.validators = append(c.validators, &bftValidator{wallet: w, bc: &bc})
+		c.keys[w.Account()] = w.PublicKey()
+	}
+	return c, nil
+}
+
+func (c *Committee) Len() int {
+	return len(c.validators)
+}
+
+// Make validator i behave as fault from now on
+func (c *Committee) SetFault(i int, fault BFTFault) {
+	c.validators[i].fault = fault
+}
+
+// Replica of the chain of validator i
+func (c *Committee) Chain(i int) *BlockChain {
+	return c.validators[i].bc
+}
+
+// Commits so far, oldest first
+func (c *Committee) Commits() []BFTCommit {
+	return c.commits
+}
+
+// Rounds run so far, at all heights
+func (c *Committee) Rounds() int {
+	return c.rounds
+}
+
+// Submit txn to the Mempool of every validator, failing if one refuses it
+func (c *Committee) Submit(txn Transaction) error {
+	for _, v := range c.validators {
+		if err := v.bc.AddTxn(txn); err != nil {
+			return fmt.Errorf("%v: %w", v.wallet.Account(), err)
+		}
+	}
+	return nil
+}
+
+// Whether the transaction hash is in a committed Block, final once there whatever comes next
+func (c *Committee) IsFinal(hash string) bool {
+	return c.validators[0].bc.Confirmations(hash) > 0
+}
+
+// Whether more than 2/3 of the committee count
+func (c *Committee) quorum(count int) bool {
+	return 3*count > 2*len(c.validators)
+}
+
+func (c *Committee) voteDigest(vote BFTVote) []byte {
+	digest := sha256.Sum256(fmt.Appendf(nil, "bft|%v|%v|%v|%v|%v", c.chainID, vote.Type, vote.Height, vote.Round, vote.Block))
+	return digest[:]
+}
+
+func (c *Committee) vote(v *bftValidator, kind string, height, round int, block string) BFTVote {
+	vote := BFTVote{Type: kind, Height: height, Round: round, Block: block, Validator: v.wallet.Account()}
+	sig, err := v.wallet.Sign(c.voteDigest(vote))
+	if err != nil {
+		log.Printf("%v: signing %v: %v", vote.Validator, kind, err)
+	}
+	vote.Sig = sig
+	return vote
+}
+
+/*
+ * Count the votes of kind at height and round for each Block, once per
+ * validator, skipping the ones not signed by a member of the committee
+ */
+func (c *Committee) tally(votes []BFTVote, kind string, height, round int) map[string]int {
+	counts := map[string]int{}
+	seen := map[string]bool{}
+	for _, vote := range votes {
+		key, ok := c.keys[vote.Validator]
+		if !ok || seen[vote.Validator] || vote.Type != kind || vote.Height != height || vote.Round != round {
+			continue
+		}
+		if !verifySignature(SchemeECDSA, key, c.voteDigest(vote), vote.Sig) {
+			continue
+		}
+		seen[vote.Validator] = true
+		counts[vote.Block]++
+	}
+	return counts
+}
+
+// Check commit carries valid precommits of more than 2/3 of the committee for its Block
+func (c *Committee) Verify(commit BFTCommit) error {
+	counts := c.tally(commit.Precommits, BFT_PRECOMMIT, commit.Height, commit.Round)
+	if commit.Block == "" || !c.quorum(counts[commit.Block]) {
+		return fmt.Errorf("%w: %v valid precommits of %v for %v at height %v", ErrInvalidCommit, counts[commit.Block], len(c.validators), commit.Block, commit.Height)
+	}
+	return nil
+}
+
+/*
+ * Block v proposes on its chain: the pending transactions that apply, in
+ * the order of its builder and within the block limits, mined but not
+ * appended, the Mempool left untouched should another Block be committed
+ */
+func (v *bftValidator) propose() (Block, error) {
+	bc := v.bc
+	state := bc.state.clone()
+	data := []Transaction{}
+	skipped := map[string]bool{}
+	limits, size := bc.blockLimits(), 1
+	var gas uint64
+	for _, txn := range bc.mempool.packingOrder(bc.builder) {
+		if skipped[txn.payer] || gas+txn.gas() > BLOCK_GAS_LIMIT || !limits.fits(len(data)+1, size+txn.size()+1) || !bc.unlocked(txn) || state.apply(txn) != nil {
+			skipped[txn.payer] = true
+			continue
+		}
+		gas += txn.gas()
+		size += txn.size() + 1
+		data = append(data, txn)
+	}
+	b := Block{
+		Header: Header{prevHash: bc.lastBlock().hash, miner: bc.miner, unixTs: bc.nextBlockTime()},
+		data:   data,
+	}
+	state, err := bc.DryRun(b)
+	if err != nil {
+		// Propose an empty Block rather than none
+		b.data = []Transaction{}
+		if state, err = bc.DryRun(b); err != nil {
+			return Block{}, err
+		}
+	}
+	bc.commitState(&b, state)
+	bc.commitAddresses(&b)
+	bc.commitVersion(&b)
+	bc.mine(&b)
+	return b, nil
+}
+
+// Append b, committed by the committee, and drop the transactions it spent the nonces of from the Mempool
+func (v *bftValidator) commit(b Block) error {
+	if err := v.bc.appendBlock(b); err != nil {
+		return err
+	}
+	v.bc.dropIncluded(b)
+	v.locked = nil
+	return nil
+}
+
+// Proposal each validator receives in round at height, nil for none
+func (c *Committee) proposals(height, round int) ([]*Block, error) {
+	proposals := make([]*Block, len(c.validators))
+	proposer := c.validators[(height+round)%len(c.validators)]
+	switch proposer.fault {
+	case BFT_OFFLINE:
+	case BFT_EQUIVOCATE:
+		// The clock moves at each reading, so the two Blocks differ by their timestamps at least
+		a, err := proposer.propose()
+		if err != nil {
+			return nil, err
+		}
+		b, err := proposer.propose()
+		if err != nil {
+			return nil, err
+		}
+		for i := range proposals {
+			proposals[i] = map[bool]*Block{true: &a, false: &b}[i%2 == 0]
+		}
+	default:
+		b := proposer.locked
+		if b == nil {
+			proposed, err := proposer.propose()
+			if err != nil {
+				return nil, err
+			}
+			b = &proposed
+		}
+		for i := range proposals {
+			proposals[i] = b
+		}
+	}
+	return proposals, nil
+}
+
+// Votes of kind validator to receives, voting for hashes[i] if honest
+func (c *Committee) broadcast(kind string, height, round int, hashes []string, to int) []BFTVote {
+	votes := []BFTVote{}
+	for i, v := range c.validators {
+		switch v.fault {
+		case BFT_OFFLINE:
+		case BFT_EQUIVOCATE:
+			votes = append(votes, c.vote(v, kind, height, round, hashes[to]))
+		default:
+			votes = append(votes, c.vote(v, kind, height, round, hashes[i]))
+		}
+	}
+	return votes
+}
+
+/*
+ * Run round at height, returning the commits of the validators that saw
+ * precommits of more than 2/3 for a Block, by validator, and the Blocks
+ * proposed by hash
+ */
+func (c *Committee) round(height, round int) (map[int]BFTCommit, map[string]Block, error) {
+	proposals, err := c.proposals(height, round)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks := map[string]Block{}
+	prevoted := make([]string, len(c.validators))
+	for i, v := range c.validators {
+		b := proposals[i]
+		if b == nil {
+			continue
+		}
+		blocks[b.hash] = *b
+		if v.fault == BFT_HONEST && v.bc.Validate(*b) == nil && (v.locked == nil || v.locked.hash == b.hash) {
+			prevoted[i] = b.hash
+		}
+	}
+	precommitted := make([]string, len(c.validators))
+	for i, v := range c.validators {
+		if b := proposals[i]; b != nil && v.fault == BFT_HONEST && c.quorum(c.tally(c.broadcast(BFT_PREVOTE, height, round, prevoted, i), BFT_PREVOTE, height, round)[b.hash]) {
+			v.locked = b
+			precommitted[i] = b.hash
+		}
+	}
+	commits := map[int]BFTCommit{}
+	for i, v := range c.validators {
+		if v.fault != BFT_HONEST {
+			continue
+		}
+		votes := c.broadcast(BFT_PRECOMMIT, height, round, precommitted, i)
+		for hash, count := range c.tally(votes, BFT_PRECOMMIT, height, round) {
+			if hash == "" || !c.quorum(count) {
+				continue
+			}
+			commit := BFTCommit{Height: height, Round: round, Block: hash}
+			for _, vote := range votes {
+				if vote.Block == hash {
+					commit.Precommits = append(commit.Precommits, vote)
+				}
+			}
+			commits[i] = commit
+		}
+	}
+	return commits, blocks, nil
+}
+
+/*
+ * Run rounds until the committee commits the next Block, every validator
+ * appending it, and return its commit
+ * Fails with ErrNoQuorum after BFT_MAX_ROUNDS rounds without one, and with
+ * ErrForked if honest validators committed different Blocks, which takes
+ * a third of the committee or more equivocating
+ */
+func (c *Committee) CommitNext() (BFTCommit, error) {
+	height := c.validators[0].bc.blocks.Len()
+	for _, v := range c.validators {
+		v.locked = nil
+	}
+	for round := range BFT_MAX_ROUNDS {
+		c.rounds++
+		commits, blocks, err := c.round(height, round)
+		if err != nil {
+			return BFTCommit{}, err
+		}
+		if len(commits) == 0 {
+			continue
+		}
+		// The validators that committed append their Block, the others catch up with the first commit
+		var first *BFTCommit
+		forked := false
+		for i, v := range c.validators {
+			commit, ok := commits[i]
+			if !ok {
+				continue
+			}
+			if first == nil {
+				first = &commit
+			}
+			forked = forked || commit.Block != first.Block
+			if err := v.commit(blocks[commit.Block]); err != nil {
+				return BFTCommit{}, fmt.Errorf("%v: %w", v.wallet.Account(), err)
+			}
+		}
+		if err := c.Verify(*first); err != nil {
+			return BFTCommit{}, err
+		}
+		for i, v := range c.validators {
+			if _, ok := commits[i]; !ok {
+				if err := v.commit(blocks[first.Block]); err != nil {
+					return BFTCommit{}, fmt.Errorf("%v: %w", v.wallet.Account(), err)
+				}
+			}
+		}
+		c.commits = append(c.commits, *first)
+		if forked {
+			return *first, fmt.Errorf("%w at height %v", ErrForked, height)
+		}
+		return *first, nil
+	}
+	return BFTCommit{}, fmt.Errorf("%w at height %v after %v rounds", ErrNoQuorum, height, BFT_MAX_ROUNDS)
+}
+
+type BFTSimResult struct {
+	Scenario  string `json:"scenario"`
+	Committed int    `json:"committed"` // heights
+	Rounds    int    `json:"rounds"`
+	Forked    bool   `json:"forked"`
+	Error     string `json:"error,omitempty"`
+}
+
+/*
+ * Commit BFT_SIM_HEIGHTS heights, a transfer submitted for each, with a
+ * committee of n validators whose last faulty ones behave as fault
+ */
+func SimulateBFT(n, faulty int, fault BFTFault) (BFTSimResult, error) {
+	result := BFTSimResult{Scenario: "honest"}
+	if faulty > 0 {
+		result.Scenario = fmt.Sprintf("%v %v", faulty, fault)
+	}
+	c, err := NewCommittee(n, TestGenesis(2))
+	if err != nil {
+		return result, err
+	}
+	for i := n - faulty; i < n; i++ {
+		c.SetFault(i, fault)
+	}
+	for height := range BFT_SIM_HEIGHTS {
+		if err := c.Submit(Transaction{payer: "account0", payee: "account1", amt: COIN, nonce: uint64(height)}); err != nil {
+			return result, err
+		}
+		_, err := c.CommitNext()
+		result.Rounds = c.Rounds()
+		if err != nil {
+			if errors.Is(err, ErrNoQuorum) || errors.Is(err, ErrForked) {
+				result.Forked = errors.Is(err, ErrForked)
+				result.Error = err.Error()
+				return result, nil
+			}
+			return result, err
+		}
+		result.Committed++
+	}
+	return result, nil
+}
+
+/*
+ * Run committees of n validators, honest, then with the most faults they
+ * tolerate and with one more, and compare their finality with the odds of
+ * reverting a payment of FINALITY_DEPTH confirmations under Proof Of Work
+ */
+func printBFTSim(n int, out *Output) error {
+	if n < 4 {
+		return errors.New("-bft-sim needs 4 validators or more to tolerate a fault")
+	}
+	f := (n - 1) / 3
+	out.Note("%v heights per committee of %v validators, tolerating up to %v faulty", BFT_SIM_HEIGHTS, n, f)
+	type scenario struct {
+		faulty int
+		fault  BFTFault
+	}
+	rows, view := [][]string{}, []BFTSimResult{}
+	for _, s := range []scenario{{0, BFT_HONEST}, {f, BFT_OFFLINE}, {f, BFT_EQUIVOCATE}, {f + 1, BFT_OFFLINE}, {f + 1, BFT_EQUIVOCATE}} {
+		result, err := SimulateBFT(n, s.faulty, s.fault)
+		if err != nil {
+			return err
+		}
+		finality := "1 block, certain"
+		switch {
+		case result.Forked:
+			finality = "none, forked"
+		case result.Error != "":
+			finality = "none, halted"
+		}
+		rows = append(rows, []string{result.Scenario, fmt.Sprintf("%v/%v", result.Committed, BFT_SIM_HEIGHTS), fmt.Sprint(result.Rounds), finality, result.Error})
+		view = append(view, result)
+	}
+	rows = append(rows, []string{"proof of work", "-", "-",
+		fmt.Sprintf("%v blocks, %.1f%% reverted by 30%% of the hash power", FINALITY_DEPTH, 100*attackSuccess(0.3, FINALITY_DEPTH)), ""})
+	return out.Table([]string{"committee", "committed", "rounds", "finality", "error"}, rows, view)
+}
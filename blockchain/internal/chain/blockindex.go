@@ -0,0 +1,198 @@
+/*
+ * Secondary indices persisted along with the Blocks.
+ * Finding a Block or a transaction by hash otherwise scans the chain, each
+ * Block read back from cold storage unless it is one of the last, see
+ * store.go, and the transactions of each account are only indexed in
+ * memory, see addressindex.go. The tiered store keeps three indices in its
+ * object store instead, one object per key:
+ *
+ *	index-block-<hash>       height of the Block
+ *	index-txn-<hash>         height:position of the transaction
+ *	index-account-<hex>      height:position:direction of each transaction
+ *	                         of the account, hex encoded in the key
+ *
+ * The entries of a Block are written before it enters the store, the
+ * Block hash last: it marks the Block indexed, so a chain replayed from
+ * its cold Blocks on a restart rewrites none of the entries, see
+ * RecoverChain. Every entry points at a Block, which stays the truth:
+ * readers check the Block an entry points at holds what it says, so the
+ * entries a crash or a reorganization left behind, pointing at a Block
+ * never stored or since replaced, are ignored rather than served. A frozen
+ * view reads the live indices, so it no longer finds by hash the Blocks
+ * replaced since it was frozen.
+ */
+package chain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BlockStore able to find Blocks and transactions without scanning them
+type indexedStore interface {
+	blockHeight(hash string) (int, bool)
+	txnLocation(hash string) (int, int, bool) // height and position
+	accountTxns(account string) []historyEntry
+}
+
+// Indices of the Blocks of a store, kept in an ObjectStore
+type objectIndex struct {
+	store ObjectStore
+}
+
+func indexBlockKey(hash string) string {
+	return "index-block-" + hash
+}
+
+func indexTxnKey(hash string) string {
+	return "index-txn-" + hash
+}
+
+func indexAccountKey(account string) string {
+	return "index-account-" + hex.EncodeToString([]byte(account))
+}
+
+func (idx objectIndex) blockHeight(hash string) (int, bool) {
+	raw, err := idx.store.Get(indexBlockKey(hash))
+	if err != nil {
+		return 0, false
+	}
+	height, err := strconv.Atoi(string(raw))
+	return height, err == nil
+}
+
+func (idx objectIndex) txnLocation(hash string) (int, int, bool) {
+	raw, err := idx.store.Get(indexTxnKey(hash))
+	if err != nil {
+		return 0, 0, false
+	}
+	height, index, ok := parseTxnLocation(string(raw))
+	return height, index, ok
+}
+
+func parseTxnLocation(s string) (int, int, bool) {
+	h, i, ok := strings.Cut(s, ":")
+	height, err := strconv.Atoi(h)
+	index, err2 := strconv.Atoi(i)
+	return height, index, ok && err == nil && err2 == nil
+}
+
+func (idx objectIndex) accountTxns(account string) []historyEntry {
+	raw, err := idx.store.Get(indexAccountKey(account))
+	if err != nil {
+		return nil
+	}
+	entries := []historyEntry{}
+	for _, line := range strings.Fields(string(raw)) {
+		i := strings.LastIndex(line, ":")
+		if height, index, ok := parseTxnLocation(line[:max(i, 0)]); ok {
+			entries = append(entries, historyEntry{height, index, line[i+1:]})
+		}
+	}
+	return entries
+}
+
+// Replace the transactions of account from height on by added
+func (idx objectIndex) putAccount(account string, height int, added []historyEntry) error {
+	kept := []historyEntry{}
+	for _, e := range idx.accountTxns(account) {
+		if e.height < height {
+			kept = append(kept, e)
+		}
+	}
+	var list strings.Builder
+	for _, e := range append(kept, added...) {
+		fmt.Fprintf(&list, "%v:%v:%v\n", e.height, e.index, e.direction)
+	}
+	if list.Len() == 0 {
+		return deleteObject(idx.store, indexAccountKey(account))
+	}
+	return idx.store.Put(indexAccountKey(account), []byte(list.String()))
+}
+
+// Entries of the Block of each account it involves
+func blockAccounts(height int, b Block) map[string][]historyEntry {
+	accounts := map[string][]historyEntry{}
+	for i, txn := range b.data {
+		for account, direction := range txn.directions() {
+			accounts[account] = append(accounts[account], historyEntry{height, i, direction})
+		}
+	}
+	return accounts
+}
+
+// Index b at height, unless it already is
+func (idx objectIndex) put(height int, b Block) error {
+	if h, ok := idx.blockHeight(b.hash); ok && h == height {
+		return nil
+	}
+	for account, entries := range blockAccounts(height, b) {
+		if err := idx.putAccount(account, height, entries); err != nil {
+			return fmt.Errorf("indexing account %v: %w", account, err)
+		}
+	}
+	for i, txn := range b.data {
+		if err := idx.store.Put(indexTxnKey(txn.Hash()), fmt.Appendf(nil, "%v:%v", height, i)); err != nil {
+			return fmt.Errorf("indexing transaction %v: %w", txn.Hash(), err)
+		}
+	}
+	if err := idx.store.Put(indexBlockKey(b.hash), []byte(strconv.Itoa(height))); err != nil {
+		return fmt.Errorf("indexing block %v: %w", b.hash, err)
+	}
+	return nil
+}
+
+// Unindex b at height, dropped from the store, its Block hash first
+func (idx objectIndex) drop(height int, b Block) error {
+	if err := deleteObject(idx.store, indexBlockKey(b.hash)); err != nil {
+		return err
+	}
+	for _, txn := range b.data {
+		if h, _, ok := idx.txnLocation(txn.Hash()); ok && h == height {
+			if err := deleteObject(idx.store, indexTxnKey(txn.Hash())); err != nil {
+				return err
+			}
+		}
+	}
+	for account := range blockAccounts(height, b) {
+		if err := idx.putAccount(account, height, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteObject(store ObjectStore, key string) error {
+	if err := store.Delete(key); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("deleting %v: %w", key, err)
+	}
+	return nil
+}
+
+// Whether the Block at height holds the transaction of entry e for account
+func (bc BlockChain) holds(account string, e historyEntry) bool {
+	if e.height >= bc.blocks.Len() || bc.isPruned(e.height) {
+		return false
+	}
+	b := bc.blockAt(e.height)
+	return e.index < len(b.data) && b.data[e.index].directions()[account] == e.direction
+}
+
+// Transactions of account in chain order, from the index of the store if it keeps one
+func (bc BlockChain) accountTxns(account string) []historyEntry {
+	idx, ok := bc.blocks.(indexedStore)
+	if !ok {
+		return bc.history[account]
+	}
+	entries := []historyEntry{}
+	for _, e := range idx.accountTxns(account) {
+		if bc.holds(account, e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,109 @@
+/*
+ * Block size limit.
+ * A Block may hold at most so many bytes of transactions, measured as
+ * their JSON encoding, the one of exports and of GET /bodies: the "data"
+ * array of the Block, brackets and commas included. Headers are left out
+ * as their size barely varies. A chain may also cap the number of
+ * transactions per Block, on top of the byte and gas limits. Both are set
+ * by the blockLimits of the genesis spec; chains without it keep the
+ * legacy limits of MAX_TXNS_PER_BLOCK transactions and
+ * DEFAULT_MAX_BLOCK_BYTES bytes. An upgrade may change them from its
+ * height on, see upgrades.go. The miner packs transactions in the
+ * Mempool order until the next one does not fit, see Mempool.take.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const DEFAULT_MAX_BLOCK_BYTES = 1 << 20
+
+// Limits of the Blocks of a chain besides BLOCK_GAS_LIMIT
+type BlockLimits struct {
+	Bytes int `json:"bytes"`          // encoded size of the transactions of a Block
+	Txns  int `json:"txns,omitempty"` // transactions per Block, 0 for no cap
+}
+
+func (l BlockLimits) check() error {
+	if l.Bytes <= 0 {
+		return fmt.Errorf("block limit of %v bytes is not positive", l.Bytes)
+	}
+	if l.Txns < 0 {
+		return fmt.Errorf("block limit of %v transactions is negative", l.Txns)
+	}
+	return nil
+}
+
+// Committed in the genesis hash
+func (l BlockLimits) String() string {
+	return fmt.Sprintf("%v/%v", l.Bytes, l.Txns)
+}
+
+// Whether n transactions of size bytes fit in a Block
+func (l BlockLimits) fits(n, bytes int) bool {
+	return bytes <= l.Bytes && (l.Txns == 0 || n <= l.Txns)
+}
+
+// Limits of the next Block of the chain
+func (bc *BlockChain) blockLimits() BlockLimits {
+	return bc.limitsAt(bc.blocks.Len())
+}
+
+// Limits of the Block at height, those of the last upgrade setting them before it or of governance
+func (bc *BlockChain) limitsAt(height int) BlockLimits {
+	l := BlockLimits{Bytes: DEFAULT_MAX_BLOCK_BYTES, Txns: MAX_TXNS_PER_BLOCK}
+	if bc.genesis.BlockLimits != nil {
+		l = *bc.genesis.BlockLimits
+	}
+	for _, u := range bc.genesis.Upgrades {
+		if u.Height <= height && u.BlockLimits != nil {
+			l = *u.BlockLimits
+		}
+	}
+	if bytes, ok := bc.state.param(PARAM_BLOCK_BYTES, height); ok {
+		l.Bytes = int(bytes)
+	}
+	if txns, ok := bc.state.param(PARAM_BLOCK_TXNS, height); ok {
+		l.Txns = int(txns)
+	}
+	return l
+}
+
+// Bytes of the JSON encoding of txn
+func (txn Transaction) size() int {
+	raw, err := json.Marshal(txn.toJSON())
+	if err != nil {
+		panic(err)
+	}
+	return len(raw)
+}
+
+// Bytes of the transactions of the Block, see blockSize
+func (b Block) size() int {
+	return blockSize(b.data)
+}
+
+// Bytes of the JSON array of txns: brackets, the transactions and a comma between each
+func blockSize(txns []Transaction) int {
+	size := 1
+	for _, txn := range txns {
+		size += txn.size() + 1
+	}
+	return max(size, 2)
+}
+
+// Whether txn does not fit in a Block along with all pending transactions
+func (bc *BlockChain) mempoolFull(txn Transaction) bool {
+	l := bc.blockLimits()
+	return !l.fits(bc.mempool.Len()+1, blockSize(bc.mempool.pending)+txn.size()+1)
+}
+
+// Refuse a transaction that no Block of the chain can hold
+func (bc *BlockChain) checkSize(txn Transaction) error {
+	if size := blockSize([]Transaction{txn}); size > bc.blockLimits().Bytes {
+		return fmt.Errorf("%w: transaction of %v bytes in a block of at most %v", ErrBlockFull, size, bc.blockLimits().Bytes)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Block assembly strategies.
+ * The miner packs the pending transactions of the Mempool into a Block in
+ * the order a BlockBuilder gives, taking each one that fits the block and
+ * gas limits, see blocksize.go, until the Block is full. Built-in builders,
+ * picked with -builder:
+ *
+ *	fee     highest fee first, in coins at the latest fee rates, ties
+ *	        broken by arrival: the default, and what the fee projection
+ *	        and estimates of feemarket.go assume
+ *	fifo    first come first served, whatever the fee
+ *	random  a random order drawn from -builder-seed
+ *
+ * Custom builders, eg. experiments with MEV-style selection favouring some
+ * accounts or kinds of transactions, are Go types set with
+ * BlockChain.SetBlockBuilder. A builder may leave transactions out, they
+ * stay pending. The miner puts the transactions of each payer back in
+ * nonce order within the places the builder gave them, so a builder need
+ * not care for nonces. Comparing builders is running the same workload,
+ * eg. from toychain-loadgen, against nodes started with each and reading the
+ * fullness and fees of their Blocks from GET /fees.
+ */
+package chain
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Built-in builders
+const (
+	BUILDER_FEE    = "fee"
+	BUILDER_FIFO   = "fifo"
+	BUILDER_RANDOM = "random"
+)
+
+type BlockBuilder interface {
+	/*
+	 * Pending transactions in the order to pack them, from pending in
+	 * arrival order, fee giving the fee of one in coins
+	 */
+	Order(pending []Transaction, fee func(Transaction) Amount) []Transaction
+}
+
+// Function used as a BlockBuilder
+type BlockBuilderFunc func(pending []Transaction, fee func(Transaction) Amount) []Transaction
+
+func (f BlockBuilderFunc) Order(pending []Transaction, fee func(Transaction) Amount) []Transaction {
+	return f(pending, fee)
+}
+
+// Highest fee first, ties broken by arrival, the default
+type FeeBuilder struct{}
+
+func (FeeBuilder) Order(pending []Transaction, fee func(Transaction) Amount) []Transaction {
+	queues := make(map[string][]int) // indices of pending txns per payer
+	payers := []string{}
+	for i, txn := range pending {
+		if _, ok := queues[txn.payer]; !ok {
+			payers = append(payers, txn.payer)
+		}
+		queues[txn.payer] = append(queues[txn.payer], i)
+	}
+	ordered := make([]Transaction, 0, len(pending))
+	for len(ordered) < len(pending) {
+		best := -1
+		for _, payer := range payers {
+			queue := queues[payer]
+			if len(queue) == 0 {
+				continue
+			}
+			f := fee(pending[queue[0]])
+			if best < 0 || f > fee(pending[best]) || (f == fee(pending[best]) && queue[0] < best) {
+				best = queue[0]
+			}
+		}
+		ordered = append(ordered, pending[best])
+		payer := pending[best].payer
+		queues[payer] = queues[payer][1:]
+	}
+	return ordered
+}
+
+// First come first served
+type FIFOBuilder struct{}
+
+func (FIFOBuilder) Order(pending []Transaction, _ func(Transaction) Amount) []Transaction {
+	return pending
+}
+
+// Random order drawn from a seed
+type RandomBuilder struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewRandomBuilder(seed uint64) *RandomBuilder {
+	return &RandomBuilder{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (b *RandomBuilder) Order(pending []Transaction, _ func(Transaction) Amount) []Transaction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rng.Shuffle(len(pending), func(i, j int) { pending[i], pending[j] = pending[j], pending[i] })
+	return pending
+}
+
+// Built-in builder called name, a random one drawing from seed, or from the time if 0
+func NewBlockBuilder(name string, seed uint64) (BlockBuilder, error) {
+	switch name {
+	case BUILDER_FEE:
+		return FeeBuilder{}, nil
+	case BUILDER_FIFO:
+		return FIFOBuilder{}, nil
+	case BUILDER_RANDOM:
+		if seed == 0 {
+			seed = uint64(time.Now().UnixNano())
+		}
+		return NewRandomBuilder(seed), nil
+	}
+	return nil, fmt.Errorf("unknown block builder %q, want %v, %v or %v", name, BUILDER_FEE, BUILDER_FIFO, BUILDER_RANDOM)
+}
+
+// Pack new Blocks in the order of builder, by fee if nil
+func (bc *BlockChain) SetBlockBuilder(builder BlockBuilder) {
+	bc.builder = builder
+}
+
+func (mp *Mempool) feeValue(txn Transaction) Amount {
+	return txn.feeValue(mp.rates)
+}
+
+/*
+ * Pending transactions in the order of builder, by fee if nil, each
+ * payer's put back in nonce order, those it left out, repeated or made up
+ * dropped
+ */
+func (mp *Mempool) packingOrder(builder BlockBuilder) []Transaction {
+	if builder == nil {
+		return mp.ordered()
+	}
+	pending := make(map[string]bool)
+	queues := make(map[string][]Transaction) // pending txns per payer, in nonce order
+	for _, txn := range mp.pending {
+		pending[txn.Hash()] = true
+		queues[txn.payer] = append(queues[txn.payer], txn)
+	}
+	order := []Transaction{}
+	for _, txn := range builder.Order(slices.Clone(mp.pending), mp.feeValue) {
+		if !pending[txn.Hash()] {
+			continue
+		}
+		delete(pending, txn.Hash())
+		order = append(order, queues[txn.payer][0])
+		queues[txn.payer] = queues[txn.payer][1:]
+	}
+	return order
+}
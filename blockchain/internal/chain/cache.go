@@ -0,0 +1,183 @@
+/*
+ * Lookup caches.
+ * Finding a Block or a transaction by hash scans the chain, and a balance
+ * at a past height replays it, see history.go, each Block read from cold
+ * storage unless it is one of the last, see store.go. The chain keeps the
+ * results of the last lookups in LRU caches instead:
+ *
+ *	blocks    Blocks by hash, with their height
+ *	txns      committed transactions by hash, with their height
+ *	balances  balance and nonce of an account at a past height
+ *
+ * Their sizes are set with SetCacheSizes, see -block-cache, -txn-cache
+ * and -balance-cache, 0 turning a cache off, and their hits and misses
+ * are counted in the stats of the chain, see stats.go. A reorganization or
+ * pruning changes what some entries would be, so it starts new caches,
+ * the counts carrying over; snapshots keep the caches they were taken with.
+ */
+package chain
+
+import (
+	"container/list"
+	"sync"
+)
+
+type CacheSizes struct {
+	Blocks   int `json:"blocks"`
+	Txns     int `json:"txns"`
+	Balances int `json:"balances"`
+}
+
+func DefaultCacheSizes() CacheSizes {
+	return CacheSizes{Blocks: 1000, Txns: 10_000, Balances: 10_000}
+}
+
+type CacheStats struct {
+	Name     string `json:"name"`
+	Entries  int    `json:"entries"`
+	Capacity int    `json:"capacity"`
+	Hits     int    `json:"hits"`
+	Misses   int    `json:"misses"`
+}
+
+// Map of at most capacity entries, dropping the least recently used first
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[K]*list.Element
+	order    *list.List // of *lruEntry, most recently used first
+	hits     int
+	misses   int
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{capacity: capacity, entries: map[K]*list.Element{}, order: list.New()}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+	c.hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry[K, V]).value, true
+}
+
+func (c *lruCache[K, V]) put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity <= 0 {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key, value})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (c *lruCache[K, V]) stats(name string) CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{name, c.order.Len(), c.capacity, c.hits, c.misses}
+}
+
+// Empty cache of capacity entries, counting on from the hits and misses of c
+func (c *lruCache[K, V]) renew(capacity int) *lruCache[K, V] {
+	fresh := newLRUCache[K, V](capacity)
+	if c != nil {
+		s := c.stats("")
+		fresh.hits, fresh.misses = s.Hits, s.Misses
+	}
+	return fresh
+}
+
+type cachedBlock struct {
+	block  Block
+	height int
+}
+
+type cachedTxn struct {
+	txn    Transaction
+	height int
+}
+
+type balanceKey struct {
+	account, asset string
+	height         int
+}
+
+type cachedBalance struct {
+	balance Amount
+	nonce   uint64
+}
+
+type lookupCaches struct {
+	blocks    *lruCache[string, cachedBlock]
+	txns      *lruCache[string, cachedTxn]
+	balances  *lruCache[balanceKey, cachedBalance]
+	summaries *blockSummaries // of the explorer charts, see charts.go
+}
+
+// Empty caches of the given sizes, counting on from the hits and misses of c if set
+func (c *lookupCaches) renew(sizes CacheSizes) *lookupCaches {
+	if c == nil {
+		c = &lookupCaches{}
+	}
+	return &lookupCaches{c.blocks.renew(sizes.Blocks), c.txns.renew(sizes.Txns), c.balances.renew(sizes.Balances), &blockSummaries{}}
+}
+
+func (c *lookupCaches) sizes() CacheSizes {
+	return CacheSizes{c.blocks.capacity, c.txns.capacity, c.balances.capacity}
+}
+
+// Size the lookup caches, emptying them
+func (bc *BlockChain) SetCacheSizes(sizes CacheSizes) {
+	bc.caches = bc.caches.renew(sizes)
+}
+
+// Drop the entries of the lookup caches, after the Blocks changed
+func (bc *BlockChain) resetCaches() {
+	bc.caches = bc.caches.renew(bc.caches.sizes())
+}
+
+func (bc *BlockChain) CacheStats() []CacheStats {
+	return []CacheStats{bc.caches.blocks.stats("blocks"), bc.caches.txns.stats("txns"), bc.caches.balances.stats("balances")}
+}
+
+/*
+ * Balance of account in asset and its nonce as of the Block at height
+ * Fails with ErrUnknownHeight or ErrPruned, see WithHeight
+ */
+func (bc *BlockChain) balanceAt(account, asset string, height int) (Amount, uint64, error) {
+	if height == bc.blocks.Len()-1 {
+		return bc.state.Balance(account, asset), bc.state.nonce(account), nil
+	}
+	key := balanceKey{account, asset, height}
+	if c, ok := bc.caches.balances.get(key); ok {
+		return c.balance, c.nonce, nil
+	}
+	view, err := bc.WithHeight(height)
+	if err != nil {
+		return 0, 0, err
+	}
+	c := cachedBalance{view.Balance(account, asset), view.Nonce(account)}
+	bc.caches.balances.put(key, c)
+	return c.balance, c.nonce, nil
+}
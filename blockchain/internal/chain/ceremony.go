@@ -0,0 +1,188 @@
+/*
+ * Genesis ceremony for multi-party chains.
+ * Each participant writes a contribution file with their validator key and
+ * the allocations they bring in. Anyone holding the same contribution files
+ * assembles the exact same genesis spec from them, and every participant
+ * checks they derived the same genesis hash before starting their node.
+ */
+package chain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type CeremonyContribution struct {
+	Participant string            `json:"participant"`
+	Validator   *GenesisValidator `json:"validator,omitempty"`
+	Alloc       map[string]Amount `json:"alloc,omitempty"`
+
+	Assets map[string]map[string]Amount `json:"assets,omitempty"`
+}
+
+// Read every *.json contribution in dir
+func LoadContributions(dir string) ([]CeremonyContribution, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	contributions := []CeremonyContribution{}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var c CeremonyContribution
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("parsing %v: %w", path, err)
+		}
+		contributions = append(contributions, c)
+	}
+	return contributions, nil
+}
+
+/*
+ * Merge contributions into base, independently of their order
+ * Two contributions allocating to the same account or registering the
+ * same validator are rejected rather than silently combined
+ */
+func AssembleGenesis(base Genesis, contributions []CeremonyContribution) (Genesis, error) {
+	sorted := append([]CeremonyContribution{}, contributions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Participant < sorted[j].Participant })
+
+	g := base
+	g.Alloc = make(map[string]Amount)
+	g.Assets = make(map[string]map[string]Amount)
+	g.Validators = append([]GenesisValidator{}, base.Validators...)
+	allocatedBy := make(map[string]string)
+	allocate := func(participant, asset, account string, amt Amount) error {
+		id := fmt.Sprintf("%q/%v", asset, account)
+		if other, ok := allocatedBy[id]; ok {
+			return fmt.Errorf("%v and %v both allocate to %v (asset %q)", other, participant, account, asset)
+		}
+		allocatedBy[id] = participant
+		if asset == NATIVE_ASSET {
+			g.Alloc[account] = amt
+		} else {
+			if g.Assets[asset] == nil {
+				g.Assets[asset] = make(map[string]Amount)
+			}
+			g.Assets[asset][account] = amt
+		}
+		return nil
+	}
+	for account, amt := range base.Alloc {
+		allocate("base spec", NATIVE_ASSET, account, amt)
+	}
+	for asset, alloc := range base.Assets {
+		for account, amt := range alloc {
+			allocate("base spec", asset, account, amt)
+		}
+	}
+
+	for i, c := range sorted {
+		if c.Participant == "" {
+			return Genesis{}, errors.New("contribution without participant")
+		}
+		if i > 0 && sorted[i-1].Participant == c.Participant {
+			return Genesis{}, fmt.Errorf("%v contributed twice", c.Participant)
+		}
+		for account, amt := range c.Alloc {
+			if err := allocate(c.Participant, NATIVE_ASSET, account, amt); err != nil {
+				return Genesis{}, err
+			}
+		}
+		for asset, alloc := range c.Assets {
+			for account, amt := range alloc {
+				if err := allocate(c.Participant, asset, account, amt); err != nil {
+					return Genesis{}, err
+				}
+			}
+		}
+		if c.Validator != nil {
+			g.Validators = append(g.Validators, *c.Validator)
+		}
+	}
+	sort.Slice(g.Validators, func(i, j int) bool { return g.Validators[i].Name < g.Validators[j].Name })
+	for i := 1; i < len(g.Validators); i++ {
+		if g.Validators[i].Name == g.Validators[i-1].Name {
+			return Genesis{}, fmt.Errorf("validator %v registered twice", g.Validators[i].Name)
+		}
+	}
+	return g, nil
+}
+
+// Check g produces the genesis Block hash everyone agreed on
+func VerifyGenesis(g Genesis, expectedHash string) error {
+	if hash := g.block().hash; hash != expectedHash {
+		return fmt.Errorf("genesis hash %v, expected %v", hash, expectedHash)
+	}
+	return nil
+}
+
+// Parse account=amt,account=amt
+func parseAlloc(s string) (map[string]Amount, error) {
+	alloc := make(map[string]Amount)
+	for _, pair := range splitList(s) {
+		account, amt, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("allocation %q is not account=amount", pair)
+		}
+		value, err := ParseAmount(amt)
+		if err != nil {
+			return nil, fmt.Errorf("allocation %q: %w", pair, err)
+		}
+		alloc[account] = value
+	}
+	return alloc, nil
+}
+
+// Write the contribution of participant to dir/participant.json
+func WriteContribution(dir, participant, alloc, validatorKey string) error {
+	c := CeremonyContribution{Participant: participant}
+	var err error
+	if c.Alloc, err = parseAlloc(alloc); err != nil {
+		return err
+	}
+	if validatorKey != "" {
+		key, err := hex.DecodeString(validatorKey)
+		if err != nil {
+			return fmt.Errorf("validator key: %w", err)
+		}
+		c.Validator = &GenesisValidator{Name: participant, Key: key}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, participant+".json"), append(raw, '\n'), 0o644)
+}
+
+// Assemble the genesis from the contributions in dir and write it to out
+func runCeremony(base Genesis, dir, out string) (string, error) {
+	contributions, err := LoadContributions(dir)
+	if err != nil {
+		return "", err
+	}
+	g, err := AssembleGenesis(base, contributions)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(out, append(raw, '\n'), 0o644); err != nil {
+		return "", err
+	}
+	return g.block().hash, nil
+}
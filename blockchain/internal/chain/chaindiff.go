@@ -0,0 +1,171 @@
+/*
+ * Chain comparison.
+ * Two student nodes disagreeing, or a sync going wrong, comes down to
+ * where their chains part. DiffChains compares two chains Block by Block
+ * and reports:
+ *
+ *	ancestor    the last Block they share, -1 on different genesis Blocks
+ *	divergence  the first height both hold different Blocks at, -1 when
+ *	            one chain extends the other
+ *	blocks      the Blocks past the ancestor on either side, by height
+ *	state       the balances and key-value entries the tips disagree on
+ *
+ * -diff A,B compares two chains, each a node API URL, downloaded and
+ * validated as a syncing node does, or an export file, see export.go, and
+ * exits with 1 when they differ.
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Blocks past the common ancestor listed
+const DIFF_MAX_BLOCKS = 100
+
+// Blocks of two chains at a height past their common ancestor
+type BlockDiff struct {
+	Height int    `json:"height"`
+	A      string `json:"a,omitempty"` // hash, "" past the tip
+	B      string `json:"b,omitempty"`
+	TxnsA  int    `json:"txnsA"`
+	TxnsB  int    `json:"txnsB"`
+}
+
+type ChainDiff struct {
+	Heights    [2]int        `json:"heights"`  // of the tips of A and B
+	Ancestor   int           `json:"ancestor"` // height of the last Block both share, -1 for none
+	Hash       string        `json:"hash,omitempty"`
+	Divergence int           `json:"divergence"` // first height both hold different Blocks at, -1 for none
+	Blocks     []BlockDiff   `json:"blocks"`     // past the ancestor, the first DIFF_MAX_BLOCKS
+	State      []StateChange `json:"state"`      // from the tip of A, old, to the tip of B, new
+}
+
+// Whether the chains hold the same Blocks
+func (d ChainDiff) Same() bool {
+	return d.Heights[0] == d.Heights[1] && d.Ancestor == d.Heights[0]
+}
+
+// Compare chain a with chain b
+func DiffChains(a, b *BlockChain) ChainDiff {
+	d := ChainDiff{Heights: [2]int{a.blocks.Len() - 1, b.blocks.Len() - 1}, Divergence: -1}
+	// Blocks link up to their parents, so the chains share every Block below one they share
+	shortest := min(d.Heights[0], d.Heights[1])
+	d.Ancestor = sort.Search(shortest+1, func(h int) bool { return a.blockAt(h).hash != b.blockAt(h).hash }) - 1
+	if d.Ancestor >= 0 {
+		d.Hash = a.blockAt(d.Ancestor).hash
+	}
+	if d.Ancestor < shortest {
+		d.Divergence = d.Ancestor + 1
+	}
+	d.Blocks = []BlockDiff{}
+	for h := d.Ancestor + 1; h <= max(d.Heights[0], d.Heights[1]) && len(d.Blocks) < DIFF_MAX_BLOCKS; h++ {
+		diff := BlockDiff{Height: h}
+		if h <= d.Heights[0] {
+			blk := a.blockAt(h)
+			diff.A, diff.TxnsA = blk.hash, len(blk.data)
+		}
+		if h <= d.Heights[1] {
+			blk := b.blockAt(h)
+			diff.B, diff.TxnsB = blk.hash, len(blk.data)
+		}
+		d.Blocks = append(d.Blocks, diff)
+	}
+	d.State = diffStates(a.state, b.state)
+	return d
+}
+
+// Chain of a node API URL or an export file
+func loadDiffChain(source string) (BlockChain, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ImportFile(source)
+	}
+	bc, err := replicaChain(source)
+	if err != nil {
+		return BlockChain{}, err
+	}
+	if _, err := bc.Sync([]string{source}); err != nil {
+		return BlockChain{}, fmt.Errorf("%v: %w", source, err)
+	}
+	return bc, nil
+}
+
+// Compare the chains of sources, A,B, returning the exit code
+func runDiff(sources string, out *Output) int {
+	paths := strings.Split(sources, ",")
+	if len(paths) != 2 {
+		log.Printf("-diff: %q is not two chains A,B", sources)
+		return 2
+	}
+	chains := [2]BlockChain{}
+	for i, path := range paths {
+		bc, err := loadDiffChain(path)
+		if err != nil {
+			log.Print(err)
+			return 2
+		}
+		chains[i] = bc
+	}
+	d := DiffChains(&chains[0], &chains[1])
+	fields := [][2]string{
+		{"ancestor", fmt.Sprint(d.Ancestor)},
+		{"hash", d.Hash},
+		{"heights", fmt.Sprintf("%v %v", d.Heights[0], d.Heights[1])},
+		{"divergence", fmt.Sprint(d.Divergence)},
+	}
+	if d.Ancestor < 0 {
+		fields[1][1] = "none, the genesis Blocks differ"
+	}
+	if d.Divergence < 0 {
+		fields[3][1] = "none"
+	}
+	code := 0
+	if !d.Same() {
+		code = 1
+	}
+	err := out.Record(fields, d)
+	if err == nil && out.mode == OutputTable {
+		err = d.writeTables(out)
+	}
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	return code
+}
+
+// Print the differing Blocks and state of d as tables
+func (d ChainDiff) writeTables(out *Output) error {
+	rows := [][]string{}
+	txns := func(hash string, n int) string {
+		if hash == "" {
+			return ""
+		}
+		return fmt.Sprint(n)
+	}
+	for _, b := range d.Blocks {
+		rows = append(rows, []string{fmt.Sprint(b.Height), b.A, txns(b.A, b.TxnsA), b.B, txns(b.B, b.TxnsB)})
+	}
+	if len(rows) > 0 {
+		out.Note("")
+		if err := out.Table([]string{"height", "a", "txns", "b", "txns"}, rows, nil); err != nil {
+			return err
+		}
+	}
+	rows = [][]string{}
+	for _, c := range d.State {
+		key, a, b := strings.TrimSpace(c.Account+" "+c.Asset), fmt.Sprint(c.Old), fmt.Sprint(c.New)
+		if c.Kind == ChangeKV {
+			key, a, b = c.Namespace+" "+c.Key, fmt.Sprintf("%q", c.Old), fmt.Sprintf("%q", c.New)
+		}
+		rows = append(rows, []string{c.Kind, key, a, b})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	out.Note("")
+	return out.Table([]string{"state", "key", "a", "b"}, rows, nil)
+}
@@ -0,0 +1,49 @@
+/*
+ * Replay protection across networks.
+ * Two classroom networks started from specs sharing accounts would accept
+ * each other's transactions: a payment signed for one could be submitted
+ * again on the other. A transaction may name the chain ID of its genesis,
+ * which then enters its signed payload, so the signatures of its parties
+ * only hold on that chain. A node refuses transactions naming another
+ * chain, and a Wallet bound to a chain with SetChainID only signs for it.
+ *
+ * Transactions naming no chain stay valid, as they were before chain IDs,
+ * unless the genesis spec turns replay protection on:
+ *
+ *	"chainId": "class-a", "replayProtection": true
+ *
+ * Every transaction of such a chain must then name it, mints aside.
+ */
+package chain
+
+import "fmt"
+
+// Bind the transaction to the chain of ID chainID, before signing it
+func (txn Transaction) WithChainID(chainID string) Transaction {
+	txn.chainID = chainID
+	return txn
+}
+
+// Sign only transactions bound to the chain of ID chainID, empty to sign for any
+func (w *Wallet) SetChainID(chainID string) {
+	w.chainID = chainID
+}
+
+// Only chain the wallet signs for, empty for any
+func (w *Wallet) ChainID() string {
+	return w.chainID
+}
+
+// Refuse transactions for another chain, and unbound ones under replay protection
+func (bc *BlockChain) checkChainID(txn Transaction) error {
+	if txn.kind == TxnMint {
+		return nil
+	}
+	if txn.chainID != "" && txn.chainID != bc.ChainID() {
+		return fmt.Errorf("%w: %q, this is %q", ErrWrongChain, txn.chainID, bc.ChainID())
+	}
+	if txn.chainID == "" && bc.genesis.ReplayProtection {
+		return fmt.Errorf("%w: it names no chain, %q requires it", ErrWrongChain, bc.ChainID())
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Read-only chain snapshots.
+ * Handlers of the HTTP API run with the lock of the Node held, see
+ * node.go, so a query walking many Blocks, like the explorer looking a
+ * transaction up by hash, holds up mining and every other request while
+ * it runs. A ChainSnapshot is the chain as of its last Block, taken under
+ * the lock in constant time and read once the lock is released:
+ *
+ *	- the state is shared: a committed State is never changed, the next
+ *	  Block leading to a new one, see DryRun, and so are its roots, see
+ *	  stateroots.go
+ *	- the Blocks are a frozen view of the BlockStore, see Freeze: later
+ *	  Blocks are appended past its end, and the store copies the Blocks
+ *	  it holds before a reorganization changes them
+ *
+ * Pruning drops the bodies of old Blocks from snapshots too. A snapshot
+ * carries no Mempool, address index or receipts, so queries on those still
+ * run under the lock.
+ */
+package chain
+
+import "fmt"
+
+type ChainSnapshot struct {
+	chain BlockChain // holding only the fields read by the queries of the snapshot
+}
+
+// Snapshot of the chain as it is, for reading without the lock of the Node
+func (bc *BlockChain) Snapshot() *ChainSnapshot {
+	return &ChainSnapshot{BlockChain{
+		genesis:    bc.genesis,
+		state:      bc.state,
+		stateRoots: bc.stateRoots,
+		blocks:     bc.blocks.Freeze(),
+		difficulty: bc.difficulty,
+		oracle:     bc.oracle,
+		txns:       bc.txns,
+		pruned:     bc.pruned,
+		caches:     bc.caches,
+	}}
+}
+
+// Snapshot of the chain of the Node, holding its lock only to take it
+func (n *Node) Snapshot() *ChainSnapshot {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.bc.Snapshot()
+}
+
+func (s *ChainSnapshot) Height() int {
+	return s.chain.blocks.Len() - 1
+}
+
+// Block at height, failing with ErrUnknownHeight past the snapshot
+func (s *ChainSnapshot) Block(height int) (Block, error) {
+	if height < 0 || height > s.Height() {
+		return Block{}, fmt.Errorf("%w: %v, snapshot height %v", ErrUnknownHeight, height, s.Height())
+	}
+	return s.chain.blocks.Get(height)
+}
+
+func (s *ChainSnapshot) LastBlock() Block {
+	return *s.chain.lastBlock()
+}
+
+func (s *ChainSnapshot) Balance(account, asset string) Amount {
+	return s.chain.Balance(account, asset)
+}
+
+// State after the last Block of the snapshot
+func (s *ChainSnapshot) State() *StateView {
+	return s.chain.latest()
+}
+
+func (s *ChainSnapshot) ChainID() string {
+	return s.chain.ChainID()
+}
@@ -0,0 +1,319 @@
+/*
+ * Chain test helpers.
+ * Code built on the chain needs chains to test against, and hand-written
+ * fixtures only cover the cases their author thought of. A TestChain
+ * builds random valid chains, random transactions and deliberately invalid
+ * Blocks for property tests and fuzzing of BlockChain.Validate. It draws
+ * everything from a seed, so a fuzzer derives it from its input and a
+ * failure replays from the seed alone:
+ *
+ *	tc := NewTestChain(seed, TestGenesis(4))
+ *	tc.Extend(10)                      // ten Blocks of random transfers
+ *	b := tc.Next()                     // a valid next Block, not appended
+ *	bad := tc.Corrupt(b, CORRUPT_WORK) // refused with CORRUPT_WORK.Err()
+ *	err := tc.Chain().Validate(bad)
+ *
+ * Each Corruption breaks one rule, and on chains of TestGenesis is refused
+ * with its Err. Mutate flips bytes of the binary encoding of a Block, see
+ * codec.go, for fuzzers to explore the rest. ReplayBlocks checks whole
+ * chains, eg. tc.Blocks() with a corrupted Block on top.
+ *
+ * -chaintest N checks these properties over the seeds 1 to N, and go test
+ * over the seeds 1 to 20, with fuzz targets for mutated Blocks, decoding,
+ * see codec_test.go, and amounts, see amount_test.go.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+)
+
+// Most transactions in a Block of Next, when the block limits allow more
+const TEST_CHAIN_BLOCK_TXNS = 8
+
+// Way of breaking a valid Block
+type Corruption string
+
+const (
+	CORRUPT_PARENT     Corruption = "parent"     // extends another Block
+	CORRUPT_HASH       Corruption = "hash"       // hash not of its header
+	CORRUPT_WORK       Corruption = "work"       // hash above the target of its difficulty
+	CORRUPT_DIFFICULTY Corruption = "difficulty" // mined at a difficulty other than the chain's
+	CORRUPT_MERKLE     Corruption = "merkle"     // transaction tampered with after mining
+	CORRUPT_TIMESTAMP  Corruption = "timestamp"  // stamped before the median time past
+	CORRUPT_OVERSPEND  Corruption = "overspend"  // transfer above the balance of its payer
+	CORRUPT_NONCE      Corruption = "nonce"      // transfer skipping a nonce of its payer
+)
+
+var CORRUPTIONS = []Corruption{
+	CORRUPT_PARENT, CORRUPT_HASH, CORRUPT_WORK, CORRUPT_DIFFICULTY,
+	CORRUPT_MERKLE, CORRUPT_TIMESTAMP, CORRUPT_OVERSPEND, CORRUPT_NONCE,
+}
+
+// Error Validate refuses a Block corrupted by c with
+func (c Corruption) Err() error {
+	switch c {
+	case CORRUPT_PARENT:
+		return ErrInvalidPrevHash
+	case CORRUPT_HASH:
+		return ErrInvalidBlockHash
+	case CORRUPT_WORK:
+		return ErrInsufficientWork
+	case CORRUPT_DIFFICULTY:
+		return ErrWrongDifficulty
+	case CORRUPT_MERKLE:
+		return ErrInvalidMerkleRoot
+	case CORRUPT_TIMESTAMP:
+		return ErrInvalidTimestamp
+	case CORRUPT_OVERSPEND:
+		return ErrInsufficientFunds
+	case CORRUPT_NONCE:
+		return ErrInvalidNonce
+	}
+	return nil
+}
+
+// Genesis spec funding accounts, at least 2, with 1000 each at difficulty 2
+func TestGenesis(accounts int) Genesis {
+	g := DefaultGenesis(2)
+	g.ChainID = "chaintest"
+	g.UnixTs = 1_700_000_000_000_000
+	g.Alloc = map[string]Amount{}
+	for i := range max(accounts, 2) {
+		g.Alloc[fmt.Sprintf("account%v", i)] = 1000 * COIN
+	}
+	return g
+}
+
+// Chain growing random Blocks from a seed
+type TestChain struct {
+	fb       *fixtureBuilder
+	rng      *rand.Rand
+	accounts []string // funded by the genesis, paying and paid by the random transactions
+}
+
+// Chain of genesis, at least 2 accounts of its allocation, drawing from seed
+func NewTestChain(seed uint64, genesis Genesis) *TestChain {
+	return &TestChain{
+		fb:       newFixtureBuilder("chaintest", genesis),
+		rng:      rand.New(rand.NewPCG(seed, 0)),
+		accounts: sortedKeys(genesis.Alloc),
+	}
+}
+
+func (tc *TestChain) Genesis() Genesis {
+	return tc.fb.fixture.Genesis
+}
+
+// The chain so far
+func (tc *TestChain) Chain() *BlockChain {
+	return &tc.fb.bc
+}
+
+// Blocks of the chain so far, genesis excluded
+func (tc *TestChain) Blocks() []Block {
+	blocks := []Block{}
+	for height := 1; height < tc.fb.bc.blocks.Len(); height++ {
+		b, err := tc.fb.bc.blocks.Get(height)
+		if err != nil {
+			panic(err)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+/*
+ * Up to n random transfers between the accounts applying in order on top of
+ * the chain, fewer when payers run low
+ */
+func (tc *TestChain) RandomTxns(n int) []Transaction {
+	state := tc.fb.bc.state
+	spent := make(map[string]Amount)
+	sent := make(map[string]uint64)
+	txns := []Transaction{}
+	for range n {
+		i := tc.rng.IntN(len(tc.accounts))
+		payer := tc.accounts[i]
+		payee := tc.accounts[(i+1+tc.rng.IntN(len(tc.accounts)-1))%len(tc.accounts)]
+		fee := Amount(tc.rng.IntN(3)) * COIN / 10
+		left := state.Balance(payer, NATIVE_ASSET) - spent[payer] - fee
+		if left < 2*COIN {
+			continue
+		}
+		amt := Amount(1+tc.rng.IntN(int(left/COIN/2))) * COIN
+		txns = append(txns, Transaction{payer: payer, payee: payee, amt: amt, fee: fee, nonce: state.nonce(payer) + sent[payer]})
+		spent[payer] += amt + fee
+		sent[payer]++
+	}
+	return txns
+}
+
+// Valid next Block of random transfers, not appended
+func (tc *TestChain) Next() Block {
+	n := TEST_CHAIN_BLOCK_TXNS
+	if limit := tc.fb.bc.blockLimits().Txns; limit > 0 {
+		n = min(n, limit)
+	}
+	return tc.fb.mine(tc.RandomTxns(1 + tc.rng.IntN(n))...)
+}
+
+// Append n Blocks of Next
+func (tc *TestChain) Extend(n int) error {
+	for range n {
+		b := tc.Next()
+		if err := tc.fb.bc.appendBlock(b); err != nil {
+			return fmt.Errorf("test chain block %v: %w", tc.fb.bc.blocks.Len(), err)
+		}
+	}
+	return nil
+}
+
+// Copy of b, a valid next Block, broken by c
+func (tc *TestChain) Corrupt(b Block, c Corruption) Block {
+	bc := &tc.fb.bc
+	b.data = slices.Clone(b.data)
+	switch c {
+	case CORRUPT_PARENT:
+		b.prevHash = SHA256([]byte("elsewhere"))
+		b.mine(bc.difficulty, bc.genesis.Pow)
+	case CORRUPT_HASH:
+		b.hash = SHA256([]byte(b.hash))
+	case CORRUPT_WORK:
+		for bc.genesis.Pow.meets(b.Header, b.hash, b.difficulty) {
+			b.nonce++
+			b.hash = b.computeHash()
+		}
+	case CORRUPT_DIFFICULTY:
+		b.mine(bc.difficulty+1, bc.genesis.Pow)
+	case CORRUPT_MERKLE:
+		if len(b.data) == 0 {
+			b.data = append(b.data, Transaction{payer: tc.accounts[0], payee: tc.accounts[1], amt: COIN})
+		} else {
+			b.data[0].amt++
+		}
+	case CORRUPT_TIMESTAMP:
+		b.unixTs = bc.genesis.UnixTs
+		b.mine(bc.difficulty, bc.genesis.Pow)
+	case CORRUPT_OVERSPEND, CORRUPT_NONCE:
+		// The last transaction, the latest of its payer, makes room for the broken one
+		if len(b.data) > 0 && !bc.blockLimits().fits(len(b.data)+1, 0) {
+			b.data = b.data[:len(b.data)-1]
+		}
+		payer, payee := tc.accounts[0], tc.accounts[1]
+		nonce, amt := bc.state.nonce(payer), COIN
+		for _, txn := range b.data {
+			if txn.payer == payer {
+				nonce++
+			}
+		}
+		if c == CORRUPT_OVERSPEND {
+			amt += bc.state.Balance(payer, NATIVE_ASSET)
+			for _, txn := range b.data {
+				amt += txn.amt
+			}
+		} else {
+			nonce++
+		}
+		tc.fb.unixTs -= 10_000_000 // stamped as b
+		b = tc.fb.mine(append(b.data, Transaction{payer: payer, payee: payee, amt: amt, nonce: nonce})...)
+	}
+	return b
+}
+
+/*
+ * Copy of b with the bytes of its binary encoding xored with data in turn,
+ * false when they no longer decode
+ */
+func Mutate(b Block, data []byte) (Block, bool) {
+	raw := EncodeBlock(b)
+	for i, x := range data {
+		raw[i%len(raw)] ^= x
+	}
+	mutated, err := DecodeBlock(raw)
+	return mutated, err == nil
+}
+
+/*
+ * Append blocks to a fresh chain of genesis, returning how many it accepted
+ * and the failure of the first refused
+ */
+func ReplayBlocks(genesis Genesis, blocks []Block) (int, error) {
+	bc := CreateBlockChain(genesis)
+	for i, b := range blocks {
+		if err := bc.appendBlock(b); err != nil {
+			return i, fmt.Errorf("block %v: %w", i+1, err)
+		}
+	}
+	return len(blocks), nil
+}
+
+/*
+ * Check the properties of the chain test helpers on the chain of seed:
+ * random chains replay, valid Blocks validate, corrupted ones are refused
+ * with the error of their corruption, and mutated ones are refused unless
+ * the mutation left their hash intact
+ */
+func checkChainTest(seed uint64) (int, error) {
+	tc := NewTestChain(seed, TestGenesis(4))
+	if err := tc.Extend(1 + tc.rng.IntN(5)); err != nil {
+		return 0, err
+	}
+	blocks := tc.Blocks()
+	if n, err := ReplayBlocks(tc.Genesis(), blocks); err != nil {
+		return n, fmt.Errorf("replaying: %w", err)
+	}
+	b := tc.Next()
+	if err := tc.Chain().Validate(b); err != nil {
+		return len(blocks), fmt.Errorf("valid block refused: %w", err)
+	}
+	for _, c := range CORRUPTIONS {
+		if err := tc.Chain().Validate(tc.Corrupt(b, c)); !errors.Is(err, c.Err()) {
+			return len(blocks), fmt.Errorf("%v corruption: got %v, expected %v", c, err, c.Err())
+		}
+		if n, err := ReplayBlocks(tc.Genesis(), append(blocks, tc.Corrupt(b, c))); !errors.Is(err, c.Err()) || n != len(blocks) {
+			return len(blocks), fmt.Errorf("replaying %v corruption: accepted %v blocks, got %v", c, n, err)
+		}
+	}
+	data := make([]byte, 8)
+	for range 100 {
+		for i := range data {
+			data[i] = byte(tc.rng.UintN(256))
+		}
+		mutated, ok := Mutate(b, data)
+		if ok && tc.Chain().Validate(mutated) == nil && mutated.hash != b.hash {
+			return len(blocks), fmt.Errorf("mutation %x of block %v accepted as %v", data, b.hash, mutated.hash)
+		}
+	}
+	return len(blocks), nil
+}
+
+// Check the chain test properties over the seeds 1 to n, returning the exit code
+func runChainTest(n int, out *Output) int {
+	type jsonResult struct {
+		Seed   uint64 `json:"seed"`
+		Blocks int    `json:"blocks"`
+		OK     bool   `json:"ok"`
+		Error  string `json:"error,omitempty"`
+	}
+	code, rows, view := 0, [][]string{}, []jsonResult{}
+	for seed := uint64(1); seed <= uint64(n); seed++ {
+		blocks, err := checkChainTest(seed)
+		r := jsonResult{Seed: seed, Blocks: blocks, OK: err == nil}
+		if err != nil {
+			r.Error = err.Error()
+			code = 1
+		}
+		rows = append(rows, []string{fmt.Sprint(r.Seed), fmt.Sprint(r.Blocks), map[bool]string{true: "ok", false: "FAIL"}[r.OK], r.Error})
+		view = append(view, r)
+	}
+	if err := out.Table([]string{"seed", "blocks", "result", "error"}, rows, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,46 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestChainTestProperties(t *testing.T) {
+	for seed := uint64(1); seed <= 20; seed++ {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			if _, err := checkChainTest(seed); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReplayBlocksOutOfOrder(t *testing.T) {
+	tc := NewTestChain(1, TestGenesis(4))
+	if err := tc.Extend(3); err != nil {
+		t.Fatal(err)
+	}
+	blocks := tc.Blocks()
+	blocks[1], blocks[2] = blocks[2], blocks[1]
+	if n, err := ReplayBlocks(tc.Genesis(), blocks); n != 1 || !errors.Is(err, ErrInvalidPrevHash) {
+		t.Fatalf("accepted %v blocks, got %v, expected 1 and %v", n, err, ErrInvalidPrevHash)
+	}
+}
+
+// Mutated Blocks are refused unless the mutation leaves their hash intact
+func FuzzValidateMutated(f *testing.F) {
+	f.Add(uint64(1), []byte{1})
+	f.Add(uint64(2), []byte{0, 0, 0, 0x80})
+	f.Fuzz(func(t *testing.T, seed uint64, data []byte) {
+		tc := NewTestChain(seed, TestGenesis(4))
+		if err := tc.Extend(2); err != nil {
+			t.Fatal(err)
+		}
+		b := tc.Next()
+		mutated, ok := Mutate(b, data)
+		if ok && tc.Chain().Validate(mutated) == nil && mutated.hash != b.hash {
+			t.Fatalf("mutation %x of block %v accepted as %v", data, b.hash, mutated.hash)
+		}
+	})
+}
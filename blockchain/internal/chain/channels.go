@@ -0,0 +1,286 @@
+/*
+ * Payment channels.
+ * A one-way channel, after Spilman, built on multisig accounts, see
+ * multisig.go, and time locks, see timelocks.go, so a payer pays a payee
+ * many times off chain and the chain only sees the opening and the close:
+ *
+ *	- open: the channel account, named after the channel ID, is declared
+ *	  a 2-of-2 multisig of the payer and the payee, see Declare. Both sign
+ *	  the Refund, paying the deposit back to the payer from the height of
+ *	  the timeout on, and only then does the payer Fund the account
+ *	- pay: the payer signs a settlement of the channel paying the payee
+ *	  the total paid so far and the payer the rest of the deposit, a
+ *	  ChannelUpdate sent off chain, see Pay. The payee checks it, see
+ *	  Accept, and keeps the latest
+ *	- close: the payee adds its signature to the latest settlement and
+ *	  submits it, see Close, before the timeout
+ *
+ * The settlements and the refund all spend the same nonce of the channel
+ * account, so a single one ever applies. The payer cannot close with an
+ * older settlement, the payee not having signed it, and the payee has no
+ * reason to, each update paying it more. Should the payee vanish, the
+ * payer takes the deposit back with the refund once the timeout is
+ * reached. Channels paying both ways need the old states to be revoked,
+ * as in Lightning, which the chain has no means for: two parties paying
+ * each other open a channel each.
+ *
+ *	GET /demo/channel  steps of the demo of -channel-demo
+ */
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Prefix of the name of the channel accounts, followed by the channel ID
+const CHANNEL_ACCOUNT_PREFIX = "channel-"
+
+// Terms the payer and the payee agree on before opening a channel
+type ChannelSpec struct {
+	ID       string    `json:"id"`
+	Payer    string    `json:"payer"`
+	PayerKey []byte    `json:"payerKey"`
+	Payee    string    `json:"payee"`
+	PayeeKey []byte    `json:"payeeKey"`
+	Asset    string    `json:"asset,omitempty"` // NATIVE_ASSET for the chain's coin
+	Deposit  Amount    `json:"deposit"`
+	Timeout  int       `json:"timeout"`           // height the refund unlocks at
+	Scheme   SigScheme `json:"scheme,omitempty"`  // of the keys
+	ChainID  string    `json:"chainId,omitempty"` // of the chain of the channel, see chainid.go
+}
+
+// Payment signed by the payer, the settlement of the channel paying Paid to the payee
+type ChannelUpdate struct {
+	Channel string `json:"channel"`
+	Paid    Amount `json:"paid"` // in total since the opening
+	Sig     []byte `json:"sig"`
+}
+
+// Channel as seen by one of its parties
+type PaymentChannel struct {
+	ChannelSpec
+	latest ChannelUpdate // last update sent by the payer or accepted by the payee
+}
+
+func OpenChannel(spec ChannelSpec) (*PaymentChannel, error) {
+	if spec.ID == "" || spec.Payer == spec.Payee {
+		return nil, errors.New("a channel needs an ID and two parties")
+	}
+	if bytes.Equal(spec.PayerKey, spec.PayeeKey) {
+		return nil, errors.New("the parties of a channel need their own keys")
+	}
+	if !(spec.Deposit > 0) || spec.Timeout < 1 {
+		return nil, errors.New("a channel needs a positive deposit and timeout")
+	}
+	return &PaymentChannel{ChannelSpec: spec}, nil
+}
+
+// Account holding the deposit
+func (s ChannelSpec) Account() string {
+	return CHANNEL_ACCOUNT_PREFIX + s.ID
+}
+
+func (s ChannelSpec) bind(txn Transaction) Transaction {
+	return txn.WithScheme(s.Scheme).WithChainID(s.ChainID)
+}
+
+// Make the channel account a 2-of-2 multisig of the parties, first of all
+func (s ChannelSpec) Declare() Transaction {
+	return s.bind(NewMultisig(s.Account(), 0, 2, s.PayerKey, s.PayeeKey))
+}
+
+// Move the deposit to the channel account, once the refund is signed
+func (s ChannelSpec) Fund(nonce uint64) Transaction {
+	return s.bind(Transaction{payer: s.Payer, payee: s.Account(), asset: s.Asset, amt: s.Deposit, nonce: nonce})
+}
+
+// Deposit back to the payer, locked until the timeout, to be cosigned by both parties
+func (s ChannelSpec) Refund() Transaction {
+	return s.bind(Transaction{payer: s.Account(), payee: s.Payer, asset: s.Asset, amt: s.Deposit, nonce: 1}.WithLockHeight(s.Timeout))
+}
+
+// Close of the channel paying paid to the payee and the rest back to the payer
+func (s ChannelSpec) settlement(paid Amount) Transaction {
+	payouts := []Payout{NewPayout(s.Payee, paid)}
+	if rest := s.Deposit - paid; rest > 0 {
+		payouts = append(payouts, NewPayout(s.Payer, rest))
+	}
+	return s.bind(NewBatchTransfer(s.Account(), 1, s.Asset, payouts...))
+}
+
+// Total paid to the payee by the latest update
+func (c *PaymentChannel) Paid() Amount {
+	return c.latest.Paid
+}
+
+// Pay amt more to the payee, as the payer, returning the update to send it
+func (c *PaymentChannel) Pay(payer Signer, amt Amount) (ChannelUpdate, error) {
+	paid := c.latest.Paid + amt
+	if !(amt > 0) || paid > c.Deposit {
+		return ChannelUpdate{}, fmt.Errorf("channel %v: cannot pay %v more than %v of a deposit of %v", c.ID, amt, c.latest.Paid, c.Deposit)
+	}
+	txn := c.settlement(paid)
+	if err := txn.CoSign(payer); err != nil {
+		return ChannelUpdate{}, err
+	}
+	c.latest = ChannelUpdate{c.ID, paid, txn.cosigs[0]}
+	return c.latest, nil
+}
+
+// Check an update of the payer, as the payee, and keep it if it pays more
+func (c *PaymentChannel) Accept(u ChannelUpdate) error {
+	if u.Channel != c.ID {
+		return fmt.Errorf("update of channel %v, not %v", u.Channel, c.ID)
+	}
+	if u.Paid <= c.latest.Paid || u.Paid > c.Deposit {
+		return fmt.Errorf("channel %v: update pays %v, not more than %v up to the deposit of %v", c.ID, u.Paid, c.latest.Paid, c.Deposit)
+	}
+	if !verifySignature(c.Scheme, c.PayerKey, c.settlement(u.Paid).digest(), u.Sig) {
+		return fmt.Errorf("%w: update of channel %v not signed by %v", ErrInvalidSignature, c.ID, c.Payer)
+	}
+	c.latest = u
+	return nil
+}
+
+// Settlement of the latest update, signed by both parties, as the payee
+func (c *PaymentChannel) Close(payee Signer) (Transaction, error) {
+	if c.latest.Sig == nil {
+		return Transaction{}, fmt.Errorf("channel %v: nothing paid", c.ID)
+	}
+	txn := c.settlement(c.latest.Paid)
+	txn.cosigs = [][]byte{c.latest.Sig}
+	if err := txn.CoSign(payee); err != nil {
+		return Transaction{}, err
+	}
+	return txn, nil
+}
+
+type ChannelStep struct {
+	Description string `json:"description"`
+	OnChain     bool   `json:"onChain"`       // a Block was submitted, or the step stayed between the parties
+	Txn         string `json:"txn,omitempty"` // hash of the transaction submitted
+	Accepted    bool   `json:"accepted"`      // by the chain, or by the payee
+	Reason      string `json:"reason,omitempty"`
+
+	Paid     Amount `json:"paid"`     // to the payee by the latest update it holds
+	Channel  Amount `json:"channel"`  // balance of the channel account on chain
+	PayerBal Amount `json:"payerBal"` // on chain
+	PayeeBal Amount `json:"payeeBal"` // on chain
+}
+
+func channelGenesis() Genesis {
+	g := DefaultGenesis(2)
+	g.ChainID = "channel-demo"
+	g.Alloc = map[string]Amount{"alice": 100 * COIN}
+	return g
+}
+
+/*
+ * Open a channel from alice to bob, pay over it off chain, try the refund
+ * early, close it and try the refund again, each step recording whether
+ * the chain, or bob, accepted it
+ */
+func RunChannelDemo() ([]ChannelStep, error) {
+	alice, err := NewWallet("alice")
+	if err != nil {
+		return nil, err
+	}
+	bob, err := NewWallet("bob")
+	if err != nil {
+		return nil, err
+	}
+	fb := newFixtureBuilder("channel", channelGenesis())
+	spec := ChannelSpec{
+		ID: "alice-bob", Payer: "alice", PayerKey: alice.PublicKey(), Payee: "bob", PayeeKey: bob.PublicKey(),
+		Deposit: 30 * COIN, Timeout: 10, ChainID: fb.bc.ChainID(),
+	}
+	payer, err := OpenChannel(spec)
+	if err != nil {
+		return nil, err
+	}
+	payee, _ := OpenChannel(spec)
+
+	steps := []ChannelStep{}
+	record := func(description string, txn *Transaction, err error) {
+		step := ChannelStep{
+			Description: description,
+			OnChain:     txn != nil,
+			Accepted:    err == nil,
+			Paid:        payee.Paid(),
+			Channel:     fb.bc.Balance(spec.Account(), spec.Asset),
+			PayerBal:    fb.bc.Balance(spec.Payer, spec.Asset),
+			PayeeBal:    fb.bc.Balance(spec.Payee, spec.Asset),
+		}
+		if txn != nil {
+			step.Txn = txn.Hash()
+		}
+		if err != nil {
+			step.Reason = err.Error()
+		}
+		steps = append(steps, step)
+	}
+	submit := func(description string, txn Transaction) {
+		err := fb.bc.appendBlock(fb.mine(txn))
+		record(description, &txn, err)
+	}
+	pay := func(amt Amount) {
+		u, err := payer.Pay(alice, amt)
+		if err == nil {
+			err = payee.Accept(u)
+		}
+		record(fmt.Sprintf("alice pays bob %v off chain", amt), nil, err)
+	}
+
+	submit("channel account declared a 2-of-2 multisig of alice and bob", spec.Declare())
+	refund := spec.Refund()
+	err = errors.Join(refund.CoSign(bob), refund.CoSign(alice))
+	record(fmt.Sprintf("bob and alice sign the refund, locked until height %v", spec.Timeout), nil, err)
+	submit(fmt.Sprintf("alice funds the channel with %v", spec.Deposit), spec.Fund(0))
+	pay(5 * COIN)
+	pay(3 * COIN)
+	forged := ChannelUpdate{spec.ID, 20 * COIN, nil}
+	record("bob forges an update paying him 20", nil, payee.Accept(forged))
+	pay(4 * COIN)
+	submit("alice takes the deposit back before the timeout", refund)
+	closing, err := payee.Close(bob)
+	if err != nil {
+		return nil, err
+	}
+	submit(fmt.Sprintf("bob closes the channel with the latest update, %v to him", payee.Paid()), closing)
+	for fb.bc.blocks.Len() < spec.Timeout {
+		if err := fb.bc.appendBlock(fb.mine()); err != nil {
+			return nil, err
+		}
+	}
+	submit("alice takes the deposit back after the timeout", refund)
+	return steps, nil
+}
+
+func printChannelDemo(out *Output, steps []ChannelStep) error {
+	rows := [][]string{}
+	for _, step := range steps {
+		where, verdict := "off chain", "accepted"
+		if step.OnChain {
+			where = "on chain"
+		}
+		if !step.Accepted {
+			verdict = "rejected: " + step.Reason
+		}
+		rows = append(rows, []string{step.Description, where, verdict, fmt.Sprint(step.Paid),
+			fmt.Sprint(step.Channel), fmt.Sprint(step.PayerBal), fmt.Sprint(step.PayeeBal)})
+	}
+	return out.Table([]string{"step", "", "verdict", "paid", "channel", "alice", "bob"}, rows, steps)
+}
+
+// GET /demo/channel
+func (s *Server) handleChannelDemo(w http.ResponseWriter, r *http.Request) {
+	steps, err := RunChannelDemo()
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, steps)
+}
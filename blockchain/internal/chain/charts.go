@@ -0,0 +1,273 @@
+/*
+ * Explorer charts.
+ * The charts of the explorer aggregate many Blocks: how many are mined
+ * each hour, how long they take, how big they are and which fees they
+ * take. Fetching every Block to aggregate them in the browser stops
+ * working once the chain grows, so the node aggregates them from a
+ * snapshot, see chainsnapshot.go, and sends the buckets alone.
+ *
+ * Hours and histograms cover the whole chain by default. Rather than read
+ * every Block from cold storage again for each request, the chain keeps
+ * a summary of each Block it aggregated, its timestamp, transactions and
+ * size, along with its lookup caches, see cache.go, and reads only the
+ * Blocks past the last one summarized. The genesis Block is left out, its
+ * timestamp being set by hand, and so are the bodies of pruned Blocks,
+ * see pruning.go. Fees take the bodies of the Blocks, so their chart only
+ * covers the last CHART_MAX_FEE_BLOCKS.
+ *
+ *	GET /charts/blocks-per-hour?hours=..  blocks and transactions of each
+ *	                                      of the last hours, all if unset
+ *	GET /charts/block-times?blocks=..     histogram of the seconds between
+ *	                                      the last blocks, all if unset
+ *	GET /charts/block-sizes?blocks=..     histograms of the bytes and the
+ *	                                      transactions of the last blocks
+ *	GET /charts/fees?blocks=..            fee percentiles of each of the
+ *	                                      last blocks and of them all
+ */
+package chain
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	CHART_BUCKETS        = 20       // of a histogram
+	CHART_MAX_HOURS      = 24 * 366 // hours of the blocks per hour chart
+	CHART_MAX_FEE_BLOCKS = 1000     // Blocks of the fee chart
+	CHART_FEE_BLOCKS     = 100      // Blocks of the fee chart by default
+)
+
+// What the charts take of a Block
+type blockSummary struct {
+	unixTs int64
+	txns   int
+	bytes  int
+}
+
+// Summaries of the Blocks of a chain from genesis on, as far as charts read it
+type blockSummaries struct {
+	mu     sync.Mutex
+	blocks []blockSummary
+}
+
+/*
+ * Summaries of the Blocks of bc from height from on, summarizing those
+ * past the last one summarized
+ */
+func (bc BlockChain) summaries(from int) []blockSummary {
+	s := bc.caches.summaries
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for height := len(s.blocks); height < bc.blocks.Len(); height++ {
+		b := bc.blockAt(height)
+		s.blocks = append(s.blocks, blockSummary{b.unixTs, len(b.data), b.size()})
+	}
+	// Snapshots share the summaries of the chain, which may reach later Blocks
+	return slices.Clone(s.blocks[from:bc.blocks.Len()])
+}
+
+// First height of the last n Blocks with a body, all of them if n is 0
+func (bc BlockChain) chartStart(n int) int {
+	from := max(bc.pruned, 1)
+	if n > 0 {
+		from = max(from, bc.blocks.Len()-n)
+	}
+	return from
+}
+
+type HourBucket struct {
+	UnixTs int64 `json:"unixTs"` // start of the hour
+	Blocks int   `json:"blocks"`
+	Txns   int   `json:"txns"` // 0 for pruned Blocks
+}
+
+/*
+ * Blocks mined in each of the last hours up to that of the last Block,
+ * empty hours included, from the first Block after genesis if hours is 0,
+ * at most CHART_MAX_HOURS
+ */
+func (bc BlockChain) BlocksPerHour(hours int) []HourBucket {
+	if hours <= 0 || hours > CHART_MAX_HOURS {
+		hours = CHART_MAX_HOURS
+	}
+	buckets := []HourBucket{}
+	summaries := bc.summaries(1)
+	if len(summaries) == 0 {
+		return buckets
+	}
+	hour := time.Hour.Microseconds()
+	last := summaries[len(summaries)-1].unixTs / hour
+	first := max(summaries[0].unixTs/hour, last-int64(hours)+1)
+	for h := first; h <= last; h++ {
+		buckets = append(buckets, HourBucket{UnixTs: h * hour})
+	}
+	for i, s := range summaries {
+		// Timestamps of Blocks may go back a little, see timestamps.go
+		if h := s.unixTs / hour; h >= first && h <= last {
+			buckets[h-first].Blocks++
+			if i+1 >= bc.pruned {
+				buckets[h-first].Txns += s.txns
+			}
+		}
+	}
+	return buckets
+}
+
+type HistogramBucket struct {
+	From  float64 `json:"from"` // least value of the bucket, the next bucket starting at its end
+	Count int     `json:"count"`
+}
+
+type Histogram struct {
+	Count   int               `json:"count"` // of values
+	Min     float64           `json:"min"`
+	Max     float64           `json:"max"`
+	Mean    float64           `json:"mean"`
+	Width   float64           `json:"width"` // of each bucket
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+/*
+ * Histogram of values in at most CHART_BUCKETS buckets of the same
+ * width, whole if whole is set, the last bucket taking the largest value
+ */
+func histogram(values []float64, whole bool) Histogram {
+	h := Histogram{Count: len(values), Buckets: []HistogramBucket{}}
+	if len(values) == 0 {
+		return h
+	}
+	h.Min, h.Max = slices.Min(values), slices.Max(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	h.Mean = sum / float64(len(values))
+	h.Width = (h.Max - h.Min) / CHART_BUCKETS
+	if whole {
+		h.Width = math.Ceil((h.Max - h.Min + 1) / CHART_BUCKETS)
+	}
+	if h.Width == 0 {
+		h.Width = 1
+	}
+	n := min(CHART_BUCKETS, int(math.Floor((h.Max-h.Min)/h.Width))+1)
+	for i := range n {
+		h.Buckets = append(h.Buckets, HistogramBucket{From: h.Min + float64(i)*h.Width})
+	}
+	for _, v := range values {
+		h.Buckets[min(int((v-h.Min)/h.Width), n-1)].Count++
+	}
+	return h
+}
+
+// Histogram of the seconds between each of the last n Blocks and its parent, all of them if n is 0
+func (bc BlockChain) BlockTimes(n int) Histogram {
+	from := 1
+	if n > 0 {
+		from = max(from, bc.blocks.Len()-n-1)
+	}
+	summaries := bc.summaries(from)
+	intervals := []float64{}
+	for i := 1; i < len(summaries); i++ {
+		intervals = append(intervals, float64(summaries[i].unixTs-summaries[i-1].unixTs)/1e6)
+	}
+	return histogram(intervals, false)
+}
+
+type BlockSizes struct {
+	Bytes Histogram `json:"bytes"` // encoded size of the transactions, see blocksize.go
+	Txns  Histogram `json:"txns"`
+}
+
+// Histograms of the size of the last n Blocks with a body, all of them if n is 0
+func (bc BlockChain) BlockSizes(n int) BlockSizes {
+	bytes, txns := []float64{}, []float64{}
+	for _, s := range bc.summaries(bc.chartStart(n)) {
+		bytes = append(bytes, float64(s.bytes))
+		txns = append(txns, float64(s.txns))
+	}
+	return BlockSizes{histogram(bytes, true), histogram(txns, true)}
+}
+
+type FeeChart struct {
+	Blocks      int             `json:"blocks"`
+	Txns        int             `json:"txns"`
+	Percentiles map[int]Amount  `json:"percentiles"` // at FEE_PERCENTILES of the fees of all the Blocks
+	History     []BlockFeeStats `json:"history"`     // of each Block, oldest first
+}
+
+/*
+ * Fee percentiles of each of the last n Blocks and of all their fees,
+ * CHART_FEE_BLOCKS if n is 0 and at most CHART_MAX_FEE_BLOCKS, fees in
+ * other assets valued at the latest fee rates, see feeassets.go
+ */
+func (bc BlockChain) FeeChart(n int) FeeChart {
+	if n <= 0 {
+		n = CHART_FEE_BLOCKS
+	}
+	n = min(n, CHART_MAX_FEE_BLOCKS)
+	chart := FeeChart{Percentiles: map[int]Amount{}, History: []BlockFeeStats{}}
+	rates := bc.state.feeRates()
+	fees := []Amount{}
+	for height := bc.chartStart(n); height < bc.blocks.Len(); height++ {
+		b := bc.blockAt(height)
+		chart.History = append(chart.History, blockFeeStats(bc.limitsAt(height), rates, height, b))
+		for _, txn := range b.data {
+			if txn.kind != TxnMint {
+				fees = append(fees, txn.feeValue(rates))
+			}
+		}
+	}
+	slices.Sort(fees)
+	chart.Blocks, chart.Txns = len(chart.History), len(fees)
+	for _, p := range FEE_PERCENTILES {
+		chart.Percentiles[p] = percentile(fees, p)
+	}
+	return chart
+}
+
+// Positive count of the query parameter name, 0 if unset
+func chartParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		writeError(w, http.StatusBadRequest, name+" must be a positive number")
+		return 0, false
+	}
+	return n, true
+}
+
+// GET /charts/blocks-per-hour?hours=..
+func (s *Server) handleBlocksPerHour(w http.ResponseWriter, r *http.Request) {
+	if hours, ok := chartParam(w, r, "hours"); ok {
+		writeJSON(w, http.StatusOK, s.node.Snapshot().chain.BlocksPerHour(hours))
+	}
+}
+
+// GET /charts/block-times?blocks=..
+func (s *Server) handleBlockTimes(w http.ResponseWriter, r *http.Request) {
+	if n, ok := chartParam(w, r, "blocks"); ok {
+		writeJSON(w, http.StatusOK, s.node.Snapshot().chain.BlockTimes(n))
+	}
+}
+
+// GET /charts/block-sizes?blocks=..
+func (s *Server) handleBlockSizes(w http.ResponseWriter, r *http.Request) {
+	if n, ok := chartParam(w, r, "blocks"); ok {
+		writeJSON(w, http.StatusOK, s.node.Snapshot().chain.BlockSizes(n))
+	}
+}
+
+// GET /charts/fees?blocks=..
+func (s *Server) handleFeeChart(w http.ResponseWriter, r *http.Request) {
+	if n, ok := chartParam(w, r, "blocks"); ok {
+		writeJSON(w, http.StatusOK, s.node.Snapshot().chain.FeeChart(n))
+	}
+}
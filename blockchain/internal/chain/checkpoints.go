@@ -0,0 +1,131 @@
+/*
+ * Trusted checkpoints.
+ * A checkpoint pins the hash of the Block at a height, eg. as published
+ * by whoever runs a classroom chain. Blocks up to the last checkpoint are
+ * appended without checking their Proof Of Work: their hashes are still
+ * recomputed and must link up to the checkpoint, which already vouches for
+ * the work, so importing or syncing a long chain mined at a high
+ * difficulty only checks the work of the Blocks past it. The transactions
+ * are validated as usual, the state being built from them.
+ *
+ * A Block at a checkpoint height with another hash is refused, by full
+ * nodes and light clients alike, and so is a reorganization forking below
+ * the last checkpoint.
+ *
+ *	GET /checkpoint?height=..  checkpoint of our Block at a height, the last
+ *	                           Block by default
+ */
+package chain
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Checkpoint struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// Pinned hashes by height
+type checkpoints map[int]string
+
+// Parse comma separated checkpoints written HEIGHT:HASH
+func ParseCheckpoints(s string) ([]Checkpoint, error) {
+	cps := []Checkpoint{}
+	for item := range strings.SplitSeq(s, ",") {
+		height, hash, ok := strings.Cut(strings.TrimSpace(item), ":")
+		h, err := strconv.Atoi(height)
+		if !ok || err != nil || hash == "" {
+			return nil, fmt.Errorf("checkpoint %q is not HEIGHT:HASH", item)
+		}
+		cps = append(cps, Checkpoint{h, hash})
+	}
+	return cps, nil
+}
+
+// Pinned hashes of cps, refusing genesis and conflicting checkpoints
+func newCheckpoints(cps []Checkpoint) (checkpoints, error) {
+	pinned := checkpoints{}
+	for _, c := range cps {
+		if c.Height <= 0 {
+			return nil, fmt.Errorf("checkpoint at height %v, genesis is pinned by its spec", c.Height)
+		}
+		if hash, ok := pinned[c.Height]; ok && hash != c.Hash {
+			return nil, fmt.Errorf("%w: %v and %v both pinned at height %v", ErrCheckpoint, hash, c.Hash, c.Height)
+		}
+		pinned[c.Height] = c.Hash
+	}
+	return pinned, nil
+}
+
+// Height of the last checkpoint, 0 without any
+func (cps checkpoints) last() int {
+	if len(cps) == 0 {
+		return 0
+	}
+	return slices.Max(slices.Collect(maps.Keys(cps)))
+}
+
+// Check the Block at height has the hash pinned there, if any
+func (cps checkpoints) check(height int, hash string) error {
+	if pinned, ok := cps[height]; ok && pinned != hash {
+		return fmt.Errorf("%w: block %v at height %v, pinned %v", ErrCheckpoint, hash, height, pinned)
+	}
+	return nil
+}
+
+/*
+ * Trust the Blocks up to the last of cps, see Checkpoint
+ * Fails with ErrCheckpoint if the chain already holds another Block at the
+ * height of one of them
+ */
+func (bc *BlockChain) SetCheckpoints(cps []Checkpoint) error {
+	pinned, err := newCheckpoints(cps)
+	if err != nil {
+		return err
+	}
+	for height := range pinned {
+		if height < bc.blocks.Len() {
+			if err := pinned.check(height, bc.blockAt(height).hash); err != nil {
+				return err
+			}
+		}
+	}
+	bc.checkpoints = pinned
+	return nil
+}
+
+// Trust the headers up to the last of cps, see Checkpoint
+func (lc *LightClient) SetCheckpoints(cps []Checkpoint) error {
+	pinned, err := newCheckpoints(cps)
+	if err != nil {
+		return err
+	}
+	lc.checkpoints = pinned
+	return nil
+}
+
+func (s *Server) handleCheckpoint(w http.ResponseWriter, r *http.Request) {
+	var cp Checkpoint
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		cp.Height = bc.blocks.Len() - 1
+		if param := r.URL.Query().Get("height"); param != "" {
+			if cp.Height, err = strconv.Atoi(param); err != nil || cp.Height < 0 || cp.Height >= bc.blocks.Len() {
+				err = fmt.Errorf("%w: %q", ErrUnknownHeight, param)
+				return
+			}
+		}
+		cp.Hash = bc.blockAt(cp.Height).hash
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cp)
+}
@@ -0,0 +1,105 @@
+/*
+ * Deterministic mode.
+ * Blocks carry the time they were mined at, so a chain built twice from
+ * the same transactions ends up with other hashes, unless the BlockChain
+ * reads the time from a Clock that is set in advance. The Proof Of Work
+ * tries nonces in turn from a start picked by a NonceStrategy: the
+ * default starts at 0, which is reproducible already; a seeded strategy
+ * starts elsewhere yet the same for the same seed and Header, eg. so
+ * simulated miners on the same Blocks do not find the same nonces.
+ * With a StepClock and either strategy, tests and the demo of
+ * -deterministic produce the same Blocks and hashes on every run.
+ */
+package chain
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+// Clock reading the system time
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Clock starting at a given time and moving by step at each reading
+type StepClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func NewStepClock(start time.Time, step time.Duration) *StepClock {
+	return &StepClock{now: start, step: step}
+}
+
+func (c *StepClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// Move the clock forward by d, eg. to let a timeout expire
+func (c *StepClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type NonceStrategy interface {
+	// First nonce tried when mining a Block of Header h
+	Start(h Header) int
+}
+
+// Nonces tried from 0, the default
+type SequentialNonces struct{}
+
+func (SequentialNonces) Start(Header) int {
+	return 0
+}
+
+// Nonces tried from a start drawn from seed and the Header
+type SeededNonces uint64
+
+func (s SeededNonces) Start(h Header) int {
+	digest := []byte(SHA256(h.fixedBytes()))
+	rng := rand.New(rand.NewPCG(uint64(s), binary.BigEndian.Uint64(digest)))
+	return rng.IntN(1 << 31)
+}
+
+// Read the time of new Blocks, and of receipts and snapshots, from clock
+func (bc *BlockChain) SetClock(clock Clock) {
+	bc.clock = clock
+}
+
+// Pick the first nonce tried when mining new Blocks with nonces
+func (bc *BlockChain) SetNonceStrategy(nonces NonceStrategy) {
+	bc.nonces = nonces
+}
+
+func (bc *BlockChain) now() time.Time {
+	if bc.clock == nil {
+		return time.Now()
+	}
+	return bc.clock.Now()
+}
+
+// Mine b at the difficulty of the chain from the nonce of the strategy, within the hash limit
+func (bc *BlockChain) mine(b *Block) {
+	if bc.nonces != nil {
+		b.nonce = bc.nonces.Start(b.Header)
+	}
+	start := b.nonce
+	b.mineLimited(bc.difficulty, bc.genesis.Pow, newHashLimiter(bc.hashLimit))
+	bc.recordAttempts(b.hash, b.nonce-start+1)
+}
@@ -0,0 +1,61 @@
+package chain
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// Hashes of n empty Blocks mined on a chain of TestGenesis reading the time from a StepClock
+func stepClockHashes(t *testing.T, n int, nonces NonceStrategy) []string {
+	t.Helper()
+	genesis := TestGenesis(2)
+	bc := CreateBlockChain(genesis)
+	bc.SetClock(NewStepClock(time.UnixMicro(genesis.UnixTs).Add(time.Second), time.Second))
+	bc.SetNonceStrategy(nonces)
+	hashes := []string{}
+	for range n {
+		if err := bc.CommitEmptyBlock(); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, bc.lastBlock().hash)
+	}
+	return hashes
+}
+
+func TestStepClock(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	c := NewStepClock(start, time.Second)
+	if now := c.Now(); !now.Equal(start) {
+		t.Fatalf("first reading %v, expected %v", now, start)
+	}
+	if now := c.Now(); !now.Equal(start.Add(time.Second)) {
+		t.Fatalf("second reading %v, expected %v", now, start.Add(time.Second))
+	}
+	c.Advance(time.Minute)
+	if now := c.Now(); !now.Equal(start.Add(time.Minute + 2*time.Second)) {
+		t.Fatalf("reading after advancing %v, expected %v", now, start.Add(time.Minute+2*time.Second))
+	}
+}
+
+func TestDeterministicChain(t *testing.T) {
+	for _, nonces := range []NonceStrategy{SequentialNonces{}, SeededNonces(7)} {
+		first, second := stepClockHashes(t, 5, nonces), stepClockHashes(t, 5, nonces)
+		if !slices.Equal(first, second) {
+			t.Errorf("%T: hashes %v, then %v", nonces, first, second)
+		}
+	}
+}
+
+func TestSeededNonces(t *testing.T) {
+	h := Header{prevHash: SHA256([]byte("parent")), miner: "miner", unixTs: 1}
+	if SeededNonces(1).Start(h) != SeededNonces(1).Start(h) {
+		t.Fatal("same seed and header start at other nonces")
+	}
+	if SeededNonces(1).Start(h) == SeededNonces(2).Start(h) {
+		t.Fatal("seeds 1 and 2 start at the same nonce")
+	}
+	if (SequentialNonces{}).Start(h) != 0 {
+		t.Fatal("sequential nonces do not start at 0")
+	}
+}
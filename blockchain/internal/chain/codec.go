@@ -0,0 +1,476 @@
+/*
+ * Binary encoding of Blocks and transactions.
+ * JSON spells out every field name of every transaction and base64s every
+ * key and signature, which weighs on cold storage and on syncing long
+ * chains. Cold storage, GET /bodies and the relay between peers use a
+ * binary encoding instead: a version byte followed by protobuf messages,
+ * the BinaryBlock, BinaryBlocks and BinaryTransaction of toychain.proto,
+ * encoded by hand like the gRPC messages of grpc.go.
+ *
+ * Protobuf skips the fields it does not know and leaves the missing ones
+ * zero, so transactions growing new parts take new field numbers and the
+ * Blocks written before keep decoding. A change the field numbers cannot
+ * absorb gets a new version byte, and decoders keep reading the older
+ * versions. Decoders tell the encodings apart by their first byte, a
+ * version never being '{' or '[', so Blocks stored as JSON before stay
+ * readable.
+ *
+ * Peers ask for the binary encoding with an Accept header of
+ * BINARY_CONTENT_TYPE and send it with that Content-Type; peers that do
+ * not ask get JSON. Exports and the rest of the API stay in JSON, and the
+ * size limit of Blocks still counts JSON bytes, see blocksize.go.
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Media type of the binary encoding
+const BINARY_CONTENT_TYPE = "application/x-toychain-binary"
+
+// Versions of the binary encoding, the last one being written
+const (
+	BINARY_V1      byte = 1 // protobuf messages of toychain.proto, amounts being doubles of coins
+	BINARY_V2      byte = 2 // amounts being int64 base units, see amount.go
+	BINARY_VERSION      = BINARY_V2
+)
+
+// Largest binary body read from a request
+const MAX_BINARY_BODY = 4 << 20
+
+// Write the key and value of each entry of m, sorted by key, as field messages
+func (w *protoWriter) entries(field int, m map[string][]byte) {
+	for _, key := range sortedKeys(m) {
+		entry := &protoWriter{}
+		entry.string(1, key)
+		entry.bytes(2, m[key])
+		w.message(field, entry)
+	}
+}
+
+func (m protoMessage) entries(field int) (map[string][]byte, error) {
+	entries, err := m.messages(field)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][]byte{}
+	for _, e := range entries {
+		values[e.string(1)] = e.last(2).bytes
+	}
+	return values, nil
+}
+
+func (m protoMessage) strings(field int) []string {
+	var values []string
+	for _, v := range m[field] {
+		values = append(values, string(v.bytes))
+	}
+	return values
+}
+
+func (m protoMessage) bytesList(field int) [][]byte {
+	var values [][]byte
+	for _, v := range m[field] {
+		values = append(values, v.bytes)
+	}
+	return values
+}
+
+// The only message of field, and whether there is one
+func (m protoMessage) sub(field int) (protoMessage, bool, error) {
+	if !m.has(field) {
+		return nil, false, nil
+	}
+	sub, err := parseProto(m.last(field).bytes)
+	return sub, err == nil, err
+}
+
+// BinaryTransaction message, see toychain.proto
+func (txn Transaction) toBinary() *protoWriter {
+	j := txn.toJSON()
+	w := &protoWriter{}
+	w.uint(1, uint64(j.Kind))
+	w.string(2, j.Payer)
+	w.string(3, j.Payee)
+	w.string(4, j.Asset)
+	w.amount(5, j.Amt)
+	w.amount(6, j.Fee)
+	w.uint(7, j.Nonce)
+	w.uint(8, j.GasLimit)
+	w.amount(9, j.GasPrice)
+	for _, p := range j.Payouts {
+		payout := &protoWriter{}
+		payout.string(1, p.Payee)
+		payout.amount(2, p.Amt)
+		w.message(10, payout)
+	}
+	if s := j.Swap; s != nil {
+		swap := &protoWriter{}
+		for _, leg := range s.Legs {
+			l := &protoWriter{}
+			l.string(1, leg.From)
+			l.string(2, leg.To)
+			l.string(3, leg.Asset)
+			l.amount(4, leg.Amt)
+			swap.message(1, l)
+		}
+		swap.entries(2, s.Keys)
+		swap.entries(3, s.Sigs)
+		swap.bytes(4, s.AggSig)
+		w.message(11, swap)
+	}
+	if o := j.Order; o != nil {
+		order := &protoWriter{}
+		order.string(1, o.ID)
+		order.uint(2, uint64(o.Side))
+		order.string(3, o.Base)
+		order.string(4, o.Quote)
+		order.amount(5, o.Price)
+		order.amount(6, o.Amount)
+		w.message(12, order)
+	}
+	if kv := j.KV; kv != nil {
+		write := &protoWriter{}
+		write.string(1, kv.Namespace)
+		write.string(2, kv.Key)
+		write.bytes(3, kv.Value)
+		w.message(13, write)
+	}
+	if u := j.UTXO; u != nil {
+		utxo := &protoWriter{}
+		for _, id := range u.Inputs {
+			utxo.string(1, id)
+		}
+		for _, o := range u.Outputs {
+			output := &protoWriter{}
+			output.string(1, o.Owner)
+			output.amount(2, o.Amt)
+			utxo.message(2, output)
+		}
+		utxo.entries(3, u.Keys)
+		utxo.entries(4, u.Sigs)
+		utxo.bytes(5, u.AggSig)
+		w.message(14, utxo)
+	}
+	if m := j.Multisig; m != nil {
+		multisig := &protoWriter{}
+		for _, key := range m.Keys {
+			multisig.bytes(1, key)
+		}
+		multisig.uint(2, uint64(m.Threshold))
+		w.message(15, multisig)
+	}
+	for _, sig := range j.CoSigs {
+		w.bytes(16, sig)
+	}
+	w.string(17, j.Script)
+	for _, witness := range j.Witness {
+		w.bytes(18, witness)
+	}
+	for _, key := range j.AccessList {
+		w.string(19, key)
+	}
+	w.bytes(20, j.Data)
+	if m := j.Message; m != nil {
+		message := &protoWriter{}
+		message.bytes(1, m.Ephemeral)
+		message.bytes(2, m.Sealed)
+		w.message(21, message)
+	}
+	w.string(22, j.FeeAsset)
+	w.uint(23, uint64(j.Scheme))
+	w.string(24, j.ChainID)
+	if r := j.Record; r != nil {
+		record := &protoWriter{}
+		record.string(1, r.Schema)
+		record.bytes(2, r.Payload)
+		w.message(25, record)
+	}
+	if t := j.Token; t != nil {
+		token := &protoWriter{}
+		token.string(1, t.Name)
+		token.uint(2, uint64(t.Decimals))
+		w.message(26, token)
+	}
+	w.uint(27, uint64(j.LockHeight))
+	w.uint(28, uint64(j.LockTime))
+	return w
+}
+
+func binaryTransaction(m protoMessage) (Transaction, error) {
+	j := jsonTxn{
+		Kind:     TxnKind(m.uint(1)),
+		Payer:    m.string(2),
+		Payee:    m.string(3),
+		Asset:    m.string(4),
+		Amt:      m.amount(5),
+		Fee:      m.amount(6),
+		Nonce:    m.uint(7),
+		GasLimit: m.uint(8),
+		GasPrice: m.amount(9),
+		CoSigs:   m.bytesList(16),
+		Script:   m.string(17),
+		Witness:  m.bytesList(18),
+		Data:     m.last(20).bytes,
+		FeeAsset: m.string(22),
+		Scheme:   SigScheme(m.uint(23)),
+		ChainID:  m.string(24),
+
+		LockHeight: int(m.uint(27)),
+		LockTime:   int64(m.uint(28)),
+
+		AccessList: m.strings(19),
+	}
+	payouts, err := m.messages(10)
+	if err != nil {
+		return Transaction{}, err
+	}
+	for _, p := range payouts {
+		j.Payouts = append(j.Payouts, jsonPayout{p.string(1), p.amount(2)})
+	}
+	if swap, ok, err := m.sub(11); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.Swap = &jsonSwap{}
+		legs, err := swap.messages(1)
+		if err != nil {
+			return Transaction{}, err
+		}
+		for _, l := range legs {
+			j.Swap.Legs = append(j.Swap.Legs, jsonSwapLeg{l.string(1), l.string(2), l.string(3), l.amount(4)})
+		}
+		if j.Swap.Keys, err = swap.entries(2); err != nil {
+			return Transaction{}, err
+		}
+		if j.Swap.Sigs, err = swap.entries(3); err != nil {
+			return Transaction{}, err
+		}
+		j.Swap.AggSig = swap.last(4).bytes
+	}
+	if o, ok, err := m.sub(12); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.Order = &jsonOrder{o.string(1), OrderSide(o.uint(2)), o.string(3), o.string(4), o.amount(5), o.amount(6)}
+	}
+	if kv, ok, err := m.sub(13); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.KV = &jsonKV{kv.string(1), kv.string(2), kv.last(3).bytes}
+	}
+	if u, ok, err := m.sub(14); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.UTXO = &jsonUTXO{Inputs: u.strings(1)}
+		outputs, err := u.messages(2)
+		if err != nil {
+			return Transaction{}, err
+		}
+		for _, o := range outputs {
+			j.UTXO.Outputs = append(j.UTXO.Outputs, jsonUTXOOutput{o.string(1), o.amount(2)})
+		}
+		if j.UTXO.Keys, err = u.entries(3); err != nil {
+			return Transaction{}, err
+		}
+		if j.UTXO.Sigs, err = u.entries(4); err != nil {
+			return Transaction{}, err
+		}
+		j.UTXO.AggSig = u.last(5).bytes
+	}
+	if ms, ok, err := m.sub(15); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.Multisig = &jsonMultisig{ms.bytesList(1), int(ms.uint(2))}
+	}
+	if msg, ok, err := m.sub(21); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.Message = &jsonMessage{msg.last(1).bytes, msg.last(2).bytes}
+	}
+	if r, ok, err := m.sub(25); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.Record = &jsonRecord{r.string(1), r.last(2).bytes}
+	}
+	if t, ok, err := m.sub(26); err != nil {
+		return Transaction{}, err
+	} else if ok {
+		j.Token = &jsonToken{t.string(1), int(t.uint(2))}
+	}
+	return j.transaction(), nil
+}
+
+// BinaryBlock message, see toychain.proto
+func (b Block) toBinary() *protoWriter {
+	w := &protoWriter{}
+	w.string(1, b.hash)
+	w.string(2, b.prevHash)
+	w.string(3, b.merkleRoot)
+	w.string(4, b.miner)
+	w.uint(5, uint64(b.unixTs))
+	w.uint(6, uint64(b.difficulty))
+	w.uint(7, uint64(b.retarget))
+	w.uint(8, uint64(b.nonce))
+	for _, txn := range b.data {
+		w.message(9, txn.toBinary())
+	}
+	w.string(10, b.stateRoot)
+	w.bytes(11, b.bloom)
+	w.uint(12, uint64(b.version))
+	return w
+}
+
+func binaryBlock(m protoMessage) (Block, error) {
+	b := Block{
+		Header: Header{
+			prevHash:   m.string(2),
+			merkleRoot: m.string(3),
+			miner:      m.string(4),
+			unixTs:     m.int(5),
+			difficulty: int(m.int(6)),
+			retarget:   int(m.int(7)),
+			stateRoot:  m.string(10),
+			bloom:      m.last(11).bytes,
+			version:    int(m.int(12)),
+			nonce:      int(m.int(8)),
+		},
+		hash: m.string(1),
+	}
+	txns, err := m.messages(9)
+	if err != nil {
+		return Block{}, err
+	}
+	for _, t := range txns {
+		txn, err := binaryTransaction(t)
+		if err != nil {
+			return Block{}, err
+		}
+		b.data = append(b.data, txn)
+	}
+	return b, nil
+}
+
+// Whether raw is JSON rather than binary
+func isJSON(raw []byte) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return len(raw) > 0 && (raw[0] == '{' || raw[0] == '[')
+}
+
+func encodeBinary(m *protoWriter) []byte {
+	return append([]byte{BINARY_VERSION}, m.buf...)
+}
+
+// Message of the binary encoding raw, of a version this node reads
+func decodeBinary(raw []byte) (protoMessage, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("empty encoding")
+	}
+	switch raw[0] {
+	case BINARY_V1, BINARY_V2:
+		// Amounts tell the versions apart by their wire type, see protoMessage.amount
+		return parseProto(raw[1:])
+	}
+	return nil, fmt.Errorf("unknown encoding version %v", raw[0])
+}
+
+func EncodeBlock(b Block) []byte {
+	return encodeBinary(b.toBinary())
+}
+
+// Block of the binary encoding or JSON raw
+func DecodeBlock(raw []byte) (Block, error) {
+	if isJSON(raw) {
+		var j jsonBlock
+		err := json.Unmarshal(raw, &j)
+		return j.block(), err
+	}
+	m, err := decodeBinary(raw)
+	if err != nil {
+		return Block{}, err
+	}
+	return binaryBlock(m)
+}
+
+// BinaryBlocks message of blocks
+func EncodeBlocks(blocks []Block) []byte {
+	w := &protoWriter{}
+	for _, b := range blocks {
+		w.message(1, b.toBinary())
+	}
+	return encodeBinary(w)
+}
+
+// Blocks of the binary encoding or JSON array raw
+func DecodeBlocks(raw []byte) ([]Block, error) {
+	blocks := []Block{}
+	if isJSON(raw) {
+		var views []jsonBlock
+		if err := json.Unmarshal(raw, &views); err != nil {
+			return nil, err
+		}
+		for _, j := range views {
+			blocks = append(blocks, j.block())
+		}
+		return blocks, nil
+	}
+	m, err := decodeBinary(raw)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := m.messages(1)
+	if err != nil {
+		return nil, err
+	}
+	for _, bm := range messages {
+		b, err := binaryBlock(bm)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func EncodeTxn(txn Transaction) []byte {
+	return encodeBinary(txn.toBinary())
+}
+
+// Transaction of the binary encoding or JSON raw
+func DecodeTxn(raw []byte) (Transaction, error) {
+	if isJSON(raw) {
+		var j jsonTxn
+		err := json.Unmarshal(raw, &j)
+		return j.transaction(), err
+	}
+	m, err := decodeBinary(raw)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return binaryTransaction(m)
+}
+
+// Whether the client of r asks for the binary encoding
+func wantsBinary(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), BINARY_CONTENT_TYPE)
+}
+
+func writeBinary(w http.ResponseWriter, status int, raw []byte) {
+	w.Header().Set("Content-Type", BINARY_CONTENT_TYPE)
+	w.WriteHeader(status)
+	w.Write(raw)
+}
+
+// Transaction of the body of r, JSON or binary
+func readTxn(r *http.Request) (Transaction, error) {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, MAX_BINARY_BODY))
+	if err != nil {
+		return Transaction{}, err
+	}
+	return DecodeTxn(raw)
+}
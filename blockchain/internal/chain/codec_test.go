@@ -0,0 +1,72 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// Encoded Blocks and transactions of a test chain, binary and JSON
+func codecSeeds(f *testing.F, encode func(Block) [][]byte) {
+	tc := NewTestChain(1, TestGenesis(4))
+	if err := tc.Extend(2); err != nil {
+		f.Fatal(err)
+	}
+	for _, b := range tc.Blocks() {
+		for _, raw := range encode(b) {
+			f.Add(raw)
+		}
+	}
+}
+
+func FuzzDecodeBlock(f *testing.F) {
+	codecSeeds(f, func(b Block) [][]byte {
+		j, err := json.Marshal(b.toJSON())
+		if err != nil {
+			f.Fatal(err)
+		}
+		return [][]byte{EncodeBlock(b), j}
+	})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		b, err := DecodeBlock(raw)
+		if err != nil {
+			return
+		}
+		encoded := EncodeBlock(b)
+		again, err := DecodeBlock(encoded)
+		if err != nil {
+			t.Fatalf("re-encoded block does not decode: %v", err)
+		}
+		if !bytes.Equal(EncodeBlock(again), encoded) {
+			t.Fatalf("block %x does not round trip", raw)
+		}
+	})
+}
+
+func FuzzDecodeTxn(f *testing.F) {
+	codecSeeds(f, func(b Block) [][]byte {
+		seeds := [][]byte{}
+		for _, txn := range b.data {
+			j, err := json.Marshal(txn.toJSON())
+			if err != nil {
+				f.Fatal(err)
+			}
+			seeds = append(seeds, EncodeTxn(txn), j)
+		}
+		return seeds
+	})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		txn, err := DecodeTxn(raw)
+		if err != nil {
+			return
+		}
+		encoded := EncodeTxn(txn)
+		again, err := DecodeTxn(encoded)
+		if err != nil {
+			t.Fatalf("re-encoded transaction does not decode: %v", err)
+		}
+		if !bytes.Equal(EncodeTxn(again), encoded) {
+			t.Fatalf("transaction %x does not round trip", raw)
+		}
+	})
+}
@@ -0,0 +1,261 @@
+/*
+ * Coin control.
+ * A Wallet spends its largest unspent outputs first, see PayUTXO, at the
+ * next free nonce. Advanced users pick them by hand instead: the outputs a
+ * payment spends, eg. to keep coins of different origins apart, and the
+ * nonce slot it takes, eg. to replace a pending transaction. Outputs they
+ * freeze are never spent, neither picked automatically nor by hand, until
+ * thawed, and any output may carry a label saying where its coins came
+ * from. Frozen outputs and labels only live in the wallet: they are kept
+ * in the keystore, one JSON file per account under coins/, and the chain
+ * knows nothing of them.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Frozen outputs and labels of the outputs of an account
+type CoinControl struct {
+	path   string
+	frozen map[string]bool
+	labels map[string]string
+}
+
+type coinsFile struct {
+	Frozen []string          `json:"frozen"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Unspent output with its label, and whether it is frozen
+type Coin struct {
+	UTXO
+	Label  string `json:"label,omitempty"`
+	Frozen bool   `json:"frozen,omitempty"`
+}
+
+// Coin control of account, empty if nothing was frozen or labelled yet
+func (ks *Keystore) CoinControl(account string) (*CoinControl, error) {
+	path, err := ks.path(account)
+	if err != nil {
+		return nil, err
+	}
+	cc := &CoinControl{
+		path:   filepath.Join(filepath.Dir(path), "coins", filepath.Base(path)),
+		frozen: map[string]bool{},
+		labels: map[string]string{},
+	}
+	data, err := os.ReadFile(cc.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f coinsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%v: %w", cc.path, err)
+	}
+	for _, id := range f.Frozen {
+		cc.frozen[id] = true
+	}
+	for id, label := range f.Labels {
+		cc.labels[id] = label
+	}
+	return cc, nil
+}
+
+// Keep the output id from being spent until thawed
+func (cc *CoinControl) Freeze(id string) {
+	cc.frozen[id] = true
+}
+
+func (cc *CoinControl) Thaw(id string) {
+	delete(cc.frozen, id)
+}
+
+// Label the output id, an empty label removing it
+func (cc *CoinControl) SetLabel(id, label string) {
+	if label == "" {
+		delete(cc.labels, id)
+		return
+	}
+	cc.labels[id] = label
+}
+
+func (cc *CoinControl) Save() error {
+	f := coinsFile{Frozen: sortedKeys(cc.frozen), Labels: cc.labels}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cc.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(cc.path, data, 0o600)
+}
+
+// Outputs of unspent with their labels and frozen flags
+func (cc *CoinControl) Coins(unspent []UTXO) []Coin {
+	coins := make([]Coin, len(unspent))
+	for i, u := range unspent {
+		coins[i] = Coin{u, cc.labels[u.ID], cc.frozen[u.ID]}
+	}
+	return coins
+}
+
+/*
+ * Outputs of unspent a payment may spend: those picked, in inputs, or all
+ * the ones not frozen if none is
+ * Fails with ErrFrozenOutput if a picked output is frozen
+ */
+func (cc *CoinControl) Select(unspent []UTXO, inputs []string) ([]UTXO, error) {
+	selected := []UTXO{}
+	for _, u := range unspent {
+		picked := slices.Contains(inputs, u.ID)
+		if picked && cc.frozen[u.ID] {
+			return nil, fmt.Errorf("%w: %v", ErrFrozenOutput, u.ID)
+		}
+		if picked || (len(inputs) == 0 && !cc.frozen[u.ID]) {
+			selected = append(selected, u)
+		}
+	}
+	return selected, nil
+}
+
+// What -coins does besides listing the outputs, see runCoins
+type coinsCommand struct {
+	freeze, thaw []string
+	labels       map[string]string // label of each output
+	payTo        string            // pay the UTXO owner payTo amt
+	amt          Amount
+	inputs       []string // outputs to spend, picked by coin control if empty
+	nonce        int      // nonce slot of the payment, the next free one if negative
+	signer       string   // URL of the signer process signing the payment, the keystore if empty
+	signerToken  string
+}
+
+// Signer of the payments of account on the chain of ID chainID, see signer.go
+func (cmd coinsCommand) signerOf(ks *Keystore, account, chainID string) (Signer, error) {
+	if cmd.signer != "" {
+		remote, err := NewRemoteSigner(cmd.signer, cmd.signerToken)
+		if err != nil {
+			return nil, err
+		}
+		if remote.Account() != account {
+			return nil, fmt.Errorf("signer at %v holds the key of %v, not %v", cmd.signer, remote.Account(), account)
+		}
+		return remote, remote.SetChainID(chainID)
+	}
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	w, err := ks.Unlock(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	w.SetChainID(chainID)
+	return w, nil
+}
+
+/*
+ * Freeze, thaw and label outputs of account, then list its unspent outputs
+ * on bc or print a payment signed with the key of account, returning the
+ * exit code
+ */
+func runCoins(bc *BlockChain, dir, account string, cmd coinsCommand, out *Output) int {
+	ks, err := NewKeystore(dir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	cc, err := ks.CoinControl(account)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	for _, id := range cmd.freeze {
+		cc.Freeze(id)
+	}
+	for _, id := range cmd.thaw {
+		cc.Thaw(id)
+	}
+	for id, label := range cmd.labels {
+		cc.SetLabel(id, label)
+	}
+	if len(cmd.freeze)+len(cmd.thaw)+len(cmd.labels) > 0 {
+		if err := cc.Save(); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+	unspent := bc.UTXOs(account)
+	if cmd.payTo == "" {
+		coins := cc.Coins(unspent)
+		rows := make([][]string, len(coins))
+		for i, c := range coins {
+			frozen := ""
+			if c.Frozen {
+				frozen = "frozen"
+			}
+			rows[i] = []string{c.ID, fmt.Sprint(c.Amt), frozen, c.Label}
+		}
+		if err := out.Table([]string{"output", "amount", "frozen", "label"}, rows, coins); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	selected, err := cc.Select(unspent, cmd.inputs)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	payTo, err := bc.ResolveAccount(cmd.payTo)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	nonce := max(bc.state.nonce(account), bc.mempool.Counts(account).NextNonce)
+	if cmd.nonce >= 0 {
+		nonce = uint64(cmd.nonce)
+	}
+	signer, err := cmd.signerOf(ks, account, bc.ChainID())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	var txn Transaction
+	if len(cmd.inputs) > 0 {
+		txn, err = PayUTXOFrom(signer, selected, cmd.inputs, payTo, cmd.amt, nonce)
+	} else {
+		txn, err = PayUTXO(signer, selected, payTo, cmd.amt, nonce)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	out.Note("POST the -output json form of the transaction to /txns of a node to submit it")
+	err = out.Record([][2]string{
+		{"hash", txn.Hash()},
+		{"nonce", fmt.Sprint(txn.nonce)},
+		{"inputs", strings.Join(txn.utxo.inputs, " ")},
+		{"outputs", txn.utxo.String()},
+	}, txn.toJSON())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
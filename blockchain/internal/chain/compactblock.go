@@ -0,0 +1,462 @@
+/*
+ * Compact Block relay.
+ * Besides transactions, a Node with relay peers, see relay.go, pushes each
+ * Block it commits, mined or received, to its peers, which push it on in
+ * turn. The peers hold most of its transactions already, relayed to them
+ * before it was mined, so sending the Block whole mostly repeats what they
+ * have. A compact Block is its header with the short ID of each of its
+ * transactions instead, the first SHORT_ID_BYTES bytes of its hash:
+ *
+ *	1. the sender POSTs the compact Block
+ *	2. the peer rebuilds it from its Mempool, and appends it if it holds
+ *	   every transaction, or keeps it aside and replies with the positions
+ *	   of those it lacks
+ *	3. the sender POSTs those transactions alone
+ *	4. if the peer still cannot rebuild it, eg. two of its transactions
+ *	   share a short ID, the Block rebuilt does not match the merkle root
+ *	   of its header or the peer dropped it meanwhile, the sender POSTs the
+ *	   Block whole
+ *
+ * A peer knowing the Block already replies known, and one whose last Block
+ * is not its parent replies unconnected, catching up by syncing, see
+ * sync.go. RelayConfig.Blocks sends Blocks whole from the start, or
+ * not at all. The Node counts the bytes it sent relaying Blocks against
+ * those the Blocks whole would have taken; -block-relay-sim compares both
+ * ways on a TestNet, see testnet.go.
+ *
+ *	POST /relay/block      a Block, compact or whole
+ *	POST /relay/blocktxns  transactions of a compact Block, by position
+ *	GET  /relay/blocks     bytes and requests spent relaying Blocks
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Bytes of the hash of a transaction standing for it in a compact Block
+const SHORT_ID_BYTES = 6
+
+// Compact Blocks a node keeps aside waiting for their missing transactions
+const MAX_PARTIAL_BLOCKS = 64
+
+// Ways of relaying Blocks
+const (
+	BLOCK_RELAY_COMPACT = "compact" // the default
+	BLOCK_RELAY_FULL    = "full"
+	BLOCK_RELAY_OFF     = "off"
+)
+
+// Replies to a relayed Block
+const (
+	BLOCK_ACCEPTED    = "accepted"    // appended
+	BLOCK_KNOWN       = "known"       // already on the chain
+	BLOCK_UNCONNECTED = "unconnected" // not extending the chain, left to sync
+	BLOCK_MISSING     = "missing"     // the transactions at Missing are wanted
+	BLOCK_WHOLE       = "whole"       // the Block is wanted whole
+)
+
+// Blocks relayed by each TestNet of -block-relay-sim
+const BLOCK_RELAY_SIM_BLOCKS = 10
+
+type jsonCompactBlock struct {
+	jsonHeader
+	ShortIDs  []string        `json:"shortIds,omitempty"`
+	Prefilled map[int]jsonTxn `json:"prefilled,omitempty"` // transactions sent along by position
+	Data      []jsonTxn       `json:"data,omitempty"`      // of a Block sent whole
+}
+
+// Transactions of a compact Block the receiver lacked
+type jsonBlockTxns struct {
+	Hash string          `json:"hash"`
+	Txns map[int]jsonTxn `json:"txns"` // by position
+}
+
+type jsonBlockReply struct {
+	Status  string `json:"status"`
+	Missing []int  `json:"missing,omitempty"` // positions of the transactions wanted
+}
+
+type BlockRelayStats struct {
+	Blocks     int `json:"blocks"`     // offered to a peer, once per peer
+	Bytes      int `json:"bytes"`      // sent relaying them
+	WholeBytes int `json:"wholeBytes"` // the Blocks sent whole would have taken
+	Requests   int `json:"requests"`   // more than one per Block whose transactions a peer lacked
+	Fallbacks  int `json:"fallbacks"`  // Blocks sent whole after their compact form
+}
+
+func (s *BlockRelayStats) add(o BlockRelayStats) {
+	s.Blocks += o.Blocks
+	s.Bytes += o.Bytes
+	s.WholeBytes += o.WholeBytes
+	s.Requests += o.Requests
+	s.Fallbacks += o.Fallbacks
+}
+
+func shortID(hash string) string {
+	return hash[:min(len(hash), 2*SHORT_ID_BYTES)]
+}
+
+func compactBlock(b Block) jsonCompactBlock {
+	j := jsonCompactBlock{jsonHeader: b.Header.toJSON(b.hash)}
+	for _, txn := range b.data {
+		j.ShortIDs = append(j.ShortIDs, shortID(txn.Hash()))
+	}
+	return j
+}
+
+/*
+ * Block of j, the transactions of a compact one found in held unless sent
+ * along, and the positions of those missing, a short ID matching two held
+ * transactions matching none
+ */
+func (j jsonCompactBlock) rebuild(held []Transaction) (Block, []int) {
+	if j.Data != nil {
+		return jsonBlock{j.jsonHeader, j.Data}.block(), nil
+	}
+	byID := map[string]*Transaction{}
+	for i := range held {
+		id := shortID(held[i].Hash())
+		if _, ok := byID[id]; ok {
+			byID[id] = nil
+		} else {
+			byID[id] = &held[i]
+		}
+	}
+	b := Block{Header: j.header(), hash: j.Hash, data: make([]Transaction, len(j.ShortIDs))}
+	missing := []int{}
+	for i, id := range j.ShortIDs {
+		if txn, ok := j.Prefilled[i]; ok {
+			b.data[i] = txn.transaction()
+		} else if txn := byID[id]; txn != nil {
+			b.data[i] = *txn
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	return b, missing
+}
+
+/*
+ * Push the Blocks the Node commits to the peers of r from now on, r
+ * replacing the relay of the Node, if any
+ * Called with n.mu held
+ */
+func (n *Node) setRelay(r *relay) {
+	if n.relay != nil && n.relay.stopBlocks != nil {
+		n.relay.stopBlocks()
+	}
+	n.relay = r
+	if r.config.Blocks == BLOCK_RELAY_OFF {
+		return
+	}
+	events, cancel := n.events.Subscribe(NewBlock)
+	r.stopBlocks = cancel
+	go func() {
+		for ev := range events {
+			for _, peer := range r.peerURLs() {
+				go func() {
+					if err := r.pushBlock(peer, *ev.Block); err != nil {
+						log.Printf("relay: block %v: %v", ev.Block.hash, err)
+					}
+				}()
+			}
+		}
+	}()
+}
+
+// Push b to peer, compact unless relaying Blocks whole, see above
+func (r *relay) pushBlock(peer string, b Block) error {
+	whole := b.toJSON()
+	raw, _ := json.Marshal(whole)
+	stats := BlockRelayStats{Blocks: 1, WholeBytes: len(raw)}
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.blockStats.add(stats)
+	}()
+	if r.config.Blocks == BLOCK_RELAY_FULL {
+		_, err := r.offerBlock(peer, "/relay/block", whole, &stats)
+		return err
+	}
+	reply, err := r.offerBlock(peer, "/relay/block", compactBlock(b), &stats)
+	if err == nil && reply.Status == BLOCK_MISSING {
+		missing := jsonBlockTxns{Hash: b.hash, Txns: map[int]jsonTxn{}}
+		for _, i := range reply.Missing {
+			if i >= 0 && i < len(b.data) {
+				missing.Txns[i] = b.data[i].toJSON()
+			}
+		}
+		reply, err = r.offerBlock(peer, "/relay/blocktxns", missing, &stats)
+	}
+	if err == nil && (reply.Status == BLOCK_MISSING || reply.Status == BLOCK_WHOLE) {
+		stats.Fallbacks++
+		_, err = r.offerBlock(peer, "/relay/block", whole, &stats)
+	}
+	return err
+}
+
+// POST v, a Block or its transactions, to path of peer, counting the request in stats
+func (r *relay) offerBlock(peer, path string, v any, stats *BlockRelayStats) (jsonBlockReply, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return jsonBlockReply{}, err
+	}
+	stats.Bytes += len(body)
+	stats.Requests++
+	resp, err := r.client.Post(peer+path, "application/json", bytes.NewReader(body))
+	r.seen(peer, err)
+	if err != nil {
+		return jsonBlockReply{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return jsonBlockReply{}, fmt.Errorf("POST %v%v: %v", peer, path, resp.Status)
+	}
+	var reply jsonBlockReply
+	return reply, json.NewDecoder(resp.Body).Decode(&reply)
+}
+
+/*
+ * Append the Block relayed as j if it extends the chain, see above for
+ * the replies
+ * Fails if the Block rebuilt, or sent whole, is invalid
+ */
+func (n *Node) acceptBlock(j jsonCompactBlock) (jsonBlockReply, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	bc := n.bc
+	if _, _, ok := bc.findBlock(j.Hash); ok {
+		return jsonBlockReply{Status: BLOCK_KNOWN}, nil
+	}
+	if j.PrevHash != bc.lastBlock().hash {
+		return jsonBlockReply{Status: BLOCK_UNCONNECTED}, nil
+	}
+	b, missing := j.rebuild(bc.mempool.held())
+	if len(missing) > 0 {
+		n.relay.keepPartial(j)
+		return jsonBlockReply{Status: BLOCK_MISSING, Missing: missing}, nil
+	}
+	if j.Data == nil && merkleRoot(b.data) != b.merkleRoot {
+		return jsonBlockReply{Status: BLOCK_WHOLE}, nil
+	}
+	if err := bc.appendBlock(b); err != nil {
+		return jsonBlockReply{}, err
+	}
+	bc.dropIncluded(b)
+	return jsonBlockReply{Status: BLOCK_ACCEPTED}, nil
+}
+
+// Complete the compact Block kept aside with txns, and accept it
+func (n *Node) acceptBlockTxns(txns jsonBlockTxns) (jsonBlockReply, error) {
+	j, ok := n.relayer().takePartial(txns.Hash)
+	if !ok {
+		return jsonBlockReply{Status: BLOCK_WHOLE}, nil
+	}
+	if j.Prefilled == nil {
+		j.Prefilled = map[int]jsonTxn{}
+	}
+	for i, txn := range txns.Txns {
+		j.Prefilled[i] = txn
+	}
+	reply, err := n.acceptBlock(j)
+	if reply.Status == BLOCK_MISSING {
+		// Not sent after all, the sender falls back to the Block whole
+		n.relayer().takePartial(txns.Hash)
+	}
+	return reply, err
+}
+
+// Keep the compact Block j aside until its missing transactions come, forgetting another one past MAX_PARTIAL_BLOCKS
+func (r *relay) keepPartial(j jsonCompactBlock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.partial == nil {
+		r.partial = map[string]jsonCompactBlock{}
+	}
+	if len(r.partial) >= MAX_PARTIAL_BLOCKS {
+		for hash := range r.partial {
+			delete(r.partial, hash)
+			break
+		}
+	}
+	r.partial[j.Hash] = j
+}
+
+func (r *relay) takePartial(hash string) (jsonCompactBlock, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.partial[hash]
+	delete(r.partial, hash)
+	return j, ok
+}
+
+// Bytes and requests spent relaying Blocks so far
+func (n *Node) BlockRelayStats() BlockRelayStats {
+	r := n.relayer()
+	if r == nil {
+		return BlockRelayStats{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.blockStats
+}
+
+// POST /relay/block
+func (s *Server) handleRelayBlock(w http.ResponseWriter, r *http.Request) {
+	var j jsonCompactBlock
+	if err := json.NewDecoder(io.LimitReader(r.Body, MAX_BINARY_BODY)).Decode(&j); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var reply jsonBlockReply
+	var err error
+	if s.node.IsReplica() || s.node.relayer() == nil {
+		err = ErrRelayDisabled
+	} else if s.node.relayer().config.RequireNoise && noisePeerKey(r.Context()) == nil {
+		err = ErrPlaintextPeer
+	} else {
+		reply, err = s.node.acceptBlock(j)
+	}
+	writeBlockReply(w, reply, err)
+}
+
+// POST /relay/blocktxns
+func (s *Server) handleRelayBlockTxns(w http.ResponseWriter, r *http.Request) {
+	var txns jsonBlockTxns
+	if err := json.NewDecoder(io.LimitReader(r.Body, MAX_BINARY_BODY)).Decode(&txns); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var reply jsonBlockReply
+	var err error
+	if s.node.IsReplica() || s.node.relayer() == nil {
+		err = ErrRelayDisabled
+	} else if s.node.relayer().config.RequireNoise && noisePeerKey(r.Context()) == nil {
+		err = ErrPlaintextPeer
+	} else {
+		reply, err = s.node.acceptBlockTxns(txns)
+	}
+	writeBlockReply(w, reply, err)
+}
+
+func writeBlockReply(w http.ResponseWriter, reply jsonBlockReply, err error) {
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	status := http.StatusOK
+	if reply.Status == BLOCK_ACCEPTED {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, reply)
+}
+
+// GET /relay/blocks
+func (s *Server) handleBlockRelayStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.node.BlockRelayStats())
+}
+
+type BlockRelaySimConfig struct {
+	Nodes    int
+	Coverage float64 // share of the transactions of a Block each node holds before it comes
+	Blocks   string  // BLOCK_RELAY_COMPACT or BLOCK_RELAY_FULL
+	Seed     uint64
+}
+
+/*
+ * Relay BLOCK_RELAY_SIM_BLOCKS Blocks of MAX_TXNS_PER_BLOCK transactions
+ * around a ring of TestNet nodes, each pushing to the next one, node 0
+ * mining them all, and return the stats of all nodes
+ */
+func SimulateBlockRelay(cfg BlockRelaySimConfig) (BlockRelayStats, error) {
+	if cfg.Nodes < 2 || !(cfg.Coverage >= 0 && cfg.Coverage <= 1) {
+		return BlockRelayStats{}, errors.New("block relay sim needs 2 nodes or more and a coverage of 0 to 1")
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	tn := NewTestNet(cfg.Nodes, TestGenesis(MAX_TXNS_PER_BLOCK+1))
+	defer tn.Close()
+	for i := range cfg.Nodes {
+		tn.Node(i).SetRelay(RelayConfig{Peers: []string{tn.PeerURL(i, (i+1)%cfg.Nodes)}, Blocks: cfg.Blocks})
+	}
+	// Signed transfers, the size of those of real wallets
+	wallets := make([]*Wallet, MAX_TXNS_PER_BLOCK)
+	for k := range wallets {
+		var err error
+		if wallets[k], err = NewWallet(fmt.Sprintf("account%v", k)); err != nil {
+			return BlockRelayStats{}, err
+		}
+	}
+	var stats BlockRelayStats
+	for height := 1; height <= BLOCK_RELAY_SIM_BLOCKS; height++ {
+		for k, w := range wallets {
+			txn, err := signOffline(w, fmt.Sprintf("account%v", k+1), NATIVE_ASSET, COIN, 0, uint64(height-1), "")
+			if err != nil {
+				return stats, err
+			}
+			for i := range cfg.Nodes {
+				if i > 0 && rng.Float64() >= cfg.Coverage {
+					continue
+				}
+				// Straight to the Mempools, without relaying
+				tn.Node(i).withChain(func(bc *BlockChain) { err = bc.AddTxn(txn) })
+				if err != nil {
+					return stats, err
+				}
+			}
+		}
+		if _, err := tn.MineOn(0); err != nil {
+			return stats, err
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			stats = BlockRelayStats{}
+			for i := range cfg.Nodes {
+				stats.add(tn.Node(i).BlockRelayStats())
+			}
+			_, heights := tn.Tips()
+			if stats.Blocks == height*cfg.Nodes && !slices.ContainsFunc(heights, func(h int) bool { return h != height }) {
+				break
+			}
+			if time.Now().After(deadline) {
+				return stats, fmt.Errorf("block %v not relayed around the ring, heights %v", height, heights)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return stats, nil
+}
+
+// Relay Blocks compact and whole to nodes holding less and less of their transactions
+func printBlockRelaySim(out *Output) error {
+	const nodes = 8
+	out.Note("%v blocks of %v transactions around a ring of %v nodes", BLOCK_RELAY_SIM_BLOCKS, MAX_TXNS_PER_BLOCK, nodes)
+	type jsonRun struct {
+		Coverage float64 `json:"coverage"`
+		Blocks   string  `json:"blocks"`
+		BlockRelayStats
+	}
+	rows, view := [][]string{}, []jsonRun{}
+	for _, coverage := range []float64{1, 0.9, 0.5, 0} {
+		for _, blocks := range []string{BLOCK_RELAY_COMPACT, BLOCK_RELAY_FULL} {
+			stats, err := SimulateBlockRelay(BlockRelaySimConfig{Nodes: nodes, Coverage: coverage, Blocks: blocks, Seed: 1})
+			if err != nil {
+				return err
+			}
+			rows = append(rows, []string{fmt.Sprintf("%.0f%%", 100*coverage), blocks,
+				fmt.Sprint(stats.Bytes / stats.Blocks), fmt.Sprintf("%.0f%%", 100-100*float64(stats.Bytes)/float64(stats.WholeBytes)),
+				fmt.Sprintf("%.2f", float64(stats.Requests)/float64(stats.Blocks)), fmt.Sprint(stats.Fallbacks)})
+			view = append(view, jsonRun{coverage, blocks, stats})
+		}
+	}
+	return out.Table([]string{"coverage", "blocks", "bytes", "saved", "requests", "fallbacks"}, rows, view)
+}
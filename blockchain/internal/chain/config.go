@@ -0,0 +1,195 @@
+/*
+ * Node configuration.
+ * Every flag can also be set in a configuration file, -config, and in an
+ * environment variable named after it, eg. TOYCHAIN_RELAY_PEERS for
+ * -relay-peers. The command line wins over the environment, which wins
+ * over the file, so one file describes a node and a flag or a variable
+ * tweaks it for a run. The file is a flat subset of TOML, one flag per
+ * line:
+ *
+ *	# node A of the classroom network
+ *	http = ":8081"
+ *	data-dir = "nodes/a"
+ *	difficulty = 3
+ *	relay-peers = ["http://localhost:8082", "http://localhost:8083"]
+ *	mine = true
+ *	mine-wait = "5s"
+ *
+ * Lists are joined with commas, the way the flags take them. With
+ * -data-dir, the relative paths of the files a node keeps (keystore, cold
+ * storage, backups, snapshots, identity key, mempool file, state
+ * snapshots) are taken from it, so nodes on the same machine do not share
+ * them.
+ *
+ * Consensus parameters, eg. the block limits or the retarget, stay in the
+ * genesis spec, -genesis, as every node of a chain must agree on them.
+ */
+package chain
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the environment variables setting flags
+const CONFIG_ENV_PREFIX = "TOYCHAIN_"
+
+// Flags naming the files of a node, relative to -data-dir when set
+var DATA_DIR_FLAGS = []string{"keystore", "cold-dir", "wal", "backup-dir", "snapshots", "node-key", "mempool-file", "state-snapshots"}
+
+// Environment variable setting flag name, eg. TOYCHAIN_RELAY_PEERS for relay-peers
+func configEnv(name string) string {
+	return CONFIG_ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Flag values of the configuration file at path, by flag name
+func ReadConfig(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	config := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%v:%v: expected key = value", path, n)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v: %w", path, n, key, err)
+		}
+		if _, dup := config[key]; dup {
+			return nil, fmt.Errorf("%v:%v: %v set twice", path, n, key)
+		}
+		config[key] = value
+	}
+	return config, scanner.Err()
+}
+
+/*
+ * Flag value of a TOML value: a quoted string, a list of them joined with
+ * commas, or a bare number or boolean, each maybe followed by a comment
+ */
+func parseConfigValue(raw string) (string, error) {
+	if list, ok := strings.CutPrefix(raw, "["); ok {
+		end := strings.LastIndex(list, "]")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated list %v", raw)
+		}
+		if rest := strings.TrimSpace(list[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the list", rest)
+		}
+		items := []string{}
+		for item := range strings.SplitSeq(list[:end], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			s, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	}
+	if strings.HasPrefix(raw, `"`) {
+		prefix, err := strconv.QuotedPrefix(raw)
+		if err != nil {
+			return "", fmt.Errorf("bad string %v", raw)
+		}
+		if rest := strings.TrimSpace(raw[len(prefix):]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the string", rest)
+		}
+		return strconv.Unquote(prefix)
+	}
+	value, _, _ := strings.Cut(raw, "#")
+	if value = strings.TrimSpace(value); value == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return value, nil
+}
+
+/*
+ * Set the flags of fs not given on the command line from the environment,
+ * then from the configuration file at path if set
+ */
+func loadConfig(fs *flag.FlagSet, path string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(configEnv(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if err = fs.Set(f.Name, value); err != nil {
+			err = fmt.Errorf("$%v: %w", configEnv(f.Name), err)
+		}
+		given[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		config, err := ReadConfig(path)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(config) {
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("%v: unknown setting %v", path, name)
+			}
+			if given[name] {
+				continue
+			}
+			if err := fs.Set(name, config[name]); err != nil {
+				return fmt.Errorf("%v: %v: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Take the relative paths of the DATA_DIR_FLAGS of fs from dir
+func resolveDataDir(fs *flag.FlagSet, dir string) {
+	if dir == "" {
+		return
+	}
+	for _, name := range DATA_DIR_FLAGS {
+		if f := fs.Lookup(name); f != nil && f.Value.String() != "" && !filepath.IsAbs(f.Value.String()) {
+			fs.Set(name, filepath.Join(dir, f.Value.String()))
+		}
+	}
+}
+
+// Write the flags of fs differing from their defaults as a configuration file
+func writeConfig(w io.Writer, fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Value.String() == f.DefValue || f.Name == "config" || f.Name == "show-config" {
+			return
+		}
+		value := strconv.Quote(f.Value.String())
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch g.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+				value = f.Value.String()
+			}
+		}
+		_, err = fmt.Fprintf(w, "%v = %v\n", f.Name, value)
+	})
+	return err
+}
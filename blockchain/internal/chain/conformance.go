@@ -0,0 +1,721 @@
+/*
+ * Conformance suite for consensus rules.
+ * A fixture is a genesis spec followed by steps, each step a mined Block
+ * that must be accepted (and lead to the given state root) or rejected.
+ * Fixtures are plain JSON so alternative implementations can replay them,
+ * and any change affecting consensus must keep RunConformance passing.
+ * Deliberate rule changes regenerate the fixtures with WriteConformance.
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ConformanceStep struct {
+	Description string    `json:"description"`
+	Block       jsonBlock `json:"block"`
+	Accept      bool      `json:"accept"`
+	StateRoot   string    `json:"stateRoot,omitempty"` // state root after an accepted Block
+}
+
+type ConformanceFixture struct {
+	Name    string            `json:"name"`
+	Genesis Genesis           `json:"genesis"`
+	Steps   []ConformanceStep `json:"steps"`
+}
+
+type ConformanceResult struct {
+	Fixture string
+	Err     error // nil if every step behaved as expected
+}
+
+// Replay a fixture against a fresh chain
+func (f ConformanceFixture) run() error {
+	bc := CreateBlockChain(f.Genesis)
+	for i, step := range f.Steps {
+		err := bc.appendBlock(step.Block.block())
+		switch {
+		case step.Accept && err != nil:
+			return fmt.Errorf("step %v (%v): expected accept, got %w", i, step.Description, err)
+		case !step.Accept && err == nil:
+			return fmt.Errorf("step %v (%v): expected reject, block was accepted", i, step.Description)
+		case step.Accept && bc.state.Root() != step.StateRoot:
+			return fmt.Errorf("step %v (%v): state root %v, expected %v", i, step.Description, bc.state.Root(), step.StateRoot)
+		}
+	}
+	return nil
+}
+
+// Run every *.json fixture in dir
+func RunConformance(dir string) ([]ConformanceResult, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	results := []ConformanceResult{}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f ConformanceFixture
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("parsing %v: %w", path, err)
+		}
+		results = append(results, ConformanceResult{Fixture: f.Name, Err: f.run()})
+	}
+	return results, nil
+}
+
+// Builds a fixture step by step, mining Blocks with fixed timestamps
+type fixtureBuilder struct {
+	fixture ConformanceFixture
+	bc      BlockChain
+	unixTs  int64
+}
+
+func newFixtureBuilder(name string, genesis Genesis) *fixtureBuilder {
+	return &fixtureBuilder{
+		fixture: ConformanceFixture{Name: name, Genesis: genesis},
+		bc:      CreateBlockChain(genesis),
+		unixTs:  genesis.UnixTs,
+	}
+}
+
+// Mine a Block on top of the current chain, without appending it
+func (fb *fixtureBuilder) mine(txns ...Transaction) Block {
+	fb.unixTs += 10_000_000
+	b := Block{
+		Header: Header{prevHash: fb.bc.lastBlock().hash, miner: "miner", unixTs: fb.unixTs},
+		data:   txns,
+	}
+	// Blocks the chain refuses commit to no state
+	if state, err := fb.bc.DryRun(b); err == nil {
+		fb.bc.commitState(&b, state)
+		fb.bc.commitAddresses(&b)
+	}
+	fb.bc.commitVersion(&b)
+	b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+	return b
+}
+
+// Record a step, checking the current rules agree with the expectation
+func (fb *fixtureBuilder) step(description string, b Block, accept bool) {
+	step := ConformanceStep{Description: description, Block: b.toJSON(), Accept: accept}
+	err := fb.bc.appendBlock(b)
+	if accept != (err == nil) {
+		panic(fmt.Sprintf("fixture %v: %v: accept=%v but got %v", fb.fixture.Name, description, accept, err))
+	}
+	if accept {
+		step.StateRoot = fb.bc.state.Root()
+	}
+	fb.fixture.Steps = append(fb.fixture.Steps, step)
+}
+
+func conformanceGenesis() Genesis {
+	g := DefaultGenesis(2)
+	g.ChainID = "conformance"
+	g.UnixTs = 1_700_000_000_000_000
+	g.Alloc = map[string]Amount{"alice": 100 * COIN, "bob": 50 * COIN}
+	g.Assets = map[string]map[string]Amount{"gold": {"bob": 10 * COIN}}
+	return g
+}
+
+// The scenarios of the suite
+func conformanceFixtures() []ConformanceFixture {
+	fixtures := []ConformanceFixture{}
+	alice, _ := NewWallet("alice")
+	bob, _ := NewWallet("bob")
+	carol, _ := NewWallet("carol")
+
+	fb := newFixtureBuilder("transfers", conformanceGenesis())
+	fb.step("plain transfers", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: 10 * COIN, nonce: 0},
+		Transaction{payer: "alice", payee: "carol", amt: 5 * COIN, fee: COIN / 2, nonce: 1},
+	), true)
+	fb.step("asset transfer", fb.mine(
+		Transaction{payer: "bob", payee: "carol", asset: "gold", amt: 2 * COIN, nonce: 0},
+	), true)
+	fb.step("transfer above the balance", fb.mine(
+		Transaction{payer: "carol", payee: "bob", amt: 6 * COIN, nonce: 0},
+	), false)
+	fb.step("transfer whose fee exceeds the balance", fb.mine(
+		Transaction{payer: "carol", payee: "bob", asset: "gold", amt: COIN, fee: COIN / 2, nonce: 0},
+		Transaction{payer: "carol", payee: "bob", amt: 5 * COIN, fee: COIN / 10, nonce: 1},
+	), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("payouts", conformanceGenesis())
+	fb.step("batch payout", fb.mine(
+		NewBatchTransfer("alice", 0, NATIVE_ASSET, NewPayout("bob", 5*COIN), NewPayout("carol", 3*COIN), NewPayout("dave", 2*COIN)),
+	), true)
+	fb.step("payout without amount", fb.mine(
+		NewBatchTransfer("alice", 1, NATIVE_ASSET, NewPayout("bob", 5*COIN), NewPayout("carol", 0)),
+	), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("gas", conformanceGenesis())
+	fb.step("gas priced transfer", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0, gasLimit: GAS_TRANSFER, gasPrice: COIN / 10_000},
+	), true)
+	fb.step("gas limit below gas used", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1, gasLimit: 1000, gasPrice: COIN / 10_000},
+	), false)
+	heavy := []Transaction{}
+	for nonce := uint64(1); nonce <= 5; nonce++ {
+		heavy = append(heavy, NewSwap(nonce, NewSwapLeg("alice", "bob", NATIVE_ASSET, COIN), NewSwapLeg("alice", "carol", NATIVE_ASSET, COIN)))
+	}
+	for i := range heavy {
+		heavy[i].SignSwap(alice)
+		heavy[i].SignSwap(bob)
+		heavy[i].SignSwap(carol)
+	}
+	fb.step("block over the gas limit", fb.mine(heavy...), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("block-linkage", conformanceGenesis())
+	b := fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.prevHash = SHA256([]byte("elsewhere"))
+	b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+	fb.step("unknown parent", b, false)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.data[0].amt = 2 * COIN
+	fb.step("tampered transaction", b, false)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	for fb.bc.genesis.Pow.meets(b.Header, b.hash, fb.bc.difficulty) {
+		b.nonce++
+		b.hash = b.computeHash()
+	}
+	fb.step("insufficient proof of work", b, false)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.mine(fb.bc.difficulty-1, fb.bc.genesis.Pow)
+	fb.step("header claiming a lower difficulty", b, false)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.mine(fb.bc.difficulty+1, fb.bc.genesis.Pow)
+	fb.step("header claiming a higher difficulty", b, false)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.data = append(b.data, Transaction{payer: "bob", payee: "alice", amt: COIN, nonce: 0})
+	fb.step("transaction added under a mined header", b, false)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.retarget = 1
+	b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+	fb.step("difficulty change outside a devnet", b, false)
+	fb.step("valid block", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	scryptGenesis := conformanceGenesis()
+	scryptGenesis.Pow, _ = NewPowSpec(POW_SCRYPT)
+	fb = newFixtureBuilder("scrypt-pow", scryptGenesis)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.mine(fb.bc.difficulty, nil)
+	for scryptGenesis.Pow.meets(b.Header, b.hash, fb.bc.difficulty) {
+		b.nonce++
+		b.mine(fb.bc.difficulty, nil)
+	}
+	fb.step("block with SHA-256 work only", b, false)
+	fb.step("block with scrypt work", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("nonces", conformanceGenesis())
+	fb.step("first nonce", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	fb.step("replayed nonce", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), false)
+	fb.step("nonce gap", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 2}), false)
+	fb.step("next nonce", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("mint", conformanceGenesis())
+	fb.step("mint after genesis", fb.mine(Transaction{kind: TxnMint, payee: "alice", amt: 1000 * COIN}), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("swaps", conformanceGenesis())
+	swap := NewSwap(0, NewSwapLeg("alice", "bob", NATIVE_ASSET, 20*COIN), NewSwapLeg("bob", "alice", "gold", 2*COIN))
+	swap.SignSwap(alice)
+	unsigned := swap
+	fb.step("swap missing a signature", fb.mine(unsigned), false)
+	swap.SignSwap(bob)
+	fb.step("swap signed by all parties", fb.mine(swap), true)
+	greedy := NewSwap(1, NewSwapLeg("alice", "bob", NATIVE_ASSET, COIN), NewSwapLeg("bob", "alice", "gold", 100*COIN))
+	greedy.SignSwap(alice)
+	greedy.SignSwap(bob)
+	fb.step("swap leg without funds", fb.mine(greedy), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("orders", conformanceGenesis())
+	sell := NewOrder("bob", 0, Sell, "gold", NATIVE_ASSET, 5*COIN, 4*COIN)
+	fb.step("matching orders", fb.mine(sell, NewOrder("alice", 0, Buy, "gold", NATIVE_ASSET, 6*COIN, 3*COIN)), true)
+	fb.step("cancel by non owner", fb.mine(NewCancelOrder("alice", 1, sell.Hash())), false)
+	fb.step("cancel by owner", fb.mine(NewCancelOrder("bob", 1, sell.Hash())), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("kv", conformanceGenesis())
+	fb.step("claim a namespace", fb.mine(NewKVWrite("alice", 0, "alice.app", "greeting", []byte("hello"))), true)
+	fb.step("write to a namespace of another owner", fb.mine(NewKVWrite("bob", 0, "alice.app", "greeting", []byte("hijack"))), false)
+	fb.step("overwrite and delete by owner", fb.mine(
+		NewKVWrite("alice", 1, "alice.app", "greeting", []byte("hi")),
+		NewKVWrite("alice", 2, "alice.app", "greeting", nil),
+	), true)
+	fb.step("oversized value", fb.mine(NewKVWrite("alice", 3, "alice.app", "blob", make([]byte, MAX_KV_VALUE_SIZE+1))), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("scripts", conformanceGenesis())
+	fb.step("arithmetic script", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithScript("2 3 ADD 5 EQUAL"),
+	), true)
+	fb.step("script ending false", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}.WithScript("2 3 ADD 6 EQUAL"),
+	), false)
+	p2pk := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}.WithScript(fmt.Sprintf("0x%x CHECKSIG", alice.PublicKey()))
+	forged := p2pk
+	forged.script = &Script{code: p2pk.script.code}
+	forged.SignScript(bob)
+	fb.step("signature by the wrong key", fb.mine(forged), false)
+	p2pk.SignScript(alice)
+	fb.step("signature by the locking key", fb.mine(p2pk), true)
+	hashlock := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 2}.WithScript(
+		fmt.Sprintf("SHA256 0x%v EQUAL", SHA256([]byte("secret"))))
+	hashlock.PushWitness([]byte("secret"))
+	fb.step("hash lock opened with the preimage", fb.mine(hashlock), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("utxo", conformanceGenesis())
+	deposit := NewUTXOTxn("alice", "", 0, 30*COIN, nil, NewUTXOOutput("alice", 20*COIN), NewUTXOOutput("bob", 10*COIN))
+	fb.step("deposit from account into outputs", fb.mine(deposit), true)
+	aliceOut := utxoID(deposit.Hash(), 0)
+	unsignedSpend := NewUTXOTxn("alice", "", 1, 0, []string{aliceOut}, NewUTXOOutput("carol", 20*COIN))
+	fb.step("spend without the owner's signature", fb.mine(unsignedSpend), false)
+	pay, _ := PayUTXO(alice, fb.bc.UTXOs("alice"), "carol", 15*COIN, 1)
+	fb.step("payment with change", fb.mine(pay), true)
+	fb.step("double spend", fb.mine(NewUTXOTxn("alice", "", 2, 0, []string{aliceOut}, NewUTXOOutput("carol", 20*COIN))), false)
+	withdraw := NewUTXOTxn("bob", "bob", 0, 0, []string{utxoID(deposit.Hash(), 1)})
+	withdraw.SignUTXO(bob)
+	fb.step("withdraw an output to an account", fb.mine(withdraw), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("multisig", conformanceGenesis())
+	fb.step("declare a 2-of-3 multisig", fb.mine(
+		NewMultisig("alice", 0, 2, alice.PublicKey(), bob.PublicKey(), carol.PublicKey()),
+	), true)
+	spend := Transaction{payer: "alice", payee: "dave", amt: 5 * COIN, nonce: 1}
+	spend.CoSign(carol)
+	fb.step("spend with one signature", fb.mine(spend), false)
+	spend.CoSign(carol)
+	fb.step("spend with the same signer twice", fb.mine(spend), false)
+	spend.cosigs = nil
+	spend.CoSign(bob)
+	spend.CoSign(carol)
+	fb.step("spend with two signatures", fb.mine(spend), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("signature-schemes", conformanceGenesis())
+	edAlice, _ := NewSchemeWallet("alice", SchemeEd25519)
+	edBob, _ := NewSchemeWallet("bob", SchemeEd25519)
+	lock := fmt.Sprintf("0x%x CHECKSIG", edAlice.PublicKey())
+	mislabeled := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithScript(lock)
+	sig, _ := edAlice.Sign(mislabeled.digest())
+	mislabeled.PushWitness(sig)
+	fb.step("ed25519 signature verified as ECDSA", fb.mine(mislabeled), false)
+	edP2PK := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithScript(lock).WithScheme(SchemeEd25519)
+	edP2PK.SignScript(edAlice)
+	fb.step("ed25519 signature by the locking key", fb.mine(edP2PK), true)
+	edSwap := NewSwap(1, NewSwapLeg("alice", "bob", "", 5*COIN), NewSwapLeg("bob", "alice", "gold", 2*COIN)).WithScheme(SchemeEd25519)
+	edSwap.SignSwap(edAlice)
+	edSwap.SignSwap(edBob)
+	fb.step("swap signed with ed25519", fb.mine(edSwap), true)
+	fb.step("unknown scheme", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 2}.WithScheme(7)), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("schnorr-aggregation", conformanceGenesis())
+	schnorrAlice, _ := NewSchemeWallet("alice", SchemeSchnorr)
+	schnorrBob, _ := NewSchemeWallet("bob", SchemeSchnorr)
+	schnorrSwap := func(nonce uint64, signers ...*Wallet) Transaction {
+		swap := NewSwap(nonce, NewSwapLeg("alice", "bob", "", 5*COIN), NewSwapLeg("bob", "alice", "gold", COIN)).WithScheme(SchemeSchnorr)
+		for _, w := range signers {
+			swap.SignSwap(w)
+		}
+		return swap
+	}
+	fb.step("swap signed with Schnorr", fb.mine(schnorrSwap(0, schnorrAlice, schnorrBob)), true)
+	partial := schnorrSwap(1, schnorrAlice)
+	partial.AggregateSignatures()
+	fb.step("aggregate missing a party", fb.mine(partial), false)
+	reordered := schnorrSwap(1, schnorrAlice, schnorrBob)
+	reordered.AggregateSignatures()
+	agg := reordered.swap.aggSig
+	reordered.swap.aggSig = slices.Concat(agg[SCHNORR_POINT_SIZE:2*SCHNORR_POINT_SIZE], agg[:SCHNORR_POINT_SIZE], agg[2*SCHNORR_POINT_SIZE:])
+	fb.step("aggregate with the signers out of order", fb.mine(reordered), false)
+	aggregated := schnorrSwap(1, schnorrAlice, schnorrBob)
+	aggregated.AggregateSignatures()
+	fb.step("swap carrying the aggregate", fb.mine(aggregated), true)
+	joint := NewUTXOTxn("alice", "", 2, 10*COIN, nil, NewUTXOOutput("alice", 4*COIN), NewUTXOOutput("bob", 6*COIN))
+	fb.step("deposit into outputs of two owners", fb.mine(joint), true)
+	spendBoth := NewUTXOTxn("alice", "", 3, 0, []string{utxoID(joint.Hash(), 0), utxoID(joint.Hash(), 1)}, NewUTXOOutput("carol", 10*COIN)).WithScheme(SchemeSchnorr)
+	spendBoth.SignUTXO(schnorrAlice)
+	spendBoth.SignUTXO(schnorrBob)
+	spendBoth.AggregateSignatures()
+	fb.step("UTXO spend by both owners carrying the aggregate", fb.mine(spendBoth), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	replayGenesis := conformanceGenesis()
+	replayGenesis.ReplayProtection = true
+	fb = newFixtureBuilder("replay-protection", replayGenesis)
+	fb.step("transaction naming no chain", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), false)
+	fb.step("transaction for another chain", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithChainID("toychain")), false)
+	replayed := NewSwap(0, NewSwapLeg("alice", "bob", "", 5*COIN), NewSwapLeg("bob", "alice", "gold", 2*COIN)).WithChainID("toychain")
+	replayed.SignSwap(alice)
+	replayed.SignSwap(bob)
+	replayed.chainID = replayGenesis.ChainID
+	fb.step("swap signed for another chain", fb.mine(replayed), false)
+	fb.step("transaction for this chain", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithChainID(replayGenesis.ChainID)), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("access-lists", conformanceGenesis())
+	fb.step("disjoint transfers in one wave", fb.mine(
+		Transaction{payer: "alice", payee: "carol", amt: 5 * COIN, nonce: 0}.WithAccessList(),
+		Transaction{payer: "bob", payee: "dave", amt: 5 * COIN, nonce: 0}.WithAccessList(),
+		Transaction{payer: "carol", payee: "bob", amt: 2 * COIN, nonce: 0}.WithAccessList(),
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1},
+	), true)
+	undeclared := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 2}
+	undeclared.accessList = []string{"account:alice"}
+	fb.step("payee missing from the access list", fb.mine(undeclared), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	devnet := conformanceGenesis()
+	devnet.DevNet = true
+	fb = newFixtureBuilder("devnet-difficulty", devnet)
+	b = fb.mine()
+	b.retarget = MAX_DEV_DIFFICULTY + 1
+	b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+	fb.step("difficulty change above the maximum", b, false)
+	b = fb.mine()
+	b.retarget = 3
+	b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+	fb.step("difficulty change to 3", b, true)
+	b = fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0})
+	b.mine(2, fb.bc.genesis.Pow)
+	fb.step("block at the former difficulty", b, false)
+	fb.step("block at the new difficulty", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("txn-data", conformanceGenesis())
+	digest := sha256.Sum256([]byte("toychain conformance"))
+	fb.step("transfer anchoring a hash", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithData(digest[:])), true)
+	fb.step("data above the maximum", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}.WithData(make([]byte, MAX_TXN_DATA+1))), false)
+	fb.step("data at the maximum", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}.WithData(make([]byte, MAX_TXN_DATA))), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	retarget := conformanceGenesis()
+	retarget.Retarget = &RetargetSpec{Algorithm: RETARGET_LWMA, Interval: 60, Window: 4}
+	fb = newFixtureBuilder("retarget", retarget)
+	fb.step("block 6 times faster than the interval", fb.mine(), true)
+	b = fb.mine()
+	b.mine(2, fb.bc.genesis.Pow)
+	fb.step("block at the difficulty before the retarget", b, false)
+	fb.step("block at the raised difficulty", fb.mine(), true)
+	fb.unixTs += 3600_000_000
+	fb.step("block an hour late", fb.mine(), true)
+	b = fb.mine()
+	b.mine(3, fb.bc.genesis.Pow)
+	fb.step("block at the difficulty before the slow block", b, false)
+	fb.step("block at the lowered difficulty", fb.mine(), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	rules := conformanceGenesis()
+	rules.Rules = []RuleSpec{
+		{Rule: RULE_MAX_AMOUNT, Amount: 20 * COIN},
+		{Rule: RULE_ALLOW_LIST, Accounts: []string{"alice", "bob", "carol"}},
+		{Rule: RULE_DATA_FIELDS, Fields: []string{"course"}},
+	}
+	fb = newFixtureBuilder("rules", rules)
+	course := []byte(`{"course": "cs101"}`)
+	fb.step("transfer within the rules", fb.mine(Transaction{payer: "alice", payee: "bob", amt: 20 * COIN, nonce: 0}.WithData(course)), true)
+	fb.step("amount above the maximum", fb.mine(Transaction{payer: "alice", payee: "bob", amt: 21 * COIN, nonce: 1}.WithData(course)), false)
+	fb.step("payee off the allow-list", fb.mine(Transaction{payer: "alice", payee: "dave", amt: COIN, nonce: 1}.WithData(course)), false)
+	fb.step("data without the course", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}.WithData([]byte(`{"student": 7}`))), false)
+	fb.step("batch transfer within the rules", fb.mine(
+		NewBatchTransfer("bob", 0, NATIVE_ASSET, NewPayout("alice", 5*COIN), NewPayout("carol", 5*COIN)).WithData(course),
+	), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	frozen := conformanceGenesis()
+	frozen.Rules = []RuleSpec{
+		{Rule: RULE_FREEZE, Accounts: []string{"mallory"}, Namespace: "sanctions", Admin: "carol"},
+		{Rule: RULE_RECIPIENTS, Accounts: []string{"alice", "bob", "carol", "mallory"}},
+	}
+	fb = newFixtureBuilder("freeze", frozen)
+	fb.step("payment to a frozen account", fb.mine(Transaction{payer: "alice", payee: "mallory", amt: COIN, nonce: 0}), false)
+	fb.step("payment to an account off the recipients", fb.mine(Transaction{payer: "alice", payee: "dave", amt: COIN, nonce: 0}), false)
+	fb.step("write to the freeze namespace by another account", fb.mine(NewKVWrite("alice", 0, "sanctions", "bob", []byte("1"))), false)
+	fb.step("admin freezing bob", fb.mine(NewKVWrite("carol", 0, "sanctions", "bob", []byte("1"))), true)
+	fb.step("payment by bob while frozen", fb.mine(Transaction{payer: "bob", payee: "alice", amt: COIN, nonce: 0}), false)
+	fb.step("payment to bob while frozen", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), false)
+	fb.step("admin unfreezing bob", fb.mine(NewKVWrite("carol", 1, "sanctions", "bob", nil)), true)
+	fb.step("payment to bob once unfrozen", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	sized := conformanceGenesis()
+	sized.BlockLimits = &BlockLimits{Bytes: 400, Txns: 6}
+	fb = newFixtureBuilder("block-size", sized)
+	transfers := func(from, n uint64) []Transaction {
+		txns := []Transaction{}
+		for nonce := from; nonce < from+n; nonce++ {
+			txns = append(txns, Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: nonce})
+		}
+		return txns
+	}
+	fb.step("six transfers, above the legacy cap", fb.mine(transfers(0, 6)...), true)
+	fb.step("seven transfers, above the cap", fb.mine(transfers(6, 7)...), false)
+	fb.step("two transfers above the byte limit", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 6}.WithData(make([]byte, 200)),
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 7}.WithData(make([]byte, 200)),
+	), false)
+	fb.step("transfer with data within the byte limit", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 6}.WithData(make([]byte, 200)),
+	), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	feeAssets := conformanceGenesis()
+	feeAssets.FeeAssets, feeAssets.FeeOracle = []string{"gold"}, "oracle"
+	fb = newFixtureBuilder("fee-assets", feeAssets)
+	inGold := func(nonce uint64, fee Amount) Transaction {
+		return Transaction{payer: "bob", payee: "alice", amt: COIN, fee: fee, nonce: nonce}.WithFeeAsset("gold")
+	}
+	fb.step("fee in gold before a rate is published", fb.mine(inGold(0, 2*COIN)), false)
+	fb.step("rate written by another account", fb.mine(NewFeeRate("alice", 0, "gold", 0.5)), false)
+	fb.step("rate published by the oracle", fb.mine(NewFeeRate("oracle", 0, "gold", 0.5)), true)
+	fb.step("transfer paying its fee in gold", fb.mine(inGold(0, 2*COIN)), true)
+	fb.step("fee in an asset the genesis does not list", fb.mine(inGold(1, 2*COIN).WithFeeAsset("silver")), false)
+	fb.step("fee above the gold balance", fb.mine(inGold(1, 9*COIN)), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("messages", conformanceGenesis())
+	note, _ := NewMessage("alice", 0, "bob", bob.PublicKey(), []byte("hello bob"))
+	long, _ := NewMessage("alice", 0, "bob", bob.PublicKey(), make([]byte, MAX_MESSAGE_SIZE+1))
+	nowhere, _ := NewMessage("alice", 0, "", bob.PublicKey(), []byte("hello"))
+	fb.step("message above the size limit", fb.mine(long), false)
+	fb.step("message without payee", fb.mine(nowhere), false)
+	fb.step("message to bob", fb.mine(note), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	// No schema is registered on the chains of the fixtures
+	fb = newFixtureBuilder("records", conformanceGenesis())
+	record := func(schema, payload string) Transaction {
+		return Transaction{kind: TxnRecord, payer: "alice", record: &RecordTxn{schema: schema, payload: []byte(payload)}}
+	}
+	fb.step("record without schema", fb.mine(record("", `{"lot":"42"}`)), false)
+	fb.step("record above the size limit", fb.mine(record("shipment", `"`+strings.Repeat("x", MAX_RECORD_SIZE)+`"`)), false)
+	fb.step("record of an unknown schema", fb.mine(record("shipment", `{"lot":"42"}`)), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	votingGenesis := conformanceGenesis()
+	votingGenesis.Apps = []string{APP_VOTING}
+	fb = newFixtureBuilder("voting", votingGenesis)
+	ballot := func(voter string, nonce uint64, choice string) Transaction {
+		txn, _ := NewBallot(voter, nonce, "lunch", choice)
+		return txn
+	}
+	lunch, _ := NewPoll("bob", 0, "lunch", PollSpec{Choices: []string{"pizza", "salad"}, Closes: 3})
+	fb.step("poll opened by bob for alice", fb.mine(lunch, NewPollVoter("bob", 1, "lunch", "alice", 0)), true)
+	fb.step("ballot of a voter not registered", fb.mine(ballot("bob", 2, "pizza")), false)
+	fb.step("ballot for no choice of the poll", fb.mine(ballot("alice", 0, "tacos")), false)
+	fb.step("two ballots in a block", fb.mine(ballot("alice", 0, "pizza"), ballot("alice", 1, "salad")), false)
+	fb.step("voter registered by another account", fb.mine(NewPollVoter("alice", 0, "lunch", "alice", 1)), false)
+	fb.step("ballot of alice", fb.mine(ballot("alice", 0, "pizza")), true)
+	fb.step("second ballot of alice", fb.mine(ballot("alice", 1, "salad")), false)
+	fb.step("alice registered again to change her vote", fb.mine(NewPollVoter("bob", 2, "lunch", "alice", 1)), true)
+	fb.step("ballot after the poll closed", fb.mine(ballot("alice", 1, "salad")), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	fb = newFixtureBuilder("tokens", conformanceGenesis())
+	toy := func(payer string, nonce uint64, amt Amount) Transaction {
+		return Transaction{payer: payer, payee: "carol", asset: "TOY", amt: amt, nonce: nonce}
+	}
+	fb.step("token without symbol", fb.mine(NewToken("alice", 0, "", "Nameless", 0, 1000*COIN)), false)
+	fb.step("token without supply", fb.mine(NewToken("alice", 0, "TOY", "Toy token", 2, 0)), false)
+	fb.step("token of an asset of the genesis", fb.mine(NewToken("alice", 0, "gold", "Gold", 0, 1000*COIN)), false)
+	fb.step("transfer of a token not created yet", fb.mine(toy("alice", 0, COIN)), false)
+	fb.step("token created by alice", fb.mine(NewToken("alice", 0, "TOY", "Toy token", 2, 1000*COIN)), true)
+	fb.step("token of the same symbol by bob", fb.mine(NewToken("bob", 0, "TOY", "Other toy", 0, 5*COIN)), false)
+	fb.step("two tokens of a symbol in a block", fb.mine(
+		NewToken("bob", 0, "FUN", "Fun", 0, 10*COIN),
+		NewToken("alice", 1, "FUN", "Fun", 0, 10*COIN),
+	), false)
+	fb.step("transfers of the token", fb.mine(toy("alice", 1, 400*COIN), Transaction{payer: "alice", payee: "bob", asset: "TOY", amt: 100 * COIN, nonce: 2}), true)
+	fb.step("transfer above the token balance", fb.mine(toy("bob", 0, 101*COIN)), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	// Premine of 150, rewards of 8, 8, 4 and 2 cut by the cap
+	issuing := conformanceGenesis()
+	issuing.Issuance = &IssuanceSpec{Reward: 8 * COIN, Halving: 2, MaxSupply: 172 * COIN}
+	fb = newFixtureBuilder("issuance", issuing)
+	fromMiner := func(nonce uint64, amt Amount) Transaction {
+		return Transaction{payer: "miner", payee: "carol", amt: amt, nonce: nonce}
+	}
+	fb.step("block minting the first reward", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	fb.step("miner spending more than its reward", fb.mine(fromMiner(0, 9*COIN)), false)
+	fb.step("miner spending its reward", fb.mine(fromMiner(0, 8*COIN)), true)
+	fb.step("first block of the halved reward", fb.mine(fromMiner(1, 8*COIN)), true)
+	fb.step("block reward cut to the supply cap", fb.mine(fromMiner(2, 4*COIN)), true)
+	fb.step("block past the supply cap", fb.mine(fromMiner(3, 2*COIN)), true)
+	fb.step("miner spending a reward past the cap", fb.mine(fromMiner(4, COIN)), false)
+	fixtures = append(fixtures, fb.fixture)
+
+	// Genesis and 3 Blocks 10s apart, their median time 20s after genesis, then restamped Blocks
+	genesis := conformanceGenesis()
+	fb = newFixtureBuilder("timestamps", genesis)
+	stamped := func(unixTs int64) Block {
+		b := fb.mine()
+		b.unixTs = unixTs
+		b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+		return b
+	}
+	for range 3 {
+		fb.step("block 10s after its parent", fb.mine(), true)
+	}
+	fb.step("block before its parent, past the median time", stamped(genesis.UnixTs+25_000_000), true)
+	fb.step("block at the median time", stamped(genesis.UnixTs+20_000_000), false)
+	fb.step("block before the median time", stamped(genesis.UnixTs), false)
+	fb.step("block stamped in the year 3000", stamped(time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro()), false)
+	fb.step("block past the median time", fb.mine(), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	// Blocks 10s apart, refused ones included: the median time past reaches 25s after genesis at height 4
+	genesis = conformanceGenesis()
+	fb = newFixtureBuilder("timelocks", genesis)
+	byHeight := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}.WithLockHeight(2)
+	byTime := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1}.WithLockTime(time.UnixMicro(genesis.UnixTs + 25_000_000))
+	fb.step("transfer locked until height 2 at height 1", fb.mine(byHeight), false)
+	fb.step("empty block", fb.mine(), true)
+	fb.step("transfer at its lock height", fb.mine(byHeight), true)
+	fb.step("block stamped past the lock time, before the median time past reaches it", fb.mine(byTime), false)
+	fb.step("empty block", fb.mine(), true)
+	fb.step("transfer once the median time past reaches its lock time", fb.mine(byTime), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	committing := conformanceGenesis()
+	committing.StateCommitments = true
+	fb = newFixtureBuilder("state-commitments", committing)
+	recommitted := func(b Block, root string) Block {
+		b.stateRoot = root
+		b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+		return b
+	}
+	fb.step("block committing to the state after it", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	transfer := fb.mine(Transaction{payer: "alice", payee: "bob", amt: 2 * COIN, nonce: 1})
+	fb.step("block committing to no state", recommitted(transfer, ""), false)
+	fb.step("block committing to the state before it", recommitted(transfer, fb.bc.state.Root()), false)
+	fb.step("block committing to the state after it, again", transfer, true)
+	fixtures = append(fixtures, fb.fixture)
+
+	blooming := conformanceGenesis()
+	blooming.AddressBlooms = true
+	fb = newFixtureBuilder("address-blooms", blooming)
+	rebloomed := func(b Block, bloom []byte) Block {
+		b.bloom = bloom
+		b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+		return b
+	}
+	fb.step("block carrying the bloom of its accounts", fb.mine(Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 0}), true)
+	toCarol := fb.mine(Transaction{payer: "alice", payee: "carol", amt: 2 * COIN, nonce: 1})
+	fb.step("block carrying no bloom", rebloomed(toCarol, nil), false)
+	toBob := fb.mine(Transaction{payer: "alice", payee: "bob", amt: 2 * COIN, nonce: 1})
+	fb.step("bloom leaving out the payee", rebloomed(toCarol, toBob.bloom), false)
+	fb.step("block carrying the bloom of its accounts, again", toCarol, true)
+	fixtures = append(fixtures, fb.fixture)
+
+	upgrading := conformanceGenesis()
+	upgrading.BlockLimits = &BlockLimits{Bytes: DEFAULT_MAX_BLOCK_BYTES, Txns: 1}
+	upgrading.Upgrades = []Upgrade{
+		{Version: 2, Height: 2, Rules: []RuleSpec{{Rule: RULE_MAX_AMOUNT, Amount: 20 * COIN}}},
+		{Version: 3, Height: 3, BlockLimits: &BlockLimits{Bytes: DEFAULT_MAX_BLOCK_BYTES, Txns: 2}},
+	}
+	fb = newFixtureBuilder("upgrades", upgrading)
+	unversioned := func(b Block) Block {
+		b.version = 0
+		b.mine(fb.bc.difficulty, fb.bc.genesis.Pow)
+		return b
+	}
+	fb.step("version 1 block paying above the cap of version 2", fb.mine(Transaction{payer: "alice", payee: "bob", amt: 30 * COIN, nonce: 0}), true)
+	fb.step("version 2 block paying above its cap", fb.mine(Transaction{payer: "alice", payee: "bob", amt: 30 * COIN, nonce: 1}), false)
+	small := fb.mine(Transaction{payer: "alice", payee: "bob", amt: 5 * COIN, nonce: 1})
+	fb.step("block signalling version 1 at the height of version 2", unversioned(small), false)
+	fb.step("version 2 block of two transactions, above its limit", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: 5 * COIN, nonce: 1},
+		Transaction{payer: "bob", payee: "carol", amt: 5 * COIN, nonce: 0},
+	), false)
+	fb.step("version 2 block within its rules", small, true)
+	fb.step("version 3 block of two transactions, within its limit", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: 5 * COIN, nonce: 2},
+		Transaction{payer: "bob", payee: "carol", amt: 5 * COIN, nonce: 0},
+	), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	governed := conformanceGenesis()
+	governed.Issuance = &IssuanceSpec{Reward: 10 * COIN}
+	governed.Validators = []GenesisValidator{{Name: "alice", Key: alice.PublicKey()}, {Name: "bob", Key: bob.PublicKey()}}
+	governed.Governance = &GovernanceSpec{Admin: "carol", Validators: true, Delay: 2}
+	fb = newFixtureBuilder("governance", governed)
+	fb.step("change less than the delay ahead", fb.mine(NewRewardChange("carol", 0, 20*COIN, 2)), false)
+	fb.step("admin raising the reward from block 3", fb.mine(NewRewardChange("carol", 0, 20*COIN, 3)), true)
+	fb.step("change by an account not governing", fb.mine(NewKVWrite("bob", 0, governanceNamespace("carol"), paramKey(PARAM_REWARD, 9), []byte("0"))), false)
+	fb.step("validator voting one transaction a block from block 5", fb.mine(NewParamChange("alice", 0, PARAM_BLOCK_TXNS, 1, 5)), true)
+	fb.step("block paying the raised reward, with the majority vote", fb.mine(NewParamChange("bob", 0, PARAM_BLOCK_TXNS, 1, 5)), true)
+	fb.step("block of two transactions before the vote holds", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 1},
+		Transaction{payer: "bob", payee: "alice", amt: COIN, nonce: 1},
+	), true)
+	fb.step("block of two transactions once the vote holds", fb.mine(
+		Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 2},
+		Transaction{payer: "bob", payee: "alice", amt: COIN, nonce: 2},
+	), false)
+	fb.step("withdrawal of a change in force", fb.mine(NewKVWrite("carol", 1, governanceNamespace("carol"), paramKey(PARAM_REWARD, 3), nil)), false)
+	fb.step("change of an unknown parameter", fb.mine(NewKVWrite("carol", 1, governanceNamespace("carol"), "gasLimit@9", []byte("1"))), false)
+	fb.step("admin raising the difficulty from block 7", fb.mine(NewParamChange("carol", 1, PARAM_DIFFICULTY, 3, 7)), true)
+	fb.step("last block at the old difficulty", fb.mine(), true)
+	b = fb.mine()
+	b.mine(2, fb.bc.genesis.Pow)
+	fb.step("block at the old difficulty", b, false)
+	fb.step("block at the raised difficulty", fb.mine(), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	stealth, _ := NewStealthWallet("bob")
+	fb = newFixtureBuilder("stealth", conformanceGenesis())
+	paid, _ := NewStealthPayment("alice", 0, stealth.Address(), 10*COIN, ADDRESS_PREFIX)
+	fb.step("payment to a one-time address", fb.mine(paid), true)
+	found := stealth.Scan(*fb.bc.lastBlock(), ADDRESS_PREFIX)[0]
+	raw, _ := carol.rawKey()
+	thief, _ := walletFromRaw(found.Owner, SchemeECDSA, raw)
+	theft, _ := PayUTXO(thief, []UTXO{found.UTXO}, "carol", found.Amt, 0)
+	fb.step("spend of the output with a key not hashing to its address", fb.mine(theft), false)
+	spender, _ := stealth.Spender(found)
+	spend, _ = PayUTXO(spender, []UTXO{found.UTXO}, "carol", found.Amt, 0)
+	fb.step("spend of the output with the one-time key", fb.mine(spend), true)
+	fixtures = append(fixtures, fb.fixture)
+
+	return fixtures
+}
+
+// Regenerate the fixture files in dir from the current rules
+func WriteConformance(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, f := range conformanceFixtures() {
+		raw, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.Name+".json"), append(raw, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
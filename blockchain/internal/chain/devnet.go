@@ -0,0 +1,186 @@
+/*
+ * Devnets.
+ * A node started with -dev runs a chain meant for development: no Proof
+ * Of Work, a funded DEV_ACCOUNT to pay from, every transaction and Block
+ * traced in the log and auto-mining: each transaction admitted is sealed
+ * in a Block before its submission returns, so a client demoing an
+ * application reads its effects right away. Turning auto-mining off lets
+ * transactions wait in the Mempool, eg. to show fee ordering, until a
+ * POST /blocks of the operator, see admin.go, or a -mine Miner seals
+ * them; turning it on seals them.
+ *
+ * In a classroom the difficulty is best tuned while the chain runs, mining
+ * getting too slow or too fast for the lesson. A Block of a devnet chain
+ * may carry a retarget, the difficulty every later Block is mined at. The
+ * change being part of the chain, every node validating it follows it.
+ * Interlocks keep it away from real chains:
+ *
+ *	- the genesis spec must declare the chain a devnet, which changes its
+ *	  genesis hash, so no node mistakes it for another chain
+ *	- only nodes started with -dev accept the request, and only from the
+ *	  operator, bearing the token of -admin-token, see admin.go
+ *	- the difficulty stays within MIN_DEV_DIFFICULTY..MAX_DEV_DIFFICULTY
+ *
+ *	POST /dev/difficulty {"difficulty": 3}  mine a Block retargeting to 3
+ *	POST /dev/automine {"on": false}        stop or start auto-mining
+ */
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const (
+	MIN_DEV_DIFFICULTY = 1
+	MAX_DEV_DIFFICULTY = 6
+)
+
+const (
+	DEV_ACCOUNT = "dev"
+	DEV_FUNDS   = 1_000_000 * COIN
+)
+
+// Genesis of -dev nodes, a devnet of difficulty 0 funding DEV_ACCOUNT
+func DevGenesis() Genesis {
+	g := DefaultGenesis(0)
+	g.ChainID = "devnet"
+	g.DevNet = true
+	g.Alloc = map[string]Amount{DEV_ACCOUNT: DEV_FUNDS}
+	return g
+}
+
+// Check a Header may change the difficulty to retarget, 0 being no change
+func checkRetarget(devnet bool, retarget int) error {
+	if retarget == 0 {
+		return nil
+	}
+	if !devnet {
+		return fmt.Errorf("%w: chain is not a devnet", ErrInvalidRetarget)
+	}
+	if retarget < MIN_DEV_DIFFICULTY || retarget > MAX_DEV_DIFFICULTY {
+		return fmt.Errorf("%w: difficulty %v outside %v..%v", ErrInvalidRetarget, retarget, MIN_DEV_DIFFICULTY, MAX_DEV_DIFFICULTY)
+	}
+	return nil
+}
+
+/*
+ * Mine an empty Block retargeting the chain to difficulty, the Blocks
+ * after it being mined at the new difficulty
+ * Fails with ErrInvalidRetarget unless the chain is a devnet
+ */
+func (bc *BlockChain) SetDifficulty(difficulty int) error {
+	if difficulty == 0 {
+		return fmt.Errorf("%w: difficulty 0", ErrInvalidRetarget)
+	}
+	if err := checkRetarget(bc.genesis.DevNet, difficulty); err != nil {
+		return err
+	}
+	return bc.commitEmpty(difficulty)
+}
+
+// Accept operator requests changing the difficulty, see devnet.go
+func (n *Node) SetDev(on bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.dev = on
+}
+
+func (n *Node) SetDifficulty(difficulty int) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.dev {
+		return ErrDevOnly
+	}
+	if n.primary != "" {
+		return ErrReadReplica
+	}
+	return n.bc.SetDifficulty(difficulty)
+}
+
+/*
+ * Seal a Block on each transaction the Node admits, and right away the
+ * pending ones if on
+ * Fails with ErrDevOnly unless the Node accepts devnet requests, see SetDev
+ */
+func (n *Node) SetAutoMine(on bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.dev {
+		return ErrDevOnly
+	}
+	if n.primary != "" {
+		return ErrReadReplica
+	}
+	n.autoMine = on
+	n.sealPending()
+	return nil
+}
+
+func (n *Node) AutoMine() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.autoMine
+}
+
+// Commit the pending transactions when auto-mining, n.mu held
+func (n *Node) sealPending() {
+	if !n.autoMine {
+		return
+	}
+	if err := n.bc.CommitBlock(); err != nil && !errors.Is(err, ErrEmptyMempool) {
+		log.Printf("dev: auto-mining: %v", err)
+	}
+}
+
+// Log the transactions and Blocks of node as they come
+func traceNode(node *Node) {
+	txns, _ := node.Subscribe(NewTxn)
+	blocks, _ := node.Subscribe(NewBlock)
+	go func() {
+		for {
+			select {
+			case ev := <-txns:
+				log.Printf("dev: txn %v admitted: %+v", ev.Txn.Hash(), *ev.Txn)
+			case ev := <-blocks:
+				log.Printf("dev: block %v sealed at height %v with %v txns, difficulty %v, %v state changes",
+					ev.Block.hash, ev.Height, len(ev.Block.data), ev.Block.difficulty, len(ev.Delta))
+			}
+		}
+	}()
+}
+
+func (s *Server) handleSetDifficulty(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Difficulty int `json:"difficulty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.node.SetDifficulty(req.Difficulty); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	var last jsonBlock
+	s.node.withChain(func(bc *BlockChain) { last = bc.lastBlock().toJSON() })
+	writeJSON(w, http.StatusOK, last)
+}
+
+func (s *Server) handleAutoMine(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		On bool `json:"on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.node.SetAutoMine(req.On); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"autoMine": s.node.AutoMine()})
+}
@@ -0,0 +1,45 @@
+package chain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The devnet controls of the node API are the operator's, bearing the admin token
+func TestDevRoutesNeedToken(t *testing.T) {
+	node := NewNode(NewTestChain(1, DevGenesis()).Chain())
+	node.SetDev(true)
+	node.SetAdminToken("secret")
+	srv := NewServer(node)
+	post := func(path, body, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, c := range []struct {
+		path, body, token string
+		status            int
+	}{
+		{"/dev/difficulty", `{"difficulty": 3}`, "", http.StatusUnauthorized},
+		{"/dev/difficulty", `{"difficulty": 3}`, "guess", http.StatusUnauthorized},
+		{"/dev/automine", `{"on": true}`, "", http.StatusUnauthorized},
+		{"/admin/difficulty", `{"difficulty": 3}`, "secret", http.StatusNotFound},
+		{"/dev/difficulty", `{"difficulty": 3}`, "secret", http.StatusOK},
+		{"/dev/automine", `{"on": true}`, "secret", http.StatusOK},
+	} {
+		if status := post(c.path, c.body, c.token); status != c.status {
+			t.Errorf("POST %v with token %q answered %v, expected %v", c.path, c.token, status, c.status)
+		}
+	}
+	node.withChain(func(bc *BlockChain) {
+		if d := bc.lastBlock().retarget; d != 3 {
+			t.Errorf("retarget %v after the operator set the difficulty to 3", d)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+/*
+ * Order book exchange between assets, driven purely by chain state.
+ * A TxnOrder places a limit order: the funds it may spend are locked in
+ * escrow, and the order is matched against the opposite side of the book
+ * of its asset pair while the Block is applied (price-time priority,
+ * trades execute at the resting order's price). What is left rests in the
+ * book until it is matched by a later order or cancelled by a
+ * TxnCancelOrder, which refunds the remaining escrow.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Trades kept per order book for display
+const MAX_TRADES_PER_BOOK = 100
+
+type OrderSide int
+
+const (
+	Buy  OrderSide = iota // buy base asset, paying with quote asset
+	Sell                  // sell base asset for quote asset
+)
+
+func (side OrderSide) String() string {
+	if side == Buy {
+		return "buy"
+	}
+	return "sell"
+}
+
+type Order struct {
+	id     string // order to cancel, for TxnCancelOrder
+	side   OrderSide
+	base   string // asset bought or sold
+	quote  string // asset the price is expressed in
+	price  Amount // of quote per coin of base
+	amount Amount // units of base
+}
+
+// Order resting in a book
+type bookEntry struct {
+	id        string // hash of the TxnOrder that placed it
+	owner     string
+	side      OrderSide
+	price     Amount
+	remaining Amount // units of base not yet filled
+}
+
+type Trade struct {
+	Buyer  string `json:"buyer"`
+	Seller string `json:"seller"`
+	Price  Amount `json:"price"`
+	Amount Amount `json:"amount"`
+}
+
+type OrderBook struct {
+	base   string
+	quote  string
+	bids   []*bookEntry // best (highest) price first, then oldest first
+	asks   []*bookEntry // best (lowest) price first, then oldest first
+	trades []Trade      // most recent last
+}
+
+func NewOrder(payer string, nonce uint64, side OrderSide, base, quote string, price, amount Amount) Transaction {
+	return Transaction{
+		kind:  TxnOrder,
+		payer: payer,
+		nonce: nonce,
+		order: &Order{side: side, base: base, quote: quote, price: price, amount: amount},
+	}
+}
+
+func NewCancelOrder(payer string, nonce uint64, orderID string) Transaction {
+	return Transaction{
+		kind:  TxnCancelOrder,
+		payer: payer,
+		nonce: nonce,
+		order: &Order{id: orderID},
+	}
+}
+
+func bookKey(base, quote string) string {
+	return base + "/" + quote
+}
+
+func (o *Order) String() string {
+	if o.id != "" {
+		return "cancel " + o.id
+	}
+	return fmt.Sprintf("%v %v%v @ %v%v", o.side, o.amount, assetSuffix(o.base), o.price, assetSuffix(o.quote))
+}
+
+func (o *Order) verify(kind TxnKind) error {
+	if kind == TxnCancelOrder {
+		if o.id == "" {
+			return errors.New("cancel without order id")
+		}
+		return nil
+	}
+	if o.side != Buy && o.side != Sell {
+		return errors.New("unknown order side")
+	}
+	if o.base == o.quote {
+		return errors.New("order base and quote assets are the same")
+	}
+	if !o.price.valid() || !o.amount.valid() {
+		return errors.New("order price and amount must be positive")
+	}
+	if _, err := o.amount.mulDiv(int64(o.price), int64(COIN)); err != nil {
+		return fmt.Errorf("order quote out of range: %w", err)
+	}
+	return nil
+}
+
+// Of quote for qty of base at price, rounded down, in range for quantities of a verified order
+func quoteFor(qty, price Amount) Amount {
+	quote, _ := qty.mulDiv(int64(price), int64(COIN))
+	return quote
+}
+
+// Asset and amount locked in escrow while a quantity of the order is open
+func (e *bookEntry) escrow(book *OrderBook, qty Amount) (string, Amount) {
+	if e.side == Buy {
+		return book.quote, quoteFor(qty, e.price)
+	}
+	return book.base, qty
+}
+
+func (book *OrderBook) clone() *OrderBook {
+	c := &OrderBook{base: book.base, quote: book.quote}
+	for _, e := range book.bids {
+		entry := *e
+		c.bids = append(c.bids, &entry)
+	}
+	for _, e := range book.asks {
+		entry := *e
+		c.asks = append(c.asks, &entry)
+	}
+	c.trades = append(c.trades, book.trades...)
+	return c
+}
+
+func (s *State) orderBook(base, quote string) *OrderBook {
+	key := bookKey(base, quote)
+	if s.books[key] == nil {
+		s.books[key] = &OrderBook{base: base, quote: quote}
+	}
+	return s.books[key]
+}
+
+// Escrow the funds of a new order, match it, and rest what is left
+func (s *State) placeOrder(id, owner string, o *Order) error {
+	book := s.orderBook(o.base, o.quote)
+	taker := &bookEntry{id: id, owner: owner, side: o.side, price: o.price, remaining: o.amount}
+	asset, locked := taker.escrow(book, o.amount)
+	if s.Balance(owner, asset) < locked {
+		return fmt.Errorf("%w: %v lacks %q to place the order", ErrInsufficientFunds, owner, asset)
+	}
+	s.credit(owner, asset, -locked)
+
+	makers := &book.asks
+	crosses := func(maker *bookEntry) bool { return maker.price <= taker.price }
+	if o.side == Sell {
+		makers = &book.bids
+		crosses = func(maker *bookEntry) bool { return maker.price >= taker.price }
+	}
+	for len(*makers) > 0 && taker.remaining > 0 && crosses((*makers)[0]) {
+		maker := (*makers)[0]
+		qty := min(maker.remaining, taker.remaining)
+		buyer, seller := taker, maker
+		if o.side == Sell {
+			buyer, seller = maker, taker
+		}
+		// Trade at the maker's price, refunding a buying taker the difference
+		s.credit(buyer.owner, book.base, qty)
+		s.credit(seller.owner, book.quote, quoteFor(qty, maker.price))
+		if buyer == taker {
+			s.credit(buyer.owner, book.quote, quoteFor(qty, taker.price)-quoteFor(qty, maker.price))
+		}
+		book.trades = append(book.trades, Trade{buyer.owner, seller.owner, maker.price, qty})
+		if len(book.trades) > MAX_TRADES_PER_BOOK {
+			book.trades = book.trades[1:]
+		}
+		maker.remaining -= qty
+		taker.remaining -= qty
+		if maker.remaining <= 0 {
+			*makers = (*makers)[1:]
+		}
+	}
+	if taker.remaining > 0 {
+		book.rest(taker)
+	}
+	return nil
+}
+
+// Insert an entry keeping price-time priority
+func (book *OrderBook) rest(e *bookEntry) {
+	entries := &book.bids
+	better := func(other *bookEntry) bool { return other.price < e.price }
+	if e.side == Sell {
+		entries = &book.asks
+		better = func(other *bookEntry) bool { return other.price > e.price }
+	}
+	i := sort.Search(len(*entries), func(i int) bool { return better((*entries)[i]) })
+	*entries = append(*entries, nil)
+	copy((*entries)[i+1:], (*entries)[i:])
+	(*entries)[i] = e
+}
+
+// Remove an open order of owner and refund its remaining escrow
+func (s *State) cancelOrder(owner, id string) error {
+	for _, book := range s.books {
+		for _, entries := range []*[]*bookEntry{&book.bids, &book.asks} {
+			for i, e := range *entries {
+				if e.id != id {
+					continue
+				}
+				if e.owner != owner {
+					return fmt.Errorf("order %v is not owned by %v", id, owner)
+				}
+				asset, locked := e.escrow(book, e.remaining)
+				s.credit(owner, asset, locked)
+				*entries = append((*entries)[:i], (*entries)[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no open order %v", id)
+}
+
+type jsonBookEntry struct {
+	ID        string `json:"id"`
+	Owner     string `json:"owner"`
+	Price     Amount `json:"price"`
+	Remaining Amount `json:"remaining"`
+}
+
+type jsonOrderBook struct {
+	Base   string          `json:"base"`
+	Quote  string          `json:"quote"`
+	Bids   []jsonBookEntry `json:"bids"`
+	Asks   []jsonBookEntry `json:"asks"`
+	Trades []Trade         `json:"trades"`
+}
+
+func (book *OrderBook) toJSON() jsonOrderBook {
+	j := jsonOrderBook{
+		Base:   book.base,
+		Quote:  book.quote,
+		Bids:   []jsonBookEntry{},
+		Asks:   []jsonBookEntry{},
+		Trades: append([]Trade{}, book.trades...),
+	}
+	for _, e := range book.bids {
+		j.Bids = append(j.Bids, jsonBookEntry{e.id, e.owner, e.price, e.remaining})
+	}
+	for _, e := range book.asks {
+		j.Asks = append(j.Asks, jsonBookEntry{e.id, e.owner, e.price, e.remaining})
+	}
+	return j
+}
+
+// Snapshot of the order book of an asset pair after the last committed Block
+func (bc *BlockChain) OrderBook(base, quote string) jsonOrderBook {
+	book, ok := bc.state.books[bookKey(base, quote)]
+	if !ok {
+		book = &OrderBook{base: base, quote: quote}
+	}
+	return book.toJSON()
+}
@@ -0,0 +1,110 @@
+/*
+ * Human and machine readable dumps of Blocks and BlockChains.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type DisplayFormat int
+
+const (
+	DisplayText    DisplayFormat = iota // multi-line text, one section per Block
+	DisplayJSON                         // indented JSON, as served by the API
+	DisplayCompact                      // one line per Block
+)
+
+func ParseDisplayFormat(name string) (DisplayFormat, error) {
+	switch name {
+	case "text":
+		return DisplayText, nil
+	case "json":
+		return DisplayJSON, nil
+	case "compact":
+		return DisplayCompact, nil
+	}
+	return 0, fmt.Errorf("unknown display format %q, want text, json or compact", name)
+}
+
+// Writer remembering the first write error, so a dump checks it once
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+func writeIndentedJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (b Block) PrettyDisplay(w io.Writer, format DisplayFormat) error {
+	return b.prettyDisplay(w, format, -1, nil)
+}
+
+/*
+ * Display the Block, annotating amounts with fiat values if oracle is set
+ * height is shown in the compact format when not negative
+ */
+func (b Block) prettyDisplay(w io.Writer, format DisplayFormat, height int, oracle *PriceOracle) error {
+	ew := &errWriter{w: w}
+	switch format {
+	case DisplayJSON:
+		return writeIndentedJSON(w, b.toJSON())
+	case DisplayCompact:
+		if height >= 0 {
+			ew.printf("#%v ", height)
+		}
+		ew.printf("%v prev:%.12v txns:%v miner:%v ts:%v\n", b.hash, b.prevHash, len(b.data), b.miner, b.unixTs)
+		return ew.err
+	}
+	ew.printf("\n\nBlock: ")
+	for _, txn := range b.data {
+		ew.printf("\n%+v", txn)
+		if oracle != nil && txn.kind == TxnTransfer && txn.asset == NATIVE_ASSET {
+			ew.printf("%v", oracle.annotation(txn.transferTotal(), b.unixTs))
+		}
+	}
+	ew.printf("\nnonce: %v", b.nonce)
+	ew.printf("\nprevHash: %v", b.prevHash)
+	ew.printf("\nmerkleRoot: %v", b.merkleRoot)
+	ew.printf("\ndifficulty: %v", b.difficulty)
+	if b.retarget != 0 {
+		ew.printf("\nretarget: %v", b.retarget)
+	}
+	ew.printf("\nminer: %v", b.miner)
+	ew.printf("\nunixTimestamp: %v", b.unixTs)
+	ew.printf("\nHash: %v", b.hash)
+	ew.printf("\n\t\t|\n\t\t|\n\t\tv")
+	return ew.err
+}
+
+func (bc BlockChain) PrettyDisplay(w io.Writer, format DisplayFormat) error {
+	if format == DisplayJSON {
+		return writeIndentedJSON(w, bc.toJSON())
+	}
+	ew := &errWriter{w: w}
+	if format == DisplayCompact {
+		ew.printf("chain %v difficulty %v height %v\n", bc.ChainID(), bc.difficulty, bc.blocks.Len()-1)
+	} else {
+		ew.printf("\n--------- BlockChain Start -----------\n")
+		ew.printf("Chain ID: %v\n", bc.ChainID())
+		ew.printf("Proof Of Work Diffculty: %v (no. of leading 0s in the hash)", bc.difficulty)
+	}
+	for height := 0; height < bc.blocks.Len() && ew.err == nil; height++ {
+		ew.err = bc.blockAt(height).prettyDisplay(w, format, height, bc.oracle)
+	}
+	if format == DisplayText {
+		ew.printf("\n\n--------- BlockChain End -----------\n\n")
+	}
+	return ew.err
+}
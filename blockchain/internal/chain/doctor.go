@@ -0,0 +1,258 @@
+/*
+ * Node self-diagnostics.
+ * Diagnose checks a node the way an operator would when something looks
+ * off, and reports the problems found from the most to the least serious,
+ * each with a suggested fix, along with a health score:
+ *
+ *	storage  every stored Block reads back, validates from genesis on and
+ *	         leads to the state the node holds
+ *	clock    the local clock agrees with the last Block and with the peers
+ *	peers    the peers answer, share our genesis and are not far ahead
+ *	mempool  no backlog, no transactions stuck behind a nonce gap
+ *	config   difficulty, miner and devnet settings make sense together
+ */
+package chain
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	MAX_CLOCK_SKEW = 2 * time.Minute // tolerated gap between clocks
+	MAX_PEER_LEAD  = 10              // Blocks a peer may be ahead before we count as behind
+)
+
+type Severity int
+
+const (
+	Critical Severity = iota // the node serves wrong data or cannot work
+	Warning                  // the node works but needs attention
+	Notice                   // worth knowing, nothing to fix
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Critical:
+		return "CRITICAL"
+	case Warning:
+		return "WARNING"
+	}
+	return "NOTICE"
+}
+
+type Finding struct {
+	Severity Severity
+	Check    string // storage, clock, peers, mempool or config
+	Problem  string
+	Fix      string
+}
+
+type DoctorReport struct {
+	Findings []Finding // most serious first
+	Score    int       // 100 for a healthy node, down to 0
+}
+
+type DoctorConfig struct {
+	Peers []string // node API URLs the node talks to
+	Dev   bool     // node runs with -dev
+}
+
+// Check bc and its surroundings, see doctor.go
+func Diagnose(bc *BlockChain, config DoctorConfig) DoctorReport {
+	var report DoctorReport
+	add := func(severity Severity, check, fix, format string, args ...any) {
+		report.Findings = append(report.Findings, Finding{severity, check, fmt.Sprintf(format, args...), fix})
+	}
+	bc.checkStorage(add)
+	bc.checkClock(add)
+	bc.checkPeers(config.Peers, add)
+	bc.checkMempool(add)
+	bc.checkConfig(config, add)
+
+	slices.SortStableFunc(report.Findings, func(a, b Finding) int { return int(a.Severity - b.Severity) })
+	report.Score = 100
+	for _, f := range report.Findings {
+		report.Score -= map[Severity]int{Critical: 40, Warning: 10, Notice: 1}[f.Severity]
+	}
+	report.Score = max(report.Score, 0)
+	return report
+}
+
+type addFinding func(severity Severity, check, fix, format string, args ...any)
+
+// Rebuild the chain from the stored Blocks and compare with the live state
+func (bc *BlockChain) checkStorage(add addFinding) {
+	const rebuild = "rebuild the chain with -recover, fetching bad blocks from a healthy node with -peer"
+	fresh := CreateBlockChain(bc.genesis)
+	fresh.checkpoints = bc.checkpoints
+	for height := 0; height < bc.blocks.Len(); height++ {
+		b, err := bc.blocks.Get(height)
+		if err != nil {
+			add(Critical, "storage", rebuild, "block %v cannot be read: %v", height, err)
+			return
+		}
+		if height == 0 {
+			if b.hash != fresh.GenesisHash() {
+				add(Critical, "storage", rebuild, "stored genesis %v does not match the genesis spec %v", b.hash, fresh.GenesisHash())
+				return
+			}
+			continue
+		}
+		if err := fresh.appendBlock(b); err != nil {
+			add(Critical, "storage", rebuild, "block %v fails validation: %v", height, err)
+			return
+		}
+	}
+	if fresh.state.Root() != bc.state.Root() {
+		add(Critical, "storage", "restart the node so the state is replayed from the blocks",
+			"state root %v differs from %v replayed from the blocks", bc.state.Root(), fresh.state.Root())
+	}
+}
+
+func (bc *BlockChain) checkClock(add addFinding) {
+	if bc.blocks.Len() == 1 {
+		return
+	}
+	last := time.UnixMicro(bc.lastBlock().unixTs)
+	if skew := time.Until(last); skew > MAX_CLOCK_SKEW {
+		add(Critical, "clock", "sync the system clock with NTP",
+			"last block is %v in the future, the local clock is behind", skew.Round(time.Second))
+	} else if idle := -skew; idle > 24*time.Hour {
+		add(Notice, "clock", "start a miner with -mine if the chain should grow",
+			"no block for %v", idle.Round(time.Minute))
+	}
+}
+
+func (bc *BlockChain) checkPeers(peers []string, add addFinding) {
+	if len(peers) == 0 {
+		add(Notice, "peers", "pass -relay-peers or -sync to connect to other nodes", "no peers configured")
+		return
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	reachable := 0
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(peer, "/")
+		resp, err := client.Get(peer + "/genesis")
+		if err != nil {
+			add(Warning, "peers", "check the URL and that the peer is up", "peer %v unreachable: %v", peer, err)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		reachable++
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			// Date has a 1s resolution
+			if skew := time.Since(date).Abs(); skew > MAX_CLOCK_SKEW {
+				add(Warning, "clock", "sync the clocks of both machines with NTP",
+					"clock differs by %v from peer %v", skew.Round(time.Second), peer)
+			}
+		}
+		p := newPeerClient(peer)
+		_, hash, err := p.genesis()
+		if err != nil {
+			add(Warning, "peers", "check the peer runs a node API", "peer %v: %v", peer, err)
+			continue
+		}
+		if hash != bc.GenesisHash() {
+			add(Critical, "peers", "remove the peer, it follows another chain",
+				"peer %v has genesis %v, expected %v", peer, hash, bc.GenesisHash())
+			continue
+		}
+		var tip []jsonBlockSummary
+		if _, err := p.get("/blocks?limit=1", &tip); err == nil && len(tip) == 1 {
+			if lead := tip[0].Height - (bc.blocks.Len() - 1); lead > MAX_PEER_LEAD {
+				add(Warning, "peers", "catch up with -sync "+peer, "peer %v is %v blocks ahead", peer, lead)
+			}
+		}
+	}
+	if reachable == 0 {
+		add(Critical, "peers", "check the network connection", "none of the %v peers is reachable", len(peers))
+	}
+}
+
+func (bc *BlockChain) checkMempool(add addFinding) {
+	pending := bc.mempool.ordered()
+	if held, _ := packed(bc.blockLimits(), pending, 2); held < len(pending) {
+		add(Warning, "mempool", "mine more often, eg. with -mine",
+			"%v pending transactions, more than 2 blocks worth", len(pending))
+	}
+	for _, account := range sortedKeys(bc.mempool.queued) {
+		if gap := bc.mempool.NonceGap(account); len(gap) > 0 {
+			add(Warning, "mempool", "submit the missing nonces or resubmit the transactions",
+				"%v transactions of %v stuck behind missing nonces %v", len(bc.mempool.queued[account]), account, gap)
+		}
+	}
+	for _, txn := range bc.mempool.pending {
+		if txn.nonce < bc.state.nonce(txn.payer) {
+			add(Warning, "mempool", "restart the node to drop it",
+				"pending transaction %v reuses committed nonce %v of %v", txn.Hash(), txn.nonce, txn.payer)
+		}
+	}
+}
+
+func (bc *BlockChain) checkConfig(config DoctorConfig, add addFinding) {
+	if bc.difficulty == 0 && !bc.genesis.DevNet {
+		add(Warning, "config", "set a difficulty in the genesis spec, or declare it a devnet",
+			"chain %v has no proof of work", bc.ChainID())
+	}
+	if bc.difficulty >= 6 {
+		add(Notice, "config", "lower the difficulty of the genesis spec for demos",
+			"difficulty %v makes every block take minutes to mine", bc.difficulty)
+	}
+	if bc.miner == "" {
+		add(Warning, "config", "set -miner", "no miner account, block fees go to the empty account")
+	}
+	if config.Dev && !bc.genesis.DevNet {
+		add(Warning, "config", "drop -genesis to run the dev genesis, or drop -dev",
+			"-dev on chain %v which is not a devnet, difficulty changes will be refused", bc.ChainID())
+	}
+	if bc.genesis.DevNet && !config.Dev {
+		add(Notice, "config", "", "chain %v is a devnet", bc.ChainID())
+	}
+}
+
+/*
+ * Print the report, only the score in quiet mode, returning the exit code,
+ * 1 if anything is critical
+ */
+func printDoctorReport(out *Output, report DoctorReport) int {
+	type jsonFinding struct {
+		Severity string `json:"severity"`
+		Check    string `json:"check"`
+		Problem  string `json:"problem"`
+		Fix      string `json:"fix,omitempty"`
+	}
+	view := struct {
+		Score    int           `json:"score"`
+		Findings []jsonFinding `json:"findings"`
+	}{report.Score, []jsonFinding{}}
+	code, rows := 0, [][]string{}
+	for _, f := range report.Findings {
+		view.Findings = append(view.Findings, jsonFinding{f.Severity.String(), f.Check, f.Problem, f.Fix})
+		rows = append(rows, []string{f.Severity.String(), f.Check, f.Problem, f.Fix})
+		if f.Severity == Critical {
+			code = 1
+		}
+	}
+	var err error
+	switch {
+	case out.mode == OutputQuiet:
+		err = out.Record([][2]string{{"score", fmt.Sprint(report.Score)}}, view)
+	case out.mode == OutputJSON || out.mode == OutputCSV || len(rows) > 0:
+		out.Note("health %v/100", report.Score)
+		err = out.Table([]string{"severity", "check", "problem", "fix"}, rows, view)
+	default:
+		out.Note("health %v/100\nno problems found", report.Score)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,576 @@
+/*
+ * Storage engines.
+ * The cold storage of the tiered store, see store.go, is any ObjectStore.
+ * A Store is one that also writes batches all or none and iterates over
+ * its keys in order; -store picks the engine, the tiered store then
+ * committing each Block with its index entries and state root as one
+ * batch, see wal.go, without a separate write-ahead log:
+ *
+ *	memory  a map, gone with the process, for tests and demos
+ *	file    a compressed file per key in -cold-dir, next to a journal
+ *	        making batches atomic; easy to look into, slow to sync
+ *	log     a single file in -cold-dir appending a checksummed record per
+ *	        batch, with an index of the keys in memory; a record cut
+ *	        short by a crash is dropped on open, and the file compacted
+ *	        once mostly overwritten
+ *	bolt    a BoltDB file in -cold-dir, go.etcd.io/bbolt, each batch one
+ *	        synced transaction of its copy-on-write B+tree; keys stay on
+ *	        disk rather than in memory, for chains outgrowing the log
+ */
+package chain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Storage engines of -store
+const (
+	STORE_MEMORY = "memory"
+	STORE_FILE   = "file"
+	STORE_LOG    = "log"
+	STORE_BOLT   = "bolt"
+)
+
+var STORE_ENGINES = []string{STORE_MEMORY, STORE_FILE, STORE_LOG, STORE_BOLT}
+
+const (
+	STORE_JOURNAL       = "journal"       // of the file engine, in its directory
+	STORE_LOG_FILE      = "store.db"      // of the log engine, in its directory
+	STORE_BOLT_FILE     = "store.bolt"    // of the bolt engine, in its directory
+	STORE_BOLT_BUCKET   = "objects"       // holding every key of the bolt engine
+	STORE_BOLT_TIMEOUT  = 5 * time.Second // waited for the lock of a BoltDB file another process holds
+	STORE_COMPACT_BYTES = 1 << 20         // overwritten bytes left in the log file before compacting it
+)
+
+// ObjectStore writing batches all or none and iterating over its keys
+type Store interface {
+	ObjectStore
+	Apply(batch []walOp) error // all or none, deletions of missing keys being no-ops
+	// Call f on the keys starting with prefix in order, and their data, until it fails; writes of an open batch are left out
+	Scan(prefix string, f func(key string, data []byte) error) error
+	Close() error
+}
+
+// Store of engine, in the directory dir unless held in memory
+func OpenStore(engine, dir string) (Store, error) {
+	if engine != STORE_MEMORY && dir == "" {
+		return nil, fmt.Errorf("the %v storage engine needs a directory", engine)
+	}
+	switch engine {
+	case STORE_MEMORY:
+		return NewMemoryEngine(), nil
+	case STORE_FILE:
+		return openFileEngine(dir)
+	case STORE_LOG:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return openLogEngine(filepath.Join(dir, STORE_LOG_FILE))
+	case STORE_BOLT:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return openBoltEngine(filepath.Join(dir, STORE_BOLT_FILE))
+	}
+	return nil, fmt.Errorf("unknown storage engine %q, expected %v", engine, strings.Join(STORE_ENGINES, ", "))
+}
+
+type memoryEngine struct {
+	batching
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+func NewMemoryEngine() Store {
+	s := &memoryEngine{objects: map[string][]byte{}}
+	s.batching.apply = s.Apply
+	return s
+}
+
+func (s *memoryEngine) Put(key string, data []byte) error {
+	return s.write(walOp{Key: key, Data: data})
+}
+
+func (s *memoryEngine) Get(key string) ([]byte, error) {
+	return s.read(key, func(key string) ([]byte, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		data, ok := s.objects[key]
+		if !ok {
+			return nil, fmt.Errorf("%v: %w", key, os.ErrNotExist)
+		}
+		return data, nil
+	})
+}
+
+func (s *memoryEngine) Delete(key string) error {
+	return s.write(walOp{Key: key, Delete: true})
+}
+
+func (s *memoryEngine) Apply(batch []walOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range batch {
+		if op.Delete {
+			delete(s.objects, op.Key)
+		} else {
+			s.objects[op.Key] = slices.Clone(op.Data)
+		}
+	}
+	return nil
+}
+
+func (s *memoryEngine) Scan(prefix string, f func(key string, data []byte) error) error {
+	s.mu.RLock()
+	keys := []string{}
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+	slices.Sort(keys)
+	for _, key := range keys {
+		data, err := s.Get(key)
+		if errors.Is(err, os.ErrNotExist) {
+			// Deleted meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryEngine) Close() error {
+	return nil
+}
+
+// Compressed files of DirObjectStore, written through a write-ahead log
+type fileEngine struct {
+	batching
+	dir     string
+	files   *DirObjectStore
+	journal *LoggedObjectStore
+}
+
+func openFileEngine(dir string) (*fileEngine, error) {
+	files, err := NewDirObjectStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	journal, redone, err := OpenLoggedObjectStore(files, filepath.Join(dir, STORE_JOURNAL))
+	if err != nil {
+		return nil, err
+	}
+	if redone > 0 {
+		log.Printf("store: redid %v writes of a batch interrupted by a crash", redone)
+	}
+	s := &fileEngine{dir: dir, files: files, journal: journal}
+	s.batching.apply = s.Apply
+	return s, nil
+}
+
+func (s *fileEngine) Put(key string, data []byte) error {
+	return s.write(walOp{Key: key, Data: data})
+}
+
+func (s *fileEngine) Get(key string) ([]byte, error) {
+	return s.read(key, s.files.Get)
+}
+
+func (s *fileEngine) Delete(key string) error {
+	return s.write(walOp{Key: key, Delete: true})
+}
+
+func (s *fileEngine) Apply(batch []walOp) error {
+	return s.journal.logAndApply(batch)
+}
+
+func (s *fileEngine) Scan(prefix string, f func(key string, data []byte) error) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	// Sorted by file name, so by key
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".gz")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		data, err := s.files.Get(key)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileEngine) Close() error {
+	return s.journal.Close()
+}
+
+// Place of the data of a key in the file of the log engine
+type logSpan struct {
+	offset int64
+	size   int
+}
+
+/*
+ * Single file of records, one per batch, each a big-endian uint32 size
+ * and CRC-32 of the payload, then the payload: per write, a byte 1 for a
+ * deletion or 0, the key and the data, each after its length as a uvarint
+ */
+type logEngine struct {
+	batching
+	path  string
+	mu    sync.RWMutex
+	file  *os.File
+	size  int64              // of the records written whole
+	index map[string]logSpan // data of every key
+	dead  int64              // bytes of data overwritten or deleted
+}
+
+func openLogEngine(path string) (*logEngine, error) {
+	s := &logEngine{path: path}
+	s.batching.apply = s.Apply
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	var live int64
+	for _, span := range s.index {
+		live += int64(span.size)
+	}
+	if s.dead > STORE_COMPACT_BYTES && s.dead > live {
+		if err := s.compact(); err != nil {
+			s.file.Close()
+			return nil, fmt.Errorf("compacting %v: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// Open the file and index its records, dropping the one a crash cut short if any
+func (s *logEngine) open() error {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size, s.index, s.dead = f, 0, map[string]logSpan{}, 0
+	for len(raw[s.size:]) >= 8 {
+		record := raw[s.size:]
+		size := int64(binary.BigEndian.Uint32(record))
+		if int64(len(record)-8) < size || crc32.ChecksumIEEE(record[8:8+size]) != binary.BigEndian.Uint32(record[4:]) {
+			break
+		}
+		batch, spans, err := decodeLogRecord(record[8 : 8+size])
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%v at %v: %w", s.path, s.size, err)
+		}
+		s.indexRecord(batch, spans, s.size+8)
+		s.size += 8 + size
+	}
+	if s.size < int64(len(raw)) {
+		log.Printf("store: dropping %v bytes of %v cut short by a crash", int64(len(raw))-s.size, s.path)
+		if err := f.Truncate(s.size); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Index the writes of batch, the record of which holds their data at spans from offset on
+func (s *logEngine) indexRecord(batch []walOp, spans []logSpan, offset int64) {
+	for i, op := range batch {
+		if old, ok := s.index[op.Key]; ok {
+			s.dead += int64(old.size)
+		}
+		if op.Delete {
+			delete(s.index, op.Key)
+		} else {
+			s.index[op.Key] = logSpan{offset: offset + spans[i].offset, size: spans[i].size}
+		}
+	}
+}
+
+// Payload of the record of batch, and where it holds the data of each write
+func encodeLogRecord(batch []walOp) ([]byte, []logSpan) {
+	var payload []byte
+	spans := make([]logSpan, len(batch))
+	for i, op := range batch {
+		kind := byte(0)
+		if op.Delete {
+			kind = 1
+		}
+		payload = append(payload, kind)
+		payload = binary.AppendUvarint(payload, uint64(len(op.Key)))
+		payload = append(payload, op.Key...)
+		payload = binary.AppendUvarint(payload, uint64(len(op.Data)))
+		spans[i] = logSpan{offset: int64(len(payload)), size: len(op.Data)}
+		payload = append(payload, op.Data...)
+	}
+	record := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+	return append(record, payload...), spans
+}
+
+func decodeLogRecord(payload []byte) ([]walOp, []logSpan, error) {
+	var batch []walOp
+	var spans []logSpan
+	field := func(at int) ([]byte, int, error) {
+		size, n := binary.Uvarint(payload[at:])
+		if n <= 0 || uint64(len(payload)-at-n) < size {
+			return nil, 0, errors.New("malformed record")
+		}
+		return payload[at+n : at+n+int(size)], at + n + int(size), nil
+	}
+	for at := 0; at < len(payload); {
+		op := walOp{Delete: payload[at] == 1}
+		key, next, err := field(at + 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, end, err := field(next)
+		if err != nil {
+			return nil, nil, err
+		}
+		op.Key, op.Data = string(key), data
+		batch = append(batch, op)
+		spans = append(spans, logSpan{offset: int64(end - len(data)), size: len(data)})
+		at = end
+	}
+	return batch, spans, nil
+}
+
+func (s *logEngine) Put(key string, data []byte) error {
+	return s.write(walOp{Key: key, Data: data})
+}
+
+func (s *logEngine) Get(key string) ([]byte, error) {
+	return s.read(key, func(key string) ([]byte, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		span, ok := s.index[key]
+		if !ok {
+			return nil, fmt.Errorf("%v: %w", key, os.ErrNotExist)
+		}
+		data := make([]byte, span.size)
+		if _, err := s.file.ReadAt(data, span.offset); err != nil {
+			return nil, fmt.Errorf("reading %v: %w", key, err)
+		}
+		return data, nil
+	})
+}
+
+func (s *logEngine) Delete(key string) error {
+	return s.write(walOp{Key: key, Delete: true})
+}
+
+// Append the record of batch and sync it, the writes taking effect once it is on disk
+func (s *logEngine) Apply(batch []walOp) error {
+	record, spans := encodeLogRecord(batch)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		s.file.Truncate(s.size)
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.indexRecord(batch, spans, s.size+8)
+	s.size += int64(len(record))
+	return nil
+}
+
+func (s *logEngine) Scan(prefix string, f func(key string, data []byte) error) error {
+	s.mu.RLock()
+	keys := []string{}
+	for key := range s.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.RUnlock()
+	slices.Sort(keys)
+	for _, key := range keys {
+		data, err := s.Get(key)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrite the file with the live data alone, replacing it once synced
+func (s *logEngine) compact() error {
+	tmp := s.path + ".compact"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	w := bufio.NewWriter(f)
+	err = s.Scan("", func(key string, data []byte) error {
+		record, _ := encodeLogRecord([]walOp{{Key: key, Data: data}})
+		_, err := w.Write(record)
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file.Close()
+	return s.open()
+}
+
+func (s *logEngine) Close() error {
+	return s.file.Close()
+}
+
+// Keys in a single bucket of a BoltDB file
+type boltEngine struct {
+	batching
+	db *bolt.DB
+}
+
+func openBoltEngine(path string) (*boltEngine, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: STORE_BOLT_TIMEOUT})
+	if err != nil {
+		return nil, fmt.Errorf("opening %v: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(STORE_BOLT_BUCKET))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &boltEngine{db: db}
+	s.batching.apply = s.Apply
+	return s, nil
+}
+
+func (s *boltEngine) Put(key string, data []byte) error {
+	return s.write(walOp{Key: key, Data: data})
+}
+
+func (s *boltEngine) Get(key string) ([]byte, error) {
+	return s.read(key, func(key string) ([]byte, error) {
+		var data []byte
+		err := s.db.View(func(tx *bolt.Tx) error {
+			// Values are only valid during the transaction
+			v := tx.Bucket([]byte(STORE_BOLT_BUCKET)).Get([]byte(key))
+			if v == nil {
+				return fmt.Errorf("%v: %w", key, os.ErrNotExist)
+			}
+			data = slices.Clone(v)
+			return nil
+		})
+		return data, err
+	})
+}
+
+func (s *boltEngine) Delete(key string) error {
+	return s.write(walOp{Key: key, Delete: true})
+}
+
+// Apply batch in a single transaction, synced on commit
+func (s *boltEngine) Apply(batch []walOp) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(STORE_BOLT_BUCKET))
+		for _, op := range batch {
+			var err error
+			if op.Delete {
+				err = b.Delete([]byte(op.Key))
+			} else {
+				err = b.Put([]byte(op.Key), op.Data)
+			}
+			if err != nil {
+				return fmt.Errorf("%v: %w", op.Key, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltEngine) Scan(prefix string, f func(key string, data []byte) error) error {
+	// f may write to the store, which it cannot within a read transaction
+	keys := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(STORE_BOLT_BUCKET)).Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		data, err := s.Get(key)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *boltEngine) Close() error {
+	return s.db.Close()
+}
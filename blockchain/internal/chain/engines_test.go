@@ -0,0 +1,180 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Batches of the crash tests, the last one torn
+var crashBatches = [][]walOp{
+	{{Key: "block-1", Data: []byte("first")}, {Key: "state-1", Data: []byte("root 1")}},
+	{{Key: "block-2", Data: []byte("second")}, {Key: "state-2", Data: []byte("root 2")}, {Key: "block-1", Delete: true}},
+	{{Key: "block-3", Data: bytes.Repeat([]byte("third"), 100)}, {Key: "state-3", Data: []byte("root 3")}, {Key: "block-2", Delete: true}},
+}
+
+// Log file holding crashBatches, and the size of its records before the last
+func writeCrashLog(t *testing.T) (string, int64) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), STORE_LOG_FILE)
+	s, err := openLogEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var before int64
+	for _, batch := range crashBatches {
+		before = s.size
+		if err := s.Apply(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path, before
+}
+
+// Check s holds the writes of the first two crashBatches and none of the last
+func checkBeforeLastBatch(t *testing.T, s Store) {
+	t.Helper()
+	want := map[string]string{"block-2": "second", "state-1": "root 1", "state-2": "root 2"}
+	for key, data := range want {
+		if got, err := s.Get(key); err != nil || string(got) != data {
+			t.Errorf("%v is %q, %v, expected %q", key, got, err, data)
+		}
+	}
+	for _, key := range []string{"block-1", "block-3", "state-3"} {
+		if _, err := s.Get(key); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%v: got %v, expected it missing", key, err)
+		}
+	}
+}
+
+// A crash cutting the last record short at any byte loses its batch whole, and the rest not
+func TestLogEngineTornBatch(t *testing.T) {
+	path, before := writeCrashLog(t)
+	whole, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size := before; size < int64(len(whole)); size++ {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			if err := os.WriteFile(path, whole[:size], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := openLogEngine(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			checkBeforeLastBatch(t, s)
+			// The torn record is gone from the file, the next batch applying after the others
+			if info, err := os.Stat(path); err != nil || info.Size() != before {
+				t.Fatalf("file of %v bytes after opening, expected %v", info.Size(), before)
+			}
+			if err := s.Apply([]walOp{{Key: "block-3", Data: []byte("again")}}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// A last record corrupted on disk fails its checksum and is dropped like a torn one
+func TestLogEngineCorruptBatch(t *testing.T) {
+	path, before := writeCrashLog(t)
+	whole, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []int64{before + 4, before + 8, before + 20, int64(len(whole)) - 1} {
+		corrupt := bytes.Clone(whole)
+		corrupt[at] ^= 0x40
+		if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := openLogEngine(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkBeforeLastBatch(t, s)
+		s.Close()
+	}
+}
+
+// Compaction keeps the live data, and a compaction cut short by a crash leaves the log as it was
+func TestLogEngineCompaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, STORE_LOG_FILE)
+	s, err := openLogEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte{1}, 64<<10)
+	for i := range 2 * STORE_COMPACT_BYTES / len(data) {
+		if err := s.Apply([]walOp{{Key: "overwritten", Data: data}, {Key: fmt.Sprintf("kept-%02d", i%4), Data: []byte(fmt.Sprint(i))}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	// Left behind by a crash during an earlier compaction
+	if err := os.WriteFile(path+".compact", []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(path)
+	if s, err = openLogEngine(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size()/4 {
+		t.Errorf("log of %v bytes compacted to %v", before.Size(), after.Size())
+	}
+	if got, err := s.Get("overwritten"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("overwritten key lost: %v", err)
+	}
+	keys := []string{}
+	if err := s.Scan("kept-", func(key string, _ []byte) error { keys = append(keys, key); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[kept-00 kept-01 kept-02 kept-03]" {
+		t.Errorf("kept keys %v", keys)
+	}
+}
+
+// Every engine applies batches whole and scans its keys in order
+func TestStoreEngines(t *testing.T) {
+	for _, engine := range STORE_ENGINES {
+		t.Run(engine, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := OpenStore(engine, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, batch := range crashBatches[:2] {
+				if err := s.Apply(batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			checkBeforeLastBatch(t, s)
+			keys := []string{}
+			if err := s.Scan("", func(key string, _ []byte) error { keys = append(keys, key); return nil }); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(keys) != "[block-2 state-1 state-2]" {
+				t.Errorf("scanned %v", keys)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if engine == STORE_MEMORY {
+				return
+			}
+			if s, err = OpenStore(engine, dir); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			checkBeforeLastBatch(t, s)
+		})
+	}
+}
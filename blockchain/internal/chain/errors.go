@@ -0,0 +1,103 @@
+/*
+ * Errors of the API.
+ * Failures wrap one of these values along with the details (account,
+ * nonce, Block hash...), so callers tell them apart with errors.Is.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// Transaction admission and validation
+	ErrInvalidTxn        = errors.New("invalid transaction") // malformed, fails the stateless checks
+	ErrInvalidSignature  = errors.New("invalid signature")   // missing, wrong or made with a key the signer does not own
+	ErrScriptFailed      = errors.New("script failed")
+	ErrInvalidNonce      = errors.New("invalid nonce")                        // not the next nonce of the payer
+	ErrNonceTaken        = errors.New("nonce taken by a pending transaction") // double spend attempt in the Mempool
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrOutOfGas          = errors.New("out of gas")
+	ErrFeeAsset          = errors.New("fees not payable in this asset")                        // see feeassets.go
+	ErrWrongChain        = errors.New("transaction is not for this chain")                     // see chainid.go
+	ErrTokenExists       = errors.New("token symbol already in use")                           // see tokens.go
+	ErrLocked            = errors.New("transaction is time-locked")                            // see timelocks.go
+	ErrFeeTooLow         = errors.New("fee below the mempool floor")                           // see mempoollimits.go
+	ErrPolicy            = errors.New("transaction refused by the policy of this node")        // see policy.go
+	ErrUnderpriced       = errors.New("replacement pays too little over the transaction held") // see replace.go
+
+	// Block validation
+	ErrBlockFull         = errors.New("block size or gas limit exceeded")
+	ErrInvalidPrevHash   = errors.New("block does not extend the last block")
+	ErrInvalidBlockHash  = errors.New("invalid block hash")
+	ErrInvalidMerkleRoot = errors.New("transactions do not match the merkle root")
+	ErrInsufficientWork  = errors.New("block does not meet the difficulty")
+	ErrWrongDifficulty   = errors.New("block records a difficulty other than the chain's") // see retarget.go
+	ErrCheckpoint        = errors.New("block does not match the checkpoint")
+	ErrInvalidProof      = errors.New("transaction is not proven part of the block")
+	ErrInvalidRetarget   = errors.New("difficulty change not allowed")
+	ErrInvalidAddress    = errors.New("invalid address") // malformed, or of another network
+	ErrLighterBranch     = errors.New("branch carries no more work than the chain")
+	ErrRuleViolation     = errors.New("transaction refused by a rule of the chain")   // see validator.go
+	ErrInvalidTimestamp  = errors.New("block timestamp out of range")                 // see timestamps.go
+	ErrStateRootMismatch = errors.New("state does not match the recorded state root") // see stateroots.go
+	ErrBloomMismatch     = errors.New("bloom does not match the block's accounts")    // see bloom.go
+	ErrWrongVersion      = errors.New("block signals a version below the chain's")    // see upgrades.go
+	ErrNoQuorum          = errors.New("no quorum of the committee committed a block") // see bft.go
+	ErrForked            = errors.New("honest validators committed different blocks") // see bft.go
+	ErrInvalidCommit     = errors.New("commit lacks the precommits of a quorum")      // see bft.go
+
+	// Queries
+	ErrUnknownHeight = errors.New("no block at this height")
+	ErrPruned        = errors.New("block body pruned")                   // see pruning.go
+	ErrUnknownPoll   = errors.New("no such poll")                        // see voting.go
+	ErrUnknownToken  = errors.New("no such token")                       // see tokens.go
+	ErrUnknownName   = errors.New("no such name")                        // see names.go
+	ErrNotPending    = errors.New("transaction not held in the mempool") // see replace.go
+
+	// Keystore
+	ErrAccountExists   = errors.New("account already in the keystore")
+	ErrUnknownAccount  = errors.New("account not in the keystore")
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	ErrFrozenOutput    = errors.New("output frozen by coin control")
+	ErrSignerRefused   = errors.New("signer refused to sign")
+	ErrSignerToken     = errors.New("missing or wrong signer token")
+
+	// HD wallets
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+	ErrInvalidPath     = errors.New("invalid derivation path")
+
+	// Node
+	ErrEmptyMempool     = errors.New("no pending transactions")
+	ErrMempoolFull      = errors.New("mempool full")
+	ErrRateLimited      = errors.New("too many transactions submitted") // see ratelimit.go
+	ErrReadReplica      = errors.New("read replica: submit transactions to the primary")
+	ErrDevOnly          = errors.New("only available on nodes started with -dev")
+	ErrRelayDisabled    = errors.New("node does not relay transactions")
+	ErrPlaintextPeer    = errors.New("peer routes require a noise:// connection")
+	ErrInvalidAlert     = errors.New("invalid double spend alert")
+	ErrNoSnapshots      = errors.New("node does not record mempool snapshots")
+	ErrInvalidReceipt   = errors.New("invalid pruning receipt")
+	ErrNoBackups        = errors.New("node does not back its chain up")
+	ErrInvalidBackup    = errors.New("invalid backup")
+	ErrInvalidPeer      = errors.New("invalid peer") // malformed URL, or of another chain
+	ErrUnknownPeer      = errors.New("not a peer of the node")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+	ErrUnknownWebhook   = errors.New("not a webhook of the node")
+	ErrAdminToken       = errors.New("missing or wrong admin token") // see admin.go
+	ErrInvalidEventSink = errors.New("invalid event sink")
+	ErrOtherChain       = errors.New("peer follows another chain")                   // see handshake.go
+	ErrIncompatiblePeer = errors.New("peer speaks an incompatible protocol version") // see handshake.go
+
+	// Transport
+	ErrNoiseHandshake = errors.New("noise handshake failed")
+)
+
+// Mark the failure of a stateless check as ErrInvalidTxn, keeping its cause
+func invalidTxn(err error) error {
+	if err == nil || errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrBlockFull) || errors.Is(err, ErrOutOfGas) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidTxn, err)
+}
@@ -0,0 +1,102 @@
+/*
+ * In-process event bus for chain activity.
+ * Subscribers get a buffered channel per event type; slow subscribers
+ * miss events rather than stalling the BlockChain.
+ */
+package chain
+
+import "sync"
+
+// Events buffered per subscriber before new events are dropped
+const EVENT_BUFFER_SIZE = 64
+
+type EventType int
+
+const (
+	NewBlock         EventType = iota // a Block was committed to the chain
+	NewTxn                            // a transaction was admitted into the Mempool
+	NewAlert                          // a double spend was seen, see alert.go
+	RevertedBlock                     // a Block was dropped by a reorganization, see reorg.go
+	RevertedTxn                       // a transaction was undone by a reorganization
+	TxnStatusChanged                  // a transaction took a step of its lifecycle, see txnstatus.go
+)
+
+func (t EventType) String() string {
+	switch t {
+	case NewBlock:
+		return "block"
+	case NewTxn:
+		return "txn"
+	case NewAlert:
+		return "alert"
+	case RevertedBlock:
+		return "reverted-block"
+	case RevertedTxn:
+		return "reverted-txn"
+	case TxnStatusChanged:
+		return "txn-status"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Type   EventType
+	Block  *Block        // set for NewBlock and RevertedBlock
+	Height int           // height of Block, or of the Block of a RevertedTxn
+	Delta  []StateChange // changes made by the Block, or undoing it for RevertedBlock
+	Txn    *Transaction  // set for NewTxn and RevertedTxn
+	Alert  *Alert        // set for NewAlert
+	Status *TxnStatus    // set for TxnStatusChanged
+}
+
+type EventBus struct {
+	mu     sync.Mutex
+	subs   map[EventType]map[int]chan Event
+	nextID int
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[EventType]map[int]chan Event)}
+}
+
+/*
+ * Subscribe to events of type t
+ * The returned function cancels the subscription and closes the channel
+ */
+func (eb *EventBus) Subscribe(t EventType) (<-chan Event, func()) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	id := eb.nextID
+	eb.nextID++
+	ch := make(chan Event, EVENT_BUFFER_SIZE)
+	if eb.subs[t] == nil {
+		eb.subs[t] = make(map[int]chan Event)
+	}
+	eb.subs[t][id] = ch
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			eb.mu.Lock()
+			defer eb.mu.Unlock()
+			delete(eb.subs[t], id)
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Deliver ev to all subscribers of its type without blocking
+func (eb *EventBus) publish(ev Event) {
+	if eb == nil {
+		return
+	}
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	for _, ch := range eb.subs[ev.Type] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
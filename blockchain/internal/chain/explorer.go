@@ -0,0 +1,263 @@
+/*
+ * Block explorer served by the node.
+ * The static UI is embedded in the binary and browses the chain through
+ * the read-only endpoints below. Blocks and transactions are looked up in
+ * a snapshot of the chain, see chainsnapshot.go, leaving the Node free for
+ * mining while a lookup scans the Blocks.
+ *
+ *	GET /explorer/            explorer UI
+ *	GET /blocks?limit=..      latest blocks, newest first
+ *	GET /blocks/{id}          block by height or hash
+ *	GET /txns/{hash}          transaction by hash, with its block height
+ *	                          and confirmations, see finality.go
+ *	GET /accounts/{account}   balance and transactions of an account,
+ *	                          as of ?height=.. if set
+ *	GET /search?q=..          resolve a height, hash or account
+ *	GET /orphans              blocks that lost a fork race, see orphans.go
+ *	GET /charts/..            aggregates of the blocks, see charts.go
+ */
+package chain
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strconv"
+)
+
+//go:embed explorer
+var explorerFS embed.FS
+
+// Max number of blocks listed by GET /blocks
+const EXPLORER_MAX_BLOCKS = 100
+
+type jsonBlockSummary struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+	UnixTs int64  `json:"unixTs"`
+	Txns   int    `json:"txns"`
+}
+
+type jsonTxnRef struct {
+	jsonTxn
+	Hash          string `json:"hash"`
+	Height        int    `json:"height"`
+	Confirmations int    `json:"confirmations"`
+	Final         bool   `json:"final"` // at FINALITY_DEPTH, or the requested depth
+}
+
+type jsonBlockDetail struct {
+	jsonBlock
+	Height        int          `json:"height"`
+	PostStateRoot string       `json:"postStateRoot,omitempty"` // after the Block, see stateroots.go
+	Txns          []jsonTxnRef `json:"txns"`
+}
+
+func (s *Server) registerExplorer() {
+	ui, _ := fs.Sub(explorerFS, "explorer")
+	s.mux.Handle("GET /explorer/", http.StripPrefix("/explorer/", http.FileServerFS(ui)))
+	s.mux.Handle("GET /{$}", http.RedirectHandler("/explorer/", http.StatusFound))
+	s.mux.HandleFunc("GET /blocks", s.handleBlocks)
+	s.mux.HandleFunc("GET /blocks/{id}", s.handleBlock)
+	s.mux.HandleFunc("GET /txns/{hash}", s.handleTxn)
+	s.mux.HandleFunc("GET /txns/{hash}/status", s.handleTxnStatus)
+	s.mux.HandleFunc("GET /txns/{hash}/events", s.handleTxnEvents)
+	s.mux.HandleFunc("GET /accounts/{account}", s.handleAccount)
+	s.mux.HandleFunc("GET /search", s.handleSearch)
+	s.mux.HandleFunc("GET /orphans", s.handleOrphans)
+	s.mux.HandleFunc("GET /charts/blocks-per-hour", s.handleBlocksPerHour)
+	s.mux.HandleFunc("GET /charts/block-times", s.handleBlockTimes)
+	s.mux.HandleFunc("GET /charts/block-sizes", s.handleBlockSizes)
+	s.mux.HandleFunc("GET /charts/fees", s.handleFeeChart)
+}
+
+// Find a Block by height or hash, see cache.go and blockindex.go
+func (bc BlockChain) findBlock(id string) (Block, int, bool) {
+	if height, err := strconv.Atoi(id); err == nil {
+		if height < 0 || height >= bc.blocks.Len() {
+			return Block{}, 0, false
+		}
+		return bc.blockAt(height), height, true
+	}
+	// Snapshots share the caches of the chain, which may know of later Blocks
+	if c, ok := bc.caches.blocks.get(id); ok && c.height < bc.blocks.Len() {
+		return c.block, c.height, true
+	}
+	if idx, ok := bc.blocks.(indexedStore); ok {
+		height, ok := idx.blockHeight(id)
+		if !ok || height >= bc.blocks.Len() {
+			return Block{}, 0, false
+		}
+		b := bc.blockAt(height)
+		if b.hash != id {
+			return Block{}, 0, false
+		}
+		bc.caches.blocks.put(id, cachedBlock{b, height})
+		return b, height, true
+	}
+	for height := 0; height < bc.blocks.Len(); height++ {
+		if b := bc.blockAt(height); b.hash == id {
+			bc.caches.blocks.put(id, cachedBlock{b, height})
+			return b, height, true
+		}
+	}
+	return Block{}, 0, false
+}
+
+// Find a committed transaction by hash, see cache.go and blockindex.go
+func (bc BlockChain) findTxn(hash string) (Transaction, int, bool) {
+	if c, ok := bc.caches.txns.get(hash); ok && c.height < bc.blocks.Len() {
+		return c.txn, c.height, true
+	}
+	if idx, ok := bc.blocks.(indexedStore); ok {
+		height, index, ok := idx.txnLocation(hash)
+		if !ok || height >= bc.blocks.Len() {
+			return Transaction{}, 0, false
+		}
+		if data := bc.blockAt(height).data; index < len(data) && data[index].Hash() == hash {
+			bc.caches.txns.put(hash, cachedTxn{data[index], height})
+			return data[index], height, true
+		}
+		return Transaction{}, 0, false
+	}
+	for height := 0; height < bc.blocks.Len(); height++ {
+		for _, txn := range bc.blockAt(height).data {
+			if txn.Hash() == hash {
+				bc.caches.txns.put(hash, cachedTxn{txn, height})
+				return txn, height, true
+			}
+		}
+	}
+	return Transaction{}, 0, false
+}
+
+// Transaction with its hash, height and fiat values if an oracle is set
+func (bc BlockChain) txnRef(txn Transaction, height int) jsonTxnRef {
+	ref := jsonTxnRef{jsonTxn: txn.toJSON(), Hash: txn.Hash(), Height: height, Confirmations: bc.confirmations(height)}
+	ref.Final = ref.Confirmations >= FINALITY_DEPTH
+	if bc.oracle != nil && txn.transferTotal() != 0 {
+		ref.Fiat = bc.oracle.Annotate(txn.transferTotal(), bc.blockAt(height).unixTs)
+	}
+	return ref
+}
+
+func (bc BlockChain) blockDetail(b Block, height int) jsonBlockDetail {
+	detail := jsonBlockDetail{jsonBlock: b.toJSON(), Height: height}
+	detail.PostStateRoot, _ = bc.StateRoot(height)
+	for _, txn := range b.data {
+		detail.Txns = append(detail.Txns, bc.txnRef(txn, height))
+	}
+	return detail
+}
+
+func (s *Server) handleBlocks(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > EXPLORER_MAX_BLOCKS {
+		limit = EXPLORER_MAX_BLOCKS
+	}
+	blocks := []jsonBlockSummary{}
+	bc := s.node.Snapshot().chain
+	for height := bc.blocks.Len() - 1; height >= 0 && len(blocks) < limit; height-- {
+		b := bc.blockAt(height)
+		blocks = append(blocks, jsonBlockSummary{height, b.hash, b.unixTs, len(b.data)})
+	}
+	writeJSON(w, http.StatusOK, blocks)
+}
+
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	bc := s.node.Snapshot().chain
+	b, height, found := bc.findBlock(r.PathValue("id"))
+	if !found {
+		writeError(w, http.StatusNotFound, "block not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, bc.blockDetail(b, height))
+}
+
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	depth := FINALITY_DEPTH
+	if d := r.URL.Query().Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil || depth < 1 {
+			writeError(w, http.StatusBadRequest, "depth must be a positive number of blocks")
+			return
+		}
+	}
+	bc := s.node.Snapshot().chain
+	txn, height, found := bc.findTxn(r.PathValue("hash"))
+	if !found {
+		writeError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	ref := bc.txnRef(txn, height)
+	ref.Final = ref.Confirmations >= depth
+	writeJSON(w, http.StatusOK, ref)
+}
+
+type jsonAccount struct {
+	Account string             `json:"account"`
+	Balance Amount             `json:"balance"`
+	Assets  map[string]Amount  `json:"assets,omitempty"`
+	Fiat    map[string]float64 `json:"fiat,omitempty"`
+	Txns    []jsonTxnRef       `json:"txns"`
+}
+
+// Balances of account in view, and its transactions up to the height of view
+func (bc BlockChain) accountDetail(account string, view *StateView) jsonAccount {
+	detail := jsonAccount{
+		Account: account,
+		Balance: view.Balance(account, NATIVE_ASSET),
+		Assets:  make(map[string]Amount),
+		Txns:    []jsonTxnRef{},
+	}
+	for asset, amt := range view.state.balances[account] {
+		if asset != NATIVE_ASSET {
+			detail.Assets[asset] = amt
+		}
+	}
+	if bc.oracle != nil {
+		detail.Fiat = bc.oracle.Annotate(detail.Balance, bc.blockAt(view.Height()).unixTs)
+	}
+	for _, e := range bc.history[account] {
+		if e.height <= view.Height() && !bc.isPruned(e.height) {
+			detail.Txns = append(detail.Txns, bc.txnRef(bc.blockAt(e.height).data[e.index], e.height))
+		}
+	}
+	return detail
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	var detail jsonAccount
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		var view *StateView
+		if view, err = requestView(bc, r); err == nil {
+			detail = bc.accountDetail(r.PathValue("account"), view)
+		}
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// Resolve q as a block height or hash, then a transaction hash, then an account
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "missing query")
+		return
+	}
+	result := map[string]any{}
+	snapshot := s.node.Snapshot().chain
+	if b, height, ok := snapshot.findBlock(q); ok {
+		result["block"] = snapshot.blockDetail(b, height)
+	} else if txn, height, ok := snapshot.findTxn(q); ok {
+		result["txn"] = snapshot.txnRef(txn, height)
+	} else {
+		// Accounts need the address index, kept under the lock
+		s.node.withChain(func(bc *BlockChain) { result["account"] = bc.accountDetail(q, bc.latest()) })
+	}
+	writeJSON(w, http.StatusOK, result)
+}
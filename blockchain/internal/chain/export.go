@@ -0,0 +1,164 @@
+/*
+ * Export and import of a full chain as JSON lines.
+ * The first line is a header with the format version and the genesis spec,
+ * each following line is one Block after genesis, in order, with the root
+ * of the state after it since version 3. Imported Blocks are validated one
+ * by one as they are appended, and must lead to the state roots exported.
+ */
+package chain
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+const EXPORT_FORMAT = "toychain"
+
+// Version of the export format written by Export
+const EXPORT_VERSION = 3
+
+// Oldest version Import reads, Blocks of version 1 hash differently
+const MIN_EXPORT_VERSION = 2
+
+type exportHeader struct {
+	Format      string  `json:"format"`
+	Version     int     `json:"version"`
+	Genesis     Genesis `json:"genesis"`
+	GenesisHash string  `json:"genesisHash"`
+	Height      int     `json:"height"` // number of Blocks after genesis
+}
+
+// Line of an export after the header
+type exportBlock struct {
+	jsonBlock
+	PostStateRoot string `json:"postStateRoot,omitempty"` // after the Block, since version 3
+}
+
+// Write the chain to w, see Import
+func (bc BlockChain) Export(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	header := exportHeader{
+		Format:      EXPORT_FORMAT,
+		Version:     EXPORT_VERSION,
+		Genesis:     bc.genesis,
+		GenesisHash: bc.GenesisHash(),
+		Height:      bc.blocks.Len() - 1,
+	}
+	if bc.pruned > 1 {
+		return fmt.Errorf("%w: bodies below %v cannot be exported", ErrPruned, bc.pruned)
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for height := 1; height < bc.blocks.Len(); height++ {
+		root, _ := bc.StateRoot(height)
+		if err := enc.Encode(exportBlock{bc.blockAt(height).toJSON(), root}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Rebuild a chain written by Export, validating every Block, but for the
+ * Proof Of Work of those up to the last of checkpoints
+ */
+func Import(r io.Reader, checkpoints ...Checkpoint) (BlockChain, error) {
+	dec, header, err := readExportHeader(r)
+	if err != nil {
+		return BlockChain{}, err
+	}
+	bc := CreateBlockChain(header.Genesis)
+	if err := bc.SetCheckpoints(checkpoints); err != nil {
+		return BlockChain{}, err
+	}
+	if err := bc.importBlocks(dec, header); err != nil {
+		return BlockChain{}, err
+	}
+	return bc, nil
+}
+
+/*
+ * Append the Blocks of an export past the last Block of bc, eg. a chain
+ * bootstrapped from a state snapshot, see statesnapshot.go. The Blocks up
+ * to it must be those of bc
+ */
+func (bc *BlockChain) ImportAfter(r io.Reader) error {
+	dec, header, err := readExportHeader(r)
+	if err != nil {
+		return err
+	}
+	return bc.importBlocks(dec, header)
+}
+
+func readExportHeader(r io.Reader) (*json.Decoder, exportHeader, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var header exportHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, header, fmt.Errorf("reading header: %w", err)
+	}
+	if header.Format != EXPORT_FORMAT {
+		return nil, header, fmt.Errorf("not a %v export", EXPORT_FORMAT)
+	}
+	if header.Version < MIN_EXPORT_VERSION || header.Version > EXPORT_VERSION {
+		return nil, header, fmt.Errorf("unsupported export version %v", header.Version)
+	}
+	return dec, header, nil
+}
+
+func (bc *BlockChain) importBlocks(dec *json.Decoder, header exportHeader) error {
+	if bc.GenesisHash() != header.GenesisHash {
+		return fmt.Errorf("genesis hash mismatch: spec gives %v, export has %v",
+			bc.GenesisHash(), header.GenesisHash)
+	}
+	for height := 1; ; height++ {
+		var j exportBlock
+		err := dec.Decode(&j)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading block %v: %w", height, err)
+		}
+		if height < bc.blocks.Len() {
+			if j.Hash != bc.blockAt(height).hash {
+				return fmt.Errorf("%w: block %v at height %v, the chain has %v", ErrInvalidBlockHash, j.Hash, height, bc.blockAt(height).hash)
+			}
+			continue
+		}
+		if err := bc.appendBlock(j.block()); err != nil {
+			return fmt.Errorf("block %v: %w", height, err)
+		}
+		if root := bc.stateRoots[height]; j.PostStateRoot != "" && j.PostStateRoot != root {
+			return fmt.Errorf("block %v: %w: %v, the export has %v", height, ErrStateRootMismatch, root, j.PostStateRoot)
+		}
+	}
+	if bc.blocks.Len()-1 != header.Height {
+		return fmt.Errorf("export is truncated: %v of %v blocks", bc.blocks.Len()-1, header.Height)
+	}
+	return nil
+}
+
+func ExportFile(bc BlockChain, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := bc.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func ImportFile(path string, checkpoints ...Checkpoint) (BlockChain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return BlockChain{}, err
+	}
+	defer f.Close()
+	return Import(f, checkpoints...)
+}
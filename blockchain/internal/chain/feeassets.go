@@ -0,0 +1,112 @@
+/*
+ * Fees paid in tokens.
+ * The genesis may list assets besides the chain's coin that transactions
+ * pay their fees in, by setting feeAsset: the flat fee and the gas price
+ * are then amounts of that asset, charged to the payer and credited to the
+ * miner in it.
+ *
+ * The rate of each asset, in coins per unit, is published on chain by the
+ * fee oracle of the genesis, as the value of the asset's key in the
+ * FEE_RATES_NAMESPACE key-value namespace, which the genesis hands to the
+ * oracle so nobody else can write to it. A transaction paying in an asset
+ * without a rate does not apply. The Mempool orders transactions by the
+ * coin value of their fees at the latest rates, so fees in a token buy the
+ * same priority as the same value in coins; rates only rank transactions,
+ * the amounts charged are the ones signed.
+ */
+package chain
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Key-value namespace of the fee rates, owned by the fee oracle
+const FEE_RATES_NAMESPACE = "fee-rates"
+
+// Write by oracle of the rate of asset, in coins per unit, 0 to withdraw it
+func NewFeeRate(oracle string, nonce uint64, asset string, rate float64) Transaction {
+	value := []byte{}
+	if rate != 0 {
+		value = []byte(strconv.FormatFloat(rate, 'g', -1, 64))
+	}
+	return NewKVWrite(oracle, nonce, FEE_RATES_NAMESPACE, asset, value)
+}
+
+// Pay the fees of the transaction in asset, before signing it
+func (txn Transaction) WithFeeAsset(asset string) Transaction {
+	txn.feeAsset = asset
+	return txn
+}
+
+// Parse a published rate, which must be a positive number
+func parseFeeRate(value []byte) (float64, error) {
+	rate, err := strconv.ParseFloat(string(value), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("fee rate %q is not a positive number", value)
+	}
+	return rate, nil
+}
+
+// Coins per unit of asset, 1 for the chain's coin, false if no rate is published
+func (s *State) feeRate(asset string) (float64, bool) {
+	if asset == NATIVE_ASSET {
+		return 1, true
+	}
+	value, ok := s.getKV(FEE_RATES_NAMESPACE, asset)
+	if !ok {
+		return 0, false
+	}
+	rate, err := parseFeeRate(value)
+	return rate, err == nil
+}
+
+// Published rates of all fee assets
+func (s *State) feeRates() map[string]float64 {
+	rates := map[string]float64{}
+	for asset := range s.kv[FEE_RATES_NAMESPACE] {
+		if rate, ok := s.feeRate(asset); ok {
+			rates[asset] = rate
+		}
+	}
+	return rates
+}
+
+// Fees of the transaction in coins at rates, 0 if its fee asset has no rate
+func (txn Transaction) feeValue(rates map[string]float64) Amount {
+	if txn.feeAsset == NATIVE_ASSET {
+		return txn.totalFee()
+	}
+	return CoinsAmount(txn.totalFee().Coins() * rates[txn.feeAsset])
+}
+
+/*
+ * Refuse fees in assets the genesis does not list, and rates published by
+ * the oracle that are not positive numbers
+ */
+func (bc *BlockChain) checkFeeAsset(txn Transaction) error {
+	if txn.feeAsset != NATIVE_ASSET && !slices.Contains(bc.genesis.FeeAssets, txn.feeAsset) {
+		return fmt.Errorf("%w: %q is not a fee asset of the chain", ErrFeeAsset, txn.feeAsset)
+	}
+	if w := txn.kv; w != nil && bc.genesis.FeeOracle != "" && w.namespace == FEE_RATES_NAMESPACE && len(w.value) > 0 {
+		if _, err := parseFeeRate(w.value); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTxn, err)
+		}
+	}
+	return nil
+}
+
+// Both or neither of the fee assets and oracle, the assets listed once
+func (g Genesis) checkFeeAssets() error {
+	if (len(g.FeeAssets) == 0) != (g.FeeOracle == "") {
+		return fmt.Errorf("fee assets and fee oracle go together")
+	}
+	for i, asset := range g.FeeAssets {
+		if asset == NATIVE_ASSET || slices.Contains(g.FeeAssets[:i], asset) {
+			return fmt.Errorf("fee asset %q is the chain's coin or listed twice", asset)
+		}
+	}
+	return nil
+}
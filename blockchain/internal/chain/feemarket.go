@@ -0,0 +1,262 @@
+/*
+ * Fee market analytics.
+ * Historical block fullness and fee percentiles are derived from committed
+ * Blocks, and the projection replays the miner's packing order over the
+ * Mempool to tell which fee gets a new transaction into the next Blocks.
+ * Fees paid in tokens count for their value in coins at the latest rates,
+ * see feeassets.go.
+ *
+ * EstimateFee suggests a fee for a target number of Blocks from both: the
+ * projection, which misses the transactions arriving meanwhile, and the
+ * fees that cleared recent full Blocks, which misses a sudden rush.
+ *
+ *	GET /fees?blocks=..           fee history of the last blocks and projection
+ *	GET /fees/estimate?target=..  fee to be included within target blocks
+ */
+package chain
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// Fee percentiles reported per Block
+var FEE_PERCENTILES = []int{10, 25, 50, 75, 90}
+
+// Smallest fee step that outbids a pending transaction
+const FEE_INCREMENT = COIN / 100
+
+// Blocks ahead covered by the fee projection
+const FEE_PROJECTION_BLOCKS = 3
+
+const (
+	FEE_ESTIMATE_BLOCKS     = 20  // recent Blocks the fee estimate learns from
+	FEE_ESTIMATE_CONFIDENCE = 0.9 // chance of inclusion within the target the estimate aims for
+	FULL_BLOCK_FULLNESS     = 0.9 // Blocks this full are taken to have turned transactions away
+)
+
+type BlockFeeStats struct {
+	Height      int            `json:"height"`
+	Txns        int            `json:"txns"`
+	Bytes       int            `json:"bytes"` // encoded size, see blocksize.go
+	GasUsed     uint64         `json:"gasUsed"`
+	Fullness    float64        `json:"fullness"` // fraction of the txn, byte or gas limit used, whichever is highest
+	MinFee      Amount         `json:"minFee"`
+	Percentiles map[int]Amount `json:"percentiles"`
+}
+
+type FeeProjection struct {
+	Pending  int    `json:"pending"`  // executable transactions in the Mempool
+	Capacity int    `json:"capacity"` // transactions per Block, 0 for no cap
+	Bytes    int    `json:"bytes"`    // encoded size of the transactions of a Block
+	Typical  Amount `json:"typical"`  // median fee of recent Blocks
+	// Fee needed to be included within n Blocks, by n
+	WithinBlocks map[int]Amount `json:"withinBlocks"`
+}
+
+type FeeEstimate struct {
+	TargetBlocks int    `json:"targetBlocks"`
+	Fee          Amount `json:"fee"`     // highest of Mempool and History
+	Mempool      Amount `json:"mempool"` // outbidding the pending transactions beyond the target Blocks
+	History      Amount `json:"history"` // clearing recent Blocks often enough to make the target
+	Blocks       int    `json:"blocks"`  // recent Blocks History learnt from
+}
+
+// Value at percentile p of sorted values, nearest rank
+func percentile[T cmp.Ordered](sorted []T, p int) T {
+	if len(sorted) == 0 {
+		var zero T
+		return zero
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func blockFeeStats(limits BlockLimits, rates map[string]float64, height int, b Block) BlockFeeStats {
+	fees := []Amount{}
+	for _, txn := range b.data {
+		if txn.kind != TxnMint {
+			fees = append(fees, txn.feeValue(rates))
+		}
+	}
+	slices.Sort(fees)
+	stats := BlockFeeStats{
+		Height:      height,
+		Txns:        len(fees),
+		Bytes:       b.size(),
+		GasUsed:     b.gasUsed(),
+		Fullness:    float64(b.size()) / float64(limits.Bytes),
+		Percentiles: make(map[int]Amount),
+	}
+	if limits.Txns > 0 {
+		stats.Fullness = max(stats.Fullness, float64(len(fees))/float64(limits.Txns))
+	}
+	if gasFullness := float64(stats.GasUsed) / BLOCK_GAS_LIMIT; gasFullness > stats.Fullness {
+		stats.Fullness = gasFullness
+	}
+	if len(fees) > 0 {
+		stats.MinFee = fees[0]
+	}
+	for _, p := range FEE_PERCENTILES {
+		stats.Percentiles[p] = percentile(fees, p)
+	}
+	return stats
+}
+
+// Fee statistics of the last n Blocks, oldest first
+func (bc *BlockChain) FeeHistory(n int) []BlockFeeStats {
+	start := bc.blocks.Len() - n
+	if start < 1 {
+		start = 1 // skip genesis allocations
+	}
+	history := []BlockFeeStats{}
+	for height := start; height < bc.blocks.Len(); height++ {
+		history = append(history, blockFeeStats(bc.limitsAt(height), bc.mempool.rates, height, bc.blockAt(height)))
+	}
+	return history
+}
+
+/*
+ * Fee a new transaction needs to be packed within the next Blocks, assuming
+ * no other transaction arrives: it must outbid every pending transaction
+ * beyond the capacity of those Blocks
+ */
+func (bc *BlockChain) ProjectFee(historyBlocks int) FeeProjection {
+	ordered := bc.mempool.ordered()
+	limits := bc.blockLimits()
+	projection := FeeProjection{
+		Pending:      len(ordered),
+		Capacity:     limits.Txns,
+		Bytes:        limits.Bytes,
+		WithinBlocks: make(map[int]Amount),
+	}
+	medians := []Amount{}
+	for _, stats := range bc.FeeHistory(historyBlocks) {
+		if stats.Txns > 0 {
+			medians = append(medians, stats.Percentiles[50])
+		}
+	}
+	slices.Sort(medians)
+	projection.Typical = percentile(medians, 50)
+
+	for n := 1; n <= FEE_PROJECTION_BLOCKS; n++ {
+		if slots, room := packed(limits, ordered, n); room {
+			projection.WithinBlocks[n] = 0
+		} else {
+			projection.WithinBlocks[n] = ordered[slots-1].feeValue(bc.mempool.rates) + FEE_INCREMENT
+		}
+	}
+	return projection
+}
+
+/*
+ * Fee likely to get a new transaction included within targetBlocks Blocks,
+ * 1 if lower. It outbids the pending transactions that fill those Blocks,
+ * as ProjectFee does, and clears enough of the last FEE_ESTIMATE_BLOCKS
+ * Blocks that one of targetBlocks like them includes it with
+ * FEE_ESTIMATE_CONFIDENCE: a full Block cleared the fees above the lowest
+ * it took, one with room left cleared any fee
+ */
+func (bc *BlockChain) EstimateFee(targetBlocks int) FeeEstimate {
+	estimate := FeeEstimate{TargetBlocks: max(targetBlocks, 1)}
+	ordered := bc.mempool.ordered()
+	if slots, room := packed(bc.blockLimits(), ordered, estimate.TargetBlocks); !room && slots > 0 {
+		estimate.Mempool = ordered[slots-1].feeValue(bc.mempool.rates) + FEE_INCREMENT
+	}
+	clearing := []Amount{}
+	for _, stats := range bc.FeeHistory(FEE_ESTIMATE_BLOCKS) {
+		var fee Amount
+		if stats.Fullness >= FULL_BLOCK_FULLNESS {
+			fee = stats.MinFee + FEE_INCREMENT
+		}
+		clearing = append(clearing, fee)
+	}
+	slices.Sort(clearing)
+	estimate.Blocks = len(clearing)
+	// A fee cleared by a fraction c of the Blocks misses all of n of them with (1-c)^n
+	miss := math.Pow(1-FEE_ESTIMATE_CONFIDENCE, 1/float64(estimate.TargetBlocks))
+	estimate.History = percentile(clearing, int(math.Round(100*(1-miss))))
+	estimate.Fee = max(estimate.Mempool, estimate.History)
+	return estimate
+}
+
+/*
+ * Number of the first of txns the next n Blocks hold, each filled in order
+ * until the next transaction does not fit, and whether they have room left
+ * once all txns are packed
+ */
+func packed(limits BlockLimits, txns []Transaction, n int) (int, bool) {
+	taken := 0
+	for ; n > 0; n-- {
+		count, size := 0, 1
+		for taken < len(txns) && limits.fits(count+1, size+txns[taken].size()+1) {
+			count, size = count+1, size+txns[taken].size()+1
+			taken++
+		}
+		if taken == len(txns) {
+			// Blocks left after this one are empty
+			return taken, n > 1 || limits.fits(count+1, size+1)
+		}
+	}
+	return taken, false
+}
+
+// GET /fees?blocks=.. fee history of the last blocks and fee projection
+func (s *Server) handleFees(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.URL.Query().Get("blocks"))
+	if err != nil || n <= 0 {
+		n = 20
+	}
+	var history []BlockFeeStats
+	var projection FeeProjection
+	s.node.withChain(func(bc *BlockChain) {
+		history = bc.FeeHistory(n)
+		projection = bc.ProjectFee(n)
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"history":    history,
+		"projection": projection,
+	})
+}
+
+// GET /fees/estimate?target=..
+func (s *Server) handleEstimateFee(w http.ResponseWriter, r *http.Request) {
+	target := 1
+	if t := r.URL.Query().Get("target"); t != "" {
+		var err error
+		if target, err = strconv.Atoi(t); err != nil || target < 1 {
+			writeError(w, http.StatusBadRequest, "target must be a positive number of blocks")
+			return
+		}
+	}
+	var estimate FeeEstimate
+	s.node.withChain(func(bc *BlockChain) { estimate = bc.EstimateFee(target) })
+	writeJSON(w, http.StatusOK, estimate)
+}
+
+func (e FeeEstimate) fields() [][2]string {
+	return [][2]string{
+		{"target blocks", fmt.Sprint(e.TargetBlocks)},
+		{"fee", fmt.Sprint(e.Fee)},
+		{"from the mempool", fmt.Sprint(e.Mempool)},
+		{"from recent blocks", fmt.Sprintf("%v, over %v blocks", e.History, e.Blocks)},
+	}
+}
+
+// Print the fee estimate for target Blocks on bc, returning the exit code
+func runEstimateFee(bc *BlockChain, target int, out *Output) int {
+	estimate := bc.EstimateFee(target)
+	if err := out.Record(estimate.fields(), estimate); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
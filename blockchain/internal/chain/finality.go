@@ -0,0 +1,40 @@
+/*
+ * Confirmations and finality.
+ * A transaction in the Block at height h of a chain whose last Block is at
+ * height t has t-h+1 confirmations: its own Block and every Block mined on
+ * top of it. To reverse the payment, an attacker has to mine a longer
+ * branch forking before h, redoing the work of every confirmation while
+ * the rest of the network keeps extending the chain, so the odds of
+ * catching up fall with each Block. Merchants thus wait for a depth of
+ * confirmations before shipping, FINALITY_DEPTH unless they ask otherwise.
+ * A committee of validators makes Blocks final at once instead, see bft.go.
+ *
+ *	GET /txns/{hash}?depth=..  confirmations of the transaction, and
+ *	                           whether it is final at depth
+ */
+package chain
+
+// Confirmations after which a transaction is considered final by default
+const FINALITY_DEPTH = 6
+
+/*
+ * Number of Blocks from the one committing the transaction hash to the
+ * last one, both included, 0 if it is pending or unknown
+ */
+func (bc *BlockChain) Confirmations(hash string) int {
+	_, height, found := bc.findTxn(hash)
+	if !found {
+		return 0
+	}
+	return bc.confirmations(height)
+}
+
+// Whether the transaction hash is committed with at least depth confirmations
+func (bc *BlockChain) IsFinal(hash string, depth int) bool {
+	return bc.Confirmations(hash) >= max(depth, 1)
+}
+
+// Confirmations of a transaction committed at height
+func (bc BlockChain) confirmations(height int) int {
+	return bc.blocks.Len() - height
+}
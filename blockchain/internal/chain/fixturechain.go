@@ -0,0 +1,78 @@
+/*
+ * Fixture chain.
+ * A small, fully valid chain shipped inside the binary as an export, so
+ * examples, tutorials and tests work on a known chain without mining. It
+ * is loaded through Import like any export, every Block being validated.
+ * The chain has difficulty 2 and fixed timestamps, and holds:
+ *
+ *	1  transfers from alice to bob and carol, one paying a fee
+ *	2  a batch payout from alice to bob, carol and dave
+ *	3  a gold transfer from bob to carol
+ *	4  alice claiming the alice.app namespace with greeting=hello
+ *	5  bob selling gold to alice through matching orders
+ *	6  alice depositing 50 into unspent outputs
+ *	7  a gas priced transfer from carol to dave
+ *
+ * Regenerate it with -write-fixture-chain after a consensus change.
+ */
+package chain
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+)
+
+//go:embed fixturechain/chain.jsonl
+var fixtureChainExport []byte
+
+const FIXTURE_CHAIN_FILE = "fixturechain/chain.jsonl"
+
+func fixtureChainGenesis() Genesis {
+	g := DefaultGenesis(2)
+	g.ChainID = "fixture"
+	g.UnixTs = 1_700_000_000_000_000
+	g.Alloc = map[string]Amount{"alice": 1000 * COIN, "bob": 500 * COIN, "carol": 250 * COIN}
+	g.Assets = map[string]map[string]Amount{"gold": {"bob": 100 * COIN}}
+	return g
+}
+
+// The embedded fixture chain, a fresh copy on each call
+func LoadFixtureChain() (BlockChain, error) {
+	return Import(bytes.NewReader(fixtureChainExport))
+}
+
+// Mine the fixture chain from scratch
+func buildFixtureChain() (BlockChain, error) {
+	fb := newFixtureBuilder("fixture-chain", fixtureChainGenesis())
+	blocks := [][]Transaction{
+		{
+			{payer: "alice", payee: "bob", amt: 10 * COIN, nonce: 0},
+			{payer: "alice", payee: "carol", amt: 5 * COIN, fee: COIN / 2, nonce: 1},
+		},
+		{NewBatchTransfer("alice", 2, NATIVE_ASSET, NewPayout("bob", 3*COIN), NewPayout("carol", 2*COIN), NewPayout("dave", COIN))},
+		{{payer: "bob", payee: "carol", asset: "gold", amt: 20 * COIN, nonce: 0}},
+		{NewKVWrite("alice", 3, "alice.app", "greeting", []byte("hello"))},
+		{
+			NewOrder("bob", 1, Sell, "gold", NATIVE_ASSET, 4*COIN, 10*COIN),
+			NewOrder("alice", 4, Buy, "gold", NATIVE_ASSET, 4*COIN, 10*COIN),
+		},
+		{NewUTXOTxn("alice", "", 5, 50*COIN, nil, NewUTXOOutput("alice", 30*COIN), NewUTXOOutput("alice", 20*COIN))},
+		{{payer: "carol", payee: "dave", amt: COIN, nonce: 0, gasLimit: GAS_TRANSFER, gasPrice: COIN / 10_000}},
+	}
+	for i, txns := range blocks {
+		if err := fb.bc.appendBlock(fb.mine(txns...)); err != nil {
+			return BlockChain{}, fmt.Errorf("fixture block %v: %w", i+1, err)
+		}
+	}
+	return fb.bc, nil
+}
+
+// Regenerate the fixture chain export at path
+func writeFixtureChain(path string) error {
+	bc, err := buildFixtureChain()
+	if err != nil {
+		return err
+	}
+	return ExportFile(bc, path)
+}
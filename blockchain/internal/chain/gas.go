@@ -0,0 +1,125 @@
+/*
+ * Gas accounting.
+ * Every transaction consumes an amount of gas depending on the work it
+ * asks of the chain, and a Block may not consume more than BLOCK_GAS_LIMIT
+ * on top of its size limits, see blocksize.go.
+ * A transaction pays its flat fee plus, when it sets a gas limit, the gas
+ * it uses times its gas price. Fees go to the miner of the Block.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Max gas consumed by the transactions of a Block
+const BLOCK_GAS_LIMIT = 150_000
+
+const (
+	GAS_TRANSFER     = 21_000
+	GAS_SWAP_LEG     = 15_000
+	GAS_ORDER        = 30_000
+	GAS_CANCEL_ORDER = 10_000
+	GAS_DATA_BYTE    = 16 // per byte of the data of a transaction
+)
+
+// Max bytes of the data of a transaction, enough for a hash or a short message
+const MAX_TXN_DATA = 256
+
+// Gas consumed by the transaction, including its script
+func (txn Transaction) gas() uint64 {
+	gas := txn.kindGas() + uint64(len(txn.cosigs))*GAS_COSIGNATURE + uint64(len(txn.data))*GAS_DATA_BYTE
+	if txn.script != nil {
+		gas += txn.script.gas()
+	}
+	return gas
+}
+
+func (txn Transaction) kindGas() uint64 {
+	switch txn.kind {
+	case TxnSwap:
+		return GAS_TRANSFER + uint64(len(txn.swap.legs))*GAS_SWAP_LEG
+	case TxnOrder:
+		return GAS_ORDER
+	case TxnCancelOrder:
+		return GAS_CANCEL_ORDER
+	case TxnKV:
+		return txn.kv.gas()
+	case TxnUTXO:
+		return txn.utxo.gas()
+	case TxnMultisig:
+		return GAS_TRANSFER + uint64(len(txn.multisig.keys))*GAS_MULTISIG_KEY
+	case TxnMessage:
+		return txn.message.gas()
+	case TxnRecord:
+		return txn.record.gas()
+	case TxnToken:
+		return GAS_TOKEN
+	case TxnMint:
+		return 0
+	}
+	return GAS_TRANSFER + uint64(len(txn.payouts))*GAS_PAYOUT
+}
+
+// Flat fee plus gas used times gas price
+func (txn Transaction) totalFee() Amount {
+	if txn.gasLimit == 0 {
+		return txn.fee
+	}
+	return txn.fee + Amount(txn.gas())*txn.gasPrice
+}
+
+func (txn Transaction) verifyGas() error {
+	if txn.fee < 0 || txn.gasPrice < 0 {
+		return errors.New("negative fee")
+	}
+	if txn.gas() > BLOCK_GAS_LIMIT {
+		return fmt.Errorf("%w: transaction uses more gas than a block allows", ErrBlockFull)
+	}
+	if txn.gasLimit == 0 {
+		if txn.gasPrice != 0 {
+			return errors.New("gas price without gas limit")
+		}
+		return nil
+	}
+	if txn.gasLimit < txn.gas() {
+		return fmt.Errorf("%w: gas limit %v below the %v gas used by the transaction", ErrOutOfGas, txn.gasLimit, txn.gas())
+	}
+	if txn.gasLimit > BLOCK_GAS_LIMIT {
+		return errors.New("gas limit above the block gas limit")
+	}
+	if txn.gasPrice > MAX_AMOUNT/Amount(txn.gasLimit) {
+		return errors.New("gas price times gas limit out of range")
+	}
+	return nil
+}
+
+// Gas consumed by all transactions of the Block
+func (b Block) gasUsed() uint64 {
+	var gas uint64
+	for _, txn := range b.data {
+		gas += txn.gas()
+	}
+	return gas
+}
+
+/*
+ * Credit the fees of the Block's transactions to its miner, in the assets
+ * they were paid in, along with the block reward, see issuance.go
+ */
+func (s *State) payMiner(b Block) {
+	s.height++
+	if b.miner == "" {
+		return
+	}
+	reward := s.issuanceAt(s.height).reward(s.height, s.supply)
+	s.supply += reward
+	fees := map[string]Amount{NATIVE_ASSET: reward}
+	for _, txn := range b.data {
+		fees[txn.feeAsset] += txn.totalFee()
+	}
+	for _, asset := range sortedKeys(fees) {
+		s.credit(b.miner, asset, fees[asset])
+	}
+}
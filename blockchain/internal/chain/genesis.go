@@ -0,0 +1,233 @@
+/*
+ * Genesis specification of a BlockChain.
+ * Two nodes created from the same spec mine the exact same genesis Block,
+ * so comparing genesis hashes tells whether they are on the same chain.
+ * The genesis Block has no parent, its prevHash commits to the chain ID,
+ * difficulty and validators instead, and its transactions mint the
+ * premined allocations. Validator keys are bound to their account names.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type Genesis struct {
+	ChainID    string            `json:"chainId"`
+	Difficulty int               `json:"difficulty"`
+	Alloc      map[string]Amount `json:"alloc"`  // premined balances of the chain's coin
+	UnixTs     int64             `json:"unixTs"` // unix microseconds
+
+	// Premined balances of other assets, by asset then account
+	Assets map[string]map[string]Amount `json:"assets,omitempty"`
+
+	Validators []GenesisValidator `json:"validators,omitempty"` // sorted by name
+
+	// Lets -dev nodes change the difficulty at runtime, see devnet.go
+	DevNet bool `json:"devnet,omitempty"`
+
+	// Accounts must be addresses of this prefix when set, see address.go
+	AddressPrefix string `json:"addressPrefix,omitempty"`
+
+	// Follows the hash rate when set, see retarget.go
+	Retarget *RetargetSpec `json:"retarget,omitempty"`
+
+	// Extra rules transactions must pass, see validator.go
+	Rules []RuleSpec `json:"rules,omitempty"`
+
+	// Size limits of the Blocks, the legacy ones when unset, see blocksize.go
+	BlockLimits *BlockLimits `json:"blockLimits,omitempty"`
+
+	// Assets fees may be paid in at the rates the oracle account publishes, see feeassets.go
+	FeeAssets []string `json:"feeAssets,omitempty"`
+	FeeOracle string   `json:"feeOracle,omitempty"`
+
+	// Block rewards, halvings and supply cap, none when unset, see issuance.go
+	Issuance *IssuanceSpec `json:"issuance,omitempty"`
+
+	// Proof Of Work algorithm, SHA-256 when unset, see pow.go
+	Pow *PowSpec `json:"pow,omitempty"`
+
+	// Transactions must name ChainID, see chainid.go
+	ReplayProtection bool `json:"replayProtection,omitempty"`
+
+	// Applications whose records the chain accepts, see records.go
+	Apps []string `json:"apps,omitempty"`
+
+	// Headers commit to the state after their Block, see statecommit.go
+	StateCommitments bool `json:"stateCommitments,omitempty"`
+
+	// Headers carry a filter of the accounts of their Block, see bloom.go
+	AddressBlooms bool `json:"addressBlooms,omitempty"`
+
+	// Versions of the rules from given heights on, by height, see upgrades.go
+	Upgrades []Upgrade `json:"upgrades,omitempty"`
+
+	// Accounts changing chain parameters on chain, none when unset, see governance.go
+	Governance *GovernanceSpec `json:"governance,omitempty"`
+}
+
+type GenesisValidator struct {
+	Name string `json:"name"` // account the key is bound to
+	Key  []byte `json:"key"`  // uncompressed P-256 public key
+}
+
+// Empty genesis with the given difficulty
+func DefaultGenesis(difficulty int) Genesis {
+	return Genesis{
+		ChainID:    "toychain",
+		Difficulty: difficulty,
+	}
+}
+
+// Read a genesis spec from a JSON file
+func LoadGenesis(path string) (Genesis, error) {
+	var g Genesis
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return g, fmt.Errorf("parsing genesis %v: %w", path, err)
+	}
+	if err := g.checkAddresses(); err != nil {
+		return g, fmt.Errorf("genesis %v: %w", path, err)
+	}
+	if g.Retarget != nil {
+		if err := g.Retarget.check(); err != nil {
+			return g, fmt.Errorf("genesis %v: %w", path, err)
+		}
+	}
+	for _, rule := range g.Rules {
+		if err := rule.check(); err != nil {
+			return g, fmt.Errorf("genesis %v: %w", path, err)
+		}
+	}
+	if g.BlockLimits != nil {
+		if err := g.BlockLimits.check(); err != nil {
+			return g, fmt.Errorf("genesis %v: %w", path, err)
+		}
+	}
+	if err := g.checkFeeAssets(); err != nil {
+		return g, fmt.Errorf("genesis %v: %w", path, err)
+	}
+	if g.Issuance != nil {
+		if err := g.Issuance.check(g.premine()); err != nil {
+			return g, fmt.Errorf("genesis %v: %w", path, err)
+		}
+	}
+	if g.Pow != nil {
+		if err := g.Pow.check(); err != nil {
+			return g, fmt.Errorf("genesis %v: %w", path, err)
+		}
+	}
+	if err := g.checkUpgrades(); err != nil {
+		return g, fmt.Errorf("genesis %v: %w", path, err)
+	}
+	if g.Governance != nil {
+		if err := g.Governance.check(g); err != nil {
+			return g, fmt.Errorf("genesis %v: %w", path, err)
+		}
+	}
+	if g.ReplayProtection && g.ChainID == "" {
+		return g, fmt.Errorf("genesis %v: replay protection needs a chain ID", path)
+	}
+	for _, app := range g.Apps {
+		if RECORD_APPS[app] == nil {
+			return g, fmt.Errorf("genesis %v: unknown app %q, want one of %v", path, app, strings.Join(sortedKeys(RECORD_APPS), ", "))
+		}
+	}
+	return g, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Mint transactions for the allocations, sorted for determinism
+func (g Genesis) allocTxns() []Transaction {
+	txns := []Transaction{}
+	for _, account := range sortedKeys(g.Alloc) {
+		txns = append(txns, Transaction{
+			kind:  TxnMint,
+			payee: account,
+			amt:   g.Alloc[account],
+		})
+	}
+	for _, asset := range sortedKeys(g.Assets) {
+		for _, account := range sortedKeys(g.Assets[asset]) {
+			txns = append(txns, Transaction{
+				kind:  TxnMint,
+				payee: account,
+				asset: asset,
+				amt:   g.Assets[asset][account],
+			})
+		}
+	}
+	return txns
+}
+
+// Mine the genesis Block described by the spec
+func (g Genesis) block() Block {
+	commitment := fmt.Sprintf("%v|%v", g.ChainID, g.Difficulty)
+	for _, v := range g.Validators {
+		commitment += fmt.Sprintf("|%v|%x", v.Name, v.Key)
+	}
+	if g.DevNet {
+		commitment += "|devnet"
+	}
+	if g.AddressPrefix != "" {
+		commitment += "|addresses=" + g.AddressPrefix
+	}
+	if g.Retarget != nil {
+		commitment += "|retarget=" + g.Retarget.String()
+	}
+	for _, rule := range g.Rules {
+		commitment += "|rule=" + rule.String()
+	}
+	if g.BlockLimits != nil {
+		commitment += "|blocklimits=" + g.BlockLimits.String()
+	}
+	if g.FeeOracle != "" {
+		commitment += fmt.Sprintf("|feeassets=%q|feeoracle=%v", g.FeeAssets, g.FeeOracle)
+	}
+	if g.Issuance != nil {
+		commitment += "|issuance=" + g.Issuance.String()
+	}
+	if g.Pow != nil {
+		commitment += "|pow=" + g.Pow.String()
+	}
+	if g.ReplayProtection {
+		commitment += "|replayprotection"
+	}
+	if len(g.Apps) > 0 {
+		commitment += "|apps=" + strings.Join(g.Apps, ",")
+	}
+	if g.StateCommitments {
+		commitment += "|statecommitments"
+	}
+	if g.AddressBlooms {
+		commitment += "|addressblooms"
+	}
+	if g.Governance != nil {
+		commitment += "|governance=" + g.Governance.String()
+	}
+	b := Block{
+		Header: Header{prevHash: SHA256([]byte(commitment)), unixTs: g.UnixTs},
+		data:   g.allocTxns(),
+	}
+	if g.AddressBlooms {
+		b.bloom = addressBloom(b)
+	}
+	b.mine(g.Difficulty, g.Pow)
+	return b
+}
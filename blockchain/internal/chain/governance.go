@@ -0,0 +1,354 @@
+/*
+ * On-chain governance of chain parameters.
+ * A genesis spec declaring a governance lets the chain change some of its
+ * parameters without a new genesis or an upgrade every node must schedule:
+ *
+ *	"governance": {"admin": "treasury", "validators": true, "delay": 10}
+ *
+ * The governors are the admin and, with validators, the validators of the
+ * genesis. The genesis hands each one the key-value namespace
+ * GOVERNANCE_NAMESPACE_PREFIX and its name, see kv.go, where it schedules
+ * the change of a parameter from a height on by writing the new value
+ * under the key param@height, see NewParamChange:
+ *
+ *	reward      coins minted to the miner of each Block, in place of the
+ *	            reward of the issuance, see issuance.go, halvings and
+ *	            supply cap still applying
+ *	blockBytes  most bytes of a Block, see blocksize.go
+ *	blockTxns   most transactions of a Block, 0 for no limit
+ *	difficulty  of the Blocks, on chains without retarget
+ *
+ * A change holds from its height on when the admin wrote it, or when a
+ * majority of the validators wrote the same value, the latest change
+ * holding at each height overriding the genesis and the upgrades. Changes
+ * are scheduled at least delay Blocks ahead, GOVERNANCE_DELAY if 0, so
+ * every node sees them coming, and a governor withdraws or amends one,
+ * deleting or writing its key again, only as long as it is that far
+ * ahead: the changes of the past never move, and the state tells the
+ * parameters at any height. Light clients, holding no state, do not
+ * follow difficulty changes.
+ *
+ *	GET /params  parameters of the next Block and changes scheduled after it
+ */
+package chain
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Key-value namespace of a governor, followed by its name
+const GOVERNANCE_NAMESPACE_PREFIX = "gov/"
+
+// Blocks at least from the write of a change to its height, unless the genesis says otherwise
+const GOVERNANCE_DELAY = 10
+
+// Parameters of a chain with governance
+const (
+	PARAM_REWARD      = "reward"
+	PARAM_BLOCK_BYTES = "blockBytes"
+	PARAM_BLOCK_TXNS  = "blockTxns"
+	PARAM_DIFFICULTY  = "difficulty"
+)
+
+var PARAMS = []string{PARAM_REWARD, PARAM_BLOCK_BYTES, PARAM_BLOCK_TXNS, PARAM_DIFFICULTY}
+
+type GovernanceSpec struct {
+	Admin      string `json:"admin,omitempty"`      // account changing parameters on its own
+	Validators bool   `json:"validators,omitempty"` // a majority of the genesis validators changes them too
+	Delay      int    `json:"delay,omitempty"`      // Blocks at least from a change to its height, GOVERNANCE_DELAY if 0
+}
+
+func (spec *GovernanceSpec) check(g Genesis) error {
+	if spec.Admin == "" && !spec.Validators {
+		return errors.New("governance needs an admin or the validators")
+	}
+	if spec.Validators && len(g.Validators) == 0 {
+		return errors.New("governance by validators needs validators")
+	}
+	if spec.Delay < 0 {
+		return fmt.Errorf("negative governance delay %v", spec.Delay)
+	}
+	for _, governor := range g.governors().accounts() {
+		if len(governanceNamespace(governor)) > MAX_KV_NAMESPACE_SIZE {
+			return fmt.Errorf("governor %v has a name too long for namespace %v", governor, governanceNamespace(governor))
+		}
+	}
+	return nil
+}
+
+// Committed in the genesis hash
+func (spec GovernanceSpec) String() string {
+	return fmt.Sprintf("%q/%v/%v", spec.Admin, spec.Validators, spec.delay())
+}
+
+func (spec *GovernanceSpec) delay() int {
+	if spec.Delay == 0 {
+		return GOVERNANCE_DELAY
+	}
+	return spec.Delay
+}
+
+// Accounts changing the parameters of a chain
+type governors struct {
+	admin      string   // "" for none
+	validators []string // a majority of whom changes them, none for no vote
+}
+
+// Governors of the spec, nil without governance
+func (g Genesis) governors() *governors {
+	if g.Governance == nil {
+		return nil
+	}
+	gov := &governors{admin: g.Governance.Admin}
+	if g.Governance.Validators {
+		for _, v := range g.Validators {
+			gov.validators = append(gov.validators, v.Name)
+		}
+	}
+	return gov
+}
+
+func (gov *governors) accounts() []string {
+	accounts := slices.Clone(gov.validators)
+	if gov.admin != "" && !slices.Contains(accounts, gov.admin) {
+		accounts = append(accounts, gov.admin)
+	}
+	return accounts
+}
+
+func governanceNamespace(governor string) string {
+	return GOVERNANCE_NAMESPACE_PREFIX + governor
+}
+
+func paramKey(param string, height int) string {
+	return fmt.Sprintf("%v@%v", param, height)
+}
+
+// Parameter and height of a key of a governor
+func parseParamKey(key string) (string, int, error) {
+	param, at, ok := strings.Cut(key, "@")
+	height, err := strconv.Atoi(at)
+	if !ok || err != nil || height < 1 {
+		return "", 0, fmt.Errorf("key %q is not param@height", key)
+	}
+	if !slices.Contains(PARAMS, param) {
+		return "", 0, fmt.Errorf("unknown parameter %q, want one of %v", param, strings.Join(PARAMS, ", "))
+	}
+	return param, height, nil
+}
+
+/*
+ * Change of param to value, as written by a governor, from height on. The
+ * reward is an Amount, parsed as one, the other parameters whole numbers
+ */
+func parseParamChange(param string, height int, value []byte) (ParamChange, error) {
+	c := ParamChange{Param: param, Height: height}
+	v, err := strconv.ParseFloat(string(value), 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return c, fmt.Errorf("%v %q is not a number", param, value)
+	}
+	if param == PARAM_REWARD {
+		if c.Reward, err = ParseAmount(string(value)); err != nil {
+			return c, err
+		}
+		if c.Reward < 0 || c.Reward > MAX_AMOUNT {
+			return c, fmt.Errorf("reward %v outside 0..%v", c.Reward, MAX_AMOUNT)
+		}
+		return c, nil
+	}
+	switch {
+	case v != math.Trunc(v):
+		return c, fmt.Errorf("%v %v is not a whole number", param, v)
+	case param == PARAM_BLOCK_BYTES && v <= 0:
+		return c, fmt.Errorf("block limit of %v bytes is not positive", v)
+	case param == PARAM_BLOCK_TXNS && v < 0:
+		return c, fmt.Errorf("block limit of %v transactions is negative", v)
+	case param == PARAM_DIFFICULTY && (v < MIN_RETARGET_DIFFICULTY || v > MAX_RETARGET_DIFFICULTY):
+		return c, fmt.Errorf("difficulty %v outside %v..%v", v, MIN_RETARGET_DIFFICULTY, MAX_RETARGET_DIFFICULTY)
+	}
+	c.Value = v
+	return c, nil
+}
+
+// Write by governor of the change of param, other than the reward, to value from height on
+func NewParamChange(governor string, nonce uint64, param string, value float64, height int) Transaction {
+	return NewKVWrite(governor, nonce, governanceNamespace(governor), paramKey(param, height), []byte(strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+// Write by governor of the change of the reward to reward from height on
+func NewRewardChange(governor string, nonce uint64, reward Amount, height int) Transaction {
+	return NewKVWrite(governor, nonce, governanceNamespace(governor), paramKey(PARAM_REWARD, height), []byte(reward.String()))
+}
+
+// Change of a parameter holding from a height on
+type ParamChange struct {
+	Param  string  `json:"param"`
+	Height int     `json:"height"`
+	Value  float64 `json:"value"` // of the parameters other than the reward
+	Reward Amount  `json:"-"`     // of PARAM_REWARD
+}
+
+// The value of every parameter under value, in coins for the reward
+func (c ParamChange) MarshalJSON() ([]byte, error) {
+	var value any = c.Value
+	if c.Param == PARAM_REWARD {
+		value = c.Reward
+	}
+	return json.Marshal(struct {
+		Param  string `json:"param"`
+		Height int    `json:"height"`
+		Value  any    `json:"value"`
+	}{c.Param, c.Height, value})
+}
+
+// Changes holding in s, written by the admin or a majority of the validators, by height
+func (s *State) paramChanges() []ParamChange {
+	gov := s.governors
+	if gov == nil {
+		return nil
+	}
+	changes := map[ParamChange]bool{}
+	read := func(governor string, found func(ParamChange)) {
+		for key, value := range s.kv[governanceNamespace(governor)] {
+			param, height, err := parseParamKey(key)
+			if err != nil {
+				continue
+			}
+			if c, err := parseParamChange(param, height, value); err == nil {
+				found(c)
+			}
+		}
+	}
+	votes := map[ParamChange]int{}
+	for _, validator := range gov.validators {
+		read(validator, func(c ParamChange) { votes[c]++ })
+	}
+	for c, n := range votes {
+		if 2*n > len(gov.validators) {
+			changes[c] = true
+		}
+	}
+	if gov.admin != "" {
+		// The admin has the last word on a height the validators changed too
+		read(gov.admin, func(c ParamChange) {
+			for other := range changes {
+				if other.Param == c.Param && other.Height == c.Height {
+					delete(changes, other)
+				}
+			}
+			changes[c] = true
+		})
+	}
+	sorted := []ParamChange{}
+	for c := range changes {
+		sorted = append(sorted, c)
+	}
+	slices.SortFunc(sorted, func(a, b ParamChange) int {
+		return cmp.Or(a.Height-b.Height, strings.Compare(a.Param, b.Param))
+	})
+	return sorted
+}
+
+// Latest change of param holding at height, false for none
+func (s *State) paramChange(param string, height int) (ParamChange, bool) {
+	var latest ParamChange
+	found := false
+	for _, c := range s.paramChanges() {
+		if c.Param == param && c.Height <= height {
+			latest, found = c, true
+		}
+	}
+	return latest, found
+}
+
+// Value of param at height set by governance, false if it never changed
+func (s *State) param(param string, height int) (float64, bool) {
+	c, ok := s.paramChange(param, height)
+	return c.Value, ok
+}
+
+// Issuance of the Block at height, its reward changed by governance
+func (s *State) issuanceAt(height int) *IssuanceSpec {
+	c, ok := s.paramChange(PARAM_REWARD, height)
+	if !ok {
+		return s.issuance
+	}
+	spec := IssuanceSpec{Reward: c.Reward}
+	if s.issuance != nil {
+		spec = *s.issuance
+		spec.Reward = c.Reward
+	}
+	return &spec
+}
+
+/*
+ * Refuse writes of governance namespaces not scheduling the change of a
+ * parameter the chain has, to a valid value, at least the delay after the
+ * Block at next
+ */
+func (bc *BlockChain) checkParamChange(txn Transaction, next int) error {
+	w := txn.kv
+	if w == nil || bc.genesis.Governance == nil || !strings.HasPrefix(w.namespace, GOVERNANCE_NAMESPACE_PREFIX) {
+		return nil
+	}
+	param, height, err := parseParamKey(w.key)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTxn, err)
+	}
+	if param == PARAM_DIFFICULTY && bc.genesis.Retarget != nil {
+		return fmt.Errorf("%w: the difficulty follows the hash rate", ErrInvalidTxn)
+	}
+	if delay := bc.genesis.Governance.delay(); height < next+delay {
+		return fmt.Errorf("%w: change of %v at height %v, less than %v blocks after block %v", ErrInvalidTxn, param, height, delay, next)
+	}
+	if len(w.value) > 0 {
+		if _, err := parseParamChange(param, height, w.value); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTxn, err)
+		}
+	}
+	return nil
+}
+
+type ParamsInfo struct {
+	Height     int           `json:"height"` // of the next Block
+	Reward     Amount        `json:"reward"`
+	BlockBytes int           `json:"blockBytes"`
+	BlockTxns  int           `json:"blockTxns"`
+	Difficulty int           `json:"difficulty"`
+	Scheduled  []ParamChange `json:"scheduled"` // changes after Height
+}
+
+// Parameters of the next Block and the changes scheduled after it
+func (bc *BlockChain) Params() ParamsInfo {
+	next := bc.blocks.Len()
+	limits := bc.blockLimits()
+	info := ParamsInfo{
+		Height:     next,
+		Reward:     bc.state.issuanceAt(next).reward(next, bc.state.supply),
+		BlockBytes: limits.Bytes,
+		BlockTxns:  limits.Txns,
+		Difficulty: bc.difficulty,
+		Scheduled:  []ParamChange{},
+	}
+	for _, c := range bc.state.paramChanges() {
+		if c.Height > next {
+			info.Scheduled = append(info.Scheduled, c)
+		}
+	}
+	return info
+}
+
+// GET /params
+func (s *Server) handleParams(w http.ResponseWriter, r *http.Request) {
+	var info ParamsInfo
+	s.node.withChain(func(bc *BlockChain) { info = bc.Params() })
+	writeJSON(w, http.StatusOK, info)
+}
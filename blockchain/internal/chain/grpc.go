@@ -0,0 +1,543 @@
+/*
+ * gRPC API of a Node, described by toychain.proto.
+ * A gRPC call is an HTTP/2 POST to /toychain.ToyChain/<method> whose
+ * bodies are protobuf messages, each prefixed with a compression flag and
+ * its length, the call status coming back in the grpc-status trailer.
+ * The protobuf wire format is encoded by hand for the messages of the
+ * service, so clients generated from toychain.proto in any language talk
+ * to the node without this package depending on a gRPC library.
+ * Compressed messages are refused.
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Max size of a request message
+const MAX_GRPC_MESSAGE = 4 << 20
+
+// gRPC status codes
+const (
+	GRPC_OK                  = 0
+	GRPC_INVALID_ARGUMENT    = 3
+	GRPC_NOT_FOUND           = 5
+	GRPC_PERMISSION_DENIED   = 7
+	GRPC_RESOURCE_EXHAUSTED  = 8
+	GRPC_FAILED_PRECONDITION = 9
+	GRPC_UNIMPLEMENTED       = 12
+	GRPC_INTERNAL            = 13
+)
+
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string {
+	return e.msg
+}
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Protobuf message encoder, fields holding their zero value are skipped
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) tag(field, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|wireType))
+}
+
+func (w *protoWriter) uint(field int, v uint64) {
+	if v != 0 {
+		w.tag(field, wireVarint)
+		w.buf = binary.AppendUvarint(w.buf, v)
+	}
+}
+
+// Amount in base units, an int64
+func (w *protoWriter) amount(field int, v Amount) {
+	w.uint(field, uint64(v))
+}
+
+func (w *protoWriter) bytes(field int, v []byte) {
+	if len(v) > 0 {
+		w.tag(field, wireBytes)
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+		w.buf = append(w.buf, v...)
+	}
+}
+
+func (w *protoWriter) string(field int, v string) {
+	w.bytes(field, []byte(v))
+}
+
+// Embedded message, written even when empty as it may be a repeated entry
+func (w *protoWriter) message(field int, m *protoWriter) {
+	w.tag(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(m.buf)))
+	w.buf = append(w.buf, m.buf...)
+}
+
+// Decoded protobuf message: values by field number, in order of appearance
+type protoMessage map[int][]protoValue
+
+type protoValue struct {
+	num   uint64 // varint and fixed values
+	fixed bool   // num being a fixed64
+	bytes []byte // length-delimited values
+}
+
+func parseProto(buf []byte) (protoMessage, error) {
+	m := make(protoMessage)
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errors.New("bad field key")
+		}
+		buf = buf[n:]
+		field := int(key >> 3)
+		var v protoValue
+		switch key & 7 {
+		case wireVarint:
+			if v.num, n = binary.Uvarint(buf); n <= 0 {
+				return nil, fmt.Errorf("bad varint in field %v", field)
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return nil, fmt.Errorf("truncated field %v", field)
+			}
+			v.num, v.fixed, buf = binary.LittleEndian.Uint64(buf), true, buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return nil, fmt.Errorf("truncated field %v", field)
+			}
+			v.num, buf = uint64(binary.LittleEndian.Uint32(buf)), buf[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || size > uint64(len(buf)-n) {
+				return nil, fmt.Errorf("truncated field %v", field)
+			}
+			v.bytes, buf = buf[n:n+int(size)], buf[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %v in field %v", key&7, field)
+		}
+		m[field] = append(m[field], v)
+	}
+	return m, nil
+}
+
+// Last value of a field, as protobuf merges repeated scalars
+func (m protoMessage) last(field int) protoValue {
+	values := m[field]
+	if len(values) == 0 {
+		return protoValue{}
+	}
+	return values[len(values)-1]
+}
+
+func (m protoMessage) has(field int) bool {
+	return len(m[field]) > 0
+}
+
+func (m protoMessage) uint(field int) uint64 {
+	return m.last(field).num
+}
+
+// Amount of an int64 field of base units, or of a double of coins as BINARY_V1 wrote them
+func (m protoMessage) amount(field int) Amount {
+	if v := m.last(field); v.fixed {
+		return CoinsAmount(math.Float64frombits(v.num))
+	}
+	return Amount(m.uint(field))
+}
+
+func (m protoMessage) string(field int) string {
+	return string(m.last(field).bytes)
+}
+
+func (m protoMessage) messages(field int) ([]protoMessage, error) {
+	messages := []protoMessage{}
+	for _, v := range m[field] {
+		sub, err := parseProto(v.bytes)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, sub)
+	}
+	return messages, nil
+}
+
+// Transaction message, see toychain.proto
+func (txn Transaction) toProto() *protoWriter {
+	w := &protoWriter{}
+	w.string(1, txn.Hash())
+	w.uint(2, uint64(txn.kind))
+	w.string(3, txn.payer)
+	w.string(4, txn.payee)
+	w.string(5, txn.asset)
+	w.amount(6, txn.amt)
+	w.amount(7, txn.fee)
+	w.uint(8, txn.nonce)
+	w.uint(9, txn.gasLimit)
+	w.amount(10, txn.gasPrice)
+	for _, p := range txn.payouts {
+		payout := &protoWriter{}
+		payout.string(1, p.payee)
+		payout.amount(2, p.amt)
+		w.message(11, payout)
+	}
+	if raw, err := json.Marshal(txn.toJSON()); err == nil {
+		w.bytes(15, raw)
+	}
+	return w
+}
+
+func protoTransaction(m protoMessage) (Transaction, error) {
+	if raw := m.last(15).bytes; len(raw) > 0 {
+		var j jsonTxn
+		if err := json.Unmarshal(raw, &j); err != nil {
+			return Transaction{}, fmt.Errorf("json: %w", err)
+		}
+		return j.transaction(), nil
+	}
+	j := jsonTxn{
+		Kind:     TxnKind(m.uint(2)),
+		Payer:    m.string(3),
+		Payee:    m.string(4),
+		Asset:    m.string(5),
+		Amt:      m.amount(6),
+		Fee:      m.amount(7),
+		Nonce:    m.uint(8),
+		GasLimit: m.uint(9),
+		GasPrice: m.amount(10),
+	}
+	payouts, err := m.messages(11)
+	if err != nil {
+		return Transaction{}, err
+	}
+	for _, p := range payouts {
+		j.Payouts = append(j.Payouts, jsonPayout{p.string(1), p.amount(2)})
+	}
+	return j.transaction(), nil
+}
+
+func (m protoMessage) int(field int) int64 {
+	return int64(m.last(field).num)
+}
+
+// Block message, see toychain.proto
+func (b Block) toProto(height int) *protoWriter {
+	w := &protoWriter{}
+	w.uint(1, uint64(height))
+	w.string(2, b.hash)
+	w.string(3, b.prevHash)
+	w.string(4, b.miner)
+	w.uint(5, uint64(b.unixTs))
+	w.uint(6, uint64(b.nonce))
+	for _, txn := range b.data {
+		w.message(7, txn.toProto())
+	}
+	w.string(8, b.merkleRoot)
+	w.uint(9, uint64(b.difficulty))
+	w.uint(10, uint64(b.retarget))
+	w.string(11, b.stateRoot)
+	w.bytes(12, b.bloom)
+	w.uint(13, uint64(b.version))
+	return w
+}
+
+// Block and its height from a Block message
+func protoBlock(m protoMessage) (Block, int, error) {
+	b := Block{
+		Header: Header{
+			prevHash:   m.string(3),
+			merkleRoot: m.string(8),
+			miner:      m.string(4),
+			unixTs:     m.int(5),
+			difficulty: int(m.int(9)),
+			retarget:   int(m.int(10)),
+			stateRoot:  m.string(11),
+			bloom:      m.last(12).bytes,
+			version:    int(m.int(13)),
+			nonce:      int(m.int(6)),
+		},
+		hash: m.string(2),
+	}
+	txns, err := m.messages(7)
+	if err != nil {
+		return Block{}, 0, err
+	}
+	for _, t := range txns {
+		txn, err := protoTransaction(t)
+		if err != nil {
+			return Block{}, 0, err
+		}
+		b.data = append(b.data, txn)
+	}
+	return b, int(m.uint(1)), nil
+}
+
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, &grpcError{GRPC_UNIMPLEMENTED, "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MAX_GRPC_MESSAGE {
+		return nil, &grpcError{GRPC_INVALID_ARGUMENT, fmt.Sprintf("message larger than %v bytes", MAX_GRPC_MESSAGE)}
+	}
+	msg := make([]byte, size)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+func writeGRPCMessage(w http.ResponseWriter, m *protoWriter) error {
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(m.buf)))
+	if _, err := w.Write(append(frame, m.buf...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// Replies of a call made to another node
+type grpcStream struct {
+	resp *http.Response
+}
+
+// Client speaking HTTP/2 without TLS, as gRPC servers expect
+func newGRPCClient() *http.Client {
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	transport.RegisterProtocol("noise", &noiseTransport{h2c: true})
+	return &http.Client{Transport: transport}
+}
+
+// Call method of the node serving baseURL
+func callGRPC(client *http.Client, baseURL, method string, req *protoWriter) (*grpcStream, error) {
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(req.buf)))
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/toychain.ToyChain/"+method,
+		bytes.NewReader(append(frame, req.buf...)))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v: %v", method, resp.Status)
+	}
+	return &grpcStream{resp}, nil
+}
+
+// Next reply, io.EOF once the call ended successfully
+func (s *grpcStream) next() (protoMessage, error) {
+	raw, err := readGRPCMessage(s.resp.Body)
+	if err == io.EOF {
+		if status := s.resp.Trailer.Get("Grpc-Status"); status != strconv.Itoa(GRPC_OK) {
+			code, _ := strconv.Atoi(status)
+			msg, _ := url.PathUnescape(s.resp.Trailer.Get("Grpc-Message"))
+			return nil, &grpcError{code, fmt.Sprintf("status %v: %v", status, msg)}
+		}
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseProto(raw)
+}
+
+func (s *grpcStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// Method of the service: handles the request, sending replies with send
+type grpcMethod func(s *Server, r *http.Request, req protoMessage, send func(*protoWriter) error) error
+
+var grpcMethods = map[string]grpcMethod{
+	"SubmitTransaction": (*Server).grpcSubmitTransaction,
+	"StreamBlocks":      (*Server).grpcStreamBlocks,
+	"GetBlock":          (*Server).grpcGetBlock,
+	"GetBalance":        (*Server).grpcGetBalance,
+	"GetChainInfo":      (*Server).grpcGetChainInfo,
+}
+
+// POST /toychain.ToyChain/{method}
+func (s *Server) handleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeError(w, http.StatusUnsupportedMediaType, "gRPC needs HTTP/2 and an application/grpc body")
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	err := s.serveGRPC(w, r)
+	code := GRPC_OK
+	if err != nil {
+		var grpcErr *grpcError
+		switch status := errorStatus(err); {
+		case errors.As(err, &grpcErr):
+			code = grpcErr.code
+		case status == http.StatusForbidden:
+			code = GRPC_PERMISSION_DENIED
+		case status == http.StatusTooManyRequests:
+			code = GRPC_RESOURCE_EXHAUSTED
+		case status == http.StatusConflict:
+			code = GRPC_FAILED_PRECONDITION
+		case status == http.StatusBadRequest:
+			code = GRPC_INVALID_ARGUMENT
+		default:
+			code = GRPC_INTERNAL
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(err.Error()))
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+}
+
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) error {
+	method, ok := grpcMethods[r.PathValue("method")]
+	if !ok {
+		return &grpcError{GRPC_UNIMPLEMENTED, "unknown method " + r.PathValue("method")}
+	}
+	raw, err := readGRPCMessage(r.Body)
+	if err != nil {
+		var grpcErr *grpcError
+		if errors.As(err, &grpcErr) {
+			return err
+		}
+		return &grpcError{GRPC_INVALID_ARGUMENT, fmt.Sprintf("reading request: %v", err)}
+	}
+	req, err := parseProto(raw)
+	if err != nil {
+		return &grpcError{GRPC_INVALID_ARGUMENT, err.Error()}
+	}
+	return method(s, r, req, func(m *protoWriter) error { return writeGRPCMessage(w, m) })
+}
+
+func (s *Server) grpcSubmitTransaction(r *http.Request, req protoMessage, send func(*protoWriter) error) error {
+	txn, err := protoTransaction(req)
+	if err != nil {
+		return &grpcError{GRPC_INVALID_ARGUMENT, err.Error()}
+	}
+	if _, err := s.node.rateLimit(r, txn); err != nil {
+		return err
+	}
+	if err := s.node.AddTxn(txn); err != nil {
+		return err
+	}
+	reply := &protoWriter{}
+	reply.string(1, txn.Hash())
+	return send(reply)
+}
+
+func (s *Server) grpcGetBlock(r *http.Request, req protoMessage, send func(*protoWriter) error) error {
+	id := req.string(2)
+	if id == "" {
+		id = strconv.FormatUint(req.uint(1), 10)
+	}
+	var reply *protoWriter
+	s.node.withChain(func(bc *BlockChain) {
+		if b, height, found := bc.findBlock(id); found {
+			reply = b.toProto(height)
+		}
+	})
+	if reply == nil {
+		return &grpcError{GRPC_NOT_FOUND, "block not found"}
+	}
+	return send(reply)
+}
+
+func (s *Server) grpcGetBalance(r *http.Request, req protoMessage, send func(*protoWriter) error) error {
+	reply := &protoWriter{}
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		height := bc.blocks.Len() - 1
+		if req.has(3) {
+			height = int(req.uint(3))
+		}
+		var balance Amount
+		var nonce uint64
+		if balance, nonce, err = bc.balanceAt(req.string(1), req.string(2), height); err == nil {
+			reply.amount(1, balance)
+			reply.uint(2, nonce)
+		}
+	})
+	if err != nil {
+		return &grpcError{GRPC_NOT_FOUND, err.Error()}
+	}
+	return send(reply)
+}
+
+func (s *Server) grpcGetChainInfo(r *http.Request, req protoMessage, send func(*protoWriter) error) error {
+	reply := &protoWriter{}
+	s.node.withChain(func(bc *BlockChain) {
+		reply.string(1, bc.ChainID())
+		reply.string(2, bc.GenesisHash())
+		reply.uint(3, uint64(bc.blocks.Len()-1))
+		reply.string(4, bc.lastBlock().hash)
+		reply.uint(5, uint64(bc.difficulty))
+		reply.string(6, bc.state.Root())
+	})
+	return send(reply)
+}
+
+/*
+ * Send the committed Blocks from from_height, then every new Block until
+ * the client goes away. The subscription starts under the chain lock so
+ * no Block falls between the replay and the live ones
+ */
+func (s *Server) grpcStreamBlocks(r *http.Request, req protoMessage, send func(*protoWriter) error) error {
+	var replay []*protoWriter
+	var ch <-chan Event
+	var cancel func()
+	s.node.withChain(func(bc *BlockChain) {
+		ch, cancel = s.node.Subscribe(NewBlock)
+		if from := req.uint(1); from > 0 {
+			for height := int(min(from, uint64(bc.blocks.Len()))); height < bc.blocks.Len(); height++ {
+				replay = append(replay, bc.blockAt(height).toProto(height))
+			}
+		}
+	})
+	defer cancel()
+	for _, b := range replay {
+		if err := send(b); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := send(ev.Block.toProto(ev.Height)); err != nil {
+				return err
+			}
+		}
+	}
+}
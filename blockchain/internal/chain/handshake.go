@@ -0,0 +1,170 @@
+/*
+ * Peer handshake.
+ * A classroom running two networks side by side must not have them mix:
+ * a node relaying to, syncing from or following a node of another chain,
+ * or one speaking an older version of the node API, would silently feed it
+ * transactions and Blocks it cannot use. So nodes greet each other with a
+ * hello on every request a node sends a peer, and on every answer of the
+ * node API, in three headers:
+ *
+ *	Toychain-Protocol: 1      P2P_PROTOCOL_VERSION of the sender
+ *	Toychain-Genesis: 00a1..  genesis hash of the chain it follows
+ *	Toychain-Node: 5f3c..     public key of its NodeIdentity, see noise.go
+ *
+ * A node refuses requests, with 409 Conflict, and answers whose hello names
+ * another genesis, ErrOtherChain, or a protocol below
+ * MIN_PEER_PROTOCOL_VERSION, ErrIncompatiblePeer, and lists such peers as
+ * PEER_OTHER_CHAIN or PEER_INCOMPATIBLE, see peers.go. Requests and answers
+ * without hello, eg. of wallets, curl or nodes predating it, are taken as
+ * before, and a client following no chain, eg. a light client, sends no
+ * genesis.
+ *
+ * Over plaintext HTTP the hello is only a claim. Over Noise it rides an
+ * encrypted connection authenticated by the node key, and a node refuses a
+ * hello naming another key than the one the connection authenticated.
+ * A node started with -http keeps its identity in -node-key, node.key in
+ * -data-dir by default, so its key stays the same across restarts; with
+ * neither, it draws a new key each time it starts.
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	P2P_PROTOCOL_VERSION      = 1 // of the node API nodes talk to each other over
+	MIN_PEER_PROTOCOL_VERSION = 1 // oldest version of peers a node talks to
+)
+
+// Headers of a hello
+const (
+	HELLO_PROTOCOL_HEADER = "Toychain-Protocol"
+	HELLO_GENESIS_HEADER  = "Toychain-Genesis"
+	HELLO_NODE_HEADER     = "Toychain-Node"
+)
+
+type hello struct {
+	protocol int
+	genesis  string // "" when following no chain
+	node     []byte // nil without identity
+}
+
+var (
+	localChainMu sync.Mutex
+	localChain   string
+)
+
+// Genesis hash greeting the peers the process sends requests to, none unless set
+func SetNodeChain(genesisHash string) {
+	localChainMu.Lock()
+	defer localChainMu.Unlock()
+	localChain = genesisHash
+}
+
+// Hello of this process following genesis, "" for none
+func newHello(genesis string) hello {
+	h := hello{protocol: P2P_PROTOCOL_VERSION, genesis: genesis}
+	localIdentityMu.Lock()
+	defer localIdentityMu.Unlock()
+	if localIdentity != nil {
+		h.node = localIdentity.PublicKey()
+	}
+	return h
+}
+
+// Hello the process sends its peers
+func localHello() hello {
+	localChainMu.Lock()
+	genesis := localChain
+	localChainMu.Unlock()
+	return newHello(genesis)
+}
+
+func (h hello) write(header http.Header) {
+	header.Set(HELLO_PROTOCOL_HEADER, strconv.Itoa(h.protocol))
+	if h.genesis != "" {
+		header.Set(HELLO_GENESIS_HEADER, h.genesis)
+	}
+	if h.node != nil {
+		header.Set(HELLO_NODE_HEADER, hex.EncodeToString(h.node))
+	}
+}
+
+// Hello in header, false if it carries none
+func readHello(header http.Header) (hello, bool, error) {
+	protocol := header.Get(HELLO_PROTOCOL_HEADER)
+	if protocol == "" {
+		return hello{}, false, nil
+	}
+	h := hello{genesis: header.Get(HELLO_GENESIS_HEADER)}
+	var err error
+	if h.protocol, err = strconv.Atoi(protocol); err != nil {
+		return h, true, fmt.Errorf("%w: protocol %q", ErrIncompatiblePeer, protocol)
+	}
+	if node := header.Get(HELLO_NODE_HEADER); node != "" {
+		if h.node, err = hex.DecodeString(node); err != nil || len(h.node) != 32 {
+			return h, true, fmt.Errorf("%w: node key %q is not 32 bytes of hex", ErrIncompatiblePeer, node)
+		}
+	}
+	return h, true, nil
+}
+
+// Check the hello of a peer is one local talks to
+func (local hello) accept(peer hello) error {
+	if peer.protocol < MIN_PEER_PROTOCOL_VERSION {
+		return fmt.Errorf("%w: peer speaks version %v, this node talks to %v and above", ErrIncompatiblePeer, peer.protocol, MIN_PEER_PROTOCOL_VERSION)
+	}
+	if local.genesis != "" && peer.genesis != "" && peer.genesis != local.genesis {
+		return fmt.Errorf("%w: peer has genesis %v, expected %v", ErrOtherChain, peer.genesis, local.genesis)
+	}
+	return nil
+}
+
+/*
+ * RoundTripper greeting peers with the hello of the process and refusing
+ * answers with an unacceptable hello, in-process nodes included, see
+ * testnet.go
+ */
+type helloTransport struct{}
+
+func (helloTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	local := localHello()
+	req = req.Clone(req.Context())
+	local.write(req.Header)
+	resp, err := roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	peer, ok, err := readHello(resp.Header)
+	if err == nil && ok {
+		err = local.accept(peer)
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v: %w", req.URL.Host, err)
+	}
+	return resp, nil
+}
+
+// Greet the client with the hello of s, refusing its request if its hello is unacceptable
+func (s *Server) greet(w http.ResponseWriter, r *http.Request) error {
+	s.hello.write(w.Header())
+	peer, ok, err := readHello(r.Header)
+	if err != nil || !ok {
+		return err
+	}
+	if err := s.hello.accept(peer); err != nil {
+		return err
+	}
+	// Over Noise, the key of the hello must be the one the handshake authenticated
+	if key := noisePeerKey(r.Context()); key != nil && peer.node != nil && !bytes.Equal(key, peer.node) {
+		return fmt.Errorf("%w: hello names node %x, connection authenticated %x", ErrIncompatiblePeer, peer.node, key)
+	}
+	return nil
+}
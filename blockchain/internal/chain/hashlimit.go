@@ -0,0 +1,66 @@
+/*
+ * Hash rate limit.
+ * Nodes run side by side on one machine mine as fast as the CPU lets them,
+ * so in a fork or 51% attack demo the process the scheduler favours wins,
+ * whatever part it plays. A BlockChain mining with a hash limit, see
+ * -hash-limit, tries at most that many nonces per second, sleeping
+ * between batches of tries: nodes limited to 1000 and 3000 H/s hold a
+ * quarter and three quarters of the hash power of their network, as long
+ * as the machine sustains the sum. The hash rate of GET /stats and -top
+ * shows whether it does.
+ *
+ * The limit only slows the Blocks the node mines itself: it is no
+ * consensus rule, and the Blocks of other miners are checked at full speed.
+ */
+package chain
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Waits of a limited miner per second, so the tries spread evenly
+const HASH_LIMIT_WAITS = 100
+
+// Pace of the tries of one Block
+type hashLimiter struct {
+	rate  float64 // tries per second
+	batch int     // tries between two waits
+	start time.Time
+	tries int
+}
+
+func newHashLimiter(rate float64) *hashLimiter {
+	if rate == 0 {
+		return nil
+	}
+	return &hashLimiter{rate: rate, batch: max(1, int(rate/HASH_LIMIT_WAITS)), start: time.Now()}
+}
+
+// Count a try, sleeping every batch of tries while ahead of the rate
+func (l *hashLimiter) try() {
+	if l == nil {
+		return
+	}
+	if l.tries++; l.tries%l.batch != 0 {
+		return
+	}
+	due := l.start.Add(time.Duration(float64(l.tries) / l.rate * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Try at most rate nonces per second when mining, 0 for no limit
+func (bc *BlockChain) SetHashLimit(rate float64) error {
+	if rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return fmt.Errorf("hash limit %v is not a rate", rate)
+	}
+	bc.hashLimit = rate
+	return nil
+}
+
+func (bc *BlockChain) HashLimit() float64 {
+	return bc.hashLimit
+}
@@ -0,0 +1,354 @@
+/*
+ * Hierarchical deterministic wallets.
+ * A mnemonic of 12 to 24 words from the BIP-39 English wordlist encodes
+ * 128 to 256 bits of entropy plus a checksum, and turns into a 512 bits
+ * seed with PBKDF2, salted with an optional passphrase. The seed derives a
+ * tree of P-256 keys following BIP-32 as adapted to P-256 by SLIP-10, each
+ * node named by its path from the master key m:
+ *
+ *	m/44'/1'/0'/0/7    the 8th key of the first account
+ *
+ * An index with ' is hardened: its key derives from the private parent key
+ * only, so a leaked child key and the parent chain code do not reveal the
+ * parent. Mnemonics and seeds are interchangeable with other BIP-39 tools,
+ * keys are not with Bitcoin wallets, those deriving secp256k1 keys.
+ *
+ * Accounts of derived Wallets are their address on the network, see
+ * address.go, so one seed yields as many accounts as needed and recovers
+ * them all.
+ */
+package chain
+
+import (
+	"bufio"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	MNEMONIC_ROUNDS = 2048             // PBKDF2 iterations of the seed
+	HD_HARDENED     = 1 << 31          // first hardened index
+	HD_DEFAULT_PATH = "m/44'/1'/0'/0"  // parent of the addresses, 1 being the testnet coin type
+	HD_SEED_KEY     = "Nist256p1 seed" // SLIP-10 HMAC key of the master key
+)
+
+//go:embed wordlist/english.txt
+var englishWordlist string
+
+var (
+	mnemonicWords = strings.Fields(englishWordlist)
+	mnemonicIndex = func() map[string]int {
+		index := make(map[string]int, len(mnemonicWords))
+		for i, word := range mnemonicWords {
+			index[word] = i
+		}
+		return index
+	}()
+)
+
+// Mnemonic of bits of fresh entropy, 128 for 12 words up to 256 for 24
+func NewMnemonic(bits int) (string, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", fmt.Errorf("%w: %v bits of entropy, need 128 to 256 by steps of 32", ErrInvalidMnemonic, bits)
+	}
+	entropy := make([]byte, bits/8)
+	rand.Read(entropy)
+	return entropyMnemonic(entropy), nil
+}
+
+// Words of entropy followed by a checksum of len(entropy)/4 bits, 11 bits a word
+func entropyMnemonic(entropy []byte) string {
+	sum := sha256.Sum256(entropy)
+	data := append(append([]byte{}, entropy...), sum[0])
+	words := make([]string, (len(entropy)*8+len(entropy)/4)/11)
+	for i := range words {
+		index := 0
+		for b := i * 11; b < (i+1)*11; b++ {
+			index = index<<1 | int(data[b/8]>>(7-b%8)&1)
+		}
+		words[i] = mnemonicWords[index]
+	}
+	return strings.Join(words, " ")
+}
+
+// Check the words and checksum of mnemonic, returning its entropy
+func mnemonicEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: %v words, need 12, 15, 18, 21 or 24", ErrInvalidMnemonic, len(words))
+	}
+	data := make([]byte, (len(words)*11+7)/8)
+	for i, word := range words {
+		index, ok := mnemonicIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not in the wordlist", ErrInvalidMnemonic, word)
+		}
+		for b := range 11 {
+			if index>>(10-b)&1 == 1 {
+				data[(i*11+b)/8] |= 1 << (7 - (i*11+b)%8)
+			}
+		}
+	}
+	entropy := data[:len(words)*4/3]
+	if entropyMnemonic(entropy) != strings.Join(words, " ") {
+		return nil, fmt.Errorf("%w: checksum mismatch, a word is wrong or out of order", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+func ValidateMnemonic(mnemonic string) error {
+	_, err := mnemonicEntropy(mnemonic)
+	return err
+}
+
+/*
+ * Seed of mnemonic and passphrase, as BIP-39 without the Unicode
+ * normalization: the words are ASCII, a passphrase with accents must be
+ * typed the same way each time
+ */
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key(sha512.New, normalized, []byte("mnemonic"+passphrase), MNEMONIC_ROUNDS, 64)
+}
+
+// Node of the key tree: a private key and the chain code deriving its children
+type HDKey struct {
+	key       []byte // 32 bytes scalar, never 0 nor above the order
+	chainCode []byte
+	path      string
+}
+
+// Master key of seed, the root m of the paths
+func NewMasterKey(seed []byte) (*HDKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed of %v bytes, need 16 to 64", len(seed))
+	}
+	data := seed
+	for {
+		i := hmacSHA512([]byte(HD_SEED_KEY), data)
+		if validScalar(i[:32]) {
+			return &HDKey{key: i[:32], chainCode: i[32:], path: "m"}, nil
+		}
+		data = i
+	}
+}
+
+// Master key of a mnemonic
+func MnemonicMasterKey(mnemonic, passphrase string) (*HDKey, error) {
+	seed, err := MnemonicSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewMasterKey(seed)
+}
+
+func (k *HDKey) Path() string {
+	return k.path
+}
+
+// Child at index, hardened from HD_HARDENED on
+func (k *HDKey) Child(index uint32) (*HDKey, error) {
+	var data []byte
+	if index >= HD_HARDENED {
+		data = append([]byte{0}, k.key...)
+	} else {
+		pub, err := k.compressedPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		data = pub
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	n := elliptic.P256().Params().N
+	for {
+		i := hmacSHA512(k.chainCode, data)
+		// Out of range, SLIP-10 derives again from the right half rather than skip the index
+		if validScalar(i[:32]) {
+			child := new(big.Int).SetBytes(i[:32])
+			child.Add(child, new(big.Int).SetBytes(k.key)).Mod(child, n)
+			if child.Sign() != 0 {
+				return &HDKey{key: child.FillBytes(make([]byte, 32)), chainCode: i[32:], path: k.path + "/" + formatHDIndex(index)}, nil
+			}
+		}
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, i[32:]...), index)
+	}
+}
+
+// Descendant at path, from m or relative to k
+func (k *HDKey) Derive(path string) (*HDKey, error) {
+	indexes, absolute, err := parseHDPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if absolute && k.path != "m" {
+		return nil, fmt.Errorf("%w: %v is absolute, %v is not the master key", ErrInvalidPath, path, k.path)
+	}
+	for _, index := range indexes {
+		if k, err = k.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Wallet of the key, its account being its address on the network of prefix
+func (k *HDKey) Wallet(prefix string) (*Wallet, error) {
+	key, err := parseP256Key(k.key)
+	if err != nil {
+		return nil, err
+	}
+	w := &Wallet{key: key, path: k.path}
+	w.account = w.Address(prefix)
+	return w, nil
+}
+
+/*
+ * Wallets of the count children of path from first on, eg. the addresses
+ * m/44'/1'/0'/0/0 to m/44'/1'/0'/0/4 of HD_DEFAULT_PATH
+ */
+func (k *HDKey) Wallets(path string, first, count int, prefix string) ([]*Wallet, error) {
+	parent, err := k.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	if first < 0 || count < 0 || first+count > HD_HARDENED {
+		return nil, fmt.Errorf("%w: children %v to %v", ErrInvalidPath, first, first+count-1)
+	}
+	wallets := make([]*Wallet, count)
+	for i := range wallets {
+		child, err := parent.Child(uint32(first + i))
+		if err != nil {
+			return nil, err
+		}
+		if wallets[i], err = child.Wallet(prefix); err != nil {
+			return nil, err
+		}
+	}
+	return wallets, nil
+}
+
+// Public key as a compressed SEC 1 point, the parent data of unhardened children
+func (k *HDKey) compressedPublicKey() ([]byte, error) {
+	key, err := parseP256Key(k.key)
+	if err != nil {
+		return nil, err
+	}
+	pub := p256PublicKey(&key.PublicKey)
+	// Uncompressed is 04 | X | Y, compressed 02 or 03 after the parity of Y, then X
+	return append([]byte{2 + pub[64]&1}, pub[1:33]...), nil
+}
+
+// Indexes of path, m/44'/1'/0'/0 or relative 0/7, and whether it starts at m
+func parseHDPath(path string) ([]uint32, bool, error) {
+	parts := strings.Split(path, "/")
+	absolute := parts[0] == "m"
+	if absolute {
+		parts = parts[1:]
+	}
+	indexes := make([]uint32, 0, len(parts))
+	for _, part := range parts {
+		digits, hardened := strings.CutSuffix(part, "'")
+		if !hardened {
+			digits, hardened = strings.CutSuffix(part, "h")
+		}
+		index, err := strconv.ParseUint(digits, 10, 31)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %q in %v", ErrInvalidPath, part, path)
+		}
+		if hardened {
+			index += HD_HARDENED
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, absolute, nil
+}
+
+func formatHDIndex(index uint32) string {
+	if index >= HD_HARDENED {
+		return strconv.Itoa(int(index-HD_HARDENED)) + "'"
+	}
+	return strconv.Itoa(int(index))
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Whether b is a valid private key, above 0 and below the order of P-256
+func validScalar(b []byte) bool {
+	s := new(big.Int).SetBytes(b)
+	return s.Sign() > 0 && s.Cmp(elliptic.P256().Params().N) < 0
+}
+
+/*
+ * Print a new mnemonic, or the addresses of count children of path for the
+ * mnemonic in $TOYCHAIN_MNEMONIC or the first line of stdin, salted with
+ * $TOYCHAIN_MNEMONIC_PASSPHRASE, as addresses of prefix. Returns the exit code
+ */
+func runHDWallet(newMnemonic bool, path string, count int, prefix string, out *Output) int {
+	if newMnemonic {
+		mnemonic, err := NewMnemonic(128)
+		if err == nil {
+			err = out.Record([][2]string{{"mnemonic", mnemonic}}, map[string]string{"mnemonic": mnemonic})
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+	mnemonic, ok := os.LookupEnv("TOYCHAIN_MNEMONIC")
+	if !ok {
+		fmt.Fprint(os.Stderr, "mnemonic: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Printf("reading mnemonic: %v", err)
+			return 1
+		}
+		mnemonic = line
+	}
+	master, err := MnemonicMasterKey(mnemonic, os.Getenv("TOYCHAIN_MNEMONIC_PASSPHRASE"))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	wallets, err := master.Wallets(path, 0, count, prefix)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	type jsonAddress struct {
+		Address   string `json:"address"`
+		Path      string `json:"path"`
+		PublicKey string `json:"publicKey"`
+	}
+	rows, view := [][]string{}, []jsonAddress{}
+	for _, w := range wallets {
+		a := jsonAddress{w.Account(), w.Path(), hex.EncodeToString(w.PublicKey())}
+		rows = append(rows, []string{a.Address, a.Path, a.PublicKey})
+		view = append(view, a)
+	}
+	if err := out.Table([]string{"address", "path", "public key"}, rows, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+/*
+ * Historic state queries.
+ * WithHeight answers state questions as of any committed Block by
+ * replaying Blocks onto an earlier state. In archive mode the chain keeps
+ * a copy of the state every ARCHIVE_INTERVAL Blocks, so a query replays at
+ * most that many Blocks; otherwise it replays from genesis.
+ */
+package chain
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Blocks between two states kept in archive mode
+const ARCHIVE_INTERVAL = 100
+
+// Read-only state as of a Block
+type StateView struct {
+	state  *State
+	height int
+}
+
+/*
+ * Keep a copy of the state every ARCHIVE_INTERVAL Blocks, replaying the
+ * chain once to archive the Blocks already committed
+ */
+func (bc *BlockChain) SetArchive(on bool) error {
+	if !on {
+		bc.archive = nil
+		return nil
+	}
+	bc.archive = map[int]*State{0: bc.genesis.state(bc.blockAt(0))}
+	state, start := bc.archive[0].clone(), 1
+	if bc.pruned > 1 {
+		state, start = bc.prunedState.clone(), bc.pruned
+	}
+	for height := start; height < bc.blocks.Len(); height++ {
+		if err := state.replay(bc.blockAt(height)); err != nil {
+			return fmt.Errorf("archiving block %v: %w", height, err)
+		}
+		if height%ARCHIVE_INTERVAL == 0 {
+			if err := bc.checkStateRoot(height, state); err != nil {
+				return err
+			}
+			bc.archive[height] = state.clone()
+		}
+	}
+	return nil
+}
+
+// Apply a committed Block, which was validated when it was appended
+func (s *State) replay(b Block) error {
+	if err := s.applyParallel(b.data); err != nil {
+		return err
+	}
+	s.payMiner(b)
+	return nil
+}
+
+// State as of the Block at height
+func (bc *BlockChain) WithHeight(height int) (*StateView, error) {
+	tip := bc.blocks.Len() - 1
+	if height < 0 || height > tip {
+		return nil, fmt.Errorf("%w: %v, chain height %v", ErrUnknownHeight, height, tip)
+	}
+	if height == tip {
+		return bc.latest(), nil
+	}
+	from := 0
+	state := bc.genesis.state(bc.blockAt(0))
+	if bc.pruned > 1 {
+		if height < bc.pruned-1 {
+			return nil, fmt.Errorf("%w: no state before height %v", ErrPruned, bc.pruned-1)
+		}
+		from, state = bc.pruned-1, bc.prunedState.clone()
+	}
+	if bc.archive != nil {
+		if a, ok := bc.archive[height-height%ARCHIVE_INTERVAL]; ok && height-height%ARCHIVE_INTERVAL > from {
+			from, state = height-height%ARCHIVE_INTERVAL, a.clone()
+		}
+	}
+	for h := from + 1; h <= height; h++ {
+		if err := state.replay(bc.blockAt(h)); err != nil {
+			return nil, fmt.Errorf("replaying block %v: %w", h, err)
+		}
+	}
+	if err := bc.checkStateRoot(height, state); err != nil {
+		return nil, err
+	}
+	return &StateView{state, height}, nil
+}
+
+// State after the last Block
+func (bc *BlockChain) latest() *StateView {
+	return &StateView{bc.state, bc.blocks.Len() - 1}
+}
+
+func (v *StateView) Height() int {
+	return v.height
+}
+
+func (v *StateView) Root() string {
+	return v.state.Root()
+}
+
+func (v *StateView) Balance(account, asset string) Amount {
+	return v.state.Balance(account, asset)
+}
+
+func (v *StateView) Nonce(account string) uint64 {
+	return v.state.nonce(account)
+}
+
+func (v *StateView) GetKV(namespace, key string) ([]byte, bool) {
+	return v.state.getKV(namespace, key)
+}
+
+func (v *StateView) NamespaceOwner(namespace string) string {
+	return v.state.namespaces[namespace]
+}
+
+func (v *StateView) UTXOs(owner string) []UTXO {
+	return v.state.utxosOf(owner)
+}
+
+// State as of the ?height= of r, the latest state when absent
+func requestView(bc *BlockChain, r *http.Request) (*StateView, error) {
+	param := r.URL.Query().Get("height")
+	if param == "" {
+		return bc.latest(), nil
+	}
+	height, err := strconv.Atoi(param)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownHeight, param)
+	}
+	return bc.WithHeight(height)
+}
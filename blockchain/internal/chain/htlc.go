@@ -0,0 +1,294 @@
+/*
+ * Hash time-locked contracts and atomic swaps.
+ * An HTLC pays the receiver whoever shows the preimage of a hash, or pays
+ * the sender back from a timeout on. Built like a payment channel, see
+ * channels.go, on a multisig account, see multisig.go, a script, see
+ * script.go, and a time lock, see timelocks.go:
+ *
+ *	- the HTLC account, named after its ID, is declared a 2-of-2 multisig
+ *	  of the sender and the receiver, see Declare
+ *	- both sign the Refund, paying the amount back to the sender from the
+ *	  height of the timeout on, and the sender signs the Redeem, paying it
+ *	  to the receiver under the script SHA256 <hash lock> EQUAL. Only then
+ *	  does the sender Fund the account
+ *	- the receiver adds its signature and the preimage, the witness of the
+ *	  script, to the Redeem and submits it before the timeout, see Claim,
+ *	  telling the preimage to whoever reads the chain, see Secret
+ *
+ * The script is covered by the signatures, the witness is not: the sender
+ * signs the Redeem not knowing who will learn the preimage. The Redeem and
+ * the Refund spend the same nonce of the HTLC account, so only one applies.
+ *
+ * Two HTLCs under the same hash lock on two chains swap their coins
+ * atomically. Alice, holding the secret, locks her coins on chain A for bob
+ * until a late timeout, and bob locks his on chain B for alice until an
+ * earlier one. Alice claims bob's coins on chain B before its timeout,
+ * revealing the secret there, and bob claims hers on chain A with it. Should
+ * alice never claim, both take their coins back after the timeouts; should
+ * bob never lock, alice takes hers back. Bob's timeout being the earlier,
+ * alice cannot wait until it passes to claim, leaving bob no time. The
+ * chain ID of each spec binds its transactions to its chain, see chainid.go.
+ *
+ *	GET /demo/swap  steps of the demo of -swap-demo
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Prefix of the name of the HTLC accounts, followed by the HTLC ID
+const HTLC_ACCOUNT_PREFIX = "htlc-"
+
+// Terms the sender and the receiver agree on before funding an HTLC
+type HTLCSpec struct {
+	ID          string    `json:"id"`
+	Sender      string    `json:"sender"`
+	SenderKey   []byte    `json:"senderKey"`
+	Receiver    string    `json:"receiver"`
+	ReceiverKey []byte    `json:"receiverKey"`
+	Asset       string    `json:"asset,omitempty"` // NATIVE_ASSET for the chain's coin
+	Amount      Amount    `json:"amount"`
+	HashLock    []byte    `json:"hashLock"`          // SHA-256 of the secret, see HashSecret
+	Timeout     int       `json:"timeout"`           // height the refund unlocks at
+	Scheme      SigScheme `json:"scheme,omitempty"`  // of the keys
+	ChainID     string    `json:"chainId,omitempty"` // of the chain of the HTLC, see chainid.go
+}
+
+// Hash lock of a secret
+func HashSecret(secret []byte) []byte {
+	hash := sha256.Sum256(secret)
+	return hash[:]
+}
+
+func (s HTLCSpec) check() error {
+	if s.ID == "" || s.Sender == s.Receiver {
+		return errors.New("an HTLC needs an ID and two parties")
+	}
+	if bytes.Equal(s.SenderKey, s.ReceiverKey) {
+		return errors.New("the parties of an HTLC need their own keys")
+	}
+	if !(s.Amount > 0) || s.Timeout < 1 {
+		return errors.New("an HTLC needs a positive amount and timeout")
+	}
+	if len(s.HashLock) != sha256.Size {
+		return fmt.Errorf("hash lock of %v bytes, not %v", len(s.HashLock), sha256.Size)
+	}
+	return nil
+}
+
+// Account holding the amount
+func (s HTLCSpec) Account() string {
+	return HTLC_ACCOUNT_PREFIX + s.ID
+}
+
+func (s HTLCSpec) bind(txn Transaction) Transaction {
+	return txn.WithScheme(s.Scheme).WithChainID(s.ChainID)
+}
+
+// Make the HTLC account a 2-of-2 multisig of the parties, first of all
+func (s HTLCSpec) Declare() Transaction {
+	return s.bind(NewMultisig(s.Account(), 0, 2, s.SenderKey, s.ReceiverKey))
+}
+
+// Move the amount to the HTLC account, once the refund and the redeem are signed
+func (s HTLCSpec) Fund(nonce uint64) Transaction {
+	return s.bind(Transaction{payer: s.Sender, payee: s.Account(), asset: s.Asset, amt: s.Amount, nonce: nonce})
+}
+
+// Amount back to the sender, locked until the timeout, to be cosigned by both parties
+func (s HTLCSpec) Refund() Transaction {
+	return s.bind(Transaction{payer: s.Account(), payee: s.Sender, asset: s.Asset, amt: s.Amount, nonce: 1}.WithLockHeight(s.Timeout))
+}
+
+// Amount to the receiver against the preimage of the hash lock, to be cosigned by both parties
+func (s HTLCSpec) Redeem() Transaction {
+	txn := Transaction{payer: s.Account(), payee: s.Receiver, asset: s.Asset, amt: s.Amount, nonce: 1}
+	return s.bind(txn.WithScript("SHA256 0x" + hex.EncodeToString(s.HashLock) + " EQUAL"))
+}
+
+// Redeem signed by the sender, completed with the signature of the receiver and secret
+func (s HTLCSpec) Claim(redeem Transaction, receiver Signer, secret []byte) (Transaction, error) {
+	if redeem.payer != s.Account() || redeem.script == nil {
+		return Transaction{}, fmt.Errorf("not a redeem of HTLC %v", s.ID)
+	}
+	// The redeem signed by the sender stays as it is, for other claims
+	script := *redeem.script
+	redeem.script = &script
+	redeem.cosigs = slices.Clone(redeem.cosigs)
+	if err := redeem.CoSign(receiver); err != nil {
+		return Transaction{}, err
+	}
+	if err := redeem.PushWitness(secret); err != nil {
+		return Transaction{}, err
+	}
+	return redeem, nil
+}
+
+// Secret told by a redeem of the HTLC in b, false if b has none
+func (s HTLCSpec) Secret(b Block) ([]byte, bool) {
+	for _, txn := range b.data {
+		if txn.payer != s.Account() || txn.script == nil || len(txn.script.witness) == 0 {
+			continue
+		}
+		if secret := txn.script.witness[0]; bytes.Equal(HashSecret(secret), s.HashLock) {
+			return secret, true
+		}
+	}
+	return nil, false
+}
+
+type SwapStep struct {
+	Description string `json:"description"`
+	Chain       string `json:"chain,omitempty"` // ID of the chain a Block was submitted to, "" for a step between the parties
+	Txn         string `json:"txn,omitempty"`   // hash of the transaction submitted
+	Accepted    bool   `json:"accepted"`        // by the chain, or by the party
+	Reason      string `json:"reason,omitempty"`
+
+	AliceA Amount `json:"aliceA"` // balances on chain A
+	BobA   Amount `json:"bobA"`
+	AliceB Amount `json:"aliceB"` // balances on chain B
+	BobB   Amount `json:"bobB"`
+}
+
+func swapGenesis(chainID, holder string) Genesis {
+	g := DefaultGenesis(2)
+	g.ChainID = chainID
+	g.Alloc = map[string]Amount{holder: 100 * COIN}
+	return g
+}
+
+/*
+ * Swap coins of alice on chain A for coins of bob on chain B with two HTLCs,
+ * bob trying to claim without the secret and alice trying to take hers back
+ * early along the way, each step recording whether the chain, or the party,
+ * accepted it
+ */
+func RunSwapDemo() ([]SwapStep, error) {
+	alice, err := NewWallet("alice")
+	if err != nil {
+		return nil, err
+	}
+	bob, err := NewWallet("bob")
+	if err != nil {
+		return nil, err
+	}
+	chainA := newFixtureBuilder("swap-a", swapGenesis("swap-a", "alice"))
+	chainB := newFixtureBuilder("swap-b", swapGenesis("swap-b", "bob"))
+	secret := []byte("alice's secret")
+	specA := HTLCSpec{
+		ID: "alice-bob", Sender: "alice", SenderKey: alice.PublicKey(), Receiver: "bob", ReceiverKey: bob.PublicKey(),
+		Amount: 30 * COIN, HashLock: HashSecret(secret), Timeout: 20, ChainID: chainA.bc.ChainID(),
+	}
+	specB := HTLCSpec{
+		ID: "bob-alice", Sender: "bob", SenderKey: bob.PublicKey(), Receiver: "alice", ReceiverKey: alice.PublicKey(),
+		Amount: 20 * COIN, HashLock: specA.HashLock, Timeout: 10, ChainID: chainB.bc.ChainID(),
+	}
+	if err := errors.Join(specA.check(), specB.check()); err != nil {
+		return nil, err
+	}
+
+	steps := []SwapStep{}
+	record := func(description string, fb *fixtureBuilder, txn *Transaction, err error) {
+		step := SwapStep{
+			Description: description,
+			Accepted:    err == nil,
+			AliceA:      chainA.bc.Balance("alice", specA.Asset),
+			BobA:        chainA.bc.Balance("bob", specA.Asset),
+			AliceB:      chainB.bc.Balance("alice", specB.Asset),
+			BobB:        chainB.bc.Balance("bob", specB.Asset),
+		}
+		if fb != nil {
+			step.Chain = fb.bc.ChainID()
+		}
+		if txn != nil {
+			step.Txn = txn.Hash()
+		}
+		if err != nil {
+			step.Reason = err.Error()
+		}
+		steps = append(steps, step)
+	}
+	submit := func(description string, fb *fixtureBuilder, txn Transaction) {
+		err := fb.bc.appendBlock(fb.mine(txn))
+		record(description, fb, &txn, err)
+	}
+	// Refund cosigned by the receiver then the sender, and redeem signed by the sender
+	sign := func(spec HTLCSpec, sender, receiver Signer) (Transaction, Transaction, error) {
+		refund, redeem := spec.Refund(), spec.Redeem()
+		err := errors.Join(refund.CoSign(receiver), refund.CoSign(sender), redeem.CoSign(sender))
+		return refund, redeem, err
+	}
+
+	record("alice picks a secret and tells bob its hash", nil, nil, nil)
+	submit("HTLC account on chain A declared a 2-of-2 multisig of alice and bob", chainA, specA.Declare())
+	refundA, redeemA, err := sign(specA, alice, bob)
+	record(fmt.Sprintf("bob and alice sign the refund, locked until height %v, and alice the redeem to bob", specA.Timeout), nil, nil, err)
+	submit(fmt.Sprintf("alice locks %v in the HTLC on chain A", specA.Amount), chainA, specA.Fund(0))
+	submit("HTLC account on chain B declared a 2-of-2 multisig of bob and alice", chainB, specB.Declare())
+	refundB, redeemB, err := sign(specB, bob, alice)
+	record(fmt.Sprintf("alice and bob sign the refund, locked until height %v, and bob the redeem to alice", specB.Timeout), nil, nil, err)
+	submit(fmt.Sprintf("bob locks %v in the HTLC on chain B under the same hash", specB.Amount), chainB, specB.Fund(0))
+
+	guess, err := specA.Claim(redeemA, bob, []byte("bob's guess"))
+	if err != nil {
+		return nil, err
+	}
+	submit("bob claims alice's coins with a guess of the secret", chainA, guess)
+	claimB, err := specB.Claim(redeemB, alice, secret)
+	if err != nil {
+		return nil, err
+	}
+	submit("alice claims bob's coins with the secret", chainB, claimB)
+	learnt, ok := specB.Secret(*chainB.bc.lastBlock())
+	var lookup error
+	if !ok {
+		lookup = errors.New("no redeem of the HTLC in the last block")
+	}
+	record("bob reads the secret off chain B", nil, nil, lookup)
+	submit("alice takes her coins back before the timeout", chainA, refundA)
+	claimA, err := specA.Claim(redeemA, bob, learnt)
+	if err != nil {
+		return nil, err
+	}
+	submit("bob claims alice's coins with the secret", chainA, claimA)
+	for chainB.bc.blocks.Len() < specB.Timeout {
+		if err := chainB.bc.appendBlock(chainB.mine()); err != nil {
+			return nil, err
+		}
+	}
+	submit("bob takes his coins back after the timeout", chainB, refundB)
+	return steps, nil
+}
+
+func printSwapDemo(out *Output, steps []SwapStep) error {
+	rows := [][]string{}
+	for _, step := range steps {
+		where, verdict := "off chain", "accepted"
+		if step.Chain != "" {
+			where = step.Chain
+		}
+		if !step.Accepted {
+			verdict = "rejected: " + step.Reason
+		}
+		rows = append(rows, []string{step.Description, where, verdict,
+			fmt.Sprint(step.AliceA), fmt.Sprint(step.BobA), fmt.Sprint(step.AliceB), fmt.Sprint(step.BobB)})
+	}
+	return out.Table([]string{"step", "", "verdict", "alice A", "bob A", "alice B", "bob B"}, rows, steps)
+}
+
+// GET /demo/swap
+func (s *Server) handleSwapDemo(w http.ResponseWriter, r *http.Request) {
+	steps, err := RunSwapDemo()
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, steps)
+}
@@ -0,0 +1,152 @@
+/*
+ * Block rewards and monetary policy.
+ * A genesis spec declaring an issuance mints a reward to the miner of
+ * every Block, on top of the fees. The reward halves every Halving Blocks,
+ * Bitcoin style, and stops after MAX_HALVINGS halvings. With a MaxSupply,
+ * the premine included, the last reward is cut to what is left under the
+ * cap, and Blocks mint nothing past it: miners then live off fees alone.
+ *
+ *	"issuance": {"reward": 50, "halving": 210, "maxSupply": 21000}
+ *
+ * The supply counts the coins issued, premine and rewards. Blocks without
+ * a miner mint nothing, and burn their fees, which stay counted.
+ *
+ *	GET /supply  total supply, reward of the next Block and next halving
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Halvings after which Blocks mint nothing
+const MAX_HALVINGS = 64
+
+type IssuanceSpec struct {
+	Reward    Amount `json:"reward"`              // coins minted to the miner of each Block at first
+	Halving   int    `json:"halving,omitempty"`   // Blocks between two halvings of the reward, 0 for never
+	MaxSupply Amount `json:"maxSupply,omitempty"` // cap of the coins issued, premine included, 0 for no cap
+}
+
+func (spec *IssuanceSpec) check(premine Amount) error {
+	if spec.Reward < 0 || spec.Halving < 0 || spec.MaxSupply < 0 {
+		return errors.New("negative issuance")
+	}
+	if spec.MaxSupply > 0 && premine > spec.MaxSupply {
+		return fmt.Errorf("premine of %v over the max supply of %v", premine, spec.MaxSupply)
+	}
+	return nil
+}
+
+func (spec IssuanceSpec) String() string {
+	return fmt.Sprintf("%v/%v/%v", spec.Reward, spec.Halving, spec.MaxSupply)
+}
+
+// Halvings before the Block at height, see scheduled
+func (spec *IssuanceSpec) halvings(height int) int {
+	if spec.Halving == 0 {
+		return 0
+	}
+	return (height - 1) / spec.Halving
+}
+
+// Reward of the Block at height before the supply cap, 0 without issuance
+func (spec *IssuanceSpec) scheduled(height int) Amount {
+	if spec == nil || height < 1 || spec.halvings(height) >= MAX_HALVINGS {
+		return 0
+	}
+	return spec.Reward >> spec.halvings(height)
+}
+
+// Reward of the Block at height given the supply issued before it
+func (spec *IssuanceSpec) reward(height int, supply Amount) Amount {
+	reward := spec.scheduled(height)
+	if spec != nil && spec.MaxSupply > 0 {
+		reward = max(min(reward, spec.MaxSupply-supply), 0)
+	}
+	return reward
+}
+
+// Coins of the chain's coin premined by genesis
+func (g Genesis) premine() Amount {
+	var premine Amount
+	for _, account := range sortedKeys(g.Alloc) {
+		premine += g.Alloc[account]
+	}
+	return premine
+}
+
+// Coins issued so far, premine and block rewards
+func (bc *BlockChain) TotalSupply() Amount {
+	return bc.state.supply
+}
+
+/*
+ * Height of the next Block whose reward halves, and that reward, false if
+ * the reward never halves again: no halving, no more halvings or the
+ * supply cap reached
+ */
+func (bc *BlockChain) NextHalving() (int, Amount, bool) {
+	spec := bc.genesis.Issuance
+	next := bc.blocks.Len()
+	if spec == nil || spec.Halving == 0 || spec.halvings(next) >= MAX_HALVINGS-1 {
+		return 0, 0, false
+	}
+	if spec.MaxSupply > 0 && bc.state.supply >= spec.MaxSupply {
+		return 0, 0, false
+	}
+	height := (spec.halvings(next)+1)*spec.Halving + 1
+	return height, spec.scheduled(height), true
+}
+
+type SupplyInfo struct {
+	Height      int    `json:"height"`
+	Supply      Amount `json:"supply"`              // coins issued up to Height
+	MaxSupply   Amount `json:"maxSupply,omitempty"` // 0 for no cap
+	Reward      Amount `json:"reward"`              // of the next Block
+	NextHalving int    `json:"nextHalving,omitempty"`
+	NextReward  Amount `json:"nextReward,omitempty"` // from NextHalving on
+}
+
+func (bc *BlockChain) Supply() SupplyInfo {
+	info := SupplyInfo{
+		Height: bc.blocks.Len() - 1,
+		Supply: bc.TotalSupply(),
+		Reward: bc.state.issuanceAt(bc.blocks.Len()).reward(bc.blocks.Len(), bc.state.supply),
+	}
+	if spec := bc.genesis.Issuance; spec != nil {
+		info.MaxSupply = spec.MaxSupply
+	}
+	info.NextHalving, info.NextReward, _ = bc.NextHalving()
+	return info
+}
+
+// Print the supply of bc, returning the exit code
+func runSupply(bc *BlockChain, out *Output) int {
+	info := bc.Supply()
+	fields := [][2]string{
+		{"height", fmt.Sprint(info.Height)},
+		{"supply", fmt.Sprint(info.Supply)},
+		{"next reward", fmt.Sprint(info.Reward)},
+	}
+	if info.MaxSupply > 0 {
+		fields = append(fields, [2]string{"max supply", fmt.Sprint(info.MaxSupply)})
+	}
+	if info.NextHalving > 0 {
+		fields = append(fields, [2]string{"next halving", fmt.Sprintf("block %v, reward %v", info.NextHalving, info.NextReward)})
+	}
+	if err := out.Record(fields, info); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleSupply(w http.ResponseWriter, r *http.Request) {
+	var info SupplyInfo
+	s.node.withChain(func(bc *BlockChain) { info = bc.Supply() })
+	writeJSON(w, http.StatusOK, info)
+}
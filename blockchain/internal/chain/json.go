@@ -0,0 +1,359 @@
+/*
+ * JSON representations of chain types.
+ * The chain types keep their fields unexported, these views are what the
+ * APIs encode and decode.
+ */
+package chain
+
+import "encoding/json"
+
+type jsonTxn struct {
+	Kind  TxnKind `json:"kind,omitempty"`
+	Payer string  `json:"payer"`
+	Payee string  `json:"payee,omitempty"`
+	Asset string  `json:"asset,omitempty"`
+	Amt   Amount  `json:"amt,omitempty"`
+	Fee   Amount  `json:"fee,omitempty"`
+
+	FeeAsset string `json:"feeAsset,omitempty"`
+
+	Payouts []jsonPayout `json:"payouts,omitempty"`
+
+	GasLimit uint64 `json:"gasLimit,omitempty"`
+	GasPrice Amount `json:"gasPrice,omitempty"`
+
+	Nonce uint64     `json:"nonce"`
+	Swap  *jsonSwap  `json:"swap,omitempty"`
+	Order *jsonOrder `json:"order,omitempty"`
+	KV    *jsonKV    `json:"kv,omitempty"`
+	UTXO  *jsonUTXO  `json:"utxo,omitempty"`
+
+	Multisig *jsonMultisig `json:"multisig,omitempty"`
+	Message  *jsonMessage  `json:"message,omitempty"`
+	Record   *jsonRecord   `json:"record,omitempty"`
+	Token    *jsonToken    `json:"token,omitempty"`
+	CoSigs   [][]byte      `json:"cosigs,omitempty"`
+	Scheme   SigScheme     `json:"scheme,omitempty"` // of the signatures, 0 ECDSA, 1 ed25519, 2 Schnorr
+	ChainID  string        `json:"chainId,omitempty"`
+
+	LockHeight int   `json:"lockHeight,omitempty"`
+	LockTime   int64 `json:"lockTime,omitempty"` // unix microseconds
+
+	Script  string   `json:"script,omitempty"`
+	Witness [][]byte `json:"witness,omitempty"`
+
+	AccessList []string `json:"accessList,omitempty"`
+
+	Data []byte `json:"data,omitempty"` // base64, up to MAX_TXN_DATA bytes
+
+	Fiat map[string]float64 `json:"fiat,omitempty"` // fiat values of amt, output only
+}
+
+type jsonPayout struct {
+	Payee string `json:"payee"`
+	Amt   Amount `json:"amt"`
+}
+
+type jsonSwapLeg struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Asset string `json:"asset,omitempty"`
+	Amt   Amount `json:"amt"`
+}
+
+type jsonSwap struct {
+	Legs   []jsonSwapLeg     `json:"legs"`
+	Keys   map[string][]byte `json:"keys"`
+	Sigs   map[string][]byte `json:"sigs"`
+	AggSig []byte            `json:"aggSig,omitempty"` // in place of sigs, see schnorr.go
+}
+
+type jsonOrder struct {
+	ID     string    `json:"id,omitempty"`
+	Side   OrderSide `json:"side"`
+	Base   string    `json:"base,omitempty"`
+	Quote  string    `json:"quote,omitempty"`
+	Price  Amount    `json:"price,omitempty"`
+	Amount Amount    `json:"amount,omitempty"`
+}
+
+type jsonKV struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Value     []byte `json:"value,omitempty"`
+}
+
+type jsonUTXOOutput struct {
+	Owner string `json:"owner"`
+	Amt   Amount `json:"amt"`
+}
+
+type jsonUTXO struct {
+	Inputs  []string          `json:"inputs,omitempty"`
+	Outputs []jsonUTXOOutput  `json:"outputs,omitempty"`
+	Keys    map[string][]byte `json:"keys,omitempty"`
+	Sigs    map[string][]byte `json:"sigs,omitempty"`
+	AggSig  []byte            `json:"aggSig,omitempty"` // in place of sigs, see schnorr.go
+}
+
+type jsonMultisig struct {
+	Keys      [][]byte `json:"keys"`
+	Threshold int      `json:"threshold"`
+}
+
+type jsonMessage struct {
+	Ephemeral []byte `json:"ephemeral"` // base64 one-time public key
+	Sealed    []byte `json:"sealed"`    // base64 GCM nonce and ciphertext
+}
+
+type jsonRecord struct {
+	Schema  string          `json:"schema"`
+	Payload json.RawMessage `json:"payload"` // canonical JSON of the record
+}
+
+type jsonToken struct {
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"`
+}
+
+type jsonHeader struct {
+	PrevHash   string `json:"prevHash"`
+	MerkleRoot string `json:"merkleRoot"`
+	Miner      string `json:"miner,omitempty"`
+	UnixTs     int64  `json:"unixTs"`
+	Difficulty int    `json:"difficulty"`
+	Retarget   int    `json:"retarget,omitempty"`
+	StateRoot  string `json:"stateRoot,omitempty"`
+	Bloom      []byte `json:"bloom,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	Nonce      int    `json:"nonce"`
+	Hash       string `json:"hash"`
+}
+
+type jsonBlock struct {
+	jsonHeader
+	Data []jsonTxn `json:"data"`
+}
+
+type jsonChain struct {
+	ChainID    string      `json:"chainId"`
+	Difficulty int         `json:"difficulty"`
+	Blocks     []jsonBlock `json:"blocks"`
+}
+
+func (txn Transaction) toJSON() jsonTxn {
+	j := jsonTxn{
+		Kind:  txn.kind,
+		Payer: txn.payer,
+		Payee: txn.payee,
+		Asset: txn.asset,
+		Amt:   txn.amt,
+		Fee:   txn.fee,
+		Nonce: txn.nonce,
+
+		FeeAsset: txn.feeAsset,
+		GasLimit: txn.gasLimit,
+		GasPrice: txn.gasPrice,
+	}
+	for _, p := range txn.payouts {
+		j.Payouts = append(j.Payouts, jsonPayout{p.payee, p.amt})
+	}
+	if o := txn.order; o != nil {
+		j.Order = &jsonOrder{o.id, o.side, o.base, o.quote, o.price, o.amount}
+	}
+	if w := txn.kv; w != nil {
+		j.KV = &jsonKV{w.namespace, w.key, w.value}
+	}
+	if u := txn.utxo; u != nil {
+		j.UTXO = &jsonUTXO{
+			Inputs: append([]string{}, u.inputs...),
+			Keys:   make(map[string][]byte),
+			Sigs:   make(map[string][]byte),
+			AggSig: u.aggSig,
+		}
+		for _, o := range u.outputs {
+			j.UTXO.Outputs = append(j.UTXO.Outputs, jsonUTXOOutput{o.owner, o.amt})
+		}
+		for owner, key := range u.keys {
+			j.UTXO.Keys[owner] = key
+		}
+		for owner, sig := range u.sigs {
+			j.UTXO.Sigs[owner] = sig
+		}
+	}
+	if m := txn.multisig; m != nil {
+		j.Multisig = &jsonMultisig{append([][]byte{}, m.keys...), m.threshold}
+	}
+	if m := txn.message; m != nil {
+		j.Message = &jsonMessage{m.ephemeral, m.sealed}
+	}
+	if r := txn.record; r != nil {
+		j.Record = &jsonRecord{r.schema, r.payload}
+	}
+	if t := txn.token; t != nil {
+		j.Token = &jsonToken{t.name, t.decimals}
+	}
+	j.CoSigs = append(j.CoSigs, txn.cosigs...)
+	j.Scheme = txn.scheme
+	j.ChainID = txn.chainID
+	j.LockHeight, j.LockTime = txn.lockHeight, txn.lockTime
+	j.AccessList = append(j.AccessList, txn.accessList...)
+	j.Data = append(j.Data, txn.data...)
+	if s := txn.script; s != nil {
+		j.Script = s.code
+		j.Witness = append([][]byte{}, s.witness...)
+	}
+	if txn.swap != nil {
+		j.Swap = &jsonSwap{
+			Keys:   make(map[string][]byte),
+			Sigs:   make(map[string][]byte),
+			AggSig: txn.swap.aggSig,
+		}
+		for party, key := range txn.swap.keys {
+			j.Swap.Keys[party] = key
+		}
+		for party, sig := range txn.swap.sigs {
+			j.Swap.Sigs[party] = sig
+		}
+		for _, leg := range txn.swap.legs {
+			j.Swap.Legs = append(j.Swap.Legs, jsonSwapLeg{leg.from, leg.to, leg.asset, leg.amt})
+		}
+	}
+	return j
+}
+
+func (j jsonTxn) transaction() Transaction {
+	txn := Transaction{
+		kind:  j.Kind,
+		payer: j.Payer,
+		payee: j.Payee,
+		asset: j.Asset,
+		amt:   j.Amt,
+		fee:   j.Fee,
+		nonce: j.Nonce,
+
+		feeAsset: j.FeeAsset,
+		gasLimit: j.GasLimit,
+		gasPrice: j.GasPrice,
+	}
+	for _, p := range j.Payouts {
+		txn.payouts = append(txn.payouts, NewPayout(p.Payee, p.Amt))
+	}
+	if o := j.Order; o != nil {
+		txn.order = &Order{o.ID, o.Side, o.Base, o.Quote, o.Price, o.Amount}
+	}
+	if w := j.KV; w != nil {
+		txn.kv = &KVWrite{w.Namespace, w.Key, w.Value}
+	}
+	if u := j.UTXO; u != nil {
+		outputs := []UTXOOutput{}
+		for _, o := range u.Outputs {
+			outputs = append(outputs, NewUTXOOutput(o.Owner, o.Amt))
+		}
+		txn.utxo = NewUTXOTxn(j.Payer, j.Payee, j.Nonce, j.Amt, u.Inputs, outputs...).utxo
+		for owner, key := range u.Keys {
+			txn.utxo.keys[owner] = key
+		}
+		for owner, sig := range u.Sigs {
+			txn.utxo.sigs[owner] = sig
+		}
+		txn.utxo.aggSig = u.AggSig
+	}
+	if m := j.Multisig; m != nil {
+		txn.multisig = &MultisigSpec{keys: m.Keys, threshold: m.Threshold}
+	}
+	if m := j.Message; m != nil {
+		txn.message = &Message{ephemeral: m.Ephemeral, sealed: m.Sealed}
+	}
+	if r := j.Record; r != nil {
+		txn.record = &RecordTxn{schema: r.Schema, payload: compactRecord(r.Payload)}
+	}
+	if t := j.Token; t != nil {
+		txn.token = &TokenSpec{name: t.Name, decimals: t.Decimals}
+	}
+	txn.cosigs = j.CoSigs
+	txn.scheme = j.Scheme
+	txn.chainID = j.ChainID
+	txn.lockHeight, txn.lockTime = j.LockHeight, j.LockTime
+	txn.accessList = j.AccessList
+	txn.data = j.Data
+	if j.Script != "" {
+		txn.script = &Script{code: j.Script, witness: j.Witness}
+	}
+	if j.Swap != nil {
+		txn.swap = &Swap{
+			keys:   make(map[string][]byte),
+			sigs:   make(map[string][]byte),
+			aggSig: j.Swap.AggSig,
+		}
+		for _, leg := range j.Swap.Legs {
+			txn.swap.legs = append(txn.swap.legs, NewSwapLeg(leg.From, leg.To, leg.Asset, leg.Amt))
+		}
+		for party, key := range j.Swap.Keys {
+			txn.swap.keys[party] = key
+		}
+		for party, sig := range j.Swap.Sigs {
+			txn.swap.sigs[party] = sig
+		}
+	}
+	return txn
+}
+
+func (b Block) toJSON() jsonBlock {
+	data := make([]jsonTxn, len(b.data))
+	for i, txn := range b.data {
+		data[i] = txn.toJSON()
+	}
+	return jsonBlock{jsonHeader: b.Header.toJSON(b.hash), Data: data}
+}
+
+func (h Header) toJSON(hash string) jsonHeader {
+	return jsonHeader{
+		PrevHash:   h.prevHash,
+		MerkleRoot: h.merkleRoot,
+		Miner:      h.miner,
+		UnixTs:     h.unixTs,
+		Difficulty: h.difficulty,
+		Retarget:   h.retarget,
+		StateRoot:  h.stateRoot,
+		Bloom:      h.bloom,
+		Version:    h.version,
+		Nonce:      h.nonce,
+		Hash:       hash,
+	}
+}
+
+func (j jsonHeader) header() Header {
+	return Header{
+		prevHash:   j.PrevHash,
+		merkleRoot: j.MerkleRoot,
+		miner:      j.Miner,
+		unixTs:     j.UnixTs,
+		difficulty: j.Difficulty,
+		retarget:   j.Retarget,
+		stateRoot:  j.StateRoot,
+		bloom:      j.Bloom,
+		version:    j.Version,
+		nonce:      j.Nonce,
+	}
+}
+
+func (j jsonBlock) block() Block {
+	data := make([]Transaction, len(j.Data))
+	for i, txn := range j.Data {
+		data[i] = txn.transaction()
+	}
+	return Block{Header: j.header(), data: data, hash: j.Hash}
+}
+
+func (bc BlockChain) toJSON() jsonChain {
+	blocks := make([]jsonBlock, bc.blocks.Len())
+	for height := range blocks {
+		blocks[height] = bc.blockAt(height).toJSON()
+	}
+	return jsonChain{
+		ChainID:    bc.ChainID(),
+		Difficulty: bc.difficulty,
+		Blocks:     blocks,
+	}
+}
@@ -0,0 +1,265 @@
+/*
+ * Keystore of passphrase encrypted Wallet keys.
+ * Each account is one JSON file in the keystore directory holding its
+ * public key in clear and its private key sealed with AES-256-GCM, under a
+ * key derived from the passphrase with scrypt and a random salt. The
+ * account and public key are authenticated along with the ciphertext, so
+ * a file renamed or edited by hand fails to unlock rather than yielding a
+ * key for the wrong account. Files are only readable by their owner.
+ * Accounts sign with ECDSA unless created with another scheme, which the
+ * file then names, see wallet.go.
+ */
+package chain
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const KEYSTORE_VERSION = 1
+
+// scrypt cost of new key files, about 32MB and 100ms per unlock
+const (
+	KEYSTORE_SCRYPT_N = 1 << 15
+	KEYSTORE_SCRYPT_R = 8
+	KEYSTORE_SCRYPT_P = 1
+)
+
+type Keystore struct {
+	dir string
+}
+
+type keyFile struct {
+	Version   int       `json:"version"`
+	Account   string    `json:"account"`
+	PublicKey []byte    `json:"publicKey"` // uncompressed P-256 point, or ed25519 key
+	Scheme    SigScheme `json:"scheme,omitempty"`
+	KDF       struct {
+		Name string `json:"name"` // always scrypt
+		N    int    `json:"n"`
+		R    int    `json:"r"`
+		P    int    `json:"p"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher     string `json:"cipher"` // always aes-256-gcm
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"` // sealed raw private key
+}
+
+// Keystore in dir, created if missing
+func NewKeystore(dir string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Keystore{dir: dir}, nil
+}
+
+func (ks *Keystore) path(account string) (string, error) {
+	if account == "" || strings.ContainsAny(account, `/\`) || strings.HasPrefix(account, ".") {
+		return "", fmt.Errorf("invalid account name %q", account)
+	}
+	return filepath.Join(ks.dir, account+".json"), nil
+}
+
+// Additional data authenticated with the private key
+func (f *keyFile) aad() []byte {
+	aad := fmt.Appendf(nil, "%v|%v|%x", KEYSTORE_VERSION, f.Account, f.PublicKey)
+	// Only covered when set, so the files of ECDSA accounts are unchanged
+	if f.Scheme != SchemeECDSA {
+		aad = fmt.Appendf(aad, "|scheme=%v", f.Scheme)
+	}
+	return aad
+}
+
+func (f *keyFile) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt(passphrase, f.KDF.Salt, f.KDF.N, f.KDF.R, f.KDF.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+ * Generate a Wallet of scheme for account and store its key encrypted
+ * with passphrase, failing with ErrAccountExists if the keystore has one
+ */
+func (ks *Keystore) CreateAccount(account, passphrase string, scheme SigScheme) (*Wallet, error) {
+	path, err := ks.path(account)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewSchemeWallet(account, scheme)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := w.rawKey()
+	if err != nil {
+		return nil, err
+	}
+	f := keyFile{Version: KEYSTORE_VERSION, Account: account, PublicKey: w.PublicKey(), Scheme: scheme, Cipher: "aes-256-gcm"}
+	f.KDF.Name, f.KDF.N, f.KDF.R, f.KDF.P = "scrypt", KEYSTORE_SCRYPT_N, KEYSTORE_SCRYPT_R, KEYSTORE_SCRYPT_P
+	f.KDF.Salt = make([]byte, 32)
+	rand.Read(f.KDF.Salt)
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	rand.Read(f.Nonce)
+	f.Ciphertext = aead.Seal(nil, f.Nonce, raw, f.aad())
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL so two accounts of the same name never overwrite each other
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w: %v", ErrAccountExists, account)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return w, file.Close()
+}
+
+/*
+ * Decrypt the key of account with passphrase
+ * Fails with ErrUnknownAccount or ErrWrongPassphrase
+ */
+func (ks *Keystore) Unlock(account, passphrase string) (*Wallet, error) {
+	path, err := ks.path(account)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAccount, account)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("key file of %v: %w", account, err)
+	}
+	if f.Version != KEYSTORE_VERSION || f.KDF.Name != "scrypt" || f.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("key file of %v: unsupported version %v, %v, %v", account, f.Version, f.KDF.Name, f.Cipher)
+	}
+	if f.Account != account {
+		return nil, fmt.Errorf("key file of %v holds account %v", account, f.Account)
+	}
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("key file of %v: bad nonce", account)
+	}
+	raw, err := aead.Open(nil, f.Nonce, f.Ciphertext, f.aad())
+	if err != nil {
+		return nil, fmt.Errorf("%w for %v", ErrWrongPassphrase, account)
+	}
+	w, err := walletFromRaw(account, f.Scheme, raw)
+	if err != nil {
+		return nil, fmt.Errorf("key file of %v: %w", account, err)
+	}
+	if !slices.Equal(w.PublicKey(), f.PublicKey) {
+		return nil, fmt.Errorf("key file of %v: private key does not match the public key", account)
+	}
+	return w, nil
+}
+
+// Accounts of the keystore, sorted
+func (ks *Keystore) List() ([]string, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	accounts := []string{}
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() && !strings.HasPrefix(name, ".") {
+			accounts = append(accounts, name)
+		}
+	}
+	return accounts, nil
+}
+
+// Passphrase from $TOYCHAIN_PASSPHRASE, else the first line of stdin
+func readPassphrase() (string, error) {
+	if p, ok := os.LookupEnv("TOYCHAIN_PASSPHRASE"); ok {
+		return p, nil
+	}
+	fmt.Fprint(os.Stderr, "passphrase: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Create account signing with scheme in the keystore at dir, or list its accounts, returning the exit code
+func runKeystore(dir, account string, scheme SigScheme, out *Output) int {
+	ks, err := NewKeystore(dir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if account == "" {
+		accounts, err := ks.List()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		rows := make([][]string, len(accounts))
+		for i, a := range accounts {
+			rows[i] = []string{a}
+		}
+		if err := out.Table([]string{"account"}, rows, accounts); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+	passphrase, err := readPassphrase()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	w, err := ks.CreateAccount(account, passphrase, scheme)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	view := struct {
+		Account   string    `json:"account"`
+		PublicKey string    `json:"publicKey"`
+		Scheme    SigScheme `json:"scheme"`
+	}{w.Account(), hex.EncodeToString(w.PublicKey()), w.Scheme()}
+	fields := [][2]string{{"account", view.Account}, {"public key", view.PublicKey}, {"scheme", view.Scheme.String()}}
+	if err := out.Record(fields, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
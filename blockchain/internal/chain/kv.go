@@ -0,0 +1,123 @@
+/*
+ * Namespaced key-value store in chain state.
+ * A TxnKV writes (or deletes, with an empty value) one small key under a
+ * namespace. The first account writing to a namespace becomes its owner,
+ * and only the owner may write to it afterwards.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	MAX_KV_NAMESPACE_SIZE = 32
+	MAX_KV_KEY_SIZE       = 64
+	MAX_KV_VALUE_SIZE     = 256
+)
+
+// Gas of a key-value write, plus GAS_KV_BYTE per byte of key and value
+const GAS_KV_WRITE = 20_000
+const GAS_KV_BYTE = 16
+
+type KVWrite struct {
+	namespace string
+	key       string
+	value     []byte // empty to delete the key
+}
+
+func NewKVWrite(payer string, nonce uint64, namespace, key string, value []byte) Transaction {
+	return Transaction{
+		kind:  TxnKV,
+		payer: payer,
+		nonce: nonce,
+		kv:    &KVWrite{namespace: namespace, key: key, value: value},
+	}
+}
+
+func (w *KVWrite) gas() uint64 {
+	return GAS_KV_WRITE + GAS_KV_BYTE*uint64(len(w.key)+len(w.value))
+}
+
+func (w *KVWrite) verify() error {
+	if w.namespace == "" || len(w.namespace) > MAX_KV_NAMESPACE_SIZE {
+		return fmt.Errorf("namespace must be 1 to %v bytes", MAX_KV_NAMESPACE_SIZE)
+	}
+	if w.key == "" || len(w.key) > MAX_KV_KEY_SIZE {
+		return fmt.Errorf("key must be 1 to %v bytes", MAX_KV_KEY_SIZE)
+	}
+	if len(w.value) > MAX_KV_VALUE_SIZE {
+		return fmt.Errorf("value must be at most %v bytes", MAX_KV_VALUE_SIZE)
+	}
+	return nil
+}
+
+func (w *KVWrite) String() string {
+	if len(w.value) == 0 {
+		return fmt.Sprintf("delete %v/%v", w.namespace, w.key)
+	}
+	return fmt.Sprintf("set %v/%v = %q", w.namespace, w.key, w.value)
+}
+
+func (s *State) applyKV(owner string, w *KVWrite) error {
+	if current, ok := s.namespaces[w.namespace]; ok && current != owner {
+		return errors.New("namespace " + w.namespace + " is owned by " + current)
+	}
+	s.namespaces[w.namespace] = owner
+	if s.kv[w.namespace] == nil {
+		s.kv[w.namespace] = make(map[string][]byte)
+	}
+	if len(w.value) == 0 {
+		delete(s.kv[w.namespace], w.key)
+	} else {
+		s.kv[w.namespace][w.key] = append([]byte{}, w.value...)
+	}
+	return nil
+}
+
+// Value of key in namespace after the last committed Block
+func (bc *BlockChain) GetKV(namespace, key string) ([]byte, bool) {
+	return bc.state.getKV(namespace, key)
+}
+
+func (s *State) getKV(namespace, key string) ([]byte, bool) {
+	value, ok := s.kv[namespace][key]
+	return value, ok
+}
+
+// Owner of a namespace, empty if nobody claimed it yet
+func (bc *BlockChain) NamespaceOwner(namespace string) string {
+	return bc.state.namespaces[namespace]
+}
+
+// GET /kv/{namespace}/{key}?height=..
+func (s *Server) handleGetKV(w http.ResponseWriter, r *http.Request) {
+	namespace, key := r.PathValue("namespace"), r.PathValue("key")
+	var value []byte
+	var owner string
+	found := false
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		var view *StateView
+		if view, err = requestView(bc, r); err == nil {
+			value, found = view.GetKV(namespace, key)
+			owner = view.NamespaceOwner(namespace)
+		}
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"namespace": namespace,
+		"owner":     owner,
+		"key":       key,
+		"value":     string(value),
+	})
+}
@@ -0,0 +1,290 @@
+/*
+ * Light client, or Simplified Payment Verification.
+ * A light client keeps only the Block headers, not the transactions nor
+ * the state. It checks every header it downloads extends the previous one
+ * and carries the Proof Of Work of the chain's difficulty, so a full node
+ * cannot feed it forged headers without redoing the work. To check a
+ * transaction was committed it asks the full node for its Merkle proof and
+ * verifies it against the root of a header it already holds: this proves
+ * inclusion, not validity, the light client trusting the miners for that
+ * like a wallet without a full node does.
+ *
+ * On a chain keeping address blooms, see bloom.go, the light client finds
+ * the Blocks involving an account from its headers: it downloads only
+ * those whose bloom may hold the account, checks their transactions
+ * against the Merkle root of the header and keeps those that do involve
+ * it, the others being false positives.
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type LightClient struct {
+	peer       *peerClient
+	devnet     bool          // difficulty may change, see devnet.go
+	retarget   *RetargetSpec // difficulty follows the hash rate, see retarget.go
+	pow        *PowSpec      // Proof Of Work algorithm, SHA-256 if nil, see pow.go
+	upgrades   []Upgrade     // versions headers must signal from their heights, see upgrades.go
+	difficulty int
+	base       int      // height of the trusted first header
+	headers    []Header // by height, from base
+	hashes     []string // hash of each header
+	prior      []Header // trusted headers before base, for the retarget
+
+	checkpoints checkpoints // trusted hashes by height, see checkpoints.go
+}
+
+// Light client of the chain of genesis, downloading headers and proofs from the node API at peer
+func NewLightClient(genesis Genesis, peer string) *LightClient {
+	b := genesis.block()
+	return newLightClientAt(peer, genesis, genesis.Difficulty, 0, []Header{b.Header}, b.hash)
+}
+
+/*
+ * Light client trusting recent, the headers of a full node up to the one
+ * at height, eg. its last Block, whose hash is hash
+ */
+func newLightClientAt(peer string, genesis Genesis, difficulty, height int, recent []Header, hash string) *LightClient {
+	return &LightClient{
+		peer:       newPeerClient(peer),
+		devnet:     genesis.DevNet,
+		retarget:   genesis.Retarget,
+		pow:        genesis.Pow,
+		upgrades:   genesis.Upgrades,
+		difficulty: difficulty,
+		base:       height,
+		headers:    []Header{recent[len(recent)-1]},
+		hashes:     []string{hash},
+		prior:      recent[:len(recent)-1],
+	}
+}
+
+// Height of the last verified header
+func (lc *LightClient) Height() int {
+	return lc.base + len(lc.headers) - 1
+}
+
+// Hash of the verified header at height, false if we do not hold it
+func (lc *LightClient) hashAt(height int) (string, bool) {
+	if height < lc.base || height > lc.Height() {
+		return "", false
+	}
+	return lc.hashes[height-lc.base], true
+}
+
+func (lc *LightClient) TipHash() string {
+	return lc.hashes[len(lc.hashes)-1]
+}
+
+// Check a header extends the last one with enough work, keeping it if so
+func (lc *LightClient) addHeader(h Header, hash string) error {
+	if h.prevHash != lc.TipHash() {
+		return fmt.Errorf("%w: header %v has parent %v", ErrInvalidPrevHash, hash, h.prevHash)
+	}
+	if h.computeHash() != hash {
+		return fmt.Errorf("%w: %v", ErrInvalidBlockHash, hash)
+	}
+	height := lc.Height() + 1
+	if err := lc.checkpoints.check(height, hash); err != nil {
+		return err
+	}
+	if h.difficulty != lc.difficulty {
+		return fmt.Errorf("%w: header %v records %v, expected %v", ErrWrongDifficulty, hash, h.difficulty, lc.difficulty)
+	}
+	if height > lc.checkpoints.last() && !lc.pow.meets(h, hash, h.difficulty) {
+		return fmt.Errorf("%w: header %v, difficulty %v", ErrInsufficientWork, hash, h.difficulty)
+	}
+	if err := checkRetarget(lc.devnet, h.retarget); err != nil {
+		return fmt.Errorf("header %v: %w", hash, err)
+	}
+	if err := checkVersion(lc.upgrades, height, h); err != nil {
+		return fmt.Errorf("header %v: %w", hash, err)
+	}
+	if err := checkMedianTime(h, lc.lastHeaders(MEDIAN_TIME_BLOCKS)); err != nil {
+		return fmt.Errorf("header %v: %w", hash, err)
+	}
+	if err := checkFutureTime(h, time.Now()); err != nil {
+		return fmt.Errorf("header %v: %w", hash, err)
+	}
+	lc.headers = append(lc.headers, h)
+	lc.hashes = append(lc.hashes, hash)
+	switch {
+	case h.retarget != 0:
+		lc.difficulty = h.retarget
+	case lc.retarget != nil:
+		lc.difficulty = lc.retarget.next(lc.lastHeaders(lc.retarget.Window + 1))
+	}
+	return nil
+}
+
+// Last n headers trusted or verified, oldest first
+func (lc *LightClient) lastHeaders(n int) []Header {
+	headers := lc.headers[max(len(lc.headers)-n, 0):]
+	if missing := n - len(headers); missing > 0 {
+		prior := lc.prior[max(len(lc.prior)-missing, 0):]
+		headers = append(prior[:len(prior):len(prior)], headers...)
+	}
+	return headers
+}
+
+/*
+ * Download and verify the headers of the peer past our height, returning
+ * how many were added
+ * Stops at the first invalid header, keeping the ones verified before it
+ */
+func (lc *LightClient) Sync() (int, error) {
+	added := 0
+	for {
+		var headers []jsonHeader
+		if _, err := lc.peer.get(fmt.Sprintf("/headers?from=%v", lc.Height()+1), &headers); err != nil {
+			return added, err
+		}
+		if len(headers) == 0 {
+			return added, nil
+		}
+		for _, j := range headers {
+			if err := lc.addHeader(j.header(), j.Hash); err != nil {
+				return added, fmt.Errorf("height %v: %w", lc.Height()+1, err)
+			}
+			added++
+		}
+	}
+}
+
+/*
+ * Check the transaction hash is committed by one of our headers, using a
+ * Merkle proof from the peer. Returns the height of its Block, syncing
+ * headers first if the peer has it in a Block we have not seen yet
+ */
+func (lc *LightClient) VerifyTxn(hash string) (int, error) {
+	var proof jsonMerkleProof
+	found, err := lc.peer.get("/proofs/"+hash, &proof)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("%w: peer has no transaction %v", ErrInvalidProof, hash)
+	}
+	if proof.Height > lc.Height() {
+		if _, err := lc.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	if blockHash, ok := lc.hashAt(proof.Height); !ok || blockHash != proof.BlockHash {
+		return 0, fmt.Errorf("%w: block %v at height %v is not in our headers", ErrInvalidProof, proof.BlockHash, proof.Height)
+	}
+	if proof.Txn != hash || !VerifyMerkleProof(hash, lc.headers[proof.Height-lc.base].merkleRoot, proof.Proof) {
+		return 0, fmt.Errorf("%w: proof of %v does not match the merkle root of block %v", ErrInvalidProof, hash, proof.Height)
+	}
+	return proof.Height, nil
+}
+
+type AccountScan struct {
+	Account        string `json:"account"`
+	Blocks         []int  `json:"blocks"`         // heights of the Blocks involving the account
+	Skipped        int    `json:"skipped"`        // Blocks the bloom ruled out, never downloaded
+	FalsePositives int    `json:"falsePositives"` // Blocks downloaded not involving the account
+}
+
+/*
+ * Heights of the verified Blocks involving account, downloading from the
+ * peer only those whose header may involve it and checking each against
+ * the Merkle root of its header
+ */
+func (lc *LightClient) ScanAccount(account string) (AccountScan, error) {
+	scan := AccountScan{Account: account, Blocks: []int{}}
+	for i, h := range lc.headers {
+		if !h.MayInvolve(account) {
+			scan.Skipped++
+			continue
+		}
+		height := lc.base + i
+		b, found, err := lc.peer.block(height)
+		if err != nil {
+			return scan, err
+		}
+		if !found || b.hash != lc.hashes[i] {
+			return scan, fmt.Errorf("%w: peer has no block %v at height %v", ErrInvalidProof, lc.hashes[i], height)
+		}
+		if merkleRoot(b.data) != h.merkleRoot {
+			return scan, fmt.Errorf("%w: transactions of block %v do not match its merkle root", ErrInvalidProof, height)
+		}
+		if involves(b, account) {
+			scan.Blocks = append(scan.Blocks, height)
+		} else {
+			scan.FalsePositives++
+		}
+	}
+	return scan, nil
+}
+
+// Whether a transaction of b involves account
+func involves(b Block, account string) bool {
+	for _, txn := range b.data {
+		if _, ok := txn.directions()[account]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Number of Blocks from the one at height to the tip, both included
+func (lc *LightClient) Confirmations(height int) int {
+	return lc.Height() - height + 1
+}
+
+/*
+ * Sync a light client from peer trusting cps, verify txn and list the
+ * Blocks involving account if set, returning the exit code
+ */
+func runLightClient(genesis Genesis, peer, txn, account string, cps []Checkpoint, out *Output) int {
+	lc := NewLightClient(genesis, peer)
+	if err := lc.SetCheckpoints(cps); err != nil {
+		log.Print(err)
+		return 1
+	}
+	added, err := lc.Sync()
+	if err != nil {
+		log.Printf("verified %v headers, then: %v", added, err)
+		return 1
+	}
+	view := struct {
+		Tip           string       `json:"tip"`
+		Height        int          `json:"height"`
+		Verified      int          `json:"verified"` // headers verified by this sync
+		Txn           string       `json:"txn,omitempty"`
+		Block         int          `json:"block,omitempty"` // height of the Block holding txn
+		Confirmations int          `json:"confirmations,omitempty"`
+		Scan          *AccountScan `json:"scan,omitempty"`
+	}{Tip: lc.TipHash(), Height: lc.Height(), Verified: added}
+	fields := [][2]string{{"tip", view.Tip}, {"height", fmt.Sprint(view.Height)}, {"verified headers", fmt.Sprint(added)}}
+	if txn != "" {
+		height, err := lc.VerifyTxn(txn)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		view.Txn, view.Block, view.Confirmations = txn, height, lc.Confirmations(height)
+		// The transaction is what scripts checking a proof are after
+		fields = append([][2]string{{"txn", txn}, {"block", fmt.Sprint(height)}, {"confirmations", fmt.Sprint(view.Confirmations)}}, fields...)
+	}
+	if account != "" {
+		scan, err := lc.ScanAccount(account)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		view.Scan = &scan
+		fields = append(fields, [2]string{"account", account}, [2]string{"blocks", fmt.Sprint(scan.Blocks)},
+			[2]string{"skipped", fmt.Sprint(scan.Skipped)}, [2]string{"false positives", fmt.Sprint(scan.FalsePositives)})
+	}
+	if err := out.Record(fields, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,295 @@
+/*
+ * Load generator.
+ * RunLoadGen, the toychain-loadgen command of cmd/toychain-loadgen, streams
+ * transfers at the node API at a URL, to measure how changes to the
+ * Mempool, mining or storage hold up under load. It makes random wallets,
+ * funds them from an account of the node, DEV_ACCOUNT by default, then has
+ * them pay each other at a steady rate for a while and reports:
+ *
+ *	acceptance  share of the transfers the node admitted to its Mempool
+ *	latency     time from sending a transfer to seeing it in a Block
+ *	throughput  transfers included per second, from the first sent to
+ *	            the last included
+ *
+ * The node mines the transfers itself, started with -mine or -dev. Blocks
+ * are polled every LOADGEN_POLL, which bounds the precision of the
+ * latencies.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	LOADGEN_POLL    = 100 * time.Millisecond
+	LOADGEN_DRAIN   = 30 * time.Second // wait for the transfers sent to be included
+	LOADGEN_WORKERS = 8                // concurrent senders, each for its share of the wallets
+)
+
+type LoadGenConfig struct {
+	Node     string // URL of the node API
+	From     string // account funding the wallets
+	Wallets  int
+	Fund     Amount // sent to each wallet before the load
+	Amount   Amount // of each transfer
+	Fee      Amount
+	TPS      float64 // transfers sent per second
+	Duration time.Duration
+	Seed     uint64 // of the payers and payees picked
+}
+
+func DefaultLoadGenConfig(node string) LoadGenConfig {
+	return LoadGenConfig{Node: node, From: DEV_ACCOUNT, Wallets: 20, Fund: 100 * COIN, Amount: COIN / 100, TPS: 50, Duration: 10 * time.Second, Seed: 1}
+}
+
+type LoadGenReport struct {
+	Sent           int     `json:"sent"`
+	Accepted       int     `json:"accepted"`
+	Included       int     `json:"included"`
+	AcceptanceRate float64 `json:"acceptanceRate"`
+	SendRate       float64 `json:"sendRate"`    // transfers sent per second
+	Throughput     float64 `json:"throughput"`  // transfers included per second
+	MeanLatency    float64 `json:"meanLatency"` // seconds from sending to inclusion
+	P95Latency     float64 `json:"p95Latency"`
+	MaxLatency     float64 `json:"maxLatency"`
+	FirstError     string  `json:"firstError,omitempty"` // of the transfers refused
+}
+
+// Transfers sent and not seen in a Block yet, and the latencies of those seen
+type loadTracker struct {
+	mu        sync.Mutex
+	node      *peerClient
+	height    int                  // of the last Block polled
+	waiting   map[string]time.Time // sending time by transaction hash
+	latencies []float64
+	last      time.Time // a transfer was last seen included
+}
+
+// Note a transfer about to be sent, before the node may include it
+func (t *loadTracker) send(hash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.waiting[hash] = time.Now()
+}
+
+func (t *loadTracker) refused(hash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.waiting, hash)
+}
+
+func (t *loadTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.waiting)
+}
+
+// Look for the transfers waiting in the Blocks mined since the last poll
+func (t *loadTracker) poll() error {
+	var tip []jsonBlockSummary
+	if _, err := t.node.get("/blocks?limit=1", &tip); err != nil {
+		return err
+	}
+	for len(tip) > 0 && t.height < tip[0].Height {
+		var detail jsonBlockDetail
+		if _, err := t.node.get(fmt.Sprintf("/blocks/%v", t.height+1), &detail); err != nil {
+			return err
+		}
+		now := time.Now()
+		t.mu.Lock()
+		for _, ref := range detail.Txns {
+			if at, ok := t.waiting[ref.Hash]; ok {
+				t.latencies = append(t.latencies, now.Sub(at).Seconds())
+				t.last = now
+				delete(t.waiting, ref.Hash)
+			}
+		}
+		t.mu.Unlock()
+		t.height++
+	}
+	return nil
+}
+
+// Poll until no transfer is waiting or timeout passes
+func (t *loadTracker) drain(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for t.pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(LOADGEN_POLL)
+		if err := t.poll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RunLoadGen(cfg LoadGenConfig) (LoadGenReport, error) {
+	var report LoadGenReport
+	if cfg.Wallets < 2 || !(cfg.TPS > 0) || cfg.Duration <= 0 || !(cfg.Amount > 0) {
+		return report, errors.New("load generator needs 2 wallets or more, a positive rate, duration and amount")
+	}
+	node := newPeerClient(cfg.Node)
+	genesis, _, err := node.genesis()
+	if err != nil {
+		return report, err
+	}
+	tracker := &loadTracker{node: node, waiting: map[string]time.Time{}}
+	if tracker.height, err = nodeHeight(node); err != nil {
+		return report, err
+	}
+
+	// Random wallets, named after their address on chains of addresses
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	accounts := make([]string, cfg.Wallets)
+	for i := range accounts {
+		w, err := NewWallet(fmt.Sprintf("load-%08x", rng.Uint32()))
+		if err != nil {
+			return report, err
+		}
+		accounts[i] = w.Account()
+		if genesis.AddressPrefix != "" {
+			accounts[i] = w.Address(genesis.AddressPrefix)
+		}
+	}
+	submit := func(j jsonTxn) error {
+		hash := j.transaction().Hash()
+		tracker.send(hash)
+		err := node.send(http.MethodPost, "/txns", j, &jsonTxn{})
+		if err != nil {
+			tracker.refused(hash)
+		}
+		return err
+	}
+
+	from, err := nextNonce(node, cfg.From)
+	if err != nil {
+		return report, err
+	}
+	for i, account := range accounts {
+		j := jsonTxn{Payer: cfg.From, Payee: account, Amt: cfg.Fund, Fee: cfg.Fee, Nonce: from + uint64(i), ChainID: genesis.ChainID}
+		if err := submit(j); err != nil {
+			return report, fmt.Errorf("funding %v: %w", account, err)
+		}
+	}
+	if err := tracker.drain(LOADGEN_DRAIN); err != nil {
+		return report, err
+	}
+	if n := tracker.pending(); n > 0 {
+		return report, fmt.Errorf("%v funding transfers not mined within %v, is the node mining?", n, LOADGEN_DRAIN)
+	}
+	tracker.latencies = nil
+	// The wallets of a seed are the same on each run
+	nonces := make([]uint64, len(accounts))
+	for i, account := range accounts {
+		if nonces[i], err = nextNonce(node, account); err != nil {
+			return report, err
+		}
+	}
+
+	// Each worker sends the transfers of its wallets in nonce order
+	var mu sync.Mutex
+	queues := make([]chan [2]int, LOADGEN_WORKERS)
+	var wg sync.WaitGroup
+	for w := range queues {
+		queues[w] = make(chan [2]int, 1024)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pair := range queues[w] {
+				payer, payee := pair[0], pair[1]
+				j := jsonTxn{Payer: accounts[payer], Payee: accounts[payee], Amt: cfg.Amount, Fee: cfg.Fee, Nonce: nonces[payer], ChainID: genesis.ChainID}
+				err := submit(j)
+				mu.Lock()
+				report.Sent++
+				if err == nil {
+					report.Accepted++
+					nonces[payer]++
+				} else if report.FirstError == "" {
+					report.FirstError = err.Error()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	polled := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(LOADGEN_POLL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				polled <- nil
+				return
+			case <-ticker.C:
+				if err := tracker.poll(); err != nil {
+					polled <- err
+					return
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	interval := time.Duration(float64(time.Second) / cfg.TPS)
+	for due := start; time.Since(start) < cfg.Duration; due = due.Add(interval) {
+		time.Sleep(time.Until(due))
+		payer := rng.IntN(cfg.Wallets)
+		payee := (payer + 1 + rng.IntN(cfg.Wallets-1)) % cfg.Wallets
+		queues[payer%LOADGEN_WORKERS] <- [2]int{payer, payee}
+	}
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	sending := time.Since(start)
+	close(stop)
+	if err := <-polled; err != nil {
+		return report, err
+	}
+	if err := tracker.drain(LOADGEN_DRAIN); err != nil {
+		return report, err
+	}
+
+	report.Included = len(tracker.latencies)
+	report.SendRate = float64(report.Sent) / sending.Seconds()
+	if report.Sent > 0 {
+		report.AcceptanceRate = float64(report.Accepted) / float64(report.Sent)
+	}
+	if lat := tracker.latencies; len(lat) > 0 {
+		slices.Sort(lat)
+		for _, l := range lat {
+			report.MeanLatency += l / float64(len(lat))
+		}
+		report.P95Latency = lat[(len(lat)-1)*95/100]
+		report.MaxLatency = lat[len(lat)-1]
+		report.Throughput = float64(len(lat)) / tracker.last.Sub(start).Seconds()
+	}
+	return report, nil
+}
+
+func nextNonce(node *peerClient, account string) (uint64, error) {
+	var counts struct {
+		NextNonce uint64 `json:"nextNonce"`
+	}
+	_, err := node.get("/mempool?account="+url.QueryEscape(account), &counts)
+	return counts.NextNonce, err
+}
+
+func nodeHeight(node *peerClient) (int, error) {
+	var tip []jsonBlockSummary
+	if _, err := node.get("/blocks?limit=1", &tip); err != nil {
+		return 0, err
+	}
+	if len(tip) == 0 {
+		return 0, errors.New("node has no blocks")
+	}
+	return tip[0].Height, nil
+}
@@ -0,0 +1,212 @@
+/*
+ * Mempool of outstanding transactions waiting to be packed in a Block.
+ * Every payer numbers its transactions with a nonce starting at 0.
+ * Transactions carrying the next expected nonce are pending (executable),
+ * transactions with a future nonce are queued per account until the gap
+ * is filled, at which point they are promoted to pending in nonce order.
+ * A transaction reusing the nonce of a held one may replace it by paying
+ * more, see replace.go.
+ * A node may cap and expire the transactions held, see mempoollimits.go.
+ */
+package chain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pending and queued transaction counts of an account
+type TxnCounts struct {
+	Pending   int    // executable transactions waiting for a Block
+	Queued    int    // future-nonce transactions waiting for a gap to fill
+	NextNonce uint64 // nonce the next pending transaction must carry
+}
+
+type Mempool struct {
+	pending []Transaction            // executable transactions in arrival order
+	queued  map[string][]Transaction // future-nonce transactions per payer, sorted by nonce
+	nonces  map[string]uint64        // next expected nonce per payer, including pending
+	rates   map[string]float64       // coins per unit of the fee assets, see feeassets.go
+
+	admitted map[string]admission // arrival of the held transactions by hash, see mempoollimits.go
+	arrivals uint64               // transactions admitted so far
+}
+
+func NewMempool() *Mempool {
+	return &Mempool{
+		queued:   make(map[string][]Transaction),
+		nonces:   make(map[string]uint64),
+		admitted: make(map[string]admission),
+	}
+}
+
+/*
+ * Admit a transaction into the Mempool, committed being the next nonce of
+ * the payer according to the chain state.
+ * Fails if the nonce was already used by a committed (ErrInvalidNonce) or
+ * pending (ErrNonceTaken) transaction of the same payer, replacements
+ * going through replace instead.
+ */
+func (mp *Mempool) add(txn Transaction, committed uint64) error {
+	next := mp.nonces[txn.payer]
+	if committed > next {
+		next = committed
+		mp.nonces[txn.payer] = next
+	}
+	switch {
+	case txn.nonce < committed:
+		return fmt.Errorf("%w: nonce %v of %v is already committed", ErrInvalidNonce, txn.nonce, txn.payer)
+	case txn.nonce < next:
+		return fmt.Errorf("%w: nonce %v of %v", ErrNonceTaken, txn.nonce, txn.payer)
+	case txn.nonce > next:
+		mp.enqueue(txn)
+		return nil
+	}
+	mp.pending = append(mp.pending, txn)
+	mp.nonces[txn.payer] = next + 1
+	mp.promote(txn.payer)
+	return nil
+}
+
+// Queue a future-nonce transaction, replacing one with the same nonce
+func (mp *Mempool) enqueue(txn Transaction) {
+	queue := mp.queued[txn.payer]
+	i := sort.Search(len(queue), func(i int) bool { return queue[i].nonce >= txn.nonce })
+	if i < len(queue) && queue[i].nonce == txn.nonce {
+		queue[i] = txn
+		return
+	}
+	queue = append(queue, Transaction{})
+	copy(queue[i+1:], queue[i:])
+	queue[i] = txn
+	mp.queued[txn.payer] = queue
+}
+
+// Move queued transactions of account to pending while the nonces are contiguous
+func (mp *Mempool) promote(account string) {
+	queue := mp.queued[account]
+	next := mp.nonces[account]
+	for len(queue) > 0 && queue[0].nonce == next {
+		mp.pending = append(mp.pending, queue[0])
+		queue = queue[1:]
+		next++
+	}
+	mp.nonces[account] = next
+	if len(queue) == 0 {
+		delete(mp.queued, account)
+	} else {
+		mp.queued[account] = queue
+	}
+}
+
+/*
+ * Reset the next nonce of account after one of its transactions was
+ * dropped, its later pending transactions are queued again until the
+ * gap is filled
+ */
+func (mp *Mempool) rewind(account string, next uint64) {
+	rest := []Transaction{}
+	for _, txn := range mp.pending {
+		if txn.payer == account {
+			mp.enqueue(txn)
+		} else {
+			rest = append(rest, txn)
+		}
+	}
+	mp.pending = rest
+	mp.nonces[account] = next
+	mp.promote(account)
+}
+
+/*
+ * Drop the held transactions whose nonces b, a Block appended from
+ * elsewhere, spent, the transactions it carries among them
+ */
+func (bc *BlockChain) dropIncluded(b Block) {
+	mp := bc.mempool
+	payers := map[string]bool{}
+	for _, txn := range b.data {
+		if held, ok := mp.heldNonce(txn.payer, txn.nonce); ok {
+			mp.remove(held)
+		}
+		payers[txn.payer] = true
+	}
+	for _, payer := range sortedKeys(payers) {
+		mp.nonces[payer] = max(mp.nonces[payer], bc.state.nonce(payer))
+		mp.promote(payer)
+	}
+}
+
+/*
+ * Pending transactions in the order the default miner packs them, see
+ * FeeBuilder: highest fee first,
+ * in coins at the latest fee rates, ties broken by arrival, while keeping
+ * each payer's transactions in nonce order
+ */
+func (mp *Mempool) ordered() []Transaction {
+	return FeeBuilder{}.Order(mp.pending, mp.feeValue)
+}
+
+/*
+ * Remove and return the pending transactions fitting in a Block of limits
+ * using at most maxGas gas, and unlocked, in the order of builder, see
+ * packingOrder and timelocks.go
+ * A transaction that does not fit or is locked holds back the later ones
+ * of its payer
+ */
+func (mp *Mempool) take(builder BlockBuilder, limits BlockLimits, maxGas uint64, unlocked func(Transaction) bool) []Transaction {
+	txns := []Transaction{}
+	taken := make(map[string]bool)
+	skipped := make(map[string]bool)
+	var gas uint64
+	size := 1 // opening bracket, each transaction adding a comma or the closing bracket
+	for _, txn := range mp.packingOrder(builder) {
+		if skipped[txn.payer] || gas+txn.gas() > maxGas || !limits.fits(len(txns)+1, size+txn.size()+1) || !unlocked(txn) {
+			skipped[txn.payer] = true
+			continue
+		}
+		gas += txn.gas()
+		size += txn.size() + 1
+		txns = append(txns, txn)
+		taken[txn.Hash()] = true
+	}
+	rest := []Transaction{}
+	for _, txn := range mp.pending {
+		if !taken[txn.Hash()] {
+			rest = append(rest, txn)
+		}
+	}
+	mp.pending = rest
+	return txns
+}
+
+// Number of pending transactions across all accounts
+func (mp *Mempool) Len() int {
+	return len(mp.pending)
+}
+
+func (mp *Mempool) Counts(account string) TxnCounts {
+	counts := TxnCounts{
+		Queued:    len(mp.queued[account]),
+		NextNonce: mp.nonces[account],
+	}
+	for _, txn := range mp.pending {
+		if txn.payer == account {
+			counts.Pending++
+		}
+	}
+	return counts
+}
+
+// Nonces missing before the queued transactions of account can be promoted
+func (mp *Mempool) NonceGap(account string) []uint64 {
+	queue := mp.queued[account]
+	if len(queue) == 0 {
+		return nil
+	}
+	gap := []uint64{}
+	for nonce := mp.nonces[account]; nonce < queue[0].nonce; nonce++ {
+		gap = append(gap, nonce)
+	}
+	return gap
+}
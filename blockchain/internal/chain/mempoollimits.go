@@ -0,0 +1,182 @@
+/*
+ * Mempool limits and expiry.
+ * A node may cap the transactions its Mempool holds, pending and queued,
+ * by count and by bytes. A transaction overflowing the caps evicts the
+ * transactions paying the lowest fee, in coins at the latest fee rates,
+ * until it fits, the latest arrival going first among equal fees; one
+ * paying no more than those it would evict is refused with ErrMempoolFull
+ * instead. Evicting a pending transaction queues the later ones of its
+ * payer again, until its nonce is sent anew. The transactions of Blocks a
+ * reorg reverts come back as arrivals, under the same caps, see reorg.go.
+ *
+ * Transactions may also expire after waiting TTL, or for TTLBlocks
+ * Blocks, checked as transactions arrive and Blocks are committed. A node
+ * may also set a fee floor, refusing transactions paying less than MinFee
+ * coins with ErrFeeTooLow whatever room its Mempool has. The zero
+ * MempoolLimits, the default, hold any transaction until it is mined.
+ */
+package chain
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+type MempoolLimits struct {
+	Txns      int           // transactions held, pending and queued, 0 for no cap
+	Bytes     int           // bytes of those, see Transaction.size, 0 for no cap
+	TTL       time.Duration // longest a transaction waits, 0 for no expiry
+	TTLBlocks int           // most Blocks committed while a transaction waits, 0 for no expiry
+	MinFee    Amount        // lowest fee of a transaction admitted, in coins at the latest fee rates
+}
+
+// Arrival of a held transaction
+type admission struct {
+	seq    uint64 // order of arrival
+	unixTs int64  // unix microseconds
+	height int    // of the last Block then
+	size   int    // see Transaction.size
+}
+
+/*
+ * Cap and expire the transactions of the Mempool from now on, the ones
+ * already held counting as arrived now
+ */
+func (bc *BlockChain) SetMempoolLimits(limits MempoolLimits) error {
+	if limits.Txns < 0 || limits.Bytes < 0 || limits.TTL < 0 || limits.TTLBlocks < 0 || limits.MinFee < 0 {
+		return fmt.Errorf("negative mempool limits %+v", limits)
+	}
+	bc.mempoolLimits = limits
+	clear(bc.mempool.admitted)
+	bc.expireTxns()
+	return bc.evict(0, 0)
+}
+
+// Pending and queued transactions, pending first
+func (mp *Mempool) held() []Transaction {
+	txns := append([]Transaction{}, mp.pending...)
+	for _, account := range sortedKeys(mp.queued) {
+		txns = append(txns, mp.queued[account]...)
+	}
+	return txns
+}
+
+/*
+ * Record the held transactions not seen yet as arrived at unixTs after
+ * the Block at height, and forget the ones no longer held
+ */
+func (mp *Mempool) stamp(unixTs int64, height int) {
+	held := make(map[string]bool)
+	for _, txn := range mp.held() {
+		hash := txn.Hash()
+		held[hash] = true
+		if _, ok := mp.admitted[hash]; !ok {
+			mp.arrivals++
+			mp.admitted[hash] = admission{mp.arrivals, unixTs, height, txn.size()}
+		}
+	}
+	for hash := range mp.admitted {
+		if !held[hash] {
+			delete(mp.admitted, hash)
+		}
+	}
+}
+
+// Drop a held transaction, the later pending ones of its payer going back to the queue
+func (mp *Mempool) remove(txn Transaction) {
+	hash := txn.Hash()
+	delete(mp.admitted, hash)
+	if i := slices.IndexFunc(mp.pending, func(p Transaction) bool { return p.Hash() == hash }); i >= 0 {
+		mp.pending = slices.Delete(mp.pending, i, i+1)
+		mp.rewind(txn.payer, txn.nonce)
+		return
+	}
+	queue := slices.DeleteFunc(mp.queued[txn.payer], func(q Transaction) bool { return q.Hash() == hash })
+	if len(queue) == 0 {
+		delete(mp.queued, txn.payer)
+	} else {
+		mp.queued[txn.payer] = queue
+	}
+}
+
+// Drop the transactions that waited longer than the limits allow
+func (bc *BlockChain) expireTxns() {
+	l, mp := bc.mempoolLimits, bc.mempool
+	if l == (MempoolLimits{}) {
+		return
+	}
+	// Only read the clock when limits are set, a StepClock moves at each reading
+	now, height := bc.now().UnixMicro(), bc.blocks.Len()-1
+	mp.stamp(now, height)
+	if l.TTL == 0 && l.TTLBlocks == 0 {
+		return
+	}
+	for _, txn := range mp.held() {
+		a := mp.admitted[txn.Hash()]
+		if (l.TTL > 0 && time.Duration(now-a.unixTs)*time.Microsecond >= l.TTL) || (l.TTLBlocks > 0 && height-a.height >= l.TTLBlocks) {
+			log.Printf("mempool: %v of %v expired", txn.Hash(), txn.payer)
+			mp.remove(txn)
+			bc.txnDropped(txn.Hash(), "expired")
+		}
+	}
+}
+
+// Refuse txn if it pays less than the fee floor
+func (bc *BlockChain) checkFeeFloor(txn Transaction) error {
+	if fee := txn.feeValue(bc.mempool.rates); fee < bc.mempoolLimits.MinFee {
+		return fmt.Errorf("%w: %v pays %v, the floor is %v", ErrFeeTooLow, txn.Hash(), fee, bc.mempoolLimits.MinFee)
+	}
+	return nil
+}
+
+/*
+ * Evict the cheapest held transactions until the Mempool has room for
+ * another transaction of size bytes paying fee coins, failing with
+ * ErrMempoolFull when that transaction would be the one to go
+ * size 0 checks the held transactions alone
+ */
+func (bc *BlockChain) evict(size int, fee Amount) error {
+	l, mp := bc.mempoolLimits, bc.mempool
+	if l.Txns == 0 && l.Bytes == 0 {
+		return nil
+	}
+	held := mp.held()
+	count, bytes := len(held), size
+	if size > 0 {
+		count++
+	}
+	for _, txn := range held {
+		bytes += mp.admitted[txn.Hash()].size
+	}
+	fits := func() bool { return (l.Txns == 0 || count <= l.Txns) && (l.Bytes == 0 || bytes <= l.Bytes) }
+	slices.SortStableFunc(held, func(a, b Transaction) int {
+		return cmp.Or(
+			cmp.Compare(a.feeValue(mp.rates), b.feeValue(mp.rates)),
+			cmp.Compare(mp.admitted[b.Hash()].seq, mp.admitted[a.Hash()].seq),
+		)
+	})
+	victims := []Transaction{}
+	for _, txn := range held {
+		if fits() {
+			break
+		}
+		if size > 0 && txn.feeValue(mp.rates) >= fee {
+			break
+		}
+		victims = append(victims, txn)
+		count--
+		bytes -= mp.admitted[txn.Hash()].size
+	}
+	if !fits() {
+		return fmt.Errorf("%w: a fee of %v does not outbid the %v transactions held", ErrMempoolFull, fee, len(held))
+	}
+	for _, txn := range victims {
+		log.Printf("mempool: evicting %v of %v, fee %v", txn.Hash(), txn.payer, txn.feeValue(mp.rates))
+		mp.remove(txn)
+		bc.txnDropped(txn.Hash(), "evicted by higher fees")
+	}
+	return nil
+}
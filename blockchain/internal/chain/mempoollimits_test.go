@@ -0,0 +1,43 @@
+package chain
+
+import "testing"
+
+// Transactions a reorg reverts count against the caps of the Mempool, the cheapest evicted
+func TestRequeueEvictsOverLimits(t *testing.T) {
+	genesis := TestGenesis(4)
+	fb := newFixtureBuilder("main", genesis)
+	bc := &fb.bc
+	txns := []Transaction{
+		{payer: "account0", payee: "account1", amt: COIN, fee: COIN / 10},
+		{payer: "account1", payee: "account2", amt: COIN, fee: 3 * COIN / 10},
+		{payer: "account2", payee: "account3", amt: COIN, fee: 2 * COIN / 10},
+	}
+	if err := bc.appendBlock(fb.mine(txns...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.SetMempoolLimits(MempoolLimits{Txns: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newFixtureBuilder("branch", genesis)
+	branch := []Block{}
+	for range 2 {
+		b := other.mine()
+		if err := other.bc.appendBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		branch = append(branch, b)
+	}
+	if err := bc.Reorg(0, branch); err != nil {
+		t.Fatal(err)
+	}
+	held := bc.mempool.held()
+	if len(held) != 2 {
+		t.Fatalf("%v transactions held after the reorg, the cap is 2", len(held))
+	}
+	for _, txn := range held {
+		if txn.Hash() == txns[0].Hash() {
+			t.Errorf("cheapest transaction %v kept", txn.Hash())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Merkle trees of transaction hashes.
+ * Leaves are the transaction hashes in Block order, each inner node the
+ * hash of its two children, the last node of an odd level being paired
+ * with itself. The root commits to the whole body of a Block, and the
+ * siblings along the path of one leaf prove its transaction is part of the
+ * Block to anyone holding just the header.
+ */
+package chain
+
+// Root of the Merkle tree of txns, the hash of nothing for an empty Block
+func merkleRoot(txns []Transaction) string {
+	if len(txns) == 0 {
+		return SHA256(nil)
+	}
+	level := make([]string, len(txns))
+	for i, txn := range txns {
+		level[i] = txn.Hash()
+	}
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+	return level[0]
+}
+
+func merkleParents(level []string) []string {
+	parents := make([]string, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		parents = append(parents, SHA256([]byte(level[i]+right)))
+	}
+	return parents
+}
+
+// Sibling of a node on the path from a leaf to the root
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // sibling is the left child
+}
+
+// Path proving txns[index] is committed by merkleRoot(txns)
+func merkleProof(txns []Transaction, index int) []MerkleStep {
+	level := make([]string, len(txns))
+	for i, txn := range txns {
+		level[i] = txn.Hash()
+	}
+	var proof []MerkleStep
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+		proof = append(proof, MerkleStep{Hash: level[sibling], Left: sibling < index})
+		level = merkleParents(level)
+		index /= 2
+	}
+	return proof
+}
+
+// Check proof leads from the transaction hash leaf to root
+func VerifyMerkleProof(leaf, root string, proof []MerkleStep) bool {
+	hash := leaf
+	for _, step := range proof {
+		if step.Left {
+			hash = SHA256([]byte(step.Hash + hash))
+		} else {
+			hash = SHA256([]byte(hash + step.Hash))
+		}
+	}
+	return hash == root
+}
@@ -0,0 +1,281 @@
+/*
+ * End-to-end encrypted direct messages.
+ * A TxnMessage carries a payload only its payee can read: the sender
+ * draws a one-time P-256 key, derives an AES-256-GCM key from its ECDH
+ * with the public key the payee signs with, and sends the one-time public
+ * key along with the ciphertext. The payee's wallet repeats the ECDH with
+ * its private key to decrypt. The sender and payee names are
+ * authenticated with the ciphertext, so a message cannot be passed off as
+ * sent by, or to, someone else.
+ *
+ * The payee's key is the one the chain learnt when it first signed a
+ * transaction, so an account that never signed cannot be messaged yet.
+ *
+ * The chain is a costly mailbox: every full node keeps each message for
+ * good, and pays GAS_MESSAGE_BYTE per byte of it, so a message of
+ * MAX_MESSAGE_SIZE bytes takes about a quarter of the gas of a Block.
+ * Only the content is private: who wrote to whom, when and how much stays
+ * public. Pruning drops old messages along with their Blocks.
+ *
+ *	GET /inbox/{account}?from=..  messages to account from a height on,
+ *	                              still encrypted
+ */
+package chain
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Max bytes of the text of a message
+const MAX_MESSAGE_SIZE = 1024
+
+// Gas of a message, plus GAS_MESSAGE_BYTE per byte of one-time key and ciphertext
+const GAS_MESSAGE = 21_000
+const GAS_MESSAGE_BYTE = 16
+
+// Most messages GET /inbox returns
+const MAX_INBOX_MESSAGES = 100
+
+// Bytes a sealed message adds to its text: the GCM nonce and tag
+const messageOverhead = 12 + 16
+
+type Message struct {
+	ephemeral []byte // one-time public key of the sender, uncompressed
+	sealed    []byte // GCM nonce followed by the ciphertext
+}
+
+/*
+ * Message from payer to payee, encrypted to payeeKey, the public key payee
+ * signs with
+ */
+func NewMessage(payer string, nonce uint64, payee string, payeeKey []byte, text []byte) (Transaction, error) {
+	pub, err := ecdh.P256().NewPublicKey(payeeKey)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("key of %v: %w", payee, err)
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return Transaction{}, err
+	}
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return Transaction{}, err
+	}
+	m := &Message{ephemeral: ephemeral.PublicKey().Bytes()}
+	gcm, err := messageCipher(shared, m.ephemeral, payeeKey)
+	if err != nil {
+		return Transaction{}, err
+	}
+	gcmNonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(gcmNonce); err != nil {
+		return Transaction{}, err
+	}
+	m.sealed = gcm.Seal(gcmNonce, gcmNonce, text, messageAD(payer, payee))
+	return Transaction{
+		kind:    TxnMessage,
+		payer:   payer,
+		payee:   payee,
+		nonce:   nonce,
+		message: m,
+	}, nil
+}
+
+// AES-256-GCM keyed from the ECDH secret, bound to both public keys
+func messageCipher(shared, ephemeral, payeeKey []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, shared, append(append([]byte{}, ephemeral...), payeeKey...), "toychain message", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Data authenticated along with the ciphertext
+func messageAD(payer, payee string) []byte {
+	return []byte(payer + "|" + payee)
+}
+
+func (m *Message) gas() uint64 {
+	if m == nil {
+		return GAS_MESSAGE
+	}
+	return GAS_MESSAGE + GAS_MESSAGE_BYTE*uint64(len(m.ephemeral)+len(m.sealed))
+}
+
+func (m *Message) verify(payee string) error {
+	if payee == "" {
+		return errors.New("message without payee")
+	}
+	if _, err := ecdh.P256().NewPublicKey(m.ephemeral); err != nil {
+		return fmt.Errorf("one-time key of the message: %w", err)
+	}
+	if len(m.sealed) < messageOverhead || len(m.sealed) > messageOverhead+MAX_MESSAGE_SIZE {
+		return fmt.Errorf("message text must be at most %v bytes", MAX_MESSAGE_SIZE)
+	}
+	return nil
+}
+
+func (m *Message) String() string {
+	return fmt.Sprintf("%v encrypted bytes", len(m.sealed)-messageOverhead)
+}
+
+// Decrypt a message sent to the account of the wallet
+func (w *Wallet) ReadMessage(txn Transaction) ([]byte, error) {
+	if txn.kind != TxnMessage || txn.message == nil {
+		return nil, errors.New("not a message")
+	}
+	if txn.payee != w.account {
+		return nil, fmt.Errorf("message to %v, not %v", txn.payee, w.account)
+	}
+	if w.key == nil {
+		return nil, fmt.Errorf("messages are encrypted to P-256 keys, %v signs with %v", w.account, w.Scheme())
+	}
+	priv, err := w.key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ecdh.P256().NewPublicKey(txn.message.ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := messageCipher(shared, txn.message.ephemeral, w.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	sealed := txn.message.sealed
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("message too short")
+	}
+	text, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], messageAD(txn.payer, txn.payee))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt message %v: %w", txn.Hash(), err)
+	}
+	return text, nil
+}
+
+// Public key account signs with, false if it never signed a transaction
+func (bc *BlockChain) PublicKey(account string) ([]byte, bool) {
+	key, ok := bc.state.keys[account]
+	return key, ok
+}
+
+type InboxMessage struct {
+	Height int     `json:"height"`
+	UnixTs int64   `json:"unixTs"` // of the Block, unix microseconds
+	Hash   string  `json:"hash"`   // of the transaction
+	Txn    jsonTxn `json:"txn"`    // carrying the encrypted message
+}
+
+/*
+ * Messages to account committed from height from on, at most
+ * MAX_INBOX_MESSAGES, skipping the Blocks whose body was pruned
+ */
+func (bc *BlockChain) Inbox(account string, from int) []InboxMessage {
+	inbox := []InboxMessage{}
+	for height := max(from, bc.pruned, 1); height < bc.blocks.Len() && len(inbox) < MAX_INBOX_MESSAGES; height++ {
+		b := bc.blockAt(height)
+		for _, txn := range b.data {
+			if txn.kind == TxnMessage && txn.payee == account && len(inbox) < MAX_INBOX_MESSAGES {
+				inbox = append(inbox, InboxMessage{height, b.unixTs, txn.Hash(), txn.toJSON()})
+			}
+		}
+	}
+	return inbox
+}
+
+/*
+ * Decrypt and print the messages to account with its key in the keystore
+ * at dir, or when sendTo is set, print a message from account to sendTo
+ * encrypted to its key on bc, returning the exit code
+ */
+func runInbox(bc *BlockChain, dir, account, sendTo, text string, out *Output) int {
+	if sendTo != "" {
+		key, ok := bc.PublicKey(sendTo)
+		if !ok {
+			log.Printf("no key known for %v, it must sign a transaction first", sendTo)
+			return 1
+		}
+		nonce := max(bc.state.nonce(account), bc.mempool.Counts(account).NextNonce)
+		txn, err := NewMessage(account, nonce, sendTo, key, []byte(text))
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		txn = txn.WithChainID(bc.ChainID())
+		if err := invalidTxn(txn.verify()); err != nil {
+			log.Print(err)
+			return 1
+		}
+		out.Note("POST the -output json form of the transaction to /txns of a node to submit it")
+		err = out.Record([][2]string{
+			{"hash", txn.Hash()},
+			{"nonce", fmt.Sprint(txn.nonce)},
+			{"to", sendTo},
+			{"gas", fmt.Sprint(txn.gas())},
+		}, txn.toJSON())
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	ks, err := NewKeystore(dir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	passphrase, err := readPassphrase()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	w, err := ks.Unlock(account, passphrase)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	type jsonRead struct {
+		InboxMessage
+		Text string `json:"text"`
+	}
+	rows, view := [][]string{}, []jsonRead{}
+	for _, m := range bc.Inbox(account, 0) {
+		text, err := w.ReadMessage(m.Txn.transaction())
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		rows = append(rows, []string{m.Hash, fmt.Sprint(m.Height), m.Txn.Payer, strconv.Quote(string(text))})
+		view = append(view, jsonRead{m, string(text)})
+	}
+	if err := out.Table([]string{"txn", "height", "from", "text"}, rows, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleInbox(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	var inbox []InboxMessage
+	s.node.withChain(func(bc *BlockChain) { inbox = bc.Inbox(r.PathValue("account"), from) })
+	writeJSON(w, http.StatusOK, inbox)
+}
@@ -0,0 +1,144 @@
+/*
+ * Per-Block metrics.
+ * One row per Block for lab reports: the time since its parent, the nonce
+ * found and the nonces tried to find it, its transactions, size and fees.
+ * All but the tries are read back from the Blocks; the tries are recorded
+ * as the chain mines, so Blocks mined elsewhere, or before a restart, have
+ * none, and kept for the last MAX_METRICS Blocks alone, until a reorg
+ * reverts their Block. Pruned bodies count no transactions, see pruning.go.
+ *
+ * -metrics prints them, -output csv as comma separated values for
+ * spreadsheets and notebooks, as does the API with ?format=csv.
+ *
+ *	GET /metrics?from=..&to=..  metrics of the Blocks from height from up to to, MAX_METRICS at most
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Max Blocks returned by GET /metrics
+const MAX_METRICS = 2000
+
+type BlockMetrics struct {
+	Height     int     `json:"height"`
+	Hash       string  `json:"hash"`
+	UnixTs     int64   `json:"unixTs"`
+	Interval   float64 `json:"interval"` // seconds since the parent, 0 up to the first Block as genesis is stamped by hand
+	Difficulty int     `json:"difficulty"`
+	Nonce      int     `json:"nonce"`
+	Attempts   int     `json:"attempts,omitempty"` // nonces tried mining it, 0 if not mined here
+	Txns       int     `json:"txns"`
+	Size       int     `json:"size"` // bytes of the transactions, see blocksize.go
+	Fees       Amount  `json:"fees"` // paid in the chain's coin
+}
+
+// Nonces tried mining a Block, and the height it was mined at
+type minedAttempts struct {
+	height   int
+	attempts int
+}
+
+/*
+ * Record the nonces tried mining the Block of hash on top of the chain,
+ * forgetting those of the Blocks MAX_METRICS below
+ */
+func (bc *BlockChain) recordAttempts(hash string, attempts int) {
+	if bc.attempts == nil {
+		bc.attempts = map[string]minedAttempts{}
+	}
+	height := bc.blocks.Len()
+	bc.attempts[hash] = minedAttempts{height, attempts}
+	maps.DeleteFunc(bc.attempts, func(_ string, a minedAttempts) bool {
+		return a.height <= height-MAX_METRICS
+	})
+}
+
+// Forget the nonces tried mining the Blocks above height, reverted by a reorg
+func (bc *BlockChain) forgetAttempts(height int) {
+	maps.DeleteFunc(bc.attempts, func(_ string, a minedAttempts) bool {
+		return a.height > height
+	})
+}
+
+func (bc *BlockChain) blockMetrics(height int) BlockMetrics {
+	b := bc.blockAt(height)
+	m := BlockMetrics{
+		Height:     height,
+		Hash:       b.hash,
+		UnixTs:     b.unixTs,
+		Difficulty: b.difficulty,
+		Nonce:      b.nonce,
+		Attempts:   bc.attempts[b.hash].attempts,
+		Txns:       len(b.data),
+		Size:       b.size(),
+	}
+	if height > 1 {
+		m.Interval = float64(b.unixTs-bc.blockAt(height-1).unixTs) / 1e6
+	}
+	for _, txn := range b.data {
+		if txn.feeAsset == "" {
+			m.Fees += txn.totalFee()
+		}
+	}
+	return m
+}
+
+// Metrics of the Blocks from height from to height to included, up to the last Block
+func (bc *BlockChain) Metrics(from, to int) []BlockMetrics {
+	metrics := []BlockMetrics{}
+	for height := max(from, 0); height <= min(to, bc.blocks.Len()-1); height++ {
+		metrics = append(metrics, bc.blockMetrics(height))
+	}
+	return metrics
+}
+
+func printMetrics(out *Output, metrics []BlockMetrics) error {
+	rows := [][]string{}
+	for _, m := range metrics {
+		attempts := ""
+		if m.Attempts > 0 {
+			attempts = strconv.Itoa(m.Attempts)
+		}
+		rows = append(rows, []string{fmt.Sprint(m.Height), m.Hash, fmt.Sprint(m.UnixTs), fmt.Sprintf("%.3f", m.Interval),
+			fmt.Sprint(m.Difficulty), fmt.Sprint(m.Nonce), attempts, fmt.Sprint(m.Txns), fmt.Sprint(m.Size), fmt.Sprint(m.Fees)})
+	}
+	header := []string{"height", "hash", "unixTs", "interval", "difficulty", "nonce", "attempts", "txns", "size", "fees"}
+	return out.Table(header, rows, metrics)
+}
+
+// Print the metrics of every Block of bc, returning the exit code
+func runMetrics(bc *BlockChain, out *Output) int {
+	if err := printMetrics(out, bc.Metrics(0, bc.blocks.Len()-1)); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// GET /metrics?from=..&to=..[&format=csv], CSV also for Accept: text/csv
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		to = from + MAX_METRICS - 1
+	}
+	var metrics []BlockMetrics
+	s.node.withChain(func(bc *BlockChain) {
+		metrics = bc.Metrics(from, min(to, max(from, 0)+MAX_METRICS-1))
+	})
+	if r.URL.Query().Get("format") != "csv" && !strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		writeJSON(w, http.StatusOK, metrics)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	if err := printMetrics(NewOutput(OutputCSV, w), metrics); err != nil {
+		log.Printf("GET /metrics: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package chain
+
+import "testing"
+
+func TestAttemptsKeptForMetricsWindow(t *testing.T) {
+	bc := CreateBlockChain(TestGenesis(2))
+	for range MAX_METRICS + 10 {
+		if err := bc.CommitEmptyBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bc.attempts) != MAX_METRICS {
+		t.Fatalf("tries of %v blocks kept, expected %v", len(bc.attempts), MAX_METRICS)
+	}
+	tip := bc.blocks.Len() - 1
+	if m := bc.blockMetrics(tip); m.Attempts == 0 {
+		t.Error("no tries for the last block")
+	}
+	if m := bc.blockMetrics(tip - MAX_METRICS); m.Attempts != 0 {
+		t.Errorf("tries %v kept for a block past the window", m.Attempts)
+	}
+}
+
+func TestAttemptsForgottenOnReorg(t *testing.T) {
+	tn := NewTestNet(2, TestGenesis(2))
+	defer tn.Close()
+	tn.Partition([]int{0}, []int{1})
+	lost, err := tn.MineOn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := tn.MineOn(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tn.Heal()
+	if _, err := tn.Settle(); err != nil {
+		t.Fatal(err)
+	}
+	tn.Node(0).withChain(func(bc *BlockChain) {
+		if bc.lastBlock().hash == lost.hash {
+			t.Fatal("node 0 did not reorganize")
+		}
+		if _, ok := bc.attempts[lost.hash]; ok {
+			t.Errorf("tries of reverted block %v kept", lost.hash)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+/*
+ * Background mining.
+ * A Miner watches the Mempool of a Node and commits a Block as soon as
+ * enough transactions are pending, or when the oldest pending transaction
+ * has waited long enough, so clients only submit transactions like they
+ * would to a real node.
+ *
+ * A scheduled Miner cuts a Block every interval instead, empty when no
+ * pending transaction applies, so Blocks come at predictable times for
+ * demos and integration tests. A tick coming while a Block is still being
+ * mined is skipped.
+ */
+package chain
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	MINER_MIN_TXNS = MAX_TXNS_PER_BLOCK // pending transactions filling a Block of the legacy limits
+	MINER_MAX_WAIT = 10 * time.Second   // wait before mining a partial Block
+)
+
+type Miner struct {
+	node     *Node
+	minTxns  int           // pending transactions mined right away
+	maxWait  time.Duration // longest a pending transaction waits for a Block
+	interval time.Duration // between the Blocks of a scheduled Miner, 0 mining on demand
+
+	mu   sync.Mutex
+	stop chan struct{} // closed to stop the loop, nil when stopped
+	done chan struct{} // closed when the loop exited
+}
+
+// Miner of node mining minTxns pending transactions at once, fewer after maxWait
+func NewMiner(node *Node, minTxns int, maxWait time.Duration) *Miner {
+	return &Miner{node: node, minTxns: max(minTxns, 1), maxWait: maxWait}
+}
+
+// Miner of node cutting a Block every interval, whatever is pending
+func NewScheduledMiner(node *Node, interval time.Duration) *Miner {
+	return &Miner{node: node, minTxns: 1, interval: interval}
+}
+
+// Start mining in the background, a no-op if the Miner runs already
+func (m *Miner) Start() error {
+	if m.node.IsReplica() {
+		return ErrReadReplica
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return nil
+	}
+	m.stop, m.done = make(chan struct{}), make(chan struct{})
+	go m.run(m.stop, m.done)
+	return nil
+}
+
+// Stop mining, waiting for the Block being mined if any
+func (m *Miner) Stop() {
+	m.mu.Lock()
+	stop, done := m.stop, m.done
+	m.stop, m.done = nil, nil
+	m.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (m *Miner) Running() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stop != nil
+}
+
+func (m *Miner) run(stop, done chan struct{}) {
+	defer close(done)
+	if m.interval > 0 {
+		m.runScheduled(stop)
+		return
+	}
+	txns, cancel := m.node.Subscribe(NewTxn)
+	defer cancel()
+	var deadline <-chan time.Time // set while transactions are pending
+	for {
+		pending := m.pending()
+		if pending >= m.minTxns {
+			m.mine()
+			pending, deadline = m.pending(), nil
+		}
+		if pending == 0 {
+			deadline = nil
+		} else if deadline == nil {
+			deadline = time.After(m.maxWait)
+		}
+		select {
+		case <-stop:
+			return
+		case <-txns:
+		case <-deadline:
+			m.mine()
+			deadline = nil
+		}
+	}
+}
+
+func (m *Miner) pending() int {
+	var pending int
+	m.node.withChain(func(bc *BlockChain) { pending = bc.mempool.Len() })
+	return pending
+}
+
+func (m *Miner) mine() {
+	if err := m.node.CommitBlock(); err != nil && !errors.Is(err, ErrEmptyMempool) {
+		log.Printf("miner: %v", err)
+	}
+}
+
+func (m *Miner) runScheduled(stop chan struct{}) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.cut()
+		}
+	}
+}
+
+// Commit a Block of the pending transactions, or an empty one if none applies
+func (m *Miner) cut() {
+	m.node.withChain(func(bc *BlockChain) {
+		err := bc.CommitBlock()
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, ErrEmptyMempool) {
+			log.Printf("miner: %v", err)
+		}
+		if err := bc.CommitEmptyBlock(); err != nil {
+			log.Printf("miner: empty block: %v", err)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+/*
+ * Mining benchmarks and simulation of competing miners.
+ * The benchmarks of the simulate package mine real Blocks at each
+ * difficulty with the Proof Of Work of the chain, measuring the hash rate of
+ * this machine and how long a Block takes:
+ *
+ *	go test -run '^$' -bench Mining -benchtime 5x ./simulate
+ *
+ * Each difficulty step asks for one more leading 0, 16 times the work, so
+ * the expected Block time is 16^difficulty hashes over the hash rate; the
+ * measured times, ns/op, scatter around it as mining a Block is a lottery.
+ * Few Blocks are mined at high difficulties, so their mean time is noisy:
+ * raise -benchtime for a smoother plot. BenchmarkMiningScrypt mines with
+ * the memory-hard work, see pow.go, to compare its hash rate with SHA-256.
+ *
+ * The simulation races miners of given hash power, in multiples of the
+ * measured hash rate. Each one finds a Block after a random time of mean
+ * 16^difficulty over its hash rate, the first one wins it and all start
+ * over on the next Block. A miner wins its share of the total hash power,
+ * and Blocks come as fast as if the whole power were one miner.
+ */
+package chain
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+const (
+	MINING_BENCH_DIFFICULTY        = 6    // highest difficulty benchmarked, from 1
+	MINING_BENCH_SCRYPT_DIFFICULTY = 3    // highest difficulty benchmarked with scrypt
+	MINER_SIM_BLOCKS               = 1000 // Blocks raced for by the simulated miners
+)
+
+// Block of a few transactions to mine at difficulty, the i-th of the benchmark
+func benchBlock(difficulty, i int) Block {
+	return Block{
+		Header: Header{prevHash: SHA256([]byte(fmt.Sprintf("bench|%v|%v", difficulty, i))), miner: "bench", unixTs: time.Now().UnixMicro()},
+		data: []Transaction{
+			{payer: "alice", payee: "bob", amt: COIN, nonce: uint64(i)},
+			{payer: "bob", payee: "carol", amt: 2 * COIN, nonce: uint64(i)},
+		},
+	}
+}
+
+/*
+ * Mine the i-th Block of the benchmark at difficulty with pow, SHA-256 if
+ * nil, returning the hashes it took
+ */
+func MineBenchBlock(difficulty, i int, pow *PowSpec) int64 {
+	blk := benchBlock(difficulty, i)
+	blk.mine(difficulty, pow)
+	return int64(blk.nonce) + 1
+}
+
+type MinerSimConfig struct {
+	Difficulty int
+	HashRates  []float64 // hashes per second of each miner
+	Blocks     int
+	Seed       uint64
+}
+
+type MinerSimResult struct {
+	MeanInterval float64 // seconds between Blocks
+	Won          []int   // Blocks won by each miner
+}
+
+func SimulateMiners(cfg MinerSimConfig) MinerSimResult {
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	work := math.Pow(16, float64(cfg.Difficulty))
+	result := MinerSimResult{Won: make([]int, len(cfg.HashRates))}
+	total := 0.0
+	for height := 0; height < cfg.Blocks; height++ {
+		winner, first := 0, math.Inf(1)
+		for i, rate := range cfg.HashRates {
+			if t := rng.ExpFloat64() * work / rate; t < first {
+				winner, first = i, t
+			}
+		}
+		result.Won[winner]++
+		total += first
+	}
+	result.MeanInterval = total / float64(cfg.Blocks)
+	return result
+}
+
+// Hash powers of a list, eg. 1,2,0.5
+func parseHashPowers(list string) ([]float64, error) {
+	powers := []float64{}
+	for _, p := range splitList(list) {
+		power, err := strconv.ParseFloat(p, 64)
+		if err != nil || power <= 0 {
+			return nil, fmt.Errorf("hash power %q is not a positive number", p)
+		}
+		powers = append(powers, power)
+	}
+	return powers, nil
+}
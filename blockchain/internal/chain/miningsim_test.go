@@ -0,0 +1,26 @@
+package chain
+
+import (
+	"math"
+	"testing"
+)
+
+// Miners win their share of the hash power, Blocks coming as fast as from one miner of it all
+func TestSimulateMiners(t *testing.T) {
+	powers := []float64{1, 2, 5}
+	for difficulty := 1; difficulty <= MINING_BENCH_DIFFICULTY; difficulty++ {
+		sim := SimulateMiners(MinerSimConfig{Difficulty: difficulty, HashRates: powers, Blocks: MINER_SIM_BLOCKS, Seed: uint64(difficulty)})
+		total := 0.0
+		for _, p := range powers {
+			total += p
+		}
+		for i, p := range powers {
+			if share := float64(sim.Won[i]) / MINER_SIM_BLOCKS; math.Abs(share-p/total) > 0.05 {
+				t.Errorf("difficulty %v: miner of power %v won %.3f of the blocks, expected %.3f", difficulty, p, share, p/total)
+			}
+		}
+		if expected := math.Pow(16, float64(difficulty)) / total; math.Abs(sim.MeanInterval/expected-1) > 0.1 {
+			t.Errorf("difficulty %v: mean interval %v, expected %v", difficulty, sim.MeanInterval, expected)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Merkle Mountain Range of the Block hashes.
+ * An append-only accumulator: each Block hash is a leaf, and whenever two
+ * perfect trees of the same height sit side by side they are merged under
+ * a new node. The nodes are numbered in the order they are appended, so
+ * the leaf of the Block at height h is at position 2h - popcount(h). The
+ * root bags the peaks of the remaining trees from right to left. Unlike
+ * the hash chain, the root commits to every Block at once, which is what
+ * a pruning receipt signs, see pruning.go.
+ */
+package chain
+
+import "math/bits"
+
+type MMR struct {
+	nodes   []string // hex hashes, by position
+	heights []int    // height of each node in its tree, 0 for leaves
+}
+
+// Append the leaf hash, merging the trees it completes, and return its position
+func (m *MMR) Append(hash string) int {
+	pos := len(m.nodes)
+	m.nodes, m.heights = append(m.nodes, hash), append(m.heights, 0)
+	for height := 0; ; height++ {
+		last := len(m.nodes) - 1
+		left := last - (2<<height - 1) // sibling on the left, 2^(height+1)-1 nodes before
+		if left < 0 || m.heights[left] != height || m.heights[last] != height {
+			break
+		}
+		m.nodes = append(m.nodes, SHA256([]byte(m.nodes[left]+m.nodes[last])))
+		m.heights = append(m.heights, height+1)
+	}
+	return pos
+}
+
+// Number of nodes
+func (m *MMR) Size() int {
+	return len(m.nodes)
+}
+
+// Positions of the peaks, left to right
+func (m *MMR) peaks() []int {
+	peaks := []int{}
+	for pos := len(m.nodes) - 1; pos >= 0; pos -= 2<<m.heights[pos] - 1 {
+		peaks = append([]int{pos}, peaks...)
+	}
+	return peaks
+}
+
+// Hash committing to every leaf, empty if there is none
+func (m *MMR) Root() string {
+	peaks := m.peaks()
+	if len(peaks) == 0 {
+		return ""
+	}
+	root := m.nodes[peaks[len(peaks)-1]]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		root = SHA256([]byte(m.nodes[peaks[i]] + root))
+	}
+	return root
+}
+
+// Position of the leaf of the Block at height
+func mmrLeafPos(height int) int {
+	return 2*height - bits.OnesCount(uint(height))
+}
+
+// MMR of the hashes of the Blocks up to height
+func (bc *BlockChain) mmrTo(height int) *MMR {
+	m := &MMR{}
+	for h := 0; h <= height; h++ {
+		m.Append(bc.blockAt(h).hash)
+	}
+	return m
+}
@@ -0,0 +1,92 @@
+/*
+ * M-of-N multisignature accounts.
+ * A TxnMultisig declares N public keys and a threshold M for its payer.
+ * From then on, every transaction paid by that account must carry valid
+ * signatures from at least M distinct declared keys, including a later
+ * TxnMultisig changing the keys or the threshold.
+ */
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const MAX_MULTISIG_KEYS = 16
+
+const (
+	GAS_MULTISIG_KEY = 2_000 // per key declared by a TxnMultisig
+	GAS_COSIGNATURE  = 3_000 // per signature carried by a transaction
+)
+
+type MultisigSpec struct {
+	keys      [][]byte // public keys of the scheme the spends sign with
+	threshold int      // signatures needed
+}
+
+func NewMultisig(payer string, nonce uint64, threshold int, keys ...[]byte) Transaction {
+	return Transaction{
+		kind:     TxnMultisig,
+		payer:    payer,
+		nonce:    nonce,
+		multisig: &MultisigSpec{keys: keys, threshold: threshold},
+	}
+}
+
+// Sign the transaction with one of the keys of a multisig payer
+func (txn *Transaction) CoSign(s Signer) error {
+	sig, err := s.SignTxn(*txn)
+	if err != nil {
+		return err
+	}
+	txn.cosigs = append(txn.cosigs, sig)
+	return nil
+}
+
+func (m *MultisigSpec) verify() error {
+	if len(m.keys) == 0 || len(m.keys) > MAX_MULTISIG_KEYS {
+		return fmt.Errorf("multisig needs 1 to %v keys", MAX_MULTISIG_KEYS)
+	}
+	if m.threshold < 1 || m.threshold > len(m.keys) {
+		return fmt.Errorf("threshold %v out of 1..%v", m.threshold, len(m.keys))
+	}
+	for i, key := range m.keys {
+		for _, other := range m.keys[:i] {
+			if bytes.Equal(key, other) {
+				return errors.New("duplicate multisig key")
+			}
+		}
+	}
+	return nil
+}
+
+// Whether sigs hold valid signatures of digest with scheme by at least threshold keys
+func (m *MultisigSpec) satisfied(scheme SigScheme, digest []byte, sigs [][]byte) bool {
+	signed := 0
+	for _, key := range m.keys {
+		for _, sig := range sigs {
+			if verifySignature(scheme, key, digest, sig) {
+				signed++
+				break
+			}
+		}
+	}
+	return signed >= m.threshold
+}
+
+func (m *MultisigSpec) String() string {
+	return fmt.Sprintf("%v-of-%v multisig", m.threshold, len(m.keys))
+}
+
+// Check the signatures of a transaction paid by a multisig account
+func (s *State) checkMultisig(txn Transaction) error {
+	m, ok := s.multisigs[txn.payer]
+	if !ok {
+		return nil
+	}
+	if !m.satisfied(txn.scheme, txn.digest(), txn.cosigs) {
+		return fmt.Errorf("%w: %v needs %v", ErrInvalidSignature, txn.payer, m)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Name registry.
+ * Human-readable names for accounts, in the way of ENS: a name maps to an
+ * address and is written to the chain as a key-value write, see kv.go, of
+ * the address under NAME_ADDRESS_KEY in the namespace NAME_NAMESPACE_PREFIX
+ * and the name. The first account registering a name becomes its owner,
+ * as it becomes the owner of any namespace, and only the owner may point
+ * the name elsewhere or release it, by writing an empty address; a
+ * released name stays its owner's.
+ *
+ * Names are 1 to MAX_NAME_SIZE lowercase letters, digits and inner
+ * hyphens. The shell and the wallet take @name wherever they take an
+ * account, resolving it on the chain at the latest height:
+ *
+ *	toychain> register alice alice alice
+ *	toychain> mine
+ *	toychain> send bob @alice 5
+ *	-coins bob -pay-utxo @alice=5
+ *	-resolve alice
+ *
+ * Resolution trusts the chain it reads: a name points where its owner last
+ * said, so check the owner of a name before paying it much.
+ *
+ *	GET /names/{name}?height=..  owner and address of a name
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// State keys of a name, in the namespace NAME_NAMESPACE_PREFIX and the name
+const (
+	NAME_NAMESPACE_PREFIX = "name/"
+	NAME_ADDRESS_KEY      = "address"
+)
+
+// Longest name, filling a key-value namespace
+const MAX_NAME_SIZE = MAX_KV_NAMESPACE_SIZE - len(NAME_NAMESPACE_PREFIX)
+
+// Prefix of names given for accounts, eg. @alice
+const NAME_SIGIL = "@"
+
+type NameRecord struct {
+	Name    string `json:"name"`
+	Owner   string `json:"owner"`
+	Address string `json:"address"`
+}
+
+func nameNamespace(name string) string {
+	return NAME_NAMESPACE_PREFIX + name
+}
+
+// Whether name is made of lowercase letters, digits and inner hyphens
+func checkName(name string) error {
+	if name == "" || len(name) > MAX_NAME_SIZE {
+		return fmt.Errorf("name must be 1 to %v characters", MAX_NAME_SIZE)
+	}
+	if strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") {
+		return fmt.Errorf("name %q starts or ends with a hyphen", name)
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return fmt.Errorf("name %q has %q, want lowercase letters, digits and hyphens", name, c)
+		}
+	}
+	return nil
+}
+
+// Point name at address as owner, claiming it if free, releasing it if address is empty
+func NewNameRegistration(owner string, nonce uint64, name, address string) (Transaction, error) {
+	if err := checkName(name); err != nil {
+		return Transaction{}, err
+	}
+	return NewKVWrite(owner, nonce, nameNamespace(name), NAME_ADDRESS_KEY, []byte(address)), nil
+}
+
+// Owner and address of name in state
+func resolveName(state *StateView, name string) (NameRecord, error) {
+	if err := checkName(name); err != nil {
+		return NameRecord{}, fmt.Errorf("%w: %w", ErrUnknownName, err)
+	}
+	address, ok := state.GetKV(nameNamespace(name), NAME_ADDRESS_KEY)
+	if !ok {
+		return NameRecord{}, fmt.Errorf("%w: %q", ErrUnknownName, name)
+	}
+	return NameRecord{name, state.NamespaceOwner(nameNamespace(name)), string(address)}, nil
+}
+
+// Owner and address of name after the last committed Block
+func (bc *BlockChain) ResolveName(name string) (NameRecord, error) {
+	return resolveName(bc.latest(), name)
+}
+
+// Address of account given as @name, account itself otherwise
+func (bc *BlockChain) ResolveAccount(account string) (string, error) {
+	name, ok := strings.CutPrefix(account, NAME_SIGIL)
+	if !ok {
+		return account, nil
+	}
+	rec, err := bc.ResolveName(name)
+	return rec.Address, err
+}
+
+// Print the owner and address of name on bc, returning the exit code
+func runResolve(bc *BlockChain, name string, out *Output) int {
+	rec, err := bc.ResolveName(strings.TrimPrefix(name, NAME_SIGIL))
+	if err == nil {
+		err = out.Record([][2]string{
+			{"name", rec.Name},
+			{"owner", rec.Owner},
+			{"address", rec.Address},
+		}, rec)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// GET /names/{name}?height=..
+func (s *Server) handleName(w http.ResponseWriter, r *http.Request) {
+	var rec NameRecord
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		var view *StateView
+		if view, err = requestView(bc, r); err == nil {
+			rec, err = resolveName(view, strings.TrimPrefix(r.PathValue("name"), NAME_SIGIL))
+		}
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
@@ -0,0 +1,167 @@
+/*
+ * Fault injection between the nodes of a TestNet.
+ * Real networks lose, repeat and hold up messages, and split into parts
+ * that cannot reach each other. Every request of a node of a TestNet to
+ * another goes through the link between them, see testnet.go, which
+ * applies the faults set on it at the time:
+ *
+ *	partition  Partition cuts links both ways until Heal, requests
+ *	           failing as if the peer were down
+ *	drop       a request is lost, failing like a timeout
+ *	duplicate  a request is handled twice, eg. a relayed transaction
+ *	           arriving again, the sender seeing the last reply
+ *	delay      Step syncs over the link every Delay+1 rounds only, Blocks
+ *	           crossing it that many rounds late
+ *	latency    the request is held that long, for nodes relaying from
+ *	           their own goroutines
+ *
+ * Faults are set per direction, on the requests node from sends node to;
+ * syncing, node from pulls the Blocks of node to. The drops and duplicates
+ * are drawn from a seed, 1 unless set by SetFaultSeed, so a run with the
+ * same calls meets the same faults.
+ *
+ * Cut off by a partition, each side keeps mining its own branch; healed,
+ * the nodes of the lighter branch switch to the heavier one, see reorg.go.
+ * -testnet N shows it, with -testnet-faults adding faults to every link.
+ */
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LinkFaults struct {
+	Drop      float64       // chance of losing a request
+	Duplicate float64       // chance of handling a request twice
+	Delay     int           // rounds of Step between two syncs over the link
+	Latency   time.Duration // holding each request
+}
+
+// Link of the in-memory transport to node to, carrying the requests of node from, -1 for the process
+type memLink struct {
+	tn       *TestNet
+	from, to int
+}
+
+// Inject faults in the requests node from sends node to from now on, the zero LinkFaults for none
+func (tn *TestNet) SetFaults(from, to int, faults LinkFaults) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	if faults == (LinkFaults{}) {
+		delete(tn.faults, [2]int{from, to})
+	} else {
+		tn.faults[[2]int{from, to}] = faults
+	}
+}
+
+// Inject faults in the requests between any two nodes
+func (tn *TestNet) SetAllFaults(faults LinkFaults) {
+	for from := range tn.nodes {
+		for to := range tn.nodes {
+			if from != to {
+				tn.SetFaults(from, to, faults)
+			}
+		}
+	}
+}
+
+// Draw the drops and duplicates from seed from now on
+func (tn *TestNet) SetFaultSeed(seed uint64) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	tn.rng = rand.New(rand.NewPCG(seed, 0))
+}
+
+// Whether node from skips syncing from node to this round
+func (tn *TestNet) delayed(from, to int) bool {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	delay := tn.faults[[2]int{from, to}].Delay
+	return delay > 0 && tn.round%(delay+1) != 0
+}
+
+// Faults of l, whether the request sent over it is dropped and whether it is duplicated, failing if l is cut
+func (l *memLink) draw() (LinkFaults, bool, bool, error) {
+	tn := l.tn
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	if l.from < 0 {
+		return LinkFaults{}, false, false, nil
+	}
+	if tn.cut[link(l.from, l.to)] {
+		return LinkFaults{}, false, false, fmt.Errorf("node %v cut off from node %v", l.from, l.to)
+	}
+	faults := tn.faults[[2]int{l.from, l.to}]
+	drop := faults.Drop > 0 && tn.rng.Float64() < faults.Drop
+	if drop {
+		tn.faulted++
+	}
+	return faults, drop, faults.Duplicate > 0 && tn.rng.Float64() < faults.Duplicate, nil
+}
+
+func (l *memLink) roundTrip(req *http.Request) (*http.Response, error) {
+	faults, drop, duplicate, err := l.draw()
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(faults.Latency)
+	if drop {
+		return nil, fmt.Errorf("request dropped between node %v and node %v", l.from, l.to)
+	}
+	server := l.tn.servers[l.to]
+	if !duplicate {
+		return serveInMemory(server, req), nil
+	}
+	var body []byte
+	if req.Body != nil {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	first := req.Clone(req.Context())
+	first.Body = io.NopCloser(bytes.NewReader(body))
+	serveInMemory(server, first).Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return serveInMemory(server, req), nil
+}
+
+/*
+ * Faults of -testnet-faults, comma separated, eg.
+ * drop=0.2,duplicate=0.1,delay=2,latency=5ms
+ */
+func ParseLinkFaults(spec string) (LinkFaults, error) {
+	var faults LinkFaults
+	for _, field := range strings.Split(spec, ",") {
+		if field == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(field, "=")
+		var err error
+		switch name {
+		case "drop":
+			faults.Drop, err = strconv.ParseFloat(value, 64)
+		case "duplicate":
+			faults.Duplicate, err = strconv.ParseFloat(value, 64)
+		case "delay":
+			faults.Delay, err = strconv.Atoi(value)
+		case "latency":
+			faults.Latency, err = time.ParseDuration(value)
+		default:
+			return LinkFaults{}, fmt.Errorf("unknown fault %q, expected drop, duplicate, delay or latency", name)
+		}
+		if err != nil {
+			return LinkFaults{}, fmt.Errorf("fault %q: %w", field, err)
+		}
+	}
+	if faults.Drop < 0 || faults.Drop >= 1 || faults.Duplicate < 0 || faults.Duplicate > 1 || faults.Delay < 0 || faults.Latency < 0 {
+		return LinkFaults{}, fmt.Errorf("faults %q out of range, drop below 1", spec)
+	}
+	return faults, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * A Node owns a BlockChain and serializes access to it, so the chain can
+ * be driven concurrently by the HTTP server and other components.
+ */
+package chain
+
+import "sync"
+
+type Node struct {
+	mu       sync.Mutex
+	bc       *BlockChain
+	events   *EventBus
+	primary  string // node followed as a read replica, see Follow
+	dev      bool   // admin requests of devnets allowed, see SetDev
+	autoMine bool   // Block sealed on each admitted transaction, see SetAutoMine
+	relay    *relay // transaction relay to peers, see SetRelay
+
+	adminToken string // of the operator routes of the node API, see SetAdminToken
+
+	alertKey *Wallet // signs the alerts the node raises, see alert.go
+	alerts   []Alert // last ALERT_LOG_SIZE alerts, oldest first
+
+	snapshots       *snapshotRecorder // see RecordSnapshots
+	backups         *backupJob        // see StartBackups
+	pruning         *pruneJob         // see StartPruning
+	webhooks        *webhooks         // see AddWebhook
+	privateWebhooks bool              // webhooks may target private addresses, see SetPrivateWebhooks
+	sinks           []*eventSink      // see AddEventSink
+	limiter         *rateLimiter      // see SetRateLimits
+}
+
+func NewNode(bc *BlockChain) *Node {
+	n := &Node{
+		bc:     bc,
+		events: NewEventBus(),
+	}
+	bc.events = n.events
+	return n
+}
+
+// Subscribe to chain events, see EventBus.Subscribe
+func (n *Node) Subscribe(t EventType) (<-chan Event, func()) {
+	return n.events.Subscribe(t)
+}
+
+// Add txn to the Mempool and relay it to peers, read replicas refuse it
+func (n *Node) AddTxn(txn Transaction) error {
+	if n.IsReplica() {
+		return ErrReadReplica
+	}
+	if n.relayer().stemming() {
+		return n.stemTxn(txn, false)
+	}
+	return n.fluffTxn(txn)
+}
+
+// Commit outstanding transactions, read replicas never mine
+func (n *Node) CommitBlock() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.primary != "" {
+		return ErrReadReplica
+	}
+	return n.bc.CommitBlock()
+}
+
+// Run f with exclusive access to the BlockChain
+func (n *Node) withChain(f func(bc *BlockChain)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f(n.bc)
+}
@@ -0,0 +1,610 @@
+/*
+ * Encrypted transport between nodes.
+ * Nodes talk to each other over their HTTP API. Served with
+ * ListenAndServeNoise, the API runs over connections opened with a Noise
+ * XX handshake (Noise_XX_25519_AESGCM_SHA256), which encrypts them and
+ * authenticates both ends by the static X25519 key of their NodeIdentity:
+ *
+ *	-> e
+ *	<- e, ee, s, es
+ *	-> s, se
+ *
+ * Peers are then reached at noise://KEY@host:port URLs, KEY being the hex
+ * public key of the peer, and the connection fails unless the peer proves
+ * it holds that key. Every HTTP client of the package understands these
+ * URLs, so sync, relay, follow and recovery all work over Noise.
+ *
+ * Downgrades are refused three ways. The prologue commits both ends to
+ * NOISE_PROLOGUE, so a handshake tampered with to pick another version or
+ * protocol fails. A noise:// peer is never retried in plaintext. A Noise
+ * listener drops connections that do not open with a handshake, and a
+ * Node relaying with RequireNoise refuses relayed transactions reaching its
+ * plaintext API.
+ *
+ * Transport messages are framed by a 2 bytes big endian length, as in the
+ * Noise spec, limiting them to NOISE_MAX_MESSAGE bytes.
+ */
+package chain
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NOISE_PROTOCOL          = "Noise_XX_25519_AESGCM_SHA256"
+	NOISE_PROLOGUE          = "toychain p2p 1"
+	NOISE_MAX_MESSAGE       = 65535
+	NOISE_HANDSHAKE_TIMEOUT = 10 * time.Second
+)
+
+// Long lived X25519 key a node is known by to its peers
+type NodeIdentity struct {
+	key *ecdh.PrivateKey
+}
+
+func NewNodeIdentity() (*NodeIdentity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeIdentity{key: key}, nil
+}
+
+// Identity stored in hex at path, generated and stored if path does not exist
+func LoadNodeIdentity(path string) (*NodeIdentity, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		id, err := NewNodeIdentity()
+		if err != nil {
+			return nil, err
+		}
+		data := hex.EncodeToString(id.key.Bytes()) + "\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			return nil, err
+		}
+		return id, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("node key %v: %w", path, err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("node key %v: %w", path, err)
+	}
+	return &NodeIdentity{key: key}, nil
+}
+
+func (id *NodeIdentity) PublicKey() []byte {
+	return id.key.PublicKey().Bytes()
+}
+
+// Public key in hex, as it appears in noise:// URLs
+func (id *NodeIdentity) String() string {
+	return hex.EncodeToString(id.PublicKey())
+}
+
+var (
+	localIdentityMu sync.Mutex
+	localIdentity   *NodeIdentity
+)
+
+// Identity presented when dialing noise:// peers, a fresh one per run unless set
+func SetNodeIdentity(id *NodeIdentity) {
+	localIdentityMu.Lock()
+	defer localIdentityMu.Unlock()
+	localIdentity = id
+}
+
+func nodeIdentity() (*NodeIdentity, error) {
+	localIdentityMu.Lock()
+	defer localIdentityMu.Unlock()
+	if localIdentity == nil {
+		id, err := NewNodeIdentity()
+		if err != nil {
+			return nil, err
+		}
+		localIdentity = id
+	}
+	return localIdentity, nil
+}
+
+// AES-GCM key and nonce counter of one direction
+type noiseCipher struct {
+	aead  cipher.AEAD // nil before the first MixKey
+	nonce uint64
+}
+
+func (c *noiseCipher) setKey(k []byte) {
+	block, _ := aes.NewCipher(k)
+	c.aead, _ = cipher.NewGCM(block)
+	c.nonce = 0
+}
+
+// 4 zero bytes then the counter, big endian as the spec asks for AES-GCM
+func (c *noiseCipher) nextNonce() []byte {
+	nonce := binary.BigEndian.AppendUint64(make([]byte, 4), c.nonce)
+	c.nonce++
+	return nonce
+}
+
+func (c *noiseCipher) seal(ad, plaintext []byte) []byte {
+	if c.aead == nil {
+		return plaintext
+	}
+	return c.aead.Seal(nil, c.nextNonce(), plaintext, ad)
+}
+
+func (c *noiseCipher) open(ad, ciphertext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return ciphertext, nil
+	}
+	return c.aead.Open(nil, c.nextNonce(), ciphertext, ad)
+}
+
+// SymmetricState and HandshakeState of the spec, for one end of an XX handshake
+type noiseHandshake struct {
+	ck, h  []byte
+	cipher noiseCipher
+	s, e   *ecdh.PrivateKey
+	rs, re *ecdh.PublicKey
+}
+
+func newNoiseHandshake(s *ecdh.PrivateKey) *noiseHandshake {
+	// The protocol name fits in the 32 bytes of a hash, it is padded rather than hashed
+	h := make([]byte, sha256.Size)
+	copy(h, NOISE_PROTOCOL)
+	hs := &noiseHandshake{ck: h, h: h, s: s}
+	hs.mixHash([]byte(NOISE_PROLOGUE))
+	return hs
+}
+
+func (hs *noiseHandshake) mixHash(data []byte) {
+	sum := sha256.Sum256(append(append([]byte{}, hs.h...), data...))
+	hs.h = sum[:]
+}
+
+func (hs *noiseHandshake) mixKey(ikm []byte) {
+	var k []byte
+	hs.ck, k = noiseHKDF(hs.ck, ikm)
+	hs.cipher.setKey(k)
+}
+
+func (hs *noiseHandshake) dh(priv *ecdh.PrivateKey, pub *ecdh.PublicKey) error {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return err
+	}
+	hs.mixKey(shared)
+	return nil
+}
+
+func (hs *noiseHandshake) encryptAndHash(plaintext []byte) []byte {
+	c := hs.cipher.seal(hs.h, plaintext)
+	hs.mixHash(c)
+	return c
+}
+
+func (hs *noiseHandshake) decryptAndHash(c []byte) ([]byte, error) {
+	p, err := hs.cipher.open(hs.h, c)
+	if err != nil {
+		return nil, err
+	}
+	hs.mixHash(c)
+	return p, nil
+}
+
+// Cipher of each direction once the handshake is done, initiator to responder first
+func (hs *noiseHandshake) split() (noiseCipher, noiseCipher) {
+	k1, k2 := noiseHKDF(hs.ck, nil)
+	var c1, c2 noiseCipher
+	c1.setKey(k1)
+	c2.setKey(k2)
+	return c1, c2
+}
+
+// The two first outputs of HKDF with HMAC-SHA256
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	temp := hmacSHA256(ck, string(ikm))
+	out1 := hmacSHA256(temp, "\x01")
+	return out1, hmacSHA256(temp, string(out1)+"\x02")
+}
+
+/*
+ * Connection encrypted with Noise. The handshake runs on the first Read
+ * or Write, or on Handshake, as with crypto/tls
+ */
+type NoiseConn struct {
+	conn      net.Conn
+	initiator bool
+	id        *NodeIdentity
+	// Checks the static key of the peer, nil to accept any
+	authorize func(remoteKey []byte) error
+
+	handshakeOnce sync.Once
+	handshakeErr  error
+	remoteKey     []byte
+
+	readMu  sync.Mutex
+	in      noiseCipher
+	pending []byte // decrypted bytes not read yet
+
+	writeMu sync.Mutex
+	out     noiseCipher
+}
+
+/*
+ * Open a Noise connection to addr, failing unless the peer
+ * authenticates with remoteKey
+ */
+func DialNoise(ctx context.Context, addr string, id *NodeIdentity, remoteKey []byte) (*NoiseConn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &NoiseConn{conn: conn, initiator: true, id: id, authorize: func(key []byte) error {
+		if subtle.ConstantTimeCompare(key, remoteKey) != 1 {
+			return fmt.Errorf("%w: %v answered with key %x, expected %x", ErrNoiseHandshake, addr, key, remoteKey)
+		}
+		return nil
+	}}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := c.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Static key of the peer, nil before the handshake
+func (c *NoiseConn) RemoteKey() []byte {
+	return c.remoteKey
+}
+
+// Run the handshake unless done already
+func (c *NoiseConn) Handshake() error {
+	c.handshakeOnce.Do(func() {
+		c.handshakeErr = c.handshake()
+		if c.handshakeErr != nil && !errors.Is(c.handshakeErr, ErrNoiseHandshake) {
+			c.handshakeErr = fmt.Errorf("%w: %w", ErrNoiseHandshake, c.handshakeErr)
+		}
+	})
+	return c.handshakeErr
+}
+
+func (c *NoiseConn) handshake() error {
+	if !c.initiator {
+		// DialNoise bounds the handshake of initiators with its context
+		c.conn.SetDeadline(time.Now().Add(NOISE_HANDSHAKE_TIMEOUT))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	hs := newNoiseHandshake(c.id.key)
+	e, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	hs.e = e
+	if c.initiator {
+		// -> e
+		hs.mixHash(e.PublicKey().Bytes())
+		if err := c.writeFrame(append(e.PublicKey().Bytes(), hs.encryptAndHash(nil)...)); err != nil {
+			return err
+		}
+		// <- e, ee, s, es
+		msg, err := c.readHandshake(32 + 48 + 16)
+		if err != nil {
+			return err
+		}
+		if hs.re, err = ecdh.X25519().NewPublicKey(msg[:32]); err != nil {
+			return err
+		}
+		hs.mixHash(msg[:32])
+		if err := hs.dh(hs.e, hs.re); err != nil {
+			return err
+		}
+		if err := c.readStatic(hs, msg[32:80]); err != nil {
+			return err
+		}
+		if err := hs.dh(hs.e, hs.rs); err != nil {
+			return err
+		}
+		if _, err := hs.decryptAndHash(msg[80:]); err != nil {
+			return err
+		}
+		// -> s, se
+		msg = hs.encryptAndHash(c.id.PublicKey())
+		if err := hs.dh(hs.s, hs.re); err != nil {
+			return err
+		}
+		if err := c.writeFrame(append(msg, hs.encryptAndHash(nil)...)); err != nil {
+			return err
+		}
+		c.out, c.in = hs.split()
+		return nil
+	}
+
+	// -> e
+	msg, err := c.readHandshake(32)
+	if err != nil {
+		return err
+	}
+	if hs.re, err = ecdh.X25519().NewPublicKey(msg); err != nil {
+		return err
+	}
+	hs.mixHash(msg)
+	if _, err := hs.decryptAndHash(nil); err != nil {
+		return err
+	}
+	// <- e, ee, s, es
+	msg = e.PublicKey().Bytes()
+	hs.mixHash(msg)
+	if err := hs.dh(hs.e, hs.re); err != nil {
+		return err
+	}
+	msg = append(msg, hs.encryptAndHash(c.id.PublicKey())...)
+	if err := hs.dh(hs.s, hs.re); err != nil {
+		return err
+	}
+	if err := c.writeFrame(append(msg, hs.encryptAndHash(nil)...)); err != nil {
+		return err
+	}
+	// -> s, se
+	if msg, err = c.readHandshake(48 + 16); err != nil {
+		return err
+	}
+	if err := c.readStatic(hs, msg[:48]); err != nil {
+		return err
+	}
+	if err := hs.dh(hs.e, hs.rs); err != nil {
+		return err
+	}
+	if _, err := hs.decryptAndHash(msg[48:]); err != nil {
+		return err
+	}
+	c.in, c.out = hs.split()
+	return nil
+}
+
+// Decrypt the static key of the peer and check it is one we talk to
+func (c *NoiseConn) readStatic(hs *noiseHandshake, encrypted []byte) error {
+	raw, err := hs.decryptAndHash(encrypted)
+	if err != nil {
+		return err
+	}
+	if hs.rs, err = ecdh.X25519().NewPublicKey(raw); err != nil {
+		return err
+	}
+	if c.authorize != nil {
+		if err := c.authorize(raw); err != nil {
+			return err
+		}
+	}
+	c.remoteKey = raw
+	return nil
+}
+
+func (c *NoiseConn) writeFrame(msg []byte) error {
+	frame := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	_, err := c.conn.Write(append(frame, msg...))
+	return err
+}
+
+/*
+ * Read a handshake message, all of a known size without payloads. A peer
+ * sending anything else, eg. a plaintext HTTP request, is dropped right away
+ */
+func (c *NoiseConn) readHandshake(size int) ([]byte, error) {
+	var prefix [2]byte
+	if _, err := io.ReadFull(c.conn, prefix[:]); err != nil {
+		return nil, err
+	}
+	if n := int(binary.BigEndian.Uint16(prefix[:])); n != size {
+		return nil, fmt.Errorf("%w: handshake message of %v bytes, expected %v, not a Noise peer", ErrNoiseHandshake, n, size)
+	}
+	msg := make([]byte, size)
+	_, err := io.ReadFull(c.conn, msg)
+	return msg, err
+}
+
+func (c *NoiseConn) readFrame() ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(c.conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (c *NoiseConn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for len(c.pending) == 0 {
+		msg, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		if c.pending, err = c.in.open(nil, msg); err != nil {
+			return 0, fmt.Errorf("noise: %w", err)
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *NoiseConn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(len(b), written+NOISE_MAX_MESSAGE-16)]
+		if err := c.writeFrame(c.out.seal(nil, chunk)); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+func (c *NoiseConn) Close() error                       { return c.conn.Close() }
+func (c *NoiseConn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *NoiseConn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *NoiseConn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *NoiseConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *NoiseConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+// Listener whose connections run the responder side of the handshake
+type noiseListener struct {
+	net.Listener
+	id        *NodeIdentity
+	authorize func(remoteKey []byte) error
+}
+
+/*
+ * Accept Noise connections on inner as id, from the peers whose static
+ * key authorize accepts, any peer if nil
+ */
+func NewNoiseListener(inner net.Listener, id *NodeIdentity, authorize func(remoteKey []byte) error) net.Listener {
+	return &noiseListener{Listener: inner, id: id, authorize: authorize}
+}
+
+func (l *noiseListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	// The handshake runs in the goroutine serving the connection, a slow peer blocks no other
+	return &NoiseConn{conn: conn, id: l.id, authorize: l.authorize}, nil
+}
+
+type noiseConnKey struct{}
+
+// Static key of the peer a request came from over Noise, nil over plaintext
+func noisePeerKey(ctx context.Context) []byte {
+	if c, ok := ctx.Value(noiseConnKey{}).(*NoiseConn); ok {
+		return c.RemoteKey()
+	}
+	return nil
+}
+
+/*
+ * Serve s on addr over Noise as id, to the peers whose key is in allowed,
+ * any peer if allowed is empty
+ */
+func ListenAndServeNoise(addr string, s *Server, id *NodeIdentity, allowed [][]byte) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	var authorize func([]byte) error
+	if len(allowed) > 0 {
+		authorize = func(key []byte) error {
+			for _, a := range allowed {
+				if subtle.ConstantTimeCompare(key, a) == 1 {
+					return nil
+				}
+			}
+			return fmt.Errorf("%w: peer key %x not allowed", ErrNoiseHandshake, key)
+		}
+	}
+	srv := &http.Server{
+		Handler:   s,
+		Protocols: new(http.Protocols),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, noiseConnKey{}, c)
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	return srv.Serve(NewNoiseListener(ln, id, authorize))
+}
+
+/*
+ * RoundTripper for noise:// URLs: requests go over HTTP on a Noise
+ * connection pinned to the key of the URL, one pool of connections per key
+ */
+type noiseTransport struct {
+	h2c        bool // unencrypted HTTP/2 inside Noise, for gRPC
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func (t *noiseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.User == nil {
+		return nil, fmt.Errorf("noise://%v lacks the KEY@ of the peer", req.URL.Host)
+	}
+	key, err := hex.DecodeString(req.URL.User.Username())
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("noise://%v: peer key is not 32 bytes of hex", req.URL.Host)
+	}
+	id, err := nodeIdentity()
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	transport, ok := t.transports[string(key)]
+	if !ok {
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				ctx, cancel := context.WithTimeout(ctx, NOISE_HANDSHAKE_TIMEOUT)
+				defer cancel()
+				return DialNoise(ctx, addr, id, key)
+			},
+			Protocols: new(http.Protocols),
+		}
+		if t.h2c {
+			transport.Protocols.SetUnencryptedHTTP2(true)
+		} else {
+			transport.Protocols.SetHTTP1(true)
+		}
+		if t.transports == nil {
+			t.transports = map[string]*http.Transport{}
+		}
+		t.transports[string(key)] = transport
+	}
+	t.mu.Unlock()
+
+	// The key is no password, drop the basic auth http.Client derives from it
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.User = "http", nil
+	req.Header.Del("Authorization")
+	return transport.RoundTrip(req)
+}
+
+func init() {
+	http.DefaultTransport.(*http.Transport).RegisterProtocol("noise", &noiseTransport{})
+}
@@ -0,0 +1,155 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func newTestIdentity(t *testing.T) *NodeIdentity {
+	t.Helper()
+	id, err := NewNodeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// Accept only the static key of id
+func onlyKey(id *NodeIdentity) func([]byte) error {
+	return func(key []byte) error {
+		if !bytes.Equal(key, id.PublicKey()) {
+			return fmt.Errorf("%w: unexpected key %x", ErrNoiseHandshake, key)
+		}
+		return nil
+	}
+}
+
+// Run the handshake of an initiator on a and a responder on b, returning both ends and their errors
+func noisePair(a, b net.Conn, initiator, responder *NodeIdentity, authorizeResponder, authorizeInitiator func([]byte) error) (*NoiseConn, *NoiseConn, error, error) {
+	i := &NoiseConn{conn: a, initiator: true, id: initiator, authorize: authorizeResponder}
+	r := &NoiseConn{conn: b, id: responder, authorize: authorizeInitiator}
+	done := make(chan error)
+	go func() {
+		err := r.Handshake()
+		if err != nil {
+			b.Close()
+		}
+		done <- err
+	}()
+	err := i.Handshake()
+	if err != nil {
+		a.Close()
+	}
+	return i, r, err, <-done
+}
+
+// Conn flipping the byte at offset at of what it writes
+type tamperConn struct {
+	net.Conn
+	at, written int
+}
+
+func (c *tamperConn) Write(b []byte) (int, error) {
+	if c.at >= c.written && c.at < c.written+len(b) {
+		b = bytes.Clone(b)
+		b[c.at-c.written] ^= 1
+	}
+	c.written += len(b)
+	return c.Conn.Write(b)
+}
+
+func TestNoiseHandshake(t *testing.T) {
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+	a, b := net.Pipe()
+	i, r, err, rerr := noisePair(a, b, alice, bob, onlyKey(bob), onlyKey(alice))
+	if err != nil || rerr != nil {
+		t.Fatalf("handshake: %v, %v", err, rerr)
+	}
+	defer i.Close()
+	if !bytes.Equal(i.RemoteKey(), bob.PublicKey()) || !bytes.Equal(r.RemoteKey(), alice.PublicKey()) {
+		t.Fatal("ends do not know the key of each other")
+	}
+	// Larger than a transport message, to cross frames
+	msg := bytes.Repeat([]byte("toychain"), NOISE_MAX_MESSAGE/4)
+	go func() {
+		i.Write(msg)
+	}()
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("read %v bytes, %v", len(got), err)
+	}
+}
+
+func TestNoiseRefusesUnexpectedKey(t *testing.T) {
+	alice, bob, mallory := newTestIdentity(t), newTestIdentity(t), newTestIdentity(t)
+	a, b := net.Pipe()
+	// Mallory answers in the place of bob
+	if _, _, err, _ := noisePair(a, b, alice, mallory, onlyKey(bob), nil); !errors.Is(err, ErrNoiseHandshake) {
+		t.Errorf("initiator got %v, expected %v", err, ErrNoiseHandshake)
+	}
+	a, b = net.Pipe()
+	// Bob only talks to alice
+	if _, _, _, err := noisePair(a, b, mallory, bob, nil, onlyKey(alice)); !errors.Is(err, ErrNoiseHandshake) {
+		t.Errorf("responder got %v, expected %v", err, ErrNoiseHandshake)
+	}
+}
+
+func TestNoiseRefusesTampering(t *testing.T) {
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+	// Bytes of -> e, 2+32 framed, and of -> s, se, 2+48+16 framed
+	for _, at := range []int{0, 2, 20, 33, 34, 36, 60, 84, 99} {
+		a, b := net.Pipe()
+		_, _, err, rerr := noisePair(&tamperConn{Conn: a, at: at}, b, alice, bob, nil, nil)
+		if err == nil && rerr == nil {
+			t.Errorf("byte %v flipped, handshake succeeded", at)
+		}
+	}
+}
+
+func TestNoiseRefusesPlaintext(t *testing.T) {
+	a, b := net.Pipe()
+	r := &NoiseConn{conn: b, id: newTestIdentity(t)}
+	go func() {
+		io.WriteString(a, "GET /blocks HTTP/1.1\r\nHost: node\r\n\r\n")
+		io.Copy(io.Discard, a)
+	}()
+	if err := r.Handshake(); !errors.Is(err, ErrNoiseHandshake) {
+		t.Fatalf("plaintext request got %v, expected %v", err, ErrNoiseHandshake)
+	}
+	b.Close()
+}
+
+// A node syncs the chain of a peer served over Noise at its noise:// URL, pinned to its key
+func TestSyncOverNoise(t *testing.T) {
+	tc := NewTestChain(1, TestGenesis(4))
+	if err := tc.Extend(3); err != nil {
+		t.Fatal(err)
+	}
+	server := newTestIdentity(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: NewServer(NewNode(tc.Chain()))}
+	go srv.Serve(NewNoiseListener(ln, server, nil))
+	defer srv.Close()
+
+	SetNodeIdentity(newTestIdentity(t))
+	bc := CreateBlockChain(tc.Genesis())
+	wrongKey := fmt.Sprintf("noise://%v@%v", newTestIdentity(t), ln.Addr())
+	if report, err := bc.Sync([]string{wrongKey}); err == nil && report.Blocks > 0 {
+		t.Fatalf("synced %v blocks from a peer with another key", report.Blocks)
+	}
+	report, err := bc.Sync([]string{fmt.Sprintf("noise://%v@%v", server, ln.Addr())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Blocks != 3 || bc.lastBlock().hash != tc.Chain().lastBlock().hash {
+		t.Fatalf("synced %v blocks to %v, expected 3 to %v", report.Blocks, bc.lastBlock().hash, tc.Chain().lastBlock().hash)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Price oracle used to annotate coin amounts with a fiat-equivalent value
+ * at the timestamp of the Block they were committed in.
+ * Prices come from a pluggable PriceSource, are cached per currency and
+ * time bucket, and calls to the source are rate limited so a slow or
+ * metered price feed is not hammered while rendering a whole chain. The
+ * cache keeps the last PRICE_CACHE_SIZE prices fetched.
+ *
+ * Amounts carry fiat values only when the operator names prices, eg.
+ * -fiat-prices USD=2.5,EUR=2.3; the coin of a toy chain has no price of
+ * its own.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default granularity of cached prices
+const PRICE_CACHE_BUCKET = time.Minute
+
+// Default max number of calls to the PriceSource per second
+const PRICE_RATE_LIMIT = 10
+
+// Prices cached at most, the first fetched dropped first
+const PRICE_CACHE_SIZE = 4096
+
+var errPriceRateLimited = errors.New("price source rate limited")
+
+// Source of fiat prices for one unit of the chain's coin
+type PriceSource interface {
+	// Price in the given fiat currency at unixTs (unix microseconds)
+	Price(currency string, unixTs int64) (float64, error)
+}
+
+// PriceSource returning the same price regardless of time, handy for demos
+type FixedPriceSource map[string]float64
+
+func (s FixedPriceSource) Price(currency string, unixTs int64) (float64, error) {
+	price, ok := s[strings.ToUpper(currency)]
+	if !ok {
+		return 0, fmt.Errorf("no price for currency %q", currency)
+	}
+	return price, nil
+}
+
+/*
+ * Fixed prices of -fiat-prices, comma separated currency=price, eg.
+ * USD=2.5,EUR=2.3, and their currencies in order
+ */
+func ParseFixedPrices(spec string) (FixedPriceSource, []string, error) {
+	prices, currencies := FixedPriceSource{}, []string{}
+	for _, field := range splitList(spec) {
+		currency, value, _ := strings.Cut(field, "=")
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		price, err := strconv.ParseFloat(value, 64)
+		if currency == "" || err != nil || price <= 0 || math.IsInf(price, 0) {
+			return nil, nil, fmt.Errorf("price %q is not a currency and a positive price, eg. USD=2.5", field)
+		}
+		if _, ok := prices[currency]; ok {
+			return nil, nil, fmt.Errorf("price of %v given twice", currency)
+		}
+		prices[currency] = price
+		currencies = append(currencies, currency)
+	}
+	return prices, currencies, nil
+}
+
+type priceKey struct {
+	currency string
+	bucket   int64
+}
+
+type PriceOracle struct {
+	source     PriceSource
+	currencies []string      // fiat currencies to annotate amounts with
+	bucket     time.Duration // granularity of cached prices
+	limit      int           // max calls to the source per second
+	mu         sync.Mutex
+	cache      map[priceKey]float64
+	cached     []priceKey // keys of cache, first fetched first
+	window     time.Time  // start of the current rate limit window
+	calls      int        // calls to the source in the current window
+}
+
+func NewPriceOracle(source PriceSource, currencies ...string) *PriceOracle {
+	return &PriceOracle{
+		source:     source,
+		currencies: currencies,
+		bucket:     PRICE_CACHE_BUCKET,
+		limit:      PRICE_RATE_LIMIT,
+		cache:      make(map[priceKey]float64),
+	}
+}
+
+/*
+ * Price of one coin in currency at unixTs.
+ * Cache misses hit the PriceSource at most limit times per second,
+ * beyond that errPriceRateLimited is returned and the caller should render
+ * the amount without a fiat value.
+ */
+func (o *PriceOracle) Price(currency string, unixTs int64) (float64, error) {
+	key := priceKey{
+		currency: strings.ToUpper(currency),
+		bucket:   unixTs / o.bucket.Microseconds(),
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if price, ok := o.cache[key]; ok {
+		return price, nil
+	}
+	if time.Since(o.window) >= time.Second {
+		o.window = time.Now()
+		o.calls = 0
+	}
+	if o.calls >= o.limit {
+		return 0, errPriceRateLimited
+	}
+	o.calls++
+	price, err := o.source.Price(key.currency, key.bucket*o.bucket.Microseconds())
+	if err != nil {
+		return 0, err
+	}
+	o.cache[key] = price
+	o.cached = append(o.cached, key)
+	if len(o.cached) > PRICE_CACHE_SIZE {
+		delete(o.cache, o.cached[0])
+		o.cached = o.cached[1:]
+	}
+	return price, nil
+}
+
+// Fiat-equivalent values of amt at unixTs, keyed by currency
+func (o *PriceOracle) Annotate(amt Amount, unixTs int64) map[string]float64 {
+	values := make(map[string]float64, len(o.currencies))
+	for _, currency := range o.currencies {
+		price, err := o.Price(currency, unixTs)
+		if err != nil {
+			continue
+		}
+		values[strings.ToUpper(currency)] = amt.Coins() * price
+	}
+	return values
+}
+
+// Human readable fiat annotation, eg. "(~ 25.00 USD, 23.10 EUR)"
+func (o *PriceOracle) annotation(amt Amount, unixTs int64) string {
+	values := o.Annotate(amt, unixTs)
+	parts := []string{}
+	for _, currency := range o.currencies {
+		if value, ok := values[strings.ToUpper(currency)]; ok {
+			parts = append(parts, fmt.Sprintf("%.2f %s", value, strings.ToUpper(currency)))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (~ " + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,54 @@
+package chain
+
+import (
+	"testing"
+	"time"
+)
+
+// PriceSource counting its calls
+type countingSource struct {
+	calls int
+}
+
+func (s *countingSource) Price(currency string, unixTs int64) (float64, error) {
+	s.calls++
+	return float64(unixTs), nil
+}
+
+func TestPriceOracleCacheBounded(t *testing.T) {
+	source := &countingSource{}
+	o := NewPriceOracle(source, "USD")
+	o.limit = 2 * PRICE_CACHE_SIZE
+	bucket := PRICE_CACHE_BUCKET.Microseconds()
+	for i := range PRICE_CACHE_SIZE + 10 {
+		if _, err := o.Price("usd", int64(i)*bucket); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(o.cache) != PRICE_CACHE_SIZE || len(o.cached) != PRICE_CACHE_SIZE {
+		t.Fatalf("%v prices cached, expected %v", len(o.cache), PRICE_CACHE_SIZE)
+	}
+	// The last bucket is cached, the first dropped
+	calls := source.calls
+	o.window = time.Now()
+	o.Price("USD", int64(PRICE_CACHE_SIZE+9)*bucket)
+	if source.calls != calls {
+		t.Error("last price fetched again")
+	}
+	o.Price("USD", 0)
+	if source.calls != calls+1 {
+		t.Error("first price still cached")
+	}
+}
+
+func TestParseFixedPrices(t *testing.T) {
+	prices, currencies, err := ParseFixedPrices("usd=2.5,EUR=2.3")
+	if err != nil || prices["USD"] != 2.5 || prices["EUR"] != 2.3 || len(currencies) != 2 || currencies[0] != "USD" {
+		t.Fatalf("got %v %v %v", prices, currencies, err)
+	}
+	for _, spec := range []string{"USD", "USD=0", "USD=-1", "=2", "USD=x", "USD=1,usd=2"} {
+		if _, _, err := ParseFixedPrices(spec); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Orphaned Blocks.
+ * A Block valid when appended but dropped by a reorganization, see
+ * reorg.go, lost a fork race: another miner found a Block at the same
+ * height and the branch built on it carries more work. The chain keeps
+ * the last MAX_ORPHANS of them, with the Block that replaced each, and
+ * counts every one in its stats. Nodes mining side by side and syncing
+ * with each other, see sync.go and hashlimit.go, orphan Blocks whenever
+ * two of them find one at the same height.
+ *
+ *	GET /orphans  orphaned Blocks, latest first
+ */
+package chain
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Orphaned Blocks kept, older ones are only counted
+const MAX_ORPHANS = 1000
+
+type OrphanBlock struct {
+	Height     int    `json:"height"`
+	Hash       string `json:"hash"`
+	Miner      string `json:"miner,omitempty"`
+	UnixTs     int64  `json:"unixTs"`
+	Txns       int    `json:"txns"`
+	ReplacedBy string `json:"replacedBy,omitempty"` // hash of the Block of the branch at the same height, if any
+}
+
+// Record the Blocks dropped by a Reorg at fork in favour of branch
+func (bc *BlockChain) orphan(fork int, dropped, branch []Block) {
+	for i, b := range dropped {
+		orphan := OrphanBlock{fork + 1 + i, b.hash, b.miner, b.unixTs, len(b.data), ""}
+		if i < len(branch) {
+			orphan.ReplacedBy = branch[i].hash
+		}
+		bc.orphans = append(bc.orphans, orphan)
+	}
+	bc.orphaned += len(dropped)
+	if len(bc.orphans) > MAX_ORPHANS {
+		bc.orphans = slices.Clone(bc.orphans[len(bc.orphans)-MAX_ORPHANS:])
+	}
+}
+
+// Last MAX_ORPHANS Blocks that lost a fork race, latest first
+func (bc *BlockChain) OrphanBlocks() []OrphanBlock {
+	orphans := append([]OrphanBlock{}, bc.orphans...)
+	slices.Reverse(orphans)
+	return orphans
+}
+
+func (s *Server) handleOrphans(w http.ResponseWriter, r *http.Request) {
+	var orphans []OrphanBlock
+	s.node.withChain(func(bc *BlockChain) { orphans = bc.OrphanBlocks() })
+	writeJSON(w, http.StatusOK, orphans)
+}
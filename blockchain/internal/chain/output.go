@@ -0,0 +1,123 @@
+/*
+ * Output of the CLI commands.
+ * Every command prints its results through an Output, in the mode picked
+ * with -output:
+ *
+ *	table  aligned columns for humans, the default
+ *	json   one JSON document on stdout, for scripts
+ *	csv    comma separated values, the header first, for spreadsheets
+ *	quiet  the key column only, one value per line, eg. the addresses of -derive
+ *
+ * Logs and errors go to stderr in every mode, and the exit code tells
+ * success from failure, so scripts never need to parse the tables.
+ */
+package chain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type OutputMode int
+
+const (
+	OutputTable OutputMode = iota
+	OutputJSON
+	OutputQuiet
+	OutputCSV
+)
+
+func ParseOutputMode(name string) (OutputMode, error) {
+	switch name {
+	case "table":
+		return OutputTable, nil
+	case "json":
+		return OutputJSON, nil
+	case "quiet":
+		return OutputQuiet, nil
+	case "csv":
+		return OutputCSV, nil
+	}
+	return 0, fmt.Errorf("unknown output mode %q, want json, table, csv or quiet", name)
+}
+
+type Output struct {
+	mode OutputMode
+	w    io.Writer
+}
+
+func NewOutput(mode OutputMode, w io.Writer) *Output {
+	return &Output{mode: mode, w: w}
+}
+
+/*
+ * Print rows under header as a table or CSV, the first column of each row
+ * in quiet mode, or v as JSON, v holding the same data as the rows
+ */
+func (o *Output) Table(header []string, rows [][]string, v any) error {
+	switch o.mode {
+	case OutputJSON:
+		return writeIndentedJSON(o.w, v)
+	case OutputCSV:
+		cw := csv.NewWriter(o.w)
+		if len(header) > 0 {
+			cw.Write(header)
+		}
+		cw.WriteAll(rows)
+		return cw.Error()
+	case OutputQuiet:
+		ew := &errWriter{w: o.w}
+		for _, row := range rows {
+			ew.printf("%v\n", row[0])
+		}
+		return ew.err
+	}
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	ew := &errWriter{w: tw}
+	if len(header) > 0 {
+		ew.printf("%v\n", strings.ToUpper(strings.Join(header, "\t")))
+	}
+	for _, row := range rows {
+		ew.printf("%v\n", strings.Join(row, "\t"))
+	}
+	if ew.err != nil {
+		return ew.err
+	}
+	return tw.Flush()
+}
+
+/*
+ * Print a single record as field: value lines, field,value ones in CSV,
+ * its key field alone in quiet mode, or v as JSON
+ */
+func (o *Output) Record(fields [][2]string, v any) error {
+	if o.mode == OutputCSV {
+		rows := make([][]string, len(fields))
+		for i, f := range fields {
+			rows[i] = f[:]
+		}
+		return o.Table([]string{"field", "value"}, rows, v)
+	}
+	if o.mode != OutputTable {
+		rows := make([][]string, 0, 1)
+		if len(fields) > 0 {
+			rows = append(rows, []string{fields[0][1]})
+		}
+		return o.Table(nil, rows, v)
+	}
+	rows := make([][]string, len(fields))
+	for i, f := range fields {
+		rows[i] = []string{f[0] + ":", f[1]}
+	}
+	return o.Table(nil, rows, v)
+}
+
+// Print a line for humans, nothing in the json and quiet modes
+func (o *Output) Note(format string, args ...any) {
+	if o.mode == OutputTable {
+		fmt.Fprintf(o.w, format+"\n", args...)
+	}
+}
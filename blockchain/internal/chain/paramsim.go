@@ -0,0 +1,382 @@
+/*
+ * Consensus parameter experiments.
+ * What would the chain look like with Blocks twice as often, smaller
+ * Blocks, LWMA retargets or a block reward? SimulateParams runs a workload
+ * under alternative ConsensusParams and reports the metrics of each side
+ * by side, the parameters of the chain first for reference.
+ *
+ * The workload is either the recent history of the chain, the
+ * transactions of its last Blocks arriving when the Block committing them
+ * was mined and the hash rate the one that mined them (see stats.go), or a
+ * synthetic one: transactions arriving at random at a steady rate, their
+ * fees drawn around a mean. Blocks are mined like in retargetsim.go, each
+ * taking a random time of mean the work of its difficulty over the hash
+ * rate, and take the pending transactions paying the most first. Every
+ * parameter set sees the same arrivals and draws, so their differences
+ * come from the parameters alone.
+ *
+ * A difficulty being a number of leading hex 0s, a fixed difficulty only
+ * gets within a factor 4 of the block time asked for; a retarget holds it
+ * on average. The stale rate is the chance another miner finds a Block
+ * while one travels the network for the propagation delay. Reward shows
+ * what a block reward costs in issuance and brings to miners, the chain's
+ * own being the reward of its next Block, see issuance.go, as if it never
+ * halved.
+ *
+ *	POST /sim/params  simulate a ParamSimRequest, with the admin token,
+ *	                  see admin.go; the explorer has a dashboard
+ *	                  comparing the results
+ */
+package chain
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// Most parameter sets simulated at once, besides the chain's
+const MAX_PARAM_SIMS = 8
+
+// Most transactions of a synthetic workload
+const MAX_PARAM_SIM_TXNS = 100_000
+
+// Most Blocks a simulation mines
+const MAX_PARAM_SIM_BLOCKS = 100_000
+
+type ConsensusParams struct {
+	Name       string  `json:"name"`
+	BlockTime  int64   `json:"blockTime"`            // target seconds between Blocks
+	Difficulty int     `json:"difficulty,omitempty"` // fixed or starting difficulty, 0 for the one closest to BlockTime
+	Retarget   string  `json:"retarget,omitempty"`   // RETARGET_WINDOW, RETARGET_LWMA, or empty for a fixed difficulty
+	Window     int     `json:"window,omitempty"`     // Blocks averaged by the retarget
+	BlockTxns  int     `json:"blockTxns,omitempty"`  // transactions per Block, 0 for no cap
+	Reward     float64 `json:"reward,omitempty"`     // coins minted to the miner of each Block
+}
+
+func (p ConsensusParams) check() error {
+	if p.BlockTime <= 0 && (p.Difficulty == 0 || p.Retarget != "") {
+		return fmt.Errorf("%v: block time %v is not positive", p.Name, p.BlockTime)
+	}
+	if p.Difficulty < 0 || p.Difficulty > MAX_RETARGET_DIFFICULTY {
+		return fmt.Errorf("%v: difficulty %v outside 0..%v", p.Name, p.Difficulty, MAX_RETARGET_DIFFICULTY)
+	}
+	if p.BlockTxns < 0 || p.Reward < 0 {
+		return fmt.Errorf("%v: negative block transactions or reward", p.Name)
+	}
+	if p.Retarget != "" {
+		if err := p.retarget().check(); err != nil {
+			return fmt.Errorf("%v: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p ConsensusParams) retarget() RetargetSpec {
+	return RetargetSpec{Algorithm: p.Retarget, Interval: p.BlockTime, Window: p.Window}
+}
+
+// Parameters of the chain, its block time the recent one unless it retargets
+func (bc *BlockChain) ConsensusParams() ConsensusParams {
+	p := ConsensusParams{
+		Name:       "chain",
+		Difficulty: bc.difficulty,
+		BlockTxns:  bc.blockLimits().Txns,
+		Reward:     bc.state.issuanceAt(bc.blocks.Len()).reward(bc.blocks.Len(), bc.state.supply).Coins(),
+	}
+	if r := bc.genesis.Retarget; r != nil {
+		p.BlockTime, p.Retarget, p.Window = r.Interval, r.Algorithm, r.Window
+	} else {
+		p.BlockTime = int64(math.Round(bc.Stats().BlockInterval))
+	}
+	return p
+}
+
+type ParamSimWorkload struct {
+	Blocks   int     `json:"blocks,omitempty"`   // last Blocks of the chain replayed, 0 for a synthetic workload
+	Duration float64 `json:"duration,omitempty"` // seconds of synthetic workload
+	TxnRate  float64 `json:"txnRate,omitempty"`  // synthetic transactions per second
+	MeanFee  float64 `json:"meanFee,omitempty"`  // of the synthetic transactions, exponentially distributed
+	HashRate float64 `json:"hashRate,omitempty"` // hashes per second of a synthetic workload
+	Delay    float64 `json:"delay"`              // seconds for a Block to reach the other miners
+	Seed     uint64  `json:"seed"`
+}
+
+type ParamSimRequest struct {
+	Workload ParamSimWorkload  `json:"workload"`
+	Params   []ConsensusParams `json:"params"`
+}
+
+// Synthetic workload of an hour at a transaction every 10s
+func DefaultParamSimRequest() ParamSimRequest {
+	return ParamSimRequest{Workload: ParamSimWorkload{Duration: 3600, TxnRate: 0.1, MeanFee: 1, HashRate: 16 * 16 * 16 / 60.0, Delay: 2, Seed: 1}}
+}
+
+type ParamSimResult struct {
+	Params         ConsensusParams `json:"params"`
+	Blocks         int             `json:"blocks"`
+	MeanInterval   float64         `json:"meanInterval"` // seconds
+	StdDev         float64         `json:"stdDev"`       // of the intervals, in seconds
+	MeanDifficulty float64         `json:"meanDifficulty"`
+	Confirmation   float64         `json:"confirmation"`   // mean seconds from arrival to the Block
+	Confirmation95 float64         `json:"confirmation95"` // 95th percentile of those
+	Throughput     float64         `json:"throughput"`     // transactions committed per second
+	Backlog        int             `json:"backlog"`        // transactions still pending at the end
+	StaleRate      float64         `json:"staleRate"`      // share of Blocks expected to be orphaned
+	MinerRevenue   float64         `json:"minerRevenue"`   // fees and reward per Block
+	Issuance       float64         `json:"issuance"`       // coins minted as rewards
+}
+
+// Transaction of a workload, arriving some seconds after it starts
+type simTxn struct {
+	arrival float64
+	fee     float64
+}
+
+/*
+ * Transactions, hash rate and duration of w, from the last Blocks of bc
+ * unless w is synthetic
+ */
+func (bc *BlockChain) paramSimWorkload(w ParamSimWorkload) ([]simTxn, float64, float64, error) {
+	if w.Blocks == 0 {
+		if w.Duration <= 0 || w.TxnRate < 0 || w.HashRate <= 0 || w.MeanFee < 0 {
+			return nil, 0, 0, fmt.Errorf("synthetic workload needs a positive duration and hash rate")
+		}
+		if w.TxnRate*w.Duration > MAX_PARAM_SIM_TXNS {
+			return nil, 0, 0, fmt.Errorf("synthetic workload of more than %v transactions", MAX_PARAM_SIM_TXNS)
+		}
+		rng := rand.New(rand.NewPCG(w.Seed, 1))
+		txns := []simTxn{}
+		for t := rng.ExpFloat64() / w.TxnRate; t < w.Duration; t += rng.ExpFloat64() / w.TxnRate {
+			txns = append(txns, simTxn{t, rng.ExpFloat64() * w.MeanFee})
+		}
+		return txns, w.HashRate, w.Duration, nil
+	}
+
+	tip := bc.blocks.Len() - 1
+	first := max(tip-w.Blocks, bc.pruned-1, 1) // genesis left out, its timestamp set by hand
+	start := bc.blockAt(first).unixTs
+	duration := float64(bc.lastBlock().unixTs-start) / 1e6
+	if tip-first < 2 || duration <= 0 {
+		return nil, 0, 0, fmt.Errorf("not enough recent blocks to replay")
+	}
+	txns, work := []simTxn{}, 0.0
+	for height := first + 1; height <= tip; height++ {
+		b := bc.blockAt(height)
+		work += math.Pow(16, float64(b.difficulty))
+		for _, txn := range b.data {
+			if txn.kind != TxnMint {
+				txns = append(txns, simTxn{float64(b.unixTs-start) / 1e6, txn.feeValue(bc.mempool.rates).Coins()})
+			}
+		}
+	}
+	return txns, work / duration, duration, nil
+}
+
+// Difficulty whose work at hashRate is closest to seconds, in log scale
+func difficultyFor(hashRate, seconds float64) int {
+	d := int(math.Round(math.Log(hashRate*seconds) / math.Log(16)))
+	return min(max(d, MIN_RETARGET_DIFFICULTY), MAX_RETARGET_DIFFICULTY)
+}
+
+// Mine the workload txns of duration seconds at hashRate under p
+func simulateParams(p ConsensusParams, txns []simTxn, hashRate, duration float64, w ParamSimWorkload) ParamSimResult {
+	rng := rand.New(rand.NewPCG(w.Seed, 0))
+	result := ParamSimResult{Params: p}
+	difficulty := p.Difficulty
+	if difficulty == 0 {
+		difficulty = difficultyFor(hashRate, float64(p.BlockTime))
+	}
+	headers := []Header{{difficulty: difficulty}}
+	pending, next := []simTxn{}, 0
+	confirmations := []float64{}
+	now, sumSquares, difficulties, fees := 0.0, 0.0, 0, 0.0
+	for result.Blocks < MAX_PARAM_SIM_BLOCKS {
+		if p.Retarget != "" && len(headers) > 1 {
+			difficulty = p.retarget().next(headers)
+		}
+		interval := rng.ExpFloat64() * math.Pow(16, float64(difficulty)) / hashRate
+		if now+interval > duration {
+			break
+		}
+		now += interval
+		result.Blocks++
+		sumSquares += interval * interval
+		difficulties += difficulty
+		headers = append(headers, Header{unixTs: int64(now * 1e6), difficulty: difficulty})
+		if len(headers) > p.Window+1 {
+			headers = headers[1:]
+		}
+
+		for ; next < len(txns) && txns[next].arrival <= now; next++ {
+			pending = append(pending, txns[next])
+		}
+		slices.SortStableFunc(pending, func(a, b simTxn) int { return cmp.Compare(b.fee, a.fee) })
+		taken := len(pending)
+		if p.BlockTxns > 0 {
+			taken = min(taken, p.BlockTxns)
+		}
+		for _, txn := range pending[:taken] {
+			confirmations = append(confirmations, now-txn.arrival)
+			fees += txn.fee
+		}
+		pending = pending[taken:]
+	}
+	result.Backlog = len(pending) + len(txns) - next
+	if result.Blocks == 0 {
+		return result
+	}
+	blocks := float64(result.Blocks)
+	result.MeanInterval = now / blocks
+	result.StdDev = math.Sqrt(max(sumSquares/blocks-result.MeanInterval*result.MeanInterval, 0))
+	result.MeanDifficulty = float64(difficulties) / blocks
+	result.Throughput = float64(len(confirmations)) / duration
+	result.StaleRate = 1 - math.Exp(-w.Delay/result.MeanInterval)
+	result.Issuance = p.Reward * blocks
+	result.MinerRevenue = (fees + result.Issuance) / blocks
+	if len(confirmations) > 0 {
+		sum := 0.0
+		for _, c := range confirmations {
+			sum += c
+		}
+		result.Confirmation = sum / float64(len(confirmations))
+		slices.Sort(confirmations)
+		result.Confirmation95 = percentile(confirmations, 95)
+	}
+	return result
+}
+
+// Workload and parameter sets of a ParamSimRequest, ready to run
+type paramSim struct {
+	params   []ConsensusParams
+	txns     []simTxn
+	hashRate float64
+	duration float64
+	workload ParamSimWorkload
+}
+
+// Check req and collect its workload, the chain's parameters coming first
+func (bc *BlockChain) newParamSim(req ParamSimRequest) (*paramSim, error) {
+	if len(req.Params) > MAX_PARAM_SIMS {
+		return nil, fmt.Errorf("more than %v parameter sets", MAX_PARAM_SIMS)
+	}
+	if req.Workload.Blocks < 0 || req.Workload.Delay < 0 {
+		return nil, fmt.Errorf("negative workload blocks or propagation delay")
+	}
+	sim := &paramSim{params: []ConsensusParams{bc.ConsensusParams()}, workload: req.Workload}
+	for i, p := range req.Params {
+		p.Name = cmp.Or(p.Name, fmt.Sprint("params ", i+1))
+		if p.Retarget != "" && p.Window == 0 {
+			p.Window = DefaultRetargetSpec(p.Retarget).Window
+		}
+		if err := p.check(); err != nil {
+			return nil, err
+		}
+		sim.params = append(sim.params, p)
+	}
+	var err error
+	sim.txns, sim.hashRate, sim.duration, err = bc.paramSimWorkload(req.Workload)
+	return sim, err
+}
+
+func (sim *paramSim) run() []ParamSimResult {
+	results := []ParamSimResult{}
+	for _, p := range sim.params {
+		results = append(results, simulateParams(p, sim.txns, sim.hashRate, sim.duration, sim.workload))
+	}
+	return results
+}
+
+/*
+ * Run the workload of req under the parameters of the chain, then under
+ * each of req.Params
+ */
+func (bc *BlockChain) SimulateParams(req ParamSimRequest) ([]ParamSimResult, error) {
+	sim, err := bc.newParamSim(req)
+	if err != nil {
+		return nil, err
+	}
+	return sim.run(), nil
+}
+
+/*
+ * Print the results of the ParamSimRequest of the JSON file at path, the
+ * default synthetic workload if empty, one column per parameter set
+ */
+func runParamSim(bc *BlockChain, path string, out *Output) int {
+	req := DefaultParamSimRequest()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if err := json.Unmarshal(raw, &req); err != nil {
+			log.Printf("%v: %v", path, err)
+			return 1
+		}
+	}
+	results, err := bc.SimulateParams(req)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	header := []string{"metric"}
+	for _, r := range results {
+		header = append(header, r.Params.Name)
+	}
+	metrics := []struct {
+		name  string
+		value func(r ParamSimResult) string
+	}{
+		{"block time", func(r ParamSimResult) string { return fmt.Sprintf("%vs", r.Params.BlockTime) }},
+		{"retarget", func(r ParamSimResult) string { return cmp.Or(r.Params.Retarget, "fixed") }},
+		{"blocks", func(r ParamSimResult) string { return fmt.Sprint(r.Blocks) }},
+		{"mean interval", func(r ParamSimResult) string { return fmt.Sprintf("%.0fs", r.MeanInterval) }},
+		{"std dev", func(r ParamSimResult) string { return fmt.Sprintf("%.0fs", r.StdDev) }},
+		{"mean difficulty", func(r ParamSimResult) string { return fmt.Sprintf("%.2f", r.MeanDifficulty) }},
+		{"confirmation", func(r ParamSimResult) string { return fmt.Sprintf("%.0fs", r.Confirmation) }},
+		{"confirmation p95", func(r ParamSimResult) string { return fmt.Sprintf("%.0fs", r.Confirmation95) }},
+		{"throughput", func(r ParamSimResult) string { return fmt.Sprintf("%.3f txn/s", r.Throughput) }},
+		{"backlog", func(r ParamSimResult) string { return fmt.Sprint(r.Backlog) }},
+		{"stale rate", func(r ParamSimResult) string { return fmt.Sprintf("%.1f%%", 100*r.StaleRate) }},
+		{"miner revenue", func(r ParamSimResult) string { return fmt.Sprintf("%.2f/block", r.MinerRevenue) }},
+		{"issuance", func(r ParamSimResult) string { return fmt.Sprint(r.Issuance) }},
+	}
+	rows := [][]string{}
+	for _, m := range metrics {
+		row := []string{m.name}
+		for _, r := range results {
+			row = append(row, m.value(r))
+		}
+		rows = append(rows, row)
+	}
+	if err := out.Table(header, rows, results); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleParamSim(w http.ResponseWriter, r *http.Request) {
+	req := DefaultParamSimRequest()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Only collecting the workload needs the chain
+	var sim *paramSim
+	var err error
+	s.node.withChain(func(bc *BlockChain) { sim, err = bc.newParamSim(req) })
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, sim.run())
+}
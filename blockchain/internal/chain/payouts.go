@@ -0,0 +1,64 @@
+/*
+ * Batch payouts.
+ * On top of paying amt to its payee, a transfer can pay further payees in
+ * the same asset, so a payroll or an exchange withdrawal batch goes out as
+ * a single transaction with a single nonce and fee.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Max payouts of a transfer on top of its payee
+const MAX_PAYOUTS = 32
+
+// Gas of each payout on top of GAS_TRANSFER
+const GAS_PAYOUT = 9_000
+
+type Payout struct {
+	payee string
+	amt   Amount
+}
+
+func NewPayout(payee string, amt Amount) Payout {
+	return Payout{payee: payee, amt: amt}
+}
+
+// Transfer of asset from payer to the first payout's payee and all others
+func NewBatchTransfer(payer string, nonce uint64, asset string, payouts ...Payout) Transaction {
+	txn := Transaction{payer: payer, asset: asset, nonce: nonce}
+	if len(payouts) > 0 {
+		txn.payee, txn.amt = payouts[0].payee, payouts[0].amt
+		txn.payouts = payouts[1:]
+	}
+	return txn
+}
+
+// Amount leaving payer in a transfer, over all payees
+func (txn Transaction) transferTotal() Amount {
+	total := txn.amt
+	for _, p := range txn.payouts {
+		total += p.amt
+	}
+	return total
+}
+
+func (txn Transaction) verifyPayouts() error {
+	if len(txn.payouts) == 0 {
+		return nil
+	}
+	if txn.kind != TxnTransfer {
+		return errors.New("only transfers can have payouts")
+	}
+	if len(txn.payouts) > MAX_PAYOUTS {
+		return fmt.Errorf("more than %v payouts", MAX_PAYOUTS)
+	}
+	for _, p := range txn.payouts {
+		if p.payee == "" || p.amt <= 0 {
+			return errors.New("payout needs a payee and a positive amount")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+/*
+ * Peer management.
+ * The peers of a Node are its relay peers, see relay.go: the nodes it
+ * floods transactions, alerts and Blocks to. -relay-peers sets them at start, and
+ * AddPeer and RemovePeer change them while the node runs, so the topology
+ * of a multi-node demo is rewired without restarting anything. A Node
+ * started without relay floods to the first peer added.
+ *
+ * HTTP has no connections to watch, so a peer counts as connected while
+ * the last request to it got an answer: every relayed transaction or alert,
+ * and the probes of AddPeer and GET /peers, which also ask the peer for its
+ * genesis and best height. A peer following another chain is refused, and
+ * one found to follow another chain or speak an incompatible protocol
+ * later on, see handshake.go, is listed as such, every request to it
+ * failing.
+ *
+ * Anyone reaching the node API lists the peers, only the operator changes
+ * them, through the admin API, see admin.go: a client adding a peer would
+ * have the node dial any address it names, and could evict honest peers.
+ *
+ *	GET    /peers                    peers and their status, probed first
+ *	POST   /admin/peers {"url": ..}  add a peer, on the admin API
+ *	DELETE /admin/peers?url=..       remove a peer, on the admin API
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a peer
+const (
+	PEER_UNKNOWN      = "unknown"      // never contacted
+	PEER_CONNECTED    = "connected"    // answered the last request
+	PEER_UNREACHABLE  = "unreachable"  // did not
+	PEER_OTHER_CHAIN  = "other-chain"  // answered with another genesis
+	PEER_INCOMPATIBLE = "incompatible" // answered with a protocol version too old, see handshake.go
+)
+
+// Timeout of the probes of peers
+const PEER_PROBE_TIMEOUT = 5 * time.Second
+
+type PeerInfo struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"`
+	LastSeen int64  `json:"lastSeen,omitempty"` // unix microseconds of the last answer
+	Height   int    `json:"height"`             // best height at the last probe, -1 before
+	Error    string `json:"error,omitempty"`    // of the last request, if it failed
+}
+
+func newPeerInfo(peer string) *PeerInfo {
+	return &PeerInfo{URL: peer, Status: PEER_UNKNOWN, Height: -1}
+}
+
+// URLs of the relay peers
+func (r *relay) peerURLs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.config.Peers)
+}
+
+// Record the outcome of a request to peer, err being nil if it answered
+func (r *relay) seen(peer string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := r.peers[peer]
+	if info == nil {
+		// Removed meanwhile
+		return
+	}
+	if err != nil {
+		info.Status, info.Error = peerStatus(err), err.Error()
+		return
+	}
+	if info.Status != PEER_OTHER_CHAIN && info.Status != PEER_INCOMPATIBLE {
+		info.Status, info.Error = PEER_CONNECTED, ""
+	}
+	info.LastSeen = time.Now().UnixMicro()
+}
+
+/*
+ * Ask peer for its genesis hash and best height, its status being
+ * PEER_OTHER_CHAIN unless the genesis hash is genesisHash
+ */
+func probePeer(peer, genesisHash string) PeerInfo {
+	info := *newPeerInfo(peer)
+	p := newPeerClient(peer)
+	p.client.Timeout = PEER_PROBE_TIMEOUT
+	_, hash, err := p.genesis()
+	if err != nil {
+		info.Status, info.Error = peerStatus(err), err.Error()
+		return info
+	}
+	info.LastSeen = time.Now().UnixMicro()
+	if hash != genesisHash {
+		info.Status, info.Error = PEER_OTHER_CHAIN, fmt.Sprintf("genesis %v, expected %v", hash, genesisHash)
+		return info
+	}
+	info.Status = PEER_CONNECTED
+	var tip []jsonBlockSummary
+	if _, err := p.get("/blocks?limit=1", &tip); err != nil {
+		info.Error = err.Error()
+	} else if len(tip) == 1 {
+		info.Height = tip[0].Height
+	}
+	return info
+}
+
+// Status of a peer whose request failed with err
+func peerStatus(err error) string {
+	switch {
+	case errors.Is(err, ErrOtherChain):
+		return PEER_OTHER_CHAIN
+	case errors.Is(err, ErrIncompatiblePeer):
+		return PEER_INCOMPATIBLE
+	}
+	return PEER_UNREACHABLE
+}
+
+func (n *Node) genesisHash() string {
+	var hash string
+	n.withChain(func(bc *BlockChain) { hash = bc.GenesisHash() })
+	return hash
+}
+
+/*
+ * Relay to peer, a node API URL, from now on. The peer is probed first and
+ * refused if it follows another chain, but added if unreachable, to be
+ * reached once it is up. Adding a peer again probes it again
+ */
+func (n *Node) AddPeer(peer string) (PeerInfo, error) {
+	peer = strings.TrimSuffix(peer, "/")
+	u, err := url.Parse(peer)
+	if err != nil {
+		return PeerInfo{}, fmt.Errorf("%w: %w", ErrInvalidPeer, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "noise" || u.Host == "" {
+		return PeerInfo{}, fmt.Errorf("%w: %q is not an http, https or noise URL", ErrInvalidPeer, peer)
+	}
+	info := probePeer(peer, n.genesisHash())
+	switch info.Status {
+	case PEER_OTHER_CHAIN:
+		return info, fmt.Errorf("%w: %v follows another chain, %v", ErrInvalidPeer, peer, info.Error)
+	case PEER_INCOMPATIBLE:
+		return info, fmt.Errorf("%w: %v speaks an incompatible protocol, %v", ErrInvalidPeer, peer, info.Error)
+	}
+	n.mu.Lock()
+	if n.relay == nil {
+		n.setRelay(newRelay(RelayConfig{}))
+	}
+	r := n.relay
+	n.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.peers[peer] == nil {
+		r.config.Peers = append(r.config.Peers, peer)
+	}
+	r.peers[peer] = &info
+	log.Printf("peers: added %v, %v", peer, info.Status)
+	return info, nil
+}
+
+// Stop relaying to peer
+func (n *Node) RemovePeer(peer string) error {
+	peer = strings.TrimSuffix(peer, "/")
+	r := n.relayer()
+	if r == nil {
+		return fmt.Errorf("%w: %v", ErrUnknownPeer, peer)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.peers[peer] == nil {
+		return fmt.Errorf("%w: %v", ErrUnknownPeer, peer)
+	}
+	delete(r.peers, peer)
+	r.config.Peers = slices.DeleteFunc(r.config.Peers, func(p string) bool { return p == peer })
+	log.Printf("peers: removed %v", peer)
+	return nil
+}
+
+// Peers of the Node in the order they were added, as last seen
+func (n *Node) Peers() []PeerInfo {
+	peers := []PeerInfo{}
+	r := n.relayer()
+	if r == nil {
+		return peers
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, peer := range r.config.Peers {
+		peers = append(peers, *r.peers[peer])
+	}
+	return peers
+}
+
+// Probe every peer at once, then list them, see Peers
+func (n *Node) RefreshPeers() []PeerInfo {
+	r := n.relayer()
+	if r == nil {
+		return []PeerInfo{}
+	}
+	hash := n.genesisHash()
+	var wg sync.WaitGroup
+	for _, peer := range r.peerURLs() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info := probePeer(peer, hash)
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.peers[peer] != nil {
+				if info.LastSeen == 0 {
+					info.LastSeen = r.peers[peer].LastSeen
+				}
+				r.peers[peer] = &info
+			}
+		}()
+	}
+	wg.Wait()
+	return n.Peers()
+}
+
+/*
+ * Print the peers of the node API at node, adding then removing the peers
+ * add and remove first when set through the admin API at admin, bearing
+ * token, returning the exit code
+ */
+func runPeers(node, admin, token, add, remove string, out *Output) int {
+	p := newPeerClient(node)
+	var peers []PeerInfo
+	var err error
+	if (add != "" || remove != "") && admin == "" {
+		err = errors.New("-add-peer and -remove-peer need -peers-admin")
+	}
+	a := newPeerClient(admin)
+	a.token = token
+	if err == nil && add != "" {
+		var info PeerInfo
+		err = a.send(http.MethodPost, "/admin/peers", map[string]string{"url": add}, &info)
+	}
+	if err == nil && remove != "" {
+		err = a.send(http.MethodDelete, "/admin/peers?url="+url.QueryEscape(remove), nil, &peers)
+	}
+	if err == nil {
+		_, err = p.get("/peers", &peers)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	rows := [][]string{}
+	for _, info := range peers {
+		seen, height := "", ""
+		if info.LastSeen != 0 {
+			seen = time.UnixMicro(info.LastSeen).UTC().Format(time.RFC3339)
+		}
+		if info.Height >= 0 {
+			height = fmt.Sprint(info.Height)
+		}
+		rows = append(rows, []string{info.URL, info.Status, height, seen, info.Error})
+	}
+	if err := out.Table([]string{"peer", "status", "height", "last seen", "error"}, rows, peers); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// Send v as JSON, unless nil, with method to path, decoding the JSON reply into reply
+func (p *peerClient) send(method, path string, v, reply any) error {
+	var body []byte
+	if v != nil {
+		var err error
+		if body, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, p.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%v %v: %v: %v", method, path, resp.Status, e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.node.RefreshPeers())
+}
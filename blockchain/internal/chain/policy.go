@@ -0,0 +1,60 @@
+/*
+ * Node policies.
+ * Validators bind every node of a chain, see validator.go. A policy is a
+ * rule of one node only: the node refuses transactions failing it when
+ * they are submitted or relayed to its Mempool, so it never mines them,
+ * yet accepts Blocks of other miners carrying them, and nodes with
+ * different policies stay on the same chain. Eg. an operator honouring a
+ * sanctions list the course does not enforce:
+ *
+ *	[{"rule": "freeze", "accounts": ["mallory"]}]
+ *
+ * -policy loads a JSON list of rules of the genesis spec, namespaces
+ * included, as policies. Custom ones are Validators set with
+ * BlockChain.AddPolicy. Transactions failing a policy are refused with
+ * ErrPolicy.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Refuse the transactions v fails from now on in the Mempool, not in Blocks
+func (bc *BlockChain) AddPolicy(v Validator) {
+	bc.policies = append(bc.policies, v)
+}
+
+// Rules of the JSON policy file at path
+func LoadPolicy(path string) ([]RuleSpec, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RuleSpec
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("policy %v: %w", path, err)
+	}
+	for _, rule := range rules {
+		if err := rule.check(); err != nil {
+			return nil, fmt.Errorf("policy %v: %w", path, err)
+		}
+	}
+	return rules, nil
+}
+
+/*
+ * Run the policies of the node on txn against the current state
+ * Fails with ErrPolicy
+ */
+func (bc *BlockChain) checkPolicies(txn Transaction) error {
+	view := &StateView{state: bc.state, height: bc.blocks.Len() - 1}
+	for _, v := range bc.policies {
+		if err := v.Validate(txn, view); err != nil {
+			return fmt.Errorf("%w: %v", ErrPolicy, err)
+		}
+	}
+	return nil
+}
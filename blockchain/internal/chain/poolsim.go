@@ -0,0 +1,376 @@
+/*
+ * Simulation of a mining pool.
+ * A miner alone finds a Block once in a long while, at random, see
+ * miningsim.go: small miners may wait months between rewards. A pool
+ * smooths their income out, paying each its part of every Block the pool
+ * finds, as told by the shares it submits:
+ *
+ *	- the coordinator builds the Block the pool mines, paying the reward
+ *	  to POOL_ACCOUNT, and sends each worker a PoolJob, its Header and a
+ *	  range of nonces of its own, so no two workers try the same nonce
+ *	- a worker submits as a PoolShare every nonce of its range whose hash
+ *	  meets the share difficulty, lower than the one of the chain. A share
+ *	  is a proof of work too: it tells how many hashes the worker tried
+ *	  without the coordinator trusting its word
+ *	- the coordinator checks each share, refusing nonces of another range,
+ *	  of a Job already over, submitted twice or short of the share
+ *	  difficulty, see Submit. A share meeting the difficulty of the chain
+ *	  also seals the Block
+ *	- the reward of each Block is split among the workers in proportion of
+ *	  their shares since the last Block, and paid in a batch transfer of
+ *	  the next Block, see payouts.go
+ *
+ * Each step of the simulation, every worker tries as many nonces as its
+ * hash power. Workers earn their part of the hash power, give or take the
+ * luck of a few shares, whoever finds the Blocks. Real pools pay on a
+ * sliding window of shares, PPLNS, so that hopping between pools does not
+ * pay, and keep a fee.
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Account the pool mines to, paying its workers from
+const POOL_ACCOUNT = "pool"
+
+const (
+	POOL_NONCE_RANGE     = 1 << 40 // nonces of each worker's range
+	POOL_MAX_WORKERS     = MAX_PAYOUTS + 1
+	POOL_SIM_REWARD      = 50 * COIN
+	POOL_SIM_BLOCKS      = 30
+	POOL_SIM_DIFFICULTY  = 4
+	POOL_SIM_SHARE_DELTA = 2   // share difficulty below the chain's
+	POOL_SIM_TICK        = 100 // hashes of a step by a worker of hash power 1
+)
+
+// Work sent to a worker
+type PoolJob struct {
+	ID              int    `json:"id"`
+	Header          Header `json:"-"`     // of the Block mined, nonce aside
+	Start           int    `json:"start"` // first nonce of the range of the worker
+	End             int    `json:"end"`   // past its last nonce
+	ShareDifficulty int    `json:"shareDifficulty"`
+}
+
+// Nonce of a job meeting the share difficulty
+type PoolShare struct {
+	Worker string `json:"worker"`
+	Job    int    `json:"job"`
+	Nonce  int    `json:"nonce"`
+}
+
+// Coordinator of a pool mining on bc
+type MiningPool struct {
+	bc              *BlockChain
+	shareDifficulty int
+	workers         []string          // in the order they connected, each mining the range of its index
+	template        Block             // Block mined by the current job
+	job             int               // ID of the current job
+	seen            map[int]bool      // nonces submitted for the current job
+	round           map[string]int    // shares of each worker since the last Block
+	earned          map[string]Amount // credited to each worker by the Blocks found
+	payouts         []Payout          // owed to the workers, paid in the next Block
+	nonce           uint64            // of the next payout of the pool
+}
+
+func NewMiningPool(bc *BlockChain, shareDifficulty int) (*MiningPool, error) {
+	if shareDifficulty < 1 || shareDifficulty > bc.difficulty {
+		return nil, fmt.Errorf("share difficulty %v outside 1..%v, the difficulty of the chain", shareDifficulty, bc.difficulty)
+	}
+	if bc.genesis.Pow.memoryHard() {
+		return nil, errors.New("the pool only mines SHA-256 chains")
+	}
+	pool := &MiningPool{bc: bc, shareDifficulty: shareDifficulty, round: map[string]int{}, earned: map[string]Amount{}}
+	return pool, pool.newJob()
+}
+
+// Build the next Block, carrying the payouts owed, and start a job mining it
+func (p *MiningPool) newJob() error {
+	bc := p.bc
+	b := Block{
+		Header: Header{prevHash: bc.lastBlock().hash, miner: POOL_ACCOUNT, unixTs: bc.lastBlock().unixTs + 10_000_000},
+		data:   []Transaction{},
+	}
+	if len(p.payouts) > 0 {
+		b.data = append(b.data, NewBatchTransfer(POOL_ACCOUNT, p.nonce, NATIVE_ASSET, p.payouts...))
+	}
+	state, err := bc.DryRun(b)
+	if err != nil {
+		return fmt.Errorf("pool block: %w", err)
+	}
+	bc.commitState(&b, state)
+	bc.commitAddresses(&b)
+	bc.commitVersion(&b)
+	b.merkleRoot = merkleRoot(b.data)
+	b.difficulty = bc.difficulty
+	p.template = b
+	p.job++
+	p.seen = map[int]bool{}
+	return nil
+}
+
+// Register a worker, returning its first job
+func (p *MiningPool) Connect(worker string) (PoolJob, error) {
+	if len(p.workers) == POOL_MAX_WORKERS {
+		return PoolJob{}, fmt.Errorf("pool full with %v workers", POOL_MAX_WORKERS)
+	}
+	if p.index(worker) >= 0 || worker == POOL_ACCOUNT {
+		return PoolJob{}, fmt.Errorf("worker %v already connected", worker)
+	}
+	p.workers = append(p.workers, worker)
+	return p.Job(worker), nil
+}
+
+func (p *MiningPool) index(worker string) int {
+	for i, w := range p.workers {
+		if w == worker {
+			return i
+		}
+	}
+	return -1
+}
+
+// Current job of a connected worker
+func (p *MiningPool) Job(worker string) PoolJob {
+	start := p.index(worker) * POOL_NONCE_RANGE
+	return PoolJob{ID: p.job, Header: p.template.Header, Start: start, End: start + POOL_NONCE_RANGE, ShareDifficulty: p.shareDifficulty}
+}
+
+/*
+ * Check and count a share, sealing the Block of the job when it meets the
+ * difficulty of the chain, returning whether it did
+ */
+func (p *MiningPool) Submit(share PoolShare) (bool, error) {
+	i := p.index(share.Worker)
+	switch {
+	case i < 0:
+		return false, fmt.Errorf("share of unknown worker %v", share.Worker)
+	case share.Job != p.job:
+		return false, fmt.Errorf("stale share of job %v, the pool mines job %v", share.Job, p.job)
+	case share.Nonce < i*POOL_NONCE_RANGE || share.Nonce >= (i+1)*POOL_NONCE_RANGE:
+		return false, fmt.Errorf("nonce %v outside the range of %v", share.Nonce, share.Worker)
+	case p.seen[share.Nonce]:
+		return false, fmt.Errorf("nonce %v already submitted", share.Nonce)
+	}
+	b := p.template
+	b.nonce = share.Nonce
+	hash := b.computeHash()
+	if !meetsDifficulty(hash, p.shareDifficulty) {
+		return false, fmt.Errorf("hash %v of nonce %v short of the share difficulty %v", hash, share.Nonce, p.shareDifficulty)
+	}
+	p.seen[share.Nonce] = true
+	p.round[share.Worker]++
+	if !meetsDifficulty(hash, b.difficulty) {
+		return false, nil
+	}
+	b.hash = hash
+	before := p.bc.Balance(POOL_ACCOUNT, NATIVE_ASSET)
+	if err := p.bc.appendBlock(b); err != nil {
+		return false, fmt.Errorf("pool block %v: %w", hash, err)
+	}
+	if len(b.data) > 0 {
+		p.nonce++
+	}
+	p.payRound(p.bc.Balance(POOL_ACCOUNT, NATIVE_ASSET) - before + payoutsTotal(p.payouts))
+	return true, p.newJob()
+}
+
+func payoutsTotal(payouts []Payout) Amount {
+	var sum Amount
+	for _, payout := range payouts {
+		sum += payout.amt
+	}
+	return sum
+}
+
+// Split reward among the workers by their shares of the round, the pool keeping what rounds off
+func (p *MiningPool) payRound(reward Amount) {
+	shares := 0
+	for _, n := range p.round {
+		shares += n
+	}
+	p.payouts = []Payout{}
+	for _, worker := range p.workers {
+		if n := p.round[worker]; n > 0 {
+			amt, _ := reward.mulDiv(int64(n), int64(shares))
+			p.payouts = append(p.payouts, NewPayout(worker, amt))
+			p.earned[worker] += amt
+		}
+	}
+	p.round = map[string]int{}
+}
+
+// Worker of the simulation, trying power nonces a step
+type poolWorker struct {
+	name   string
+	power  int
+	job    PoolJob
+	fixed  []byte // bytes of the Header of the job but the nonce
+	next   int    // nonce tried next
+	shares int
+	blocks int
+}
+
+func (w *poolWorker) take(job PoolJob) {
+	w.job, w.fixed, w.next = job, job.Header.fixedBytes(), job.Start
+}
+
+// Try the next nonces of the job, returning the shares found
+func (w *poolWorker) work() []PoolShare {
+	shares := []PoolShare{}
+	header := append(make([]byte, 0, len(w.fixed)+20), w.fixed...)
+	for range w.power {
+		if w.next == w.job.End {
+			break
+		}
+		sum := sha256.Sum256(appendNonce(header[:len(w.fixed)], w.next))
+		if sumMeetsDifficulty(&sum, w.job.ShareDifficulty) {
+			shares = append(shares, PoolShare{w.name, w.job.ID, w.next})
+		}
+		w.next++
+	}
+	return shares
+}
+
+type PoolSimConfig struct {
+	Difficulty      int
+	ShareDifficulty int
+	Powers          []float64 // hash power of each worker, in POOL_SIM_TICK hashes a step
+	Blocks          int
+}
+
+type PoolSimWorker struct {
+	Worker     string  `json:"worker"`
+	Power      float64 `json:"power"`
+	PowerShare float64 `json:"powerShare"`
+	Shares     int     `json:"shares"`
+	ShareShare float64 `json:"shareShare"`
+	Blocks     int     `json:"blocks"` // found by the worker
+	Solo       Amount  `json:"solo"`   // rewards of the Blocks it found, had it mined them alone
+	Earned     Amount  `json:"earned"` // from the pool
+	Paid       Amount  `json:"paid"`   // on chain, the payout of the last Block being due
+}
+
+type PoolSimResult struct {
+	Blocks  int             `json:"blocks"`
+	Hashes  int64           `json:"hashes"`
+	Shares  int             `json:"shares"`
+	Workers []PoolSimWorker `json:"workers"`
+}
+
+func DefaultPoolSimConfig() PoolSimConfig {
+	return PoolSimConfig{
+		Difficulty:      POOL_SIM_DIFFICULTY,
+		ShareDifficulty: POOL_SIM_DIFFICULTY - POOL_SIM_SHARE_DELTA,
+		Powers:          []float64{1, 1, 2, 4, 8},
+		Blocks:          POOL_SIM_BLOCKS,
+	}
+}
+
+func poolGenesis(difficulty int) Genesis {
+	g := DefaultGenesis(difficulty)
+	g.ChainID = "pool-sim"
+	g.Issuance = &IssuanceSpec{Reward: POOL_SIM_REWARD}
+	return g
+}
+
+// Mine cfg.Blocks Blocks with a pool of workers of the given hash powers
+func SimulatePool(cfg PoolSimConfig) (PoolSimResult, error) {
+	if len(cfg.Powers) == 0 || cfg.Blocks < 1 {
+		return PoolSimResult{}, errors.New("pool simulation needs workers and blocks")
+	}
+	bc := CreateBlockChain(poolGenesis(cfg.Difficulty))
+	pool, err := NewMiningPool(&bc, cfg.ShareDifficulty)
+	if err != nil {
+		return PoolSimResult{}, err
+	}
+	workers := []*poolWorker{}
+	power := 0.0
+	for i, p := range cfg.Powers {
+		w := &poolWorker{name: "worker" + strconv.Itoa(i+1), power: int(math.Round(p * POOL_SIM_TICK))}
+		if w.power < 1 {
+			return PoolSimResult{}, fmt.Errorf("hash power %v of %v tries no nonce a step", p, w.name)
+		}
+		job, err := pool.Connect(w.name)
+		if err != nil {
+			return PoolSimResult{}, err
+		}
+		w.take(job)
+		workers = append(workers, w)
+		power += p
+	}
+	result := PoolSimResult{}
+	for result.Blocks < cfg.Blocks {
+		found := false
+		for _, w := range workers {
+			result.Hashes += int64(w.power)
+			for _, share := range w.work() {
+				sealed, err := pool.Submit(share)
+				if err != nil {
+					return result, err
+				}
+				w.shares++
+				result.Shares++
+				if sealed {
+					w.blocks++
+					result.Blocks++
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		// Workers yet to mine this step start on the new job, as on a real network
+		if found {
+			for _, w := range workers {
+				w.take(pool.Job(w.name))
+			}
+		}
+	}
+	for i, w := range workers {
+		result.Workers = append(result.Workers, PoolSimWorker{
+			Worker:     w.name,
+			Power:      cfg.Powers[i],
+			PowerShare: cfg.Powers[i] / power,
+			Shares:     w.shares,
+			ShareShare: float64(w.shares) / float64(result.Shares),
+			Blocks:     w.blocks,
+			Solo:       Amount(w.blocks) * POOL_SIM_REWARD,
+			Earned:     pool.earned[w.name],
+			Paid:       bc.Balance(w.name, NATIVE_ASSET),
+		})
+	}
+	return result, nil
+}
+
+func printPoolSim(workers string, out *Output) error {
+	cfg := DefaultPoolSimConfig()
+	if workers != "" {
+		powers, err := parseHashPowers(workers)
+		if err != nil {
+			return err
+		}
+		cfg.Powers = powers
+	}
+	result, err := SimulatePool(cfg)
+	if err != nil {
+		return err
+	}
+	out.Note("%v blocks of reward %v at difficulty %v found by a pool, %v shares at difficulty %v, %v hashes",
+		result.Blocks, POOL_SIM_REWARD, cfg.Difficulty, result.Shares, cfg.ShareDifficulty, result.Hashes)
+	rows := [][]string{}
+	for _, w := range result.Workers {
+		rows = append(rows, []string{w.Worker, fmt.Sprint(w.Power), fmt.Sprintf("%.1f%%", 100*w.PowerShare), fmt.Sprint(w.Shares),
+			fmt.Sprintf("%.1f%%", 100*w.ShareShare), fmt.Sprint(w.Blocks), fmt.Sprintf("%.2f", w.Solo.Coins()),
+			fmt.Sprintf("%.2f", w.Earned.Coins()), fmt.Sprintf("%.2f", w.Paid.Coins())})
+	}
+	return out.Table([]string{"worker", "power", "power share", "shares", "share share", "blocks", "solo", "earned", "paid"}, rows, result)
+}
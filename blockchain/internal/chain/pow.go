@@ -0,0 +1,107 @@
+/*
+ * Proof Of Work algorithms.
+ * Blocks are mined with SHA-256 unless the genesis spec declares scrypt,
+ * the memory-hard function of the keystore, see scrypt.go:
+ *
+ *	"pow": {"algorithm": "scrypt", "n": 1024, "r": 1, "p": 1}
+ *
+ * The Block hash stays the SHA-256 of the Header, linking the Blocks and
+ * naming them, but the work is checked on the scrypt of the Header, salted
+ * with itself, as Litecoin does: each try costs 128*r*n bytes of memory,
+ * 128KB with the Litecoin parameters, the defaults. Memory, unlike
+ * hashing circuits, is not much faster on dedicated chips, which is the
+ * idea of ASIC resistance. A try also takes far longer than a SHA-256
+ * hash, so a scrypt chain wants a lower difficulty: compare the hash rates
+ * of the mining benchmarks, see miningsim.go.
+ *
+ * Argon2 would fit the same spot, but it is not in the standard library.
+ */
+package chain
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	POW_SHA256 = "sha256"
+	POW_SCRYPT = "scrypt"
+)
+
+// Litecoin's scrypt parameters, the defaults
+const (
+	POW_SCRYPT_N = 1024
+	POW_SCRYPT_R = 1
+	POW_SCRYPT_P = 1
+)
+
+// Most memory a scrypt try may take, 64MB
+const POW_SCRYPT_MAX_MEMORY = 64 << 20
+
+type PowSpec struct {
+	Algorithm string `json:"algorithm"`   // POW_SHA256 or POW_SCRYPT
+	N         int    `json:"n,omitempty"` // scrypt cost, a power of 2
+	R         int    `json:"r,omitempty"` // scrypt block size
+	P         int    `json:"p,omitempty"` // scrypt parallelism
+}
+
+// Spec of the algorithm named name with its default parameters, nil for SHA-256
+func NewPowSpec(name string) (*PowSpec, error) {
+	switch name {
+	case POW_SHA256:
+		return nil, nil
+	case POW_SCRYPT:
+		return &PowSpec{Algorithm: POW_SCRYPT, N: POW_SCRYPT_N, R: POW_SCRYPT_R, P: POW_SCRYPT_P}, nil
+	}
+	return nil, fmt.Errorf("unknown proof of work %q, expected %v or %v", name, POW_SHA256, POW_SCRYPT)
+}
+
+func (spec *PowSpec) check() error {
+	switch spec.Algorithm {
+	case POW_SHA256:
+		if spec.N != 0 || spec.R != 0 || spec.P != 0 {
+			return fmt.Errorf("%v proof of work takes no parameters", POW_SHA256)
+		}
+		return nil
+	case POW_SCRYPT:
+		if spec.N <= 1 || spec.N&(spec.N-1) != 0 || spec.R <= 0 || spec.P <= 0 {
+			return fmt.Errorf("scrypt proof of work needs n a power of 2 above 1 and positive r and p, got %v", spec)
+		}
+		if spec.R > POW_SCRYPT_MAX_MEMORY/128 || spec.N > POW_SCRYPT_MAX_MEMORY/(128*spec.R) || spec.P >= (1<<30)/spec.R {
+			return fmt.Errorf("scrypt proof of work %v takes more than %v bytes or too many passes", spec, POW_SCRYPT_MAX_MEMORY)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown proof of work %q", spec.Algorithm)
+}
+
+func (spec PowSpec) String() string {
+	if spec.Algorithm == POW_SCRYPT {
+		return fmt.Sprintf("%v/%v/%v/%v", spec.Algorithm, spec.N, spec.R, spec.P)
+	}
+	return spec.Algorithm
+}
+
+// Whether the work is a memory-hard function rather than the Block hash
+func (spec *PowSpec) memoryHard() bool {
+	return spec != nil && spec.Algorithm == POW_SCRYPT
+}
+
+// Hex scrypt of the Header, the work of memory-hard chains
+func (spec *PowSpec) workHash(h Header) string {
+	header := appendNonce(h.fixedBytes(), h.nonce)
+	key, err := scrypt(string(header), header, spec.N, spec.R, spec.P, 32)
+	if err != nil {
+		// Parameters are checked when the genesis is loaded
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+// Whether the Header h, whose hash is hash, carries the work of difficulty
+func (spec *PowSpec) meets(h Header, hash string, difficulty int) bool {
+	if !spec.memoryHard() {
+		return meetsDifficulty(hash, difficulty)
+	}
+	return meetsDifficulty(spec.workHash(h), difficulty)
+}
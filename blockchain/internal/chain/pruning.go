@@ -0,0 +1,362 @@
+/*
+ * Pruning with deletion receipts.
+ * A long running node may drop the bodies of old Blocks, keeping their
+ * headers: the chain stays linked and light clients are served as before,
+ * but those transactions can no longer be replayed, proven or synced from
+ * the node. The state after the last pruned Block is kept instead, so
+ * historic queries back to it still work. The bodies of the last
+ * MAX_REORG_DEPTH Blocks are never pruned, as a reorganization replays
+ * them.
+ *
+ * Pruning produces a PruneReceipt signed by the operator: the height,
+ * hash, Merkle root, transaction count and MMR position of every pruned
+ * Block, along with the MMR root of all Block hashes up to the tip and the
+ * state root the node now replays from. An auditor holding the chain, or
+ * only its headers, checks with VerifyPruneReceipt that the receipt
+ * matches it: the pruned Blocks are the ones of the chain, and the MMR root
+ * proves no retained Block was altered by the pruning.
+ *
+ * Pruned bodies are gone from cold storage too, so -recover stops at the
+ * first pruned Block; keep a full node or an export to recover from.
+ *
+ * A node is started in one of three modes: a full node keeps every body
+ * unless told to prune, a pruned node (-prune-keep) keeps the bodies of
+ * its last Blocks only, pruning older ones in batches of PRUNE_BATCH as
+ * Blocks are committed, and an archive node (-archive) keeps every body
+ * along with periodic states, see history.go.
+ *
+ *	GET  /prune/receipts  receipts of the pruning done by the node
+ *	POST /prune/verify    check a receipt against the chain of the node
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Fewest bodies a pruned node prunes at once, so receipts come in batches
+const PRUNE_BATCH = 100
+
+type PrunedBlock struct {
+	Height     int    `json:"height"`
+	Hash       string `json:"hash"`
+	MerkleRoot string `json:"merkleRoot"` // of the pruned transactions
+	Txns       int    `json:"txns"`
+	MMRPos     int    `json:"mmrPos"` // position of the leaf of the Block
+}
+
+type PruneReceipt struct {
+	GenesisHash string        `json:"genesisHash"`
+	Blocks      []PrunedBlock `json:"blocks"`
+	Tip         int           `json:"tip"` // height of the chain when pruned
+	TipHash     string        `json:"tipHash"`
+	MMRRoot     string        `json:"mmrRoot"` // of the Block hashes up to the tip
+	MMRSize     int           `json:"mmrSize"`
+	StateRoot   string        `json:"stateRoot"` // after the last pruned Block
+	UnixTs      int64         `json:"unixTs"`    // unix microseconds
+	Pruner      string        `json:"pruner"`    // account of the operator
+	PublicKey   []byte        `json:"publicKey"`
+	Scheme      SigScheme     `json:"scheme,omitempty"` // of the pruner's key
+	Signature   []byte        `json:"signature"`        // of the digest of the receipt
+}
+
+func (r PruneReceipt) digest() []byte {
+	packed := fmt.Sprintf("prune|%v|%v|%v|%v|%v|%v|%v|%v|%x",
+		r.GenesisHash, r.Tip, r.TipHash, r.MMRRoot, r.MMRSize, r.StateRoot, r.UnixTs, r.Pruner, r.PublicKey)
+	if r.Scheme != SchemeECDSA {
+		packed += fmt.Sprintf("|scheme=%v", r.Scheme)
+	}
+	for _, b := range r.Blocks {
+		packed += fmt.Sprintf("|%v:%v:%v:%v:%v", b.Height, b.Hash, b.MerkleRoot, b.Txns, b.MMRPos)
+	}
+	hash := sha256.Sum256([]byte(packed))
+	return hash[:]
+}
+
+/*
+ * Drop the bodies of the Blocks below height, and return the receipt of
+ * the drop signed with key
+ * Fails if the bodies are pruned already, or are among the last
+ * MAX_REORG_DEPTH
+ */
+func (bc *BlockChain) Prune(height int, key *Wallet) (PruneReceipt, error) {
+	tip := bc.blocks.Len() - 1
+	if height > tip-MAX_REORG_DEPTH+1 {
+		return PruneReceipt{}, fmt.Errorf("cannot prune below %v, the bodies of the last %v blocks are kept for reorgs", height, MAX_REORG_DEPTH)
+	}
+	from := max(bc.pruned, 1)
+	if height <= from {
+		return PruneReceipt{}, fmt.Errorf("cannot prune below %v, blocks below %v are pruned already", height, from)
+	}
+	view, err := bc.WithHeight(height - 1)
+	if err != nil {
+		return PruneReceipt{}, err
+	}
+	mmr := bc.mmrTo(tip)
+	r := PruneReceipt{
+		GenesisHash: bc.GenesisHash(),
+		Tip:         tip,
+		TipHash:     bc.lastBlock().hash,
+		MMRRoot:     mmr.Root(),
+		MMRSize:     mmr.Size(),
+		StateRoot:   view.Root(),
+		UnixTs:      bc.now().UnixMicro(),
+		Pruner:      key.account,
+		PublicKey:   key.PublicKey(),
+		Scheme:      key.Scheme(),
+	}
+	for h := from; h < height; h++ {
+		b := bc.blockAt(h)
+		r.Blocks = append(r.Blocks, PrunedBlock{h, b.hash, b.merkleRoot, len(b.data), mmrLeafPos(h)})
+	}
+	if r.Signature, err = key.Sign(r.digest()); err != nil {
+		return PruneReceipt{}, err
+	}
+
+	// Mark the bodies pruned first, so a failing store never serves half of them
+	bc.pruned, bc.prunedState = height, view.state.clone()
+	bc.receipts = append(bc.receipts, r)
+	bc.resetCaches()
+	for _, b := range r.Blocks {
+		if err := bc.blocks.Prune(b.Height); err != nil {
+			return r, fmt.Errorf("pruning block %v: %w", b.Height, err)
+		}
+	}
+	return r, nil
+}
+
+/*
+ * Prune the bodies older than the last keep Blocks with key, when there
+ * are at least batch of them, false if there are not
+ */
+func (bc *BlockChain) pruneKeeping(keep, batch int, key *Wallet) (PruneReceipt, bool, error) {
+	height := bc.blocks.Len() - keep
+	if height-max(bc.pruned, 1) < batch {
+		return PruneReceipt{}, false, nil
+	}
+	r, err := bc.Prune(height, key)
+	return r, err == nil, err
+}
+
+// Prunes the chain of a Node as Blocks are committed
+type pruneJob struct {
+	keep int
+	key  *Wallet
+	stop chan struct{} // closed to stop pruning
+	done chan struct{} // closed when the loop exited
+}
+
+/*
+ * Run the Node as a pruned node keeping the bodies of its last keep
+ * Blocks, signing the receipts with key, until StopPruning
+ * The bodies older than that are pruned right away
+ */
+func (n *Node) StartPruning(keep int, key *Wallet) error {
+	if keep < MAX_REORG_DEPTH {
+		return fmt.Errorf("a pruned node keeps at least the last %v blocks for reorgs, not %v", MAX_REORG_DEPTH, keep)
+	}
+	n.StopPruning()
+	job := &pruneJob{keep: keep, key: key, stop: make(chan struct{}), done: make(chan struct{})}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.bc.archive != nil {
+		return errors.New("an archive node keeps every block body")
+	}
+	if _, _, err := n.bc.pruneKeeping(keep, 1, key); err != nil {
+		return err
+	}
+	n.pruning = job
+	blocks, cancel := n.events.Subscribe(NewBlock)
+	go n.runPruning(job, blocks, cancel)
+	return nil
+}
+
+// Stop pruning, a no-op if not pruning
+func (n *Node) StopPruning() {
+	n.mu.Lock()
+	job := n.pruning
+	n.pruning = nil
+	n.mu.Unlock()
+	if job != nil {
+		close(job.stop)
+		<-job.done
+	}
+}
+
+func (n *Node) runPruning(job *pruneJob, blocks <-chan Event, cancel func()) {
+	defer close(job.done)
+	defer cancel()
+	for {
+		select {
+		case <-job.stop:
+			return
+		case <-blocks:
+		}
+		n.mu.Lock()
+		r, ok, err := n.bc.pruneKeeping(job.keep, PRUNE_BATCH, job.key)
+		n.mu.Unlock()
+		if err != nil {
+			log.Printf("pruning: %v", err)
+		} else if ok {
+			log.Printf("pruned %v blocks, heights %v to %v", len(r.Blocks), r.Blocks[0].Height, r.Blocks[len(r.Blocks)-1].Height)
+		}
+	}
+}
+
+// Whether the body of the Block at height was pruned
+func (bc *BlockChain) isPruned(height int) bool {
+	return height > 0 && height < bc.pruned
+}
+
+/*
+ * Check r is signed by its pruner and matches the chain: the pruned
+ * Blocks, their MMR positions and the MMR root up to the tip of r, and the
+ * state root when the chain can replay up to the last pruned Block
+ * Fails with ErrInvalidReceipt
+ */
+func (bc *BlockChain) VerifyPruneReceipt(r PruneReceipt) error {
+	if !verifySignature(r.Scheme, r.PublicKey, r.digest(), r.Signature) {
+		return fmt.Errorf("%w: not signed by its pruner", ErrInvalidReceipt)
+	}
+	if r.GenesisHash != bc.GenesisHash() {
+		return fmt.Errorf("%w: genesis %v, expected %v", ErrInvalidReceipt, r.GenesisHash, bc.GenesisHash())
+	}
+	if r.Tip < 0 || r.Tip >= bc.blocks.Len() || bc.blockAt(r.Tip).hash != r.TipHash {
+		return fmt.Errorf("%w: tip %v at height %v is not part of the chain", ErrInvalidReceipt, r.TipHash, r.Tip)
+	}
+	mmr := bc.mmrTo(r.Tip)
+	if mmr.Root() != r.MMRRoot || mmr.Size() != r.MMRSize {
+		return fmt.Errorf("%w: MMR root %v of size %v, the chain has %v of size %v", ErrInvalidReceipt, r.MMRRoot, r.MMRSize, mmr.Root(), mmr.Size())
+	}
+	if len(r.Blocks) == 0 {
+		return fmt.Errorf("%w: no pruned block", ErrInvalidReceipt)
+	}
+	for _, p := range r.Blocks {
+		if p.Height < 1 || p.Height > r.Tip {
+			return fmt.Errorf("%w: pruned height %v outside the chain", ErrInvalidReceipt, p.Height)
+		}
+		b := bc.blockAt(p.Height)
+		switch {
+		case b.hash != p.Hash:
+			return fmt.Errorf("%w: block %v at height %v, the chain has %v", ErrInvalidReceipt, p.Hash, p.Height, b.hash)
+		case b.merkleRoot != p.MerkleRoot:
+			return fmt.Errorf("%w: merkle root %v at height %v, the chain has %v", ErrInvalidReceipt, p.MerkleRoot, p.Height, b.merkleRoot)
+		case p.MMRPos != mmrLeafPos(p.Height):
+			return fmt.Errorf("%w: MMR position %v at height %v, expected %v", ErrInvalidReceipt, p.MMRPos, p.Height, mmrLeafPos(p.Height))
+		case !bc.isPruned(p.Height) && len(b.data) != p.Txns:
+			return fmt.Errorf("%w: %v transactions at height %v, the chain has %v", ErrInvalidReceipt, p.Txns, p.Height, len(b.data))
+		}
+	}
+	last := r.Blocks[len(r.Blocks)-1].Height
+	view, err := bc.WithHeight(last)
+	if errors.Is(err, ErrPruned) {
+		return nil // pruned further since, the state root cannot be recomputed
+	}
+	if err != nil {
+		return err
+	}
+	if view.Root() != r.StateRoot {
+		return fmt.Errorf("%w: state root %v after height %v, the chain has %v", ErrInvalidReceipt, r.StateRoot, last, view.Root())
+	}
+	return nil
+}
+
+/*
+ * Prune the bodies below height with the key of account in the keystore
+ * at dir, writing the receipt to path if set, returning the exit code
+ */
+func runPrune(bc *BlockChain, height int, dir, account, path string, out *Output) int {
+	key, err := unlockPruneKey(dir, account)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	r, err := bc.Prune(height, key)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if path != "" {
+		raw, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if err := os.WriteFile(path, append(raw, '\n'), 0o644); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+	err = out.Record([][2]string{
+		{"pruned", fmt.Sprintf("%v blocks, heights %v to %v", len(r.Blocks), r.Blocks[0].Height, height-1)},
+		{"tip", fmt.Sprintf("%v %v", r.Tip, r.TipHash)},
+		{"mmr root", r.MMRRoot},
+		{"state root", r.StateRoot},
+		{"pruner", r.Pruner},
+	}, r)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// Key of account in the keystore at dir signing the receipts, see runPrune
+func unlockPruneKey(dir, account string) (*Wallet, error) {
+	ks, err := NewKeystore(dir)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	return ks.Unlock(account, passphrase)
+}
+
+// Check the receipt of the file at path against bc, returning the exit code
+func runVerifyPruneReceipt(bc *BlockChain, path string, out *Output) int {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	var r PruneReceipt
+	if err := json.Unmarshal(raw, &r); err != nil {
+		log.Printf("%v: %v", path, err)
+		return 1
+	}
+	if err := bc.VerifyPruneReceipt(r); err != nil {
+		log.Print(err)
+		return 1
+	}
+	out.Note("receipt of %v pruned blocks matches the chain up to height %v", len(r.Blocks), r.Tip)
+	return 0
+}
+
+func (s *Server) handlePruneReceipts(w http.ResponseWriter, r *http.Request) {
+	var receipts []PruneReceipt
+	s.node.withChain(func(bc *BlockChain) { receipts = append([]PruneReceipt{}, bc.receipts...) })
+	writeJSON(w, http.StatusOK, receipts)
+}
+
+func (s *Server) handlePruneVerify(w http.ResponseWriter, r *http.Request) {
+	var receipt PruneReceipt
+	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var err error
+	s.node.withChain(func(bc *BlockChain) { err = bc.VerifyPruneReceipt(receipt) })
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+}
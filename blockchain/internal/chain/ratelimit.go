@@ -0,0 +1,163 @@
+/*
+ * Rate limiting of transaction submission.
+ * A node open to a classroom gets flooded by the first script stuck in a
+ * loop. A Node set with SetRateLimits admits the transactions submitted to
+ * POST /txns and the SubmitTransaction gRPC call at most at a rate per
+ * client IP and per paying account, each a token bucket holding up to a
+ * burst of transactions and refilled at the rate. Submissions over either
+ * limit are refused with ErrRateLimited before reaching the Mempool: 429
+ * Too Many Requests with a Retry-After header over HTTP, RESOURCE_EXHAUSTED
+ * over gRPC. Transactions posted to POST /relay/{phase}, see relay.go, count
+ * against the same limits, unless relayed by a peer authenticated over
+ * Noise, see noise.go.
+ *
+ * The client IP is the remote address of the connection, so clients behind
+ * a proxy share the bucket of the proxy. See -rate-ip and -rate-account,
+ * and the fee floor of MempoolLimits for transactions too cheap to hold.
+ */
+package chain
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Buckets a limit keeps before forgetting the full ones
+const RATE_LIMIT_BUCKETS = 10_000
+
+type RateLimits struct {
+	IP           float64 // transactions a second per client IP, 0 for no limit
+	IPBurst      int     // transactions a client IP submits at once, 0 for IP rounded up
+	Account      float64 // transactions a second per paying account, 0 for no limit
+	AccountBurst int     // transactions submitted at once for an account, 0 for Account rounded up
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time // of the last refill
+}
+
+// Token buckets of one limit by key
+type bucketLimit struct {
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+}
+
+func newBucketLimit(rate float64, burst int) bucketLimit {
+	if burst == 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return bucketLimit{rate: rate, burst: burst, buckets: map[string]*tokenBucket{}}
+}
+
+// Bucket of key refilled up to now, nil without limit
+func (l bucketLimit) bucket(key string, now time.Time) *tokenBucket {
+	if l.rate == 0 {
+		return nil
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= RATE_LIMIT_BUCKETS {
+			l.forgetFull(now)
+		}
+		b = &tokenBucket{tokens: float64(l.burst), at: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(l.burst), b.tokens+now.Sub(b.at).Seconds()*l.rate)
+	b.at = now
+	return b
+}
+
+// Drop the buckets refilled to the burst by now, new ones starting full anyway
+func (l bucketLimit) forgetFull(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.at).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Wait until b holds a token, 0 if it does
+func (l bucketLimit) wait(b *tokenBucket) time.Duration {
+	if b == nil || b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	limits  RateLimits
+	ip      bucketLimit
+	account bucketLimit
+}
+
+/*
+ * Take a token of ip and of account at now, or none and fail with
+ * ErrRateLimited along with the wait until both hold one
+ */
+func (l *rateLimiter) take(ip, account string, now time.Time) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ipBucket, accountBucket := l.ip.bucket(ip, now), l.account.bucket(account, now)
+	if wait := l.ip.wait(ipBucket); wait > 0 {
+		return max(wait, l.account.wait(accountBucket)), fmt.Errorf("%w: client %v submits over %v transactions a second", ErrRateLimited, ip, l.limits.IP)
+	}
+	if wait := l.account.wait(accountBucket); wait > 0 {
+		return wait, fmt.Errorf("%w: %v pays for over %v transactions a second", ErrRateLimited, account, l.limits.Account)
+	}
+	for _, b := range []*tokenBucket{ipBucket, accountBucket} {
+		if b != nil {
+			b.tokens--
+		}
+	}
+	return 0, nil
+}
+
+// Limit the transactions clients submit to the Node, the zero RateLimits lifting the limits
+func (n *Node) SetRateLimits(limits RateLimits) error {
+	if limits.IP < 0 || limits.IPBurst < 0 || limits.Account < 0 || limits.AccountBurst < 0 {
+		return fmt.Errorf("negative rate limits %+v", limits)
+	}
+	var l *rateLimiter
+	if limits.IP > 0 || limits.Account > 0 {
+		l = &rateLimiter{
+			limits:  limits,
+			ip:      newBucketLimit(limits.IP, limits.IPBurst),
+			account: newBucketLimit(limits.Account, limits.AccountBurst),
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.limiter = l
+	return nil
+}
+
+/*
+ * Count txn, submitted by the client of r, against the rate limits of the
+ * Node, failing with the wait until it fits when over them
+ */
+func (n *Node) rateLimit(r *http.Request, txn Transaction) (time.Duration, error) {
+	n.mu.Lock()
+	l := n.limiter
+	n.mu.Unlock()
+	if l == nil {
+		return 0, nil
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return l.take(ip, txn.payer, time.Now())
+}
+
+// Retry-After header of a submission refused for wait
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,175 @@
+/*
+ * Transaction receipts.
+ * As a Block is committed, each of its transactions gets a receipt: where
+ * it landed, the fee and gas it paid, and the balances it left to the
+ * accounts it involves, those it changed, so a client confirms what a
+ * transaction did without replaying the chain. A Block holding a
+ * transaction that fails is refused whole, so every committed transaction
+ * was applied; GET /receipts tells those from the ones still pending in
+ * the Mempool. The balances are taken right after the transaction, before
+ * the miner collects the fees of the Block.
+ *
+ * Receipts are kept in memory by transaction hash, built as Blocks are
+ * committed from genesis on and cut back with the chain on a
+ * reorganization, like the address index. They outlive the bodies of
+ * pruned Blocks. Genesis allocations get none.
+ *
+ *	GET /receipts/{hash}  receipt of a transaction, committed or pending
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// Statuses of a receipt
+const (
+	RECEIPT_APPLIED = "applied" // committed in a Block
+	RECEIPT_PENDING = "pending" // waiting in the Mempool
+)
+
+type TxnReceipt struct {
+	Hash          string `json:"hash"` // of the transaction
+	Status        string `json:"status"`
+	Block         string `json:"block,omitempty"` // hash
+	Height        int    `json:"height,omitempty"`
+	Index         int    `json:"index"` // in the Block
+	Confirmations int    `json:"confirmations,omitempty"`
+	Final         bool   `json:"final,omitempty"` // see finality.go
+	Fee           Amount `json:"fee"`
+	FeeAsset      string `json:"feeAsset,omitempty"` // empty for the chain's coin
+	Gas           uint64 `json:"gas"`
+
+	// Balances changed by the transaction, by account then asset, empty for the chain's coin
+	Balances map[string]map[string]Amount `json:"balances,omitempty"`
+	Outputs  []string                     `json:"outputs,omitempty"` // IDs of the UTXO outputs created
+}
+
+// Receipts of the committed transactions by hash
+type receiptIndex map[string]TxnReceipt
+
+/*
+ * Receipts of the transactions of b, the Block at height, applying them in
+ * order on a copy of s, the state before b
+ */
+func (s *State) receipts(height int, b Block) []TxnReceipt {
+	state := s.clone()
+	receipts := []TxnReceipt{}
+	for i, txn := range b.data {
+		accounts := txn.directions()
+		before := map[string]map[string]Amount{}
+		for account := range accounts {
+			before[account] = maps.Clone(state.balances[account])
+		}
+		if err := state.apply(txn); err != nil {
+			// b was validated when appended, this would be a bug
+			log.Printf("receipts: transaction %v of block %v: %v", txn.Hash(), b.hash, err)
+			break
+		}
+		r := TxnReceipt{
+			Hash:     txn.Hash(),
+			Status:   RECEIPT_APPLIED,
+			Block:    b.hash,
+			Height:   height,
+			Index:    i,
+			Fee:      txn.totalFee(),
+			FeeAsset: txn.feeAsset,
+			Gas:      txn.gas(),
+			Balances: map[string]map[string]Amount{},
+		}
+		for account := range accounts {
+			after := state.balances[account]
+			for asset := range after {
+				if after[asset] != before[account][asset] {
+					if r.Balances[account] == nil {
+						r.Balances[account] = map[string]Amount{}
+					}
+					r.Balances[account][asset] = after[asset]
+				}
+			}
+		}
+		if txn.utxo != nil {
+			for n := range txn.utxo.outputs {
+				r.Outputs = append(r.Outputs, utxoID(r.Hash, n))
+			}
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts
+}
+
+func (idx receiptIndex) add(receipts []TxnReceipt) {
+	for _, r := range receipts {
+		idx[r.Hash] = r
+	}
+}
+
+// Drop the receipts of the Blocks from height on, see reorg.go
+func (idx receiptIndex) truncate(height int) {
+	maps.DeleteFunc(idx, func(_ string, r TxnReceipt) bool { return r.Height >= height })
+}
+
+/*
+ * Receipt of the transaction with hash, committed or pending in the
+ * Mempool, false if neither
+ */
+func (bc *BlockChain) Receipt(hash string) (TxnReceipt, bool) {
+	if r, ok := bc.txnReceipts[hash]; ok {
+		r.Confirmations = bc.confirmations(r.Height)
+		r.Final = r.Confirmations >= FINALITY_DEPTH
+		return r, true
+	}
+	for _, txn := range bc.mempool.held() {
+		if txn.Hash() == hash {
+			return TxnReceipt{Hash: hash, Status: RECEIPT_PENDING, Fee: txn.totalFee(), FeeAsset: txn.feeAsset, Gas: txn.gas()}, true
+		}
+	}
+	return TxnReceipt{}, false
+}
+
+// Print the receipt of the transaction with hash, returning the exit code
+func runReceipt(bc *BlockChain, hash string, out *Output) int {
+	r, ok := bc.Receipt(hash)
+	if !ok {
+		log.Printf("transaction %v not found", hash)
+		return 1
+	}
+	fields := [][2]string{{"hash", r.Hash}, {"status", r.Status}}
+	if r.Status == RECEIPT_APPLIED {
+		fields = append(fields,
+			[2]string{"block", fmt.Sprintf("%v at height %v, index %v", r.Block, r.Height, r.Index)},
+			[2]string{"confirmations", fmt.Sprint(r.Confirmations)},
+		)
+	}
+	fields = append(fields, [2]string{"fee", fmt.Sprintf("%v%v", r.Fee, assetSuffix(r.FeeAsset))}, [2]string{"gas", fmt.Sprint(r.Gas)})
+	for _, account := range sortedKeys(r.Balances) {
+		balances := []string{}
+		for _, asset := range sortedKeys(r.Balances[account]) {
+			balances = append(balances, fmt.Sprintf("%v%v", r.Balances[account][asset], assetSuffix(asset)))
+		}
+		fields = append(fields, [2]string{"balance of " + account, strings.Join(balances, ", ")})
+	}
+	if len(r.Outputs) > 0 {
+		fields = append(fields, [2]string{"outputs", strings.Join(r.Outputs, " ")})
+	}
+	if err := out.Record(fields, r); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	var receipt TxnReceipt
+	found := false
+	s.node.withChain(func(bc *BlockChain) { receipt, found = bc.Receipt(r.PathValue("hash")) })
+	if !found {
+		writeError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, receipt)
+}
@@ -0,0 +1,207 @@
+/*
+ * Application-defined records.
+ * A TxnRecord carries a record of a schema the application defines, eg. a
+ * supply chain event or a ballot, so the chain mechanics, ordering, proof
+ * of work, signatures, nonces and fees, serve other ledgers than payments
+ * without forking the core. A schema is a Go type implementing Record,
+ * registered under its name with RegisterRecord:
+ *
+ *	type Shipment struct {
+ *		Lot  string `json:"lot"`
+ *		Site string `json:"site"`
+ *	}
+ *
+ *	func (s Shipment) Validate(payer string, nonce uint64, state *StateView) error { .. }
+ *
+ *	RegisterRecord[Shipment](&bc, "shipment")
+ *	txn, err := NewRecord("alice", nonce, "shipment", Shipment{"42", "Lyon"})
+ *
+ * The record travels as the canonical JSON of the type, which the
+ * transaction hash covers, so the hash of the transaction identifies the
+ * record. Nodes decode the records of the schemas they registered and run
+ * their Validate against the state before the Block, as they run the
+ * Validators, see validator.go, and refuse the records of schemas they do
+ * not know: every node of a chain must register the same schemas, lest
+ * they fork, so the applications built in, eg. voting.go, are best
+ * enabled in the genesis spec, which makes them part of the genesis hash.
+ * Records change no state but the nonce and fees of their payer; an
+ * application keeps its own, eg. the tally of a vote, by folding the
+ * records of the chain read with Records.
+ *
+ *	GET /records/{schema}?from=..  records of a schema from a height on
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Max bytes of the name of a schema and of the JSON of a record
+const (
+	MAX_RECORD_SCHEMA_SIZE = 32
+	MAX_RECORD_SIZE        = 1024
+)
+
+// Gas of a record, plus GAS_RECORD_BYTE per byte of schema and JSON
+const GAS_RECORD = 20_000
+const GAS_RECORD_BYTE = 16
+
+// Most records GET /records returns
+const MAX_RECORDS = 100
+
+// Applications built in, enabled by name in the genesis spec
+var RECORD_APPS = map[string]func(bc *BlockChain){
+	APP_VOTING: registerVoting,
+}
+
+// Application-defined content of a TxnRecord, encoded as JSON
+type Record interface {
+	// Check the record sent by payer with nonce against the state it applies to, the error saying why it is refused
+	Validate(payer string, nonce uint64, state *StateView) error
+}
+
+type RecordTxn struct {
+	schema  string
+	payload []byte // canonical JSON of the record
+}
+
+// Decoder of the records of a schema registered with RegisterRecord
+type recordSchema func(payload []byte) (Record, error)
+
+/*
+ * Accept the records of schema, decoded as T, from now on. Registering a
+ * schema again replaces its type
+ */
+func RegisterRecord[T Record](bc *BlockChain, schema string) {
+	if bc.records == nil {
+		bc.records = map[string]recordSchema{}
+	}
+	bc.records[schema] = func(payload []byte) (Record, error) {
+		return decodeRecord[T](payload)
+	}
+}
+
+// Record of schema sent by payer
+func NewRecord[T Record](payer string, nonce uint64, schema string, record T) (Transaction, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("record of %v: %w", schema, err)
+	}
+	return Transaction{
+		kind:   TxnRecord,
+		payer:  payer,
+		nonce:  nonce,
+		record: &RecordTxn{schema: schema, payload: payload},
+	}, nil
+}
+
+// Record carried by txn, decoded as T
+func DecodeRecord[T Record](txn Transaction) (T, error) {
+	if txn.kind != TxnRecord || txn.record == nil {
+		var zero T
+		return zero, errors.New("not a record")
+	}
+	return decodeRecord[T](txn.record.payload)
+}
+
+// T encoded in payload, which must be its canonical JSON, without unknown fields
+func decodeRecord[T Record](payload []byte) (T, error) {
+	var record T
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&record); err != nil {
+		return record, err
+	}
+	if canonical, err := json.Marshal(record); err != nil || !bytes.Equal(canonical, payload) {
+		return record, errors.New("record is not in canonical JSON, as encoded by NewRecord")
+	}
+	return record, nil
+}
+
+/*
+ * JSON of payload as the JSON encoders output it, compact and HTML
+ * escaped, payload itself if not JSON. An indented export keeps the
+ * records of its transactions
+ */
+func compactRecord(payload []byte) []byte {
+	var compact, escaped bytes.Buffer
+	if err := json.Compact(&compact, payload); err != nil {
+		return payload
+	}
+	json.HTMLEscape(&escaped, compact.Bytes())
+	return escaped.Bytes()
+}
+
+func (r *RecordTxn) gas() uint64 {
+	if r == nil {
+		return GAS_RECORD
+	}
+	return GAS_RECORD + GAS_RECORD_BYTE*uint64(len(r.schema)+len(r.payload))
+}
+
+func (r *RecordTxn) verify() error {
+	if r.schema == "" || len(r.schema) > MAX_RECORD_SCHEMA_SIZE {
+		return fmt.Errorf("schema must be 1 to %v bytes", MAX_RECORD_SCHEMA_SIZE)
+	}
+	if len(r.payload) > MAX_RECORD_SIZE {
+		return fmt.Errorf("record must be at most %v bytes", MAX_RECORD_SIZE)
+	}
+	if !json.Valid(r.payload) || !bytes.Equal(compactRecord(r.payload), r.payload) {
+		return errors.New("record is not compact JSON")
+	}
+	return nil
+}
+
+func (r *RecordTxn) String() string {
+	return fmt.Sprintf("%v %s", r.schema, r.payload)
+}
+
+// Decode the record of txn by its schema and run its Validate against state
+func (bc *BlockChain) validateRecord(txn Transaction, state *StateView) error {
+	decode, ok := bc.records[txn.record.schema]
+	if !ok {
+		return fmt.Errorf("unknown record schema %q", txn.record.schema)
+	}
+	record, err := decode(txn.record.payload)
+	if err != nil {
+		return fmt.Errorf("record of %v: %w", txn.record.schema, err)
+	}
+	return record.Validate(txn.payer, txn.nonce, state)
+}
+
+type ChainRecord struct {
+	Height int             `json:"height"`
+	UnixTs int64           `json:"unixTs"` // of the Block, unix microseconds
+	Hash   string          `json:"hash"`   // of the transaction
+	Payer  string          `json:"payer"`
+	Record json.RawMessage `json:"record"`
+}
+
+/*
+ * Records of schema committed from height from on, at most MAX_RECORDS,
+ * skipping the Blocks whose body was pruned
+ */
+func (bc *BlockChain) Records(schema string, from int) []ChainRecord {
+	records := []ChainRecord{}
+	for height := max(from, bc.pruned, 1); height < bc.blocks.Len() && len(records) < MAX_RECORDS; height++ {
+		b := bc.blockAt(height)
+		for _, txn := range b.data {
+			if txn.kind == TxnRecord && txn.record.schema == schema && len(records) < MAX_RECORDS {
+				records = append(records, ChainRecord{height, b.unixTs, txn.Hash(), txn.payer, txn.record.payload})
+			}
+		}
+	}
+	return records
+}
+
+func (s *Server) handleRecords(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	var records []ChainRecord
+	s.node.withChain(func(bc *BlockChain) { records = bc.Records(r.PathValue("schema"), from) })
+	writeJSON(w, http.StatusOK, records)
+}
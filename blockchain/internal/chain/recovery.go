@@ -0,0 +1,176 @@
+/*
+ * Disaster recovery.
+ * The state is never stored, it is derived from the Blocks: after a crash
+ * the Blocks moved to cold storage survive, while the hot Blocks and the
+ * state are gone. Recovery replays the surviving Blocks from genesis,
+ * validating each like an imported one, and fetches the Blocks missing
+ * locally or failing validation from a peer's HTTP API. Peer Blocks go
+ * through the same validation and must extend the recovered chain, so a
+ * bad peer can stop recovery but cannot corrupt it. Blocks taken from the
+ * peer are written back to cold storage as they age like any other Block.
+ * With a write-ahead log every committed Block survives, with the state
+ * root it led to, which the replayed state must match, see wal.go.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type RecoveryReport struct {
+	FromStore int    // Blocks replayed from cold storage
+	FromPeer  []int  // heights of the Blocks fetched from the peer
+	Stop      string // why recovery stopped at the last Block
+	StateRoot string // root of the recovered state
+}
+
+// Client of the HTTP API of another node
+type peerClient struct {
+	url    string
+	client *http.Client
+	token  string // bearer token of the requests when set, see signer.go
+}
+
+func newPeerClient(url string) *peerClient {
+	return &peerClient{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: 30 * time.Second, Transport: helloTransport{}},
+	}
+}
+
+/*
+ * Body of the reply to GET path, asking for the binary encoding, which
+ * the peer may or may not use, see codec.go
+ */
+func (p *peerClient) getBinary(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", BINARY_CONTENT_TYPE+", application/json")
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Decode the JSON reply to GET path into v, false if the peer answers 404
+func (p *peerClient) get(path string, v any) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, p.url+path, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET %v: %v", path, resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *peerClient) do(req *http.Request) (*http.Response, error) {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return p.client.Do(req)
+}
+
+// Genesis spec of the peer along with the hash it claims for it
+func (p *peerClient) genesis() (Genesis, string, error) {
+	var reply struct {
+		Spec Genesis `json:"spec"`
+		Hash string  `json:"hash"`
+	}
+	if _, err := p.get("/genesis", &reply); err != nil {
+		return Genesis{}, "", err
+	}
+	return reply.Spec, reply.Hash, nil
+}
+
+// Block at height, false if the peer's chain is shorter
+func (p *peerClient) block(height int) (Block, bool, error) {
+	var detail jsonBlockDetail
+	found, err := p.get(fmt.Sprintf("/blocks/%v", height), &detail)
+	if err != nil || !found {
+		return Block{}, found, err
+	}
+	return detail.block(), true, nil
+}
+
+/*
+ * Rebuild the chain of genesis from the Blocks in cold, keeping the last
+ * hotBlocks in memory, and filling the gaps from peer when it is set.
+ * cold may be nil to fetch every Block from peer
+ * Recovery stops at the first Block neither source provides
+ */
+func RecoverChain(genesis Genesis, cold ObjectStore, hotBlocks int, peer string) (BlockChain, RecoveryReport, error) {
+	var report RecoveryReport
+	bc := CreateBlockChain(genesis)
+	if cold != nil {
+		if err := bc.SetColdStorage(cold, hotBlocks); err != nil {
+			return BlockChain{}, report, err
+		}
+	}
+	var p *peerClient
+	if peer != "" {
+		p = newPeerClient(peer)
+		_, hash, err := p.genesis()
+		if err != nil {
+			return BlockChain{}, report, fmt.Errorf("peer %v: %w", peer, err)
+		}
+		if hash != bc.GenesisHash() {
+			return BlockChain{}, report, fmt.Errorf("peer %v has genesis %v, expected %v", peer, hash, bc.GenesisHash())
+		}
+	}
+
+	for height := 1; ; height++ {
+		localErr := fmt.Errorf("no cold storage")
+		if cold != nil {
+			var b Block
+			if b, localErr = readColdBlock(cold, height); localErr == nil {
+				localErr = bc.appendBlock(b)
+			}
+			if localErr == nil {
+				if err := bc.checkCommittedState(cold, height); err != nil {
+					return BlockChain{}, report, err
+				}
+				report.FromStore++
+				continue
+			}
+		}
+		if p == nil {
+			report.Stop = localErr.Error()
+			break
+		}
+		b, found, err := p.block(height)
+		if err != nil {
+			return BlockChain{}, report, fmt.Errorf("fetching block %v from peer: %w", height, err)
+		}
+		if !found {
+			report.Stop = fmt.Sprintf("%v; peer has no block %v either", localErr, height)
+			break
+		}
+		if err := bc.appendBlock(b); err != nil {
+			return BlockChain{}, report, fmt.Errorf("block %v from peer: %w", height, err)
+		}
+		report.FromPeer = append(report.FromPeer, height)
+	}
+	report.StateRoot = bc.state.Root()
+	return bc, report, nil
+}
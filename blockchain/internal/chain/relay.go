@@ -0,0 +1,257 @@
+/*
+ * Transaction relay between nodes.
+ * A Node with relay peers forwards the transactions it admits to them over
+ * their HTTP API. By default every transaction is flooded: each node
+ * sends it to all its peers as soon as it admits it. An observer connected
+ * to many nodes then tells the node a transaction came from with good odds,
+ * it being the first to announce it.
+ *
+ * Dandelion hides the origin by relaying in two phases. In the stem phase
+ * a transaction is passed along a random path, each node sending it to a
+ * single stem peer without admitting it, until a node flips a coin coming
+ * up fluff with FLUFF_PROBABILITY. That node admits and floods it like any
+ * other, the fluff phase, and is the one observers see first. A stem node
+ * whose transaction is not fluffed within the embargo, because a node on
+ * the path dropped it, fluffs it itself.
+ *
+ *	POST /relay/stem   transaction in its stem phase
+ *	POST /relay/fluff  transaction being flooded
+ *
+ * The effect on the odds of the observer is measured by SimulateRelay.
+ * Blocks are relayed compact, see compactblock.go.
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FLUFF_PROBABILITY = 0.1              // chance of a stem hop turning into fluff
+	STEM_EMBARGO      = 30 * time.Second // stem transactions fluffed after that long
+	STEM_EPOCH        = 10 * time.Minute // lifetime of the choice of stem peer
+)
+
+type RelayConfig struct {
+	Peers            []string      // node API URLs of the relay peers, see peers.go to change them
+	Dandelion        bool          // stem transactions before flooding them
+	FluffProbability float64       // defaults to FLUFF_PROBABILITY
+	Embargo          time.Duration // defaults to STEM_EMBARGO
+	RequireNoise     bool          // refuse transactions relayed over plaintext HTTP, see noise.go
+	Blocks           string        // how committed Blocks are pushed, BLOCK_RELAY_COMPACT unless set, see compactblock.go
+}
+
+type relay struct {
+	config RelayConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	stemPeer  string
+	stemUntil time.Time            // end of the epoch of stemPeer
+	stems     map[string]struct{}  // hashes of the stem transactions seen
+	peers     map[string]*PeerInfo // status of config.Peers by URL, see peers.go
+
+	stopBlocks func()                      // ends the push of Blocks, see compactblock.go
+	blockStats BlockRelayStats             // spent pushing Blocks
+	partial    map[string]jsonCompactBlock // compact Blocks missing transactions by hash
+}
+
+// Relay the transactions the Node admits and the Blocks it commits to the peers of config
+func (n *Node) SetRelay(config RelayConfig) {
+	r := newRelay(config)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.setRelay(r)
+}
+
+func newRelay(config RelayConfig) *relay {
+	if config.FluffProbability == 0 {
+		config.FluffProbability = FLUFF_PROBABILITY
+	}
+	if config.Embargo == 0 {
+		config.Embargo = STEM_EMBARGO
+	}
+	for i, peer := range config.Peers {
+		config.Peers[i] = strings.TrimSuffix(peer, "/")
+	}
+	r := &relay{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: helloTransport{}},
+		stems:  map[string]struct{}{},
+		peers:  map[string]*PeerInfo{},
+	}
+	for _, peer := range config.Peers {
+		r.peers[peer] = newPeerInfo(peer)
+	}
+	return r
+}
+
+func (n *Node) relayer() *relay {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.relay
+}
+
+// Whether transactions of clients start with a stem phase
+func (r *relay) stemming() bool {
+	return r != nil && r.config.Dandelion && len(r.peerURLs()) > 0
+}
+
+// Stem peer of the current epoch, a new one if it was removed, empty without peers
+func (r *relay) nextHop() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.config.Peers) == 0 {
+		return ""
+	}
+	if time.Now().After(r.stemUntil) || r.peers[r.stemPeer] == nil {
+		r.stemPeer = r.config.Peers[rand.IntN(len(r.config.Peers))]
+		r.stemUntil = time.Now().Add(STEM_EPOCH)
+	}
+	return r.stemPeer
+}
+
+// POST txn to path of peer in the binary encoding, see codec.go
+func (r *relay) send(peer, path string, txn Transaction) error {
+	return r.postBody(peer, path, BINARY_CONTENT_TYPE, EncodeTxn(txn))
+}
+
+// POST v as JSON to path of peer
+func (r *relay) post(peer, path string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.postBody(peer, path, "application/json", body)
+}
+
+func (r *relay) postBody(peer, path, contentType string, body []byte) error {
+	resp, err := r.client.Post(peer+path, contentType, bytes.NewReader(body))
+	r.seen(peer, err)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %v%v: %v", peer, path, resp.Status)
+	}
+	return nil
+}
+
+/*
+ * Pass txn on in its stem phase, unless the coin says fluff or fromPeer
+ * is false, the origin always stemming. Repeated stem transactions are
+ * dropped, which breaks loops
+ */
+func (n *Node) stemTxn(txn Transaction, fromPeer bool) error {
+	if err := invalidTxn(txn.verify()); err != nil {
+		return err
+	}
+	r := n.relayer()
+	if fromPeer && rand.Float64() < r.config.FluffProbability {
+		return n.fluffTxn(txn)
+	}
+	hash := txn.Hash()
+	r.mu.Lock()
+	_, seen := r.stems[hash]
+	r.stems[hash] = struct{}{}
+	r.mu.Unlock()
+	if seen {
+		return nil
+	}
+	time.AfterFunc(r.config.Embargo, func() {
+		// Fails harmlessly if the transaction was fluffed meanwhile
+		if err := n.fluffTxn(txn); err == nil {
+			log.Printf("relay: embargo of %v expired, fluffed it", hash)
+		}
+		r.mu.Lock()
+		delete(r.stems, hash)
+		r.mu.Unlock()
+	})
+	go func() {
+		if err := r.send(r.nextHop(), "/relay/stem", txn); err != nil {
+			log.Printf("relay: stem of %v: %v, fluffing it", txn.Hash(), err)
+			n.fluffTxn(txn)
+		}
+	}()
+	return nil
+}
+
+// Admit txn and flood it to the relay peers, if it is new
+func (n *Node) fluffTxn(txn Transaction) error {
+	n.mu.Lock()
+	err := n.bc.AddTxn(txn)
+	if err == nil {
+		n.sealPending()
+	}
+	var alert Alert
+	doubleSpend := false
+	if errors.Is(err, ErrNonceTaken) || errors.Is(err, ErrInvalidNonce) {
+		alert, doubleSpend = n.bc.doubleSpend(txn)
+	}
+	r := n.relay
+	n.mu.Unlock()
+	if doubleSpend {
+		n.raiseAlert(alert)
+	}
+	if err != nil || r == nil {
+		return err
+	}
+	for _, peer := range r.peerURLs() {
+		go func() {
+			if err := r.send(peer, "/relay/fluff", txn); err != nil {
+				log.Printf("relay: fluff of %v: %v", txn.Hash(), err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (s *Server) handleRelay(w http.ResponseWriter, r *http.Request) {
+	phase := r.PathValue("phase")
+	if phase != "stem" && phase != "fluff" {
+		writeError(w, http.StatusNotFound, "unknown relay phase")
+		return
+	}
+	txn, err := readTxn(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Peers authenticated over Noise are trusted, anyone else posts like to POST /txns
+	if noisePeerKey(r.Context()) == nil {
+		if wait, err := s.node.rateLimit(r, txn); err != nil {
+			setRetryAfter(w, wait)
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+	}
+	if s.node.IsReplica() || s.node.relayer() == nil {
+		err = ErrRelayDisabled
+	} else if s.node.relayer().config.RequireNoise && noisePeerKey(r.Context()) == nil {
+		err = ErrPlaintextPeer
+	} else if phase == "stem" && s.node.relayer().stemming() {
+		err = s.node.stemTxn(txn, true)
+	} else {
+		// Nodes without Dandelion fluff the stem transactions they get
+		err = s.node.fluffTxn(txn)
+	}
+	if errors.Is(err, ErrInvalidNonce) || errors.Is(err, ErrNonceTaken) {
+		// Known already or conflicting with a known one, the flood stops here
+		err = nil
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, txn.toJSON())
+}
@@ -0,0 +1,42 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Relay posts of clients not authenticated over Noise count against the rate limits
+func TestRelayRateLimited(t *testing.T) {
+	tc := NewTestChain(1, TestGenesis(4))
+	node := NewNode(tc.Chain())
+	node.SetRelay(RelayConfig{})
+	if err := node.SetRateLimits(RateLimits{IP: 0.001, IPBurst: 3}); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(node)
+	txns := tc.RandomTxns(10)
+	if len(txns) < 5 {
+		t.Fatalf("%v random transactions", len(txns))
+	}
+	for i, txn := range txns {
+		body, err := json.Marshal(txn.toJSON())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/relay/fluff", bytes.NewReader(body)))
+		expected := http.StatusAccepted
+		if i >= 3 {
+			expected = http.StatusTooManyRequests
+		}
+		if rec.Code != expected {
+			t.Fatalf("relay post %v answered %v %s, expected %v", i, rec.Code, rec.Body, expected)
+		}
+		if i >= 3 && rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("relay post %v refused without Retry-After", i)
+		}
+	}
+}
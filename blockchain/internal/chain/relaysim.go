@@ -0,0 +1,152 @@
+/*
+ * Simulation of the transaction relay of relay.go.
+ * Nodes are linked to random relay peers, every message taking a random
+ * time to cross a link. A spy connected to every node notes which node
+ * announces each transaction first and guesses it is its origin. With
+ * flooding the origin is the first to announce, give or take the latency
+ * of the links, so the spy is right far more often than by chance. With
+ * Dandelion the first to announce is the end of the stem, about
+ * 1/FLUFF_PROBABILITY random hops away.
+ */
+package chain
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// Mean time for a message to cross a link, in milliseconds
+const RELAY_SIM_LATENCY = 100.0
+
+type RelaySimConfig struct {
+	Nodes            int
+	Degree           int // relay peers each node picks, links go both ways
+	Dandelion        bool
+	FluffProbability float64 // defaults to FLUFF_PROBABILITY
+	Trials           int     // transactions relayed, each from a random node
+	Seed             uint64
+}
+
+type RelaySimResult struct {
+	Precision float64 // share of transactions whose origin the spy guessed
+	StemHops  float64 // mean length of the stem phase
+}
+
+func DefaultRelaySimConfig(dandelion bool) RelaySimConfig {
+	return RelaySimConfig{Nodes: 100, Degree: 4, Dandelion: dandelion, Trials: 2000, Seed: 1}
+}
+
+func SimulateRelay(cfg RelaySimConfig) RelaySimResult {
+	if cfg.FluffProbability == 0 {
+		cfg.FluffProbability = FLUFF_PROBABILITY
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	peers := relaySimGraph(rng, cfg.Nodes, cfg.Degree)
+	// Stem peer of each node for the epoch
+	stem := make([]int, cfg.Nodes)
+	for v := range stem {
+		stem[v] = peers[v][rng.IntN(len(peers[v]))]
+	}
+	latency := func() float64 { return rng.ExpFloat64() * RELAY_SIM_LATENCY }
+
+	var result RelaySimResult
+	correct, hops := 0, 0
+	for range cfg.Trials {
+		origin := rng.IntN(cfg.Nodes)
+		fluff := origin
+		if cfg.Dandelion {
+			// The origin always stems, each next node fluffs with FluffProbability
+			fluff = stem[origin]
+			hops++
+			for rng.Float64() >= cfg.FluffProbability {
+				fluff = stem[fluff]
+				hops++
+			}
+		}
+		arrival := relaySimFlood(peers, fluff, latency)
+		guess, first := -1, math.Inf(1)
+		for v, at := range arrival {
+			if at += latency(); at < first {
+				guess, first = v, at
+			}
+		}
+		if guess == origin {
+			correct++
+		}
+	}
+	result.Precision = float64(correct) / float64(cfg.Trials)
+	result.StemHops = float64(hops) / float64(cfg.Trials)
+	return result
+}
+
+// Random graph of n nodes each linked to degree others at least
+func relaySimGraph(rng *rand.Rand, n, degree int) [][]int {
+	linked := make([]map[int]bool, n)
+	for v := range linked {
+		linked[v] = map[int]bool{}
+	}
+	for v := range n {
+		for len(linked[v]) < min(degree, n-1) {
+			if u := rng.IntN(n); u != v {
+				linked[v][u], linked[u][v] = true, true
+			}
+		}
+	}
+	peers := make([][]int, n)
+	for v := range peers {
+		for u := range n {
+			if linked[v][u] {
+				peers[v] = append(peers[v], u)
+			}
+		}
+	}
+	return peers
+}
+
+// Time each node gets a transaction flooded from source, +Inf if never
+func relaySimFlood(peers [][]int, source int, latency func() float64) []float64 {
+	arrival := make([]float64, len(peers))
+	for v := range arrival {
+		arrival[v] = math.Inf(1)
+	}
+	arrival[source] = 0
+	done := make([]bool, len(peers))
+	for {
+		v := -1
+		for u := range arrival {
+			if !done[u] && !math.IsInf(arrival[u], 1) && (v < 0 || arrival[u] < arrival[v]) {
+				v = u
+			}
+		}
+		if v < 0 {
+			return arrival
+		}
+		done[v] = true
+		for _, u := range peers[v] {
+			if !done[u] {
+				arrival[u] = min(arrival[u], arrival[v]+latency())
+			}
+		}
+	}
+}
+
+// Print how often the spy finds the origin with and without Dandelion
+func printRelaySim(out *Output) error {
+	flood := DefaultRelaySimConfig(false)
+	out.Note("%v transactions relayed by %v nodes of at least %v peers, a spy listening to every node",
+		flood.Trials, flood.Nodes, flood.Degree)
+	type jsonRun struct {
+		Relay     string  `json:"relay"`
+		Precision float64 `json:"precision"`
+		StemHops  float64 `json:"stemHops"`
+	}
+	rows, view := [][]string{}, []jsonRun{}
+	for _, dandelion := range []bool{false, true} {
+		result := SimulateRelay(DefaultRelaySimConfig(dandelion))
+		run := jsonRun{map[bool]string{false: "flooding", true: "dandelion"}[dandelion], result.Precision, result.StemHops}
+		rows = append(rows, []string{run.Relay, fmt.Sprintf("%.1f%%", 100*run.Precision), fmt.Sprintf("%.1f", run.StemHops)})
+		view = append(view, run)
+	}
+	return out.Table([]string{"relay", "origin found", "stem hops"}, rows, view)
+}
@@ -0,0 +1,289 @@
+/*
+ * Chain reorganizations.
+ * Two miners finding a Block at about the same height fork the chain, and
+ * each node follows the branch it heard of first. Once one branch carries
+ * more work, nodes on the other switch to it: Reorg drops their Blocks
+ * past the fork, rolls the state back to the fork Block, replaying from
+ * the nearest archived state like WithHeight does, and appends the Blocks
+ * of the branch, validating each like an imported one. A branch with an
+ * invalid Block leaves the chain as it was.
+ *
+ * The transactions of the dropped Blocks that the branch does not carry
+ * go back to the Mempool, unless the branch spent their nonce, and every
+ * dropped Block and transaction is published on the event bus, so that
+ * watches and wallets learn about payments undone:
+ *
+ *	reverted-block  a dropped Block, with the changes undoing it
+ *	reverted-txn    a transaction of a dropped Block the branch lacks
+ *
+ * The dropped Blocks are kept as orphans, see orphans.go.
+ *
+ * Blocks deeper than MAX_REORG_DEPTH, or moved to cold storage, are never
+ * reverted: Sync looks for forks within that depth only.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+)
+
+// Blocks past which the chain never reorganizes
+const MAX_REORG_DEPTH = 100
+
+// Expected number of hashes to mine the Blocks past height
+func (bc *BlockChain) workAfter(height int) float64 {
+	work := 0.0
+	for h := height + 1; h < bc.blocks.Len(); h++ {
+		work += math.Pow(16, float64(bc.blockAt(h).difficulty))
+	}
+	return work
+}
+
+/*
+ * Replace the Blocks past the one at height fork with branch, which must
+ * extend it and carry more work
+ * Fails with ErrInvalidPrevHash if branch does not extend the Block at
+ * fork, ErrLighterBranch if it does not carry more work, ErrCheckpoint if
+ * fork is below the last checkpoint, and with the failure of its first
+ * invalid Block, the chain being left as it was. The Blocks of branch pass
+ * the checks needing no state, eg. their Proof Of Work, before the chain
+ * is rolled back
+ */
+func (bc *BlockChain) Reorg(fork int, branch []Block) error {
+	tip := bc.blocks.Len() - 1
+	if fork < 0 || fork > tip || tip-fork > MAX_REORG_DEPTH {
+		return fmt.Errorf("cannot fork at height %v of %v, at most %v blocks deep", fork, tip, MAX_REORG_DEPTH)
+	}
+	if len(branch) == 0 || branch[0].prevHash != bc.blockAt(fork).hash {
+		return fmt.Errorf("%w: branch does not fork from block %v", ErrInvalidPrevHash, fork)
+	}
+	if last := bc.checkpoints.last(); fork < last {
+		return fmt.Errorf("%w: cannot fork at height %v, below the checkpoint at %v", ErrCheckpoint, fork, last)
+	}
+	// Garbage must not cost a rollback: the branch links up and carries the work it claims
+	work := 0.0
+	for i, b := range branch {
+		if i > 0 && b.prevHash != branch[i-1].hash {
+			return fmt.Errorf("%w: block %v of the branch has parent %v", ErrInvalidPrevHash, fork+1+i, b.prevHash)
+		}
+		if err := bc.checkStatic(b, true); err != nil {
+			return fmt.Errorf("block %v of the branch: %w", fork+1+i, err)
+		}
+		work += math.Pow(16, float64(b.difficulty))
+	}
+	if work <= bc.workAfter(fork) {
+		return fmt.Errorf("%w: %v expected hashes past block %v, the chain has %v", ErrLighterBranch, work, fork, bc.workAfter(fork))
+	}
+
+	view, err := bc.WithHeight(fork)
+	if err != nil {
+		return err
+	}
+	dropped := []Block{}
+	for height := fork + 1; height <= tip; height++ {
+		dropped = append(dropped, bc.blockAt(height))
+	}
+	// Put back as is if the branch fails
+	saved := *bc
+	saved.archive = maps.Clone(bc.archive)
+	saved.txnReceipts = maps.Clone(bc.txnReceipts)
+	if err := bc.blocks.Truncate(fork + 1); err != nil {
+		return err
+	}
+	bc.history.truncate(fork + 1)
+	bc.txnReceipts.truncate(fork + 1)
+	bc.truncateStateRoots(fork + 1)
+	if len(dropped) > 0 {
+		bc.difficulty = dropped[0].difficulty
+	}
+	bc.state = view.state
+	for _, b := range dropped {
+		bc.txns -= len(b.data)
+	}
+	maps.DeleteFunc(bc.archive, func(height int, _ *State) bool { return height > fork })
+
+	// Events of the branch wait until it is known valid
+	bc.events = nil
+	states := []*State{view.state}
+	for i, b := range branch {
+		if err = bc.appendBlock(b); err != nil {
+			err = fmt.Errorf("block %v of the branch: %w", fork+1+i, err)
+			break
+		}
+		states = append(states, bc.state)
+	}
+	if err != nil {
+		bc.restore(saved, fork, dropped)
+		return err
+	}
+	bc.events = saved.events
+	bc.publishReorg(fork, dropped, branch, states)
+	bc.requeue(dropped, branch)
+	bc.orphan(fork, dropped, branch)
+	bc.forgetAttempts(fork)
+	bc.resetCaches()
+	return nil
+}
+
+// Put the chain back as it was before a failed Reorg at fork
+func (bc *BlockChain) restore(saved BlockChain, fork int, dropped []Block) {
+	if err := bc.blocks.Truncate(fork + 1); err != nil {
+		panic(err)
+	}
+	bc.history.truncate(fork + 1)
+	for i, b := range dropped {
+		if err := bc.blocks.Append(b); err != nil {
+			panic(fmt.Errorf("restoring block %v: %w", b.hash, err))
+		}
+		bc.history.add(fork+1+i, b)
+	}
+	bc.state, bc.difficulty, bc.txns, bc.archive, bc.events = saved.state, saved.difficulty, saved.txns, saved.archive, saved.events
+	bc.txnReceipts, bc.stateRoots = saved.txnReceipts, saved.stateRoots
+	bc.mempool.rates = bc.state.feeRates()
+}
+
+/*
+ * Publish the dropped Blocks from the last one down, their transactions
+ * missing from branch, then the Blocks of branch, states holding the state
+ * at fork and after each Block of branch
+ */
+func (bc *BlockChain) publishReorg(fork int, dropped, branch []Block, states []*State) {
+	if bc.events == nil {
+		return
+	}
+	kept := map[string]bool{}
+	for _, b := range branch {
+		for _, txn := range b.data {
+			kept[txn.Hash()] = true
+		}
+	}
+	// States after each dropped Block, replayed from the fork
+	after := []*State{states[0]}
+	for _, b := range dropped {
+		state := after[len(after)-1].clone()
+		if err := state.replay(b); err != nil {
+			panic(fmt.Errorf("replaying reverted block %v: %w", b.hash, err))
+		}
+		after = append(after, state)
+	}
+	for i := len(dropped) - 1; i >= 0; i-- {
+		b := dropped[i]
+		bc.events.publish(Event{Type: RevertedBlock, Block: &b, Height: fork + 1 + i, Delta: diffStates(after[i+1], after[i])})
+		for _, txn := range b.data {
+			if !kept[txn.Hash()] {
+				bc.events.publish(Event{Type: RevertedTxn, Txn: &txn, Height: fork + 1 + i})
+			}
+		}
+	}
+	for i, b := range branch {
+		bc.events.publish(Event{Type: NewBlock, Block: &b, Height: fork + 1 + i, Delta: diffStates(states[i], states[i+1])})
+	}
+}
+
+/*
+ * Rebuild the Mempool with the transactions of dropped missing from branch
+ * first, then expire and evict under the Mempool limits as for arrivals
+ */
+func (bc *BlockChain) requeue(dropped, branch []Block) {
+	kept := map[string]bool{}
+	for _, b := range branch {
+		for _, txn := range b.data {
+			kept[txn.Hash()] = true
+		}
+	}
+	txns := []Transaction{}
+	for _, b := range dropped {
+		for _, txn := range b.data {
+			switch {
+			case kept[txn.Hash()]:
+			case txn.kind == TxnMint:
+				bc.txnDropped(txn.Hash(), "block reverted")
+			default:
+				txns = append(txns, txn)
+			}
+		}
+	}
+	reverted := len(txns)
+	old := bc.mempool
+	txns = append(txns, old.held()...)
+	bc.mempool = NewMempool()
+	bc.mempool.rates = bc.state.feeRates()
+	bc.mempool.admitted, bc.mempool.arrivals = old.admitted, old.arrivals
+	for i, txn := range txns {
+		err := bc.mempool.add(txn, bc.state.nonce(txn.payer))
+		// Transactions whose nonce the branch spent are gone for good
+		if err != nil && !errors.Is(err, ErrInvalidNonce) && !errors.Is(err, ErrNonceTaken) {
+			panic(err)
+		}
+		switch {
+		case i >= reverted:
+		case err != nil:
+			bc.txnDropped(txn.Hash(), "block reverted, nonce spent by the branch")
+		default:
+			bc.txnStep(txn.Hash(), TxnStep{Status: TXN_PENDING, Reason: "block reverted"})
+		}
+	}
+	bc.expireTxns()
+	if err := bc.evict(0, 0); err != nil {
+		log.Printf("mempool: %v", err)
+	}
+}
+
+/*
+ * Switch to the branch of peer if it forked from our chain within
+ * MAX_REORG_DEPTH Blocks and carries more work, counting the Blocks
+ * appended and replaced in report
+ */
+func (bc *BlockChain) resolveFork(peer string, report *SyncReport) error {
+	tip := bc.blocks.Len() - 1
+	from := max(tip-MAX_REORG_DEPTH, 0)
+	p := newPeerClient(peer)
+	var headers []jsonHeader
+	if _, err := p.get(fmt.Sprintf("/headers?from=%v", from), &headers); err != nil {
+		return err
+	}
+	fork := -1
+	for i, j := range headers {
+		if from+i > tip || j.Hash != bc.blockAt(from+i).hash {
+			break
+		}
+		fork = from + i
+	}
+	switch {
+	case fork < 0:
+		return fmt.Errorf("no common block in the last %v", MAX_REORG_DEPTH)
+	case fork == tip || fork == from+len(headers)-1:
+		// The peer extends our chain, or is behind on it
+		return nil
+	}
+	lc, err := bc.lightClientAt(peer, fork)
+	if err != nil {
+		return err
+	}
+	if _, err := lc.Sync(); err != nil {
+		log.Printf("sync: peer %v: fork: %v", peer, err)
+	}
+	if lc.work() <= bc.workAfter(fork) {
+		return nil
+	}
+	branch := []Block{}
+	for fork+len(branch) < lc.Height() {
+		blocks, err := lc.bodies(fork + 1 + len(branch))
+		if err != nil {
+			return err
+		}
+		branch = append(branch, blocks...)
+	}
+	if err := bc.Reorg(fork, branch); err != nil {
+		return err
+	}
+	log.Printf("sync: switched to the branch of %v forking at block %v, %v blocks reverted", peer, fork, tip-fork)
+	report.Peers = append(report.Peers, peer)
+	report.Blocks += len(branch)
+	report.Reverted += tip - fork
+	return nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Replace-by-fee and cancellation.
+ * A payer whose transaction waits in the Mempool, eg. paying too little to
+ * be mined soon, may send another one with the same nonce: it replaces the
+ * one held, pending or queued, if it pays REPLACEMENT_FEE_BUMP more, and no
+ * less than REPLACEMENT_MIN_FEE more, in coins at the latest fee rates.
+ * Otherwise it is refused with ErrUnderpriced, which also marks it
+ * ErrNonceTaken as before, so a conflicting spend paying no more still
+ * raises a double spend alert, see alert.go. The bump keeps a payer from
+ * flooding the network with replacements for free. A replacement takes the
+ * room of the one it replaces in a Mempool at its limits, see
+ * mempoollimits.go, and the replaced transaction ends replaced, see
+ * txnstatus.go.
+ *
+ * Cancelling a held transaction replaces it with a transfer of nothing
+ * from its payer to itself, paying the least replacement fee: once mined,
+ * it spends the nonce and the fee alone. The fee being the payer's, only
+ * the payer cancels over the node API, signing the digest of "cancel|"
+ * followed by the hash with the key bound to its account, or to which its
+ * address hashes, in the signature scheme of the transaction. The
+ * operator, bearing the admin token, see admin.go, cancels any.
+ *
+ *	POST /txns/{hash}/cancel  {"publicKey": .., "signature": ..}: cancel a
+ *	                          held transaction, returns the cancellation
+ *	                          sent in its place
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+const (
+	REPLACEMENT_FEE_BUMP        = 10          // percent of the replaced fee a replacement pays on top
+	REPLACEMENT_MIN_FEE  Amount = COIN / 1000 // least fee a replacement pays on top, eg. of a free transaction
+)
+
+// Held transaction of payer with nonce, pending or queued
+func (mp *Mempool) heldNonce(payer string, nonce uint64) (Transaction, bool) {
+	same := func(txn Transaction) bool { return txn.payer == payer && txn.nonce == nonce }
+	if i := slices.IndexFunc(mp.pending, same); i >= 0 {
+		return mp.pending[i], true
+	}
+	if i := slices.IndexFunc(mp.queued[payer], same); i >= 0 {
+		return mp.queued[payer][i], true
+	}
+	return Transaction{}, false
+}
+
+// Held transaction of hash, pending or queued
+func (mp *Mempool) find(hash string) (Transaction, bool) {
+	held := mp.held()
+	if i := slices.IndexFunc(held, func(txn Transaction) bool { return txn.Hash() == hash }); i >= 0 {
+		return held[i], true
+	}
+	return Transaction{}, false
+}
+
+// Put txn in the place of the held old, of the same payer and nonce
+func (mp *Mempool) replace(old, txn Transaction) {
+	hash := old.Hash()
+	delete(mp.admitted, hash)
+	same := func(t Transaction) bool { return t.Hash() == hash }
+	if i := slices.IndexFunc(mp.pending, same); i >= 0 {
+		mp.pending[i] = txn
+		return
+	}
+	if i := slices.IndexFunc(mp.queued[old.payer], same); i >= 0 {
+		mp.queued[old.payer][i] = txn
+	}
+}
+
+// Least fee, in the fee asset of old, of a transaction replacing old
+func replacementFee(old Transaction) Amount {
+	fee := old.totalFee()
+	return fee + max(fee/100*REPLACEMENT_FEE_BUMP, REPLACEMENT_MIN_FEE)
+}
+
+// Replace the held old by txn if it pays enough more
+func (bc *BlockChain) replaceTxn(old, txn Transaction) error {
+	least, paid := replacementFee(old), txn.totalFee()
+	if txn.feeAsset != old.feeAsset {
+		least = Transaction{fee: least, feeAsset: old.feeAsset}.feeValue(bc.mempool.rates)
+		paid = txn.feeValue(bc.mempool.rates)
+	}
+	if paid < least {
+		return fmt.Errorf("%w: %w, %v pays %v, replacing %v takes %v", ErrNonceTaken, ErrUnderpriced, txn.Hash(), paid, old.Hash(), least)
+	}
+	bc.mempool.replace(old, txn)
+	bc.txnStep(old.Hash(), TxnStep{Status: TXN_REPLACED, ReplacedBy: txn.Hash()})
+	return nil
+}
+
+/*
+ * Transfer of nothing from the payer of the held transaction hash to
+ * itself, with its nonce, paying the least replacement fee, and cosigned
+ * by cosigners if the payer is a multisig account
+ * Fails with ErrNotPending if the Mempool does not hold it
+ */
+func (bc *BlockChain) cancellation(hash string, cosigners ...Signer) (Transaction, error) {
+	old, ok := bc.mempool.find(hash)
+	if !ok {
+		return Transaction{}, fmt.Errorf("%w: %v", ErrNotPending, hash)
+	}
+	cancel := Transaction{
+		payer:    old.payer,
+		payee:    old.payer,
+		fee:      replacementFee(old),
+		feeAsset: old.feeAsset,
+		nonce:    old.nonce,
+		scheme:   old.scheme,
+		chainID:  old.chainID,
+	}
+	for _, s := range cosigners {
+		if err := cancel.CoSign(s); err != nil {
+			return Transaction{}, err
+		}
+	}
+	return cancel, nil
+}
+
+// Cancel the held transaction hash, returning the cancellation replacing it, see cancellation
+func (bc *BlockChain) Cancel(hash string, cosigners ...Signer) (Transaction, error) {
+	cancel, err := bc.cancellation(hash, cosigners...)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return cancel, bc.AddTxn(cancel)
+}
+
+// Cancel the held transaction hash, relaying the cancellation like any transaction
+func (n *Node) Cancel(hash string, cosigners ...Signer) (Transaction, error) {
+	var cancel Transaction
+	var err error
+	n.withChain(func(bc *BlockChain) { cancel, err = bc.cancellation(hash, cosigners...) })
+	if err != nil {
+		return Transaction{}, err
+	}
+	return cancel, n.AddTxn(cancel)
+}
+
+// Digest the payer of the held transaction hash signs to cancel it
+func cancelDigest(hash string) []byte {
+	sum := sha256.Sum256([]byte("cancel|" + hash))
+	return sum[:]
+}
+
+/*
+ * Check sig is the signature of the cancellation of the held transaction
+ * hash by its payer, made with pubKey
+ * Fails with ErrNotPending if the Mempool does not hold it
+ */
+func (bc *BlockChain) checkCancelSignature(hash string, pubKey, sig []byte) error {
+	old, ok := bc.mempool.find(hash)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrNotPending, hash)
+	}
+	if known, ok := bc.state.keys[old.payer]; ok {
+		if !bytes.Equal(known, pubKey) {
+			return fmt.Errorf("%w: %v cancelled with a key it does not own", ErrInvalidSignature, old.payer)
+		}
+	} else if _, _, err := decodeAddress(old.payer); err != nil || !ownsAccount(old.payer, pubKey) {
+		// Accounts named rather than addressed own no key until they sign
+		return fmt.Errorf("%w: %v owns no key cancelling for it", ErrInvalidSignature, old.payer)
+	}
+	if !verifySignature(old.scheme, pubKey, cancelDigest(hash), sig) {
+		return fmt.Errorf("%w on the cancellation of %v", ErrInvalidSignature, hash)
+	}
+	return nil
+}
+
+// POST /txns/{hash}/cancel
+func (s *Server) handleCancelTxn(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	if !s.fromOperator(r) {
+		var req struct {
+			PublicKey []byte `json:"publicKey"`
+			Signature []byte `json:"signature"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var err error
+		s.node.withChain(func(bc *BlockChain) { err = bc.checkCancelSignature(hash, req.PublicKey, req.Signature) })
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+	}
+	cancel, err := s.node.Cancel(hash)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, cancel.toJSON())
+}
@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Only the payer, signing with the key its address hashes from, or the operator cancel over the node API
+func TestCancelTxnSigned(t *testing.T) {
+	payer, err := NewWallet("payer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, err := NewWallet("stranger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := payer.Address(ADDRESS_PREFIX)
+	genesis := TestGenesis(2)
+	genesis.Alloc[addr] = 1000 * COIN
+	node := NewNode(NewTestChain(1, genesis).Chain())
+	node.SetAdminToken("secret")
+	srv := NewServer(node)
+	held := func(payer string) string {
+		t.Helper()
+		txn := Transaction{payer: payer, payee: "account1", amt: COIN, fee: COIN / 10}
+		if err := node.AddTxn(txn); err != nil {
+			t.Fatal(err)
+		}
+		return txn.Hash()
+	}
+	cancel := func(hash string, w *Wallet, token string) int {
+		t.Helper()
+		body := []byte("{}")
+		if w != nil {
+			sig, err := w.Sign(cancelDigest(hash))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ = json.Marshal(map[string][]byte{"publicKey": w.PublicKey(), "signature": sig})
+		}
+		req := httptest.NewRequest(http.MethodPost, "/txns/"+hash+"/cancel", bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	hash := held(addr)
+	for _, c := range []struct {
+		name   string
+		w      *Wallet
+		status int
+	}{
+		{"unsigned", nil, http.StatusBadRequest},
+		{"signed by a stranger", stranger, http.StatusBadRequest},
+		{"signed by the payer", payer, http.StatusAccepted},
+	} {
+		if status := cancel(hash, c.w, ""); status != c.status {
+			t.Errorf("cancellation %v answered %v, expected %v", c.name, status, c.status)
+		}
+	}
+
+	// account0 is named, so no key is its own yet
+	named := held("account0")
+	if status := cancel(named, stranger, ""); status != http.StatusBadRequest {
+		t.Errorf("cancellation of a named account by a stranger answered %v, expected %v", status, http.StatusBadRequest)
+	}
+	if status := cancel(named, nil, "secret"); status != http.StatusAccepted {
+		t.Errorf("cancellation by the operator answered %v, expected %v", status, http.StatusAccepted)
+	}
+}
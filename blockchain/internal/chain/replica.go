@@ -0,0 +1,98 @@
+/*
+ * Read replicas.
+ * A replica follows the chain of a primary node over the gRPC block
+ * stream, validating and appending every Block like an imported one. It
+ * never mines and refuses transactions, but serves every read query of
+ * the HTTP and gRPC APIs, taking explorer traffic off the mining node.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Wait before reconnecting to the primary after the stream broke
+const REPLICA_RETRY = 5 * time.Second
+
+// New chain from the genesis spec of primary, checking it gives the hash primary claims
+func replicaChain(primary string) (BlockChain, error) {
+	spec, hash, err := newPeerClient(primary).genesis()
+	if err != nil {
+		return BlockChain{}, fmt.Errorf("primary %v: %w", primary, err)
+	}
+	if err := VerifyGenesis(spec, hash); err != nil {
+		return BlockChain{}, fmt.Errorf("primary %v: %w", primary, err)
+	}
+	return CreateBlockChain(spec), nil
+}
+
+func (n *Node) IsReplica() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.primary != ""
+}
+
+/*
+ * Turn the Node into a read replica of primary and follow its chain in
+ * the background, reconnecting whenever the stream breaks
+ * Fails if the primary cannot be reached or is on another chain
+ */
+func (n *Node) Follow(primary string) error {
+	_, hash, err := newPeerClient(primary).genesis()
+	if err != nil {
+		return fmt.Errorf("primary %v: %w", primary, err)
+	}
+	n.mu.Lock()
+	n.primary = primary
+	genesisHash := n.bc.GenesisHash()
+	n.mu.Unlock()
+	if hash != genesisHash {
+		return fmt.Errorf("primary %v has genesis %v, expected %v", primary, hash, genesisHash)
+	}
+	go func() {
+		client := newGRPCClient()
+		for {
+			err := n.followStream(client, primary)
+			log.Printf("following %v: %v, reconnecting in %v", primary, err, REPLICA_RETRY)
+			time.Sleep(REPLICA_RETRY)
+		}
+	}()
+	return nil
+}
+
+// Append the Blocks of the primary from our height on, until the stream breaks
+func (n *Node) followStream(client *http.Client, primary string) error {
+	req := &protoWriter{}
+	n.withChain(func(bc *BlockChain) { req.uint(1, uint64(bc.blocks.Len())) })
+	stream, err := callGRPC(client, primary, "StreamBlocks", req)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	for {
+		m, err := stream.next()
+		if err == io.EOF {
+			return errors.New("stream closed by the primary")
+		}
+		if err != nil {
+			return err
+		}
+		b, height, err := protoBlock(m)
+		if err != nil {
+			return err
+		}
+		n.withChain(func(bc *BlockChain) {
+			if height >= bc.blocks.Len() {
+				err = bc.appendBlock(b)
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("block %v from primary: %w", height, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Difficulty retargeting.
+ * A genesis spec declaring a retarget lets the chain follow the hash rate:
+ * after every Block the difficulty is recomputed from the timestamps and
+ * difficulties of the last Window Blocks, so that Blocks keep coming every
+ * Interval seconds on average. Every node validating the chain computes the
+ * same difficulty, which the next Block must be mined at.
+ *
+ *	"retarget": {"algorithm": "lwma", "interval": 60, "window": 45}
+ *
+ * Two algorithms estimate the hash rate:
+ *
+ *	window  the work of the window over its duration, every Block weighing
+ *	        the same, so a change of hash rate takes a whole window to show
+ *	lwma    linearly weighted moving average, the solve time of the i-th
+ *	        Block of the window weighing i, so the last Blocks count most
+ *	        and the difficulty catches up within a few Blocks
+ *
+ * When miners leave, the window average keeps the difficulty up until a
+ * window of slow Blocks went by, while LWMA brings it down sooner and the
+ * miners staying wait less. -retarget-sim compares both as the hash rate
+ * rises, drops and oscillates.
+ *
+ * Solve times are clamped to 1 microsecond..RETARGET_MAX_SOLVE intervals,
+ * so a timestamp far off cannot swing the difficulty on its own. A
+ * difficulty being a number of leading hex 0s, each step is 16 times the
+ * work: the estimate is rounded to the nearest step, in log scale, and kept
+ * within MIN_RETARGET_DIFFICULTY..MAX_RETARGET_DIFFICULTY. The arithmetic
+ * is exact, so nodes on any platform agree.
+ */
+package chain
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+)
+
+const (
+	RETARGET_WINDOW = "window"
+	RETARGET_LWMA   = "lwma"
+)
+
+const (
+	MIN_RETARGET_DIFFICULTY = 1
+	MAX_RETARGET_DIFFICULTY = 8
+	RETARGET_MAX_SOLVE      = 6 // longest solve time counted, in intervals
+	RETARGET_MAX_WINDOW     = 1000
+)
+
+type RetargetSpec struct {
+	Algorithm string `json:"algorithm"` // RETARGET_WINDOW or RETARGET_LWMA
+	Interval  int64  `json:"interval"`  // target seconds between Blocks
+	Window    int    `json:"window"`    // Blocks averaged
+}
+
+// Retarget of algorithm aiming at a Block a minute, averaging 45 Blocks
+func DefaultRetargetSpec(algorithm string) RetargetSpec {
+	return RetargetSpec{Algorithm: algorithm, Interval: 60, Window: 45}
+}
+
+func (r RetargetSpec) check() error {
+	if r.Algorithm != RETARGET_WINDOW && r.Algorithm != RETARGET_LWMA {
+		return fmt.Errorf("unknown retarget algorithm %q, want %v or %v", r.Algorithm, RETARGET_WINDOW, RETARGET_LWMA)
+	}
+	if r.Interval <= 0 {
+		return fmt.Errorf("retarget interval %v is not positive", r.Interval)
+	}
+	if r.Window < 1 || r.Window > RETARGET_MAX_WINDOW {
+		return fmt.Errorf("retarget window %v outside 1..%v", r.Window, RETARGET_MAX_WINDOW)
+	}
+	return nil
+}
+
+func (r RetargetSpec) String() string {
+	return fmt.Sprintf("%v/%v/%v", r.Algorithm, r.Interval, r.Window)
+}
+
+/*
+ * Difficulty of the Block after the last of headers, the headers before
+ * it being the chain up to Window Blocks back, oldest first
+ */
+func (r RetargetSpec) next(headers []Header) int {
+	if len(headers) > r.Window+1 {
+		headers = headers[len(headers)-r.Window-1:]
+	}
+	last := headers[len(headers)-1].difficulty
+	if len(headers) < 2 {
+		return last
+	}
+	interval := r.Interval * 1_000_000
+	work, weights, solves := new(big.Int), new(big.Int), new(big.Int)
+	for i := 1; i < len(headers); i++ {
+		weight := int64(1)
+		if r.Algorithm == RETARGET_LWMA {
+			weight = int64(i)
+		}
+		solve := min(max(headers[i].unixTs-headers[i-1].unixTs, 1), RETARGET_MAX_SOLVE*interval)
+		work.Add(work, new(big.Int).Lsh(big.NewInt(1), 4*uint(headers[i].difficulty)))
+		weights.Add(weights, big.NewInt(weight))
+		solves.Add(solves, new(big.Int).Mul(big.NewInt(weight), big.NewInt(solve)))
+	}
+	// Hashes per interval: work/n * interval / (solves/weights)
+	num := new(big.Int).Mul(work, weights)
+	num.Mul(num, big.NewInt(interval))
+	den := new(big.Int).Mul(solves, big.NewInt(int64(len(headers)-1)))
+	// Highest difficulty d with num/den >= 16^(d-1/2), ie. 4*num >= 16^d*den
+	num.Lsh(num, 2)
+	difficulty := MIN_RETARGET_DIFFICULTY
+	for d := MIN_RETARGET_DIFFICULTY + 1; d <= MAX_RETARGET_DIFFICULTY; d++ {
+		if num.Cmp(new(big.Int).Lsh(den, 4*uint(d))) < 0 {
+			break
+		}
+		difficulty = d
+	}
+	return difficulty
+}
+
+// Headers of the n Blocks up to the one at height, oldest first
+func (bc *BlockChain) headersTo(height, n int) ([]Header, error) {
+	headers := []Header{}
+	for h := max(height-n+1, 0); h <= height; h++ {
+		b, err := bc.blocks.Get(h)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, b.Header)
+	}
+	return headers, nil
+}
+
+/*
+ * Difficulty of the Blocks after b, about to be appended to the chain and
+ * lead to state
+ */
+func (bc *BlockChain) nextDifficulty(b Block, state *State) (int, error) {
+	next := bc.blocks.Len() + 1
+	if c, ok := state.paramChange(PARAM_DIFFICULTY, next); ok && c.Height == next && b.retarget == 0 {
+		return int(c.Value), nil
+	}
+	r := bc.genesis.Retarget
+	if b.retarget != 0 || r == nil {
+		return cmp.Or(b.retarget, bc.difficulty), nil
+	}
+	headers, err := bc.headersTo(bc.blocks.Len()-1, r.Window)
+	if err != nil {
+		return 0, fmt.Errorf("retargeting after block %v: %w", b.hash, err)
+	}
+	return r.next(append(headers, b.Header)), nil
+}
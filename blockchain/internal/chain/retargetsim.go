@@ -0,0 +1,114 @@
+/*
+ * Simulation of the difficulty retargets of retarget.go.
+ * Blocks are mined by a simulated hash rate, each taking a random time of
+ * mean the work of its difficulty over the hash rate, and the difficulty
+ * is retargeted after each one like a node does. The scenarios:
+ *
+ *	steady     the hash rate of the starting difficulty, for reference
+ *	rise       the hash rate grows 16 times halfway through
+ *	drop       the hash rate falls 16 times halfway through
+ *	switching  miners with 15 times the hash rate mine only while the
+ *	           difficulty is at most the starting one, hopping to
+ *	           another chain as soon as it rises
+ *
+ * The spread of the Block intervals tells how well each algorithm holds
+ * the interval, the longest one how long users wait when miners leave.
+ * LWMA comes down faster after a drop. Against switching miners both
+ * oscillate between two difficulties, a step being 16 times the work, and
+ * LWMA changes more often as it follows them closer.
+ */
+package chain
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+const (
+	RETARGET_SIM_STEADY    = "steady"
+	RETARGET_SIM_RISE      = "rise"
+	RETARGET_SIM_DROP      = "drop"
+	RETARGET_SIM_SWITCHING = "switching"
+)
+
+type RetargetSimConfig struct {
+	Spec       RetargetSpec
+	Scenario   string // RETARGET_SIM_STEADY, RETARGET_SIM_RISE, RETARGET_SIM_DROP or RETARGET_SIM_SWITCHING
+	Difficulty int    // starting difficulty, the steady hash rate mining it every interval
+	Blocks     int
+	Seed       uint64
+}
+
+type RetargetSimResult struct {
+	MeanInterval float64 // seconds
+	StdDev       float64 // of the intervals, in seconds
+	Longest      float64 // longest interval, in seconds
+	Changes      int     // difficulty changes
+}
+
+func DefaultRetargetSimConfig(algorithm, scenario string) RetargetSimConfig {
+	return RetargetSimConfig{Spec: DefaultRetargetSpec(algorithm), Scenario: scenario, Difficulty: 3, Blocks: 2000, Seed: 1}
+}
+
+func SimulateRetarget(cfg RetargetSimConfig) RetargetSimResult {
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	steady := math.Pow(16, float64(cfg.Difficulty)) / float64(cfg.Spec.Interval)
+	hashRate := func(height, difficulty int) float64 {
+		switch {
+		case cfg.Scenario == RETARGET_SIM_RISE && height > cfg.Blocks/2,
+			cfg.Scenario == RETARGET_SIM_DROP && height <= cfg.Blocks/2,
+			cfg.Scenario == RETARGET_SIM_SWITCHING && difficulty <= cfg.Difficulty:
+			return 16 * steady
+		}
+		return steady
+	}
+
+	headers := []Header{{difficulty: cfg.Difficulty}}
+	var result RetargetSimResult
+	sum, sumSquares := 0.0, 0.0
+	for height := 1; height <= cfg.Blocks; height++ {
+		last := headers[len(headers)-1]
+		difficulty := cfg.Spec.next(headers)
+		if difficulty != last.difficulty && height > 1 {
+			result.Changes++
+		}
+		interval := rng.ExpFloat64() * math.Pow(16, float64(difficulty)) / hashRate(height, difficulty)
+		sum += interval
+		sumSquares += interval * interval
+		result.Longest = max(result.Longest, interval)
+		headers = append(headers, Header{unixTs: last.unixTs + int64(interval*1e6), difficulty: difficulty})
+		if len(headers) > cfg.Spec.Window+1 {
+			headers = headers[1:]
+		}
+	}
+	result.MeanInterval = sum / float64(cfg.Blocks)
+	result.StdDev = math.Sqrt(max(sumSquares/float64(cfg.Blocks)-result.MeanInterval*result.MeanInterval, 0))
+	return result
+}
+
+// Print how the window average and LWMA hold the interval in every scenario
+func printRetargetSim(out *Output) error {
+	spec := DefaultRetargetSpec(RETARGET_LWMA)
+	out.Note("blocks mined every %vs at difficulty 3 by the steady hash rate, retargets averaging %v blocks",
+		spec.Interval, spec.Window)
+	type jsonRun struct {
+		Scenario     string  `json:"scenario"`
+		Algorithm    string  `json:"algorithm"`
+		MeanInterval float64 `json:"meanInterval"`
+		StdDev       float64 `json:"stdDev"`
+		Longest      float64 `json:"longest"`
+		Changes      int     `json:"changes"`
+	}
+	rows, view := [][]string{}, []jsonRun{}
+	for _, scenario := range []string{RETARGET_SIM_STEADY, RETARGET_SIM_RISE, RETARGET_SIM_DROP, RETARGET_SIM_SWITCHING} {
+		for _, algorithm := range []string{RETARGET_WINDOW, RETARGET_LWMA} {
+			result := SimulateRetarget(DefaultRetargetSimConfig(algorithm, scenario))
+			run := jsonRun{scenario, algorithm, result.MeanInterval, result.StdDev, result.Longest, result.Changes}
+			rows = append(rows, []string{scenario, algorithm, fmt.Sprintf("%.0fs", run.MeanInterval),
+				fmt.Sprintf("%.0fs", run.StdDev), fmt.Sprintf("%.0fs", run.Longest), fmt.Sprint(run.Changes)})
+			view = append(view, run)
+		}
+	}
+	return out.Table([]string{"scenario", "algorithm", "mean interval", "std dev", "longest", "changes"}, rows, view)
+}
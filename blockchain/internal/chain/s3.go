@@ -0,0 +1,158 @@
+/*
+ * ObjectStore backed by an S3-compatible API (AWS S3, MinIO, ...).
+ * Requests are signed with AWS Signature Version 4 and use path-style
+ * URLs, which every S3-compatible server accepts. Objects read back are
+ * kept in a local cache store, as stored Blocks never change.
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type S3Config struct {
+	Endpoint  string // eg. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region    string
+	Bucket    string
+	Prefix    string // prepended to every key
+	AccessKey string
+	SecretKey string
+}
+
+type S3ObjectStore struct {
+	config S3Config
+	client *http.Client
+	cache  ObjectStore // optional local copies of fetched objects
+}
+
+func NewS3ObjectStore(config S3Config, cache ObjectStore) *S3ObjectStore {
+	return &S3ObjectStore{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		cache:  cache,
+	}
+}
+
+func (s *S3ObjectStore) Put(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if s.cache != nil {
+		s.cache.Put(key, data)
+	}
+	return nil
+}
+
+func (s *S3ObjectStore) Get(key string) ([]byte, error) {
+	if s.cache != nil {
+		if data, err := s.cache.Get(key); err == nil {
+			return data, nil
+		}
+	}
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if s.cache != nil {
+		s.cache.Put(key, data)
+	}
+	return data, nil
+}
+
+func (s *S3ObjectStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if s.cache != nil {
+		s.cache.Delete(key)
+	}
+	return nil
+}
+
+/*
+ * Send a signed request for the object at key, failing on non 2xx replies,
+ * with os.ErrNotExist on 404
+ */
+func (s *S3ObjectStore) do(method, key string, body []byte) (*http.Response, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + s.config.Bucket + "/" + s.config.Prefix + key
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("s3 %v %v: %w", method, key, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("s3 %v %v: %v %s", method, key, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Add AWS Signature Version 4 headers to req
+func (s *S3ObjectStore) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := SHA256(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.config.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + SHA256([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), day)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
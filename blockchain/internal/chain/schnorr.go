@@ -0,0 +1,314 @@
+/*
+ * Schnorr signatures and their aggregation.
+ * SchemeSchnorr signs with the P-256 keys of ECDSA, public keys still
+ * traveling as uncompressed SEC 1 points, in the way of BIP-340 adapted to
+ * P-256. With d the private key, P = dG its public key and m the digest
+ * of the transaction:
+ *
+ *	k = H("toychain/schnorr/nonce", d || P || m)      deterministic nonce
+ *	R = kG
+ *	e = H("toychain/schnorr/challenge", R || P || m)
+ *	s = k + e·d
+ *
+ * H(tag, x) being SHA-256(SHA-256(tag) || SHA-256(tag) || x) mod n, R
+ * compressed to 33 bytes and s a 32 byte big endian scalar. The signature
+ * is R || s, 65 bytes, and verifies when sG = R + eP.
+ *
+ * Unlike ECDSA signatures, Schnorr signatures add up. The parties of a
+ * swap or the owners of the outputs a UTXO transaction spends all sign the
+ * same digest, each on its own, then anyone holding their signatures
+ * aggregates them, see Transaction.AggregateSignatures, into
+ *
+ *	R1 || .. || Rn || s,  s = z1·s1 + .. + zn·sn
+ *
+ * the signers sorted by account, z1 = 1 and, for i > 1,
+ * zi = H("toychain/schnorr/aggregate", R1 || P1 || .. || Rn || Pn || m || i)
+ * with i on 4 big endian bytes. It verifies when
+ *
+ *	sG = z1(R1 + e1P1) + .. + zn(Rn + enPn)
+ *
+ * The aggregate takes 33n + 32 bytes instead of 65n, and one check instead
+ * of n. The weights z keep a party from picking its R to cancel out the
+ * signature of another: with a plain sum of the s, a party knowing the
+ * other signatures could claim the sum for keys that never signed. Every
+ * R stays, making this half aggregation: folding them into one needs the
+ * signers to agree on their nonces before signing, as MuSig2 does, which
+ * signers signing alone, eg. through a remote signer, cannot. Cosignatures
+ * of multisig accounts and script witnesses are not aggregated. A single
+ * Schnorr signature is the aggregate of one.
+ *
+ * -schnorr-demo signs a swap between -schnorr-parties parties and compares
+ * the sizes of their signatures before and after aggregation.
+ */
+package chain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+)
+
+// Sizes of the parts of Schnorr signatures
+const (
+	SCHNORR_POINT_SIZE  = 33 // compressed R
+	SCHNORR_SCALAR_SIZE = 32 // s
+)
+
+// Tags of the hashes, see above
+const (
+	SCHNORR_NONCE_TAG     = "toychain/schnorr/nonce"
+	SCHNORR_CHALLENGE_TAG = "toychain/schnorr/challenge"
+	SCHNORR_AGGREGATE_TAG = "toychain/schnorr/aggregate"
+)
+
+// Parties of the swap of -schnorr-demo unless set
+const SCHNORR_DEMO_PARTIES = 4
+
+// Tagged hash of parts as a scalar of P-256
+func schnorrHash(tag string, parts ...[]byte) *big.Int {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	for _, part := range parts {
+		h.Write(part)
+	}
+	e := new(big.Int).SetBytes(h.Sum(nil))
+	return e.Mod(e, elliptic.P256().Params().N)
+}
+
+// Schnorr signature of digest by key
+func schnorrSign(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	ecdhKey, err := key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	d, pub := ecdhKey.Bytes(), ecdhKey.PublicKey().Bytes()
+	k := schnorrHash(SCHNORR_NONCE_TAG, d, pub, digest)
+	if k.Sign() == 0 {
+		return nil, errors.New("schnorr nonce is zero")
+	}
+	rx, ry := curve.ScalarBaseMult(k.FillBytes(make([]byte, SCHNORR_SCALAR_SIZE)))
+	r := elliptic.MarshalCompressed(curve, rx, ry)
+	e := schnorrHash(SCHNORR_CHALLENGE_TAG, r, pub, digest)
+	s := new(big.Int).Mul(e, new(big.Int).SetBytes(d))
+	s.Add(s, k).Mod(s, curve.Params().N)
+	return append(r, s.FillBytes(make([]byte, SCHNORR_SCALAR_SIZE))...), nil
+}
+
+// Weights of the signatures of an aggregate, the Rs and keys in the order of the signers
+func aggregateWeights(rs, keys [][]byte, digest []byte) []*big.Int {
+	var transcript []byte
+	for i := range rs {
+		transcript = append(append(transcript, rs[i]...), keys[i]...)
+	}
+	weights := []*big.Int{big.NewInt(1)}
+	for i := 1; i < len(rs); i++ {
+		weights = append(weights, schnorrHash(SCHNORR_AGGREGATE_TAG, transcript, digest, binary.BigEndian.AppendUint32(nil, uint32(i))))
+	}
+	return weights
+}
+
+/*
+ * Aggregate the Schnorr signatures sigs of digest by keys, in the order
+ * of the signers, refusing any that does not verify
+ */
+func aggregateSignatures(keys [][]byte, digest []byte, sigs [][]byte) ([]byte, error) {
+	if len(keys) == 0 || len(keys) != len(sigs) {
+		return nil, errors.New("aggregating needs one signature per key")
+	}
+	rs := [][]byte{}
+	for i, sig := range sigs {
+		if !verifyAggregate(keys[i:i+1], digest, sig) {
+			return nil, fmt.Errorf("%w: signature %v is not a Schnorr signature of its key", ErrInvalidSignature, i+1)
+		}
+		rs = append(rs, sig[:SCHNORR_POINT_SIZE])
+	}
+	n := elliptic.P256().Params().N
+	s := new(big.Int)
+	for i, z := range aggregateWeights(rs, keys, digest) {
+		si := new(big.Int).SetBytes(sigs[i][SCHNORR_POINT_SIZE:])
+		s.Add(s, si.Mul(si, z)).Mod(s, n)
+	}
+	return append(slices.Concat(rs...), s.FillBytes(make([]byte, SCHNORR_SCALAR_SIZE))...), nil
+}
+
+// Whether agg aggregates Schnorr signatures of digest by every one of keys, in their order
+func verifyAggregate(keys [][]byte, digest, agg []byte) bool {
+	if len(keys) == 0 || len(agg) != len(keys)*SCHNORR_POINT_SIZE+SCHNORR_SCALAR_SIZE {
+		return false
+	}
+	curve := elliptic.P256()
+	s := new(big.Int).SetBytes(agg[len(agg)-SCHNORR_SCALAR_SIZE:])
+	if s.Cmp(curve.Params().N) >= 0 {
+		return false
+	}
+	rs := [][]byte{}
+	for i := range keys {
+		rs = append(rs, agg[i*SCHNORR_POINT_SIZE:(i+1)*SCHNORR_POINT_SIZE])
+	}
+	var sumX, sumY *big.Int
+	for i, z := range aggregateWeights(rs, keys, digest) {
+		p, err := parseP256PublicKey(keys[i])
+		rx, ry := elliptic.UnmarshalCompressed(curve, rs[i])
+		if err != nil || rx == nil {
+			return false
+		}
+		e := schnorrHash(SCHNORR_CHALLENGE_TAG, rs[i], keys[i], digest)
+		ex, ey := curve.ScalarMult(p.X, p.Y, e.Bytes())
+		x, y := curve.Add(rx, ry, ex, ey)
+		x, y = curve.ScalarMult(x, y, z.Bytes())
+		if sumX == nil {
+			sumX, sumY = x, y
+		} else {
+			sumX, sumY = curve.Add(sumX, sumY, x, y)
+		}
+	}
+	x, y := curve.ScalarBaseMult(s.Bytes())
+	return x.Cmp(sumX) == 0 && y.Cmp(sumY) == 0
+}
+
+/*
+ * Replace the Schnorr signatures of the parties of a swap, or of the
+ * owners signing a UTXO transaction, by their aggregate
+ */
+func (txn *Transaction) AggregateSignatures() error {
+	if txn.scheme != SchemeSchnorr {
+		return fmt.Errorf("only Schnorr signatures aggregate, not %v ones", txn.scheme)
+	}
+	var keys, sigs map[string][]byte
+	var agg *[]byte
+	switch {
+	case txn.swap != nil:
+		keys, sigs, agg = txn.swap.keys, txn.swap.sigs, &txn.swap.aggSig
+	case txn.utxo != nil:
+		keys, sigs, agg = txn.utxo.keys, txn.utxo.sigs, &txn.utxo.aggSig
+	default:
+		return errors.New("only swaps and UTXO transactions carry signatures to aggregate")
+	}
+	if *agg != nil {
+		return errors.New("signatures already aggregated")
+	}
+	signers := sortedKeys(sigs)
+	signerKeys, signerSigs := [][]byte{}, [][]byte{}
+	for _, account := range signers {
+		signerKeys, signerSigs = append(signerKeys, keys[account]), append(signerSigs, sigs[account])
+	}
+	aggregate, err := aggregateSignatures(signerKeys, txn.digest(), signerSigs)
+	if err != nil {
+		return err
+	}
+	*agg = aggregate
+	clear(sigs)
+	return nil
+}
+
+/*
+ * Check the aggregate Schnorr signature of the accounts of keys, sorted,
+ * carried in place of their signatures
+ */
+func verifyAggregateOf(scheme SigScheme, keys, sigs map[string][]byte, digest, agg []byte) error {
+	if scheme != SchemeSchnorr {
+		return fmt.Errorf("%w: aggregate signature of scheme %v", ErrInvalidSignature, scheme)
+	}
+	if len(sigs) > 0 {
+		return fmt.Errorf("%w: both signatures and their aggregate", ErrInvalidSignature)
+	}
+	signerKeys := [][]byte{}
+	for _, account := range sortedKeys(keys) {
+		signerKeys = append(signerKeys, keys[account])
+	}
+	if !verifyAggregate(signerKeys, digest, agg) {
+		return fmt.Errorf("%w: aggregate of %v", ErrInvalidSignature, sortedKeys(keys))
+	}
+	return nil
+}
+
+type AggregationDemo struct {
+	Parties   int    `json:"parties"`
+	Separate  int    `json:"separate"`  // bytes of the signatures of every party
+	Aggregate int    `json:"aggregate"` // bytes of their aggregate
+	TxnBytes  int    `json:"txnBytes"`  // of the JSON of the swap signed separately
+	AggBytes  int    `json:"aggBytes"`  // of the JSON of the swap carrying the aggregate
+	Verified  bool   `json:"verified"`  // the aggregate verifies
+	Tampered  bool   `json:"tampered"`  // the aggregate still verifies once a leg changes, which it must not
+	Hash      string `json:"hash"`
+}
+
+/*
+ * Sign a swap passing a coin around parties accounts with Schnorr keys,
+ * then aggregate their signatures
+ */
+func SchnorrDemo(parties int) (AggregationDemo, error) {
+	if parties < 2 {
+		return AggregationDemo{}, errors.New("the demo needs at least two parties")
+	}
+	legs := []SwapLeg{}
+	for i := range parties {
+		legs = append(legs, NewSwapLeg(fmt.Sprintf("party%v", i+1), fmt.Sprintf("party%v", (i+1)%parties+1), NATIVE_ASSET, COIN))
+	}
+	txn := NewSwap(0, legs...).WithScheme(SchemeSchnorr)
+	for i := range parties {
+		w, err := NewSchemeWallet(fmt.Sprintf("party%v", i+1), SchemeSchnorr)
+		if err != nil {
+			return AggregationDemo{}, err
+		}
+		if err := txn.SignSwap(w); err != nil {
+			return AggregationDemo{}, err
+		}
+	}
+	demo := AggregationDemo{Parties: parties, Hash: txn.Hash()}
+	for _, sig := range txn.swap.sigs {
+		demo.Separate += len(sig)
+	}
+	raw, err := json.Marshal(txn.toJSON())
+	if err != nil {
+		return demo, err
+	}
+	demo.TxnBytes = len(raw)
+	if err := txn.AggregateSignatures(); err != nil {
+		return demo, err
+	}
+	demo.Aggregate = len(txn.swap.aggSig)
+	if raw, err = json.Marshal(txn.toJSON()); err != nil {
+		return demo, err
+	}
+	demo.AggBytes = len(raw)
+	demo.Verified = txn.verify() == nil
+	tampered := txn
+	tampered.swap = &Swap{legs: slices.Clone(txn.swap.legs), keys: txn.swap.keys, sigs: txn.swap.sigs, aggSig: txn.swap.aggSig}
+	tampered.swap.legs[0].amt = 100 * COIN
+	demo.Tampered = tampered.verify() == nil
+	return demo, nil
+}
+
+// Print the -schnorr-demo of parties, returning the exit code
+func runSchnorrDemo(parties int, out *Output) int {
+	demo, err := SchnorrDemo(parties)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	err = out.Record([][2]string{
+		{"parties", fmt.Sprint(demo.Parties)},
+		{"swap", demo.Hash},
+		{"signatures", fmt.Sprintf("%v bytes", demo.Separate)},
+		{"aggregate", fmt.Sprintf("%v bytes, %.0f%% of them", demo.Aggregate, 100*float64(demo.Aggregate)/float64(demo.Separate))},
+		{"swap json", fmt.Sprintf("%v bytes, %v aggregated", demo.TxnBytes, demo.AggBytes)},
+		{"verifies", fmt.Sprint(demo.Verified)},
+		{"tampered verifies", fmt.Sprint(demo.Tampered)},
+	}, demo)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,207 @@
+/*
+ * Transaction scripts.
+ * Any transaction may carry a script, a program for a tiny stack machine in
+ * the spirit of Bitcoin Script. The witness items are pushed first, then the
+ * script runs when the transaction is applied, and the transaction is
+ * rejected unless the script leaves a true value on top of the stack.
+ * The script is covered by the transaction digest, the witness is not, so
+ * the witness can hold signatures over the transaction.
+ *
+ * A script is a space separated list of tokens:
+ *   123, -4                        push a number
+ *   0x00ff                         push raw bytes
+ *   DUP DROP SWAP                  stack manipulation
+ *   ADD SUB                        arithmetic on numbers
+ *   EQUAL LESS                     comparison, pushes 1 or 0
+ *   VERIFY EQUALVERIFY             fail unless true (or equal)
+ *   SHA256                         hash the top item
+ *   CHECKSIG                       pop a public key and a signature over
+ *                                  the transaction digest, push 1 if valid
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAX_SCRIPT_OPS   = 64
+	MAX_SCRIPT_STACK = 32
+)
+
+// Gas per script token
+const GAS_SCRIPT_OP = 200
+
+// Extra gas of a CHECKSIG on top of GAS_SCRIPT_OP
+const GAS_CHECKSIG = 3_000
+
+type Script struct {
+	code    string   // program, see the tokens above
+	witness [][]byte // initial stack, bottom first
+}
+
+// Attach a script to the transaction; it must be set before signing
+func (txn Transaction) WithScript(code string) Transaction {
+	txn.script = &Script{code: code}
+	return txn
+}
+
+// Push items on the initial stack of the transaction's script
+func (txn *Transaction) PushWitness(items ...[]byte) error {
+	if txn.script == nil {
+		return errors.New("transaction has no script")
+	}
+	txn.script.witness = append(txn.script.witness, items...)
+	return nil
+}
+
+// Push the signer's signature of the transaction on the witness
+func (txn *Transaction) SignScript(s Signer) error {
+	sig, err := s.SignTxn(*txn)
+	if err != nil {
+		return err
+	}
+	return txn.PushWitness(sig)
+}
+
+func (s *Script) ops() []string {
+	return strings.Fields(s.code)
+}
+
+func (s *Script) gas() uint64 {
+	gas := uint64(0)
+	for _, op := range s.ops() {
+		gas += GAS_SCRIPT_OP
+		if op == "CHECKSIG" {
+			gas += GAS_CHECKSIG
+		}
+	}
+	return gas
+}
+
+func scriptNum(item []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(item), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", item)
+	}
+	return n, nil
+}
+
+func scriptBool(b bool) []byte {
+	if b {
+		return []byte("1")
+	}
+	return []byte("0")
+}
+
+func scriptTrue(item []byte) bool {
+	return len(item) > 0 && string(item) != "0"
+}
+
+// Run the script over the witness, digest being what CHECKSIG verifies with scheme
+func (s *Script) run(scheme SigScheme, digest []byte) error {
+	ops := s.ops()
+	if len(ops) > MAX_SCRIPT_OPS {
+		return fmt.Errorf("script has more than %v ops", MAX_SCRIPT_OPS)
+	}
+	if len(s.witness) > MAX_SCRIPT_STACK {
+		return errors.New("script witness overflows the stack")
+	}
+	stack := append([][]byte{}, s.witness...)
+	pop := func(n int) ([][]byte, error) {
+		if len(stack) < n {
+			return nil, errors.New("script stack underflow")
+		}
+		items := append([][]byte{}, stack[len(stack)-n:]...)
+		stack = stack[:len(stack)-n]
+		return items, nil
+	}
+	for i, op := range ops {
+		var items [][]byte
+		var err error
+		switch op {
+		case "DUP":
+			if items, err = pop(1); err == nil {
+				stack = append(stack, items[0], items[0])
+			}
+		case "DROP":
+			_, err = pop(1)
+		case "SWAP":
+			if items, err = pop(2); err == nil {
+				stack = append(stack, items[1], items[0])
+			}
+		case "ADD", "SUB", "LESS":
+			if items, err = pop(2); err != nil {
+				break
+			}
+			var a, b int64
+			if a, err = scriptNum(items[0]); err != nil {
+				break
+			}
+			if b, err = scriptNum(items[1]); err != nil {
+				break
+			}
+			switch op {
+			case "ADD":
+				stack = append(stack, []byte(strconv.FormatInt(a+b, 10)))
+			case "SUB":
+				stack = append(stack, []byte(strconv.FormatInt(a-b, 10)))
+			case "LESS":
+				stack = append(stack, scriptBool(a < b))
+			}
+		case "EQUAL", "EQUALVERIFY":
+			if items, err = pop(2); err != nil {
+				break
+			}
+			equal := bytes.Equal(items[0], items[1])
+			if op == "EQUAL" {
+				stack = append(stack, scriptBool(equal))
+			} else if !equal {
+				err = errors.New("EQUALVERIFY failed")
+			}
+		case "VERIFY":
+			if items, err = pop(1); err == nil && !scriptTrue(items[0]) {
+				err = errors.New("VERIFY failed")
+			}
+		case "SHA256":
+			if items, err = pop(1); err == nil {
+				hash := sha256.Sum256(items[0])
+				stack = append(stack, hash[:])
+			}
+		case "CHECKSIG":
+			if items, err = pop(2); err == nil {
+				stack = append(stack, scriptBool(verifySignature(scheme, items[1], digest, items[0])))
+			}
+		default:
+			var item []byte
+			if strings.HasPrefix(op, "0x") {
+				item, err = hex.DecodeString(op[2:])
+			} else if _, err = strconv.ParseInt(op, 10, 64); err == nil {
+				item = []byte(op)
+			} else {
+				err = errors.New("unknown op")
+			}
+			stack = append(stack, item)
+		}
+		if err != nil {
+			return fmt.Errorf("script op %v (%v): %w", i, op, err)
+		}
+		if len(stack) > MAX_SCRIPT_STACK {
+			return errors.New("script stack overflow")
+		}
+	}
+	if len(stack) == 0 || !scriptTrue(stack[len(stack)-1]) {
+		return errors.New("script did not end with true")
+	}
+	return nil
+}
+
+func (s *Script) String() string {
+	return fmt.Sprintf("script %q with %v witness items", s.code, len(s.witness))
+}
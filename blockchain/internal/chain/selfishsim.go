@@ -0,0 +1,230 @@
+/*
+ * Simulation of selfish mining over a network with latency.
+ * A pool and honest miners share the hash power, the honest part split
+ * evenly. Blocks are found a random time apart, by each miner in
+ * proportion to its power, on top of the best chain it knows of, and
+ * reach every other miner a random time later, of mean Latency. A miner
+ * switches to a Block only if it is higher than its tip, so of two Blocks
+ * at the same height it keeps mining on the first it heard of, and the
+ * other ends up orphaned.
+ *
+ * A selfish pool follows the strategy of Eyal and Sirer: it keeps the
+ * Blocks it finds private and mines on them, and each time the honest
+ * miners find one it publishes just enough to stay ahead:
+ *
+ *	behind         it gives up its private Blocks and mines on theirs
+ *	tied           it publishes its Block, racing theirs, and publishes
+ *	               the next Block it finds straight away
+ *	ahead by one   it publishes all, overriding their Block
+ *	further ahead  it publishes its Block of the same height
+ *
+ * Honest miners waste their work on the Blocks it overrides, so the pool
+ * earns more than its share of the Blocks of the chain above a third of
+ * the hash power without latency, where the honest miners always hear of
+ * their own Block first. Latency lets the pool's racing Block reach some
+ * of them first, lowering the threshold, and orphans Blocks of honest
+ * miners too. Expected is the revenue of the paper for a pool winning no
+ * race, comparable to the runs without latency.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+type SelfishSimConfig struct {
+	Share        float64 // of the hash power held by the pool
+	Selfish      bool    // or the pool mines honestly
+	HonestMiners int
+	Interval     float64 // mean seconds between Blocks
+	Latency      float64 // mean seconds for a Block to reach another miner
+	Blocks       int     // found by all miners
+	Seed         uint64
+}
+
+type SelfishSimResult struct {
+	OrphanRate   float64 // share of the Blocks found left out of the chain
+	RevenueShare float64 // of the Blocks of the chain mined by the pool
+	Expected     float64 // revenue share of a selfish pool without latency
+}
+
+func DefaultSelfishSimConfig(share float64, selfish bool, latency float64) SelfishSimConfig {
+	return SelfishSimConfig{Share: share, Selfish: selfish, HonestMiners: 10, Interval: 600, Latency: latency, Blocks: 20_000, Seed: 1}
+}
+
+type selfishSimBlock struct {
+	parent, height int
+	pool           bool
+}
+
+type selfishSimDelivery struct {
+	at           float64
+	miner, block int
+}
+
+func SimulateSelfish(cfg SelfishSimConfig) (SelfishSimResult, error) {
+	if !(cfg.Share > 0 && cfg.Share < 1) || cfg.HonestMiners < 1 || !(cfg.Interval > 0) || cfg.Latency < 0 || cfg.Blocks < 1 {
+		return SelfishSimResult{}, errors.New("selfish sim needs a share between 0 and 1, honest miners, a positive interval and blocks")
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	// Miner 0 is the pool, block 0 the genesis
+	blocks := []selfishSimBlock{{parent: -1}}
+	tip := make([]int, cfg.HonestMiners+1)
+	pending := []selfishSimDelivery{}
+	published := []bool{true}
+	send := func(from, block int, now float64) {
+		published[block] = true
+		for miner := range tip {
+			if miner != from {
+				pending = append(pending, selfishSimDelivery{now + rng.ExpFloat64()*cfg.Latency, miner, block})
+			}
+		}
+	}
+	find := func(miner int) int {
+		parent := tip[miner]
+		blocks = append(blocks, selfishSimBlock{parent, blocks[parent].height + 1, miner == 0})
+		published = append(published, false)
+		tip[miner] = len(blocks) - 1
+		return tip[miner]
+	}
+
+	// The pool's tip is private, public the best Block it heard of
+	public, racing := 0, false
+	publishUpTo := func(height int, now float64) {
+		chain := []int{}
+		for b := tip[0]; !published[b]; b = blocks[b].parent {
+			if blocks[b].height <= height {
+				chain = append(chain, b)
+			}
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			send(0, chain[i], now)
+		}
+	}
+	receive := func(d selfishSimDelivery) {
+		if d.miner != 0 || !cfg.Selfish {
+			if blocks[d.block].height > blocks[tip[d.miner]].height {
+				tip[d.miner] = d.block
+			}
+			return
+		}
+		if blocks[d.block].height <= blocks[public].height {
+			return
+		}
+		public = d.block
+		racing = false
+		switch h, private := blocks[public].height, blocks[tip[0]].height; {
+		case private < h:
+			tip[0] = public
+		case private == h:
+			publishUpTo(h, d.at)
+			racing = true
+		case private == h+1:
+			publishUpTo(private, d.at)
+		default:
+			publishUpTo(h, d.at)
+		}
+	}
+	deliverUntil := func(t float64) {
+		for {
+			next := -1
+			for i, d := range pending {
+				if d.at <= t && (next < 0 || d.at < pending[next].at) {
+					next = i
+				}
+			}
+			if next < 0 {
+				return
+			}
+			d := pending[next]
+			pending = append(pending[:next], pending[next+1:]...)
+			receive(d)
+		}
+	}
+
+	now := 0.0
+	for range cfg.Blocks {
+		now += rng.ExpFloat64() * cfg.Interval
+		deliverUntil(now)
+		miner := 0
+		if rng.Float64() >= cfg.Share {
+			miner = 1 + rng.IntN(cfg.HonestMiners)
+		}
+		b := find(miner)
+		switch {
+		case miner != 0 || !cfg.Selfish:
+			send(miner, b, now)
+		case racing:
+			publishUpTo(blocks[b].height, now)
+			racing = false
+		}
+	}
+	// The pool publishes what it holds back, and every Block arrives
+	if cfg.Selfish && blocks[tip[0]].height > blocks[public].height {
+		publishUpTo(blocks[tip[0]].height, now)
+	}
+	deliverUntil(math.Inf(1))
+
+	// The chain is the highest published Block, the first found on a tie
+	best := 0
+	for b := range blocks {
+		if published[b] && blocks[b].height > blocks[best].height {
+			best = b
+		}
+	}
+	pool := 0
+	for b := best; b > 0; b = blocks[b].parent {
+		if blocks[b].pool {
+			pool++
+		}
+	}
+	height := blocks[best].height
+	return SelfishSimResult{
+		OrphanRate:   float64(cfg.Blocks-height) / float64(cfg.Blocks),
+		RevenueShare: float64(pool) / float64(height),
+		Expected:     selfishRevenue(cfg.Share, 0),
+	}, nil
+}
+
+// Revenue share of a selfish pool of share a winning a share g of the races, after Eyal and Sirer
+func selfishRevenue(a, g float64) float64 {
+	return (a*(1-a)*(1-a)*(4*a+g*(1-2*a)) - a*a*a) / (1 - a*(1+(2-a)*a))
+}
+
+// Print the orphan rate and revenue of an honest and a selfish pool, with and without latency
+func printSelfishSim(out *Output) error {
+	cfg := DefaultSelfishSimConfig(0, false, 0)
+	out.Note("%v blocks found every %vs on average, by a pool and %v honest miners", cfg.Blocks, cfg.Interval, cfg.HonestMiners)
+	type jsonRun struct {
+		Share        float64 `json:"share"`
+		Strategy     string  `json:"strategy"`
+		Latency      float64 `json:"latency"`
+		OrphanRate   float64 `json:"orphanRate"`
+		RevenueShare float64 `json:"revenueShare"`
+		Expected     float64 `json:"expected,omitempty"`
+	}
+	rows, view := [][]string{}, []jsonRun{}
+	for _, share := range []float64{0.1, 0.25, 0.33, 0.4} {
+		for _, latency := range []float64{0, 60} {
+			for _, selfish := range []bool{false, true} {
+				result, err := SimulateSelfish(DefaultSelfishSimConfig(share, selfish, latency))
+				if err != nil {
+					return err
+				}
+				run := jsonRun{share, map[bool]string{false: "honest", true: "selfish"}[selfish], latency, result.OrphanRate, result.RevenueShare, 0}
+				expected := ""
+				if selfish {
+					run.Expected = result.Expected
+					expected = fmt.Sprintf("%.1f%%", 100*run.Expected)
+				}
+				rows = append(rows, []string{fmt.Sprintf("%.0f%%", 100*share), run.Strategy, fmt.Sprintf("%vs", latency),
+					fmt.Sprintf("%.1f%%", 100*run.OrphanRate), fmt.Sprintf("%.1f%%", 100*run.RevenueShare), expected})
+				view = append(view, run)
+			}
+		}
+	}
+	return out.Table([]string{"pool share", "strategy", "latency", "orphans", "pool revenue", "expected"}, rows, view)
+}
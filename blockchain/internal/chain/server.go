@@ -0,0 +1,408 @@
+/*
+ * HTTP API of a Node
+ *
+ *	GET  /chain               full chain dump
+ *	GET  /genesis             genesis spec and hash, to check peers share it
+ *	GET  /headers?from=..     Block headers from a height on, for light clients
+ *	GET  /proofs/{hash}       Merkle proof of a committed transaction
+ *	GET  /bodies?from=..      full Blocks from a height on, for syncing nodes,
+ *	                          JSON or binary, see codec.go
+ *	POST /txns                submit a transaction, JSON or binary, see
+ *	                          ratelimit.go for the limits per client
+ *	POST /blocks              commit outstanding transactions in a Block,
+ *	                          with the admin token, see admin.go
+ *	GET  /mempool?account=..  pending and queued counts of an account
+ *	GET  /books/{base}/{quote} order book and recent trades of an asset pair
+ *	GET  /fees?blocks=..      fee history and next-block fee projection
+ *	GET  /ws?events=block,txn live chain events over a WebSocket
+ *
+ * The block explorer endpoints are listed in explorer.go, the devnet admin
+ * endpoint in devnet.go, the relay endpoints in relay.go and
+ * compactblock.go, the signing test
+ * vector endpoints in signing.go, the mempool snapshot endpoint in
+ * snapshots.go, the pruning receipt endpoints in pruning.go, the inbox
+ * endpoint in messages.go, the backup endpoint in backup.go, the account
+ * history endpoint in addressindex.go, the parameter simulation endpoint
+ * in paramsim.go, the checkpoint endpoint in checkpoints.go, the supply
+ * endpoint in issuance.go, the receipt endpoint in receipts.go, the peer
+ * endpoints in peers.go, the state snapshot endpoint in statesnapshot.go,
+ * the mining progress endpoint in top.go, the event sink endpoint in eventsinks.go, the records
+ * endpoint in records.go, the poll endpoint in voting.go, the token
+ * endpoints in tokens.go, the parameters endpoint in governance.go, the
+ * cancellation endpoint in replace.go, the gRPC service in toychain.proto.
+ * Runtime controls are served apart, on the -admin address, see admin.go
+ */
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Server struct {
+	node  *Node
+	mux   *http.ServeMux
+	hello hello // greeting peers, see handshake.go
+}
+
+func NewServer(node *Node) *Server {
+	s := &Server{node: node, mux: http.NewServeMux(), hello: newHello(node.genesisHash())}
+	s.mux.HandleFunc("GET /chain", s.handleChain)
+	s.mux.HandleFunc("GET /genesis", s.handleGenesis)
+	s.mux.HandleFunc("GET /headers", s.handleHeaders)
+	s.mux.HandleFunc("GET /proofs/{hash}", s.handleProof)
+	s.mux.HandleFunc("GET /bodies", s.handleBodies)
+	s.mux.HandleFunc("POST /txns", s.handleSubmitTxn)
+	s.mux.HandleFunc("POST /txns/{hash}/cancel", s.handleCancelTxn)
+	s.mux.HandleFunc("POST /blocks", s.operator(s.handleCommitBlock))
+	s.mux.HandleFunc("GET /mempool", s.handleMempool)
+	s.mux.HandleFunc("GET /mempool/snapshots", s.handleSnapshots)
+	s.mux.HandleFunc("GET /books/{base}/{quote}", s.handleOrderBook)
+	s.mux.HandleFunc("GET /fees", s.handleFees)
+	s.mux.HandleFunc("GET /fees/estimate", s.handleEstimateFee)
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("GET /kv/{namespace}/{key}", s.handleGetKV)
+	s.mux.HandleFunc("GET /ws", s.handleWebSocket)
+	s.mux.HandleFunc("GET /watch", s.handleWatch)
+	s.mux.HandleFunc("GET /utxos/{owner}", s.handleUTXOs)
+	s.mux.HandleFunc("GET /inbox/{account}", s.handleInbox)
+	s.mux.HandleFunc("GET /records/{schema}", s.handleRecords)
+	s.mux.HandleFunc("GET /polls/{id}", s.handlePoll)
+	s.mux.HandleFunc("GET /names/{name}", s.handleName)
+	s.mux.HandleFunc("GET /tokens", s.handleTokens)
+	s.mux.HandleFunc("GET /tokens/{symbol}", s.handleToken)
+	s.mux.HandleFunc("GET /history/{account}", s.handleHistory)
+	s.mux.HandleFunc("POST /sim/params", s.operator(s.handleParamSim))
+	s.mux.HandleFunc("GET /backups", s.handleBackups)
+	s.mux.HandleFunc("GET /checkpoint", s.handleCheckpoint)
+	s.mux.HandleFunc("GET /supply", s.handleSupply)
+	s.mux.HandleFunc("GET /params", s.handleParams)
+	s.mux.HandleFunc("GET /receipts/{hash}", s.handleReceipt)
+	s.mux.HandleFunc("GET /state/snapshot", s.handleStateSnapshot)
+	s.mux.HandleFunc("GET /mining", s.handleMining)
+	s.mux.HandleFunc("GET /demo/double-spend", s.handleDoubleSpendDemo)
+	s.mux.HandleFunc("GET /demo/channel", s.handleChannelDemo)
+	s.mux.HandleFunc("GET /demo/swap", s.handleSwapDemo)
+	s.mux.HandleFunc("GET /demo/stealth", s.handleStealthDemo)
+	s.mux.HandleFunc("POST /toychain.ToyChain/{method}", s.handleGRPC)
+	s.mux.HandleFunc("POST /dev/difficulty", s.operator(s.handleSetDifficulty))
+	s.mux.HandleFunc("POST /dev/automine", s.operator(s.handleAutoMine))
+	s.mux.HandleFunc("POST /relay/{phase}", s.handleRelay)
+	s.mux.HandleFunc("POST /relay/block", s.handleRelayBlock)
+	s.mux.HandleFunc("POST /relay/blocktxns", s.handleRelayBlockTxns)
+	s.mux.HandleFunc("GET /relay/blocks", s.handleBlockRelayStats)
+	s.mux.HandleFunc("GET /peers", s.handlePeers)
+	s.mux.HandleFunc("GET /event-sinks", s.handleEventSinks)
+	s.mux.HandleFunc("GET /alerts", s.handleAlerts)
+	s.mux.HandleFunc("POST /alerts", s.handleRelayAlert)
+	s.mux.HandleFunc("GET /prune/receipts", s.handlePruneReceipts)
+	s.mux.HandleFunc("POST /prune/verify", s.handlePruneVerify)
+	s.mux.HandleFunc("GET /signing/vectors", s.handleSigningVectors)
+	s.mux.HandleFunc("POST /signing/verify", s.handleSigningVerify)
+	s.registerExplorer()
+	return s
+}
+
+// Serve s on addr over HTTP/1.1 and, for gRPC clients, HTTP/2 without TLS
+func ListenAndServe(addr string, s *Server) error {
+	return newHTTPServer(addr, s).ListenAndServe()
+}
+
+func newHTTPServer(addr string, s *Server) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: s, Protocols: new(http.Protocols)}
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	return srv
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.greet(w, r); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	if LogLevel() == LOG_DEBUG {
+		log.Printf("%v %v from %v", r.Method, r.URL.RequestURI(), r.RemoteAddr)
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func (s *Server) handleChain(w http.ResponseWriter, r *http.Request) {
+	var chain jsonChain
+	s.node.withChain(func(bc *BlockChain) { chain = bc.toJSON() })
+	writeJSON(w, http.StatusOK, chain)
+}
+
+func (s *Server) handleGenesis(w http.ResponseWriter, r *http.Request) {
+	var genesis Genesis
+	var hash string
+	s.node.withChain(func(bc *BlockChain) {
+		genesis = bc.genesis
+		hash = bc.GenesisHash()
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"spec": genesis,
+		"hash": hash,
+	})
+}
+
+// HTTP status reporting err, see errors.go
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrReadReplica), errors.Is(err, ErrDevOnly), errors.Is(err, ErrRelayDisabled),
+		errors.Is(err, ErrPlaintextPeer), errors.Is(err, ErrNoSnapshots), errors.Is(err, ErrNoBackups):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnknownHeight), errors.Is(err, ErrPruned), errors.Is(err, ErrUnknownPeer), errors.Is(err, ErrUnknownWebhook), errors.Is(err, ErrUnknownPoll),
+		errors.Is(err, ErrUnknownToken), errors.Is(err, ErrUnknownName), errors.Is(err, ErrNotPending):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidNonce), errors.Is(err, ErrNonceTaken), errors.Is(err, ErrEmptyMempool), errors.Is(err, ErrTokenExists),
+		errors.Is(err, ErrOtherChain), errors.Is(err, ErrIncompatiblePeer):
+		return http.StatusConflict
+	case errors.Is(err, ErrMempoolFull):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrInvalidTxn), errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrScriptFailed),
+		errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrOutOfGas), errors.Is(err, ErrFeeAsset), errors.Is(err, ErrBlockFull), errors.Is(err, ErrWrongChain), errors.Is(err, ErrLocked), errors.Is(err, ErrFeeTooLow), errors.Is(err, ErrPolicy),
+		errors.Is(err, ErrInvalidRetarget), errors.Is(err, ErrWrongDifficulty), errors.Is(err, ErrInvalidAddress), errors.Is(err, ErrInvalidAlert), errors.Is(err, ErrInvalidReceipt),
+		errors.Is(err, ErrLighterBranch), errors.Is(err, ErrRuleViolation), errors.Is(err, ErrCheckpoint), errors.Is(err, ErrInvalidPeer),
+		errors.Is(err, ErrInvalidWebhook), errors.Is(err, ErrInvalidTimestamp):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Max headers returned by GET /headers
+const MAX_HEADERS = 2000
+
+func (s *Server) handleHeaders(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	headers := []jsonHeader{}
+	s.node.withChain(func(bc *BlockChain) {
+		for height := max(from, 0); height < bc.blocks.Len() && len(headers) < MAX_HEADERS; height++ {
+			b := bc.blockAt(height)
+			headers = append(headers, b.Header.toJSON(b.hash))
+		}
+	})
+	writeJSON(w, http.StatusOK, headers)
+}
+
+// Max Blocks returned by GET /bodies
+const MAX_BODIES = 100
+
+func (s *Server) handleBodies(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	blocks := []Block{}
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		if bc.isPruned(max(from, 1)) {
+			err = fmt.Errorf("%w: block %v, bodies below %v are pruned", ErrPruned, from, bc.pruned)
+			return
+		}
+		for height := max(from, 0); height < bc.blocks.Len() && len(blocks) < MAX_BODIES; height++ {
+			blocks = append(blocks, bc.blockAt(height))
+		}
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	if wantsBinary(r) {
+		writeBinary(w, http.StatusOK, EncodeBlocks(blocks))
+		return
+	}
+	views := make([]jsonBlock, len(blocks))
+	for i, b := range blocks {
+		views[i] = b.toJSON()
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+type jsonMerkleProof struct {
+	Txn       string       `json:"txn"`
+	Height    int          `json:"height"`
+	BlockHash string       `json:"blockHash"`
+	Index     int          `json:"index"` // position in the Block
+	Proof     []MerkleStep `json:"proof"`
+}
+
+func (s *Server) handleProof(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	var proof jsonMerkleProof
+	found := false
+	s.node.withChain(func(bc *BlockChain) {
+		var height int
+		if _, height, found = bc.findTxn(hash); found {
+			b := bc.blockAt(height)
+			for i, txn := range b.data {
+				if txn.Hash() == hash {
+					proof = jsonMerkleProof{hash, height, b.hash, i, merkleProof(b.data, i)}
+					break
+				}
+			}
+		}
+	})
+	if !found {
+		writeError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, proof)
+}
+
+func (s *Server) handleSubmitTxn(w http.ResponseWriter, r *http.Request) {
+	txn, err := readTxn(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if wait, err := s.node.rateLimit(r, txn); err != nil {
+		setRetryAfter(w, wait)
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	tracer := s.node.tracer()
+	parent, _ := parseTraceparent(r.Header.Get("traceparent"))
+	span := tracer.Start("txn.submit", parent)
+	span.SetKind(SPAN_KIND_SERVER)
+	span.SetAttr("http.route", "POST /txns")
+	tracer.followTxn(txn, span)
+	err = s.node.AddTxn(txn)
+	span.End(err)
+	if span != nil {
+		w.Header().Set("traceparent", span.Context().traceparent())
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, txn.toJSON())
+}
+
+func (s *Server) handleCommitBlock(w http.ResponseWriter, r *http.Request) {
+	if err := s.node.CommitBlock(); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	var last jsonBlock
+	s.node.withChain(func(bc *BlockChain) { last = bc.lastBlock().toJSON() })
+	writeJSON(w, http.StatusOK, last)
+}
+
+func (s *Server) handleMempool(w http.ResponseWriter, r *http.Request) {
+	account := r.URL.Query().Get("account")
+	var counts TxnCounts
+	var gap []uint64
+	s.node.withChain(func(bc *BlockChain) {
+		counts = bc.mempool.Counts(account)
+		gap = bc.mempool.NonceGap(account)
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"account":   account,
+		"pending":   counts.Pending,
+		"queued":    counts.Queued,
+		"nextNonce": counts.NextNonce,
+		"nonceGap":  gap,
+	})
+}
+
+func (s *Server) handleOrderBook(w http.ResponseWriter, r *http.Request) {
+	var book jsonOrderBook
+	s.node.withChain(func(bc *BlockChain) {
+		book = bc.OrderBook(r.PathValue("base"), r.PathValue("quote"))
+	})
+	writeJSON(w, http.StatusOK, book)
+}
+
+type jsonEvent struct {
+	Type   string     `json:"type"`
+	Block  *jsonBlock `json:"block,omitempty"`
+	Txn    *jsonTxn   `json:"txn,omitempty"`
+	Alert  *jsonAlert `json:"alert,omitempty"`
+	Status *TxnStatus `json:"status,omitempty"`
+}
+
+// Event types named in filter, eg. block,txn, all of them if empty
+func eventTypes(filter string) []EventType {
+	all := []EventType{NewBlock, NewTxn, NewAlert, RevertedBlock, RevertedTxn, TxnStatusChanged}
+	if filter == "" {
+		return all
+	}
+	var types []EventType
+	for _, name := range strings.Split(filter, ",") {
+		for _, t := range all {
+			if t.String() == name {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+func (ev Event) toJSON() jsonEvent {
+	msg := jsonEvent{Type: ev.Type.String()}
+	if ev.Block != nil {
+		b := ev.Block.toJSON()
+		msg.Block = &b
+	}
+	if ev.Txn != nil {
+		txn := ev.Txn.toJSON()
+		msg.Txn = &txn
+	}
+	if ev.Alert != nil {
+		alert := ev.Alert.toJSON()
+		msg.Alert = &alert
+	}
+	msg.Status = ev.Status
+	return msg
+}
+
+// Stream events to a WebSocket client, all event types unless ?events= is set
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	types := eventTypes(r.URL.Query().Get("events"))
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer ws.Close()
+
+	events := make(chan Event, EVENT_BUFFER_SIZE)
+	for _, t := range types {
+		ch, cancel := s.node.Subscribe(t)
+		defer cancel()
+		go func() {
+			for ev := range ch {
+				select {
+				case events <- ev:
+				case <-ws.Done():
+				}
+			}
+		}()
+	}
+	for {
+		select {
+		case <-ws.Done():
+			return
+		case ev := <-events:
+			payload, _ := json.Marshal(ev.toJSON())
+			if err := ws.WriteText(payload); err != nil {
+				return
+			}
+		}
+	}
+}
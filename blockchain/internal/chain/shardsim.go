@@ -0,0 +1,343 @@
+/*
+ * Sharding simulation.
+ * One chain commits at most a Block of transactions at a time, however
+ * many nodes it has. Sharding splits the accounts among several chains
+ * committing side by side. The simulation runs real chains: shards, each
+ * holding the accounts whose address starts, after the prefix, with a
+ * character of its own, see ShardOf, plus a coordinator chain
+ * crosslinking their Blocks, ie. recording their hashes by height in the
+ * key-value namespace CROSSLINK_NAMESPACE.
+ *
+ * A transfer between two accounts of a shard is a plain transfer. One to
+ * another shard takes three steps, over two rounds at least:
+ *
+ *	- the payer pays the amount to SHARD_BRIDGE on its shard, the data
+ *	  naming the destination shard and payee, locking it there
+ *	- the coordinator crosslinks the Block holding the lock
+ *	- the bridge of the destination shard checks the CrossShardReceipt of
+ *	  the lock, a Merkle proof of the transaction in a crosslinked Block,
+ *	  and pays the payee out of its own reserve, the data naming the lock
+ *
+ * Every round each shard commits a Block of the transfers waiting on it,
+ * bridge payouts first, then the coordinator crosslinks the new Blocks and
+ * the bridges take up the receipts. -shard-sim runs the same transfers on
+ * 1 to SHARD_SIM_MAX shards: the rounds taken fall with the shards, less
+ * than in proportion as more transfers go cross-shard, each costing two
+ * transactions and a round of latency.
+ * Fees are 0, so the coins of the accounts plus those in flight stay the
+ * same throughout, which the simulation checks.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+const (
+	SHARD_BRIDGE        = "bridge"      // account locking and paying out cross-shard transfers on each shard
+	SHARD_COORDINATOR   = "coordinator" // account crosslinking shard Blocks on the coordinator chain
+	CROSSLINK_NAMESPACE = "crosslinks"  // of the coordinator, shard/height -> Block hash
+	SHARD_SIM_MAX       = 8             // shards of -shard-sim
+	SHARD_SIM_BALANCE   = 1000 * COIN   // of each account at genesis
+)
+
+type ShardSimConfig struct {
+	Shards    int // at most len(BECH32_CHARSET)
+	Accounts  int
+	Transfers int
+	Seed      uint64
+}
+
+type ShardSimResult struct {
+	Shards     int
+	Rounds     int     // until every transfer was paid out
+	Txns       int     // committed on the shards, payouts included
+	CrossShard int     // transfers between shards
+	Latency    float64 // mean rounds from the lock of a cross-shard transfer to its payout
+	Conserved  bool    // coins of the accounts and in flight as at genesis
+}
+
+func DefaultShardSimConfig(shards int) ShardSimConfig {
+	return ShardSimConfig{Shards: shards, Accounts: 64, Transfers: 1000, Seed: 1}
+}
+
+/*
+ * Shard of account among shards: the position in BECH32_CHARSET of the
+ * first character of its address after the prefix, of the first byte of
+ * plain names
+ */
+func ShardOf(account string, shards int) int {
+	if account == "" {
+		return 0
+	}
+	if i := strings.LastIndexByte(account, '1'); i >= 0 && i+1 < len(account) {
+		if c := strings.IndexByte(BECH32_CHARSET, account[i+1]); c >= 0 {
+			return c % shards
+		}
+	}
+	return int(account[0]) % shards
+}
+
+// Data of a lock, naming where the transfer goes
+type crossShardMemo struct {
+	Shard int    `json:"shard"`
+	Payee string `json:"payee"`
+}
+
+// Proof that a lock was committed in a crosslinked Block of shard From
+type CrossShardReceipt struct {
+	From   int
+	Height int
+	Header Header
+	Txn    Transaction
+	Proof  []MerkleStep
+}
+
+func crosslinkKey(shard, height int) string {
+	return fmt.Sprintf("%v/%v", shard, height)
+}
+
+// Receipt of the txn at index of the Block at height of shard from
+func newCrossShardReceipt(shard *BlockChain, from, height, index int) CrossShardReceipt {
+	b := shard.blockAt(height)
+	return CrossShardReceipt{from, height, b.Header, b.data[index], merkleProof(b.data, index)}
+}
+
+/*
+ * Check r proves a lock crosslinked by coordinator to shard to, returning
+ * the payee and amount to pay out
+ */
+func (r CrossShardReceipt) verify(coordinator *BlockChain, to int) (string, Amount, error) {
+	hash := r.Header.computeHash()
+	if linked, ok := coordinator.state.getKV(CROSSLINK_NAMESPACE, crosslinkKey(r.From, r.Height)); !ok || string(linked) != hash {
+		return "", 0, fmt.Errorf("block %v of shard %v is not crosslinked", hash, r.From)
+	}
+	if !VerifyMerkleProof(r.Txn.Hash(), r.Header.merkleRoot, r.Proof) {
+		return "", 0, fmt.Errorf("%w: %v in block %v of shard %v", ErrInvalidProof, r.Txn.Hash(), hash, r.From)
+	}
+	var memo crossShardMemo
+	if r.Txn.payee != SHARD_BRIDGE || json.Unmarshal(r.Txn.data, &memo) != nil || memo.Shard != to {
+		return "", 0, fmt.Errorf("%v is not a transfer to shard %v", r.Txn.Hash(), to)
+	}
+	return memo.Payee, r.Txn.amt, nil
+}
+
+type shardSim struct {
+	cfg         ShardSimConfig
+	shards      []*BlockChain
+	coordinator *BlockChain
+	queues      [][]Transaction // of each shard, waiting for room in a Block
+	nonces      map[string]uint64
+	bridges     []uint64 // next nonce of the bridge of each shard
+	linked      []int    // last height of each shard crosslinked
+	locked      map[string]int
+	result      ShardSimResult
+	latency     int
+}
+
+// Chain of the shard or coordinator called id, funding alloc
+func shardSimChain(id string, alloc map[string]Amount) *BlockChain {
+	g := DefaultGenesis(1)
+	g.ChainID = id
+	g.UnixTs = 1_700_000_000_000_000
+	g.Alloc = alloc
+	bc := CreateBlockChain(g)
+	bc.SetClock(NewStepClock(time.UnixMicro(g.UnixTs).Add(time.Second), time.Second))
+	return &bc
+}
+
+func newShardSim(cfg ShardSimConfig) *shardSim {
+	sim := &shardSim{
+		cfg:         cfg,
+		coordinator: shardSimChain("coordinator", map[string]Amount{}),
+		queues:      make([][]Transaction, cfg.Shards),
+		nonces:      map[string]uint64{},
+		bridges:     make([]uint64, cfg.Shards),
+		linked:      make([]int, cfg.Shards),
+		locked:      map[string]int{},
+		result:      ShardSimResult{Shards: cfg.Shards},
+	}
+	accounts := []string{}
+	allocs := make([]map[string]Amount, cfg.Shards)
+	for i := range allocs {
+		// Enough for the bridge to pay out every coin of the other shards
+		allocs[i] = map[string]Amount{SHARD_BRIDGE: Amount(cfg.Accounts) * SHARD_SIM_BALANCE}
+	}
+	for i := range cfg.Accounts {
+		account := NewAddress([]byte(fmt.Sprint("shard sim account ", i)), ADDRESS_PREFIX)
+		accounts = append(accounts, account)
+		allocs[ShardOf(account, cfg.Shards)][account] = SHARD_SIM_BALANCE
+	}
+	for i, alloc := range allocs {
+		sim.shards = append(sim.shards, shardSimChain(fmt.Sprintf("shard%v", i), alloc))
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, 0))
+	for range cfg.Transfers {
+		i := rng.IntN(len(accounts))
+		payer, payee := accounts[i], accounts[(i+1+rng.IntN(len(accounts)-1))%len(accounts)]
+		from, to := ShardOf(payer, cfg.Shards), ShardOf(payee, cfg.Shards)
+		txn := Transaction{payer: payer, payee: payee, amt: Amount(1+rng.IntN(5)) * COIN, nonce: sim.nonces[payer]}
+		if from != to {
+			memo, _ := json.Marshal(crossShardMemo{to, payee})
+			txn = Transaction{payer: payer, payee: SHARD_BRIDGE, amt: txn.amt, nonce: txn.nonce}.WithData(memo)
+			sim.result.CrossShard++
+		}
+		sim.queues[from] = append(sim.queues[from], txn)
+		sim.nonces[payer]++
+	}
+	return sim
+}
+
+// Commit a Block of the transfers waiting on each shard, noting the payouts of round
+func (sim *shardSim) commitShards(round int) error {
+	for i, shard := range sim.shards {
+		n := min(len(sim.queues[i]), shard.blockLimits().Txns)
+		for _, txn := range sim.queues[i][:n] {
+			if err := shard.AddTxn(txn); err != nil {
+				return fmt.Errorf("shard %v: %w", i, err)
+			}
+		}
+		sim.queues[i] = sim.queues[i][n:]
+		if err := shard.CommitBlock(); errors.Is(err, ErrEmptyMempool) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("shard %v: %w", i, err)
+		}
+		for _, txn := range shard.lastBlock().data {
+			if txn.payer == SHARD_BRIDGE {
+				sim.latency += round - sim.locked[string(txn.data)]
+			}
+			sim.result.Txns++
+		}
+	}
+	return nil
+}
+
+// Crosslink the new Blocks of the shards on the coordinator, returning their heights by shard
+func (sim *shardSim) crosslink() ([][]int, error) {
+	heights := make([][]int, len(sim.shards))
+	for i, shard := range sim.shards {
+		for height := sim.linked[i] + 1; height < shard.blocks.Len(); height++ {
+			txn := NewKVWrite(SHARD_COORDINATOR, sim.nonces[SHARD_COORDINATOR], CROSSLINK_NAMESPACE, crosslinkKey(i, height), []byte(shard.blockAt(height).hash))
+			if err := sim.coordinator.AddTxn(txn); err != nil {
+				return nil, fmt.Errorf("coordinator: %w", err)
+			}
+			sim.nonces[SHARD_COORDINATOR]++
+			heights[i] = append(heights[i], height)
+			sim.linked[i] = height
+		}
+	}
+	for {
+		if err := sim.coordinator.CommitBlock(); errors.Is(err, ErrEmptyMempool) {
+			return heights, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("coordinator: %w", err)
+		}
+	}
+}
+
+// Queue the payouts of the locks in the Blocks crosslinked in round
+func (sim *shardSim) payOut(round int, heights [][]int) error {
+	for from, shard := range sim.shards {
+		for _, height := range heights[from] {
+			for index, txn := range shard.blockAt(height).data {
+				var memo crossShardMemo
+				if txn.payee != SHARD_BRIDGE || json.Unmarshal(txn.data, &memo) != nil {
+					continue
+				}
+				payee, amt, err := newCrossShardReceipt(shard, from, height, index).verify(sim.coordinator, memo.Shard)
+				if err != nil {
+					return err
+				}
+				payout := Transaction{payer: SHARD_BRIDGE, payee: payee, amt: amt, nonce: sim.bridges[memo.Shard]}.WithData([]byte(txn.Hash()))
+				sim.bridges[memo.Shard]++
+				sim.queues[memo.Shard] = append([]Transaction{payout}, sim.queues[memo.Shard]...)
+				sim.locked[txn.Hash()] = round
+			}
+		}
+	}
+	return nil
+}
+
+func (sim *shardSim) done() bool {
+	for i, queue := range sim.queues {
+		if len(queue) > 0 || sim.shards[i].mempool.Len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the coins of the accounts and bridges add up to those of the genesis
+func (sim *shardSim) conserved() bool {
+	var total Amount
+	for _, shard := range sim.shards {
+		for account, balances := range shard.state.balances {
+			total += balances[NATIVE_ASSET]
+			if account == SHARD_BRIDGE {
+				total -= Amount(sim.cfg.Accounts) * SHARD_SIM_BALANCE
+			}
+		}
+	}
+	return total == Amount(sim.cfg.Accounts)*SHARD_SIM_BALANCE
+}
+
+// Run the transfers of cfg round by round until every one is paid out
+func SimulateShards(cfg ShardSimConfig) (ShardSimResult, error) {
+	if cfg.Shards < 1 || cfg.Shards > len(BECH32_CHARSET) || cfg.Accounts < 2 {
+		return ShardSimResult{}, fmt.Errorf("%v shards of %v accounts, want 1 to %v shards of 2 accounts or more", cfg.Shards, cfg.Accounts, len(BECH32_CHARSET))
+	}
+	sim := newShardSim(cfg)
+	for round := 1; !sim.done(); round++ {
+		if err := sim.commitShards(round); err != nil {
+			return sim.result, err
+		}
+		heights, err := sim.crosslink()
+		if err != nil {
+			return sim.result, err
+		}
+		if err := sim.payOut(round, heights); err != nil {
+			return sim.result, err
+		}
+		sim.result.Rounds = round
+	}
+	if sim.result.CrossShard > 0 {
+		sim.result.Latency = float64(sim.latency) / float64(sim.result.CrossShard)
+	}
+	sim.result.Conserved = sim.conserved()
+	return sim.result, nil
+}
+
+// Print the rounds the same transfers take on 1 to SHARD_SIM_MAX shards
+func printShardSim(out *Output) error {
+	cfg := DefaultShardSimConfig(1)
+	out.Note("%v transfers between %v accounts, blocks of at most %v transactions, a round a block",
+		cfg.Transfers, cfg.Accounts, MAX_TXNS_PER_BLOCK)
+	type jsonRun struct {
+		Shards     int     `json:"shards"`
+		Rounds     int     `json:"rounds"`
+		Txns       int     `json:"txns"`
+		CrossShard int     `json:"crossShard"`
+		Latency    float64 `json:"latency"`
+		Conserved  bool    `json:"conserved"`
+	}
+	rows, view := [][]string{}, []jsonRun{}
+	for shards := 1; shards <= SHARD_SIM_MAX; shards *= 2 {
+		r, err := SimulateShards(DefaultShardSimConfig(shards))
+		if err != nil {
+			return err
+		}
+		run := jsonRun{r.Shards, r.Rounds, r.Txns, r.CrossShard, r.Latency, r.Conserved}
+		rows = append(rows, []string{
+			fmt.Sprint(run.Shards), fmt.Sprint(run.Rounds), fmt.Sprintf("%.1f", float64(cfg.Transfers)/float64(run.Rounds)),
+			fmt.Sprint(run.CrossShard), fmt.Sprintf("%.1f", run.Latency), map[bool]string{true: "yes", false: "NO"}[run.Conserved],
+		})
+		view = append(view, run)
+	}
+	return out.Table([]string{"shards", "rounds", "transfers/round", "cross-shard", "latency", "conserved"}, rows, view)
+}
@@ -0,0 +1,604 @@
+/*
+ * Interactive shell.
+ * -shell reads commands from the terminal and runs them against the chain
+ * built from the other flags, the demo chain by default, and -shell-node
+ * against the node API at a URL:
+ *
+ *	toychain> send alice bob 10
+ *	toychain> mine
+ *	toychain> balance bob
+ *	toychain> block 3
+ *
+ * Every command goes through the HTTP API, served in-process without a
+ * socket when the chain is local, so what a shell does a script does with
+ * curl. Accounts may be given as @name, resolved on the chain, see
+ * names.go. Transfers are not signed: the shell is for the demo accounts,
+ * not for accounts with a bound key, and it fills in the next nonce and
+ * the chain ID.
+ *
+ * On a terminal Tab completes the commands and the accounts seen so far,
+ * from the genesis allocations on, and the arrows recall earlier lines:
+ * the terminal is switched to raw mode with stty while a line is read.
+ * Commands piped on stdin run without prompts, the exit code telling
+ * whether one failed.
+ */
+package chain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const SHELL_PROMPT = "toychain> "
+
+// Blocks listed by the blocks command without a count
+const SHELL_BLOCKS = 10
+
+type shellCommand struct {
+	name     string
+	args     string // usage, its ACCOUNT, PAYER and PAYEE arguments completed with accounts
+	help     string
+	min, max int // number of arguments
+	run      func(sh *shell, args []string) error
+}
+
+type shell struct {
+	node     *peerClient
+	out      *Output
+	chainID  string
+	accounts map[string]bool // completion candidates
+	commands []shellCommand
+}
+
+// Transport serving requests with a handler in-process
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.h.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// Client of the API of node without a listener, see runShell
+func newLocalClient(node *Node) *peerClient {
+	return &peerClient{url: "http://toychain", client: &http.Client{Transport: handlerTransport{localOperator(NewServer(node))}}}
+}
+
+func newShell(node *peerClient, out *Output) *shell {
+	sh := &shell{node: node, out: out, accounts: map[string]bool{}}
+	sh.commands = []shellCommand{
+		{"send", "PAYER PAYEE AMOUNT [FEE]", "submit a transfer with the next nonce of PAYER", 3, 4, (*shell).send},
+		{"mine", "", "commit the pending transactions in a block", 0, 0, (*shell).mine},
+		{"balance", "ACCOUNT [HEIGHT]", "balances of ACCOUNT, as of HEIGHT if set", 1, 2, (*shell).balance},
+		{"block", "HEIGHT|HASH", "block and its transactions", 1, 1, (*shell).block},
+		{"blocks", "[COUNT]", fmt.Sprintf("latest blocks, %v by default", SHELL_BLOCKS), 0, 1, (*shell).blocks},
+		{"txn", "HASH", "committed transaction", 1, 1, (*shell).txn},
+		{"mempool", "ACCOUNT", "pending and queued transactions of ACCOUNT", 1, 1, (*shell).mempool},
+		{"register", "OWNER NAME [ADDRESS]", "point NAME at ADDRESS as OWNER, claiming it if free, releasing it without ADDRESS", 2, 3, (*shell).register},
+		{"resolve", "NAME", "owner and address of NAME", 1, 1, (*shell).resolve},
+		{"fee", "[TARGET]", "fee likely to get a transaction into the next TARGET blocks, 1 by default", 0, 1, (*shell).fee},
+		{"stats", "", "height, mempool size and difficulty", 0, 0, (*shell).stats},
+		{"help", "", "list the commands", 0, 0, (*shell).help},
+		{"exit", "", "leave the shell, as does Ctrl-D", 0, 0, nil},
+	}
+	return sh
+}
+
+/*
+ * Run the commands read from in against node until exit or the end of
+ * input, returning the exit code
+ */
+func runShell(node *peerClient, in *os.File, out *Output) int {
+	sh := newShell(node, out)
+	g, _, err := node.genesis()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	sh.chainID = g.ChainID
+	for account := range g.Alloc {
+		sh.accounts[account] = true
+	}
+	var lines *lineReader
+	if info, err := in.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		lines = newLineReader(in, sh.complete)
+		out.Note("%v, type help for the commands", node.url)
+	}
+	scanner := bufio.NewScanner(in)
+	code := 0
+	for {
+		var line string
+		if lines != nil {
+			if line, err = lines.read(SHELL_PROMPT); err != nil {
+				break
+			}
+		} else if scanner.Scan() {
+			line = scanner.Text()
+		} else {
+			err = scanner.Err()
+			break
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "exit" || words[0] == "quit" {
+			break
+		}
+		if err := sh.exec(words); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			code = 1
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if lines != nil {
+		return 0
+	}
+	return code
+}
+
+func (sh *shell) exec(words []string) error {
+	for _, c := range sh.commands {
+		if c.name != words[0] || c.run == nil {
+			continue
+		}
+		args := words[1:]
+		if len(args) < c.min || len(args) > c.max {
+			return fmt.Errorf("usage: %v %v", c.name, c.args)
+		}
+		for i, arg := range args {
+			name, ok := strings.CutPrefix(arg, NAME_SIGIL)
+			if !ok || !sh.takesAccount(c.name, i) {
+				continue
+			}
+			rec, err := sh.lookup(name)
+			if err != nil {
+				return err
+			}
+			sh.accounts[arg] = true
+			args[i] = rec.Address
+		}
+		return c.run(sh, args)
+	}
+	return fmt.Errorf("unknown command %q, type help for the commands", words[0])
+}
+
+func (sh *shell) send(args []string) error {
+	amt, err := ParseAmount(args[2])
+	if err != nil {
+		return err
+	}
+	var fee Amount
+	if len(args) == 4 {
+		if fee, err = ParseAmount(args[3]); err != nil {
+			return err
+		}
+	}
+	var counts struct {
+		NextNonce uint64 `json:"nextNonce"`
+	}
+	if _, err := sh.node.get("/mempool?account="+url.QueryEscape(args[0]), &counts); err != nil {
+		return err
+	}
+	j := jsonTxn{Payer: args[0], Payee: args[1], Amt: amt, Fee: fee, Nonce: counts.NextNonce, ChainID: sh.chainID}
+	if err := sh.node.send(http.MethodPost, "/txns", j, &j); err != nil {
+		return err
+	}
+	sh.accounts[args[0]], sh.accounts[args[1]] = true, true
+	return sh.out.Record([][2]string{
+		{"hash", j.transaction().Hash()},
+		{"nonce", fmt.Sprint(j.Nonce)},
+	}, j)
+}
+
+func (sh *shell) mine([]string) error {
+	var b jsonBlock
+	if err := sh.node.send(http.MethodPost, "/blocks", nil, &b); err != nil {
+		return err
+	}
+	var tip []jsonBlockSummary
+	if _, err := sh.node.get("/blocks?limit=1", &tip); err != nil {
+		return err
+	}
+	for _, txn := range b.Data {
+		sh.accounts[txn.Payer] = true
+	}
+	height := ""
+	if len(tip) == 1 && tip[0].Hash == b.Hash {
+		height = fmt.Sprint(tip[0].Height)
+	}
+	return sh.out.Record([][2]string{
+		{"hash", b.Hash},
+		{"height", height},
+		{"txns", fmt.Sprint(len(b.Data))},
+		{"nonce", fmt.Sprint(b.Nonce)},
+	}, b)
+}
+
+func (sh *shell) balance(args []string) error {
+	path := "/accounts/" + url.PathEscape(args[0])
+	if len(args) == 2 {
+		path += "?height=" + url.QueryEscape(args[1])
+	}
+	var a jsonAccount
+	if _, err := sh.node.get(path, &a); err != nil {
+		return err
+	}
+	sh.accounts[a.Account] = true
+	fields := [][2]string{{"balance", fmt.Sprint(a.Balance)}}
+	for _, asset := range sortedKeys(a.Assets) {
+		if asset != NATIVE_ASSET {
+			fields = append(fields, [2]string{asset, fmt.Sprint(a.Assets[asset])})
+		}
+	}
+	fields = append(fields, [2]string{"txns", fmt.Sprint(len(a.Txns))})
+	return sh.out.Record(fields, a)
+}
+
+func (sh *shell) block(args []string) error {
+	var b jsonBlockDetail
+	found, err := sh.node.get("/blocks/"+url.PathEscape(args[0]), &b)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("block %v not found", args[0])
+	}
+	err = sh.out.Record([][2]string{
+		{"hash", b.Hash},
+		{"height", fmt.Sprint(b.Height)},
+		{"prev", b.PrevHash},
+		{"time", time.UnixMicro(b.UnixTs).UTC().Format(time.RFC3339)},
+		{"miner", b.Miner},
+		{"difficulty", fmt.Sprint(b.Difficulty)},
+		{"nonce", fmt.Sprint(b.Nonce)},
+	}, b)
+	if err != nil || sh.out.mode != OutputTable || len(b.Txns) == 0 {
+		return err
+	}
+	return sh.out.Table([]string{"hash", "kind", "payer", "payee", "amount", "fee"}, sh.txnRows(b.Txns), b.Txns)
+}
+
+func (sh *shell) txnRows(txns []jsonTxnRef) [][]string {
+	rows := [][]string{}
+	for _, t := range txns {
+		sh.accounts[t.Payer] = true
+		if t.Payee != "" {
+			sh.accounts[t.Payee] = true
+		}
+		rows = append(rows, []string{t.Hash, TXN_KIND_NAMES[t.Kind], t.Payer, t.Payee, fmt.Sprintf("%v%v", t.Amt, assetSuffix(t.Asset)), fmt.Sprint(t.Fee)})
+	}
+	return rows
+}
+
+func (sh *shell) blocks(args []string) error {
+	count := SHELL_BLOCKS
+	if len(args) == 1 {
+		var err error
+		if count, err = strconv.Atoi(args[0]); err != nil || count <= 0 {
+			return fmt.Errorf("count %q is not a positive number", args[0])
+		}
+	}
+	var blocks []jsonBlockSummary
+	if _, err := sh.node.get(fmt.Sprintf("/blocks?limit=%v", count), &blocks); err != nil {
+		return err
+	}
+	rows := [][]string{}
+	for _, b := range blocks {
+		rows = append(rows, []string{fmt.Sprint(b.Height), b.Hash, time.UnixMicro(b.UnixTs).UTC().Format(time.RFC3339), fmt.Sprint(b.Txns)})
+	}
+	return sh.out.Table([]string{"height", "hash", "time", "txns"}, rows, blocks)
+}
+
+func (sh *shell) txn(args []string) error {
+	var t jsonTxnRef
+	found, err := sh.node.get("/txns/"+url.PathEscape(args[0]), &t)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("transaction %v not found", args[0])
+	}
+	rows := sh.txnRows([]jsonTxnRef{t})
+	return sh.out.Record([][2]string{
+		{"hash", t.Hash},
+		{"kind", rows[0][1]},
+		{"payer", t.Payer},
+		{"payee", t.Payee},
+		{"amount", rows[0][4]},
+		{"fee", rows[0][5]},
+		{"nonce", fmt.Sprint(t.Nonce)},
+		{"height", fmt.Sprint(t.Height)},
+		{"confirmations", fmt.Sprint(t.Confirmations)},
+	}, t)
+}
+
+func (sh *shell) mempool(args []string) error {
+	var counts struct {
+		Account   string   `json:"account"`
+		Pending   int      `json:"pending"`
+		Queued    int      `json:"queued"`
+		NextNonce uint64   `json:"nextNonce"`
+		NonceGap  []uint64 `json:"nonceGap"`
+	}
+	if _, err := sh.node.get("/mempool?account="+url.QueryEscape(args[0]), &counts); err != nil {
+		return err
+	}
+	sh.accounts[args[0]] = true
+	return sh.out.Record([][2]string{
+		{"pending", fmt.Sprint(counts.Pending)},
+		{"queued", fmt.Sprint(counts.Queued)},
+		{"next nonce", fmt.Sprint(counts.NextNonce)},
+		{"nonce gap", fmt.Sprint(counts.NonceGap)},
+	}, counts)
+}
+
+func (sh *shell) register(args []string) error {
+	address := ""
+	if len(args) == 3 {
+		address = args[2]
+	}
+	var counts struct {
+		NextNonce uint64 `json:"nextNonce"`
+	}
+	if _, err := sh.node.get("/mempool?account="+url.QueryEscape(args[0]), &counts); err != nil {
+		return err
+	}
+	txn, err := NewNameRegistration(args[0], counts.NextNonce, args[1], address)
+	if err != nil {
+		return err
+	}
+	j := txn.WithChainID(sh.chainID).toJSON()
+	if err := sh.node.send(http.MethodPost, "/txns", j, &j); err != nil {
+		return err
+	}
+	sh.accounts[args[0]], sh.accounts[NAME_SIGIL+args[1]] = true, true
+	return sh.out.Record([][2]string{
+		{"hash", j.transaction().Hash()},
+		{"nonce", fmt.Sprint(j.Nonce)},
+	}, j)
+}
+
+// Owner and address of name, see names.go
+func (sh *shell) lookup(name string) (NameRecord, error) {
+	var rec NameRecord
+	found, err := sh.node.get("/names/"+url.PathEscape(name), &rec)
+	if err == nil && !found {
+		err = fmt.Errorf("%w: %q", ErrUnknownName, name)
+	}
+	return rec, err
+}
+
+func (sh *shell) resolve(args []string) error {
+	rec, err := sh.lookup(strings.TrimPrefix(args[0], NAME_SIGIL))
+	if err != nil {
+		return err
+	}
+	sh.accounts[NAME_SIGIL+rec.Name], sh.accounts[rec.Owner], sh.accounts[rec.Address] = true, true, true
+	return sh.out.Record([][2]string{
+		{"name", rec.Name},
+		{"owner", rec.Owner},
+		{"address", rec.Address},
+	}, rec)
+}
+
+func (sh *shell) stats([]string) error {
+	var stats ChainStats
+	if _, err := sh.node.get("/stats", &stats); err != nil {
+		return err
+	}
+	return sh.out.Record([][2]string{
+		{"height", fmt.Sprint(stats.Height)},
+		{"txns", fmt.Sprint(stats.Txns)},
+		{"mempool", fmt.Sprint(stats.Mempool)},
+		{"difficulty", fmt.Sprint(stats.Difficulty)},
+	}, stats)
+}
+
+func (sh *shell) fee(args []string) error {
+	target := "1"
+	if len(args) == 1 {
+		target = args[0]
+	}
+	var estimate FeeEstimate
+	if err := sh.node.send(http.MethodGet, "/fees/estimate?target="+url.QueryEscape(target), nil, &estimate); err != nil {
+		return err
+	}
+	return sh.out.Record(estimate.fields(), estimate)
+}
+
+func (sh *shell) help([]string) error {
+	rows := [][]string{}
+	for _, c := range sh.commands {
+		rows = append(rows, []string{strings.TrimSpace(c.name + " " + c.args), c.help})
+	}
+	return sh.out.Table(nil, rows, rows)
+}
+
+/*
+ * Completion of the last word of line: the line completed as far as the
+ * candidates agree, and the candidates when they do not
+ */
+func (sh *shell) complete(line string) (string, []string) {
+	words := strings.Fields(line)
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	prefix := words[len(words)-1]
+	var options []string
+	if len(words) == 1 {
+		for _, c := range sh.commands {
+			options = append(options, c.name)
+		}
+	} else if sh.takesAccount(words[0], len(words)-2) {
+		options = sortedKeys(sh.accounts)
+	}
+	var candidates []string
+	for _, o := range options {
+		if strings.HasPrefix(o, prefix) {
+			candidates = append(candidates, o)
+		}
+	}
+	if len(candidates) == 0 {
+		return line, nil
+	}
+	common := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	line += common[len(prefix):]
+	if len(candidates) == 1 {
+		return line + " ", nil
+	}
+	return line, candidates
+}
+
+// Whether argument i of the command name is an account
+func (sh *shell) takesAccount(name string, i int) bool {
+	for _, c := range sh.commands {
+		usage := strings.Fields(c.args)
+		if c.name == name && i < len(usage) {
+			return strings.Contains(usage[i], "ACCOUNT") || strings.Contains(usage[i], "ADDRESS") || slices.Contains([]string{"PAYER", "PAYEE", "OWNER"}, usage[i])
+		}
+	}
+	return false
+}
+
+/*
+ * Line editor of a terminal in raw mode: Tab completes, the up and down
+ * arrows walk the history, Ctrl-C drops the line and Ctrl-D on an empty
+ * line ends the input
+ */
+type lineReader struct {
+	in       *bufio.Reader
+	tty      *os.File
+	complete func(line string) (string, []string)
+	history  []string
+}
+
+func newLineReader(tty *os.File, complete func(string) (string, []string)) *lineReader {
+	return &lineReader{in: bufio.NewReader(tty), tty: tty, complete: complete}
+}
+
+// Run stty on the terminal, returning its output
+func (lr *lineReader) stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = lr.tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Line typed after prompt, without editing if the terminal cannot be switched to raw mode
+func (lr *lineReader) read(prompt string) (string, error) {
+	fmt.Print(prompt)
+	saved, err := lr.stty("-g")
+	if err == nil {
+		_, err = lr.stty("raw", "-echo")
+	}
+	if err != nil {
+		line, err := lr.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer lr.stty(saved)
+	line, err := lr.edit(prompt)
+	fmt.Print("\r\n")
+	if err == nil && strings.TrimSpace(line) != "" && (len(lr.history) == 0 || lr.history[len(lr.history)-1] != line) {
+		lr.history = append(lr.history, line)
+	}
+	return line, err
+}
+
+func (lr *lineReader) edit(prompt string) (string, error) {
+	line := ""
+	recalled := len(lr.history)
+	redraw := func() { fmt.Printf("\r\x1b[K%v%v", prompt, line) }
+	for {
+		c, err := lr.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '\r' || c == '\n':
+			return line, nil
+		case c == 3: // Ctrl-C
+			fmt.Print("^C\r\n" + prompt)
+			line, recalled = "", len(lr.history)
+		case c == 4: // Ctrl-D
+			if line == "" {
+				return "", io.EOF
+			}
+		case c == 127 || c == '\b':
+			if line != "" {
+				_, size := utf8.DecodeLastRuneInString(line)
+				line = line[:len(line)-size]
+				fmt.Print("\b \b")
+			}
+		case c == '\t':
+			var candidates []string
+			line, candidates = lr.complete(line)
+			if len(candidates) > 0 {
+				fmt.Print("\r\n" + strings.Join(candidates, "  "))
+				fmt.Print("\r\n")
+			}
+			redraw()
+		case c == 0x1b: // escape sequence, only the up and down arrows are handled
+			seq, err := lr.escape()
+			if err != nil {
+				return "", err
+			}
+			switch {
+			case seq == "[A" && recalled > 0:
+				recalled--
+			case seq == "[B" && recalled < len(lr.history):
+				recalled++
+			default:
+				continue
+			}
+			line = ""
+			if recalled < len(lr.history) {
+				line = lr.history[recalled]
+			}
+			redraw()
+		case c >= ' ':
+			line += string([]byte{c})
+			os.Stdout.Write([]byte{c})
+		}
+	}
+}
+
+// Rest of an escape sequence after ESC
+func (lr *lineReader) escape() (string, error) {
+	seq := []byte{}
+	for {
+		c, err := lr.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, c)
+		if len(seq) > 1 && (c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '~') || seq[0] != '[' && seq[0] != 'O' {
+			return string(seq), nil
+		}
+	}
+}
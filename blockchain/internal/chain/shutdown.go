@@ -0,0 +1,199 @@
+/*
+ * Graceful shutdown.
+ * A node serving its API with -http stops on SIGINT or SIGTERM, or as its
+ * -shell or -top exits, rather than dying halfway through a Block:
+ *
+ *	1. the API stops taking requests and finishes those in flight, within
+ *	   SHUTDOWN_TIMEOUT
+ *	2. the Miner stops, after the Block it is mining if any
+ *	3. backups, pruning and Mempool snapshots stop
+ *	4. the transactions held in the Mempool are written to -mempool-file
+ *	5. the hot Blocks are written to cold storage, so -recover finds them
+ *	   all, see TieredStore.Flush
+ *	6. the events queued for the event sinks are published, see
+ *	   eventsinks.go
+ *	7. the spans left are sent to the collector, see tracing.go
+ *
+ * Started again with the same -mempool-file, the node submits the saved
+ * transactions to its Mempool before serving, dropping those committed
+ * meanwhile or no longer valid. A second signal kills the node at once.
+ */
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SHUTDOWN_TIMEOUT    = 10 * time.Second // for the requests in flight
+	MEMPOOL_FILE_FORMAT = "toychain-mempool"
+)
+
+type mempoolFile struct {
+	Format      string    `json:"format"`
+	GenesisHash string    `json:"genesisHash"`
+	Height      int       `json:"height"` // of the chain when saved
+	Txns        []jsonTxn `json:"txns"`   // pending then queued
+}
+
+// Write the transactions held in the Mempool to path, returning how many
+func (bc *BlockChain) SaveMempool(path string) (int, error) {
+	f := mempoolFile{Format: MEMPOOL_FILE_FORMAT, GenesisHash: bc.GenesisHash(), Height: bc.blocks.Len() - 1, Txns: []jsonTxn{}}
+	for _, txn := range bc.mempool.held() {
+		f.Txns = append(f.Txns, txn.toJSON())
+	}
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return 0, err
+	}
+	// Renamed into place, a crash while writing leaves the last file whole
+	if err := os.WriteFile(path+".tmp", append(raw, '\n'), 0o600); err != nil {
+		return 0, err
+	}
+	return len(f.Txns), os.Rename(path+".tmp", path)
+}
+
+/*
+ * Submit the transactions saved to path by SaveMempool again, returning
+ * how many the Mempool took and how many it refused. A missing file
+ * restores nothing
+ */
+func (bc *BlockChain) RestoreMempool(path string) (restored, dropped int, err error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var f mempoolFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return 0, 0, fmt.Errorf("reading mempool file %v: %w", path, err)
+	}
+	if f.Format != MEMPOOL_FILE_FORMAT {
+		return 0, 0, fmt.Errorf("%v is not a mempool file", path)
+	}
+	if f.GenesisHash != bc.GenesisHash() {
+		return 0, 0, fmt.Errorf("mempool file %v is of genesis %v, the chain has %v", path, f.GenesisHash, bc.GenesisHash())
+	}
+	for _, j := range f.Txns {
+		if bc.AddTxn(j.transaction()) != nil {
+			dropped++
+			continue
+		}
+		restored++
+	}
+	return restored, dropped, nil
+}
+
+// Stop the background jobs of the node and persist what would be lost, steps 3 to 7 above
+func (n *Node) Shutdown(mempoolFile string) error {
+	n.StopBackups()
+	n.StopPruning()
+	n.StopSnapshots()
+	var errs []error
+	n.mu.Lock()
+	if mempoolFile != "" {
+		saved, err := n.bc.SaveMempool(mempoolFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saving the mempool: %w", err))
+		} else {
+			log.Printf("saved %v transactions to %v", saved, mempoolFile)
+		}
+	}
+	if err := n.bc.blocks.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	n.mu.Unlock()
+	n.stopEventSinks()
+	n.bc.tracer.Close()
+	return errors.Join(errs...)
+}
+
+// Stores open until the process exits, closed by closeAll
+var openClosers struct {
+	mu      sync.Mutex
+	closers []io.Closer
+}
+
+// Close c as the process exits, whether main returns or calls exit or fatal
+func closeAtExit(c io.Closer) {
+	openClosers.mu.Lock()
+	defer openClosers.mu.Unlock()
+	openClosers.closers = append(openClosers.closers, c)
+}
+
+// Close what closeAtExit took, the last first, once
+func closeAll() {
+	openClosers.mu.Lock()
+	defer openClosers.mu.Unlock()
+	for _, c := range slices.Backward(openClosers.closers) {
+		if err := c.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+	openClosers.closers = nil
+}
+
+// os.Exit, closing the stores first, which deferred calls would not
+func exit(code int) {
+	closeAll()
+	os.Exit(code)
+}
+
+// log.Fatal, closing the stores first
+func fatal(v ...any) {
+	log.Print(v...)
+	exit(1)
+}
+
+// log.Fatalf, closing the stores first
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	exit(1)
+}
+
+// Stop miner, nil if not mining, then node
+func stopNode(miner *Miner, node *Node, mempoolFile string) error {
+	if miner != nil {
+		miner.Stop()
+	}
+	return node.Shutdown(mempoolFile)
+}
+
+// Serve the API of node until SIGINT or SIGTERM, then shut down as above
+func serveUntilSignal(addr string, miner *Miner, node *Node, mempoolFile string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := newHTTPServer(addr, NewServer(node))
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe() }()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	log.Print("shutting down, signal again to kill")
+	timeout, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := srv.Shutdown(timeout); err != nil {
+		log.Printf("stopping the node API: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		log.Print(err)
+	}
+	return stopNode(miner, node, mempoolFile)
+}
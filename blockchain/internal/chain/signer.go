@@ -0,0 +1,230 @@
+/*
+ * Remote signing.
+ * Transactions are signed through a Signer: a Wallet, whose key lives in
+ * the process signing, or a RemoteSigner, client of a signer process
+ * holding the key elsewhere, eg. on another machine, the way a hardware
+ * wallet holds it off the computer:
+ *
+ *	-serve-signer :7000 -signer-account alice -signer-confirm
+ *	-coins alice -pay-utxo bob=5 -signer http://wallet-host:7000
+ *
+ * The signer unlocks the -keystore account once as it starts, then only
+ * ever sends signatures. It is sent whole transactions rather than
+ * digests, so it knows what it signs: it computes the digest itself,
+ * refuses transactions of another chain when bound to one with
+ * -signer-chain and, with -signer-confirm, asks its operator to approve
+ * each transaction, as a hardware wallet asks on its screen. With
+ * -signer-token, requests must carry the token as a bearer token; it
+ * crosses the network in plaintext, so put TLS in front of a signer
+ * reachable beyond a classroom network. The RemoteSigner checks every
+ * signature against the public key the signer announced.
+ *
+ *	GET  /signer       account, scheme, public key and chain of the signer
+ *	POST /signer/sign  {"txn": ..} to {"signature": ..}, 403 if refused
+ */
+package chain
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Holder of the key of an account signing transactions
+type Signer interface {
+	Account() string
+	Scheme() SigScheme
+	PublicKey() []byte
+	ChainID() string                         // only chain signed for, empty for any
+	SignTxn(txn Transaction) ([]byte, error) // signature of the digest of txn
+}
+
+// What a signer process tells of its key, GET /signer
+type SignerInfo struct {
+	Account   string    `json:"account"`
+	Scheme    SigScheme `json:"scheme"`
+	PublicKey []byte    `json:"publicKey"`
+	ChainID   string    `json:"chainId,omitempty"`
+}
+
+type signRequest struct {
+	Txn jsonTxn `json:"txn"`
+}
+
+type signReply struct {
+	Signature []byte `json:"signature"`
+}
+
+// Signer asking a signer process, see SignerServer
+type RemoteSigner struct {
+	peer    *peerClient
+	info    SignerInfo
+	chainID string
+}
+
+// Client of the signer process at url, sending token unless empty
+func NewRemoteSigner(url, token string) (*RemoteSigner, error) {
+	r := &RemoteSigner{peer: newPeerClient(url)}
+	r.peer.token = token
+	found, err := r.peer.get("/signer", &r.info)
+	if err == nil && !found {
+		err = fmt.Errorf("%v is not a signer", url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !r.info.Scheme.valid() {
+		return nil, fmt.Errorf("signer at %v signs with unknown %v", url, r.info.Scheme)
+	}
+	r.chainID = r.info.ChainID
+	return r, nil
+}
+
+// Sign only transactions bound to the chain of ID chainID, as Wallet.SetChainID
+func (r *RemoteSigner) SetChainID(chainID string) error {
+	if r.info.ChainID != "" && chainID != r.info.ChainID {
+		return fmt.Errorf("signer of %v signs for chain %q only, not %q", r.info.Account, r.info.ChainID, chainID)
+	}
+	r.chainID = chainID
+	return nil
+}
+
+func (r *RemoteSigner) Account() string {
+	return r.info.Account
+}
+
+func (r *RemoteSigner) Scheme() SigScheme {
+	return r.info.Scheme
+}
+
+func (r *RemoteSigner) PublicKey() []byte {
+	return append([]byte{}, r.info.PublicKey...)
+}
+
+func (r *RemoteSigner) ChainID() string {
+	return r.chainID
+}
+
+func (r *RemoteSigner) SignTxn(txn Transaction) ([]byte, error) {
+	if txn.scheme != r.info.Scheme {
+		return nil, fmt.Errorf("%v signer of %v cannot sign a transaction of scheme %v", r.info.Scheme, r.info.Account, txn.scheme)
+	}
+	if r.chainID != "" && txn.chainID != r.chainID {
+		return nil, fmt.Errorf("signer of %v signs for chain %q only, not %q", r.info.Account, r.chainID, txn.chainID)
+	}
+	var reply signReply
+	if err := r.peer.send(http.MethodPost, "/signer/sign", signRequest{txn.toJSON()}, &reply); err != nil {
+		return nil, err
+	}
+	if !verifySignature(r.info.Scheme, r.info.PublicKey, txn.digest(), reply.Signature) {
+		return nil, fmt.Errorf("%w: signer of %v answered with a signature of another key", ErrInvalidSignature, r.info.Account)
+	}
+	return reply.Signature, nil
+}
+
+// HTTP API of a signer process, signing with one Wallet
+type SignerServer struct {
+	wallet  *Wallet
+	token   string
+	mu      sync.Mutex                 // approvals one at a time
+	approve func(txn Transaction) bool // nil approves everything
+	mux     *http.ServeMux
+}
+
+// Sign with w the transactions of requests carrying token, any if empty
+func NewSignerServer(w *Wallet, token string) *SignerServer {
+	s := &SignerServer{wallet: w, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /signer", s.handleInfo)
+	s.mux.HandleFunc("POST /signer/sign", s.handleSign)
+	return s
+}
+
+// Have approve decide on each transaction before it is signed
+func (s *SignerServer) SetApproval(approve func(txn Transaction) bool) {
+	s.approve = approve
+}
+
+func (s *SignerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	want := "Bearer " + s.token
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		writeError(w, http.StatusUnauthorized, ErrSignerToken.Error())
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *SignerServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, SignerInfo{
+		Account:   s.wallet.Account(),
+		Scheme:    s.wallet.Scheme(),
+		PublicKey: s.wallet.PublicKey(),
+		ChainID:   s.wallet.ChainID(),
+	})
+}
+
+func (s *SignerServer) handleSign(w http.ResponseWriter, r *http.Request) {
+	var req signRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txn := req.Txn.transaction()
+	s.mu.Lock()
+	approved := s.approve == nil || s.approve(txn)
+	s.mu.Unlock()
+	if !approved {
+		log.Printf("signer: refused %v", txn)
+		writeError(w, http.StatusForbidden, ErrSignerRefused.Error())
+		return
+	}
+	sig, err := s.wallet.SignTxn(txn)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Errorf("%w: %w", ErrSignerRefused, err).Error())
+		return
+	}
+	log.Printf("signer: signed %v", txn)
+	writeJSON(w, http.StatusOK, signReply{sig})
+}
+
+// Approval of transactions by the operator answering y on in, prompted on out
+func confirmTxns(in io.Reader, out io.Writer) func(Transaction) bool {
+	answers := bufio.NewReader(in)
+	return func(txn Transaction) bool {
+		fmt.Fprintf(out, "sign %v, hash %v? [y/N] ", txn, txn.Hash())
+		line, _ := answers.ReadString('\n')
+		return strings.EqualFold(strings.TrimSpace(line), "y")
+	}
+}
+
+// Serve the key of account of the keystore at dir on addr until the process exits
+func runSignerServer(addr, dir, account, token, chainID string, confirm bool) error {
+	ks, err := NewKeystore(dir)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+	w, err := ks.Unlock(account, passphrase)
+	if err != nil {
+		return err
+	}
+	w.SetChainID(chainID)
+	s := NewSignerServer(w, token)
+	if confirm {
+		s.SetApproval(confirmTxns(os.Stdin, os.Stderr))
+	}
+	if token == "" {
+		log.Print("signer: no -signer-token, anyone reaching the signer gets signatures")
+	}
+	log.Printf("signer: serving the %v key of %v on %v", w.Scheme(), account, addr)
+	return http.ListenAndServe(addr, s)
+}
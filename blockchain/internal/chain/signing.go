@@ -0,0 +1,262 @@
+/*
+ * Transaction signing test vectors.
+ * Swaps, UTXO spends, multisig cosignatures and P2PK scripts are signed
+ * by their parties over the digest of the transaction, the SHA-256 of its
+ * canonical payload, which is also the transaction ID. Clients written in
+ * other languages, eg. Python or JS class projects, must build the very
+ * same payload as the node, so the construction is published along with
+ * vectors to check against, see signing/README.md. Each vector holds a
+ * transaction as POST /txns takes it, its payload and digest, the key of
+ * the signer and a signature of the digest. ECDSA signatures are
+ * randomized, so a client signing the digest gets a different signature
+ * that verifies all the same; ed25519 ones, of the transactions naming
+ * that scheme, are deterministic.
+ *
+ *	GET  /signing/vectors  the vectors of SigningVectors
+ *	POST /signing/verify   payload and digest of a transaction as the node
+ *	                       builds them, and whether a signature of the
+ *	                       digest verifies
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+)
+
+type SigningVector struct {
+	Name       string  `json:"name"`
+	Txn        jsonTxn `json:"txn"`
+	Payload    string  `json:"payload"`    // canonical encoding, signatures left out
+	Digest     string  `json:"digest"`     // hex SHA-256 of the payload, signed by the parties
+	PrivateKey []byte  `json:"privateKey"` // P-256 scalar of the signer, big endian, or ed25519 seed
+	PublicKey  []byte  `json:"publicKey"`  // uncompressed SEC 1 point of the signer, or ed25519 key
+	Signature  []byte  `json:"signature"`  // ASN.1 ECDSA or ed25519 signature of the digest
+}
+
+// Signer of the vectors with scheme, its key derived from a fixed seed so vectors are reproducible
+func signingVectorWallet(scheme SigScheme) *Wallet {
+	seed := sha256.Sum256([]byte("toychain signing vectors"))
+	w, err := walletFromRaw("alice", scheme, seed[:])
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// Vectors covering every part of the payload, signed by the key of alice
+func SigningVectors() ([]SigningVector, error) {
+	alice, edAlice := signingVectorWallet(SchemeECDSA), signingVectorWallet(SchemeEd25519)
+	swap := NewSwap(3, NewSwapLeg("alice", "bob", "", 5*COIN), NewSwapLeg("bob", "alice", "gold", 2*COIN))
+	if err := swap.SignSwap(alice); err != nil {
+		return nil, err
+	}
+	utxo := NewUTXOTxn("alice", "bob", 4, 0, []string{utxoID(SHA256([]byte("deposit")), 0)}, NewUTXOOutput("carol", 15*COIN/2))
+	if err := utxo.SignUTXO(alice); err != nil {
+		return nil, err
+	}
+	cosigned := Transaction{payer: "alice", payee: "dave", amt: 5 * COIN, nonce: 6}
+	if err := cosigned.CoSign(alice); err != nil {
+		return nil, err
+	}
+	message, err := NewMessage("alice", 11, "bob", alice.PublicKey(), []byte("meet at noon"))
+	if err != nil {
+		return nil, err
+	}
+	p2pk := Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 8}.WithScript(fmt.Sprintf("0x%x CHECKSIG", alice.PublicKey()))
+	if err := p2pk.SignScript(alice); err != nil {
+		return nil, err
+	}
+	edSwap := NewSwap(12, NewSwapLeg("alice", "bob", "", 5*COIN), NewSwapLeg("bob", "alice", "gold", 2*COIN)).WithScheme(SchemeEd25519)
+	if err := edSwap.SignSwap(edAlice); err != nil {
+		return nil, err
+	}
+	bobSeed := sha256.Sum256([]byte("toychain signing vectors bob"))
+	schnorrBob, err := walletFromRaw("bob", SchemeSchnorr, bobSeed[:])
+	if err != nil {
+		return nil, err
+	}
+	aggSwap := NewSwap(18, NewSwapLeg("alice", "bob", "", 5*COIN), NewSwapLeg("bob", "alice", "gold", 2*COIN)).WithScheme(SchemeSchnorr)
+	for _, s := range []Signer{signingVectorWallet(SchemeSchnorr), schnorrBob} {
+		if err := aggSwap.SignSwap(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := aggSwap.AggregateSignatures(); err != nil {
+		return nil, err
+	}
+	txns := []struct {
+		name string
+		txn  Transaction
+	}{
+		{"transfer", Transaction{payer: "alice", payee: "bob", amt: 10 * COIN, nonce: 0}},
+		{"asset transfer with a fee", Transaction{payer: "alice", payee: "bob", asset: "gold", amt: COIN / 10, fee: COIN / 100_000, nonce: 1}},
+		{"gas priced transfer", Transaction{payer: "alice", payee: "bob", amt: 1234567 * COIN, gasLimit: GAS_TRANSFER, gasPrice: COIN / 2, nonce: 2}},
+		{"large and small amounts", Transaction{payer: "alice", payee: "bob", amt: MAX_AMOUNT, fee: 1, nonce: 2}},
+		{"quoted asset", Transaction{payer: "alice", payee: "bob", asset: `g"old é`, amt: COIN, nonce: 2}},
+		{"batch transfer", NewBatchTransfer("alice", 2, NATIVE_ASSET, NewPayout("bob", 5*COIN), NewPayout("carol", 9*COIN/4))},
+		{"swap", swap},
+		{"order", NewOrder("alice", 3, Buy, "gold", "", 5*COIN/2, 4*COIN)},
+		{"key-value write", NewKVWrite("alice", 3, "notes", "greeting", []byte("hello"))},
+		{"UTXO spend", utxo},
+		{"multisig declaration", NewMultisig("alice", 5, 2, alice.PublicKey(), alice.PublicKey())},
+		{"multisig spend", cosigned},
+		{"access list", Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 7}.WithAccessList()},
+		{"P2PK script", p2pk},
+		{"data", Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 9}.WithData([]byte("document digest"))},
+		{"fee asset", Transaction{payer: "alice", payee: "bob", amt: COIN, fee: COIN / 2, nonce: 10}.WithFeeAsset("gold")},
+		{"message", message},
+		{"record", Transaction{kind: TxnRecord, payer: "alice", nonce: 14, record: &RecordTxn{schema: "shipment", payload: []byte(`{"lot":"42","site":"Lyon"}`)}}},
+		{"token", NewToken("alice", 15, "TOY", "Toy token", 2, 1000*COIN)},
+		{"ed25519 transfer", Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 12}.WithScheme(SchemeEd25519)},
+		{"ed25519 swap", edSwap},
+		{"chain-bound transfer", Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 13}.WithChainID("class-a")},
+		{"time-locked transfer", Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 16, lockHeight: 100, lockTime: 1_700_000_000_000_000}},
+		{"schnorr transfer", Transaction{payer: "alice", payee: "bob", amt: COIN, nonce: 17}.WithScheme(SchemeSchnorr)},
+		{"schnorr aggregated swap", aggSwap},
+	}
+	vectors := []SigningVector{}
+	for _, t := range txns {
+		signer := signingVectorWallet(t.txn.scheme)
+		sig, err := signer.Sign(t.txn.digest())
+		if err != nil {
+			return nil, err
+		}
+		raw, err := signer.rawKey()
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, SigningVector{
+			Name:       t.name,
+			Txn:        t.txn.toJSON(),
+			Payload:    string(t.txn.bytes()),
+			Digest:     hex.EncodeToString(t.txn.digest()),
+			PrivateKey: raw,
+			PublicKey:  signer.PublicKey(),
+			Signature:  sig,
+		})
+	}
+	return vectors, nil
+}
+
+// Check the node builds the payload and digest of v, and that its signature verifies
+func (v SigningVector) check() error {
+	txn := v.Txn.transaction()
+	if payload := string(txn.bytes()); payload != v.Payload {
+		return fmt.Errorf("payload %q, expected %q", payload, v.Payload)
+	}
+	if digest := hex.EncodeToString(txn.digest()); digest != v.Digest {
+		return fmt.Errorf("digest %v, expected %v", digest, v.Digest)
+	}
+	w, err := walletFromRaw("", txn.scheme, v.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("private key: %w", err)
+	}
+	if !slices.Equal(w.PublicKey(), v.PublicKey) {
+		return fmt.Errorf("public key does not match the private key")
+	}
+	if !verifySignature(txn.scheme, v.PublicKey, txn.digest(), v.Signature) {
+		return ErrInvalidSignature
+	}
+	if s := txn.swap; s != nil && s.aggSig != nil {
+		return verifyAggregateOf(txn.scheme, s.keys, s.sigs, txn.digest(), s.aggSig)
+	}
+	return nil
+}
+
+func WriteSigningVectors(path string) error {
+	vectors, err := SigningVectors()
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+// Check the vectors of the file at path, eg. signed by another client, returning the exit code
+func runSigningVectors(path string, write bool, out *Output) int {
+	if write {
+		if err := WriteSigningVectors(path); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	var vectors []SigningVector
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		log.Printf("%v: %v", path, err)
+		return 1
+	}
+	type jsonResult struct {
+		Vector string `json:"vector"`
+		OK     bool   `json:"ok"`
+		Error  string `json:"error,omitempty"`
+	}
+	code, rows, view := 0, [][]string{}, []jsonResult{}
+	for _, v := range vectors {
+		r := jsonResult{Vector: v.Name, OK: true}
+		if err := v.check(); err != nil {
+			r.OK, r.Error, code = false, err.Error(), 1
+		}
+		rows = append(rows, []string{r.Vector, map[bool]string{true: "ok", false: "FAIL"}[r.OK], r.Error})
+		view = append(view, r)
+	}
+	if err := out.Table([]string{"vector", "result", "error"}, rows, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return code
+}
+
+func (s *Server) handleSigningVectors(w http.ResponseWriter, r *http.Request) {
+	vectors, err := SigningVectors()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, vectors)
+}
+
+type jsonSigningCheck struct {
+	Txn       jsonTxn `json:"txn"`
+	PublicKey []byte  `json:"publicKey,omitempty"`
+	Signature []byte  `json:"signature,omitempty"` // of the digest, checked when publicKey is set
+}
+
+type jsonSigningResult struct {
+	Payload string `json:"payload"`
+	Digest  string `json:"digest"`
+	Valid   *bool  `json:"valid,omitempty"`    // whether signature verifies, if publicKey is set
+	TxnErr  string `json:"txnError,omitempty"` // failure of the stateless checks, eg. of the signatures the transaction carries
+}
+
+func (s *Server) handleSigningVerify(w http.ResponseWriter, r *http.Request) {
+	var check jsonSigningCheck
+	if err := json.NewDecoder(r.Body).Decode(&check); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txn := check.Txn.transaction()
+	result := jsonSigningResult{Payload: string(txn.bytes()), Digest: hex.EncodeToString(txn.digest())}
+	if check.PublicKey != nil {
+		valid := verifySignature(txn.scheme, check.PublicKey, txn.digest(), check.Signature)
+		result.Valid = &valid
+	}
+	if err := txn.verify(); err != nil {
+		result.TxnErr = err.Error()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,248 @@
+/*
+ * Mempool snapshots.
+ * During a load test the Mempool fills and drains faster than anyone can
+ * watch GET /fees. A Node may record what its Mempool holds every so
+ * often: how many transactions are pending and queued, of which kinds,
+ * from how many payers, their size and gas, and the distribution of their
+ * fees. Snapshots are appended as JSON lines to a file, which outlives the
+ * Node, so congestion can be analysed after the fact, over the API while
+ * the Node runs or with -show-snapshots once it stopped.
+ *
+ *	GET /mempool/snapshots?from=..&to=..  snapshots taken between two unix
+ *	                                      microsecond timestamps, both optional
+ */
+package chain
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Default time between two snapshots
+const SNAPSHOT_INTERVAL = 10 * time.Second
+
+// Most snapshots a query returns, the latest ones
+const MAX_SNAPSHOTS = 1000
+
+var TXN_KIND_NAMES = map[TxnKind]string{
+	TxnTransfer:    "transfer",
+	TxnSwap:        "swap",
+	TxnMint:        "mint",
+	TxnOrder:       "order",
+	TxnCancelOrder: "cancel-order",
+	TxnKV:          "kv",
+	TxnUTXO:        "utxo",
+	TxnMultisig:    "multisig",
+	TxnMessage:     "message",
+	TxnRecord:      "record",
+	TxnToken:       "token",
+}
+
+type MempoolSnapshot struct {
+	UnixTs  int64          `json:"unixTs"` // unix microseconds
+	Height  int            `json:"height"` // of the last Block
+	Pending int            `json:"pending"`
+	Queued  int            `json:"queued"` // waiting for missing nonces
+	Payers  int            `json:"payers"` // accounts with pending transactions
+	Kinds   map[string]int `json:"kinds"`  // pending transactions by kind
+	Bytes   int            `json:"bytes"`  // encoded size of the pending transactions, see blocksize.go
+	Gas     uint64         `json:"gas"`    // used by the pending transactions
+	Blocks  int            `json:"blocks"` // Blocks needed to pack the pending transactions
+	MinFee  Amount         `json:"minFee"`
+	MaxFee  Amount         `json:"maxFee"`
+	// Fees of the pending transactions at FEE_PERCENTILES
+	Percentiles map[int]Amount `json:"percentiles"`
+}
+
+// Snapshot of the Mempool as of now
+func (bc *BlockChain) MempoolSnapshot() MempoolSnapshot {
+	snap := MempoolSnapshot{
+		UnixTs:      bc.now().UnixMicro(),
+		Height:      bc.blocks.Len() - 1,
+		Pending:     bc.mempool.Len(),
+		Kinds:       map[string]int{},
+		Bytes:       blockSize(bc.mempool.pending),
+		Percentiles: map[int]Amount{},
+	}
+	for _, queue := range bc.mempool.queued {
+		snap.Queued += len(queue)
+	}
+	payers := map[string]bool{}
+	fees := []Amount{}
+	for _, txn := range bc.mempool.pending {
+		payers[txn.payer] = true
+		snap.Kinds[TXN_KIND_NAMES[txn.kind]]++
+		snap.Gas += txn.gas()
+		fees = append(fees, txn.feeValue(bc.mempool.rates))
+	}
+	snap.Payers = len(payers)
+	for ordered, taken := bc.mempool.ordered(), 0; taken < len(ordered); {
+		snap.Blocks++
+		taken, _ = packed(bc.blockLimits(), ordered, snap.Blocks)
+	}
+	slices.Sort(fees)
+	if len(fees) > 0 {
+		snap.MinFee, snap.MaxFee = fees[0], fees[len(fees)-1]
+	}
+	for _, p := range FEE_PERCENTILES {
+		snap.Percentiles[p] = percentile(fees, p)
+	}
+	return snap
+}
+
+// Appends a snapshot of the Mempool of a Node to a file at regular intervals
+type snapshotRecorder struct {
+	path     string
+	interval time.Duration
+	stop     chan struct{} // closed to stop recording
+	done     chan struct{} // closed when the loop exited
+}
+
+/*
+ * Append a snapshot of the Mempool to the file at path every interval,
+ * until StopSnapshots
+ */
+func (n *Node) RecordSnapshots(path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("snapshot interval %v is not positive", interval)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	n.StopSnapshots()
+	rec := &snapshotRecorder{path: path, interval: interval, stop: make(chan struct{}), done: make(chan struct{})}
+	n.mu.Lock()
+	n.snapshots = rec
+	n.mu.Unlock()
+	go n.recordSnapshots(rec, f)
+	return nil
+}
+
+// Stop recording snapshots, a no-op if not recording
+func (n *Node) StopSnapshots() {
+	n.mu.Lock()
+	rec := n.snapshots
+	n.snapshots = nil
+	n.mu.Unlock()
+	if rec != nil {
+		close(rec.stop)
+		<-rec.done
+	}
+}
+
+func (n *Node) recordSnapshots(rec *snapshotRecorder, f *os.File) {
+	defer close(rec.done)
+	defer f.Close()
+	ticker := time.NewTicker(rec.interval)
+	defer ticker.Stop()
+	enc := json.NewEncoder(f)
+	for {
+		select {
+		case <-rec.stop:
+			return
+		case <-ticker.C:
+		}
+		var snap MempoolSnapshot
+		n.withChain(func(bc *BlockChain) { snap = bc.MempoolSnapshot() })
+		if err := enc.Encode(snap); err != nil {
+			log.Printf("snapshots: %v", err)
+		}
+	}
+}
+
+/*
+ * Snapshots of the file at path taken between the unix microsecond
+ * timestamps from and to, both included, to being 0 for no end, at most
+ * the MAX_SNAPSHOTS latest
+ */
+func ReadSnapshots(path string, from, to int64) ([]MempoolSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	snaps := []MempoolSnapshot{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var snap MempoolSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snap); err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", path, line, err)
+		}
+		if snap.UnixTs >= from && (to == 0 || snap.UnixTs <= to) {
+			snaps = append(snaps, snap)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return snaps[max(len(snaps)-MAX_SNAPSHOTS, 0):], nil
+}
+
+// Print the latest snapshots of the file at path, returning the exit code
+func runSnapshots(path string, out *Output) int {
+	snaps, err := ReadSnapshots(path, 0, 0)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	rows := make([][]string, len(snaps))
+	for i, s := range snaps {
+		rows[i] = []string{
+			time.UnixMicro(s.UnixTs).UTC().Format(time.RFC3339),
+			fmt.Sprint(s.Height), fmt.Sprint(s.Pending), fmt.Sprint(s.Queued), fmt.Sprint(s.Payers),
+			fmt.Sprint(s.Bytes), fmt.Sprint(s.Blocks), fmt.Sprint(s.Percentiles[50]), fmt.Sprint(s.MaxFee),
+		}
+	}
+	header := []string{"time", "height", "pending", "queued", "payers", "bytes", "blocks", "median fee", "max fee"}
+	if err := out.Table(header, rows, snaps); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+/*
+ * Snapshots recorded by the Node between from and to, see ReadSnapshots
+ * Fails with ErrNoSnapshots if the Node does not record any
+ */
+func (n *Node) Snapshots(from, to int64) ([]MempoolSnapshot, error) {
+	n.mu.Lock()
+	rec := n.snapshots
+	n.mu.Unlock()
+	if rec == nil {
+		return nil, ErrNoSnapshots
+	}
+	snaps, err := ReadSnapshots(rec.path, from, to)
+	if errors.Is(err, os.ErrNotExist) {
+		return []MempoolSnapshot{}, nil
+	}
+	return snaps, err
+}
+
+func (s *Server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	var bounds [2]int64
+	for i, param := range []string{"from", "to"} {
+		if v := r.URL.Query().Get(param); v != "" {
+			var err error
+			if bounds[i], err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %v: %v", param, v))
+				return
+			}
+		}
+	}
+	snaps, err := s.node.Snapshots(bounds[0], bounds[1])
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, snaps)
+}
@@ -0,0 +1,295 @@
+/*
+ * Account state derived by applying committed transactions in order.
+ * Balances are tracked per asset and start from the genesis allocations.
+ * Every payer must hold its fees in the fee asset and, for transfers and
+ * batch payouts, the amounts it sends, see checkFunds; swaps and orders
+ * require every sender to hold what they give.
+ */
+package chain
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type State struct {
+	balances map[string]map[string]Amount // account -> asset -> balance
+	keys     map[string][]byte            // public key bound to an account on first signature
+	books    map[string]*OrderBook        // order books by asset pair
+	nonces   map[string]uint64            // next transaction nonce per account
+
+	namespaces map[string]string            // key-value namespace -> owner
+	kv         map[string]map[string][]byte // namespace -> key -> value
+	utxos      map[string]UTXO              // unspent outputs by ID
+	multisigs  map[string]*MultisigSpec     // keys and threshold of multisig accounts
+	tokens     map[string]Token             // assets by symbol, see tokens.go
+
+	issuance  *IssuanceSpec // block rewards of the chain, nil for none, see issuance.go
+	height    int           // of the last Block applied
+	supply    Amount        // coins issued up to it
+	governors *governors    // accounts changing the parameters of the chain, nil for none, see governance.go
+}
+
+func NewState() *State {
+	return &State{
+		balances: make(map[string]map[string]Amount),
+		keys:     make(map[string][]byte),
+		books:    make(map[string]*OrderBook),
+		nonces:   make(map[string]uint64),
+
+		namespaces: make(map[string]string),
+		kv:         make(map[string]map[string][]byte),
+		utxos:      make(map[string]UTXO),
+		multisigs:  make(map[string]*MultisigSpec),
+		tokens:     make(map[string]Token),
+	}
+}
+
+// Nonce the next transaction of account must carry
+func (s *State) nonce(account string) uint64 {
+	return s.nonces[account]
+}
+
+func (s *State) Balance(account, asset string) Amount {
+	return s.balances[account][asset]
+}
+
+func (s *State) credit(account, asset string, amt Amount) {
+	if s.balances[account] == nil {
+		s.balances[account] = make(map[string]Amount)
+	}
+	s.balances[account][asset] += amt
+}
+
+// Deep copy, so a Block can be applied tentatively
+func (s *State) clone() *State {
+	c := NewState()
+	for account, assets := range s.balances {
+		for asset, amt := range assets {
+			c.credit(account, asset, amt)
+		}
+	}
+	for account, key := range s.keys {
+		c.keys[account] = key
+	}
+	for pair, book := range s.books {
+		c.books[pair] = book.clone()
+	}
+	for account, nonce := range s.nonces {
+		c.nonces[account] = nonce
+	}
+	for namespace, owner := range s.namespaces {
+		c.namespaces[namespace] = owner
+	}
+	for namespace, pairs := range s.kv {
+		c.kv[namespace] = make(map[string][]byte)
+		for key, value := range pairs {
+			c.kv[namespace][key] = value
+		}
+	}
+	for id, u := range s.utxos {
+		c.utxos[id] = u
+	}
+	for account, m := range s.multisigs {
+		c.multisigs[account] = m
+	}
+	for symbol, t := range s.tokens {
+		c.tokens[symbol] = t
+	}
+	c.issuance, c.height, c.supply, c.governors = s.issuance, s.height, s.supply, s.governors
+	return c
+}
+
+/*
+ * Hash committing to the whole state, equal on every node that applied the
+ * same Blocks
+ */
+func (s *State) Root() string {
+	var packed bytes.Buffer
+	for _, account := range sortedKeys(s.balances) {
+		for _, asset := range sortedKeys(s.balances[account]) {
+			fmt.Fprintf(&packed, "balance|%v|%q|%v\n", account, asset, s.balances[account][asset])
+		}
+	}
+	for _, account := range sortedKeys(s.nonces) {
+		fmt.Fprintf(&packed, "nonce|%v|%v\n", account, s.nonces[account])
+	}
+	for _, account := range sortedKeys(s.keys) {
+		fmt.Fprintf(&packed, "key|%v|%x\n", account, s.keys[account])
+	}
+	for _, pair := range sortedKeys(s.books) {
+		book := s.books[pair]
+		for _, e := range append(append([]*bookEntry{}, book.bids...), book.asks...) {
+			fmt.Fprintf(&packed, "order|%v|%v|%v|%v|%v|%v\n", pair, e.id, e.owner, e.side, e.price, e.remaining)
+		}
+	}
+	for _, namespace := range sortedKeys(s.namespaces) {
+		fmt.Fprintf(&packed, "namespace|%q|%v\n", namespace, s.namespaces[namespace])
+		for _, key := range sortedKeys(s.kv[namespace]) {
+			fmt.Fprintf(&packed, "kv|%q|%q|%x\n", namespace, key, s.kv[namespace][key])
+		}
+	}
+	for _, id := range sortedKeys(s.utxos) {
+		fmt.Fprintf(&packed, "utxo|%v|%v|%v\n", id, s.utxos[id].Owner, s.utxos[id].Amt)
+	}
+	for _, account := range sortedKeys(s.multisigs) {
+		m := s.multisigs[account]
+		fmt.Fprintf(&packed, "multisig|%v|%v", account, m.threshold)
+		for _, key := range m.keys {
+			fmt.Fprintf(&packed, "|%x", key)
+		}
+		packed.WriteString("\n")
+	}
+	// The assets of the genesis are committed to by their balances
+	for _, symbol := range sortedKeys(s.tokens) {
+		if t := s.tokens[symbol]; t.Issuer != "" {
+			fmt.Fprintf(&packed, "token|%q|%q|%v|%v|%v\n", symbol, t.Name, t.Decimals, t.Supply, t.Issuer)
+		}
+	}
+	return SHA256(packed.Bytes())
+}
+
+/*
+ * Bind account to pubKey the first time it signs, and afterwards refuse
+ * signatures made with any other key. Address accounts only bind to the
+ * key they derive from
+ */
+func (s *State) checkKey(account string, pubKey []byte) error {
+	known, ok := s.keys[account]
+	if !ok {
+		if !ownsAccount(account, pubKey) {
+			return fmt.Errorf("%w: key does not hash to address %v", ErrInvalidSignature, account)
+		}
+		s.keys[account] = pubKey
+		return nil
+	}
+	if !bytes.Equal(known, pubKey) {
+		return fmt.Errorf("%w: %v signed with a key it does not own", ErrInvalidSignature, account)
+	}
+	return nil
+}
+
+/*
+ * Apply txn to the state, leaving the state untouched on error
+ * Every transaction but genesis mints must carry the payer's next nonce,
+ * and the fees are charged to the payer, in the fee asset, once the
+ * transaction applies (the miner is credited per Block, see payMiner)
+ */
+func (s *State) apply(txn Transaction) error {
+	if txn.kind == TxnMint {
+		return s.applyKind(txn)
+	}
+	if txn.nonce != s.nonces[txn.payer] {
+		return fmt.Errorf("%w: %v expected nonce %v, got %v", ErrInvalidNonce, txn.payer, s.nonces[txn.payer], txn.nonce)
+	}
+	if err := s.checkMultisig(txn); err != nil {
+		return err
+	}
+	if txn.script != nil {
+		if err := txn.script.run(txn.scheme, txn.digest()); err != nil {
+			return fmt.Errorf("%w: %w", ErrScriptFailed, err)
+		}
+	}
+	if _, ok := s.feeRate(txn.feeAsset); !ok {
+		return fmt.Errorf("%w: no rate published for %v", ErrFeeAsset, txn.feeAsset)
+	}
+	if err := s.checkFunds(txn); err != nil {
+		return err
+	}
+	if err := s.applyKind(txn); err != nil {
+		return err
+	}
+	s.credit(txn.payer, txn.feeAsset, -txn.totalFee())
+	s.nonces[txn.payer]++
+	return nil
+}
+
+// Check the payer can afford the fees and, for transfers, the amounts sent
+func (s *State) checkFunds(txn Transaction) error {
+	fee, sent := txn.totalFee(), Amount(0)
+	if txn.kind == TxnTransfer {
+		sent = txn.transferTotal()
+	}
+	if txn.asset == txn.feeAsset {
+		fee, sent = 0, fee+sent
+	}
+	if sent > 0 && s.Balance(txn.payer, txn.asset) < sent {
+		return fmt.Errorf("%w: %v holds %v%v, needs %v", ErrInsufficientFunds,
+			txn.payer, s.Balance(txn.payer, txn.asset), assetSuffix(txn.asset), sent)
+	}
+	if fee > 0 && s.Balance(txn.payer, txn.feeAsset) < fee {
+		return fmt.Errorf("%w: %v holds %v%v, needs %v for fees", ErrInsufficientFunds,
+			txn.payer, s.Balance(txn.payer, txn.feeAsset), assetSuffix(txn.feeAsset), fee)
+	}
+	return nil
+}
+
+func (s *State) applyKind(txn Transaction) error {
+	switch txn.kind {
+	case TxnTransfer:
+		s.credit(txn.payer, txn.asset, -txn.amt)
+		s.credit(txn.payee, txn.asset, txn.amt)
+		for _, p := range txn.payouts {
+			s.credit(txn.payer, txn.asset, -p.amt)
+			s.credit(p.payee, txn.asset, p.amt)
+		}
+	case TxnSwap:
+		return s.applySwap(txn.swap)
+	case TxnMint:
+		s.credit(txn.payee, txn.asset, txn.amt)
+	case TxnOrder:
+		return s.placeOrder(txn.Hash(), txn.payer, txn.order)
+	case TxnCancelOrder:
+		return s.cancelOrder(txn.payer, txn.order.id)
+	case TxnKV:
+		return s.applyKV(txn.payer, txn.kv)
+	case TxnUTXO:
+		return s.applyUTXO(txn)
+	case TxnMultisig:
+		s.multisigs[txn.payer] = txn.multisig
+	case TxnToken:
+		return s.createToken(txn)
+	}
+	return nil
+}
+
+func (s *State) applySwap(swap *Swap) error {
+	for _, party := range swap.parties() {
+		if known, ok := s.keys[party]; ok && !bytes.Equal(known, swap.keys[party]) {
+			return fmt.Errorf("%w: %v signed with a key it does not own", ErrInvalidSignature, party)
+		}
+		if !ownsAccount(party, swap.keys[party]) {
+			return fmt.Errorf("%w: key does not hash to address %v", ErrInvalidSignature, party)
+		}
+	}
+	// Net effect of all legs per sender and asset, so a party can pass on
+	// what it receives in another leg of the same swap
+	net := make(map[string]map[string]Amount)
+	for _, leg := range swap.legs {
+		for _, change := range []struct {
+			account string
+			amt     Amount
+		}{{leg.from, -leg.amt}, {leg.to, leg.amt}} {
+			if net[change.account] == nil {
+				net[change.account] = make(map[string]Amount)
+			}
+			net[change.account][leg.asset] += change.amt
+		}
+	}
+	for account, assets := range net {
+		for asset, amt := range assets {
+			if amt < 0 && s.Balance(account, asset) < -amt {
+				return fmt.Errorf("%w: %v lacks %q for the swap", ErrInsufficientFunds, account, asset)
+			}
+		}
+	}
+	for _, party := range swap.parties() {
+		s.checkKey(party, swap.keys[party])
+	}
+	for account, assets := range net {
+		for asset, amt := range assets {
+			s.credit(account, asset, amt)
+		}
+	}
+	return nil
+}
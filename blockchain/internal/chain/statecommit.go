@@ -0,0 +1,43 @@
+/*
+ * State commitments.
+ * A chain whose genesis sets stateCommitments has each Block commit to
+ * the Root of the state after it in its Header:
+ *
+ *	"stateCommitments": true
+ *
+ * The root is covered by the Block hash, so the Proof Of Work seals it,
+ * and a node appending the Block refuses it with ErrStateRootMismatch
+ * unless applying the transactions leads it to the same root: two nodes
+ * following the same Blocks provably computed identical state, and a light
+ * client following the headers, see lightclient.go, learns the root of the
+ * state at each height, against which a snapshot of the state can be
+ * checked, see statesnapshot.go. The root hashes the whole state sorted by
+ * key, see State.Root, rather than a Merkle Patricia trie as Ethereum
+ * does, so it proves the state as a whole but not single accounts.
+ *
+ * The Headers of other chains carry no root and hash as before.
+ */
+package chain
+
+import "fmt"
+
+// Commit b to the state it leads to, on chains committing to their state
+func (bc *BlockChain) commitState(b *Block, state *State) {
+	if bc.genesis.StateCommitments {
+		b.stateRoot = state.Root()
+	}
+}
+
+// Check the state root b carries is that of state, the state b leads to
+func (bc *BlockChain) checkStateCommitment(b Block, state *State) error {
+	if !bc.genesis.StateCommitments {
+		if b.stateRoot != "" {
+			return fmt.Errorf("%w: block %v commits to a state, the chain does not", ErrStateRootMismatch, b.hash)
+		}
+		return nil
+	}
+	if root := state.Root(); b.stateRoot != root {
+		return fmt.Errorf("%w: block %v commits to %q, its transactions lead to %v", ErrStateRootMismatch, b.hash, b.stateRoot, root)
+	}
+	return nil
+}
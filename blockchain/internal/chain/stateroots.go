@@ -0,0 +1,53 @@
+/*
+ * State roots by height.
+ * The state of the chain is updated incrementally: a Block is applied to
+ * a copy of the state before it, see DryRun, and the result becomes the
+ * state of the chain once the Block is committed, so balances and nonces
+ * of the last Block are map lookups. As it commits a Block, the chain also
+ * records the Root of the state after it, and:
+ *
+ *	- a state replayed to a past height, see WithHeight and SetArchive,
+ *	  must hash to the root recorded then, or the query fails with
+ *	  ErrStateRootMismatch rather than answer from a diverging state
+ *	- exports carry the root after each Block, which Import checks, see
+ *	  export.go
+ *	- GET /blocks/{id} gives the root after the Block as postStateRoot
+ *
+ * A chain bootstrapped from a state snapshot knows the roots from the
+ * snapshot on only. Pruning keeps the roots of the pruned Blocks.
+ */
+package chain
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Root of the state after the Block at height, ErrPruned if unknown
+func (bc *BlockChain) StateRoot(height int) (string, error) {
+	if height < 0 || height >= len(bc.stateRoots) {
+		return "", fmt.Errorf("%w: %v, chain height %v", ErrUnknownHeight, height, bc.blocks.Len()-1)
+	}
+	if bc.stateRoots[height] == "" {
+		return "", fmt.Errorf("%w: no state root before height %v", ErrPruned, bc.pruned-1)
+	}
+	return bc.stateRoots[height], nil
+}
+
+// Check a state replayed to height against the root recorded when its Block was committed
+func (bc *BlockChain) checkStateRoot(height int, state *State) error {
+	recorded, err := bc.StateRoot(height)
+	if err != nil {
+		return nil
+	}
+	if root := state.Root(); root != recorded {
+		return fmt.Errorf("%w: replayed %v at height %v, recorded %v", ErrStateRootMismatch, root, height, recorded)
+	}
+	return nil
+}
+
+// Drop the roots of the Blocks from height on, see reorg.go
+func (bc *BlockChain) truncateStateRoots(height int) {
+	// Copied, as snapshots may share the roots past height
+	bc.stateRoots = slices.Clone(bc.stateRoots[:height])
+}
@@ -0,0 +1,302 @@
+/*
+ * State snapshots.
+ * SnapshotState dumps the state as of a committed Block: balances, nonces,
+ * bound keys, resting orders, key-value pairs, unspent outputs, multisig
+ * accounts and tokens, with the state root they hash to. The headers of the
+ * Blocks up to it come along, so a node bootstrapped from the snapshot
+ * links the Blocks after it and serves light clients, without replaying
+ * the transactions before it: a fast sync. Comparing the snapshots or
+ * roots of two chains at a height is also how student chains are graded.
+ *
+ * BootstrapChain checks the genesis, the linkage and work of the headers,
+ * and that the dumped state hashes to its root, then starts a chain whose
+ * bodies up to the snapshot are missing, as on a pruned node, see
+ * pruning.go. The state itself is trusted: the headers do not commit to
+ * it, so take snapshots from a node you trust, or compare the root with
+ * one. Blocks past the snapshot come from -import or -sync as usual.
+ * Recent trades of the order books are not kept.
+ *
+ *	GET /state/snapshot?height=..  snapshot at a height, the last Block by default
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const STATE_SNAPSHOT_FORMAT = "toychain-state"
+
+// Version of the snapshots written by SnapshotState
+const STATE_SNAPSHOT_VERSION = 1
+
+type StateSnapshot struct {
+	Format      string  `json:"format"`
+	Version     int     `json:"version"`
+	Genesis     Genesis `json:"genesis"`
+	GenesisHash string  `json:"genesisHash"`
+	Height      int     `json:"height"`
+	BlockHash   string  `json:"blockHash"` // of the Block at Height
+	StateRoot   string  `json:"stateRoot"`
+	Txns        int     `json:"txns"`   // committed after genesis up to Height
+	Supply      Amount  `json:"supply"` // coins issued up to Height, see issuance.go
+
+	Balances   map[string]map[string]Amount `json:"balances"` // by account then asset, empty for the chain's coin
+	Nonces     map[string]uint64            `json:"nonces"`
+	Keys       map[string][]byte            `json:"keys,omitempty"`
+	Orders     []snapshotOrder              `json:"orders,omitempty"` // by book, bids then asks, in book order
+	Namespaces map[string]string            `json:"namespaces,omitempty"`
+	KV         map[string]map[string][]byte `json:"kv,omitempty"`
+	UTXOs      []UTXO                       `json:"utxos,omitempty"` // sorted by ID
+	Multisigs  map[string]jsonMultisig      `json:"multisigs,omitempty"`
+	Tokens     map[string]Token             `json:"tokens,omitempty"` // created after genesis, see tokens.go
+
+	Headers []jsonHeader `json:"headers"` // of the Blocks 1 to Height
+}
+
+type snapshotOrder struct {
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Side      OrderSide `json:"side"`
+	Price     Amount    `json:"price"`
+	Remaining Amount    `json:"remaining"`
+}
+
+// Snapshot of the state as of the Block at height
+func (bc *BlockChain) SnapshotState(height int) (StateSnapshot, error) {
+	view, err := bc.WithHeight(height)
+	if err != nil {
+		return StateSnapshot{}, err
+	}
+	// The snapshot outlives the lock of the Node, see handleStateSnapshot
+	s := view.state.clone()
+	snap := StateSnapshot{
+		Format:      STATE_SNAPSHOT_FORMAT,
+		Version:     STATE_SNAPSHOT_VERSION,
+		Genesis:     bc.genesis,
+		GenesisHash: bc.GenesisHash(),
+		Height:      height,
+		BlockHash:   bc.blockAt(height).hash,
+		StateRoot:   s.Root(),
+		Txns:        bc.txns,
+		Supply:      s.supply,
+		Balances:    s.balances,
+		Nonces:      s.nonces,
+		Keys:        s.keys,
+		Namespaces:  s.namespaces,
+		KV:          s.kv,
+		Multisigs:   map[string]jsonMultisig{},
+		Headers:     []jsonHeader{},
+	}
+	for h := height + 1; h < bc.blocks.Len(); h++ {
+		snap.Txns -= len(bc.blockAt(h).data)
+	}
+	for _, pair := range sortedKeys(s.books) {
+		book := s.books[pair]
+		for _, e := range append(append([]*bookEntry{}, book.bids...), book.asks...) {
+			snap.Orders = append(snap.Orders, snapshotOrder{book.base, book.quote, e.id, e.owner, e.side, e.price, e.remaining})
+		}
+	}
+	for _, id := range sortedKeys(s.utxos) {
+		snap.UTXOs = append(snap.UTXOs, s.utxos[id])
+	}
+	for account, m := range s.multisigs {
+		snap.Multisigs[account] = jsonMultisig{m.keys, m.threshold}
+	}
+	for symbol, t := range s.tokens {
+		if t.Issuer != "" {
+			if snap.Tokens == nil {
+				snap.Tokens = map[string]Token{}
+			}
+			snap.Tokens[symbol] = t
+		}
+	}
+	for h := 1; h <= height; h++ {
+		b := bc.blockAt(h)
+		snap.Headers = append(snap.Headers, b.Header.toJSON(b.hash))
+	}
+	return snap, nil
+}
+
+// State dumped in snap
+func (snap StateSnapshot) state() *State {
+	s := NewState()
+	for account, assets := range snap.Balances {
+		for asset, amt := range assets {
+			s.credit(account, asset, amt)
+		}
+	}
+	for account, nonce := range snap.Nonces {
+		s.nonces[account] = nonce
+	}
+	for account, key := range snap.Keys {
+		s.keys[account] = key
+	}
+	for _, o := range snap.Orders {
+		book := s.orderBook(o.Base, o.Quote)
+		entry := &bookEntry{id: o.ID, owner: o.Owner, side: o.Side, price: o.Price, remaining: o.Remaining}
+		if o.Side == Buy {
+			book.bids = append(book.bids, entry)
+		} else {
+			book.asks = append(book.asks, entry)
+		}
+	}
+	for namespace, owner := range snap.Namespaces {
+		s.namespaces[namespace] = owner
+	}
+	for namespace, pairs := range snap.KV {
+		s.kv[namespace] = map[string][]byte{}
+		for key, value := range pairs {
+			s.kv[namespace][key] = value
+		}
+	}
+	for _, u := range snap.UTXOs {
+		s.utxos[u.ID] = u
+	}
+	for account, m := range snap.Multisigs {
+		s.multisigs[account] = &MultisigSpec{keys: m.Keys, threshold: m.Threshold}
+	}
+	s.tokens = snap.Genesis.tokens()
+	for symbol, t := range snap.Tokens {
+		s.tokens[symbol] = t
+	}
+	s.issuance, s.height, s.supply, s.governors = snap.Genesis.Issuance, snap.Height, snap.Supply, snap.Genesis.governors()
+	return s
+}
+
+/*
+ * Chain starting from the state of snap, its Blocks up to the snapshot
+ * known by their headers only, checked against checkpoints
+ */
+func BootstrapChain(snap StateSnapshot, checkpoints ...Checkpoint) (BlockChain, error) {
+	if snap.Format != STATE_SNAPSHOT_FORMAT {
+		return BlockChain{}, fmt.Errorf("not a %v snapshot", STATE_SNAPSHOT_FORMAT)
+	}
+	if snap.Version != STATE_SNAPSHOT_VERSION {
+		return BlockChain{}, fmt.Errorf("unsupported state snapshot version %v", snap.Version)
+	}
+	if err := VerifyGenesis(snap.Genesis, snap.GenesisHash); err != nil {
+		return BlockChain{}, err
+	}
+	if len(snap.Headers) != snap.Height {
+		return BlockChain{}, fmt.Errorf("snapshot at height %v holds %v headers", snap.Height, len(snap.Headers))
+	}
+	bc := CreateBlockChain(snap.Genesis)
+	if err := bc.SetCheckpoints(checkpoints); err != nil {
+		return BlockChain{}, err
+	}
+	lc := NewLightClient(snap.Genesis, "")
+	lc.checkpoints = bc.checkpoints
+	for i, j := range snap.Headers {
+		if err := lc.addHeader(j.header(), j.Hash); err != nil {
+			return BlockChain{}, fmt.Errorf("header %v: %w", i+1, err)
+		}
+	}
+	if lc.TipHash() != snap.BlockHash {
+		return BlockChain{}, fmt.Errorf("%w: headers end at %v, snapshot of %v", ErrInvalidBlockHash, lc.TipHash(), snap.BlockHash)
+	}
+	state := snap.state()
+	if root := state.Root(); root != snap.StateRoot {
+		return BlockChain{}, fmt.Errorf("snapshot state hashes to %v, expected %v", root, snap.StateRoot)
+	}
+	// The last header vouches for the state on chains committing to it, see statecommit.go
+	if n := len(snap.Headers); n > 0 && snap.Genesis.StateCommitments && snap.Headers[n-1].StateRoot != snap.StateRoot {
+		return BlockChain{}, fmt.Errorf("%w: snapshot state %v, block %v commits to %q", ErrStateRootMismatch, snap.StateRoot, snap.BlockHash, snap.Headers[n-1].StateRoot)
+	}
+	if snap.Height == 0 {
+		return bc, nil
+	}
+	for _, j := range snap.Headers {
+		if err := bc.blocks.Append(Block{Header: j.header(), hash: j.Hash}); err != nil {
+			return BlockChain{}, err
+		}
+	}
+	bc.state, bc.difficulty, bc.txns = state, lc.difficulty, snap.Txns
+	bc.pruned, bc.prunedState = snap.Height+1, state.clone()
+	bc.stateRoots = append(bc.stateRoots, make([]string, snap.Height)...)
+	bc.stateRoots[snap.Height] = snap.StateRoot
+	bc.mempool.rates = state.feeRates()
+	return bc, nil
+}
+
+// Chain bootstrapped from the state snapshot in the JSON file at path, see BootstrapChain
+func BootstrapChainFile(path string, checkpoints ...Checkpoint) (BlockChain, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return BlockChain{}, err
+	}
+	var snap StateSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return BlockChain{}, fmt.Errorf("parsing state snapshot %v: %w", path, err)
+	}
+	return BootstrapChain(snap, checkpoints...)
+}
+
+/*
+ * Write the snapshot of the state of bc at height, the last Block if
+ * negative, to path, returning the exit code
+ */
+func runSnapshotState(bc *BlockChain, height int, path string, out *Output) int {
+	if height < 0 {
+		height = bc.blocks.Len() - 1
+	}
+	snap, err := bc.SnapshotState(height)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	raw, err := json.Marshal(snap)
+	if err == nil {
+		err = os.WriteFile(path, raw, 0o644)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	accounts := map[string]bool{}
+	for account := range snap.Balances {
+		accounts[account] = true
+	}
+	for account := range snap.Nonces {
+		accounts[account] = true
+	}
+	err = out.Record([][2]string{
+		{"height", fmt.Sprint(snap.Height)},
+		{"block", snap.BlockHash},
+		{"state root", snap.StateRoot},
+		{"accounts", fmt.Sprint(len(accounts))},
+		{"utxos", fmt.Sprint(len(snap.UTXOs))},
+		{"size", fmt.Sprintf("%v bytes", len(raw))},
+	}, map[string]any{"height": snap.Height, "blockHash": snap.BlockHash, "stateRoot": snap.StateRoot, "bytes": len(raw)})
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleStateSnapshot(w http.ResponseWriter, r *http.Request) {
+	var snap StateSnapshot
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		height := bc.blocks.Len() - 1
+		if param := r.URL.Query().Get("height"); param != "" {
+			if height, err = strconv.Atoi(param); err != nil {
+				err = fmt.Errorf("%w: %q", ErrUnknownHeight, param)
+				return
+			}
+		}
+		snap, err = bc.SnapshotState(height)
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
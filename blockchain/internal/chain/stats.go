@@ -0,0 +1,85 @@
+/*
+ * Chain statistics.
+ * An at-a-glance view of a chain for operators and students: how long it
+ * is, how busy, how fast Blocks come and how much work goes into them.
+ * The interval and hash rate are averaged over the last STATS_BLOCKS
+ * Blocks, the genesis Block left out as its timestamp is set by hand.
+ *
+ *	GET /stats
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+)
+
+// Recent Blocks the interval and hash rate are averaged over
+const STATS_BLOCKS = 100
+
+type ChainStats struct {
+	Height        int          `json:"height"`
+	Txns          int          `json:"txns"`          // committed after genesis
+	BlockInterval float64      `json:"blockInterval"` // mean seconds between recent Blocks, 0 before 2 Blocks
+	HashRate      float64      `json:"hashRate"`      // hashes per second mining recent Blocks, from their difficulty
+	Mempool       int          `json:"mempool"`       // pending transactions
+	Difficulty    int          `json:"difficulty"`    // of the next Block
+	Orphans       int          `json:"orphans"`       // Blocks dropped by reorganizations, see orphans.go
+	Caches        []CacheStats `json:"caches"`        // lookup caches, see cache.go
+}
+
+func (bc *BlockChain) Stats() ChainStats {
+	stats := ChainStats{
+		Height:     bc.blocks.Len() - 1,
+		Txns:       bc.txns,
+		Mempool:    bc.mempool.Len(),
+		Difficulty: bc.difficulty,
+		Orphans:    bc.orphaned,
+		Caches:     bc.CacheStats(),
+	}
+	first := max(bc.blocks.Len()-STATS_BLOCKS, 1)
+	if stats.Height-first < 1 {
+		return stats
+	}
+	work := 0.0
+	for height := first + 1; height <= stats.Height; height++ {
+		work += math.Pow(16, float64(bc.blockAt(height).difficulty))
+	}
+	elapsed := float64(bc.lastBlock().unixTs-bc.blockAt(first).unixTs) / 1e6
+	if elapsed > 0 {
+		stats.BlockInterval = elapsed / float64(stats.Height-first)
+		stats.HashRate = work / elapsed
+	}
+	return stats
+}
+
+// GET /stats height, transactions, block interval, hash rate, mempool, difficulty and orphans
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	var stats ChainStats
+	s.node.withChain(func(bc *BlockChain) { stats = bc.Stats() })
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Print stats, returning the exit code
+func printStats(out *Output, stats ChainStats) int {
+	fields := [][2]string{
+		{"height", fmt.Sprint(stats.Height)},
+		{"transactions", fmt.Sprint(stats.Txns)},
+		{"block interval", fmt.Sprintf("%.1fs", stats.BlockInterval)},
+		{"hash rate", fmt.Sprintf("%.0f H/s", stats.HashRate)},
+		{"mempool", fmt.Sprint(stats.Mempool)},
+		{"difficulty", fmt.Sprint(stats.Difficulty)},
+		{"orphans", fmt.Sprint(stats.Orphans)},
+	}
+	for _, c := range stats.Caches {
+		fields = append(fields, [2]string{c.Name + " cache", fmt.Sprintf("%v of %v entries, %v hits, %v misses", c.Entries, c.Capacity, c.Hits, c.Misses)})
+	}
+	err := out.Record(fields, stats)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
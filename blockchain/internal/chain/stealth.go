@@ -0,0 +1,329 @@
+/*
+ * Stealth addresses.
+ * Every payment to an address shows up under it on chain, so whoever knows
+ * the address of bob sees all he is paid. Bob publishes a stealth address
+ * instead, the public keys A of a scan key a and B of a spend key b, never
+ * seen on chain, and every payer pays him at a new one-time address:
+ *
+ *	- the payer draws a one-time key r and derives the tweak t, the hash of
+ *	  the ECDH secret r·A, and the one-time key P = B + t·G
+ *	- it pays a UTXO output to the address of P, see address.go, and
+ *	  announces R = r·G in the data of the transaction
+ *	- bob, scanning the chain, repeats the ECDH a·R = r·A of each
+ *	  announcement and recognizes P among the outputs, see Scan. He alone
+ *	  spends it, with the private key b + t of P, see Spender
+ *
+ * Nobody else can tell two outputs to one-time addresses have the same
+ * owner, nor link them to the stealth address. Handing out the scan key
+ * alone lets a watcher find the payments of bob without spending them.
+ * The amounts, the payers and, once bob spends his outputs together, the
+ * links between his addresses stay public. Keys stay on P-256.
+ *
+ *	GET /demo/stealth  steps of the demo of -stealth-demo
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+// Prefix of the data of the transactions announcing a payment to a stealth address
+const STEALTH_ANNOUNCEMENT = "stealth:"
+
+// Published by the payee in place of an address
+type StealthAddress struct {
+	ScanKey  []byte `json:"scanKey"` // uncompressed SEC 1 P-256 points
+	SpendKey []byte `json:"spendKey"`
+}
+
+// Keys behind a stealth address
+type StealthWallet struct {
+	account string
+	scan    *Wallet
+	spend   *Wallet
+}
+
+// Output paid to a stealth address, found by Scan
+type StealthOutput struct {
+	UTXO
+	Ephemeral []byte `json:"ephemeral"` // R announced by the payer
+}
+
+func NewStealthWallet(account string) (*StealthWallet, error) {
+	scan, err := NewWallet(account)
+	if err != nil {
+		return nil, err
+	}
+	spend, err := NewWallet(account)
+	if err != nil {
+		return nil, err
+	}
+	return &StealthWallet{account, scan, spend}, nil
+}
+
+func (sw *StealthWallet) Address() StealthAddress {
+	return StealthAddress{ScanKey: sw.scan.PublicKey(), SpendKey: sw.spend.PublicKey()}
+}
+
+// Tweak t of the one-time key, hashed from the ECDH secret and R
+func stealthTweak(shared, ephemeral []byte) *big.Int {
+	h := sha256.New()
+	h.Write([]byte("toychain stealth"))
+	h.Write(shared)
+	h.Write(ephemeral)
+	t := new(big.Int).SetBytes(h.Sum(nil))
+	return t.Mod(t, elliptic.P256().Params().N)
+}
+
+// One-time key B + t·G
+func stealthKey(spendKey []byte, t *big.Int) ([]byte, error) {
+	curve := elliptic.P256()
+	b, err := parseP256PublicKey(spendKey)
+	if err != nil {
+		return nil, errors.New("spend key is not a P-256 point")
+	}
+	tx, ty := curve.ScalarBaseMult(t.Bytes())
+	px, py := curve.Add(b.X, b.Y, tx, ty)
+	// Uncompressed point 0x04 || X || Y, which ecdh.P256 parses
+	key := make([]byte, 65)
+	key[0] = 4
+	px.FillBytes(key[1:33])
+	py.FillBytes(key[33:])
+	return key, nil
+}
+
+/*
+ * Deposit of amt by payer to a one-time address of to, on the network of
+ * prefix, announced in the data of the transaction
+ */
+func NewStealthPayment(payer string, nonce uint64, to StealthAddress, amt Amount, prefix string) (Transaction, error) {
+	scanKey, err := ecdh.P256().NewPublicKey(to.ScanKey)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("scan key: %w", err)
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return Transaction{}, err
+	}
+	shared, err := ephemeral.ECDH(scanKey)
+	if err != nil {
+		return Transaction{}, err
+	}
+	r := ephemeral.PublicKey().Bytes()
+	key, err := stealthKey(to.SpendKey, stealthTweak(shared, r))
+	if err != nil {
+		return Transaction{}, err
+	}
+	txn := NewUTXOTxn(payer, "", nonce, amt, nil, NewUTXOOutput(NewAddress(key, prefix), amt))
+	return txn.WithData(append([]byte(STEALTH_ANNOUNCEMENT), r...)), nil
+}
+
+// Tweak of the payments announcing R to the wallet
+func (sw *StealthWallet) tweak(r []byte) (*big.Int, error) {
+	pub, err := ecdh.P256().NewPublicKey(r)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := sw.scan.key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	return stealthTweak(shared, r), nil
+}
+
+// Outputs of b paid to the wallet, on the network of prefix
+func (sw *StealthWallet) Scan(b Block, prefix string) []StealthOutput {
+	found := []StealthOutput{}
+	for _, txn := range b.data {
+		r, ok := bytes.CutPrefix(txn.data, []byte(STEALTH_ANNOUNCEMENT))
+		if !ok || txn.utxo == nil {
+			continue
+		}
+		t, err := sw.tweak(r)
+		if err != nil {
+			continue
+		}
+		key, err := stealthKey(sw.spend.PublicKey(), t)
+		if err != nil {
+			continue
+		}
+		owner := NewAddress(key, prefix)
+		for i, o := range txn.utxo.outputs {
+			if o.owner == owner {
+				found = append(found, StealthOutput{UTXO{utxoID(txn.Hash(), i), o.owner, o.amt}, r})
+			}
+		}
+	}
+	return found
+}
+
+// Wallet of the one-time address of o, signing with b + t
+func (sw *StealthWallet) Spender(o StealthOutput) (*Wallet, error) {
+	t, err := sw.tweak(o.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	b, err := sw.spend.rawKey()
+	if err != nil {
+		return nil, err
+	}
+	p := t.Add(t, new(big.Int).SetBytes(b))
+	p.Mod(p, elliptic.P256().Params().N)
+	if p.Sign() == 0 {
+		return nil, errors.New("one-time key is zero")
+	}
+	return walletFromRaw(o.Owner, SchemeECDSA, p.FillBytes(make([]byte, 32)))
+}
+
+type StealthStep struct {
+	Description string `json:"description"`
+	OnChain     bool   `json:"onChain"`       // a Block was submitted, or the step stayed off chain
+	Txn         string `json:"txn,omitempty"` // hash of the transaction submitted
+	Accepted    bool   `json:"accepted"`      // by the chain
+	Reason      string `json:"reason,omitempty"`
+	Found       []UTXO `json:"found"` // outputs found by the party, or paid by the transaction
+}
+
+func stealthGenesis() Genesis {
+	g := DefaultGenesis(2)
+	g.ChainID = "stealth-demo"
+	g.Alloc = map[string]Amount{"alice": 100 * COIN}
+	return g
+}
+
+/*
+ * Pay bob twice at his stealth address, let eve and bob scan the chain, eve
+ * try to spend bob's outputs and bob spend one, each step recording whether
+ * the chain accepted it and the outputs the party found
+ */
+func RunStealthDemo() ([]StealthStep, error) {
+	bob, err := NewStealthWallet("bob")
+	if err != nil {
+		return nil, err
+	}
+	eve, err := NewStealthWallet("eve")
+	if err != nil {
+		return nil, err
+	}
+	fb := newFixtureBuilder("stealth", stealthGenesis())
+	steps := []StealthStep{}
+	record := func(description string, txn *Transaction, err error, found []UTXO) {
+		step := StealthStep{Description: description, OnChain: txn != nil, Accepted: err == nil, Found: found}
+		if txn != nil {
+			step.Txn = txn.Hash()
+		}
+		if err != nil {
+			step.Reason = err.Error()
+		}
+		steps = append(steps, step)
+	}
+	submit := func(description string, txn Transaction) {
+		err := fb.bc.appendBlock(fb.mine(txn))
+		paid := []UTXO{}
+		for _, o := range txn.utxo.outputs {
+			paid = append(paid, fb.bc.UTXOs(o.owner)...)
+		}
+		record(description, &txn, err, paid)
+	}
+	scan := func(sw *StealthWallet) []StealthOutput {
+		found := []StealthOutput{}
+		for height := range fb.bc.blocks.Len() {
+			b, err := fb.bc.blocks.Get(height)
+			if err == nil {
+				found = append(found, sw.Scan(b, ADDRESS_PREFIX)...)
+			}
+		}
+		return found
+	}
+	utxos := func(outputs []StealthOutput) []UTXO {
+		found := []UTXO{}
+		for _, o := range outputs {
+			found = append(found, o.UTXO)
+		}
+		return found
+	}
+
+	record("bob publishes his stealth address", nil, nil, []UTXO{})
+	for nonce, amt := range []Amount{10 * COIN, 15 * COIN} {
+		txn, err := NewStealthPayment("alice", uint64(nonce), bob.Address(), amt, ADDRESS_PREFIX)
+		if err != nil {
+			return nil, err
+		}
+		submit(fmt.Sprintf("alice pays bob %v at his stealth address", amt), txn)
+	}
+	record("eve scans the chain with her stealth keys", nil, nil, utxos(scan(eve)))
+	found := scan(bob)
+	record("bob scans the chain with his stealth keys", nil, nil, utxos(found))
+	if len(found) == 0 {
+		return nil, errors.New("bob found none of his payments")
+	}
+	o := found[0]
+	// eve signs for the one-time address with her own spend key
+	raw, err := eve.spend.rawKey()
+	if err != nil {
+		return nil, err
+	}
+	thief, err := walletFromRaw(o.Owner, SchemeECDSA, raw)
+	if err != nil {
+		return nil, err
+	}
+	theft, err := PayUTXO(thief, []UTXO{o.UTXO}, "eve", o.Amt, 0)
+	if err != nil {
+		return nil, err
+	}
+	submit(fmt.Sprintf("eve spends the output of %v to her", o.Owner), theft)
+	spender, err := bob.Spender(o)
+	if err != nil {
+		return nil, err
+	}
+	spend, err := PayUTXO(spender, []UTXO{o.UTXO}, "carol", o.Amt, 0)
+	if err != nil {
+		return nil, err
+	}
+	submit(fmt.Sprintf("bob spends the output of %v to carol", o.Owner), spend)
+	return steps, nil
+}
+
+func printStealthDemo(out *Output, steps []StealthStep) error {
+	rows := [][]string{}
+	for _, step := range steps {
+		where, verdict := "off chain", "accepted"
+		if step.OnChain {
+			where = "on chain"
+		}
+		if !step.Accepted {
+			verdict = "rejected: " + step.Reason
+		}
+		outputs := ""
+		for i, u := range step.Found {
+			if i > 0 {
+				outputs += ", "
+			}
+			outputs += fmt.Sprintf("%v to %v", u.Amt, u.Owner)
+		}
+		rows = append(rows, []string{step.Description, where, verdict, outputs})
+	}
+	return out.Table([]string{"step", "", "verdict", "outputs"}, rows, steps)
+}
+
+// GET /demo/stealth
+func (s *Server) handleStealthDemo(w http.ResponseWriter, r *http.Request) {
+	steps, err := RunStealthDemo()
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, steps)
+}
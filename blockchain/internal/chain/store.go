@@ -0,0 +1,329 @@
+/*
+ * Block storage.
+ * The BlockChain keeps its Blocks in a BlockStore. The default store holds
+ * them in memory; the tiered store keeps the most recent Blocks in memory
+ * and moves older ones to a slower ObjectStore (compressed files in a
+ * directory, or any other object store), reading them back on demand.
+ * Cold Blocks are stored in the binary encoding of codec.go, next to the
+ * indices finding them by hash, see blockindex.go.
+ */
+package chain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type BlockStore interface {
+	Len() int                      // number of Blocks, genesis included
+	Get(height int) (Block, error) // Block at height
+	Append(b Block) error          // add the next Block
+	Truncate(height int) error     // drop the Blocks from height on, see reorg.go
+	Prune(height int) error        // drop the body of the Block at height, keeping its header, see pruning.go
+	Freeze() BlockStore            // read-only view of the Blocks as they are now, see chainsnapshot.go
+	Flush() error                  // write the Blocks held in memory to durable storage if any, see shutdown.go
+}
+
+// Key-value blob storage, eg. files or a cloud object store
+type ObjectStore interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error) // fails with os.ErrNotExist for missing keys
+	Delete(key string) error
+}
+
+type memoryStore struct {
+	blocks []Block
+	shared bool // blocks is also read by a frozen view, copy before changing it
+}
+
+func NewMemoryStore() BlockStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Len() int {
+	return len(s.blocks)
+}
+
+func (s *memoryStore) Get(height int) (Block, error) {
+	if height < 0 || height >= len(s.blocks) {
+		return Block{}, fmt.Errorf("no block at height %v", height)
+	}
+	return s.blocks[height], nil
+}
+
+func (s *memoryStore) Append(b Block) error {
+	s.blocks = append(s.blocks, b)
+	return nil
+}
+
+func (s *memoryStore) Truncate(height int) error {
+	if height < 1 || height > len(s.blocks) {
+		return fmt.Errorf("cannot truncate %v blocks at height %v", len(s.blocks), height)
+	}
+	s.own()
+	s.blocks = s.blocks[:height]
+	return nil
+}
+
+func (s *memoryStore) Prune(height int) error {
+	if height < 0 || height >= len(s.blocks) {
+		return fmt.Errorf("no block at height %v", height)
+	}
+	s.own()
+	s.blocks[height].data = nil
+	return nil
+}
+
+// Appends go past the end of the view, the Blocks it holds are copied before any other change
+func (s *memoryStore) Freeze() BlockStore {
+	s.shared = true
+	return &memoryStore{blocks: slices.Clip(s.blocks), shared: true}
+}
+
+// Memory is all there is
+func (s *memoryStore) Flush() error {
+	return nil
+}
+
+func (s *memoryStore) own() {
+	if s.shared {
+		s.blocks, s.shared = slices.Clone(s.blocks), false
+	}
+}
+
+// ObjectStore keeping each object as a gzip compressed file in a directory
+type DirObjectStore struct {
+	dir string
+}
+
+func NewDirObjectStore(dir string) (*DirObjectStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirObjectStore{dir: dir}, nil
+}
+
+func (s *DirObjectStore) Put(key string, data []byte) error {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, key+".gz"), compressed.Bytes(), 0o644)
+}
+
+func (s *DirObjectStore) Get(key string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(s.dir, key+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+func (s *DirObjectStore) Delete(key string) error {
+	return os.Remove(filepath.Join(s.dir, key+".gz"))
+}
+
+/*
+ * BlockStore keeping the last hotBlocks Blocks in memory and moving older
+ * ones to cold storage as they age
+ */
+type TieredStore struct {
+	hot         []Block     // Blocks from height coldLen on
+	coldLen     int         // Blocks moved to cold storage
+	cold        ObjectStore // Blocks below coldLen, one object per Block
+	hotBlocks   int         // Blocks kept in memory
+	flushed     int         // Blocks below it are in cold storage, hot ones too since Flush
+	shared      bool        // hot is also read by a frozen view, copy before changing it
+	objectIndex             // of every Block, in cold storage, see blockindex.go
+}
+
+func NewTieredStore(cold ObjectStore, hotBlocks int) (*TieredStore, error) {
+	if hotBlocks < 1 {
+		return nil, errors.New("at least one block must stay hot")
+	}
+	return &TieredStore{cold: cold, hotBlocks: hotBlocks, objectIndex: objectIndex{cold}}, nil
+}
+
+// Key of the Block at height, named after the JSON the Blocks were once stored in, see codec.go
+func coldKey(height int) string {
+	return fmt.Sprintf("block-%08d.json", height)
+}
+
+func (s *TieredStore) Len() int {
+	return s.coldLen + len(s.hot)
+}
+
+func (s *TieredStore) Get(height int) (Block, error) {
+	if height < 0 || height >= s.Len() {
+		return Block{}, fmt.Errorf("no block at height %v", height)
+	}
+	if height >= s.coldLen {
+		return s.hot[height-s.coldLen], nil
+	}
+	return readColdBlock(s.cold, height)
+}
+
+func readColdBlock(cold ObjectStore, height int) (Block, error) {
+	raw, err := cold.Get(coldKey(height))
+	if err != nil {
+		return Block{}, fmt.Errorf("reading block %v from cold storage: %w", height, err)
+	}
+	b, err := DecodeBlock(raw)
+	if err != nil {
+		return Block{}, fmt.Errorf("decoding block %v from cold storage: %w", height, err)
+	}
+	return b, nil
+}
+
+/*
+ * Index b and make room for it by moving the oldest hot Blocks to cold
+ * storage first, unless they are there since Flush
+ */
+func (s *TieredStore) Append(b Block) error {
+	return s.atomically(func() error {
+		if err := s.put(s.Len(), b); err != nil {
+			return err
+		}
+		for len(s.hot) >= s.hotBlocks {
+			if s.coldLen >= s.flushed {
+				if err := s.cold.Put(coldKey(s.coldLen), EncodeBlock(s.hot[0])); err != nil {
+					return fmt.Errorf("moving block %v to cold storage: %w", s.coldLen, err)
+				}
+			}
+			s.hot = s.hot[1:]
+			s.coldLen++
+			s.flushed = max(s.flushed, s.coldLen)
+		}
+		s.hot = append(s.hot, b)
+		return nil
+	})
+}
+
+// Drop hot Blocks, those in cold storage are final
+func (s *TieredStore) Truncate(height int) error {
+	if height < 1 || height > s.Len() {
+		return fmt.Errorf("cannot truncate %v blocks at height %v", s.Len(), height)
+	}
+	if height < s.coldLen {
+		return fmt.Errorf("cannot truncate blocks at height %v, blocks below %v are in cold storage", height, s.coldLen)
+	}
+	return s.atomically(func() error {
+		// The flushed copies of the Blocks dropped would come back on recovery
+		for ; s.flushed > height; s.flushed-- {
+			if err := deleteObject(s.cold, coldKey(s.flushed-1)); err != nil {
+				return fmt.Errorf("deleting flushed block %v: %w", s.flushed-1, err)
+			}
+			if err := deleteObject(s.cold, stateKey(s.flushed-1)); err != nil {
+				return err
+			}
+		}
+		for h := s.Len() - 1; h >= height; h-- {
+			if err := s.drop(h, s.hot[h-s.coldLen]); err != nil {
+				return fmt.Errorf("unindexing block %v: %w", h, err)
+			}
+		}
+		s.own()
+		s.hot = s.hot[:height-s.coldLen]
+		return nil
+	})
+}
+
+// Drop the body of a hot Block, or rewrite a cold one without it, flushed hot Blocks being both
+func (s *TieredStore) Prune(height int) error {
+	if height < 0 || height >= s.Len() {
+		return fmt.Errorf("no block at height %v", height)
+	}
+	if height >= s.coldLen {
+		s.own()
+		s.hot[height-s.coldLen].data = nil
+		if height >= s.flushed {
+			return nil
+		}
+	}
+	b, err := readColdBlock(s.cold, height)
+	if err != nil {
+		return err
+	}
+	b.data = nil
+	return s.atomically(func() error {
+		return s.cold.Put(coldKey(height), EncodeBlock(b))
+	})
+}
+
+// Cold Blocks are only ever rewritten by pruning, hot ones as in the memory store
+func (s *TieredStore) Freeze() BlockStore {
+	s.shared = true
+	return &TieredStore{hot: slices.Clip(s.hot), coldLen: s.coldLen, cold: s.cold, hotBlocks: s.hotBlocks, flushed: s.flushed, shared: true, objectIndex: s.objectIndex}
+}
+
+/*
+ * Write the hot Blocks not written yet to cold storage, keeping them in
+ * memory, so they survive the process, see RecoverChain
+ */
+func (s *TieredStore) Flush() error {
+	return s.atomically(func() error {
+		for ; s.flushed < s.Len(); s.flushed++ {
+			if err := s.cold.Put(coldKey(s.flushed), EncodeBlock(s.hot[s.flushed-s.coldLen])); err != nil {
+				return fmt.Errorf("flushing block %v to cold storage: %w", s.flushed, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *TieredStore) own() {
+	if s.shared {
+		s.hot, s.shared = slices.Clone(s.hot), false
+	}
+}
+
+/*
+ * Move Blocks older than the last hotBlocks to cold storage, now and as
+ * the chain grows. Readers see no difference apart from latency
+ */
+func (bc *BlockChain) SetColdStorage(cold ObjectStore, hotBlocks int) error {
+	tiered, err := NewTieredStore(cold, hotBlocks)
+	if err != nil {
+		return err
+	}
+	for height := 0; height < bc.blocks.Len(); height++ {
+		if err := tiered.Append(bc.blockAt(height)); err != nil {
+			return err
+		}
+	}
+	// Committed Blocks are durable with a write-ahead log, see wal.go
+	if _, ok := cold.(batchStore); ok {
+		if err := tiered.Flush(); err != nil {
+			return err
+		}
+	}
+	bc.blocks = tiered
+	return nil
+}
+
+/*
+ * Block at height, which must exist
+ * Panics if the store cannot read it back, as the chain is unusable then
+ */
+func (bc BlockChain) blockAt(height int) Block {
+	b, err := bc.blocks.Get(height)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,139 @@
+/*
+ * Atomic multi-party swaps.
+ * A swap is a single transaction made of several legs, each moving an
+ * amount of some asset between two parties. Every party taking part in a
+ * leg must sign the swap, and the legs are applied all together or not
+ * at all, so no party can end up giving without receiving.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Asset name of the chain's own coin
+const NATIVE_ASSET = ""
+
+type SwapLeg struct {
+	from  string
+	to    string
+	asset string // NATIVE_ASSET or the name of another asset
+	amt   Amount
+}
+
+type Swap struct {
+	legs   []SwapLeg
+	keys   map[string][]byte // public key of each party that signed
+	sigs   map[string][]byte // signature of each party over the swap
+	aggSig []byte            // Schnorr signature of every party in place of sigs, see schnorr.go
+}
+
+func NewSwapLeg(from, to, asset string, amt Amount) SwapLeg {
+	return SwapLeg{from: from, to: to, asset: asset, amt: amt}
+}
+
+/*
+ * Create an unsigned swap transaction
+ * The sender of the first leg proposes the swap, and the swap consumes
+ * their nonce
+ */
+func NewSwap(nonce uint64, legs ...SwapLeg) Transaction {
+	txn := Transaction{
+		kind:  TxnSwap,
+		nonce: nonce,
+		swap: &Swap{
+			legs: legs,
+			keys: make(map[string][]byte),
+			sigs: make(map[string][]byte),
+		},
+	}
+	if len(legs) > 0 {
+		txn.payer = legs[0].from
+	}
+	return txn
+}
+
+// Sorted list of accounts sending or receiving in any leg
+func (s *Swap) parties() []string {
+	seen := make(map[string]bool)
+	parties := []string{}
+	for _, leg := range s.legs {
+		for _, party := range []string{leg.from, leg.to} {
+			if !seen[party] {
+				seen[party] = true
+				parties = append(parties, party)
+			}
+		}
+	}
+	sort.Strings(parties)
+	return parties
+}
+
+// Add the signature of the signer's account to a swap transaction
+func (txn *Transaction) SignSwap(s Signer) error {
+	if txn.swap == nil {
+		return errors.New("not a swap transaction")
+	}
+	sig, err := s.SignTxn(*txn)
+	if err != nil {
+		return err
+	}
+	txn.swap.keys[s.Account()] = s.PublicKey()
+	txn.swap.sigs[s.Account()] = sig
+	return nil
+}
+
+// Check the swap is well formed and signed by every party
+func (s *Swap) verify(scheme SigScheme, digest []byte) error {
+	if len(s.legs) == 0 {
+		return errors.New("swap has no legs")
+	}
+	for _, leg := range s.legs {
+		if leg.amt <= 0 {
+			return fmt.Errorf("swap leg %v -> %v has non-positive amount", leg.from, leg.to)
+		}
+		if leg.from == leg.to {
+			return fmt.Errorf("swap leg from %v to itself", leg.from)
+		}
+	}
+	if s.aggSig != nil {
+		for _, party := range s.parties() {
+			if s.keys[party] == nil {
+				return fmt.Errorf("%w: swap is missing the signature of %v", ErrInvalidSignature, party)
+			}
+		}
+		if len(s.keys) != len(s.parties()) {
+			return fmt.Errorf("%w: swap carries keys of accounts not taking part", ErrInvalidSignature)
+		}
+		return verifyAggregateOf(scheme, s.keys, s.sigs, digest, s.aggSig)
+	}
+	for _, party := range s.parties() {
+		sig, ok := s.sigs[party]
+		if !ok {
+			return fmt.Errorf("%w: swap is missing the signature of %v", ErrInvalidSignature, party)
+		}
+		if !verifySignature(scheme, s.keys[party], digest, sig) {
+			return fmt.Errorf("%w on the swap by %v", ErrInvalidSignature, party)
+		}
+	}
+	return nil
+}
+
+// Display suffix for amounts of asset, empty for the chain's coin
+func assetSuffix(asset string) string {
+	if asset == NATIVE_ASSET {
+		return ""
+	}
+	return " " + asset
+}
+
+func (s *Swap) String() string {
+	legs := make([]string, len(s.legs))
+	for i, leg := range s.legs {
+		legs[i] = fmt.Sprintf("%v->%v %v%v", leg.from, leg.to, leg.amt, assetSuffix(leg.asset))
+	}
+	return strings.Join(legs, ", ")
+}
@@ -0,0 +1,158 @@
+/*
+ * Initial block download.
+ * A node joining the network catches up with its peers before serving.
+ * It first downloads the headers of every peer past its own last Block,
+ * verifying them like a light client does, which is cheap, and picks the
+ * chain carrying the most work. It then downloads the bodies of that chain
+ * in batches, checking each Block against its verified header and
+ * validating it like an imported one. A peer lying about its headers is
+ * found out before any body is fetched; when the chosen peer serves bodies
+ * that do not match, the next best peer sharing our last Block takes over.
+ * A peer on a fork of our chain carrying more work than ours past the fork
+ * has the node switch to its branch first, see reorg.go.
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+)
+
+type SyncReport struct {
+	Heights  map[string]int // height of the verified headers of each peer
+	Peers    []string       // peers the Blocks were downloaded from
+	Blocks   int            // Blocks appended
+	Reverted int            // Blocks replaced by the branch of a heavier fork
+}
+
+// Expected number of hashes to mine the headers past the trusted one
+func (lc *LightClient) work() float64 {
+	work := 0.0
+	for _, h := range lc.headers[1:] {
+		work += math.Pow(16, float64(h.difficulty))
+	}
+	return work
+}
+
+/*
+ * Catch up with the best chain among peers, the node API URLs of other
+ * nodes on the same genesis. Peers that cannot be reached or are on
+ * another chain are skipped
+ * Fails if no peer delivers the Blocks of the best verified headers
+ */
+func (bc *BlockChain) Sync(peers []string) (SyncReport, error) {
+	report := SyncReport{Heights: map[string]int{}}
+	var candidates []*LightClient
+	for _, peer := range peers {
+		_, hash, err := newPeerClient(peer).genesis()
+		if err != nil {
+			log.Printf("sync: peer %v: %v", peer, err)
+			continue
+		}
+		if hash != bc.GenesisHash() {
+			log.Printf("sync: peer %v has genesis %v, expected %v", peer, hash, bc.GenesisHash())
+			continue
+		}
+		if err := bc.resolveFork(peer, &report); err != nil {
+			log.Printf("sync: peer %v: fork: %v", peer, err)
+		}
+		lc, err := bc.lightClientAt(peer, bc.blocks.Len()-1)
+		if err != nil {
+			return report, err
+		}
+		if _, err := lc.Sync(); err != nil {
+			// The headers verified before the bad one are still usable
+			log.Printf("sync: peer %v: %v", peer, err)
+		}
+		report.Heights[peer] = lc.Height()
+		candidates = append(candidates, lc)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].work() > candidates[j].work() })
+
+	var err error
+	for _, lc := range candidates {
+		if hash, ok := lc.hashAt(bc.blocks.Len() - 1); !ok || hash != bc.lastBlock().hash {
+			continue
+		}
+		if lc.Height() < bc.blocks.Len() {
+			break
+		}
+		report.Peers = append(report.Peers, lc.peer.url)
+		if err = bc.downloadBodies(lc, &report); err == nil {
+			break
+		}
+		log.Printf("sync: peer %v: %v", lc.peer.url, err)
+	}
+	return report, err
+}
+
+// Append the Blocks of the verified headers of lc, in batches of MAX_BODIES
+func (bc *BlockChain) downloadBodies(lc *LightClient, report *SyncReport) error {
+	for bc.blocks.Len() <= lc.Height() {
+		from := bc.blocks.Len()
+		blocks, err := lc.bodies(from)
+		if err != nil {
+			return err
+		}
+		for i, b := range blocks {
+			if err := bc.appendBlock(b); err != nil {
+				return fmt.Errorf("block %v: %w", from+i, err)
+			}
+			report.Blocks++
+		}
+	}
+	return nil
+}
+
+// Blocks of the verified headers of lc from height from on, up to MAX_BODIES
+func (lc *LightClient) bodies(from int) ([]Block, error) {
+	raw, err := lc.peer.getBinary(fmt.Sprintf("/bodies?from=%v", from))
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := DecodeBlocks(raw)
+	if err != nil {
+		return nil, fmt.Errorf("bodies from %v: %w", from, err)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no block %v despite its header", from)
+	}
+	verified := []Block{}
+	for i, b := range blocks {
+		height := from + i
+		hash, ok := lc.hashAt(height)
+		if !ok {
+			break
+		}
+		if b.hash != hash {
+			return nil, fmt.Errorf("%w: block %v at height %v, its header has %v", ErrInvalidBlockHash, b.hash, height, hash)
+		}
+		verified = append(verified, b)
+	}
+	return verified, nil
+}
+
+/*
+ * Light client of peer trusting our Block at height, along with the
+ * headers before it the retarget averages, if any
+ */
+func (bc *BlockChain) lightClientAt(peer string, height int) (*LightClient, error) {
+	b := bc.blockAt(height)
+	recent := []Header{b.Header}
+	if r := bc.genesis.Retarget; r != nil {
+		var err error
+		if recent, err = bc.headersTo(height, r.Window+1); err != nil {
+			return nil, err
+		}
+	}
+	// The difficulty after height, which the Block after it was mined at
+	difficulty := bc.difficulty
+	if height < bc.blocks.Len()-1 {
+		difficulty = bc.blockAt(height + 1).difficulty
+	}
+	lc := newLightClientAt(peer, bc.genesis, difficulty, height, recent, b.hash)
+	lc.checkpoints = bc.checkpoints
+	return lc, nil
+}
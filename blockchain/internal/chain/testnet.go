@@ -0,0 +1,387 @@
+/*
+ * In-process test network.
+ * Checking sync, forks and reorganizations takes several nodes talking to
+ * each other, and real sockets make such tests slow and flaky. A TestNet
+ * runs N Nodes in the process, each served by its Server on an in-memory
+ * transport: a request to the URL of a node of a TestNet goes straight to
+ * its handler, through helloTransport like any request to a peer, see
+ * handshake.go, so the rest of the code cannot tell it from HTTP.
+ *
+ * Nothing moves on its own. Nodes mine when told to, and Step has each
+ * node in turn sync from the peers it can reach, see sync.go, the way a
+ * node polling its peers would. The nodes read the time from one StepClock
+ * started at the genesis, and mine with sequential nonces, so the same
+ * calls build the same Blocks and hashes on every run:
+ *
+ *	tn := NewTestNet(3, TestGenesis(4))
+ *	defer tn.Close()
+ *	tn.MineOn(0)                        // node 0 mines a Block
+ *	tn.Settle()                         // the others sync it
+ *	tn.Partition([]int{0}, []int{1, 2}) // node 0 cut off from 1 and 2
+ *	tn.MineOn(0); tn.MineOn(1); tn.MineOn(1)
+ *	tn.Settle()                         // 0 and 1 diverge
+ *	tn.Heal()
+ *	tn.Settle()                         // 0 reorganizes to the branch of 1
+ *
+ * -testnet N runs that scenario on N nodes and checks where they end up,
+ * and so does go test, see testnet_test.go.
+ * Links may also drop, duplicate and delay requests, see netfaults.go.
+ */
+package chain
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Time between two readings of the clock of a TestNet
+const TESTNET_CLOCK_STEP = 10 * time.Second
+
+// Rounds of Step Settle runs at most before giving up
+const TESTNET_MAX_ROUNDS = 100
+
+// Links to the in-process nodes by host, see memLink
+var memHosts sync.Map
+
+// TestNets created, numbering their hosts
+var testnets atomic.Int64
+
+// Send req to the in-process node of its host, if any, and otherwise over the network
+func roundTrip(req *http.Request) (*http.Response, error) {
+	l, ok := memHosts.Load(req.URL.Host)
+	if !ok {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return l.(*memLink).roundTrip(req)
+}
+
+// Reply of h to req, as if it came over HTTP
+func serveInMemory(h http.Handler, req *http.Request) *http.Response {
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	req.RemoteAddr = req.URL.Host
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp
+}
+
+type TestNet struct {
+	id      int64
+	nodes   []*Node
+	servers []*Server
+	hosts   []string // of the links to the nodes
+
+	mu      sync.Mutex
+	cut     map[[2]int]bool       // links down, by node indices, lower one first
+	faults  map[[2]int]LinkFaults // by sender and receiver, see netfaults.go
+	rng     *rand.Rand            // drawing the drops and duplicates
+	round   int                   // of Step
+	faulted int                   // requests dropped and links delayed in the round
+}
+
+// Network of n Nodes on genesis, each mining to its own account, node0 to nodeN-1
+func NewTestNet(n int, genesis Genesis) *TestNet {
+	tn := &TestNet{
+		id:     testnets.Add(1),
+		cut:    map[[2]int]bool{},
+		faults: map[[2]int]LinkFaults{},
+		rng:    rand.New(rand.NewPCG(1, 0)),
+	}
+	clock := NewStepClock(time.UnixMicro(genesis.UnixTs), TESTNET_CLOCK_STEP)
+	for i := range n {
+		bc := CreateBlockChain(genesis)
+		bc.SetClock(clock)
+		bc.SetMiner(fmt.Sprintf("node%v", i))
+		node := NewNode(&bc)
+		tn.nodes = append(tn.nodes, node)
+		tn.servers = append(tn.servers, NewServer(node))
+	}
+	// Each node is reached by a host of its own from each other node, and one for the process
+	for to := range n {
+		for from := -1; from < n; from++ {
+			host := tn.host(from, to)
+			memHosts.Store(host, &memLink{tn: tn, from: from, to: to})
+			tn.hosts = append(tn.hosts, host)
+		}
+	}
+	return tn
+}
+
+// Host of node to for requests of node from, -1 for the process
+func (tn *TestNet) host(from, to int) string {
+	if from < 0 {
+		return fmt.Sprintf("testnet%v-node%v", tn.id, to)
+	}
+	return fmt.Sprintf("testnet%v-node%v-from%v", tn.id, to, from)
+}
+
+// Take the nodes off the in-memory transport
+func (tn *TestNet) Close() {
+	for _, host := range tn.hosts {
+		memHosts.Delete(host)
+	}
+}
+
+func (tn *TestNet) Len() int {
+	return len(tn.nodes)
+}
+
+func (tn *TestNet) Node(i int) *Node {
+	return tn.nodes[i]
+}
+
+// API URL of node i, reachable from the process only, whatever the partitions and faults
+func (tn *TestNet) URL(i int) string {
+	return "http://" + tn.host(-1, i)
+}
+
+// API URL of node to for node from, through the link between them
+func (tn *TestNet) PeerURL(from, to int) string {
+	return "http://" + tn.host(from, to)
+}
+
+// Admit txn to the Mempool of node i alone, the Blocks it mines carry it to the others
+func (tn *TestNet) Submit(i int, txn Transaction) error {
+	return tn.nodes[i].AddTxn(txn)
+}
+
+// Have node i mine a Block of its pending transactions, empty if there are none
+func (tn *TestNet) MineOn(i int) (Block, error) {
+	var b Block
+	var err error
+	tn.nodes[i].withChain(func(bc *BlockChain) {
+		if bc.mempool.Len() > 0 {
+			err = bc.CommitBlock()
+		} else {
+			err = bc.CommitEmptyBlock()
+		}
+		b = *bc.lastBlock()
+	})
+	return b, err
+}
+
+func link(i, j int) [2]int {
+	return [2]int{min(i, j), max(i, j)}
+}
+
+// Cut the links between the nodes of a and those of b, both ways
+func (tn *TestNet) Partition(a, b []int) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	for _, i := range a {
+		for _, j := range b {
+			tn.cut[link(i, j)] = true
+		}
+	}
+}
+
+// Restore the links cut by Partition, the faults of the links staying
+func (tn *TestNet) Heal() {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	clear(tn.cut)
+}
+
+// Whether nodes i and j can talk
+func (tn *TestNet) Reachable(i, j int) bool {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	return i != j && !tn.cut[link(i, j)]
+}
+
+// URLs of the peers node i can reach and syncs from this round
+func (tn *TestNet) peers(i int) []string {
+	peers := []string{}
+	for j := range tn.nodes {
+		if !tn.Reachable(i, j) {
+			continue
+		}
+		if tn.delayed(i, j) {
+			tn.mu.Lock()
+			tn.faulted++
+			tn.mu.Unlock()
+			continue
+		}
+		peers = append(peers, tn.PeerURL(i, j))
+	}
+	return peers
+}
+
+/*
+ * Have each node in turn sync from the peers it reaches, returning the
+ * Blocks appended and reverted
+ */
+func (tn *TestNet) Step() int {
+	tn.mu.Lock()
+	tn.round++
+	tn.faulted = 0
+	tn.mu.Unlock()
+	changed := 0
+	for i, node := range tn.nodes {
+		peers := tn.peers(i)
+		if len(peers) == 0 {
+			continue
+		}
+		node.withChain(func(bc *BlockChain) {
+			report, err := bc.Sync(peers)
+			if err != nil {
+				log.Printf("testnet: node %v: %v", i, err)
+			}
+			changed += report.Blocks + report.Reverted
+		})
+	}
+	return changed
+}
+
+/*
+ * Step until every node has the last Block of the peers it reaches, or a
+ * round changes nothing without a fault getting in the way, returning the
+ * rounds it took
+ */
+func (tn *TestNet) Settle() (int, error) {
+	for round := 1; round <= TESTNET_MAX_ROUNDS; round++ {
+		changed := tn.Step()
+		tn.mu.Lock()
+		faulted := tn.faulted
+		tn.mu.Unlock()
+		if tn.settled() || (changed == 0 && faulted == 0) {
+			return round, nil
+		}
+	}
+	return TESTNET_MAX_ROUNDS, fmt.Errorf("testnet still changing after %v rounds", TESTNET_MAX_ROUNDS)
+}
+
+// Hash and height of the last Block of each node
+func (tn *TestNet) Tips() ([]string, []int) {
+	hashes, heights := make([]string, len(tn.nodes)), make([]int, len(tn.nodes))
+	for i, node := range tn.nodes {
+		node.withChain(func(bc *BlockChain) {
+			hashes[i], heights[i] = bc.lastBlock().hash, bc.blocks.Len()-1
+		})
+	}
+	return hashes, heights
+}
+
+// Whether each node has the same last Block as the peers it reaches
+func (tn *TestNet) settled() bool {
+	hashes, _ := tn.Tips()
+	for i := range hashes {
+		for j := range hashes {
+			if tn.Reachable(i, j) && hashes[i] != hashes[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Whether every node has the same last Block
+func (tn *TestNet) Converged() bool {
+	hashes, _ := tn.Tips()
+	return len(slices.Compact(hashes)) <= 1
+}
+
+// Step of the -testnet scenario, with what it expects of the tips
+type testnetStep struct {
+	name   string
+	run    func(tn *TestNet) (int, error) // rounds it took to settle
+	expect func(hashes []string) error
+}
+
+func sameTips(nodes ...int) func([]string) error {
+	return func(hashes []string) error {
+		for _, i := range nodes[1:] {
+			if hashes[i] != hashes[nodes[0]] {
+				return fmt.Errorf("node %v is at %v, node %v at %v", i, hashes[i], nodes[0], hashes[nodes[0]])
+			}
+		}
+		return nil
+	}
+}
+
+// The scenario of the doc above on n nodes, the first half cut off from the second
+func testnetScenario(n int) []testnetStep {
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	a, b := all[:n/2], all[n/2:]
+	mine := func(i, blocks int) func(*TestNet) (int, error) {
+		return func(tn *TestNet) (int, error) {
+			for range blocks {
+				if _, err := tn.MineOn(i); err != nil {
+					return 0, err
+				}
+			}
+			return tn.Settle()
+		}
+	}
+	return []testnetStep{
+		{"node 0 mines 2 blocks", mine(0, 2), sameTips(all...)},
+		{fmt.Sprintf("partition %v from %v", a, b), func(tn *TestNet) (int, error) { tn.Partition(a, b); return 0, nil }, sameTips(all...)},
+		{"node 0 mines 2 blocks", mine(0, 2), sameTips(a...)},
+		{fmt.Sprintf("node %v mines 3 blocks", b[0]), mine(b[0], 3), func(hashes []string) error {
+			if err := sameTips(b...)(hashes); err != nil {
+				return err
+			}
+			if hashes[a[0]] == hashes[b[0]] {
+				return fmt.Errorf("both sides of the partition at %v", hashes[a[0]])
+			}
+			return nil
+		}},
+		{"heal", func(tn *TestNet) (int, error) { tn.Heal(); return tn.Settle() }, sameTips(all...)},
+	}
+}
+
+/*
+ * Run the scenario of -testnet on n nodes, faults injected between any two,
+ * and print the rounds each step took to settle and the tips after it,
+ * returning the exit code
+ */
+func runTestNet(n int, faults LinkFaults, out *Output) int {
+	type jsonStep struct {
+		Step    string   `json:"step"`
+		Rounds  int      `json:"rounds"`
+		Heights []int    `json:"heights"`
+		Tips    []string `json:"tips"`
+		OK      bool     `json:"ok"`
+		Error   string   `json:"error,omitempty"`
+	}
+	tn := NewTestNet(max(n, 2), TestGenesis(2))
+	defer tn.Close()
+	tn.SetAllFaults(faults)
+	code, rows, view := 0, [][]string{}, []jsonStep{}
+	for _, step := range testnetScenario(tn.Len()) {
+		rounds, err := step.run(tn)
+		hashes, heights := tn.Tips()
+		if err == nil {
+			err = step.expect(hashes)
+		}
+		s := jsonStep{Step: step.name, Rounds: rounds, Heights: heights, Tips: hashes, OK: err == nil}
+		if err != nil {
+			s.Error = err.Error()
+			code = 1
+		}
+		tips := ""
+		for i, hash := range hashes {
+			tips += fmt.Sprintf(" %v@%v", hash[:8], heights[i])
+		}
+		rows = append(rows, []string{s.Step, fmt.Sprint(s.Rounds), tips[1:], map[bool]string{true: "ok", false: "FAIL"}[s.OK], s.Error})
+		view = append(view, s)
+	}
+	if err := out.Table([]string{"step", "rounds", "tips", "result", "error"}, rows, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return code
+}
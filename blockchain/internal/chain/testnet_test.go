@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The scenario of the doc of testnet.go: partitioned, node 0 falls behind, healed, it reorganizes
+func TestTestNetPartitionReorg(t *testing.T) {
+	tn := NewTestNet(3, TestGenesis(4))
+	defer tn.Close()
+	settle := func() {
+		t.Helper()
+		if _, err := tn.Settle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mine := func(i int) Block {
+		t.Helper()
+		b, err := tn.MineOn(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	first := mine(0)
+	settle()
+	if hashes, _ := tn.Tips(); !tn.Converged() || hashes[0] != first.hash {
+		t.Fatalf("tips %v after node 0 mined %v", hashes, first.hash)
+	}
+
+	tn.Partition([]int{0}, []int{1, 2})
+	lost := mine(0)
+	mine(1)
+	tip := mine(1)
+	settle()
+	hashes, heights := tn.Tips()
+	if hashes[0] != lost.hash || hashes[1] != tip.hash || hashes[2] != tip.hash {
+		t.Fatalf("partitioned tips %v, expected %v, %v, %v", hashes, lost.hash, tip.hash, tip.hash)
+	}
+	if heights[0] != 2 || heights[1] != 3 {
+		t.Fatalf("partitioned heights %v, expected 2 and 3", heights)
+	}
+
+	tn.Heal()
+	settle()
+	hashes, heights = tn.Tips()
+	for i := range hashes {
+		if hashes[i] != tip.hash || heights[i] != 3 {
+			t.Errorf("node %v at %v@%v after healing, expected %v@3", i, hashes[i], heights[i], tip.hash)
+		}
+	}
+	tn.Node(0).withChain(func(bc *BlockChain) {
+		if b, _ := bc.blocks.Get(2); b.hash == lost.hash {
+			t.Errorf("node 0 kept block %v of its branch", lost.hash)
+		}
+	})
+}
+
+// The -testnet scenario ends with every node on the heavier branch, with or without faults
+func TestTestNetScenario(t *testing.T) {
+	for _, c := range []struct {
+		nodes  int
+		faults string
+	}{
+		{2, ""},
+		{3, ""},
+		{5, ""},
+		{3, "duplicate=0.5"},
+		{3, "delay=2"},
+		{4, "drop=0.2,duplicate=0.1,delay=1"},
+	} {
+		t.Run(fmt.Sprintf("%v nodes %v", c.nodes, c.faults), func(t *testing.T) {
+			faults, err := ParseLinkFaults(c.faults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tn := NewTestNet(c.nodes, TestGenesis(2))
+			defer tn.Close()
+			tn.SetAllFaults(faults)
+			for _, step := range testnetScenario(c.nodes) {
+				if _, err := step.run(tn); err != nil {
+					t.Fatalf("%v: %v", step.name, err)
+				}
+				hashes, _ := tn.Tips()
+				if err := step.expect(hashes); err != nil {
+					t.Fatalf("%v: %v", step.name, err)
+				}
+			}
+			if _, heights := tn.Tips(); heights[0] != 5 {
+				t.Errorf("heights %v after healing, expected 5", heights)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Time locks.
+ * As with the nLockTime of Bitcoin, a transaction may carry a lock before
+ * which no Block includes it, a height, a time or both:
+ *
+ *	lockHeight  first height of a Block that may include it
+ *	lockTime    unix microseconds the median time past of the chain, see
+ *	            timestamps.go, must have reached before a Block includes it
+ *
+ * The lock is part of the signed payload, so no party can lift it. The
+ * time is checked against the median time past, not the time of the Block
+ * itself, which its miner chooses: miners cannot unlock a transaction
+ * early by stamping their Blocks ahead. A locked transaction is admitted
+ * in the Mempool and waits there, holding back the later nonces of its
+ * payer, until a Block may include it, see Mempool.take, or it expires,
+ * see mempoollimits.go. A Block including it earlier is refused.
+ *
+ * Escrow: alice and bob make a 2-of-2 multisig escrow account, see
+ * multisig.go, and both sign a refund paying the escrow back to alice,
+ * locked at the height the deal times out, before alice funds it. Until
+ * then, the escrow only pays out what both sign again; past it, alice gets
+ * her coins back without bob, unless a payment of the escrow took the
+ * nonce of the refund first.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Lock the transaction until the chain reaches height, before signing it
+func (txn Transaction) WithLockHeight(height int) Transaction {
+	txn.lockHeight = height
+	return txn
+}
+
+// Lock the transaction until the median time past reaches t, before signing it
+func (txn Transaction) WithLockTime(t time.Time) Transaction {
+	txn.lockTime = t.UnixMicro()
+	return txn
+}
+
+func (txn Transaction) verifyLock() error {
+	if txn.lockHeight < 0 || txn.lockTime < 0 {
+		return errors.New("negative lock")
+	}
+	if txn.kind == TxnMint && (txn.lockHeight != 0 || txn.lockTime != 0) {
+		return errors.New("mint transactions cannot be locked")
+	}
+	return nil
+}
+
+// Check a Block at height, following Blocks of median time mtp, may include txn
+func (txn Transaction) checkLock(height int, mtp int64) error {
+	if height < txn.lockHeight {
+		return fmt.Errorf("%w: until height %v, not %v", ErrLocked, txn.lockHeight, height)
+	}
+	if mtp < txn.lockTime {
+		return fmt.Errorf("%w: until %v, the median time past is %v", ErrLocked, formatBlockTime(txn.lockTime), formatBlockTime(mtp))
+	}
+	return nil
+}
+
+// Whether the next Block may include txn as far as its lock goes
+func (bc *BlockChain) unlocked(txn Transaction) bool {
+	if txn.lockHeight == 0 && txn.lockTime == 0 {
+		return true
+	}
+	mtp, err := bc.medianTimePast()
+	return err == nil && txn.checkLock(bc.blocks.Len(), mtp) == nil
+}
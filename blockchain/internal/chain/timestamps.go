@@ -0,0 +1,82 @@
+/*
+ * Block timestamp rules.
+ * Miners stamp their Blocks with their own clock, and the retarget, see
+ * retarget.go, the mempool expiry and the explorer all believe them. As in
+ * Bitcoin, a Block is refused unless its time is:
+ *
+ *	past the median time past, the median of the times of the last
+ *	MEDIAN_TIME_BLOCKS Blocks, so it moves forward with the chain
+ *	at most MAX_FUTURE_BLOCK_TIME ahead of the clock of the node checking it
+ *
+ * The median lets a Block be stamped a little before its parent, as clocks
+ * drift, while no miner can drag the time back on its own. The first rule
+ * only depends on the chain, so every node agrees on it, and is checked
+ * with the rest of a Block, see DryRun. The second depends on the clock of
+ * the node: a Block refused as too early is accepted once the node catches
+ * up, so it is only checked on Blocks mined elsewhere, on import, sync and
+ * relay, and by light clients on the headers they download. A node whose
+ * clock lags behind the median time past stamps its Blocks right after it.
+ */
+package chain
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Blocks whose median time the next one must be past
+const MEDIAN_TIME_BLOCKS = 11
+
+// Furthest a Block may be stamped ahead of the clock of the node checking it
+const MAX_FUTURE_BLOCK_TIME = 2 * time.Hour
+
+// Median of the times of headers, in unix microseconds
+func medianTime(headers []Header) int64 {
+	times := make([]int64, len(headers))
+	for i, h := range headers {
+		times[i] = h.unixTs
+	}
+	slices.Sort(times)
+	return times[len(times)/2]
+}
+
+func formatBlockTime(unixTs int64) string {
+	return time.UnixMicro(unixTs).UTC().Format(time.RFC3339Nano)
+}
+
+// Check h, following headers, is stamped past their median time
+func checkMedianTime(h Header, headers []Header) error {
+	if mtp := medianTime(headers); h.unixTs <= mtp {
+		return fmt.Errorf("%w: %v is not past the median time %v of the last %v blocks",
+			ErrInvalidTimestamp, formatBlockTime(h.unixTs), formatBlockTime(mtp), len(headers))
+	}
+	return nil
+}
+
+// Check h is stamped at most MAX_FUTURE_BLOCK_TIME after now
+func checkFutureTime(h Header, now time.Time) error {
+	if limit := now.Add(MAX_FUTURE_BLOCK_TIME).UnixMicro(); h.unixTs > limit {
+		return fmt.Errorf("%w: %v is more than %v ahead of %v",
+			ErrInvalidTimestamp, formatBlockTime(h.unixTs), MAX_FUTURE_BLOCK_TIME, formatBlockTime(now.UnixMicro()))
+	}
+	return nil
+}
+
+// Median time past of the last MEDIAN_TIME_BLOCKS Blocks of the chain
+func (bc *BlockChain) medianTimePast() (int64, error) {
+	headers, err := bc.headersTo(bc.blocks.Len()-1, MEDIAN_TIME_BLOCKS)
+	if err != nil {
+		return 0, err
+	}
+	return medianTime(headers), nil
+}
+
+// Time of a Block mined now, unix microseconds past the median time past
+func (bc *BlockChain) nextBlockTime() int64 {
+	now := bc.now().UnixMicro()
+	if mtp, err := bc.medianTimePast(); err == nil && now <= mtp {
+		return mtp + 1
+	}
+	return now
+}
@@ -0,0 +1,200 @@
+/*
+ * Tokens.
+ * Besides the chain's coin, balances are kept per asset, see state.go, and
+ * transfers, swaps and orders move any asset. The assets of the genesis
+ * are premined; a TxnToken creates one later on, in the manner of an
+ * ERC-20 contract: its payer, the issuer, names a symbol no asset uses yet
+ * and is credited with the whole supply, which is fixed, as nothing mints
+ * the asset again. From then on the token moves between accounts by
+ * transfers of the asset, and the balances of an account in every asset
+ * are queried with GET /accounts/{account}, see explorer.go.
+ *
+ * The name and decimals of a token are for wallets and explorers: balances
+ * are Amounts, as for every asset, so a token has at most AMOUNT_DECIMALS
+ * decimals.
+ *
+ *	GET /tokens           assets of the genesis and tokens created since
+ *	GET /tokens/{symbol}  a token and the accounts holding it
+ */
+package chain
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+)
+
+const (
+	MAX_TOKEN_SYMBOL_SIZE = 12
+	MAX_TOKEN_NAME_SIZE   = 64
+	MAX_TOKEN_DECIMALS    = AMOUNT_DECIMALS
+)
+
+// Gas of the creation of a token
+const GAS_TOKEN = 50_000
+
+// Name and decimals of a token created by a TxnToken, whose asset is the symbol and amt the supply
+type TokenSpec struct {
+	name     string
+	decimals int
+}
+
+// Asset of the chain, as known to the state
+type Token struct {
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name,omitempty"`
+	Decimals int    `json:"decimals,omitempty"`
+	Supply   Amount `json:"supply"`
+	Issuer   string `json:"issuer,omitempty"` // empty for the assets of the genesis
+}
+
+type TokenHolder struct {
+	Account string `json:"account"`
+	Balance Amount `json:"balance"`
+}
+
+type jsonTokenDetail struct {
+	Token
+	Holders []TokenHolder `json:"holders"` // by balance, largest first
+}
+
+// Create the token symbol with a fixed supply credited to issuer
+func NewToken(issuer string, nonce uint64, symbol, name string, decimals int, supply Amount) Transaction {
+	return Transaction{
+		kind:  TxnToken,
+		payer: issuer,
+		asset: symbol,
+		amt:   supply,
+		nonce: nonce,
+		token: &TokenSpec{name: name, decimals: decimals},
+	}
+}
+
+func (t *TokenSpec) verify(symbol string, supply Amount) error {
+	if symbol == NATIVE_ASSET || len(symbol) > MAX_TOKEN_SYMBOL_SIZE {
+		return fmt.Errorf("token symbol must be 1 to %v bytes", MAX_TOKEN_SYMBOL_SIZE)
+	}
+	if len(t.name) > MAX_TOKEN_NAME_SIZE {
+		return fmt.Errorf("token name must be at most %v bytes", MAX_TOKEN_NAME_SIZE)
+	}
+	if t.decimals < 0 || t.decimals > MAX_TOKEN_DECIMALS {
+		return fmt.Errorf("token decimals must be 0 to %v", MAX_TOKEN_DECIMALS)
+	}
+	if !supply.valid() {
+		return errors.New("token supply must be positive")
+	}
+	return nil
+}
+
+func (t *TokenSpec) String() string {
+	return fmt.Sprintf("%q decimals:%v", t.name, t.decimals)
+}
+
+// Assets premined by the genesis, with their supply
+func (g Genesis) tokens() map[string]Token {
+	tokens := map[string]Token{}
+	for _, asset := range sortedKeys(g.Assets) {
+		token := Token{Symbol: asset}
+		for _, account := range sortedKeys(g.Assets[asset]) {
+			token.Supply += g.Assets[asset][account]
+		}
+		tokens[asset] = token
+	}
+	return tokens
+}
+
+func (s *State) createToken(txn Transaction) error {
+	if _, ok := s.tokens[txn.asset]; ok {
+		return fmt.Errorf("%w: %q", ErrTokenExists, txn.asset)
+	}
+	s.tokens[txn.asset] = Token{txn.asset, txn.token.name, txn.token.decimals, txn.amt, txn.payer}
+	s.credit(txn.payer, txn.asset, txn.amt)
+	return nil
+}
+
+// Assets of the genesis and tokens created since, by symbol
+func (bc *BlockChain) Tokens() []Token {
+	tokens := []Token{}
+	for _, symbol := range sortedKeys(bc.state.tokens) {
+		tokens = append(tokens, bc.state.tokens[symbol])
+	}
+	return tokens
+}
+
+// Token symbol and the accounts holding it, largest balance first
+func (bc *BlockChain) TokenHolders(symbol string) (Token, []TokenHolder, error) {
+	token, ok := bc.state.tokens[symbol]
+	if !ok {
+		return Token{}, nil, fmt.Errorf("%w: %q", ErrUnknownToken, symbol)
+	}
+	holders := []TokenHolder{}
+	for _, account := range sortedKeys(bc.state.balances) {
+		if amt := bc.state.balances[account][symbol]; amt != 0 {
+			holders = append(holders, TokenHolder{account, amt})
+		}
+	}
+	slices.SortStableFunc(holders, func(a, b TokenHolder) int {
+		return cmp.Compare(b.Balance, a.Balance)
+	})
+	return token, holders, nil
+}
+
+/*
+ * Print the tokens of bc or, when symbol is set, the accounts holding it,
+ * returning the exit code
+ */
+func runTokens(bc *BlockChain, symbol string, out *Output) int {
+	if symbol == "" {
+		rows := [][]string{}
+		tokens := bc.Tokens()
+		for _, t := range tokens {
+			issuer := t.Issuer
+			if issuer == "" {
+				issuer = "genesis"
+			}
+			rows = append(rows, []string{t.Symbol, t.Name, fmt.Sprint(t.Decimals), fmt.Sprint(t.Supply), issuer})
+		}
+		if err := out.Table([]string{"symbol", "name", "decimals", "supply", "issuer"}, rows, tokens); err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+	token, holders, err := bc.TokenHolders(symbol)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	out.Note("%v %v, supply %v", token.Symbol, token.Name, token.Supply)
+	rows := [][]string{}
+	for _, h := range holders {
+		rows = append(rows, []string{h.Account, fmt.Sprint(h.Balance)})
+	}
+	if err := out.Table([]string{"account", "balance"}, rows, jsonTokenDetail{token, holders}); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	var tokens []Token
+	s.node.withChain(func(bc *BlockChain) { tokens = bc.Tokens() })
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var detail jsonTokenDetail
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		detail.Token, detail.Holders, err = bc.TokenHolders(r.PathValue("symbol"))
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
@@ -0,0 +1,253 @@
+/*
+ * Chain monitor.
+ * -top redraws a dashboard of the chain on the terminal: height,
+ * difficulty, mempool, the latest Blocks and the progress of the Block
+ * being mined, the nonce reached and the hashes tried per second. It
+ * watches the node served with -http in-process, redrawing as Blocks and
+ * transactions arrive, or with -top-node the node API at a URL, polled
+ * every -top-interval. Ctrl-C leaves it.
+ *
+ * A Block is mined with the Node locked, so the progress of mining is
+ * metered apart from the chain, and GET /mining answers while the chain
+ * waits for the Block.
+ *
+ *	GET /mining  progress of the Block being mined, hashes tried by the node
+ */
+package chain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Default time between two redraws of -top
+const TOP_INTERVAL = time.Second
+
+// Blocks listed by -top
+const TOP_BLOCKS = 10
+
+// Nonces tried between two updates of the mining meter
+const MINING_METER_BATCH = 1 << 12
+
+type MiningProgress struct {
+	UnixTs     int64  `json:"unixTs"` // unix microseconds of the reading
+	Mining     bool   `json:"mining"` // a Block is being mined
+	Hashes     uint64 `json:"hashes"` // nonces tried by the process since it started
+	Nonce      int    `json:"nonce,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	Since      int64  `json:"since,omitempty"` // unix microseconds the Block began to be mined
+}
+
+// Hashing of the process, updated every MINING_METER_BATCH nonces
+type miningMeter struct {
+	mu         sync.Mutex
+	hashes     uint64
+	mining     int // Blocks being mined
+	nonce      int
+	difficulty int
+	since      time.Time
+}
+
+var meter miningMeter
+
+func (m *miningMeter) begin(nonce, difficulty int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mining++
+	m.nonce, m.difficulty, m.since = nonce, difficulty, time.Now()
+}
+
+// Count tries more nonces, the last one being nonce
+func (m *miningMeter) add(tries, nonce int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hashes += uint64(tries)
+	m.nonce = nonce
+}
+
+func (m *miningMeter) end(tries, nonce int) {
+	m.add(tries, nonce)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mining--
+}
+
+func (m *miningMeter) progress() MiningProgress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := MiningProgress{UnixTs: time.Now().UnixMicro(), Mining: m.mining > 0, Hashes: m.hashes}
+	if p.Mining {
+		p.Nonce, p.Difficulty, p.Since = m.nonce, m.difficulty, m.since.UnixMicro()
+	}
+	return p
+}
+
+// What -top shows, read from the node API
+type topView struct {
+	mu      sync.Mutex
+	stats   ChainStats
+	blocks  []jsonBlockSummary
+	chainAt time.Time // of the last reading of stats and blocks
+	mining  MiningProgress
+	rate    float64 // hashes per second between the last two readings of mining
+	err     error
+}
+
+// Read the chain part of the view, which waits while a local Block is mined
+func (v *topView) readChain(node *peerClient) {
+	var stats ChainStats
+	var blocks []jsonBlockSummary
+	_, err := node.get("/stats", &stats)
+	if err == nil {
+		_, err = node.get(fmt.Sprintf("/blocks?limit=%v", TOP_BLOCKS), &blocks)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.err = err
+	if err == nil {
+		v.stats, v.blocks, v.chainAt = stats, blocks, time.Now()
+	}
+}
+
+func (v *topView) readMining(node *peerClient) {
+	var p MiningProgress
+	_, err := node.get("/mining", &p)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err != nil {
+		v.err = err
+		return
+	}
+	if prev := v.mining; prev.UnixTs != 0 && p.UnixTs > prev.UnixTs && p.Hashes >= prev.Hashes {
+		v.rate = float64(p.Hashes-prev.Hashes) / (float64(p.UnixTs-prev.UnixTs) / 1e6)
+	}
+	v.mining = p
+}
+
+func (v *topView) draw(w io.Writer, url string, terminal bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var buf bytes.Buffer
+	if terminal {
+		buf.WriteString("\x1b[H\x1b[2J")
+	}
+	out := NewOutput(OutputTable, &buf)
+	out.Note("toychain top  %v  %v", url, time.Now().Format(time.TimeOnly))
+	if v.err != nil {
+		out.Note("error: %v", v.err)
+	}
+	out.Note("")
+	mining := fmt.Sprintf("idle, %v hashes tried", v.mining.Hashes)
+	if v.mining.Mining {
+		mining = fmt.Sprintf("block at difficulty %v, nonce %v, for %.1fs",
+			v.mining.Difficulty, v.mining.Nonce, time.Since(time.UnixMicro(v.mining.Since)).Seconds())
+	}
+	fields := [][2]string{{"mining", mining}, {"node hash rate", fmt.Sprintf("%.0f H/s", v.rate)}}
+	if !v.chainAt.IsZero() {
+		fields = append([][2]string{
+			{"height", fmt.Sprint(v.stats.Height)},
+			{"difficulty", fmt.Sprint(v.stats.Difficulty)},
+			{"transactions", fmt.Sprint(v.stats.Txns)},
+			{"mempool", fmt.Sprintf("%v pending", v.stats.Mempool)},
+			{"block interval", fmt.Sprintf("%.1fs", v.stats.BlockInterval)},
+			{"chain hash rate", fmt.Sprintf("%.0f H/s, from the difficulty", v.stats.HashRate)},
+			{"orphans", fmt.Sprint(v.stats.Orphans)},
+		}, fields...)
+	}
+	if err := out.Record(fields, nil); err != nil {
+		return err
+	}
+	out.Note("")
+	if v.chainAt.IsZero() {
+		out.Note("waiting for the chain")
+	}
+	rows := [][]string{}
+	for _, b := range v.blocks {
+		rows = append(rows, []string{fmt.Sprint(b.Height), b.Hash, time.UnixMicro(b.UnixTs).Format(time.DateTime), fmt.Sprint(b.Txns)})
+	}
+	if err := out.Table([]string{"height", "hash", "time", "txns"}, rows, nil); err != nil {
+		return err
+	}
+	if !terminal {
+		out.Note("")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+/*
+ * Redraw the dashboard of node on stdout every interval and, when local is
+ * the Node behind it, as its Blocks and transactions arrive, until
+ * interrupted, returning the exit code
+ */
+func runTop(node *peerClient, local *Node, interval time.Duration) int {
+	if interval <= 0 {
+		fmt.Fprintln(os.Stderr, "error: -top-interval must be positive")
+		return 1
+	}
+	terminal := false
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		terminal = true
+		fmt.Print("\x1b[?25l")
+		defer fmt.Print("\x1b[?25h\n")
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	var blocks, txns <-chan Event
+	if local != nil {
+		var cancel func()
+		blocks, cancel = local.Subscribe(NewBlock)
+		defer cancel()
+		txns, cancel = local.Subscribe(NewTxn)
+		defer cancel()
+	}
+
+	// The chain is read apart, so the mining progress is drawn while a local Block is mined
+	view := &topView{}
+	refresh, read := make(chan struct{}, 1), make(chan struct{}, 1)
+	trigger := func(c chan struct{}) {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		for range refresh {
+			view.readChain(node)
+			trigger(read)
+		}
+	}()
+	defer close(refresh)
+	trigger(refresh)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		view.readMining(node)
+		if err := view.draw(os.Stdout, node.url, terminal); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		select {
+		case <-interrupt:
+			return 0
+		case <-ticker.C:
+			trigger(refresh)
+		case <-blocks:
+			trigger(refresh)
+		case <-txns:
+			trigger(refresh)
+		case <-read:
+		}
+	}
+}
+
+func (s *Server) handleMining(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, meter.progress())
+}
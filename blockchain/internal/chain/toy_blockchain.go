@@ -0,0 +1,1902 @@
+/*
+ * This is a 'Toy Blockchain' created to learn basic concepts
+ * behind a Blockchain. It runs on a single node, and is in memory.
+ * For understanding the terminologies refer:
+ * https://ethereum.org/en/developers/docs/intro-to-ethereum/#terminology
+ */
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Max number of transactions to be packed in a Block, unless the genesis sets blockLimits
+const MAX_TXNS_PER_BLOCK = 5
+
+type TxnKind int
+
+const (
+	TxnTransfer    TxnKind = iota // payer pays amt to payee
+	TxnSwap                       // atomic multi-party exchange of assets
+	TxnMint                       // genesis allocation of amt to payee
+	TxnOrder                      // place a limit order on an asset pair
+	TxnCancelOrder                // cancel an open limit order of payer
+	TxnKV                         // write a key-value pair in a namespace of payer
+	TxnUTXO                       // spend unspent outputs into new ones
+	TxnMultisig                   // make payer an M-of-N multisig account
+	TxnMessage                    // message from payer encrypted to payee
+	TxnRecord                     // application-defined record sent by payer
+	TxnToken                      // create the token asset with a fixed supply amt held by payer
+)
+
+type Transaction struct {
+	kind       TxnKind
+	payer      string
+	payee      string
+	asset      string // asset moved, NATIVE_ASSET for the chain's coin
+	amt        Amount
+	payouts    []Payout      // further payees of a transfer, see NewBatchTransfer
+	fee        Amount        // flat fee paid by payer to get the transaction included
+	feeAsset   string        // asset the fees are paid in, NATIVE_ASSET for the chain's coin, see feeassets.go
+	nonce      uint64        // sequence number of the transaction for the payer
+	swap       *Swap         // legs and signatures of a TxnSwap
+	order      *Order        // order placed or cancelled by a TxnOrder or TxnCancelOrder
+	kv         *KVWrite      // key-value pair written by a TxnKV
+	utxo       *UTXOTxn      // inputs, outputs and signatures of a TxnUTXO
+	multisig   *MultisigSpec // keys and threshold declared by a TxnMultisig
+	message    *Message      // encrypted payload of a TxnMessage
+	record     *RecordTxn    // schema and JSON of a TxnRecord
+	token      *TokenSpec    // name and decimals of the token created by a TxnToken
+	script     *Script       // optional script that must succeed for the transaction to apply
+	accessList []string      // optional state keys the transaction may touch, see touched
+	data       []byte        // optional memo anchored on chain, up to MAX_TXN_DATA bytes
+	cosigs     [][]byte      // signatures required when payer is a multisig account
+	scheme     SigScheme     // of every signature the transaction carries, see wallet.go
+	chainID    string        // chain the transaction is only valid on, any if empty, see chainid.go
+	lockHeight int           // first height of a Block that may include the transaction, see timelocks.go
+	lockTime   int64         // unix microseconds the median time past must reach before, see timelocks.go
+
+	gasLimit uint64 // optional max gas the transaction may use, 0 if unset
+	gasPrice Amount // fee per unit of gas used, requires gasLimit
+}
+
+/*
+ * Header of a Block, the only part its hash covers: the transactions are
+ * committed to through the Merkle root, so mining re-hashes a few fixed
+ * size fields and light clients can follow the chain from headers alone
+ */
+type Header struct {
+	prevHash   string // hash of the previous Block
+	merkleRoot string // root of the Merkle tree of the transaction hashes
+	miner      string // account credited with the fees of the Block
+	unixTs     int64  // unix timestamp when the Block was created
+	difficulty int    // leading 0s required in the hash
+	retarget   int    // difficulty of the next Blocks on a devnet, 0 to keep it
+	stateRoot  string // root of the state after the Block, "" unless the chain commits to it, see statecommit.go
+	bloom      []byte // filter of the accounts the Block involves, nil unless the chain keeps them, see bloom.go
+	version    int    // rules the Block follows, 0 before the first upgrade of the chain, see upgrades.go
+	nonce      int    // Proof Of Work
+}
+
+type Block struct {
+	Header
+	data []Transaction // body: the transactions under merkleRoot
+	hash string        // hash of the Header
+}
+
+type BlockChain struct {
+	genesis     Genesis                  // Spec the chain was created from
+	mempool     *Mempool                 // Outstanding transactions
+	state       *State                   // Balances after the last committed Block
+	stateRoots  []string                 // Root of the state after each Block, "" if unknown, see stateroots.go
+	blocks      BlockStore               // Committed Blocks
+	difficulty  int                      // Proof Of Work difficulty
+	miner       string                   // Account mining new Blocks, collecting their fees
+	oracle      *PriceOracle             // Optional fiat price annotations
+	events      *EventBus                // Optional listeners of chain activity
+	archive     map[int]*State           // State every ARCHIVE_INTERVAL Blocks, nil unless archiving
+	txns        int                      // Transactions committed after genesis, see Stats
+	validators  []Validator              // Extra rules transactions must pass, see validator.go
+	upgrades    [][]Validator            // Extra rules of each upgrade of the genesis, see upgrades.go
+	policies    []Validator              // Rules of this node's Mempool only, see policy.go
+	records     map[string]recordSchema  // Schemas of the records accepted, see records.go
+	clock       Clock                    // Time of new Blocks, the system time if nil, see clock.go
+	nonces      NonceStrategy            // First nonce tried when mining, 0 if nil
+	builder     BlockBuilder             // Order the Mempool is packed in, by fee if nil, see builder.go
+	hashLimit   float64                  // Nonces tried per second at most when mining, 0 for no limit, see hashlimit.go
+	history     addressIndex             // Transactions of each account, see addressindex.go
+	orphans     []OrphanBlock            // Last Blocks dropped by reorganizations, see orphans.go
+	orphaned    int                      // Blocks ever dropped by reorganizations
+	caches      *lookupCaches            // Last lookups by hash and past balances, see cache.go
+	txnStatuses txnStatuses              // Steps of the last transactions seen, see txnstatus.go
+	tracer      *Tracer                  // Spans of the transactions and Blocks, nil unless tracing, see tracing.go
+	attempts    map[string]minedAttempts // Nonces tried mining the Blocks mined here, by hash, see metrics.go
+
+	mempoolLimits MempoolLimits // Caps and expiry of the Mempool, see mempoollimits.go
+	checkpoints   checkpoints   // Trusted hashes by height, see checkpoints.go
+	txnReceipts   receiptIndex  // Receipts of the committed transactions, see receipts.go
+
+	pruned      int            // Blocks below this height, genesis aside, have no body, see pruning.go
+	prunedState *State         // State after the Block at pruned-1, replays start from it
+	receipts    []PruneReceipt // Signed records of the pruned bodies, oldest first
+}
+
+// Cryptographic Hash using SHA-256
+func SHA256(packedBytes []byte) string {
+	hash := sha256.Sum256(packedBytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// Canonical encoding of the transaction, excluding signatures
+func (txn Transaction) bytes() []byte {
+	packed := fmt.Sprintf("%v|%v|%v|%q|%v|%v|%v|%v|%v", txn.kind, txn.payer, txn.payee, txn.asset, txn.amt,
+		txn.fee, txn.gasLimit, txn.gasPrice, txn.nonce)
+	for _, p := range txn.payouts {
+		packed += fmt.Sprintf("|%v|%v", p.payee, p.amt)
+	}
+	if txn.swap != nil {
+		for _, leg := range txn.swap.legs {
+			packed += fmt.Sprintf("|%v|%v|%q|%v", leg.from, leg.to, leg.asset, leg.amt)
+		}
+	}
+	if o := txn.order; o != nil {
+		packed += fmt.Sprintf("|%v|%v|%q|%q|%v|%v", o.id, o.side, o.base, o.quote, o.price, o.amount)
+	}
+	if w := txn.kv; w != nil {
+		packed += fmt.Sprintf("|%q|%q|%x", w.namespace, w.key, w.value)
+	}
+	if u := txn.utxo; u != nil {
+		for _, id := range u.inputs {
+			packed += "|" + id
+		}
+		for _, o := range u.outputs {
+			packed += fmt.Sprintf("|%v|%v", o.owner, o.amt)
+		}
+	}
+	if m := txn.multisig; m != nil {
+		packed += fmt.Sprintf("|%v", m.threshold)
+		for _, key := range m.keys {
+			packed += fmt.Sprintf("|%x", key)
+		}
+	}
+	if m := txn.message; m != nil {
+		packed += fmt.Sprintf("|%x|%x", m.ephemeral, m.sealed)
+	}
+	if r := txn.record; r != nil {
+		packed += fmt.Sprintf("|%q|%x", r.schema, r.payload)
+	}
+	if t := txn.token; t != nil {
+		packed += fmt.Sprintf("|%q|%v", t.name, t.decimals)
+	}
+	if txn.script != nil {
+		packed += fmt.Sprintf("|%q", txn.script.code)
+	}
+	for _, key := range txn.accessList {
+		packed += fmt.Sprintf("|%q", key)
+	}
+	// Only covered when set, so the hashes of other transactions are unchanged
+	if len(txn.data) > 0 {
+		packed += fmt.Sprintf("|data=%x", txn.data)
+	}
+	if txn.feeAsset != NATIVE_ASSET {
+		packed += fmt.Sprintf("|feeAsset=%q", txn.feeAsset)
+	}
+	if txn.scheme != SchemeECDSA {
+		packed += fmt.Sprintf("|scheme=%v", txn.scheme)
+	}
+	if txn.chainID != "" {
+		packed += fmt.Sprintf("|chain=%q", txn.chainID)
+	}
+	if txn.lockHeight != 0 {
+		packed += fmt.Sprintf("|lockHeight=%v", txn.lockHeight)
+	}
+	if txn.lockTime != 0 {
+		packed += fmt.Sprintf("|lockTime=%v", txn.lockTime)
+	}
+	return []byte(packed)
+}
+
+// Digest signed by the parties of the transaction
+func (txn Transaction) digest() []byte {
+	hash := sha256.Sum256(txn.bytes())
+	return hash[:]
+}
+
+// Transaction ID
+func (txn Transaction) Hash() string {
+	return SHA256(txn.bytes())
+}
+
+func (txn Transaction) String() string {
+	switch txn.kind {
+	case TxnSwap:
+		return fmt.Sprintf("{swap by %v nonce:%v: %v}", txn.payer, txn.nonce, txn.swap)
+	case TxnMint:
+		return fmt.Sprintf("{mint payee:%v amt:%v%v}", txn.payee, txn.amt, assetSuffix(txn.asset))
+	case TxnOrder, TxnCancelOrder:
+		return fmt.Sprintf("{order by %v nonce:%v: %v}", txn.payer, txn.nonce, txn.order)
+	case TxnKV:
+		return fmt.Sprintf("{kv by %v nonce:%v: %v}", txn.payer, txn.nonce, txn.kv)
+	case TxnUTXO:
+		return fmt.Sprintf("{utxo by %v nonce:%v: %v}", txn.payer, txn.nonce, txn.utxo)
+	case TxnMultisig:
+		return fmt.Sprintf("{%v nonce:%v: %v}", txn.payer, txn.nonce, txn.multisig)
+	case TxnMessage:
+		return fmt.Sprintf("{message from %v to %v nonce:%v: %v}", txn.payer, txn.payee, txn.nonce, txn.message)
+	case TxnRecord:
+		return fmt.Sprintf("{record by %v nonce:%v: %v}", txn.payer, txn.nonce, txn.record)
+	case TxnToken:
+		return fmt.Sprintf("{token by %v nonce:%v: %v%v %v}", txn.payer, txn.nonce, txn.amt, assetSuffix(txn.asset), txn.token)
+	}
+	desc := fmt.Sprintf("{payer:%v payee:%v amt:%v%v", txn.payer, txn.payee, txn.amt, assetSuffix(txn.asset))
+	for _, p := range txn.payouts {
+		desc += fmt.Sprintf(" payee:%v amt:%v%v", p.payee, p.amt, assetSuffix(txn.asset))
+	}
+	desc += fmt.Sprintf(" fee:%v%v nonce:%v", txn.totalFee(), assetSuffix(txn.feeAsset), txn.nonce)
+	if len(txn.data) > 0 {
+		desc += fmt.Sprintf(" data:%x", txn.data)
+	}
+	if txn.script != nil {
+		desc += fmt.Sprintf(" %v", txn.script)
+	}
+	if txn.lockHeight != 0 {
+		desc += fmt.Sprintf(" lockHeight:%v", txn.lockHeight)
+	}
+	if txn.lockTime != 0 {
+		desc += fmt.Sprintf(" lockTime:%v", formatBlockTime(txn.lockTime))
+	}
+	return desc + "}"
+}
+
+/*
+ * Attach data to the transaction, eg. the hash of a document to prove it
+ * existed by the time of the Block, before signing it
+ */
+func (txn Transaction) WithData(data []byte) Transaction {
+	txn.data = append([]byte{}, data...)
+	return txn
+}
+
+// Whether account sends or receives anything in the transaction
+func (txn Transaction) involves(account string) bool {
+	_, ok := txn.directions()[account]
+	return ok
+}
+
+// Stateless checks of a transaction before it is admitted in the Mempool
+func (txn Transaction) verify() error {
+	if len(txn.data) > MAX_TXN_DATA {
+		return fmt.Errorf("data of %v bytes, more than %v", len(txn.data), MAX_TXN_DATA)
+	}
+	if err := txn.verifyAmounts(); err != nil {
+		return err
+	}
+	if err := txn.verifyGas(); err != nil {
+		return err
+	}
+	if err := txn.verifyPayouts(); err != nil {
+		return err
+	}
+	if err := txn.verifyAccessList(); err != nil {
+		return err
+	}
+	if err := txn.verifyLock(); err != nil {
+		return err
+	}
+	if !txn.scheme.valid() {
+		return fmt.Errorf("unknown signature %v", txn.scheme)
+	}
+	switch txn.kind {
+	case TxnSwap:
+		if txn.swap == nil {
+			return errors.New("swap transaction without legs")
+		}
+		return txn.swap.verify(txn.scheme, txn.digest())
+	case TxnMint:
+		return errors.New("mint transactions are only allowed in genesis")
+	case TxnOrder, TxnCancelOrder:
+		if txn.order == nil {
+			return errors.New("order transaction without order")
+		}
+		return txn.order.verify(txn.kind)
+	case TxnKV:
+		if txn.kv == nil {
+			return errors.New("key-value transaction without key")
+		}
+		return txn.kv.verify()
+	case TxnUTXO:
+		if txn.utxo == nil {
+			return errors.New("UTXO transaction without inputs or outputs")
+		}
+		return txn.utxo.verify(txn.scheme, txn.digest(), txn.amt)
+	case TxnMultisig:
+		if txn.multisig == nil {
+			return errors.New("multisig transaction without keys")
+		}
+		return txn.multisig.verify()
+	case TxnMessage:
+		if txn.message == nil {
+			return errors.New("message transaction without payload")
+		}
+		return txn.message.verify(txn.payee)
+	case TxnRecord:
+		if txn.record == nil {
+			return errors.New("record transaction without record")
+		}
+		return txn.record.verify()
+	case TxnToken:
+		if txn.token == nil {
+			return errors.New("token transaction without token")
+		}
+		return txn.token.verify(txn.asset, txn.amt)
+	}
+	if txn.script != nil && len(txn.script.ops()) > MAX_SCRIPT_OPS {
+		return fmt.Errorf("script has more than %v ops", MAX_SCRIPT_OPS)
+	}
+	return nil
+}
+
+// Bytes of the Header covered by the hash, apart from the nonce
+func (h Header) fixedBytes() []byte {
+	fixed := fmt.Sprintf("%v|%v|%v|%v|%v|", h.prevHash, h.merkleRoot, h.miner, h.unixTs, h.difficulty)
+	// Only covered when set, so the hashes of other Blocks are unchanged
+	if h.retarget != 0 {
+		fixed += fmt.Sprintf("retarget=%v|", h.retarget)
+	}
+	if h.stateRoot != "" {
+		fixed += fmt.Sprintf("state=%v|", h.stateRoot)
+	}
+	if h.bloom != nil {
+		fixed += fmt.Sprintf("bloom=%x|", h.bloom)
+	}
+	if h.version != 0 {
+		fixed += fmt.Sprintf("version=%v|", h.version)
+	}
+	return []byte(fixed)
+}
+
+// Bytes of a Header covered by the hash, the nonce appended to its fixedBytes
+func appendNonce(fixed []byte, nonce int) []byte {
+	return strconv.AppendInt(fixed, int64(nonce), 10)
+}
+
+func (h Header) computeHash() string {
+	return SHA256(appendNonce(h.fixedBytes(), h.nonce))
+}
+
+func meetsDifficulty(hash string, difficulty int) bool {
+	if difficulty > len(hash) {
+		return false
+	}
+	for i := 0; i < difficulty; i++ {
+		if hash[i] != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the hex of the raw hash sum starts with difficulty 0s, see meetsDifficulty
+func sumMeetsDifficulty(sum *[sha256.Size]byte, difficulty int) bool {
+	if difficulty <= 0 {
+		return true
+	}
+	if difficulty > 2*len(sum) {
+		return false
+	}
+	for _, b := range sum[:difficulty/2] {
+		if b != 0 {
+			return false
+		}
+	}
+	return difficulty%2 == 0 || sum[difficulty/2]>>4 == 0
+}
+
+// Seal the transactions in the Header and do the Proof Of Work with pow, SHA-256 if nil
+func (b *Block) mine(difficulty int, pow *PowSpec) {
+	b.mineLimited(difficulty, pow, nil)
+}
+
+// Mine b as mine does, pacing the tries with limit unless nil
+func (b *Block) mineLimited(difficulty int, pow *PowSpec, limit *hashLimiter) {
+	b.merkleRoot = merkleRoot(b.data)
+	b.difficulty = difficulty
+	meter.begin(b.nonce, difficulty)
+	// Tries not counted by the mining meter yet, see top.go
+	tries := 1
+	defer func() { meter.end(tries, b.nonce) }()
+	if pow.memoryHard() {
+		for !pow.meets(b.Header, "", difficulty) {
+			limit.try()
+			b.nonce++
+			if tries++; tries == MINING_METER_BATCH {
+				meter.add(tries, b.nonce)
+				tries = 0
+			}
+		}
+		b.hash = b.computeHash()
+		return
+	}
+	// The fixed bytes are formatted once and each try only rewrites the
+	// nonce past them in the same buffer, large enough for any int, and
+	// checks the raw sum: the hex hash is only formatted for the winner
+	header := b.fixedBytes()
+	fixed := len(header)
+	header = append(make([]byte, 0, fixed+20), header...)
+	sum := sha256.Sum256(appendNonce(header[:fixed], b.nonce))
+	for !sumMeetsDifficulty(&sum, difficulty) {
+		limit.try()
+		b.nonce++
+		sum = sha256.Sum256(appendNonce(header[:fixed], b.nonce))
+		if tries++; tries == MINING_METER_BATCH {
+			meter.add(tries, b.nonce)
+			tries = 0
+		}
+	}
+	b.hash = hex.EncodeToString(sum[:])
+}
+
+// State right after the genesis Block of the spec
+func (g Genesis) state(genesisBlock Block) *State {
+	state := NewState()
+	for _, txn := range genesisBlock.data {
+		state.apply(txn)
+	}
+	for _, v := range g.Validators {
+		state.checkKey(v.Name, v.Key)
+	}
+	if g.FeeOracle != "" {
+		state.namespaces[FEE_RATES_NAMESPACE] = g.FeeOracle
+	}
+	state.issuance, state.supply = g.Issuance, g.premine()
+	state.tokens = g.tokens()
+	if state.governors = g.governors(); state.governors != nil {
+		for _, governor := range state.governors.accounts() {
+			state.namespaces[governanceNamespace(governor)] = governor
+		}
+	}
+	return state
+}
+
+func CreateBlockChain(genesis Genesis) BlockChain {
+	genesisBlock := genesis.block()
+	bc := BlockChain{
+		genesis:    genesis,
+		mempool:    NewMempool(),
+		state:      genesis.state(genesisBlock),
+		blocks:     NewMemoryStore(),
+		difficulty: genesis.Difficulty,
+		history:    addressIndex{},
+	}
+	bc.txnReceipts = receiptIndex{}
+	bc.stateRoots = []string{bc.state.Root()}
+	bc.SetCacheSizes(DefaultCacheSizes())
+	for _, rule := range genesis.Rules {
+		bc.AddValidator(rule.Validator())
+	}
+	for _, u := range genesis.Upgrades {
+		bc.upgrades = append(bc.upgrades, u.validators())
+	}
+	for _, app := range genesis.Apps {
+		if register := RECORD_APPS[app]; register != nil {
+			register(&bc)
+		}
+	}
+	bc.blocks.Append(genesisBlock)
+	bc.history.add(0, genesisBlock)
+	return bc
+}
+
+func (bc BlockChain) ChainID() string {
+	return bc.genesis.ChainID
+}
+
+// Hash of the genesis Block, equal for all chains created from the same spec
+func (bc BlockChain) GenesisHash() string {
+	return bc.blockAt(0).hash
+}
+
+// Account credited with the fees of the Blocks committed from now on
+func (bc *BlockChain) SetMiner(account string) {
+	bc.miner = account
+}
+
+// Annotate amounts with fiat values from oracle, nil disables annotations
+func (bc *BlockChain) SetPriceOracle(oracle *PriceOracle) {
+	bc.oracle = oracle
+}
+
+func (bc BlockChain) lastBlock() *Block {
+	b := bc.blockAt(bc.blocks.Len() - 1)
+	return &b
+}
+
+/*
+ * Add a transaction to the Mempool
+ * Transactions with a future nonce are queued until the missing nonces
+ * arrive, transactions reusing a nonce or failing the stateless checks
+ * (eg. an invalid signature) are refused, as are transactions below the fee
+ * floor or too cheap to enter a Mempool at its limits, see mempoollimits.go
+ * A transaction reusing the nonce of a held one replaces it if it pays
+ * enough more, see replace.go
+ */
+func (bc *BlockChain) AddTxn(txn Transaction) error {
+	span := bc.tracer.startTxn("mempool.admit", txn)
+	received := bc.txnReceived(txn)
+	err := bc.addTxn(txn)
+	bc.tracer.admitted(txn, span, err)
+	// Unless refused as a duplicate of the one admitted or committed
+	if received {
+		bc.txnAdmitted(txn, err)
+	}
+	return err
+}
+
+func (bc *BlockChain) addTxn(txn Transaction) error {
+	if err := invalidTxn(txn.verify()); err != nil {
+		return err
+	}
+	if err := bc.checkAddresses(txn); err != nil {
+		return err
+	}
+	if err := bc.checkFeeAsset(txn); err != nil {
+		return err
+	}
+	if err := bc.checkChainID(txn); err != nil {
+		return err
+	}
+	if err := bc.checkParamChange(txn, bc.blocks.Len()); err != nil {
+		return err
+	}
+	if err := bc.validate(txn, bc.state); err != nil {
+		return err
+	}
+	if err := bc.checkPolicies(txn); err != nil {
+		return err
+	}
+	if err := bc.checkSize(txn); err != nil {
+		return err
+	}
+	if err := bc.checkFeeFloor(txn); err != nil {
+		return err
+	}
+	if bc.mempoolFull(txn) {
+		if err := bc.CommitBlock(); err != nil {
+			log.Printf("committing the full mempool: %v", err)
+		}
+	}
+	bc.expireTxns()
+	if old, ok := bc.mempool.heldNonce(txn.payer, txn.nonce); ok {
+		if err := bc.replaceTxn(old, txn); err != nil {
+			return err
+		}
+	} else {
+		if err := bc.evict(txn.size(), txn.feeValue(bc.mempool.rates)); err != nil {
+			return err
+		}
+		if err := bc.mempool.add(txn, bc.state.nonce(txn.payer)); err != nil {
+			return err
+		}
+	}
+	bc.expireTxns()
+	bc.events.publish(Event{Type: NewTxn, Txn: &txn})
+	return nil
+}
+
+/*
+ * Pack the pending transactions fitting in the block limits, see
+ * blocksize.go, and using at most BLOCK_GAS_LIMIT gas in a new Block, and
+ * append it to the BlockChain
+ * Transactions that cannot be applied to the current state (eg. a swap
+ * whose parties lack the funds) are dropped from the Block
+ * Fails with ErrEmptyMempool when there is nothing to commit, and with
+ * the failure of the last dropped transaction when none applies
+ */
+func (bc *BlockChain) CommitBlock() error {
+	if bc.mempool.Len() == 0 {
+		return ErrEmptyMempool
+	}
+	span := bc.tracer.Start("block", SpanContext{})
+	assembling := bc.tracer.Start("block.assemble", span.Context())
+	b, state, err := bc.assembleBlock()
+	assembling.End(err)
+	if err != nil {
+		span.End(err)
+		return err
+	}
+	bc.tracer.linkTxns(span, b.data)
+	span.SetAttr("block.txns", len(b.data))
+	mining := bc.tracer.Start("block.mine", span.Context())
+	bc.commitState(&b, state)
+	bc.commitAddresses(&b)
+	bc.commitVersion(&b)
+	bc.mine(&b)
+	mining.SetAttr("block.difficulty", b.difficulty)
+	mining.SetAttr("block.nonce", b.nonce)
+	mining.End(nil)
+	committing := bc.tracer.Start("block.commit", span.Context())
+	err = bc.commit(b, state)
+	committing.End(err)
+	span.SetAttr("block.hash", b.hash)
+	span.End(err)
+	return err
+}
+
+// Mine and append a Block without transactions, eg. to keep a block schedule, see miner.go
+func (bc *BlockChain) CommitEmptyBlock() error {
+	return bc.commitEmpty(0)
+}
+
+// Mine and append an empty Block retargeting to difficulty unless 0, see devnet.go
+func (bc *BlockChain) commitEmpty(difficulty int) error {
+	b := Block{
+		Header: Header{
+			prevHash: bc.lastBlock().hash,
+			miner:    bc.miner,
+			unixTs:   bc.nextBlockTime(),
+			retarget: difficulty,
+		},
+		data: []Transaction{},
+	}
+	state, err := bc.DryRun(b)
+	if err != nil {
+		return err
+	}
+	bc.commitState(&b, state)
+	bc.commitAddresses(&b)
+	bc.commitVersion(&b)
+	bc.mine(&b)
+	return bc.commit(b, state)
+}
+
+// Block of the pending transactions that apply, and the state it leads to, see CommitBlock
+func (bc *BlockChain) assembleBlock() (Block, *State, error) {
+	state := bc.state.clone()
+	data := []Transaction{}
+	var dropped error
+	for _, txn := range bc.mempool.take(bc.builder, bc.blockLimits(), BLOCK_GAS_LIMIT, bc.unlocked) {
+		if err := state.apply(txn); err == nil {
+			data = append(data, txn)
+		} else {
+			dropped = fmt.Errorf("transaction %v: %w", txn.Hash(), err)
+			bc.mempool.rewind(txn.payer, state.nonce(txn.payer))
+			bc.txnDropped(txn.Hash(), err.Error())
+		}
+	}
+	if len(data) == 0 {
+		if dropped == nil {
+			return Block{}, nil, ErrEmptyMempool
+		}
+		return Block{}, nil, dropped
+	}
+	b := Block{
+		Header: Header{
+			prevHash: bc.lastBlock().hash,
+			miner:    bc.miner,
+			unixTs:   bc.nextBlockTime(),
+		},
+		data: data,
+	}
+	// Never spend Proof Of Work on a Block peers would reject
+	state, err := bc.DryRun(b)
+	for err != nil {
+		var txnErr *TxnError
+		if !errors.As(err, &txnErr) {
+			return Block{}, nil, fmt.Errorf("not mining block: %w", err)
+		}
+		log.Printf("dropping %v from block: %v", txnErr.Hash, txnErr.Err)
+		b.data = bc.dropTxn(b.data, txnErr.Index)
+		bc.txnDropped(txnErr.Hash, txnErr.Err.Error())
+		if len(b.data) == 0 {
+			return Block{}, nil, err
+		}
+		state, err = bc.DryRun(b)
+	}
+	return b, state, nil
+}
+
+/*
+ * Remove txns[i] from a candidate Block, along with the later transactions
+ * of the same payer, which go back to the Mempool
+ */
+func (bc *BlockChain) dropTxn(txns []Transaction, i int) []Transaction {
+	dropped := txns[i]
+	kept := append([]Transaction{}, txns[:i]...)
+	bc.mempool.rewind(dropped.payer, dropped.nonce)
+	for _, txn := range txns[i+1:] {
+		if txn.payer == dropped.payer {
+			bc.mempool.add(txn, dropped.nonce)
+		} else {
+			kept = append(kept, txn)
+		}
+	}
+	return kept
+}
+
+// Append a validated Block along with the state it leads to
+func (bc *BlockChain) commit(b Block, state *State) error {
+	difficulty, err := bc.nextDifficulty(b, state)
+	if err != nil {
+		return err
+	}
+	root := b.stateRoot
+	if root == "" {
+		root = state.Root()
+	}
+	if s, ok := bc.blocks.(*TieredStore); ok {
+		err = s.appendCommitted(b, root)
+	} else {
+		err = bc.blocks.Append(b)
+	}
+	if err != nil {
+		return fmt.Errorf("storing block %v: %w", b.hash, err)
+	}
+	height := bc.blocks.Len() - 1
+	bc.difficulty = difficulty
+	bc.txns += len(b.data)
+	bc.history.add(height, b)
+	bc.txnReceipts.add(bc.state.receipts(height, b))
+	if bc.archive != nil && height%ARCHIVE_INTERVAL == 0 {
+		bc.archive[height] = state.clone()
+	}
+	ev := Event{Type: NewBlock, Block: &b, Height: height}
+	if bc.events != nil {
+		ev.Delta = diffStates(bc.state, state)
+	}
+	bc.state = state
+	bc.stateRoots = append(bc.stateRoots, root)
+	bc.mempool.rates = state.feeRates()
+	bc.expireTxns()
+	bc.events.publish(ev)
+	bc.tracer.included(b, height)
+	bc.txnsIncluded(b, height)
+	return nil
+}
+
+/*
+ * Validate a Block mined elsewhere (eg. imported from a file) and append
+ * it to the BlockChain, see Validate
+ */
+func (bc *BlockChain) appendBlock(b Block) error {
+	state, err := bc.validateBlock(b)
+	if err != nil {
+		return err
+	}
+	return bc.commit(b, state)
+}
+
+/*
+ * Check b is a valid next Block without appending it: it must extend the
+ * last Block, carry a correct Proof Of Work unless a checkpoint vouches for
+ * it, see checkpoints.go, and all its transactions must apply to the
+ * current state
+ */
+func (bc *BlockChain) Validate(b Block) error {
+	_, err := bc.validateBlock(b)
+	return err
+}
+
+// State b leads to once validated, see Validate
+func (bc *BlockChain) validateBlock(b Block) (*State, error) {
+	if b.prevHash != bc.lastBlock().hash {
+		return nil, fmt.Errorf("%w: block %v has parent %v", ErrInvalidPrevHash, b.hash, b.prevHash)
+	}
+	if b.computeHash() != b.hash {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBlockHash, b.hash)
+	}
+	height := bc.blocks.Len()
+	if err := bc.checkpoints.check(height, b.hash); err != nil {
+		return nil, err
+	}
+	// Each Block is checked against the difficulty it records, which must be the chain's next
+	if b.difficulty != bc.difficulty {
+		return nil, fmt.Errorf("%w: block %v records %v, expected %v", ErrWrongDifficulty, b.hash, b.difficulty, bc.difficulty)
+	}
+	// The checkpoints vouch for the work of the Blocks up to them
+	if err := bc.checkStatic(b, height > bc.checkpoints.last()); err != nil {
+		return nil, err
+	}
+	state, err := bc.dryRun(b, false)
+	if err != nil {
+		return nil, fmt.Errorf("block %v: %w", b.hash, err)
+	}
+	if err := bc.checkStateCommitment(b, state); err != nil {
+		return nil, err
+	}
+	if err := bc.checkAddressBloom(b); err != nil {
+		return nil, err
+	}
+	if err := bc.checkVersion(height, b); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+/*
+ * Checks of b needing no state, cheap enough to run on whatever a peer
+ * sends before touching the chain: its hash is the one of its header and,
+ * with work, meets the difficulty it records, its transactions match the
+ * merkle root and pass their stateless checks (eg. signatures), and it is
+ * stamped at most MAX_FUTURE_BLOCK_TIME ahead
+ */
+func (bc *BlockChain) checkStatic(b Block, work bool) error {
+	if b.computeHash() != b.hash {
+		return fmt.Errorf("%w: %v", ErrInvalidBlockHash, b.hash)
+	}
+	if work && !bc.genesis.Pow.meets(b.Header, b.hash, b.difficulty) {
+		return fmt.Errorf("%w: block %v, difficulty %v", ErrInsufficientWork, b.hash, b.difficulty)
+	}
+	if merkleRoot(b.data) != b.merkleRoot {
+		return fmt.Errorf("%w: block %v", ErrInvalidMerkleRoot, b.hash)
+	}
+	if err := checkRetarget(bc.genesis.DevNet, b.retarget); err != nil {
+		return fmt.Errorf("block %v: %w", b.hash, err)
+	}
+	if err := checkFutureTime(b.Header, bc.now()); err != nil {
+		return fmt.Errorf("block %v: %w", b.hash, err)
+	}
+	for i, txn := range b.data {
+		if err := invalidTxn(txn.verify()); err != nil {
+			return fmt.Errorf("block %v: %w", b.hash, &TxnError{i, txn.Hash(), err})
+		}
+	}
+	return nil
+}
+
+// Failure of one transaction of a Block
+type TxnError struct {
+	Index int    // position in the Block
+	Hash  string // transaction ID
+	Err   error
+}
+
+func (e *TxnError) Error() string {
+	return fmt.Sprintf("transaction %v: %v", e.Hash, e.Err)
+}
+
+func (e *TxnError) Unwrap() error {
+	return e.Err
+}
+
+/*
+ * Run every validation of a Block but the Proof Of Work against an overlay
+ * of the current state, returning the state the Block leads to. A failing
+ * transaction is reported as a *TxnError
+ */
+func (bc *BlockChain) DryRun(b Block) (*State, error) {
+	return bc.dryRun(b, true)
+}
+
+// DryRun, skipping the stateless checks of the transactions unless verify
+func (bc *BlockChain) dryRun(b Block, verify bool) (*State, error) {
+	if b.prevHash != bc.lastBlock().hash {
+		return nil, ErrInvalidPrevHash
+	}
+	headers, err := bc.headersTo(bc.blocks.Len()-1, MEDIAN_TIME_BLOCKS)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMedianTime(b.Header, headers); err != nil {
+		return nil, err
+	}
+	height, mtp := bc.blocks.Len(), medianTime(headers)
+	if !bc.blockLimits().fits(len(b.data), b.size()) || b.gasUsed() > BLOCK_GAS_LIMIT {
+		return nil, ErrBlockFull
+	}
+	for i, txn := range b.data {
+		if verify {
+			if err := invalidTxn(txn.verify()); err != nil {
+				return nil, &TxnError{i, txn.Hash(), err}
+			}
+		}
+		if err := bc.checkAddresses(txn); err != nil {
+			return nil, &TxnError{i, txn.Hash(), err}
+		}
+		if err := bc.checkFeeAsset(txn); err != nil {
+			return nil, &TxnError{i, txn.Hash(), err}
+		}
+		if err := bc.checkChainID(txn); err != nil {
+			return nil, &TxnError{i, txn.Hash(), err}
+		}
+		if err := txn.checkLock(height, mtp); err != nil {
+			return nil, &TxnError{i, txn.Hash(), err}
+		}
+		if err := bc.checkParamChange(txn, height); err != nil {
+			return nil, &TxnError{i, txn.Hash(), err}
+		}
+		if err := bc.validate(txn, bc.state); err != nil {
+			return nil, &TxnError{i, txn.Hash(), err}
+		}
+	}
+	state := bc.state.clone()
+	if err := state.applyParallel(b.data); err != nil {
+		return nil, err
+	}
+	state.payMiner(b)
+	return state, nil
+}
+
+// Balance of account in asset, NATIVE_ASSET for the chain's coin
+func (bc *BlockChain) Balance(account, asset string) Amount {
+	return bc.state.Balance(account, asset)
+}
+
+func (bc *BlockChain) Mempool() *Mempool {
+	return bc.mempool
+}
+
+// Run or regenerate the conformance fixtures, returning the exit code
+func runConformance(dir string, write bool, out *Output) int {
+	if write {
+		if err := WriteConformance(dir); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+	results, err := RunConformance(dir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	type jsonResult struct {
+		Fixture string `json:"fixture"`
+		OK      bool   `json:"ok"`
+		Error   string `json:"error,omitempty"`
+	}
+	code, rows, view := 0, [][]string{}, []jsonResult{}
+	for _, result := range results {
+		r := jsonResult{Fixture: result.Fixture, OK: result.Err == nil}
+		if result.Err != nil {
+			r.Error = result.Err.Error()
+			code = 1
+		}
+		rows = append(rows, []string{r.Fixture, map[bool]string{true: "ok", false: "FAIL"}[r.OK], r.Error})
+		view = append(view, r)
+	}
+	if err := out.Table([]string{"fixture", "result", "error"}, rows, view); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return code
+}
+
+// Simulate adding transactions
+func simulateTxns(blockchain *BlockChain) {
+	blockchain.AddTxn(Transaction{
+		payer: "alice",
+		payee: "bob",
+		amt:   10 * COIN,
+		nonce: 0,
+	})
+	blockchain.AddTxn(Transaction{
+		payer: "alice",
+		payee: "bob",
+		amt:   30 * COIN,
+		nonce: 1,
+	})
+	blockchain.AddTxn(Transaction{
+		payer: "bob",
+		payee: "alice",
+		amt:   35 * COIN,
+		nonce: 0,
+	})
+	blockchain.AddTxn(Transaction{
+		payer: "clark",
+		payee: "bob",
+		amt:   10 * COIN,
+		nonce: 0,
+	})
+	// Future nonce, queued until clark's nonce 1 arrives
+	blockchain.AddTxn(Transaction{
+		payer: "clark",
+		payee: "bob",
+		amt:   10 * COIN,
+		nonce: 2,
+	})
+	blockchain.AddTxn(Transaction{
+		payer: "clark",
+		payee: "alice",
+		amt:   5 * COIN,
+		nonce: 1,
+	})
+	blockchain.AddTxn(Transaction{
+		payer: "clark",
+		payee: "alice",
+		amt:   5 * COIN,
+		nonce: 3,
+	})
+}
+
+// Run the toy_blockchain command on the flags of os.Args, for the main package of the module
+func Main() {
+	configPath := flag.String("config", "", "read the settings not given as flags or $"+CONFIG_ENV_PREFIX+"... variables from this file, see config.go")
+	showConfig := flag.Bool("show-config", false, "print the settings differing from the defaults as a -config file and exit")
+	dataDir := flag.String("data-dir", "", "directory of the keystore, cold storage, write-ahead log, backups, snapshots, node key and mempool file given as relative paths")
+	difficulty := flag.Int("difficulty", 4, "proof of work difficulty of the demo genesis, when -genesis is not set")
+	powName := flag.String("pow", POW_SHA256, "proof of work of the demo genesis, sha256 or scrypt, which wants a lower -difficulty")
+	httpAddr := flag.String("http", "", "serve the node API on this address after the demo, eg. :8080")
+	genesisPath := flag.String("genesis", "", "JSON genesis spec, defaults to a demo premine")
+	miner := flag.String("miner", "miner", "account collecting the fees of mined blocks")
+	importPath := flag.String("import", "", "load the chain from an export instead of running the demo")
+	exportPath := flag.String("export", "", "export the chain to this file")
+	stateIn := flag.String("state-in", "", "start from the state snapshot in this file instead of genesis, appending the blocks after it from -import or -sync")
+	stateOut := flag.String("state-out", "", "write a snapshot of the state at -state-height of the chain set up by the other flags to this file, and exit")
+	stateHeight := flag.Int("state-height", -1, "with -state-out, height of the snapshot, the last block by default")
+	conformanceDir := flag.String("conformance", "", "run the consensus conformance fixtures in this directory and exit")
+	writeConformance := flag.Bool("write-conformance", false, "regenerate the -conformance fixtures from the current rules")
+	chainTest := flag.Int("chaintest", 0, "check random valid chains validate and corrupted and mutated blocks are refused, for the seeds 1 to this, and exit")
+	testNet := flag.Int("testnet", 0, "run this many in-process nodes through a partition, both sides mining, and its healing, check they converge, and exit")
+	testNetFaults := flag.String("testnet-faults", "", "with -testnet, faults of every link between two nodes, eg. drop=0.2,duplicate=0.1,delay=2,latency=5ms")
+	signingVectors := flag.String("signing-vectors", "", "check the transaction signing test vectors of this file, eg. signed by another client, and exit")
+	writeSigningVectors := flag.Bool("write-signing-vectors", false, "regenerate the -signing-vectors file")
+	coldDir := flag.String("cold-dir", "", "move blocks older than -hot-blocks to compressed files in this directory")
+	hotBlocks := flag.Int("hot-blocks", 1000, "most recent blocks kept in memory when -cold-dir, -store or -s3-endpoint is set")
+	storeEngine := flag.String("store", "", "move blocks older than -hot-blocks to this storage engine, committing each block at once: memory, file, log or bolt, the last three in -cold-dir, see engines.go")
+	walPath := flag.String("wal", "", "write each block to -cold-dir or -s3-endpoint as it is committed, through this write-ahead log, redone on startup")
+	blockCache := flag.Int("block-cache", DefaultCacheSizes().Blocks, "blocks looked up by hash kept in an LRU cache, 0 for none")
+	txnCache := flag.Int("txn-cache", DefaultCacheSizes().Txns, "transactions looked up by hash kept in an LRU cache, 0 for none")
+	balanceCache := flag.Int("balance-cache", DefaultCacheSizes().Balances, "balances at past heights kept in an LRU cache, 0 for none")
+	s3Endpoint := flag.String("s3-endpoint", "", "move old blocks to this S3-compatible endpoint, -cold-dir becoming a local cache; credentials from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	s3Bucket := flag.String("s3-bucket", "toychain", "bucket for -s3-endpoint")
+	s3Region := flag.String("s3-region", "us-east-1", "region for -s3-endpoint")
+	s3Prefix := flag.String("s3-prefix", "", "key prefix for -s3-endpoint")
+	ceremonyDir := flag.String("ceremony-dir", "ceremony", "directory of the genesis ceremony contributions")
+	contribute := flag.String("ceremony-contribute", "", "write the ceremony contribution of this participant and exit")
+	contributeAlloc := flag.String("ceremony-alloc", "", "allocations of the contribution, eg. alice=10,bob=5")
+	contributeKey := flag.String("ceremony-key", "", "hex public key registering the participant as a validator")
+	assemble := flag.String("ceremony-assemble", "", "assemble the contributions on top of -genesis into this genesis file and exit")
+	verifyGenesis := flag.String("verify-genesis", "", "check -genesis has this genesis hash and exit")
+	displayFormat := flag.String("format", "text", "format of the chain dump: text, json or compact")
+	outputMode := flag.String("output", "table", "output of the commands: table, json, csv or quiet, the key column only")
+	fiatPrices := flag.String("fiat-prices", "", "annotate amounts of the chain dump and the explorer with fiat values at these fixed prices of a coin, eg. USD=2.5,EUR=2.3, none if unset")
+	doubleSpend := flag.Bool("double-spend-demo", false, "show how conflicting spends get rejected and exit")
+	channelDemo := flag.Bool("channel-demo", false, "show a payment channel opened, paid over off chain and closed, and exit")
+	swapDemo := flag.Bool("swap-demo", false, "show an atomic swap of coins of two chains with hash time-locked contracts, and exit")
+	stealthDemo := flag.Bool("stealth-demo", false, "show payments to one-time addresses of a stealth address found and spent by their payee alone, and exit")
+	recoverChain := flag.Bool("recover", false, "rebuild the chain of -genesis from the blocks left in -cold-dir or -s3-endpoint instead of running the demo")
+	archive := flag.Bool("archive", false, "keep periodic state snapshots to answer historic queries faster")
+	follow := flag.String("follow", "", "serve -http as a read replica of the node API at this URL instead of running the demo")
+	peer := flag.String("peer", "", "with -recover, fetch the blocks missing or invalid locally from the node API at this URL")
+	doctor := flag.Bool("doctor", false, "check the storage, clock, peers, mempool and configuration of the node set up by the other flags, and exit")
+	paramSim := flag.String("param-sim", "", "simulate the chain set up by the other flags under the alternative consensus parameters of this JSON file, see paramsim.go, print the metrics side by side and exit")
+	stats := flag.Bool("stats", false, "print the height, transactions, block interval, hash rate, mempool depth and difficulty of the chain set up by the other flags, and exit")
+	metrics := flag.Bool("metrics", false, "print the interval, nonce, nonces tried, transactions, size and fees of every block of the chain set up by the other flags, and exit")
+	supply := flag.Bool("supply", false, "print the total supply, next block reward and next halving of the chain set up by the other flags, and exit")
+	relayPeers := flag.String("relay-peers", "", "with -http, comma separated node API URLs to relay transactions to")
+	peers := flag.String("peers", "", "print the peers of the node API at this URL with their status, and exit")
+	addPeer := flag.String("add-peer", "", "with -peers and -peers-admin, first make the node relay to this node API URL")
+	removePeer := flag.String("remove-peer", "", "with -peers and -peers-admin, first make the node stop relaying to this node API URL")
+	peersAdmin := flag.String("peers-admin", "", "with -add-peer or -remove-peer, admin API URL of the node, eg. http://localhost:8090, the requests bearing -admin-token")
+	dandelion := flag.Bool("dandelion", false, "with -relay-peers, hide the origin of transactions with a Dandelion stem phase")
+	blockRelay := flag.String("block-relay", BLOCK_RELAY_COMPACT, "with -relay-peers, push the committed blocks to the peers compact, full or off")
+	webhookURLs := flag.String("webhooks", "", "with -http, comma separated URLs to POST every committed block to as JSON")
+	webhookSecret := flag.String("webhook-secret", "", "with -webhooks, sign the posted blocks with HMAC-SHA256 under this secret")
+	webhookPrivate := flag.Bool("webhook-allow-private", false, "with -http, let webhooks target loopback, link-local and private addresses, eg. a receiver on this machine")
+	eventSinks := flag.String("event-sinks", "", "with -http, comma separated nats:// or kafka:// URLs to publish the chain events to, eg. kafka://localhost:9092/toychain")
+	sinkEvents := flag.String("sink-events", "", "with -event-sinks, comma separated events to publish among block, txn, reverted-block, reverted-txn, txn-status and alert, all of them if empty")
+	p2pAddr := flag.String("p2p", "", "with -http, also serve the node API to peers on this address over Noise encrypted connections, and only take relayed transactions there")
+	nodeKey := flag.String("node-key", "", "with -http, file of the node identity key, created if missing, which the node greets its peers with and serves -p2p as; node.key in -data-dir by default, a new key on each start without -data-dir")
+	p2pAllow := flag.String("p2p-allow", "", "with -p2p, comma separated hex keys of the only peers accepted")
+	relaySim := flag.Bool("relay-sim", false, "simulate how often a spy finds the origin of transactions, with and without -dandelion, and exit")
+	blockRelaySim := flag.Bool("block-relay-sim", false, "relay blocks compact and full around a ring of in-process nodes holding less and less of their transactions, print the bytes sent and exit")
+	compareSchemes := flag.Int("compare-schemes", 0, "sign and verify this many digests with each signature scheme, print their sizes and speeds and exit")
+	schnorrDemo := flag.Bool("schnorr-demo", false, "sign a swap with Schnorr keys, aggregate the signatures, print their sizes and exit")
+	schnorrParties := flag.Int("schnorr-parties", SCHNORR_DEMO_PARTIES, "with -schnorr-demo, parties of the swap")
+	retargetSim := flag.Bool("retarget-sim", false, "simulate how the window average and LWMA difficulty retargets hold the block interval as the hash rate changes, and exit")
+	selfishSim := flag.Bool("selfish-sim", false, "simulate the orphan rate and revenue of an honest and a selfish mining pool, with and without network latency, and exit")
+	poolSim := flag.Bool("pool-sim", false, "simulate a mining pool splitting the nonces among its workers, counting their shares and paying the rewards in proportion, and exit")
+	poolWorkers := flag.String("pool-workers", "", "with -pool-sim, hash powers of the workers, eg. 1,2,5")
+	shardSim := flag.Bool("shard-sim", false, "simulate the same transfers on 1 to "+fmt.Sprint(SHARD_SIM_MAX)+" shard chains crosslinked by a coordinator chain, with receipts for cross-shard transfers, and exit")
+	attackSim := flag.Bool("attack-sim", false, "simulate double spends by attackers of growing hash power against merchants waiting for 1, 3 and 6 confirmations, and exit")
+	bftSim := flag.Int("bft-sim", 0, "commit blocks with BFT committees of this many validators, honest, offline and equivocating, compare their finality with proof of work's, and exit")
+	keystoreDir := flag.String("keystore", "keystore", "directory of the encrypted key files")
+	newAccount := flag.String("new-account", "", "create this account in -keystore, passphrase from $TOYCHAIN_PASSPHRASE or stdin, and exit")
+	scheme := flag.String("scheme", "ecdsa", "with -new-account, signature scheme of the account, ecdsa, ed25519 or schnorr")
+	listAccounts := flag.Bool("accounts", false, "list the accounts of -keystore and exit")
+	pruneBelow := flag.Int("prune", 0, "drop the bodies of the blocks below this height, signing the receipt with the -prune-key account of -keystore")
+	pruneKey := flag.String("prune-key", "", "with -prune or -prune-keep, -keystore account signing the pruning receipts")
+	pruneKeep := flag.Int("prune-keep", 0, "run as a pruned node keeping the bodies of this many last blocks, at least the reorg depth, pruning older ones as blocks are committed")
+	pruneReceipt := flag.String("prune-receipt", "", "with -prune, write the receipt to this file")
+	verifyReceipt := flag.String("verify-prune-receipt", "", "check a pruning receipt against the chain set up by the other flags and exit")
+	coins := flag.String("coins", "", "list the unspent outputs of this -keystore account on the chain set up by the other flags, with their labels, and exit")
+	freeze := flag.String("freeze", "", "with -coins, comma separated outputs never to spend until thawed")
+	thaw := flag.String("thaw", "", "with -coins, comma separated outputs to spend again")
+	label := flag.String("label", "", "with -coins, label an output, eg. <txn hash>:0=savings, an empty label removing it")
+	payUTXO := flag.String("pay-utxo", "", "with -coins, print a payment to this UTXO owner signed with the -keystore key, eg. bob=5 or @bob=5, instead of listing the outputs")
+	inputs := flag.String("inputs", "", "with -pay-utxo, comma separated outputs to spend instead of the largest ones not frozen")
+	nonce := flag.Int("nonce", -1, "with -pay-utxo, nonce slot of the payment instead of the next free one, eg. to replace a pending transaction")
+	signerURL := flag.String("signer", "", "with -pay-utxo, sign with the signer process at this URL instead of the -keystore key")
+	serveSigner := flag.String("serve-signer", "", "serve the key of -signer-account on this address to remote wallets, eg. :7000, passphrase from $TOYCHAIN_PASSPHRASE or stdin")
+	signerAccount := flag.String("signer-account", "", "with -serve-signer, -keystore account whose key signs")
+	signerToken := flag.String("signer-token", "", "with -serve-signer, bearer token the requests must carry; with -signer, token sent")
+	signerChain := flag.String("signer-chain", "", "with -serve-signer, only sign transactions bound to this chain ID")
+	signerConfirm := flag.Bool("signer-confirm", false, "with -serve-signer, ask on the terminal before signing each transaction")
+	inbox := flag.String("inbox", "", "decrypt the messages to this -keystore account on the chain set up by the other flags, print them and exit")
+	history := flag.String("history", "", "print the transactions sending to or from this account on the chain set up by the other flags, and exit")
+	receipt := flag.String("receipt", "", "print the receipt of the transaction with this hash on the chain set up by the other flags, and exit")
+	shell := flag.Bool("shell", false, "run the commands typed in an interactive shell, like send alice bob 10, mine, balance alice or block 3, on the chain set up by the other flags, serving it meanwhile with -http")
+	shellNode := flag.String("shell-node", "", "run the commands of -shell on the node API at this URL")
+	top := flag.Bool("top", false, "with -http, show a live dashboard of the chain served, its mempool, latest blocks and mining progress")
+	topNode := flag.String("top-node", "", "show the dashboard of -top for the node API at this URL")
+	topInterval := flag.Duration("top-interval", TOP_INTERVAL, "with -top or -top-node, time between two redraws")
+	sendMessage := flag.String("send-message", "", "with -inbox, print a message from the -inbox account encrypted to the key of a recipient on chain, eg. bob=hello, instead of reading the messages")
+	poll := flag.String("poll", "", "print the tally of this poll on the chain set up by the other flags, whose genesis enables the "+APP_VOTING+" app, and exit")
+	vote := flag.String("vote", "", "with -poll, print the ballot of a registered voter, eg. alice=yes, instead of the tally")
+	diffChains := flag.String("diff", "", "compare two chains given as A,B, each a node API URL or an export file: common ancestor, divergence, differing blocks and state, exiting with 1 if they differ")
+	estimateFee := flag.Int("estimate-fee", 0, "print the fee likely to get a transaction into this many next blocks of the chain set up by the other flags, and exit")
+	resolve := flag.String("resolve", "", "print the owner and address of this name on the chain set up by the other flags, and exit")
+	tokens := flag.Bool("tokens", false, "print the tokens of the chain set up by the other flags and exit")
+	token := flag.String("token", "", "print this token of the chain set up by the other flags and the accounts holding it, and exit")
+	newMnemonic := flag.Bool("new-mnemonic", false, "print a new 12 words mnemonic seed phrase and exit")
+	derive := flag.String("derive", "", "print the addresses of the children of this derivation path, eg. "+HD_DEFAULT_PATH+", for the mnemonic in $TOYCHAIN_MNEMONIC or stdin, with the address prefix of -genesis, and exit")
+	deriveCount := flag.Int("derive-count", 5, "with -derive, number of addresses printed")
+	mine := flag.Bool("mine", false, "with -http, mine pending transactions in the background")
+	mineTxns := flag.Int("mine-txns", MINER_MIN_TXNS, "with -mine, pending transactions mined right away")
+	mineWait := flag.Duration("mine-wait", MINER_MAX_WAIT, "with -mine, longest wait before mining fewer than -mine-txns")
+	mineInterval := flag.Duration("mine-interval", 0, "with -mine, cut a block every interval instead, empty when nothing is pending")
+	mempoolTxns := flag.Int("mempool-txns", 0, "most transactions the mempool holds, evicting the lowest fees first, 0 for no cap")
+	mempoolBytes := flag.Int("mempool-bytes", 0, "most bytes of transactions the mempool holds, evicting the lowest fees first, 0 for no cap")
+	mempoolTTL := flag.Duration("mempool-ttl", 0, "drop transactions waiting in the mempool for longer than this, 0 to keep them")
+	mempoolTTLBlocks := flag.Int("mempool-ttl-blocks", 0, "drop transactions waiting in the mempool for this many blocks, 0 to keep them")
+	mempoolMinFee := flag.String("mempool-min-fee", "0", "refuse transactions paying less than this fee, in coins")
+	rateIP := flag.Float64("rate-ip", 0, "with -http, transactions a second each client IP may submit, 0 for no limit")
+	rateIPBurst := flag.Int("rate-ip-burst", 0, "transactions a client IP may submit at once under -rate-ip, 0 for the rate rounded up")
+	rateAccount := flag.Float64("rate-account", 0, "with -http, transactions a second submitted for each paying account, 0 for no limit")
+	rateAccountBurst := flag.Int("rate-account-burst", 0, "transactions submitted at once for an account under -rate-account, 0 for the rate rounded up")
+	mempoolFile := flag.String("mempool-file", "", "with -http, save the mempool to this file on SIGINT or SIGTERM and submit its transactions again on the next start")
+	snapshots := flag.String("snapshots", "", "with -http, append mempool and fee snapshots to this JSON lines file")
+	snapshotInterval := flag.Duration("snapshot-interval", SNAPSHOT_INTERVAL, "with -snapshots, time between two snapshots")
+	showSnapshots := flag.Bool("show-snapshots", false, "print the latest snapshots of the -snapshots file and exit")
+	dev := flag.Bool("dev", false, "with -http, run a devnet sealing each transaction at once without proof of work, funding account "+DEV_ACCOUNT+" unless -genesis is set, and accept POST /dev/difficulty and /dev/automine of the operator")
+	autoMine := flag.Bool("automine", true, "with -dev, seal each admitted transaction in a block before answering its submission")
+	syncPeers := flag.String("sync", "", "comma separated node API URLs to download the chain from, after -import or from -genesis instead of running the demo")
+	light := flag.String("light", "", "sync the headers of the node API at this URL as a light client of -genesis and exit")
+	checkpointList := flag.String("checkpoints", "", "comma separated trusted HEIGHT:HASH checkpoints, the proof of work of the blocks up to them is not checked when importing or syncing")
+	lightTxn := flag.String("light-txn", "", "with -light, verify this transaction hash is in the chain with a Merkle proof")
+	lightAccount := flag.String("light-account", "", "with -light, list the blocks involving this account, downloading only those its address bloom may hold")
+	deterministic := flag.Bool("deterministic", false, "date the blocks of the demo one second apart from the genesis time instead of the system time, so every run gives the same hashes")
+	builder := flag.String("builder", BUILDER_FEE, "order the miner packs pending transactions in: fee, fifo or random")
+	builderSeed := flag.Uint64("builder-seed", 0, "with -builder random, seed of the order, 0 for the time")
+	policyPath := flag.String("policy", "", "JSON list of rules, as in a genesis spec, this node refuses transactions failing at admission while accepting blocks carrying them")
+	nonceSeed := flag.Uint64("nonce-seed", 0, "start the nonce search of new blocks at a point drawn from this seed and the block, 0 starting at nonce 0")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "send OpenTelemetry traces of the transactions and blocks to this OTLP/HTTP collector, eg. http://localhost:4318 for Jaeger")
+	hashLimit := flag.Float64("hash-limit", 0, "try at most this many nonces per second when mining, eg. to give nodes on one machine set shares of the hash power, 0 for no limit")
+	fixtureChain := flag.Bool("fixture-chain", false, "load the embedded fixture chain instead of running the demo")
+	writeFixture := flag.Bool("write-fixture-chain", false, "regenerate "+FIXTURE_CHAIN_FILE+" from the current rules and exit")
+	backupDir := flag.String("backup-dir", "", "back the chain up to compressed files in this directory, every -backup-interval with -http, once otherwise")
+	backupInterval := flag.Duration("backup-interval", BACKUP_INTERVAL, "with -backup-dir and -http, time between two backups")
+	backupKeep := flag.Int("backup-keep", DefaultBackupPolicy().Keep, "with -backup-dir, most restore points kept, older backups being merged, 0 for no limit")
+	backupMaxAge := flag.Duration("backup-max-age", 0, "with -backup-dir, merge restore points older than this, 0 for no limit")
+	restoreBackup := flag.Bool("restore-backup", false, "rebuild the chain from the backups in -backup-dir instead of running the demo")
+	restoreHeight := flag.Int("restore-height", 0, "with -restore-backup, restore point to rebuild up to, 0 for the latest")
+	showBackups := flag.Bool("show-backups", false, "print the restore points of the backups in -backup-dir and exit")
+	adminAddr := flag.String("admin", "", "with -http, serve the admin API controlling the node at runtime on this address, eg. localhost:8090, see admin.go")
+	adminToken := flag.String("admin-token", "", "with -admin, bearer token the admin requests must carry, POST /blocks and POST /sim/params of the node API too, better set in $TOYCHAIN_ADMIN_TOKEN; with -shell-node or -peers-admin, token to send")
+	stateSnapshots := flag.String("state-snapshots", "state-snapshots", "with -admin, directory the state snapshots taken through the admin API are written to")
+	logLevelFlag := flag.String("log-level", LOG_INFO, "debug also logs every request of the node API, quiet logs nothing; info otherwise")
+	flag.Parse()
+	// The flags of the verify command may follow it, see verify.go
+	verifyChain := flag.Arg(0) == "verify"
+	if verifyChain {
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() > 0 {
+			log.Fatalf("verify: unexpected argument %q", flag.Arg(0))
+		}
+	}
+	if err := loadConfig(flag.CommandLine, *configPath); err != nil {
+		log.Fatal(err)
+	}
+	if *showConfig {
+		if err := writeConfig(os.Stdout, flag.CommandLine); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	resolveDataDir(flag.CommandLine, *dataDir)
+	if *nodeKey == "" && *dataDir != "" {
+		*nodeKey = filepath.Join(*dataDir, "node.key")
+	}
+	if err := SetLogLevel(*logLevelFlag); err != nil {
+		log.Fatal(err)
+	}
+	format, err := ParseDisplayFormat(*displayFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mode, err := ParseOutputMode(*outputMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := NewOutput(mode, os.Stdout)
+	pow, err := NewPowSpec(*powName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *conformanceDir != "" {
+		os.Exit(runConformance(*conformanceDir, *writeConformance, out))
+	}
+	if *chainTest > 0 {
+		os.Exit(runChainTest(*chainTest, out))
+	}
+	if *testNet > 0 {
+		faults, err := ParseLinkFaults(*testNetFaults)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(runTestNet(*testNet, faults, out))
+	}
+	if *diffChains != "" {
+		os.Exit(runDiff(*diffChains, out))
+	}
+	if *signingVectors != "" {
+		os.Exit(runSigningVectors(*signingVectors, *writeSigningVectors, out))
+	}
+	if *showSnapshots {
+		os.Exit(runSnapshots(*snapshots, out))
+	}
+	if *doubleSpend {
+		if err := printDoubleSpendDemo(out, RunDoubleSpendDemo()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *channelDemo {
+		steps, err := RunChannelDemo()
+		if err == nil {
+			err = printChannelDemo(out, steps)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *swapDemo {
+		steps, err := RunSwapDemo()
+		if err == nil {
+			err = printSwapDemo(out, steps)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *stealthDemo {
+		steps, err := RunStealthDemo()
+		if err == nil {
+			err = printStealthDemo(out, steps)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *peers != "" {
+		os.Exit(runPeers(*peers, *peersAdmin, *adminToken, *addPeer, *removePeer, out))
+	}
+	if *shellNode != "" {
+		client := newPeerClient(*shellNode)
+		client.token = *adminToken
+		os.Exit(runShell(client, os.Stdin, out))
+	}
+	if *topNode != "" {
+		os.Exit(runTop(newPeerClient(*topNode), nil, *topInterval))
+	}
+	if *relaySim {
+		if err := printRelaySim(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *blockRelaySim {
+		if err := printBlockRelaySim(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *retargetSim {
+		if err := printRetargetSim(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *selfishSim {
+		if err := printSelfishSim(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *poolSim {
+		if err := printPoolSim(*poolWorkers, out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *shardSim {
+		if err := printShardSim(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *attackSim {
+		if err := printAttackSim(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *bftSim > 0 {
+		if err := printBFTSim(*bftSim, out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *compareSchemes > 0 {
+		os.Exit(runCompareSchemes(*compareSchemes, out))
+	}
+	if *schnorrDemo {
+		os.Exit(runSchnorrDemo(*schnorrParties, out))
+	}
+	if flag.Arg(0) == "wallet" {
+		os.Exit(runWallet(flag.Args()[1:], *keystoreDir, out))
+	}
+	if *newAccount != "" || *listAccounts {
+		accountScheme, err := ParseSigScheme(*scheme)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(runKeystore(*keystoreDir, *newAccount, accountScheme, out))
+	}
+	if *serveSigner != "" {
+		log.Fatal(runSignerServer(*serveSigner, *keystoreDir, *signerAccount, *signerToken, *signerChain, *signerConfirm))
+	}
+	if *newMnemonic || *derive != "" {
+		prefix := ADDRESS_PREFIX
+		if *genesisPath != "" {
+			g, err := LoadGenesis(*genesisPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if g.AddressPrefix != "" {
+				prefix = g.AddressPrefix
+			}
+		}
+		os.Exit(runHDWallet(*newMnemonic, *derive, *deriveCount, prefix, out))
+	}
+	if *writeFixture {
+		if err := writeFixtureChain(FIXTURE_CHAIN_FILE); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *dev && *httpAddr == "" {
+		log.Fatal("-dev needs -http")
+	}
+	if *top && *httpAddr == "" {
+		log.Fatal("-top needs -http")
+	}
+	if *top && *shell {
+		log.Fatal("-top and -shell both take the terminal, run one with -top-node or -shell-node")
+	}
+	// Nodes keep their identity across restarts, see handshake.go
+	if *httpAddr != "" && *nodeKey != "" {
+		id, err := LoadNodeIdentity(*nodeKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		SetNodeIdentity(id)
+	}
+	// Serve node on -p2p alongside -http
+	serveP2P := func(node *Node) {}
+	if *p2pAddr != "" {
+		if *httpAddr == "" {
+			log.Fatal("-p2p needs -http")
+		}
+		id, err := nodeIdentity()
+		if err != nil {
+			log.Fatal(err)
+		}
+		var allowed [][]byte
+		for _, k := range strings.Split(*p2pAllow, ",") {
+			if k == "" {
+				continue
+			}
+			key, err := hex.DecodeString(k)
+			if err != nil || len(key) != 32 {
+				log.Fatalf("-p2p-allow: %q is not a 32 bytes hex key", k)
+			}
+			allowed = append(allowed, key)
+		}
+		serveP2P = func(node *Node) {
+			log.Printf("serving peers on %v as noise://%v@%v", *p2pAddr, id, *p2pAddr)
+			go func() { log.Fatal(ListenAndServeNoise(*p2pAddr, NewServer(node), id, allowed)) }()
+		}
+	}
+	if *follow != "" {
+		if *httpAddr == "" {
+			log.Fatal("-follow needs -http")
+		}
+		blockchain, err := replicaChain(*follow)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := blockchain.SetArchive(*archive); err != nil {
+			log.Fatal(err)
+		}
+		SetNodeChain(blockchain.GenesisHash())
+		node := NewNode(&blockchain)
+		if err := node.Follow(*follow); err != nil {
+			log.Fatal(err)
+		}
+		serveP2P(node)
+		log.Printf("serving read replica of %v on %v", *follow, *httpAddr)
+		log.Fatal(ListenAndServe(*httpAddr, NewServer(node)))
+	}
+	if *contribute != "" {
+		if err := WriteContribution(*ceremonyDir, *contribute, *contributeAlloc, *contributeKey); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *assemble != "" || *verifyGenesis != "" {
+		base := DefaultGenesis(*difficulty)
+		base.Pow = pow
+		if *genesisPath != "" {
+			var err error
+			if base, err = LoadGenesis(*genesisPath); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *assemble != "" {
+			hash, err := runCeremony(base, *ceremonyDir, *assemble)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("wrote %v, genesis hash %v\n", *assemble, hash)
+		} else if err := VerifyGenesis(base, *verifyGenesis); err != nil {
+			log.Fatal(err)
+		} else {
+			fmt.Println("genesis hash matches")
+		}
+		return
+	}
+
+	// Stores opened from here on are closed on return, and by exit and fatal unlike os.Exit and log.Fatal
+	defer closeAll()
+	var cold ObjectStore
+	if *storeEngine != "" {
+		store, err := OpenStore(*storeEngine, *coldDir)
+		if err != nil {
+			fatal(err)
+		}
+		closeAtExit(store)
+		cold = store
+	} else if *coldDir != "" {
+		dir, err := NewDirObjectStore(*coldDir)
+		if err != nil {
+			fatal(err)
+		}
+		cold = dir
+	}
+	if *s3Endpoint != "" {
+		cold = NewS3ObjectStore(S3Config{
+			Endpoint:  *s3Endpoint,
+			Region:    *s3Region,
+			Bucket:    *s3Bucket,
+			Prefix:    *s3Prefix,
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		}, cold)
+	}
+	if *walPath != "" {
+		if cold == nil {
+			fatal("-wal needs -cold-dir, -store or -s3-endpoint")
+		}
+		logged, redone, err := OpenLoggedObjectStore(cold, *walPath)
+		if err != nil {
+			fatal(err)
+		}
+		if redone > 0 {
+			log.Printf("redid %v writes of a commit interrupted by a crash", redone)
+		}
+		closeAtExit(logged)
+		cold = logged
+	}
+
+	genesis := DefaultGenesis(*difficulty)
+	genesis.Alloc = map[string]Amount{"alice": 100 * COIN, "bob": 50 * COIN, "clark": 50 * COIN}
+	genesis.Pow = pow
+	if *dev && *genesisPath == "" {
+		genesis = DevGenesis()
+	}
+	if *genesisPath != "" {
+		if genesis, err = LoadGenesis(*genesisPath); err != nil {
+			fatal(err)
+		}
+	}
+	var trusted []Checkpoint
+	if *checkpointList != "" {
+		if trusted, err = ParseCheckpoints(*checkpointList); err != nil {
+			fatal(err)
+		}
+	}
+	if *light != "" {
+		exit(runLightClient(genesis, *light, *lightTxn, *lightAccount, trusted, out))
+	}
+	if verifyChain {
+		if cold == nil {
+			fatal("verify needs -cold-dir, -store or -s3-endpoint")
+		}
+		exit(runVerifyChain(genesis, cold, trusted, out))
+	}
+	var backups ObjectStore
+	policy := BackupPolicy{Interval: *backupInterval, Keep: *backupKeep, MaxAge: *backupMaxAge}
+	if *backupDir != "" {
+		if backups, err = NewDirObjectStore(*backupDir); err != nil {
+			fatal(err)
+		}
+	}
+	if *showBackups {
+		if backups == nil {
+			fatal("-show-backups needs -backup-dir")
+		}
+		exit(runBackups(backups, out))
+	}
+	var blockchain BlockChain
+	demo := false
+	switch {
+	case *recoverChain:
+		var report RecoveryReport
+		if blockchain, report, err = RecoverChain(genesis, cold, *hotBlocks, *peer); err != nil {
+			fatal(err)
+		}
+		log.Printf("recovered %v blocks from storage and %v from peer %v, stopped at: %v",
+			report.FromStore, len(report.FromPeer), report.FromPeer, report.Stop)
+		log.Printf("state root %v", report.StateRoot)
+		blockchain.SetMiner(*miner)
+	case *stateIn != "":
+		if blockchain, err = BootstrapChainFile(*stateIn, trusted...); err != nil {
+			fatal(err)
+		}
+		log.Printf("bootstrapped at height %v, state root %v", blockchain.blocks.Len()-1, blockchain.state.Root())
+		if *importPath != "" {
+			f, err := os.Open(*importPath)
+			if err != nil {
+				fatal(err)
+			}
+			err = blockchain.ImportAfter(f)
+			f.Close()
+			if err != nil {
+				fatal(err)
+			}
+		}
+		blockchain.SetMiner(*miner)
+	case *importPath != "":
+		if blockchain, err = ImportFile(*importPath, trusted...); err != nil {
+			fatal(err)
+		}
+	case *restoreBackup:
+		if backups == nil {
+			fatal("-restore-backup needs -backup-dir")
+		}
+		if blockchain, err = RestoreBackup(backups, *restoreHeight); err != nil {
+			fatal(err)
+		}
+		log.Printf("restored %v blocks, state root %v", blockchain.blocks.Len()-1, blockchain.state.Root())
+		blockchain.SetMiner(*miner)
+	case *fixtureChain:
+		if blockchain, err = LoadFixtureChain(); err != nil {
+			fatal(err)
+		}
+	case *syncPeers != "", *dev:
+		blockchain = CreateBlockChain(genesis)
+		blockchain.SetMiner(*miner)
+	default:
+		blockchain = CreateBlockChain(genesis)
+		blockchain.SetMiner(*miner)
+		demo = true
+	}
+	if *nonceSeed != 0 {
+		blockchain.SetNonceStrategy(SeededNonces(*nonceSeed))
+	}
+	if *builder != BUILDER_FEE {
+		b, err := NewBlockBuilder(*builder, *builderSeed)
+		if err != nil {
+			fatal(err)
+		}
+		blockchain.SetBlockBuilder(b)
+	}
+	if *policyPath != "" {
+		rules, err := LoadPolicy(*policyPath)
+		if err != nil {
+			fatal(err)
+		}
+		for _, rule := range rules {
+			blockchain.AddPolicy(rule.Validator())
+		}
+	}
+	if err := blockchain.SetHashLimit(*hashLimit); err != nil {
+		fatal(err)
+	}
+	if *otlpEndpoint != "" {
+		tracer, err := NewTracer(*otlpEndpoint)
+		if err != nil {
+			fatal(err)
+		}
+		blockchain.SetTracer(tracer)
+	}
+	if err := blockchain.SetCheckpoints(trusted); err != nil {
+		fatal(err)
+	}
+	minFee, err := ParseAmount(*mempoolMinFee)
+	if err != nil {
+		fatalf("-mempool-min-fee: %v", err)
+	}
+	limits := MempoolLimits{Txns: *mempoolTxns, Bytes: *mempoolBytes, TTL: *mempoolTTL, TTLBlocks: *mempoolTTLBlocks, MinFee: minFee}
+	if err := blockchain.SetMempoolLimits(limits); err != nil {
+		fatal(err)
+	}
+	if demo {
+		if *deterministic {
+			blockchain.SetClock(NewStepClock(time.UnixMicro(genesis.UnixTs).Add(time.Second), time.Second))
+		}
+		simulateTxns(&blockchain)
+		// Commit outstanding transactions if the last block is not full
+		if err := blockchain.CommitBlock(); err != nil && !errors.Is(err, ErrEmptyMempool) {
+			fatal(err)
+		}
+	}
+	if cold != nil && !*recoverChain {
+		if err := blockchain.SetColdStorage(cold, *hotBlocks); err != nil {
+			fatal(err)
+		}
+	}
+	blockchain.SetCacheSizes(CacheSizes{Blocks: *blockCache, Txns: *txnCache, Balances: *balanceCache})
+	if *archive {
+		if err := blockchain.SetArchive(true); err != nil {
+			fatal(err)
+		}
+	}
+	if *syncPeers != "" {
+		report, err := blockchain.Sync(strings.Split(*syncPeers, ","))
+		log.Printf("synced %v blocks from %v, peer heights %v, %v blocks reverted", report.Blocks, report.Peers, report.Heights, report.Reverted)
+		if err != nil {
+			fatal(err)
+		}
+	}
+	if *verifyReceipt != "" {
+		exit(runVerifyPruneReceipt(&blockchain, *verifyReceipt, out))
+	}
+	if *pruneBelow > 0 {
+		if code := runPrune(&blockchain, *pruneBelow, *keystoreDir, *pruneKey, *pruneReceipt, out); code != 0 {
+			exit(code)
+		}
+	}
+	var pruner *Wallet
+	if *pruneKeep > 0 {
+		if *archive {
+			fatal("-archive keeps every block body, it cannot be combined with -prune-keep")
+		}
+		if pruner, err = unlockPruneKey(*keystoreDir, *pruneKey); err != nil {
+			fatal(err)
+		}
+	}
+	if pruner != nil && *httpAddr == "" {
+		r, ok, err := blockchain.pruneKeeping(*pruneKeep, 1, pruner)
+		if err != nil {
+			fatal(err)
+		}
+		if ok {
+			log.Printf("pruned %v blocks, heights %v to %v", len(r.Blocks), r.Blocks[0].Height, r.Blocks[len(r.Blocks)-1].Height)
+		}
+	}
+	if *doctor {
+		var peers []string
+		for _, list := range []string{*relayPeers, *syncPeers, *peer, *follow} {
+			if list != "" {
+				peers = append(peers, strings.Split(list, ",")...)
+			}
+		}
+		exit(printDoctorReport(out, Diagnose(&blockchain, DoctorConfig{Peers: peers, Dev: *dev})))
+	}
+	if *stats {
+		exit(printStats(out, blockchain.Stats()))
+	}
+	if *metrics {
+		exit(runMetrics(&blockchain, out))
+	}
+	if *supply {
+		exit(runSupply(&blockchain, out))
+	}
+	if *stateOut != "" {
+		exit(runSnapshotState(&blockchain, *stateHeight, *stateOut, out))
+	}
+	if *paramSim != "" {
+		exit(runParamSim(&blockchain, *paramSim, out))
+	}
+	if *coins != "" {
+		cmd := coinsCommand{freeze: splitList(*freeze), thaw: splitList(*thaw), labels: map[string]string{}, inputs: splitList(*inputs), nonce: *nonce, signer: *signerURL, signerToken: *signerToken}
+		if *label != "" {
+			id, text, ok := strings.Cut(*label, "=")
+			if !ok {
+				fatalf("-label: %q is not output=label", *label)
+			}
+			cmd.labels[id] = text
+		}
+		if *payUTXO != "" {
+			to, amt, ok := strings.Cut(*payUTXO, "=")
+			if cmd.amt, err = ParseAmount(amt); !ok || err != nil {
+				fatalf("-pay-utxo: %q is not owner=amount", *payUTXO)
+			}
+			cmd.payTo = to
+		}
+		exit(runCoins(&blockchain, *keystoreDir, *coins, cmd, out))
+	}
+	if *inbox != "" {
+		to, text, ok := strings.Cut(*sendMessage, "=")
+		if *sendMessage != "" && !ok {
+			fatalf("-send-message: %q is not recipient=text", *sendMessage)
+		}
+		exit(runInbox(&blockchain, *keystoreDir, *inbox, to, text, out))
+	}
+	if *poll != "" {
+		voter, choice, ok := strings.Cut(*vote, "=")
+		if *vote != "" && !ok {
+			fatalf("-vote: %q is not voter=choice", *vote)
+		}
+		exit(runPoll(&blockchain, *poll, voter, choice, out))
+	}
+	if *estimateFee > 0 {
+		exit(runEstimateFee(&blockchain, *estimateFee, out))
+	}
+	if *resolve != "" {
+		exit(runResolve(&blockchain, *resolve, out))
+	}
+	if *tokens || *token != "" {
+		exit(runTokens(&blockchain, *token, out))
+	}
+	if *history != "" {
+		exit(runHistory(&blockchain, *history, out))
+	}
+	if *receipt != "" {
+		exit(runReceipt(&blockchain, *receipt, out))
+	}
+	if *shell && *httpAddr == "" {
+		exit(runShell(newLocalClient(NewNode(&blockchain)), os.Stdin, out))
+	}
+	if *fiatPrices != "" {
+		prices, currencies, err := ParseFixedPrices(*fiatPrices)
+		if err != nil {
+			fatalf("-fiat-prices: %v", err)
+		}
+		blockchain.SetPriceOracle(NewPriceOracle(prices, currencies...))
+	}
+	if err := blockchain.PrettyDisplay(os.Stdout, format); err != nil {
+		fatal(err)
+	}
+
+	if *exportPath != "" {
+		if err := ExportFile(blockchain, *exportPath); err != nil {
+			fatal(err)
+		}
+	}
+	if backups != nil && *httpAddr == "" {
+		point, ok, err := blockchain.Backup(backups, policy)
+		if err != nil {
+			fatal(err)
+		}
+		if ok {
+			log.Printf("backed up blocks %v to %v, state root %v", point.From, point.To, point.StateRoot)
+		}
+	}
+	if *httpAddr != "" {
+		if *mempoolFile != "" {
+			restored, dropped, err := blockchain.RestoreMempool(*mempoolFile)
+			if err != nil {
+				fatal(err)
+			}
+			if restored+dropped > 0 {
+				log.Printf("restored %v transactions from %v, dropped %v", restored, *mempoolFile, dropped)
+			}
+		}
+		SetNodeChain(blockchain.GenesisHash())
+		node := NewNode(&blockchain)
+		node.SetDev(*dev)
+		if err := node.SetRateLimits(RateLimits{IP: *rateIP, IPBurst: *rateIPBurst, Account: *rateAccount, AccountBurst: *rateAccountBurst}); err != nil {
+			fatal(err)
+		}
+		if *relayPeers != "" {
+			switch *blockRelay {
+			case BLOCK_RELAY_COMPACT, BLOCK_RELAY_FULL, BLOCK_RELAY_OFF:
+			default:
+				fatalf("-block-relay %q: expected compact, full or off", *blockRelay)
+			}
+			node.SetRelay(RelayConfig{Peers: strings.Split(*relayPeers, ","), Dandelion: *dandelion, RequireNoise: *p2pAddr != "", Blocks: *blockRelay})
+		}
+		node.SetAdminToken(*adminToken)
+		node.SetPrivateWebhooks(*webhookPrivate)
+		for _, target := range splitList(*webhookURLs) {
+			if err := node.AddWebhook(target, *webhookSecret); err != nil {
+				fatal(err)
+			}
+		}
+		for _, target := range splitList(*eventSinks) {
+			if err := node.AddEventSink(target, eventTypes(*sinkEvents)); err != nil {
+				fatal(err)
+			}
+		}
+		if *dev {
+			traceNode(node)
+			if err := node.SetAutoMine(*autoMine); err != nil {
+				fatal(err)
+			}
+		}
+		var miner *Miner
+		if *mine {
+			miner = NewMiner(node, *mineTxns, *mineWait)
+			if *mineInterval > 0 {
+				miner = NewScheduledMiner(node, *mineInterval)
+			}
+			if err := miner.Start(); err != nil {
+				fatal(err)
+			}
+		}
+		if *adminAddr != "" && miner == nil {
+			// Idle until started through the admin API
+			miner = NewMiner(node, *mineTxns, *mineWait)
+		}
+		if *snapshots != "" {
+			if err := node.RecordSnapshots(*snapshots, *snapshotInterval); err != nil {
+				fatal(err)
+			}
+		}
+		if backups != nil {
+			if err := node.StartBackups(backups, policy); err != nil {
+				fatal(err)
+			}
+		}
+		if pruner != nil {
+			if err := node.StartPruning(*pruneKeep, pruner); err != nil {
+				fatal(err)
+			}
+		}
+		serveP2P(node)
+		if *adminAddr != "" {
+			admin, err := NewAdminServer(node, miner, *adminToken, *stateSnapshots)
+			if err != nil {
+				fatal(err)
+			}
+			log.Printf("serving admin API on %v", *adminAddr)
+			go func() { fatal(admin.ListenAndServe(*adminAddr)) }()
+		}
+		log.Printf("serving node API on %v", *httpAddr)
+		if *shell {
+			go func() { fatal(ListenAndServe(*httpAddr, NewServer(node))) }()
+			code := runShell(newLocalClient(node), os.Stdin, out)
+			if err := stopNode(miner, node, *mempoolFile); err != nil {
+				fatal(err)
+			}
+			exit(code)
+		}
+		if *top {
+			go func() { fatal(ListenAndServe(*httpAddr, NewServer(node))) }()
+			code := runTop(newLocalClient(node), node, *topInterval)
+			if err := stopNode(miner, node, *mempoolFile); err != nil {
+				fatal(err)
+			}
+			exit(code)
+		}
+		if err := serveUntilSignal(*httpAddr, miner, node, *mempoolFile); err != nil {
+			fatal(err)
+		}
+	}
+}
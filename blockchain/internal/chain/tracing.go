@@ -0,0 +1,470 @@
+/*
+ * OpenTelemetry tracing.
+ * With -otlp-endpoint, a node records the life of its transactions and
+ * Blocks as spans and sends them to an OpenTelemetry collector over
+ * OTLP/HTTP, eg. Jaeger with its OTLP receiver:
+ *
+ *	docker run -p 16686:16686 -p 4318:4318 jaegertracing/all-in-one
+ *	toychain -dev -http :8545 -otlp-endpoint http://localhost:4318
+ *
+ * Each transaction is a trace:
+ *
+ *	txn.submit     POST /txns, joining the trace of the W3C traceparent
+ *	               header of the request if any, returned in the reply
+ *	mempool.admit  checks and admission to the Mempool
+ *	txn.pending    from admission until a committed Block includes it
+ *
+ * and each Block mined is another, linked to the traces of its
+ * transactions:
+ *
+ *	block           CommitBlock
+ *	block.assemble  packing the pending transactions and dry running them
+ *	block.mine      Proof Of Work
+ *	block.commit    appending the Block and the state it leads to
+ *
+ * Spans are sent in batches as OTLP JSON every TRACE_FLUSH_INTERVAL, and
+ * dropped past TRACE_QUEUE spans when the collector falls behind. The
+ * OpenTelemetry SDK is not a dependency of this module, so the protocol is
+ * spoken by hand, as gRPC is, see grpc.go.
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TRACE_FLUSH_INTERVAL = 2 * time.Second
+	TRACE_QUEUE          = 4096   // spans waiting to be sent, later ones are dropped
+	TRACE_TXNS           = 10_000 // transactions followed to their Block, an arbitrary one is forgotten past it
+	TRACE_SERVICE        = "toychain"
+)
+
+// Kinds of spans, as numbered by OTLP
+const (
+	SPAN_KIND_INTERNAL = 1
+	SPAN_KIND_SERVER   = 2
+)
+
+// Span of a trace, zero for none
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+func (sc SpanContext) valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// W3C traceparent header naming sc, see https://www.w3.org/TR/trace-context/
+func (sc SpanContext) traceparent() string {
+	return fmt.Sprintf("00-%x-%x-01", sc.TraceID, sc.SpanID)
+}
+
+// Span named by a traceparent header, false if malformed
+func parseTraceparent(header string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	trace, err := hex.DecodeString(parts[1])
+	if err != nil || len(trace) != len(sc.TraceID) {
+		return sc, false
+	}
+	span, err := hex.DecodeString(parts[2])
+	if err != nil || len(span) != len(sc.SpanID) {
+		return sc, false
+	}
+	copy(sc.TraceID[:], trace)
+	copy(sc.SpanID[:], span)
+	return sc, sc.valid()
+}
+
+// Timed operation, whose methods are no-ops on a nil Span, as started by a nil Tracer
+type Span struct {
+	tracer *Tracer
+	name   string
+	ctx    SpanContext
+	parent [8]byte // span ID of the parent, zero for the root of a trace
+	kind   int
+	start  time.Time
+	attrs  []otlpAttribute
+	links  []SpanContext
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+func (s *Span) SetKind(kind int) {
+	if s != nil {
+		s.kind = kind
+	}
+}
+
+// Set the attribute key to a string, integer, float or bool value
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	v := map[string]any{}
+	switch value := value.(type) {
+	case bool:
+		v["boolValue"] = value
+	case int:
+		v["intValue"] = strconv.Itoa(value)
+	case int64:
+		v["intValue"] = strconv.FormatInt(value, 10)
+	case uint64:
+		v["intValue"] = strconv.FormatUint(value, 10)
+	case float64:
+		v["doubleValue"] = value
+	default:
+		v["stringValue"] = fmt.Sprint(value)
+	}
+	s.attrs = append(s.attrs, otlpAttribute{key, v})
+}
+
+// Link the span to another, eg. of another trace
+func (s *Span) Link(sc SpanContext) {
+	if s != nil && sc.valid() {
+		s.links = append(s.links, sc)
+	}
+}
+
+// End the span, failed with err unless nil, and queue it for sending
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	span := otlpSpan{
+		TraceID:    hex.EncodeToString(s.ctx.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.ctx.SpanID[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: s.attrs,
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, l := range s.links {
+		span.Links = append(span.Links, otlpLink{hex.EncodeToString(l.TraceID[:]), hex.EncodeToString(l.SpanID[:])})
+	}
+	if err != nil {
+		span.Status = otlpStatus{Code: 2, Message: err.Error()}
+	}
+	s.tracer.queue(span)
+}
+
+// Sends spans to an OTLP/HTTP collector, its methods are no-ops on a nil Tracer
+type Tracer struct {
+	endpoint string // of the collector, spans are posted to /v1/traces
+	client   *http.Client
+
+	mu      sync.Mutex
+	spans   []otlpSpan           // ended and not sent yet
+	dropped int                  // spans dropped since the last batch sent
+	failing bool                 // the last batch failed, see flush
+	txns    map[string]tracedTxn // transactions followed to their Block, by hash
+
+	stop chan struct{} // closed to stop sending
+	done chan struct{} // closed when the last batch was sent
+}
+
+type tracedTxn struct {
+	ctx      SpanContext // span the later stages of the transaction are children of
+	admitted time.Time   // zero until the Mempool admits it
+}
+
+// Tracer sending to the collector at endpoint, eg. http://localhost:4318
+func NewTracer(endpoint string) (*Tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected eg. http://localhost:4318", endpoint)
+	}
+	t := &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		txns:     map[string]tracedTxn{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// Start a span, child of parent unless zero, starting a new trace then
+func (t *Tracer) Start(name string, parent SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{tracer: t, name: name, kind: SPAN_KIND_INTERNAL, start: time.Now()}
+	if parent.valid() {
+		s.ctx.TraceID, s.parent = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.ctx.TraceID[:])
+	}
+	rand.Read(s.ctx.SpanID[:])
+	return s
+}
+
+// Send the spans left and stop
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+}
+
+/*
+ * Trace the later stages of txn as children of s, the span submitting it,
+ * unless txn is followed already, eg. submitted twice
+ */
+func (t *Tracer) followTxn(txn Transaction, s *Span) {
+	if t == nil {
+		return
+	}
+	hash := txn.Hash()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.txns[hash]; !ok {
+		t.follow(hash, tracedTxn{ctx: s.Context()})
+	}
+}
+
+// Follow the transaction hash, forgetting another past TRACE_TXNS, eg. one that expired
+func (t *Tracer) follow(hash string, traced tracedTxn) {
+	if _, ok := t.txns[hash]; !ok && len(t.txns) >= TRACE_TXNS {
+		for old := range t.txns {
+			delete(t.txns, old)
+			break
+		}
+	}
+	t.txns[hash] = traced
+}
+
+// Span of the stage name of txn, in the trace it was submitted in if followed
+func (t *Tracer) startTxn(name string, txn Transaction) *Span {
+	if t == nil {
+		return nil
+	}
+	hash := txn.Hash()
+	t.mu.Lock()
+	followed := t.txns[hash]
+	t.mu.Unlock()
+	s := t.Start(name, followed.ctx)
+	s.SetAttr("txn.hash", hash)
+	s.SetAttr("txn.payer", txn.payer)
+	s.SetAttr("txn.nonce", txn.nonce)
+	return s
+}
+
+// End s, the admission of txn to the Mempool, following txn until a Block includes it unless err
+func (t *Tracer) admitted(txn Transaction, s *Span, err error) {
+	if t == nil {
+		return
+	}
+	s.End(err)
+	hash := txn.Hash()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	followed := t.txns[hash]
+	if err != nil {
+		// Unless refused as a duplicate of the one admitted
+		if followed.admitted.IsZero() {
+			delete(t.txns, hash)
+		}
+		return
+	}
+	if !followed.ctx.valid() {
+		followed.ctx = s.Context()
+	}
+	followed.admitted = time.Now()
+	t.follow(hash, followed)
+}
+
+// Link s to the traces of the transactions followed among txns
+func (t *Tracer) linkTxns(s *Span, txns []Transaction) {
+	if t == nil {
+		return
+	}
+	for _, txn := range txns {
+		hash := txn.Hash()
+		t.mu.Lock()
+		followed := t.txns[hash]
+		t.mu.Unlock()
+		s.Link(followed.ctx)
+	}
+}
+
+// End the wait of the transactions followed among those of b, the Block at height
+func (t *Tracer) included(b Block, height int) {
+	if t == nil {
+		return
+	}
+	for _, txn := range b.data {
+		hash := txn.Hash()
+		t.mu.Lock()
+		followed, ok := t.txns[hash]
+		delete(t.txns, hash)
+		t.mu.Unlock()
+		if !ok || followed.admitted.IsZero() {
+			continue
+		}
+		s := t.Start("txn.pending", followed.ctx)
+		s.start = followed.admitted
+		s.SetAttr("txn.hash", hash)
+		s.SetAttr("block.hash", b.hash)
+		s.SetAttr("block.height", height)
+		s.End(nil)
+	}
+}
+
+func (t *Tracer) queue(span otlpSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) >= TRACE_QUEUE {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, span)
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(TRACE_FLUSH_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			t.flush()
+			return
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+// Send the spans queued, logging when the collector starts or stops failing
+func (t *Tracer) flush() {
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	err := t.send(spans)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case err != nil && !t.failing:
+		log.Printf("tracing: sending %v spans: %v", len(spans), err)
+	case err == nil && t.failing:
+		log.Printf("tracing: sending spans to %v again", t.endpoint)
+	}
+	if err == nil && dropped > 0 {
+		log.Printf("tracing: dropped %v spans, the collector falls behind", dropped)
+	}
+	t.failing = err != nil
+}
+
+func (t *Tracer) send(spans []otlpSpan) error {
+	var req otlpRequest
+	req.ResourceSpans = []otlpResourceSpans{{
+		Resource:   otlpResource{[]otlpAttribute{{"service.name", map[string]any{"stringValue": TRACE_SERVICE}}}},
+		ScopeSpans: []otlpScopeSpans{{otlpScope{TRACE_SERVICE}, spans}},
+	}}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint+"/v1/traces", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector replied %v", resp.Status)
+	}
+	return nil
+}
+
+// Trace the chain with t, nil to stop tracing
+func (bc *BlockChain) SetTracer(t *Tracer) {
+	bc.tracer = t
+}
+
+// Tracer of the chain, set before the Node serves, see BlockChain.SetTracer
+func (n *Node) tracer() *Tracer {
+	return n.bc.tracer
+}
+
+// ExportTraceServiceRequest of OTLP, in its JSON encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"` // hex
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Links        []otlpLink      `json:"links,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"` // eg. {"stringValue": "..."}
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 2 for errors
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,235 @@
+/*
+ * Transaction lifecycle.
+ * A client submitting a transaction otherwise only learns whether the
+ * Mempool admitted it; it can poll its receipt, see receipts.go, but a
+ * transaction expired, evicted or dropped from a Block just vanishes. The
+ * chain records each step of the transactions it sees instead:
+ *
+ *	received   submitted to the node, being checked
+ *	pending    admitted to the Mempool, or put back by a reorganization
+ *	included   committed in a Block, at a height
+ *	confirmed  FINALITY_DEPTH Blocks deep, see finality.go
+ *	dropped    refused, expired, evicted, failing in a Block, or its Block
+ *	           reverted with its nonce spent by the branch
+ *	replaced   by another transaction of the payer with the same nonce
+ *
+ * Each step is published as a txn-status event, streamed by GET /ws with
+ * the other events or, for one transaction, by GET /txns/{hash}/events
+ * until it ends confirmed, dropped or replaced. The steps of the last
+ * TXN_STATUSES transactions are kept; the status of older ones is read
+ * back from the chain and the Mempool, without the steps.
+ *
+ *	GET /txns/{hash}/status  status of a transaction and its steps
+ *	GET /txns/{hash}/events  WebSocket stream of its next steps
+ */
+package chain
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Statuses of a transaction
+const (
+	TXN_RECEIVED  = "received"
+	TXN_PENDING   = "pending"
+	TXN_INCLUDED  = "included"
+	TXN_CONFIRMED = "confirmed"
+	TXN_DROPPED   = "dropped"
+	TXN_REPLACED  = "replaced"
+)
+
+// Transactions whose steps are kept, the oldest one is forgotten past it
+const TXN_STATUSES = 10_000
+
+type TxnStep struct {
+	Status     string `json:"status"`
+	UnixTs     int64  `json:"unixTs"`
+	Height     int    `json:"height,omitempty"`     // of the Block including the transaction
+	Reason     string `json:"reason,omitempty"`     // why it was dropped or put back
+	ReplacedBy string `json:"replacedBy,omitempty"` // hash of the replacing transaction
+}
+
+type TxnStatus struct {
+	Hash          string    `json:"hash"`
+	Status        string    `json:"status"`
+	Height        int       `json:"height,omitempty"`
+	Confirmations int       `json:"confirmations,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	ReplacedBy    string    `json:"replacedBy,omitempty"`
+	Steps         []TxnStep `json:"steps,omitempty"` // oldest first
+}
+
+// Whether the transaction is done with, its status changing no more short of a reorganization
+func (s TxnStatus) final() bool {
+	return s.Status == TXN_CONFIRMED || s.Status == TXN_DROPPED || s.Status == TXN_REPLACED
+}
+
+// Steps of the last TXN_STATUSES transactions seen
+type txnStatuses struct {
+	steps map[string][]TxnStep
+	order []string // hashes, oldest first
+}
+
+// Record step of the transaction hash and publish its new status
+func (bc *BlockChain) txnStep(hash string, step TxnStep) {
+	ts := &bc.txnStatuses
+	if ts.steps == nil {
+		ts.steps = map[string][]TxnStep{}
+	}
+	if _, ok := ts.steps[hash]; !ok {
+		if len(ts.order) >= TXN_STATUSES {
+			delete(ts.steps, ts.order[0])
+			ts.order = ts.order[1:]
+		}
+		ts.order = append(ts.order, hash)
+	}
+	// The system time, a StepClock moves at each reading, see clock.go
+	step.UnixTs = time.Now().UnixMicro()
+	ts.steps[hash] = append(ts.steps[hash], step)
+	if bc.events == nil {
+		return
+	}
+	status := TxnStatus{Hash: hash, Status: step.Status, Height: step.Height, Reason: step.Reason, ReplacedBy: step.ReplacedBy, Steps: slices.Clone(ts.steps[hash])}
+	if step.Height > 0 {
+		status.Confirmations = bc.confirmations(step.Height)
+	}
+	bc.events.publish(Event{Type: TxnStatusChanged, Status: &status})
+}
+
+// Status of the transaction hash as last recorded, "" if it was not
+func (bc *BlockChain) lastTxnStep(hash string) string {
+	if steps := bc.txnStatuses.steps[hash]; len(steps) > 0 {
+		return steps[len(steps)-1].Status
+	}
+	return ""
+}
+
+// Record the submission of txn, unless it is already pending or committed
+func (bc *BlockChain) txnReceived(txn Transaction) bool {
+	switch bc.lastTxnStep(txn.Hash()) {
+	case TXN_PENDING, TXN_INCLUDED, TXN_CONFIRMED:
+		return false
+	}
+	bc.txnStep(txn.Hash(), TxnStep{Status: TXN_RECEIVED})
+	return true
+}
+
+// Record the admission of txn to the Mempool, or its refusal for err
+func (bc *BlockChain) txnAdmitted(txn Transaction, err error) {
+	if err != nil {
+		bc.txnStep(txn.Hash(), TxnStep{Status: TXN_DROPPED, Reason: err.Error()})
+		return
+	}
+	bc.txnStep(txn.Hash(), TxnStep{Status: TXN_PENDING})
+}
+
+func (bc *BlockChain) txnDropped(hash, reason string) {
+	bc.txnStep(hash, TxnStep{Status: TXN_DROPPED, Reason: reason})
+}
+
+// Record the inclusion of the transactions of b at height, and the confirmation of those FINALITY_DEPTH deep
+func (bc *BlockChain) txnsIncluded(b Block, height int) {
+	for _, txn := range b.data {
+		bc.txnStep(txn.Hash(), TxnStep{Status: TXN_INCLUDED, Height: height})
+	}
+	if deep := height - FINALITY_DEPTH + 1; deep > 0 && !bc.isPruned(deep) {
+		for _, txn := range bc.blockAt(deep).data {
+			if bc.lastTxnStep(txn.Hash()) == TXN_INCLUDED {
+				bc.txnStep(txn.Hash(), TxnStep{Status: TXN_CONFIRMED, Height: deep})
+			}
+		}
+	}
+}
+
+/*
+ * Status of the transaction hash with its steps, from the chain and the
+ * Mempool if its steps were forgotten, false if unknown
+ */
+func (bc *BlockChain) TxnStatus(hash string) (TxnStatus, bool) {
+	status := TxnStatus{Hash: hash, Steps: slices.Clone(bc.txnStatuses.steps[hash])}
+	if n := len(status.Steps); n > 0 {
+		last := status.Steps[n-1]
+		status.Status, status.Height, status.Reason, status.ReplacedBy = last.Status, last.Height, last.Reason, last.ReplacedBy
+	}
+	switch status.Status {
+	case TXN_INCLUDED, TXN_CONFIRMED, "":
+		if _, height, ok := bc.findTxn(hash); ok {
+			status.Status, status.Height = TXN_INCLUDED, height
+			status.Confirmations = bc.confirmations(height)
+			if status.Confirmations >= FINALITY_DEPTH {
+				status.Status = TXN_CONFIRMED
+			}
+			return status, true
+		}
+	}
+	if status.Status == "" {
+		for _, txn := range bc.mempool.held() {
+			if txn.Hash() == hash {
+				status.Status = TXN_PENDING
+				return status, true
+			}
+		}
+		return status, false
+	}
+	return status, true
+}
+
+// GET /txns/{hash}/status
+func (s *Server) handleTxnStatus(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	var status TxnStatus
+	var found bool
+	s.node.withChain(func(bc *BlockChain) { status, found = bc.TxnStatus(hash) })
+	if !found {
+		writeError(w, http.StatusNotFound, "unknown transaction "+hash)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+/*
+ * GET /txns/{hash}/events: its current status, then each step as it
+ * happens, over a WebSocket closed once the transaction is done with
+ */
+func (s *Server) handleTxnEvents(w http.ResponseWriter, r *http.Request) {
+	hash := r.PathValue("hash")
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer ws.Close()
+
+	events, cancel := s.node.Subscribe(TxnStatusChanged)
+	defer cancel()
+	var status TxnStatus
+	s.node.withChain(func(bc *BlockChain) { status, _ = bc.TxnStatus(hash) })
+	for {
+		if status.Status != "" {
+			payload, _ := json.Marshal(status)
+			if err := ws.WriteText(payload); err != nil {
+				return
+			}
+		}
+		if status.final() {
+			return
+		}
+		select {
+		case <-ws.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				log.Printf("GET /txns/%v/events: subscription closed", hash)
+				return
+			}
+			if ev.Status.Hash != hash {
+				continue
+			}
+			status = *ev.Status
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Block versions and upgrades.
+ * The Blocks of a chain follow the rules of its genesis spec, version 1,
+ * until the spec schedules upgrades: from the height of an upgrade on,
+ * every Block carries its version in the Header and follows its rules on
+ * top of the earlier ones, as a hard fork or soft fork does:
+ *
+ *	"upgrades": [
+ *	  {"version": 2, "height": 100, "rules": [{"rule": "max-amount", "amount": 50}]},
+ *	  {"version": 3, "height": 200, "blockLimits": {"bytes": 2097152, "txns": 0}}
+ *	]
+ *
+ * Rules, see validator.go, only ever add to those of the versions before,
+ * and block limits, see blocksize.go, replace them. Each Block is checked
+ * against the rules of its height, so the Blocks a node replays from
+ * storage or a peer are checked as they were when mined, whatever the
+ * upgrades after them.
+ *
+ * A node appending a Block refuses it with ErrWrongVersion when it carries
+ * a version below the one of its height, and follows the rules of its
+ * height whatever higher version the Block signals. An upgrade that only
+ * restricts, eg. adding a rule, is a soft fork: nodes not scheduling it
+ * still accept the Blocks of the upgraded miners. One that loosens, eg.
+ * raising the block limits, is a hard fork: they refuse the first Block
+ * using the new limits and follow their own chain from there.
+ *
+ * The schedule is not part of the genesis hash, so the nodes of a chain
+ * agree on the upgrades until their heights, and upgrading a chain is
+ * adding an upgrade at a height it has not reached yet: the Blocks it has
+ * carry no version and hash as before.
+ */
+package chain
+
+import "fmt"
+
+// Version of the Blocks before the first upgrade, carried by none of them
+const BASE_BLOCK_VERSION = 1
+
+// Rules of a chain from a height on
+type Upgrade struct {
+	Version     int          `json:"version"`               // one more than the version before
+	Height      int          `json:"height"`                // of the first Block following it
+	Rules       []RuleSpec   `json:"rules,omitempty"`       // added to those of the versions before
+	BlockLimits *BlockLimits `json:"blockLimits,omitempty"` // replacing those of the versions before
+}
+
+// Validators of the rules the upgrade adds
+func (u Upgrade) validators() []Validator {
+	validators := []Validator{}
+	for _, rule := range u.Rules {
+		validators = append(validators, rule.Validator())
+	}
+	return validators
+}
+
+// Whether the upgrades follow each other, one version at a time, at growing heights
+func (g Genesis) checkUpgrades() error {
+	version, height := BASE_BLOCK_VERSION, 0
+	for _, u := range g.Upgrades {
+		if u.Version != version+1 {
+			return fmt.Errorf("upgrade to version %v follows version %v, want version %v", u.Version, version, version+1)
+		}
+		if u.Height <= height {
+			return fmt.Errorf("upgrade to version %v at height %v, want a height above %v", u.Version, u.Height, height)
+		}
+		for _, rule := range u.Rules {
+			if err := rule.check(); err != nil {
+				return fmt.Errorf("upgrade to version %v: %w", u.Version, err)
+			}
+		}
+		if u.BlockLimits != nil {
+			if err := u.BlockLimits.check(); err != nil {
+				return fmt.Errorf("upgrade to version %v: %w", u.Version, err)
+			}
+		}
+		version, height = u.Version, u.Height
+	}
+	return nil
+}
+
+// Version of the rules of the Block at height under upgrades
+func versionAt(upgrades []Upgrade, height int) int {
+	version := BASE_BLOCK_VERSION
+	for _, u := range upgrades {
+		if u.Height <= height {
+			version = u.Version
+		}
+	}
+	return version
+}
+
+// Version the Header signals, BASE_BLOCK_VERSION if none
+func (h Header) Version() int {
+	return max(h.version, BASE_BLOCK_VERSION)
+}
+
+// Version of the rules of the Block at height
+func (bc *BlockChain) VersionAt(height int) int {
+	return versionAt(bc.genesis.Upgrades, height)
+}
+
+// Validators of the Block at height: those of the genesis and of the upgrades before it
+func (bc *BlockChain) activeValidators(height int) []Validator {
+	validators := bc.validators
+	for i, u := range bc.genesis.Upgrades {
+		if u.Height <= height {
+			validators = append(validators[:len(validators):len(validators)], bc.upgrades[i]...)
+		}
+	}
+	return validators
+}
+
+// Set the version of b, the next Block, once the chain has upgraded
+func (bc *BlockChain) commitVersion(b *Block) {
+	if version := bc.VersionAt(bc.blocks.Len()); version > BASE_BLOCK_VERSION {
+		b.version = version
+	}
+}
+
+// Check h, at height, signals at least the version of the rules there under upgrades
+func checkVersion(upgrades []Upgrade, height int, h Header) error {
+	if version := versionAt(upgrades, height); h.Version() < version {
+		return fmt.Errorf("%w: version %v at height %v, where version %v applies", ErrWrongVersion, h.Version(), height, version)
+	}
+	return nil
+}
+
+func (bc *BlockChain) checkVersion(height int, b Block) error {
+	if err := checkVersion(bc.genesis.Upgrades, height, b.Header); err != nil {
+		return fmt.Errorf("block %v: %w", b.hash, err)
+	}
+	return nil
+}
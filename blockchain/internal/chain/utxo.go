@@ -0,0 +1,288 @@
+/*
+ * UTXO transactions, living side by side with account balances.
+ * A TxnUTXO spends unspent outputs of earlier UTXO transactions and creates
+ * new ones, each output holding an amount of the native coin for an owner.
+ * It may also bring coins in from the payer's account balance (amt) and
+ * release what the inputs hold beyond the outputs to the payee's account:
+ *   inputs + amt = outputs + released to payee
+ * Every owner of a spent output signs the transaction, and the wallet takes
+ * care of picking the outputs to spend and of sending the change back.
+ */
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	GAS_UTXO_INPUT  = 5_000
+	GAS_UTXO_OUTPUT = 3_000
+)
+
+// Output of a UTXO transaction, identified by txn hash and index
+type UTXO struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	Amt   Amount `json:"amt"`
+}
+
+type UTXOOutput struct {
+	owner string
+	amt   Amount
+}
+
+type UTXOTxn struct {
+	inputs  []string // IDs of the spent outputs
+	outputs []UTXOOutput
+	keys    map[string][]byte // public key of each owner of an input
+	sigs    map[string][]byte // signature of each owner over the transaction
+	aggSig  []byte            // Schnorr signature of every owner in place of sigs, see schnorr.go
+}
+
+func utxoID(txnHash string, index int) string {
+	return fmt.Sprintf("%v:%v", txnHash, index)
+}
+
+func NewUTXOOutput(owner string, amt Amount) UTXOOutput {
+	return UTXOOutput{owner: owner, amt: amt}
+}
+
+/*
+ * Create an unsigned UTXO transaction. deposit is taken from payer's
+ * account balance, and inputs left over after the outputs go to payee
+ */
+func NewUTXOTxn(payer, payee string, nonce uint64, deposit Amount, inputs []string, outputs ...UTXOOutput) Transaction {
+	return Transaction{
+		kind:  TxnUTXO,
+		payer: payer,
+		payee: payee,
+		amt:   deposit,
+		nonce: nonce,
+		utxo: &UTXOTxn{
+			inputs:  inputs,
+			outputs: outputs,
+			keys:    make(map[string][]byte),
+			sigs:    make(map[string][]byte),
+		},
+	}
+}
+
+// Add the signature of the signer's account, owning some of the inputs
+func (txn *Transaction) SignUTXO(s Signer) error {
+	if txn.utxo == nil {
+		return errors.New("not a UTXO transaction")
+	}
+	sig, err := s.SignTxn(*txn)
+	if err != nil {
+		return err
+	}
+	txn.utxo.keys[s.Account()] = s.PublicKey()
+	txn.utxo.sigs[s.Account()] = sig
+	return nil
+}
+
+func (u *UTXOTxn) gas() uint64 {
+	return GAS_TRANSFER + uint64(len(u.inputs))*GAS_UTXO_INPUT + uint64(len(u.outputs))*GAS_UTXO_OUTPUT
+}
+
+// Check the transaction is well formed and its signatures valid
+func (u *UTXOTxn) verify(scheme SigScheme, digest []byte, deposit Amount) error {
+	if len(u.inputs) == 0 && deposit == 0 {
+		return errors.New("UTXO transaction spends nothing")
+	}
+	if deposit < 0 {
+		return errors.New("negative deposit")
+	}
+	seen := make(map[string]bool)
+	for _, id := range u.inputs {
+		if seen[id] {
+			return fmt.Errorf("output %v spent twice", id)
+		}
+		seen[id] = true
+	}
+	for _, out := range u.outputs {
+		if out.amt <= 0 || out.owner == "" {
+			return errors.New("UTXO output needs an owner and a positive amount")
+		}
+	}
+	if u.aggSig != nil {
+		return verifyAggregateOf(scheme, u.keys, u.sigs, digest, u.aggSig)
+	}
+	for owner, sig := range u.sigs {
+		if !verifySignature(scheme, u.keys[owner], digest, sig) {
+			return fmt.Errorf("%w by %v", ErrInvalidSignature, owner)
+		}
+	}
+	return nil
+}
+
+// Whether owner signed the transaction, alone or in the aggregate
+func (u *UTXOTxn) signed(owner string) bool {
+	if u.aggSig != nil {
+		return u.keys[owner] != nil
+	}
+	_, ok := u.sigs[owner]
+	return ok
+}
+
+func (s *State) applyUTXO(txn Transaction) error {
+	u := txn.utxo
+	in := txn.amt
+	for _, id := range u.inputs {
+		spent, ok := s.utxos[id]
+		if !ok {
+			return fmt.Errorf("output %v is unknown or already spent", id)
+		}
+		if !u.signed(spent.Owner) {
+			return fmt.Errorf("%w: output %v is not signed by its owner %v", ErrInvalidSignature, id, spent.Owner)
+		}
+		if known, ok := s.keys[spent.Owner]; ok && !bytes.Equal(known, u.keys[spent.Owner]) {
+			return fmt.Errorf("%w: %v signed with a key it does not own", ErrInvalidSignature, spent.Owner)
+		}
+		if !ownsAccount(spent.Owner, u.keys[spent.Owner]) {
+			return fmt.Errorf("%w: key does not hash to address %v", ErrInvalidSignature, spent.Owner)
+		}
+		in += spent.Amt
+	}
+	var out Amount
+	for _, o := range u.outputs {
+		out += o.amt
+	}
+	released := in - out
+	if released < 0 {
+		return fmt.Errorf("outputs of %v exceed inputs of %v", out, in)
+	}
+	if released > 0 && txn.payee == "" {
+		return fmt.Errorf("%v left over without a payee", released)
+	}
+	if txn.amt > 0 && s.Balance(txn.payer, NATIVE_ASSET) < txn.amt {
+		return fmt.Errorf("%w: %v cannot deposit %v", ErrInsufficientFunds, txn.payer, txn.amt)
+	}
+
+	for _, id := range u.inputs {
+		s.checkKey(s.utxos[id].Owner, u.keys[s.utxos[id].Owner])
+		delete(s.utxos, id)
+	}
+	hash := txn.Hash()
+	for i, o := range u.outputs {
+		s.utxos[utxoID(hash, i)] = UTXO{ID: utxoID(hash, i), Owner: o.owner, Amt: o.amt}
+	}
+	s.credit(txn.payer, NATIVE_ASSET, -txn.amt)
+	if released > 0 {
+		s.credit(txn.payee, NATIVE_ASSET, released)
+	}
+	return nil
+}
+
+func (u *UTXOTxn) String() string {
+	outputs := []string{}
+	for _, o := range u.outputs {
+		outputs = append(outputs, fmt.Sprintf("%v:%v", o.owner, o.amt))
+	}
+	return fmt.Sprintf("spend %v outputs -> [%v]", len(u.inputs), strings.Join(outputs, " "))
+}
+
+// Unspent outputs owned by owner, largest first
+func (bc *BlockChain) UTXOs(owner string) []UTXO {
+	return bc.state.utxosOf(owner)
+}
+
+func (s *State) utxosOf(owner string) []UTXO {
+	utxos := []UTXO{}
+	for _, u := range s.utxos {
+		if u.Owner == owner {
+			utxos = append(utxos, u)
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].Amt != utxos[j].Amt {
+			return utxos[i].Amt > utxos[j].Amt
+		}
+		return utxos[i].ID < utxos[j].ID
+	})
+	return utxos
+}
+
+/*
+ * Build and sign with s a transaction paying amt to the UTXO owner to out
+ * of the unspent outputs of the account of s, picking the largest outputs
+ * first and sending the change back to it
+ */
+func PayUTXO(s Signer, unspent []UTXO, to string, amt Amount, nonce uint64) (Transaction, error) {
+	selected := []string{}
+	var total Amount
+	for _, u := range unspent {
+		if total >= amt {
+			break
+		}
+		if u.Owner != s.Account() {
+			continue
+		}
+		selected = append(selected, u.ID)
+		total += u.Amt
+	}
+	return spendUTXOs(s, selected, total, to, amt, nonce)
+}
+
+/*
+ * Like PayUTXO, but spending all the outputs inputs of unspent, eg. picked
+ * by hand, see coincontrol.go
+ */
+func PayUTXOFrom(s Signer, unspent []UTXO, inputs []string, to string, amt Amount, nonce uint64) (Transaction, error) {
+	owned := map[string]Amount{}
+	for _, u := range unspent {
+		if u.Owner == s.Account() {
+			owned[u.ID] = u.Amt
+		}
+	}
+	var total Amount
+	for _, id := range inputs {
+		amt, ok := owned[id]
+		if !ok {
+			return Transaction{}, fmt.Errorf("%v is not an unspent output of %v", id, s.Account())
+		}
+		total += amt
+	}
+	return spendUTXOs(s, inputs, total, to, amt, nonce)
+}
+
+// Sign a transaction spending the outputs selected, holding total, into amt for to and the change
+func spendUTXOs(s Signer, selected []string, total Amount, to string, amt Amount, nonce uint64) (Transaction, error) {
+	if amt <= 0 {
+		return Transaction{}, errors.New("amount must be positive")
+	}
+	if total < amt {
+		return Transaction{}, fmt.Errorf("%v holds %v in unspent outputs, needs %v", s.Account(), total, amt)
+	}
+	outputs := []UTXOOutput{NewUTXOOutput(to, amt)}
+	if change := total - amt; change > 0 {
+		outputs = append(outputs, NewUTXOOutput(s.Account(), change))
+	}
+	txn := NewUTXOTxn(s.Account(), "", nonce, 0, selected, outputs...).WithScheme(s.Scheme()).WithChainID(s.ChainID())
+	if err := txn.SignUTXO(s); err != nil {
+		return Transaction{}, err
+	}
+	return txn, nil
+}
+
+// GET /utxos/{owner}?height=..
+func (s *Server) handleUTXOs(w http.ResponseWriter, r *http.Request) {
+	var utxos []UTXO
+	var err error
+	s.node.withChain(func(bc *BlockChain) {
+		var view *StateView
+		if view, err = requestView(bc, r); err == nil {
+			utxos = view.UTXOs(r.PathValue("owner"))
+		}
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, utxos)
+}
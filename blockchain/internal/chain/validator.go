@@ -0,0 +1,247 @@
+/*
+ * Pluggable transaction validation.
+ * Courses want different ledger rules, eg. a cap on payments or a class
+ * roster of accounts, without forking the core. A Validator is an extra
+ * rule on top of the consensus rules: the Mempool refuses transactions
+ * failing it, and Blocks carrying one are invalid. Every node of a chain
+ * must run the same Validators, lest they fork, so the built-in rules are
+ * best declared in the genesis spec, which makes them part of the genesis
+ * hash:
+ *
+ *	max-amount   the amount of a transaction and of each of its payouts
+ *	             is at most amount
+ *	allow-list   every account a transaction involves is one of accounts
+ *	data-fields  every transaction carries data holding a JSON object
+ *	             with all of fields, eg. the course and student IDs
+ *	freeze       no transaction involves one of accounts, eg. a sanctions
+ *	             list, or a key of namespace
+ *	recipients   every account a transaction pays, other than its payer,
+ *	             is one of accounts or a key of namespace
+ *
+ * The lists of freeze and recipients change on-chain when the rule names
+ * a namespace: the keys of the namespace, see kv.go, are listed accounts,
+ * and the admin of the rule, the only account it lets write to the
+ * namespace, adds and removes them with key-value writes. A change holds
+ * from the Block after the write on. Rules binding one node only are
+ * policies, see policy.go.
+ *
+ * Custom rules are Go types registered with BlockChain.AddValidator after
+ * creating the chain. Validators see the state before the Block, or the
+ * current state for the Mempool, not the changes of the transactions
+ * before them in the same Block.
+ */
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	RULE_MAX_AMOUNT  = "max-amount"
+	RULE_ALLOW_LIST  = "allow-list"
+	RULE_DATA_FIELDS = "data-fields"
+	RULE_FREEZE      = "freeze"
+	RULE_RECIPIENTS  = "recipients"
+)
+
+type Validator interface {
+	// Check txn against the state it applies to, the error saying why it is refused
+	Validate(txn Transaction, state *StateView) error
+}
+
+// Function used as a Validator
+type ValidatorFunc func(txn Transaction, state *StateView) error
+
+func (f ValidatorFunc) Validate(txn Transaction, state *StateView) error {
+	return f(txn, state)
+}
+
+// Built-in rule of a genesis spec
+type RuleSpec struct {
+	Rule      string   `json:"rule"`                // RULE_MAX_AMOUNT, RULE_ALLOW_LIST, RULE_DATA_FIELDS, RULE_FREEZE or RULE_RECIPIENTS
+	Amount    Amount   `json:"amount,omitempty"`    // of RULE_MAX_AMOUNT
+	Accounts  []string `json:"accounts,omitempty"`  // of RULE_ALLOW_LIST, RULE_FREEZE and RULE_RECIPIENTS
+	Fields    []string `json:"fields,omitempty"`    // of RULE_DATA_FIELDS
+	Namespace string   `json:"namespace,omitempty"` // listing more accounts as keys, of RULE_FREEZE and RULE_RECIPIENTS
+	Admin     string   `json:"admin,omitempty"`     // account writing to Namespace
+}
+
+func (r RuleSpec) check() error {
+	switch r.Rule {
+	case RULE_MAX_AMOUNT:
+		if r.Amount <= 0 {
+			return fmt.Errorf("rule %v needs a positive amount", r.Rule)
+		}
+	case RULE_ALLOW_LIST:
+		if len(r.Accounts) == 0 {
+			return fmt.Errorf("rule %v needs accounts", r.Rule)
+		}
+	case RULE_DATA_FIELDS:
+		if len(r.Fields) == 0 {
+			return fmt.Errorf("rule %v needs fields", r.Rule)
+		}
+	case RULE_FREEZE, RULE_RECIPIENTS:
+		if len(r.Accounts) == 0 && r.Namespace == "" {
+			return fmt.Errorf("rule %v needs accounts or a namespace", r.Rule)
+		}
+		if r.Namespace != "" && r.Admin == "" {
+			return fmt.Errorf("rule %v needs the admin of namespace %v", r.Rule, r.Namespace)
+		}
+		if len(r.Namespace) > MAX_KV_NAMESPACE_SIZE {
+			return fmt.Errorf("rule %v namespace must be at most %v bytes", r.Rule, MAX_KV_NAMESPACE_SIZE)
+		}
+	default:
+		return fmt.Errorf("unknown rule %q, want %v, %v, %v, %v or %v", r.Rule, RULE_MAX_AMOUNT, RULE_ALLOW_LIST, RULE_DATA_FIELDS, RULE_FREEZE, RULE_RECIPIENTS)
+	}
+	return nil
+}
+
+// Committed in the genesis hash
+func (r RuleSpec) String() string {
+	switch r.Rule {
+	case RULE_MAX_AMOUNT:
+		return fmt.Sprintf("%v/%v", r.Rule, r.Amount)
+	case RULE_ALLOW_LIST:
+		return fmt.Sprintf("%v/%v", r.Rule, strings.Join(r.Accounts, ","))
+	case RULE_FREEZE, RULE_RECIPIENTS:
+		return fmt.Sprintf("%v/%v/%q/%q", r.Rule, strings.Join(r.Accounts, ","), r.Namespace, r.Admin)
+	}
+	return fmt.Sprintf("%v/%v", r.Rule, strings.Join(r.Fields, ","))
+}
+
+func (r RuleSpec) Validator() Validator {
+	switch r.Rule {
+	case RULE_MAX_AMOUNT:
+		return ValidatorFunc(func(txn Transaction, _ *StateView) error {
+			if txn.amt > r.Amount {
+				return fmt.Errorf("amount %v above %v", txn.amt, r.Amount)
+			}
+			for _, p := range txn.payouts {
+				if p.amt > r.Amount {
+					return fmt.Errorf("payout of %v to %v above %v", p.amt, p.payee, r.Amount)
+				}
+			}
+			return nil
+		})
+	case RULE_ALLOW_LIST:
+		return ValidatorFunc(func(txn Transaction, _ *StateView) error {
+			for _, account := range txn.accounts() {
+				if !slices.Contains(r.Accounts, account) {
+					return fmt.Errorf("account %v not allowed", account)
+				}
+			}
+			return nil
+		})
+	case RULE_FREEZE:
+		return ValidatorFunc(func(txn Transaction, state *StateView) error {
+			if err := r.checkAdmin(txn); err != nil {
+				return err
+			}
+			for _, account := range txn.accounts() {
+				if r.lists(account, state) {
+					return fmt.Errorf("account %v frozen", account)
+				}
+			}
+			return nil
+		})
+	case RULE_RECIPIENTS:
+		return ValidatorFunc(func(txn Transaction, state *StateView) error {
+			if err := r.checkAdmin(txn); err != nil {
+				return err
+			}
+			for _, account := range txn.recipients() {
+				if !r.lists(account, state) {
+					return fmt.Errorf("recipient %v not allowed", account)
+				}
+			}
+			return nil
+		})
+	}
+	return ValidatorFunc(func(txn Transaction, _ *StateView) error {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(txn.data, &fields); err != nil {
+			return fmt.Errorf("data is not a JSON object with fields %v", strings.Join(r.Fields, ", "))
+		}
+		for _, field := range r.Fields {
+			if _, ok := fields[field]; !ok {
+				return fmt.Errorf("data has no field %v", field)
+			}
+		}
+		return nil
+	})
+}
+
+// Whether account is one of the accounts of r or a key of its namespace in state
+func (r RuleSpec) lists(account string, state *StateView) bool {
+	if slices.Contains(r.Accounts, account) {
+		return true
+	}
+	if r.Namespace == "" || state.NamespaceOwner(r.Namespace) != r.Admin {
+		return false
+	}
+	_, ok := state.GetKV(r.Namespace, account)
+	return ok
+}
+
+// Refuse writes to the namespace of r by anyone but its admin
+func (r RuleSpec) checkAdmin(txn Transaction) error {
+	if r.Namespace != "" && txn.kv != nil && txn.kv.namespace == r.Namespace && txn.payer != r.Admin {
+		return fmt.Errorf("only %v writes to namespace %v", r.Admin, r.Namespace)
+	}
+	return nil
+}
+
+// Accounts txn pays, its payer aside
+func (txn Transaction) recipients() []string {
+	recipients := []string{}
+	paid := func(account string) {
+		if account != "" && account != txn.payer && !slices.Contains(recipients, account) {
+			recipients = append(recipients, account)
+		}
+	}
+	paid(txn.payee)
+	for _, p := range txn.payouts {
+		paid(p.payee)
+	}
+	if txn.swap != nil {
+		for _, leg := range txn.swap.legs {
+			paid(leg.to)
+		}
+	}
+	if txn.utxo != nil {
+		for _, o := range txn.utxo.outputs {
+			paid(o.owner)
+		}
+	}
+	return recipients
+}
+
+// Refuse the transactions v fails from now on, in the Mempool and in Blocks
+func (bc *BlockChain) AddValidator(v Validator) {
+	bc.validators = append(bc.validators, v)
+}
+
+/*
+ * Run the Validators of the chain on txn against state
+ * Fails with ErrRuleViolation
+ */
+func (bc *BlockChain) validate(txn Transaction, state *State) error {
+	if txn.kind == TxnMint {
+		return nil
+	}
+	view := &StateView{state: state, height: bc.blocks.Len() - 1}
+	if txn.kind == TxnRecord {
+		if err := bc.validateRecord(txn, view); err != nil {
+			return fmt.Errorf("%w: %v", ErrRuleViolation, err)
+		}
+	}
+	for _, v := range bc.activeValidators(bc.blocks.Len()) {
+		if err := v.Validate(txn, view); err != nil {
+			return fmt.Errorf("%w: %v", ErrRuleViolation, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+ * Offline chain verification.
+ * A node trusts the Blocks it wrote itself: on a restart it reads them
+ * back from cold storage, and the doctor, see doctor.go, checks a running
+ * node. To grade a chain, or to check the storage of a node before
+ * restarting it, the verify command checks the chain persisted in cold
+ * storage with no node running, set up by the same flags as the node:
+ *
+ *	toychain verify -data-dir node1 -cold-dir cold -store log -genesis genesis.json
+ *
+ * It reads every Block from genesis on, the stored genesis Block having to
+ * be the one of the genesis spec, and validates each like an imported one,
+ * replaying the state: proof of work, transactions, state commitments and
+ * all. With a write-ahead log every Block was committed along with the
+ * state root it led to, see wal.go, which must be the root of the state
+ * replayed to it. Verification stops at the first Block missing, unreadable
+ * or invalid, and reports it with the reason and the state roots not
+ * matching up to it. The exit code is 0 for a valid chain, 1 otherwise.
+ */
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// State root committed with a Block that the replayed state does not match
+type RootMismatch struct {
+	Height    int    `json:"height"`
+	Committed string `json:"committed"`
+	Replayed  string `json:"replayed"`
+}
+
+type VerifyReport struct {
+	Height        int            `json:"height"`                  // of the last valid Block
+	Blocks        int            `json:"blocks"`                  // valid Blocks, genesis included
+	Roots         int            `json:"roots"`                   // committed state roots checked
+	InvalidHeight int            `json:"invalidHeight,omitempty"` // of the first invalid Block, with Reason
+	InvalidHash   string         `json:"invalidHash,omitempty"`
+	Reason        string         `json:"reason,omitempty"` // why the Block at InvalidHeight is invalid
+	Mismatches    []RootMismatch `json:"mismatches"`
+	StateRoot     string         `json:"stateRoot"` // after the last valid Block
+	Supply        Amount         `json:"supply"`
+}
+
+// Whether the chain verified has no invalid Block and no state root mismatch
+func (r VerifyReport) Valid() bool {
+	return r.Reason == "" && len(r.Mismatches) == 0
+}
+
+/*
+ * Verify the chain of genesis persisted in cold, see above, trusting the
+ * work of the Blocks up to checkpoints. The error is for a storage that
+ * cannot be read, problems of the chain go in the report
+ */
+func VerifyChain(genesis Genesis, cold ObjectStore, checkpoints []Checkpoint) (VerifyReport, error) {
+	report := VerifyReport{Mismatches: []RootMismatch{}}
+	bc := CreateBlockChain(genesis)
+	if err := bc.SetCheckpoints(checkpoints); err != nil {
+		return report, err
+	}
+	invalid := func(height int, hash string, format string, args ...any) {
+		report.InvalidHeight, report.InvalidHash, report.Reason = height, hash, fmt.Sprintf(format, args...)
+	}
+	for height := 0; ; height++ {
+		b, err := readColdBlock(cold, height)
+		if errors.Is(err, os.ErrNotExist) {
+			if height == 0 {
+				return report, fmt.Errorf("no chain in cold storage, block 0 missing")
+			}
+			if err := checkChainEnd(cold, height); err != nil {
+				invalid(height, "", "%v", err)
+			}
+			break
+		}
+		if err != nil {
+			invalid(height, "", "%v", err)
+			break
+		}
+		if height == 0 && b.hash != bc.GenesisHash() {
+			invalid(0, b.hash, "stored genesis does not match the genesis spec %v", bc.GenesisHash())
+			break
+		}
+		if height > 0 {
+			if err := bc.appendBlock(b); err != nil {
+				invalid(height, b.hash, "%v", err)
+				break
+			}
+		}
+		report.Height, report.Blocks = height, report.Blocks+1
+		root, ok, err := committedRoot(cold, height)
+		if err != nil {
+			return report, err
+		}
+		if ok {
+			report.Roots++
+			if root != bc.stateRoots[height] {
+				report.Mismatches = append(report.Mismatches, RootMismatch{height, root, bc.stateRoots[height]})
+			}
+		}
+	}
+	report.StateRoot, report.Supply = bc.state.Root(), bc.TotalSupply()
+	return report, nil
+}
+
+/*
+ * Check the Block at height, missing from cold, is past the end of the
+ * chain rather than lost: neither its state root nor the next Block are
+ * stored
+ */
+func checkChainEnd(cold ObjectStore, height int) error {
+	if _, ok, err := committedRoot(cold, height); err != nil || ok {
+		return errors.Join(err, fmt.Errorf("block %v missing, its state root being committed", height))
+	}
+	if _, err := cold.Get(coldKey(height + 1)); !errors.Is(err, os.ErrNotExist) {
+		return errors.Join(err, fmt.Errorf("block %v missing, block %v being stored", height, height+1))
+	}
+	return nil
+}
+
+// Verify the chain of genesis in cold and print the report, returning the exit code
+func runVerifyChain(genesis Genesis, cold ObjectStore, checkpoints []Checkpoint, out *Output) int {
+	report, err := VerifyChain(genesis, cold, checkpoints)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	fields := [][2]string{
+		{"height", fmt.Sprint(report.Height)},
+		{"blocks", fmt.Sprint(report.Blocks)},
+		{"state roots checked", fmt.Sprint(report.Roots)},
+		{"state root", report.StateRoot},
+		{"supply", report.Supply.String()},
+	}
+	if report.Reason != "" {
+		fields = append(fields,
+			[2]string{"first invalid block", strings.TrimSpace(fmt.Sprintf("%v %v", report.InvalidHeight, report.InvalidHash))},
+			[2]string{"reason", report.Reason})
+	}
+	for _, m := range report.Mismatches {
+		fields = append(fields, [2]string{"state root mismatch", fmt.Sprintf("block %v committed %v, replayed %v", m.Height, m.Committed, m.Replayed)})
+	}
+	if err := out.Record(fields, report); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !report.Valid() {
+		return 1
+	}
+	out.Note("chain valid")
+	return 0
+}
@@ -0,0 +1,277 @@
+/*
+ * Voting.
+ * An example application on records, see records.go, enabled by listing
+ * APP_VOTING in the apps of the genesis spec. Nothing in it moves coins:
+ *
+ *	- an organizer opens a poll with a key-value write of its PollSpec,
+ *	  the choices and the last height ballots are accepted at, in the
+ *	  namespace of the poll, see NewPoll, which makes the organizer its
+ *	  owner, see kv.go
+ *	- the organizer registers each voter in the same namespace, along with
+ *	  the nonce the voter is to vote with, usually its next one, see
+ *	  NewPollVoter
+ *	- a voter casts a Ballot, a record carrying the poll and a choice, with
+ *	  that nonce, see NewBallot
+ *
+ * An account uses each nonce once, so a voter casts a single ballot per
+ * poll: a second one, or one sent after the voter's nonce went past the
+ * registered one, is refused. A voter whose nonce went past it before
+ * voting must be registered again, which also lets a voter who voted
+ * change its vote. The tally is derived from the chain, by counting the
+ * last ballot of each voter committed to the poll, and needs the Blocks of
+ * the poll unpruned. The organizer is trusted with the poll: it may
+ * change the choices or the closing height while the poll is open.
+ *
+ *	GET /polls/{id}  tally of a poll
+ */
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Name of the application in the apps of a genesis spec
+const APP_VOTING = "voting"
+
+// Schema of the ballots
+const BALLOT_SCHEMA = "ballot"
+
+// State keys of a poll, in the namespace POLL_NAMESPACE_PREFIX and its ID
+const (
+	POLL_NAMESPACE_PREFIX = "poll/"
+	POLL_SPEC_KEY         = "spec"
+	POLL_VOTER_PREFIX     = "voter/" // followed by the account, holding its ballot nonce
+)
+
+// Written by the organizer of a poll, at most MAX_KV_VALUE_SIZE bytes of JSON
+type PollSpec struct {
+	Question string   `json:"question,omitempty"`
+	Choices  []string `json:"choices"`
+	Closes   int      `json:"closes,omitempty"` // last height ballots are accepted at, open forever if 0
+}
+
+type Ballot struct {
+	Poll   string `json:"poll"`
+	Choice string `json:"choice"`
+}
+
+type PollChoice struct {
+	Choice string `json:"choice"`
+	Votes  int    `json:"votes"`
+}
+
+type PollTally struct {
+	Poll      string       `json:"poll"`
+	Question  string       `json:"question,omitempty"`
+	Organizer string       `json:"organizer"`
+	Closes    int          `json:"closes,omitempty"`
+	Open      bool         `json:"open"`  // ballots are accepted in the next Block
+	Votes     []PollChoice `json:"votes"` // in the order of the choices
+	Voters    int          `json:"voters"`
+	Ballots   int          `json:"ballots"` // voters who voted
+}
+
+func registerVoting(bc *BlockChain) {
+	RegisterRecord[Ballot](bc, BALLOT_SCHEMA)
+}
+
+func pollNamespace(id string) string {
+	return POLL_NAMESPACE_PREFIX + id
+}
+
+// Open the poll id, or change its spec, as organizer
+func NewPoll(organizer string, nonce uint64, id string, spec PollSpec) (Transaction, error) {
+	if len(spec.Choices) < 2 {
+		return Transaction{}, errors.New("a poll needs at least two choices")
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return NewKVWrite(organizer, nonce, pollNamespace(id), POLL_SPEC_KEY, raw), nil
+}
+
+// Let voter cast a ballot in the poll id with its nonce ballotNonce, as organizer
+func NewPollVoter(organizer string, nonce uint64, id, voter string, ballotNonce uint64) Transaction {
+	return NewKVWrite(organizer, nonce, pollNamespace(id), POLL_VOTER_PREFIX+voter, []byte(strconv.FormatUint(ballotNonce, 10)))
+}
+
+// Ballot of voter for choice in poll, nonce being the one it was registered with
+func NewBallot(voter string, nonce uint64, poll, choice string) (Transaction, error) {
+	return NewRecord(voter, nonce, BALLOT_SCHEMA, Ballot{poll, choice})
+}
+
+// Spec of the poll id in state
+func pollSpec(state *StateView, id string) (PollSpec, error) {
+	var spec PollSpec
+	raw, ok := state.GetKV(pollNamespace(id), POLL_SPEC_KEY)
+	if !ok {
+		return spec, fmt.Errorf("%w: %q", ErrUnknownPoll, id)
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return spec, fmt.Errorf("poll %v: %w", id, err)
+	}
+	return spec, nil
+}
+
+// Nonce voter was registered to vote with in the poll id, false if not a voter
+func ballotNonce(state *StateView, id, voter string) (uint64, bool) {
+	raw, ok := state.GetKV(pollNamespace(id), POLL_VOTER_PREFIX+voter)
+	if !ok {
+		return 0, false
+	}
+	nonce, err := strconv.ParseUint(string(raw), 10, 64)
+	return nonce, err == nil
+}
+
+func (b Ballot) Validate(payer string, nonce uint64, state *StateView) error {
+	spec, err := pollSpec(state, b.Poll)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(spec.Choices, b.Choice) {
+		return fmt.Errorf("%q is not a choice of poll %v", b.Choice, b.Poll)
+	}
+	if spec.Closes != 0 && state.Height()+1 > spec.Closes {
+		return fmt.Errorf("poll %v closed at height %v", b.Poll, spec.Closes)
+	}
+	registered, ok := ballotNonce(state, b.Poll, payer)
+	if !ok {
+		return fmt.Errorf("%v is not a voter of poll %v", payer, b.Poll)
+	}
+	if nonce != registered {
+		return fmt.Errorf("%v votes in poll %v with nonce %v, not %v, and votes once", payer, b.Poll, registered, nonce)
+	}
+	return nil
+}
+
+// Tally of the ballots of the poll id committed to the chain
+func (bc *BlockChain) TallyPoll(id string) (PollTally, error) {
+	view := &StateView{state: bc.state, height: bc.blocks.Len() - 1}
+	spec, err := pollSpec(view, id)
+	if err != nil {
+		return PollTally{}, err
+	}
+	if bc.pruned > 1 {
+		return PollTally{}, fmt.Errorf("%w: ballots before height %v", ErrPruned, bc.pruned)
+	}
+	tally := PollTally{
+		Poll:      id,
+		Question:  spec.Question,
+		Organizer: bc.state.namespaces[pollNamespace(id)],
+		Closes:    spec.Closes,
+		Open:      spec.Closes == 0 || view.Height()+1 <= spec.Closes,
+		Votes:     []PollChoice{},
+	}
+	for _, choice := range spec.Choices {
+		tally.Votes = append(tally.Votes, PollChoice{choice, 0})
+	}
+	for key := range bc.state.kv[pollNamespace(id)] {
+		if strings.HasPrefix(key, POLL_VOTER_PREFIX) {
+			tally.Voters++
+		}
+	}
+	choices := map[string]string{} // last choice of each voter
+	for height := 1; height < bc.blocks.Len(); height++ {
+		for _, txn := range bc.blockAt(height).data {
+			if txn.kind != TxnRecord || txn.record.schema != BALLOT_SCHEMA {
+				continue
+			}
+			if ballot, err := DecodeRecord[Ballot](txn); err == nil && ballot.Poll == id {
+				choices[txn.payer] = ballot.Choice
+			}
+		}
+	}
+	tally.Ballots = len(choices)
+	for _, choice := range choices {
+		// Choices the organizer dropped since are not counted
+		if i := slices.Index(spec.Choices, choice); i >= 0 {
+			tally.Votes[i].Votes++
+		}
+	}
+	return tally, nil
+}
+
+/*
+ * Print the tally of the poll id on bc or, when voter is set, the ballot
+ * of voter for choice with the nonce it was registered with, returning the
+ * exit code
+ */
+func runPoll(bc *BlockChain, id, voter, choice string, out *Output) int {
+	if voter != "" {
+		view := &StateView{state: bc.state, height: bc.blocks.Len() - 1}
+		nonce, ok := ballotNonce(view, id, voter)
+		if !ok {
+			log.Printf("%v is not a voter of poll %v", voter, id)
+			return 1
+		}
+		txn, err := NewBallot(voter, nonce, id, choice)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		txn = txn.WithChainID(bc.ChainID())
+		if err = invalidTxn(txn.verify()); err == nil {
+			err = bc.validate(txn, bc.state)
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		out.Note("POST the -output json form of the transaction to /txns of a node to submit it")
+		err = out.Record([][2]string{
+			{"hash", txn.Hash()},
+			{"nonce", fmt.Sprint(txn.nonce)},
+			{"poll", id},
+			{"choice", choice},
+		}, txn.toJSON())
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	tally, err := bc.TallyPoll(id)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	status := "open"
+	if !tally.Open {
+		status = fmt.Sprintf("closed at height %v", tally.Closes)
+	} else if tally.Closes != 0 {
+		status = fmt.Sprintf("open until height %v", tally.Closes)
+	}
+	if tally.Question != "" {
+		out.Note("%v", tally.Question)
+	}
+	out.Note("poll %v by %v, %v, %v ballots of %v voters", tally.Poll, tally.Organizer, status, tally.Ballots, tally.Voters)
+	rows := [][]string{}
+	for _, v := range tally.Votes {
+		rows = append(rows, []string{v.Choice, fmt.Sprint(v.Votes)})
+	}
+	if err := out.Table([]string{"choice", "votes"}, rows, tally); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	var tally PollTally
+	var err error
+	s.node.withChain(func(bc *BlockChain) { tally, err = bc.TallyPoll(r.PathValue("id")) })
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tally)
+}
@@ -0,0 +1,272 @@
+/*
+ * Write-ahead log.
+ * Committing a Block writes several objects to cold storage: the Block,
+ * its index entries, see blockindex.go, and the state root it led to; a
+ * reorganization deletes as many. Written one by one, a crash in between
+ * leaves a Block without the record of its state update, or the record of
+ * a state without its Block, or a file cut short.
+ *
+ * LoggedObjectStore writes a batch of objects all or none: it appends the
+ * whole batch to a log file and syncs it before touching the store, then
+ * applies it and empties the log. Opening the store after a crash redoes
+ * the batch the log still holds, if it was written whole, and drops it
+ * otherwise: the store ends up before or after the commit, never in
+ * between. Redoing a batch twice is harmless, its objects being written in
+ * full and deleted whether there or not.
+ *
+ * With a log, the tiered store writes each Block to cold storage as it is
+ * committed, with the state root it led to, see appendCommitted, and
+ * RecoverChain checks the state replayed from the Blocks against those
+ * roots. The state itself is never written: replaying the Blocks rebuilds
+ * it. The log guards against the process dying, the objects written by
+ * the store being left to the operating system to sync.
+ */
+package chain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Write of a batch, of an object or its deletion
+type walOp struct {
+	Key    string `json:"key"`
+	Data   []byte `json:"data,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// Store of batches of writes applied all or none
+type batchStore interface {
+	begin() // batches nest, the outermost one being applied
+	commit() error
+	abort()
+}
+
+/*
+ * Writes of nested batches, kept until the outermost one commits and
+ * applied all at once, a write outside any batch being applied alone
+ */
+type batching struct {
+	depth int                 // of the batches begun
+	batch []walOp             // writes of the open batch
+	apply func([]walOp) error // all or none
+}
+
+func (b *batching) write(op walOp) error {
+	if b.depth > 0 {
+		b.batch = append(b.batch, op)
+		return nil
+	}
+	return b.apply([]walOp{op})
+}
+
+// The writes of the open batch are read back before they are applied
+func (b *batching) read(key string, get func(string) ([]byte, error)) ([]byte, error) {
+	for i := len(b.batch) - 1; i >= 0; i-- {
+		if op := b.batch[i]; op.Key == key {
+			if op.Delete {
+				return nil, fmt.Errorf("%v: %w", key, os.ErrNotExist)
+			}
+			return op.Data, nil
+		}
+	}
+	return get(key)
+}
+
+func (b *batching) begin() {
+	b.depth++
+}
+
+// Apply the batch once the outermost one commits
+func (b *batching) commit() error {
+	if b.depth == 0 {
+		return errors.New("no batch to commit")
+	}
+	if b.depth--; b.depth > 0 || len(b.batch) == 0 {
+		return nil
+	}
+	batch := b.batch
+	b.batch = nil
+	return b.apply(batch)
+}
+
+// Drop the open batches, outer ones included
+func (b *batching) abort() {
+	b.depth, b.batch = 0, nil
+}
+
+// ObjectStore logging its writes ahead of applying them
+type LoggedObjectStore struct {
+	batching
+	store ObjectStore
+	log   *os.File
+}
+
+/*
+ * Log the writes to store in the file at path, redoing the batch a crash
+ * interrupted, if any, and returning the number of writes it held
+ */
+func OpenLoggedObjectStore(store ObjectStore, path string) (*LoggedObjectStore, int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	s := &LoggedObjectStore{store: store, log: f}
+	s.batching.apply = s.logAndApply
+	batch, err := s.readLog()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if err := s.applyLogged(batch); err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("redoing the write-ahead log: %w", err)
+	}
+	return s, len(batch), nil
+}
+
+// Batch held by the log, none if it was cut short
+func (s *LoggedObjectStore) readLog() ([]walOp, error) {
+	raw, err := io.ReadAll(io.NewSectionReader(s.log, 0, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 8 {
+		return nil, nil
+	}
+	size, sum := binary.BigEndian.Uint32(raw), binary.BigEndian.Uint32(raw[4:])
+	payload := raw[8:]
+	if uint64(len(payload)) < uint64(size) || crc32.ChecksumIEEE(payload[:size]) != sum {
+		return nil, nil
+	}
+	var batch []walOp
+	if err := json.Unmarshal(payload[:size], &batch); err != nil {
+		return nil, fmt.Errorf("decoding the write-ahead log: %w", err)
+	}
+	return batch, nil
+}
+
+// Log batch and sync the log
+func (s *LoggedObjectStore) writeLog(batch []walOp) error {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	record := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+	if _, err := s.log.WriteAt(append(record, payload...), 0); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// Apply a logged batch to the store, then empty the log
+func (s *LoggedObjectStore) applyLogged(batch []walOp) error {
+	for _, op := range batch {
+		var err error
+		if op.Delete {
+			err = deleteObject(s.store, op.Key)
+		} else {
+			err = s.store.Put(op.Key, op.Data)
+		}
+		if err != nil {
+			return fmt.Errorf("applying %v: %w", op.Key, err)
+		}
+	}
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// Log batch, then apply it
+func (s *LoggedObjectStore) logAndApply(batch []walOp) error {
+	if err := s.writeLog(batch); err != nil {
+		return fmt.Errorf("writing the write-ahead log: %w", err)
+	}
+	return s.applyLogged(batch)
+}
+
+func (s *LoggedObjectStore) Put(key string, data []byte) error {
+	return s.write(walOp{Key: key, Data: data})
+}
+
+func (s *LoggedObjectStore) Get(key string) ([]byte, error) {
+	return s.read(key, s.store.Get)
+}
+
+func (s *LoggedObjectStore) Delete(key string) error {
+	return s.write(walOp{Key: key, Delete: true})
+}
+
+func (s *LoggedObjectStore) Close() error {
+	return s.log.Close()
+}
+
+// Key of the state root the Block at height led to
+func stateKey(height int) string {
+	return fmt.Sprintf("state-%08d", height)
+}
+
+// Run f as one batch if the cold storage writes them
+func (s *TieredStore) atomically(f func() error) error {
+	bs, ok := s.cold.(batchStore)
+	if !ok {
+		return f()
+	}
+	bs.begin()
+	if err := f(); err != nil {
+		bs.abort()
+		return err
+	}
+	return bs.commit()
+}
+
+/*
+ * Append b, committed with the state root it led to. If the cold storage
+ * logs its writes, b goes there at once, along with the root: the commit
+ * is durable once it returns
+ */
+func (s *TieredStore) appendCommitted(b Block, root string) error {
+	return s.atomically(func() error {
+		if err := s.Append(b); err != nil {
+			return err
+		}
+		if _, ok := s.cold.(batchStore); !ok {
+			return nil
+		}
+		if err := s.cold.Put(stateKey(s.Len()-1), []byte(root)); err != nil {
+			return err
+		}
+		return s.Flush()
+	})
+}
+
+// Check the state replayed up to height against the root committed with its Block, if recorded
+func (bc BlockChain) checkCommittedState(cold ObjectStore, height int) error {
+	root, ok, err := committedRoot(cold, height)
+	if err != nil || !ok {
+		return err
+	}
+	if root != bc.stateRoots[height] {
+		return fmt.Errorf("%w: block %v led to %v, committed with %v", ErrStateRootMismatch, height, bc.stateRoots[height], root)
+	}
+	return nil
+}
+
+// State root committed with the Block at height, false if not recorded
+func committedRoot(cold ObjectStore, height int) (string, bool, error) {
+	root, err := cold.Get(stateKey(height))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(root), true, nil
+}
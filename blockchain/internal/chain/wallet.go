@@ -0,0 +1,297 @@
+/*
+ * Wallets hold the key of an account and sign transactions.
+ * Each wallet signs with one of three schemes: ECDSA over P-256, the
+ * default, whose public keys travel as uncompressed SEC 1 points and
+ * signatures as ASN.1, ed25519 (RFC 8032), with 32 byte keys and 64 byte
+ * deterministic signatures, or Schnorr over P-256, with the keys of ECDSA
+ * and 65 byte deterministic signatures that aggregate, see schnorr.go. A
+ * transaction names the scheme of its
+ * signatures, all of them, so verification picks the right algorithm: the
+ * swap parties, UTXO owners, cosigners and P2PK witnesses of a
+ * transaction sign with the same scheme.
+ *
+ * -compare-schemes signs and verifies with each to compare their key and
+ * signature sizes and their speed. HD wallets and encrypted messages stay
+ * on P-256. Transactions are signed through the Signer interface, which
+ * a signer process holding the key in place of the Wallet also
+ * implements, see signer.go.
+ */
+package chain
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+)
+
+// Signature schemes, numbered in the JSON and binary forms of transactions
+type SigScheme int
+
+const (
+	SchemeECDSA   SigScheme = iota // ECDSA over P-256
+	SchemeEd25519                  // ed25519
+	SchemeSchnorr                  // Schnorr over P-256, see schnorr.go
+)
+
+var SIG_SCHEMES = []SigScheme{SchemeECDSA, SchemeEd25519, SchemeSchnorr}
+
+func (scheme SigScheme) String() string {
+	switch scheme {
+	case SchemeECDSA:
+		return "ecdsa"
+	case SchemeEd25519:
+		return "ed25519"
+	case SchemeSchnorr:
+		return "schnorr"
+	}
+	return fmt.Sprintf("scheme %d", int(scheme))
+}
+
+func (scheme SigScheme) valid() bool {
+	return scheme == SchemeECDSA || scheme == SchemeEd25519 || scheme == SchemeSchnorr
+}
+
+// Scheme named name, ecdsa, ed25519 or schnorr
+func ParseSigScheme(name string) (SigScheme, error) {
+	for _, scheme := range SIG_SCHEMES {
+		if scheme.String() == name {
+			return scheme, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown signature scheme %q, expected ecdsa, ed25519 or schnorr", name)
+}
+
+type Wallet struct {
+	account string
+	key     *ecdsa.PrivateKey  // nil for ed25519 wallets
+	edKey   ed25519.PrivateKey // nil for ECDSA and Schnorr wallets
+	schnorr bool               // key signs Schnorr signatures rather than ECDSA ones
+	path    string             // derivation path of HD wallets, see hdwallet.go
+	chainID string             // only chain the wallet signs for when set, see chainid.go
+}
+
+func NewWallet(account string) (*Wallet, error) {
+	return NewSchemeWallet(account, SchemeECDSA)
+}
+
+// Wallet of account with a random key of scheme
+func NewSchemeWallet(account string, scheme SigScheme) (*Wallet, error) {
+	switch scheme {
+	case SchemeECDSA, SchemeSchnorr:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Wallet{account: account, key: key, schnorr: scheme == SchemeSchnorr}, nil
+	case SchemeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Wallet{account: account, edKey: key}, nil
+	}
+	return nil, fmt.Errorf("unknown signature scheme %v", scheme)
+}
+
+/*
+ * Wallet of account with the raw private key of scheme: the big endian
+ * P-256 scalar, or the 32 byte ed25519 seed
+ */
+func walletFromRaw(account string, scheme SigScheme, raw []byte) (*Wallet, error) {
+	switch scheme {
+	case SchemeECDSA, SchemeSchnorr:
+		key, err := parseP256Key(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &Wallet{account: account, key: key, schnorr: scheme == SchemeSchnorr}, nil
+	case SchemeEd25519:
+		if len(raw) != ed25519.SeedSize {
+			return nil, fmt.Errorf("ed25519 seed of %v bytes, expected %v", len(raw), ed25519.SeedSize)
+		}
+		return &Wallet{account: account, edKey: ed25519.NewKeyFromSeed(raw)}, nil
+	}
+	return nil, fmt.Errorf("unknown signature scheme %v", scheme)
+}
+
+func (w *Wallet) Account() string {
+	return w.account
+}
+
+func (w *Wallet) Scheme() SigScheme {
+	if w.edKey != nil {
+		return SchemeEd25519
+	}
+	if w.schnorr {
+		return SchemeSchnorr
+	}
+	return SchemeECDSA
+}
+
+// Derivation path from the seed, empty for keys generated at random
+func (w *Wallet) Path() string {
+	return w.path
+}
+
+// Public key as an uncompressed SEC 1 point, or the 32 bytes of an ed25519 key
+func (w *Wallet) PublicKey() []byte {
+	if w.edKey != nil {
+		return append([]byte{}, w.edKey.Public().(ed25519.PublicKey)...)
+	}
+	return p256PublicKey(&w.key.PublicKey)
+}
+
+// P-256 key of the big endian scalar raw, checked to be in range
+func parseP256Key(raw []byte) (*ecdsa.PrivateKey, error) {
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parseP256PublicKey(key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(raw)}, nil
+}
+
+// P-256 public key of the uncompressed SEC 1 point pubKey, checked to be on the curve
+func parseP256PublicKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	if _, err := ecdh.P256().NewPublicKey(pubKey); err != nil {
+		return nil, err
+	}
+	// A valid point is 04 | X | Y with 32 byte coordinates
+	x := new(big.Int).SetBytes(pubKey[1:33])
+	y := new(big.Int).SetBytes(pubKey[33:65])
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// Uncompressed SEC 1 point of the P-256 key pub
+func p256PublicKey(pub *ecdsa.PublicKey) []byte {
+	key, err := pub.ECDH()
+	if err != nil {
+		return nil
+	}
+	return key.Bytes()
+}
+
+// Raw private key, see walletFromRaw
+func (w *Wallet) rawKey() ([]byte, error) {
+	if w.edKey != nil {
+		return w.edKey.Seed(), nil
+	}
+	key, err := w.key.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+// Signature of digest with the scheme of the wallet
+func (w *Wallet) Sign(digest []byte) ([]byte, error) {
+	if w.edKey != nil {
+		return ed25519.Sign(w.edKey, digest), nil
+	}
+	if w.schnorr {
+		return schnorrSign(w.key, digest)
+	}
+	return ecdsa.SignASN1(rand.Reader, w.key, digest)
+}
+
+func verifySignature(scheme SigScheme, pubKey, digest, sig []byte) bool {
+	switch scheme {
+	case SchemeECDSA:
+		pub, err := parseP256PublicKey(pubKey)
+		if err != nil {
+			return false
+		}
+		return ecdsa.VerifyASN1(pub, digest, sig)
+	case SchemeEd25519:
+		// ed25519.Verify panics on keys of another size
+		return len(pubKey) == ed25519.PublicKeySize && ed25519.Verify(pubKey, digest, sig)
+	case SchemeSchnorr:
+		return verifyAggregate([][]byte{pubKey}, digest, sig)
+	}
+	return false
+}
+
+// Sign the transaction's signatures with scheme, before signing it
+func (txn Transaction) WithScheme(scheme SigScheme) Transaction {
+	txn.scheme = scheme
+	return txn
+}
+
+// Signature of txn by w, which must sign with the scheme of the transaction
+func (w *Wallet) SignTxn(txn Transaction) ([]byte, error) {
+	if w.Scheme() != txn.scheme {
+		return nil, fmt.Errorf("%v wallet of %v cannot sign a transaction of scheme %v", w.Scheme(), w.account, txn.scheme)
+	}
+	if w.chainID != "" && txn.chainID != w.chainID {
+		return nil, fmt.Errorf("wallet of %v signs for chain %q only, not %q", w.account, w.chainID, txn.chainID)
+	}
+	return w.Sign(txn.digest())
+}
+
+type SchemeComparison struct {
+	Scheme     SigScheme     `json:"scheme"`
+	PublicKey  int           `json:"publicKey"` // bytes
+	Signature  int           `json:"signature"` // bytes, the longest seen for ASN.1 ECDSA
+	SignTime   time.Duration `json:"signNs"`    // average
+	VerifyTime time.Duration `json:"verifyNs"`  // average
+}
+
+// Sign and verify rounds digests with a fresh key of every scheme
+func CompareSchemes(rounds int) ([]SchemeComparison, error) {
+	results := []SchemeComparison{}
+	for _, scheme := range SIG_SCHEMES {
+		w, err := NewSchemeWallet("bench", scheme)
+		if err != nil {
+			return nil, err
+		}
+		c := SchemeComparison{Scheme: scheme, PublicKey: len(w.PublicKey())}
+		digests, sigs := make([][]byte, rounds), make([][]byte, rounds)
+		start := time.Now()
+		for i := range rounds {
+			digest := sha256.Sum256(fmt.Appendf(nil, "bench|%v", i))
+			digests[i] = digest[:]
+			if sigs[i], err = w.Sign(digests[i]); err != nil {
+				return nil, err
+			}
+			c.Signature = max(c.Signature, len(sigs[i]))
+		}
+		c.SignTime = time.Since(start) / time.Duration(rounds)
+		start = time.Now()
+		for i := range rounds {
+			if !verifySignature(scheme, w.PublicKey(), digests[i], sigs[i]) {
+				return nil, fmt.Errorf("%v signature %v does not verify", scheme, i)
+			}
+		}
+		c.VerifyTime = time.Since(start) / time.Duration(rounds)
+		results = append(results, c)
+	}
+	return results, nil
+}
+
+// Print the comparison of the signature schemes over rounds signatures, returning the exit code
+func runCompareSchemes(rounds int, out *Output) int {
+	results, err := CompareSchemes(rounds)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	rows := [][]string{}
+	for _, c := range results {
+		rows = append(rows, []string{c.Scheme.String(), fmt.Sprint(c.PublicKey), fmt.Sprint(c.Signature), c.SignTime.String(), c.VerifyTime.String()})
+	}
+	if err := out.Table([]string{"scheme", "public key", "signature", "sign", "verify"}, rows, results); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
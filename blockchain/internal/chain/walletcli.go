@@ -0,0 +1,199 @@
+/*
+ * Wallet commands with offline signing.
+ * A cold wallet keeps its key on a machine never connected to a network:
+ * it signs there, and the signed transaction is carried to an online
+ * machine, eg. on a USB stick, to be broadcast. The wallet commands split
+ * the two steps, after the other flags:
+ *
+ *	wallet new [-scheme ecdsa] <account>   create an account in -keystore
+ *	wallet list                            list the accounts of -keystore
+ *	wallet sign -from alice -to bob -amount 5 -nonce 0 [-fee ..]
+ *	            [-asset ..] [-chain-id ..] [-out txn.hex]
+ *	                                       sign a transfer, reading no
+ *	                                       chain and contacting no node
+ *	wallet broadcast -node http://.. txn.hex
+ *	                                       submit a signed transfer
+ *
+ * Signing knows nothing of the chain, so the nonce is given, see GET
+ * /mempool?account=.. for the next one, and so is the chain ID of a chain
+ * under replay protection, see chainid.go. The transfer carries a P2PK
+ * script, the public key of the payer followed by CHECKSIG, and the
+ * signature of the payer in its witness, see script.go: changing anything
+ * it signs after the fact fails the script. The signed transaction is
+ * written as the hex of its binary encoding, see codec.go, a single line
+ * to copy by hand if need be; broadcast also takes its JSON form.
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Transfer from the account of w signed by w, see above
+func signOffline(w *Wallet, to, asset string, amt, fee Amount, nonce uint64, chainID string) (Transaction, error) {
+	txn := Transaction{payer: w.Account(), payee: to, asset: asset, amt: amt, fee: fee, nonce: nonce}.
+		WithScheme(w.Scheme()).
+		WithChainID(chainID).
+		WithScript(fmt.Sprintf("0x%x CHECKSIG", w.PublicKey()))
+	if err := invalidTxn(txn.verify()); err != nil {
+		return Transaction{}, err
+	}
+	if err := txn.SignScript(w); err != nil {
+		return Transaction{}, err
+	}
+	return txn, nil
+}
+
+// Signed transaction of a file written by wallet sign, hex or JSON
+func readSignedTxn(path string) (Transaction, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Transaction{}, err
+	}
+	raw = bytes.TrimSpace(raw)
+	if !isJSON(raw) {
+		if raw, err = hex.DecodeString(string(raw)); err != nil {
+			return Transaction{}, fmt.Errorf("%v: neither hex nor JSON: %w", path, err)
+		}
+	}
+	txn, err := DecodeTxn(raw)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("%v: %w", path, err)
+	}
+	return txn, nil
+}
+
+// Run the wallet command of args on the keystore at dir, returning the exit code
+func runWallet(args []string, dir string, out *Output) int {
+	if len(args) == 0 {
+		log.Print("wallet: missing command, new, list, sign or broadcast")
+		return 2
+	}
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "new":
+		err = walletNew(args, dir, out)
+	case "list":
+		return runKeystore(dir, "", SchemeECDSA, out)
+	case "sign":
+		err = walletSign(args, dir, out)
+	case "broadcast":
+		err = walletBroadcast(args, out)
+	default:
+		log.Printf("wallet: unknown command %q, expected new, list, sign or broadcast", cmd)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		log.Printf("wallet %v: %v", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func walletNew(args []string, dir string, out *Output) error {
+	fs := flag.NewFlagSet("wallet new", flag.ContinueOnError)
+	scheme := fs.String("scheme", "ecdsa", "signature scheme of the account, ecdsa, ed25519 or schnorr")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected the account to create")
+	}
+	accountScheme, err := ParseSigScheme(*scheme)
+	if err != nil {
+		return err
+	}
+	if runKeystore(dir, fs.Arg(0), accountScheme, out) != 0 {
+		return errors.New("account not created")
+	}
+	return nil
+}
+
+func walletSign(args []string, dir string, out *Output) error {
+	fs := flag.NewFlagSet("wallet sign", flag.ContinueOnError)
+	from := fs.String("from", "", "-keystore account paying, passphrase from $TOYCHAIN_PASSPHRASE or stdin")
+	to := fs.String("to", "", "account paid")
+	amount := fs.String("amount", "0", "amount paid")
+	asset := fs.String("asset", NATIVE_ASSET, "asset paid, the chain's coin if empty")
+	fee := fs.String("fee", "0", "fee paid to the miner, in the chain's coin")
+	nonce := fs.Int("nonce", -1, "nonce of the transfer, the next one of the payer")
+	chainID := fs.String("chain-id", "", "chain the transfer is only valid on, required on chains with replay protection")
+	outPath := fs.String("out", "", "file the signed transfer is written to, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *nonce < 0 {
+		return errors.New("-from, -to and -nonce are required")
+	}
+	ks, err := NewKeystore(dir)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassphrase()
+	if err != nil {
+		return err
+	}
+	w, err := ks.Unlock(*from, passphrase)
+	if err != nil {
+		return err
+	}
+	amt, err := ParseAmount(*amount)
+	if err != nil {
+		return fmt.Errorf("-amount: %w", err)
+	}
+	paid, err := ParseAmount(*fee)
+	if err != nil {
+		return fmt.Errorf("-fee: %w", err)
+	}
+	txn, err := signOffline(w, *to, *asset, amt, paid, uint64(*nonce), *chainID)
+	if err != nil {
+		return err
+	}
+	blob := hex.EncodeToString(EncodeTxn(txn)) + "\n"
+	if *outPath == "" {
+		_, err = fmt.Print(blob)
+		return err
+	}
+	if err := os.WriteFile(*outPath, []byte(blob), 0o600); err != nil {
+		return err
+	}
+	out.Note("wallet broadcast -node <url> %v to submit it", *outPath)
+	return out.Record([][2]string{
+		{"hash", txn.Hash()},
+		{"payer", txn.payer},
+		{"payee", txn.payee},
+		{"amount", fmt.Sprint(txn.amt) + assetSuffix(txn.asset)},
+		{"nonce", fmt.Sprint(txn.nonce)},
+	}, txn.toJSON())
+}
+
+func walletBroadcast(args []string, out *Output) error {
+	fs := flag.NewFlagSet("wallet broadcast", flag.ContinueOnError)
+	node := fs.String("node", "", "API URL of the node submitted to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *node == "" || fs.NArg() != 1 {
+		return errors.New("expected -node and the file of the signed transfer")
+	}
+	txn, err := readSignedTxn(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var reply jsonTxn
+	if err := newPeerClient(*node).send(http.MethodPost, "/txns", txn.toJSON(), &reply); err != nil {
+		return err
+	}
+	out.Note("GET /txns/%v/status of the node to follow it", txn.Hash())
+	return out.Record([][2]string{{"hash", txn.Hash()}, {"payer", txn.payer}, {"nonce", fmt.Sprint(txn.nonce)}}, reply)
+}
@@ -0,0 +1,189 @@
+/*
+ * State watches.
+ * Every committed Block carries the delta it made to the state, and a
+ * Watch filters those deltas down to the balances and key-value entries a
+ * client cares about, so it is told exactly what changed and how. A Block
+ * dropped by a reorganization, see reorg.go, is reported with the changes
+ * undoing it, before those of the Blocks replacing it.
+ */
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	ChangeBalance = "balance"
+	ChangeKV      = "kv"
+)
+
+type StateChange struct {
+	Kind      string `json:"kind"` // ChangeBalance or ChangeKV
+	Account   string `json:"account,omitempty"`
+	Asset     string `json:"asset,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Old       any    `json:"old"` // balance, or value (nil if unset)
+	New       any    `json:"new"`
+}
+
+// What to watch; a change matching any of the lists is reported
+type Watch struct {
+	Accounts   []string // balances of these accounts, in every asset
+	Namespaces []string // every key of these namespaces
+	Keys       []string // single keys, as namespace/key
+}
+
+type WatchNotification struct {
+	BlockHash string        `json:"blockHash"`
+	Reverted  bool          `json:"reverted,omitempty"` // the Block was dropped by a reorganization
+	Changes   []StateChange `json:"changes"`
+}
+
+// Balances and key-value entries differing between old and new
+func diffStates(old, new *State) []StateChange {
+	changes := []StateChange{}
+	accounts := make(map[string]bool)
+	for account := range old.balances {
+		accounts[account] = true
+	}
+	for account := range new.balances {
+		accounts[account] = true
+	}
+	for _, account := range sortedKeys(accounts) {
+		assets := make(map[string]bool)
+		for asset := range old.balances[account] {
+			assets[asset] = true
+		}
+		for asset := range new.balances[account] {
+			assets[asset] = true
+		}
+		for _, asset := range sortedKeys(assets) {
+			before, after := old.Balance(account, asset), new.Balance(account, asset)
+			if before != after {
+				changes = append(changes, StateChange{Kind: ChangeBalance, Account: account, Asset: asset, Old: before, New: after})
+			}
+		}
+	}
+	namespaces := make(map[string]bool)
+	for namespace := range old.kv {
+		namespaces[namespace] = true
+	}
+	for namespace := range new.kv {
+		namespaces[namespace] = true
+	}
+	for _, namespace := range sortedKeys(namespaces) {
+		keys := make(map[string]bool)
+		for key := range old.kv[namespace] {
+			keys[key] = true
+		}
+		for key := range new.kv[namespace] {
+			keys[key] = true
+		}
+		for _, key := range sortedKeys(keys) {
+			before, after := old.kv[namespace][key], new.kv[namespace][key]
+			if !bytes.Equal(before, after) {
+				changes = append(changes, StateChange{Kind: ChangeKV, Namespace: namespace, Key: key, Old: before, New: after})
+			}
+		}
+	}
+	return changes
+}
+
+func (w Watch) matches(c StateChange) bool {
+	contains := func(list []string, s string) bool {
+		for _, item := range list {
+			if item == s {
+				return true
+			}
+		}
+		return false
+	}
+	if c.Kind == ChangeBalance {
+		return contains(w.Accounts, c.Account)
+	}
+	return contains(w.Namespaces, c.Namespace) || contains(w.Keys, c.Namespace+"/"+c.Key)
+}
+
+/*
+ * Get a notification for every committed or reverted Block changing
+ * something w watches. The returned function cancels the watch and closes
+ * the channel
+ */
+func (n *Node) Watch(w Watch) (<-chan WatchNotification, func()) {
+	committed, cancelCommitted := n.Subscribe(NewBlock)
+	reverted, cancelReverted := n.Subscribe(RevertedBlock)
+	notifications := make(chan WatchNotification, EVENT_BUFFER_SIZE)
+	go func() {
+		defer close(notifications)
+		for {
+			var ev Event
+			var ok bool
+			select {
+			case ev, ok = <-committed:
+			case ev, ok = <-reverted:
+			}
+			if !ok {
+				return
+			}
+			notification := WatchNotification{BlockHash: ev.Block.hash, Reverted: ev.Type == RevertedBlock}
+			for _, c := range ev.Delta {
+				if w.matches(c) {
+					notification.Changes = append(notification.Changes, c)
+				}
+			}
+			if len(notification.Changes) == 0 {
+				continue
+			}
+			select {
+			case notifications <- notification:
+			default:
+			}
+		}
+	}()
+	return notifications, func() {
+		cancelCommitted()
+		cancelReverted()
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// Stream notifications to a WebSocket client, see Watch
+// GET /watch?accounts=a,b&namespaces=ns&keys=ns/key
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	watch := Watch{
+		Accounts:   splitList(query.Get("accounts")),
+		Namespaces: splitList(query.Get("namespaces")),
+		Keys:       splitList(query.Get("keys")),
+	}
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer ws.Close()
+
+	notifications, cancel := s.node.Watch(watch)
+	defer cancel()
+	for {
+		select {
+		case <-ws.Done():
+			return
+		case notification := <-notifications:
+			payload, _ := json.Marshal(notification)
+			if err := ws.WriteText(payload); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,357 @@
+/*
+ * Webhooks.
+ * A Node POSTs every Block it commits, as JSON, to the webhook URLs
+ * registered with AddWebhook or -webhooks, so a chat bot or a grading
+ * script follows the chain without polling it. Blocks dropped by a
+ * reorganization, see reorg.go, are posted as reverted-block events.
+ *
+ * With a secret the body is signed with HMAC-SHA256, as GitHub signs its
+ * webhooks: the X-Toychain-Signature header holds sha256= and the hex MAC,
+ * which the receiver recomputes over the raw body, see VerifyWebhook. A
+ * delivery not answered with a 2xx is attempted again, up to
+ * WEBHOOK_ATTEMPTS times, waiting twice as long each time, then dropped.
+ * Each webhook delivers its events in order on its own, so a slow receiver
+ * delays no other; past WEBHOOK_QUEUE events waiting for it, new ones are
+ * dropped.
+ *
+ * Webhooks are managed by the operator through the admin API, see
+ * admin.go, as peers are: a client registering one would have the node
+ * post to any address it names. Unless SetPrivateWebhooks allows them, eg.
+ * for a receiver on the same machine, webhooks may not target loopback,
+ * link-local or private addresses, such as a cloud metadata service: the
+ * URL is refused if its host is one, and a delivery if its host resolves
+ * to one when it is made.
+ *
+ *	GET    /admin/webhooks                           webhooks and their deliveries
+ *	POST   /admin/webhooks {"url": .., "secret": ..} add a webhook
+ *	DELETE /admin/webhooks?url=..                    remove a webhook
+ */
+package chain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Events posted to webhooks
+const (
+	WEBHOOK_BLOCK          = "block"
+	WEBHOOK_REVERTED_BLOCK = "reverted-block"
+)
+
+const (
+	WEBHOOK_ATTEMPTS    = 4                // deliveries of an event before it is dropped
+	WEBHOOK_RETRY_DELAY = time.Second      // before the second delivery, doubling after
+	WEBHOOK_TIMEOUT     = 10 * time.Second // of a delivery
+	WEBHOOK_QUEUE       = 64               // events waiting for a webhook before new ones are dropped
+)
+
+// Headers of the deliveries
+const (
+	WEBHOOK_EVENT_HEADER     = "X-Toychain-Event"
+	WEBHOOK_SIGNATURE_HEADER = "X-Toychain-Signature"
+)
+
+// Body posted to webhooks
+type WebhookEvent struct {
+	Event   string    `json:"event"` // WEBHOOK_BLOCK or WEBHOOK_REVERTED_BLOCK
+	ChainID string    `json:"chainId"`
+	Height  int       `json:"height"`
+	Block   jsonBlock `json:"block"`
+}
+
+type WebhookInfo struct {
+	URL       string `json:"url"`
+	Signed    bool   `json:"signed"`
+	Delivered int    `json:"delivered"`
+	Dropped   int    `json:"dropped"`             // events given up on, or with the queue full
+	LastError string `json:"lastError,omitempty"` // of the last failed delivery
+}
+
+type webhookDelivery struct {
+	event string
+	body  []byte
+}
+
+type webhook struct {
+	info   WebhookInfo
+	secret string
+	queue  chan webhookDelivery
+	stop   chan struct{} // closed when the webhook is removed
+}
+
+// Webhooks of a Node, fed by a loop following its events
+type webhooks struct {
+	mu     sync.Mutex
+	hooks  map[string]*webhook
+	order  []string // URLs in the order they were added
+	client *http.Client
+}
+
+// Value of the WEBHOOK_SIGNATURE_HEADER of body signed with secret
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Whether signature, the WEBHOOK_SIGNATURE_HEADER of a delivery, signs body with secret
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(SignWebhook(secret, body)))
+}
+
+/*
+ * Post the committed Blocks to target, an http or https URL, signed with
+ * secret unless empty. Adding a webhook again replaces its secret
+ */
+func (n *Node) AddWebhook(target, secret string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%w: %q is not an http or https URL", ErrInvalidWebhook, target)
+	}
+	if !n.allowsPrivateWebhooks() && privateHost(u.Hostname()) {
+		return fmt.Errorf("%w: %v is a loopback, link-local or private address", ErrInvalidWebhook, u.Hostname())
+	}
+	n.mu.Lock()
+	wh := n.webhooks
+	if wh == nil {
+		wh = &webhooks{hooks: map[string]*webhook{}, client: webhookClient(n.allowsPrivateWebhooks)}
+		n.webhooks = wh
+		// Subscribed for the life of the Node
+		blocks, _ := n.Subscribe(NewBlock)
+		reverted, _ := n.Subscribe(RevertedBlock)
+		go wh.run(blocks, reverted, n.bc.ChainID())
+	}
+	n.mu.Unlock()
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	if hook := wh.hooks[target]; hook != nil {
+		hook.secret, hook.info.Signed = secret, secret != ""
+		return nil
+	}
+	hook := &webhook{
+		info:   WebhookInfo{URL: target, Signed: secret != ""},
+		secret: secret,
+		queue:  make(chan webhookDelivery, WEBHOOK_QUEUE),
+		stop:   make(chan struct{}),
+	}
+	wh.hooks[target] = hook
+	wh.order = append(wh.order, target)
+	go wh.deliver(hook)
+	log.Printf("webhooks: added %v", target)
+	return nil
+}
+
+// Let webhooks target loopback, link-local and private addresses, refused otherwise, see above
+func (n *Node) SetPrivateWebhooks(allow bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.privateWebhooks = allow
+}
+
+func (n *Node) allowsPrivateWebhooks() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.privateWebhooks
+}
+
+// Whether host, a name or an address, is a loopback, link-local or private address
+func privateHost(host string) bool {
+	if strings.EqualFold(strings.TrimSuffix(host, "."), "localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && privateAddr(addr)
+}
+
+func privateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast()
+}
+
+/*
+ * Client of the deliveries, refusing to connect to private addresses
+ * unless private says so, whatever the host of the URL resolves to
+ */
+func webhookClient(private func() bool) *http.Client {
+	dialer := &net.Dialer{Timeout: WEBHOOK_TIMEOUT}
+	dialer.Control = func(network, address string, _ syscall.RawConn) error {
+		if ap, err := netip.ParseAddrPort(address); err == nil && privateAddr(ap.Addr()) && !private() {
+			return fmt.Errorf("%w: %v is a loopback, link-local or private address", ErrInvalidWebhook, ap.Addr())
+		}
+		return nil
+	}
+	// No proxy, which would connect in place of the dialer
+	return &http.Client{Timeout: WEBHOOK_TIMEOUT, Transport: &http.Transport{DialContext: dialer.DialContext}}
+}
+
+// Stop posting to target
+func (n *Node) RemoveWebhook(target string) error {
+	n.mu.Lock()
+	wh := n.webhooks
+	n.mu.Unlock()
+	if wh == nil {
+		return fmt.Errorf("%w: %v", ErrUnknownWebhook, target)
+	}
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	hook := wh.hooks[target]
+	if hook == nil {
+		return fmt.Errorf("%w: %v", ErrUnknownWebhook, target)
+	}
+	close(hook.stop)
+	delete(wh.hooks, target)
+	wh.order = slices.DeleteFunc(wh.order, func(u string) bool { return u == target })
+	log.Printf("webhooks: removed %v", target)
+	return nil
+}
+
+// Webhooks of the Node in the order they were added, without their secrets
+func (n *Node) Webhooks() []WebhookInfo {
+	infos := []WebhookInfo{}
+	n.mu.Lock()
+	wh := n.webhooks
+	n.mu.Unlock()
+	if wh == nil {
+		return infos
+	}
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	for _, target := range wh.order {
+		infos = append(infos, wh.hooks[target].info)
+	}
+	return infos
+}
+
+// Queue the committed and reverted Blocks of the chain of ID chainID for every webhook
+func (wh *webhooks) run(blocks, reverted <-chan Event, chainID string) {
+	for {
+		var ev Event
+		event := WEBHOOK_BLOCK
+		select {
+		case ev = <-blocks:
+		case ev = <-reverted:
+			event = WEBHOOK_REVERTED_BLOCK
+		}
+		body, err := json.Marshal(WebhookEvent{event, chainID, ev.Height, ev.Block.toJSON()})
+		if err != nil {
+			log.Printf("webhooks: %v", err)
+			continue
+		}
+		wh.mu.Lock()
+		for _, hook := range wh.hooks {
+			select {
+			case hook.queue <- webhookDelivery{event, body}:
+			default:
+				hook.info.Dropped++
+				hook.info.LastError = "queue full"
+			}
+		}
+		wh.mu.Unlock()
+	}
+}
+
+// Deliver the events queued for hook in order, until it is removed
+func (wh *webhooks) deliver(hook *webhook) {
+	for {
+		var d webhookDelivery
+		select {
+		case <-hook.stop:
+			return
+		case d = <-hook.queue:
+		}
+		delay := WEBHOOK_RETRY_DELAY
+		err := wh.post(hook, d)
+		for attempt := 2; err != nil && attempt <= WEBHOOK_ATTEMPTS; attempt++ {
+			select {
+			case <-hook.stop:
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			err = wh.post(hook, d)
+		}
+		wh.mu.Lock()
+		if err != nil {
+			hook.info.Dropped++
+			hook.info.LastError = err.Error()
+			log.Printf("webhooks: dropped %v event for %v: %v", d.event, hook.info.URL, err)
+		} else {
+			hook.info.Delivered++
+		}
+		wh.mu.Unlock()
+	}
+}
+
+func (wh *webhooks) post(hook *webhook, d webhookDelivery) error {
+	wh.mu.Lock()
+	secret := hook.secret
+	wh.mu.Unlock()
+	req, err := http.NewRequest(http.MethodPost, hook.info.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WEBHOOK_EVENT_HEADER, d.event)
+	if secret != "" {
+		req.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhook(secret, d.body))
+	}
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %v: %v", hook.info.URL, resp.Status)
+	}
+	return nil
+}
+
+// GET /admin/webhooks
+func (s *AdminServer) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.node.Webhooks())
+}
+
+// POST /admin/webhooks
+func (s *AdminServer) handleAddWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL    string `json:"url"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.node.AddWebhook(strings.TrimSpace(req.URL), req.Secret); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.node.Webhooks())
+}
+
+// DELETE /admin/webhooks
+func (s *AdminServer) handleRemoveWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := s.node.RemoveWebhook(r.URL.Query().Get("url")); err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.node.Webhooks())
+}
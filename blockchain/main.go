@@ -0,0 +1,12 @@
+/*
+ * The toy_blockchain command: a node, its CLI tools and simulations, all
+ * picked by flags, see internal/chain/toy_blockchain.go. The packages of
+ * API.md are the library for other programs.
+ */
+package main
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+func main() {
+	chain.Main()
+}
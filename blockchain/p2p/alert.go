@@ -0,0 +1,12 @@
+// Double spend alerts, see internal/chain/alert.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	ALERT_LOG_SIZE = chain.ALERT_LOG_SIZE // alerts kept by a node
+	ALERT_MAX_AGE  = chain.ALERT_MAX_AGE  // older alerts are dropped, which ends their flood
+)
+
+type Alert = chain.Alert
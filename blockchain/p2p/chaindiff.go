@@ -0,0 +1,21 @@
+// Chain comparison, see internal/chain/chaindiff.go
+
+package p2p
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+// Blocks past the common ancestor listed
+const DIFF_MAX_BLOCKS = chain.DIFF_MAX_BLOCKS
+
+// Blocks of two chains at a height past their common ancestor
+type BlockDiff = chain.BlockDiff
+
+type ChainDiff = chain.ChainDiff
+
+// Compare chain a with chain b
+func DiffChains(a, b *core.BlockChain) ChainDiff {
+	return chain.DiffChains(a, b)
+}
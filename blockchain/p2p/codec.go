@@ -0,0 +1,43 @@
+// Binary encoding of Blocks and transactions, see internal/chain/codec.go
+
+package p2p
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	// Media type of the binary encoding
+	BINARY_CONTENT_TYPE = chain.BINARY_CONTENT_TYPE
+
+	BINARY_VERSION = chain.BINARY_VERSION
+)
+
+func EncodeBlock(b core.Block) []byte {
+	return chain.EncodeBlock(b)
+}
+
+// Block of the binary encoding or JSON raw
+func DecodeBlock(raw []byte) (core.Block, error) {
+	return chain.DecodeBlock(raw)
+}
+
+// BinaryBlocks message of blocks
+func EncodeBlocks(blocks []core.Block) []byte {
+	return chain.EncodeBlocks(blocks)
+}
+
+// Blocks of the binary encoding or JSON array raw
+func DecodeBlocks(raw []byte) ([]core.Block, error) {
+	return chain.DecodeBlocks(raw)
+}
+
+func EncodeTxn(txn core.Transaction) []byte {
+	return chain.EncodeTxn(txn)
+}
+
+// Transaction of the binary encoding or JSON raw
+func DecodeTxn(raw []byte) (core.Transaction, error) {
+	return chain.DecodeTxn(raw)
+}
@@ -0,0 +1,38 @@
+// Compact Block relay, see internal/chain/compactblock.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Bytes of the hash of a transaction standing for it in a compact Block
+	SHORT_ID_BYTES = chain.SHORT_ID_BYTES
+
+	// Compact Blocks a node keeps aside waiting for their missing transactions
+	MAX_PARTIAL_BLOCKS = chain.MAX_PARTIAL_BLOCKS
+
+	BLOCK_RELAY_COMPACT = chain.BLOCK_RELAY_COMPACT // the default
+	BLOCK_RELAY_FULL    = chain.BLOCK_RELAY_FULL
+	BLOCK_RELAY_OFF     = chain.BLOCK_RELAY_OFF
+	BLOCK_ACCEPTED      = chain.BLOCK_ACCEPTED    // appended
+	BLOCK_KNOWN         = chain.BLOCK_KNOWN       // already on the chain
+	BLOCK_UNCONNECTED   = chain.BLOCK_UNCONNECTED // not extending the chain, left to sync
+	BLOCK_MISSING       = chain.BLOCK_MISSING     // the transactions at Missing are wanted
+	BLOCK_WHOLE         = chain.BLOCK_WHOLE       // the Block is wanted whole
+
+	// Blocks relayed by each TestNet of -block-relay-sim
+	BLOCK_RELAY_SIM_BLOCKS = chain.BLOCK_RELAY_SIM_BLOCKS
+)
+
+type BlockRelayStats = chain.BlockRelayStats
+
+type BlockRelaySimConfig = chain.BlockRelaySimConfig
+
+/*
+ * Relay BLOCK_RELAY_SIM_BLOCKS Blocks of MAX_TXNS_PER_BLOCK transactions
+ * around a ring of TestNet nodes, each pushing to the next one, node 0
+ * mining them all, and return the stats of all nodes
+ */
+func SimulateBlockRelay(cfg BlockRelaySimConfig) (BlockRelayStats, error) {
+	return chain.SimulateBlockRelay(cfg)
+}
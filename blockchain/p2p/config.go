@@ -0,0 +1,16 @@
+// Node configuration, see internal/chain/config.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Prefix of the environment variables setting flags
+const CONFIG_ENV_PREFIX = chain.CONFIG_ENV_PREFIX
+
+// Flags naming the files of a node, relative to -data-dir when set
+var DATA_DIR_FLAGS = chain.DATA_DIR_FLAGS
+
+// Flag values of the configuration file at path, by flag name
+func ReadConfig(path string) (map[string]string, error) {
+	return chain.ReadConfig(path)
+}
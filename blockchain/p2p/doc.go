@@ -0,0 +1,7 @@
+/*
+ * Package p2p is the node of the toy chain and how it talks to its peers:
+ * the Node and its miner, peers, Noise transport, block and transaction
+ * relay, the binary codec, sync and reorgs, light clients, webhooks, event
+ * sinks and the event bus.
+ */
+package p2p
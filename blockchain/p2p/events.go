@@ -0,0 +1,27 @@
+// In-process event bus for chain activity, see internal/chain/events.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Events buffered per subscriber before new events are dropped
+	EVENT_BUFFER_SIZE = chain.EVENT_BUFFER_SIZE
+
+	NewBlock         = chain.NewBlock         // a Block was committed to the chain
+	NewTxn           = chain.NewTxn           // a transaction was admitted into the Mempool
+	NewAlert         = chain.NewAlert         // a double spend was seen, see alert.go
+	RevertedBlock    = chain.RevertedBlock    // a Block was dropped by a reorganization, see reorg.go
+	RevertedTxn      = chain.RevertedTxn      // a transaction was undone by a reorganization
+	TxnStatusChanged = chain.TxnStatusChanged // a transaction took a step of its lifecycle, see txnstatus.go
+)
+
+type EventType = chain.EventType
+
+type Event = chain.Event
+
+type EventBus = chain.EventBus
+
+func NewEventBus() *EventBus {
+	return chain.NewEventBus()
+}
@@ -0,0 +1,32 @@
+// Event sinks, see internal/chain/eventsinks.go
+
+package p2p
+
+import (
+	"net/url"
+
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	EVENT_SINK_PREFIX      = chain.EVENT_SINK_PREFIX      // of the subjects and topics, unless the URL has a path
+	EVENT_SINK_ATTEMPTS    = chain.EVENT_SINK_ATTEMPTS    // publishes of a message before it is dropped
+	EVENT_SINK_RETRY_DELAY = chain.EVENT_SINK_RETRY_DELAY // before the second publish, doubling after
+	EVENT_SINK_TIMEOUT     = chain.EVENT_SINK_TIMEOUT     // of a connection or a publish
+	EVENT_SINK_QUEUE       = chain.EVENT_SINK_QUEUE       // events waiting for a sink before new ones are dropped
+	KAFKA_PRODUCE          = chain.KAFKA_PRODUCE
+	KAFKA_PRODUCE_VERSION  = chain.KAFKA_PRODUCE_VERSION // the first with record batches
+	KAFKA_METADATA         = chain.KAFKA_METADATA
+	KAFKA_METADATA_VERSION = chain.KAFKA_METADATA_VERSION // the first asking to create missing topics
+	KAFKA_MAX_RESPONSE     = chain.KAFKA_MAX_RESPONSE
+)
+
+// Client of a message broker
+type EventSink = chain.EventSink
+
+type EventSinkInfo = chain.EventSinkInfo
+
+// Client of the broker of u, a nats:// or kafka:// URL
+func NewEventSink(u *url.URL) (EventSink, error) {
+	return chain.NewEventSink(u)
+}
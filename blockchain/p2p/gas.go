@@ -0,0 +1,8 @@
+// Gas accounting, see internal/chain/gas.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Max gas consumed by the transactions of a Block
+const BLOCK_GAS_LIMIT = chain.BLOCK_GAS_LIMIT
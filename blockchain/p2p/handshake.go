@@ -0,0 +1,18 @@
+// Peer handshake, see internal/chain/handshake.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	P2P_PROTOCOL_VERSION      = chain.P2P_PROTOCOL_VERSION      // of the node API nodes talk to each other over
+	MIN_PEER_PROTOCOL_VERSION = chain.MIN_PEER_PROTOCOL_VERSION // oldest version of peers a node talks to
+	HELLO_PROTOCOL_HEADER     = chain.HELLO_PROTOCOL_HEADER
+	HELLO_GENESIS_HEADER      = chain.HELLO_GENESIS_HEADER
+	HELLO_NODE_HEADER         = chain.HELLO_NODE_HEADER
+)
+
+// Genesis hash greeting the peers the process sends requests to, none unless set
+func SetNodeChain(genesisHash string) {
+	chain.SetNodeChain(genesisHash)
+}
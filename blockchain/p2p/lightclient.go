@@ -0,0 +1,17 @@
+// Light client, or Simplified Payment Verification, see internal/chain/lightclient.go
+
+package p2p
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+type LightClient = chain.LightClient
+
+type AccountScan = chain.AccountScan
+
+// Light client of the chain of genesis, downloading headers and proofs from the node API at peer
+func NewLightClient(genesis core.Genesis, peer string) *LightClient {
+	return chain.NewLightClient(genesis, peer)
+}
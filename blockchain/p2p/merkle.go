@@ -0,0 +1,13 @@
+// Merkle trees of transaction hashes, see internal/chain/merkle.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Sibling of a node on the path from a leaf to the root
+type MerkleStep = chain.MerkleStep
+
+// Check proof leads from the transaction hash leaf to root
+func VerifyMerkleProof(leaf, root string, proof []MerkleStep) bool {
+	return chain.VerifyMerkleProof(leaf, root, proof)
+}
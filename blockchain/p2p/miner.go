@@ -0,0 +1,26 @@
+// Background mining, see internal/chain/miner.go
+
+package p2p
+
+import (
+	"time"
+
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	MINER_MIN_TXNS = chain.MINER_MIN_TXNS // pending transactions filling a Block of the legacy limits
+	MINER_MAX_WAIT = chain.MINER_MAX_WAIT // wait before mining a partial Block
+)
+
+type Miner = chain.Miner
+
+// Miner of node mining minTxns pending transactions at once, fewer after maxWait
+func NewMiner(node *Node, minTxns int, maxWait time.Duration) *Miner {
+	return chain.NewMiner(node, minTxns, maxWait)
+}
+
+// Miner of node cutting a Block every interval, whatever is pending
+func NewScheduledMiner(node *Node, interval time.Duration) *Miner {
+	return chain.NewScheduledMiner(node, interval)
+}
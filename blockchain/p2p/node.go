@@ -0,0 +1,14 @@
+// Nodes serializing access to their BlockChain, see internal/chain/node.go
+
+package p2p
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+type Node = chain.Node
+
+func NewNode(bc *core.BlockChain) *Node {
+	return chain.NewNode(bc)
+}
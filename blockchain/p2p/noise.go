@@ -0,0 +1,56 @@
+// Encrypted transport between nodes, see internal/chain/noise.go
+
+package p2p
+
+import (
+	"context"
+	"net"
+
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	NOISE_PROTOCOL          = chain.NOISE_PROTOCOL
+	NOISE_PROLOGUE          = chain.NOISE_PROLOGUE
+	NOISE_MAX_MESSAGE       = chain.NOISE_MAX_MESSAGE
+	NOISE_HANDSHAKE_TIMEOUT = chain.NOISE_HANDSHAKE_TIMEOUT
+)
+
+// Long lived X25519 key a node is known by to its peers
+type NodeIdentity = chain.NodeIdentity
+
+/*
+ * Connection encrypted with Noise. The handshake runs on the first Read
+ * or Write, or on Handshake, as with crypto/tls
+ */
+type NoiseConn = chain.NoiseConn
+
+func NewNodeIdentity() (*NodeIdentity, error) {
+	return chain.NewNodeIdentity()
+}
+
+// Identity stored in hex at path, generated and stored if path does not exist
+func LoadNodeIdentity(path string) (*NodeIdentity, error) {
+	return chain.LoadNodeIdentity(path)
+}
+
+// Identity presented when dialing noise:// peers, a fresh one per run unless set
+func SetNodeIdentity(id *NodeIdentity) {
+	chain.SetNodeIdentity(id)
+}
+
+/*
+ * Open a Noise connection to addr, failing unless the peer
+ * authenticates with remoteKey
+ */
+func DialNoise(ctx context.Context, addr string, id *NodeIdentity, remoteKey []byte) (*NoiseConn, error) {
+	return chain.DialNoise(ctx, addr, id, remoteKey)
+}
+
+/*
+ * Accept Noise connections on inner as id, from the peers whose static
+ * key authorize accepts, any peer if nil
+ */
+func NewNoiseListener(inner net.Listener, id *NodeIdentity, authorize func(remoteKey []byte) error) net.Listener {
+	return chain.NewNoiseListener(inner, id, authorize)
+}
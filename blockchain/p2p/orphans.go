@@ -0,0 +1,10 @@
+// Orphaned Blocks, see internal/chain/orphans.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Orphaned Blocks kept, older ones are only counted
+const MAX_ORPHANS = chain.MAX_ORPHANS
+
+type OrphanBlock = chain.OrphanBlock
@@ -0,0 +1,18 @@
+// Peer management, see internal/chain/peers.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	PEER_UNKNOWN      = chain.PEER_UNKNOWN      // never contacted
+	PEER_CONNECTED    = chain.PEER_CONNECTED    // answered the last request
+	PEER_UNREACHABLE  = chain.PEER_UNREACHABLE  // did not
+	PEER_OTHER_CHAIN  = chain.PEER_OTHER_CHAIN  // answered with another genesis
+	PEER_INCOMPATIBLE = chain.PEER_INCOMPATIBLE // answered with a protocol version too old, see handshake.go
+
+	// Timeout of the probes of peers
+	PEER_PROBE_TIMEOUT = chain.PEER_PROBE_TIMEOUT
+)
+
+type PeerInfo = chain.PeerInfo
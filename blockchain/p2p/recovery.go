@@ -0,0 +1,20 @@
+// Disaster recovery, see internal/chain/recovery.go
+
+package p2p
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+type RecoveryReport = chain.RecoveryReport
+
+/*
+ * Rebuild the chain of genesis from the Blocks in cold, keeping the last
+ * hotBlocks in memory, and filling the gaps from peer when it is set.
+ * cold may be nil to fetch every Block from peer
+ * Recovery stops at the first Block neither source provides
+ */
+func RecoverChain(genesis core.Genesis, cold core.ObjectStore, hotBlocks int, peer string) (core.BlockChain, RecoveryReport, error) {
+	return chain.RecoverChain(genesis, cold, hotBlocks, peer)
+}
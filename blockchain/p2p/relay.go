@@ -0,0 +1,13 @@
+// Transaction relay between nodes, see internal/chain/relay.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	FLUFF_PROBABILITY = chain.FLUFF_PROBABILITY // chance of a stem hop turning into fluff
+	STEM_EMBARGO      = chain.STEM_EMBARGO      // stem transactions fluffed after that long
+	STEM_EPOCH        = chain.STEM_EPOCH        // lifetime of the choice of stem peer
+)
+
+type RelayConfig = chain.RelayConfig
@@ -0,0 +1,8 @@
+// Chain reorganizations, see internal/chain/reorg.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Blocks past which the chain never reorganizes
+const MAX_REORG_DEPTH = chain.MAX_REORG_DEPTH
@@ -0,0 +1,8 @@
+// Read replicas, see internal/chain/replica.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Wait before reconnecting to the primary after the stream broke
+const REPLICA_RETRY = chain.REPLICA_RETRY
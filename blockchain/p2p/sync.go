@@ -0,0 +1,7 @@
+// Initial block download, see internal/chain/sync.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type SyncReport = chain.SyncReport
@@ -0,0 +1,12 @@
+// State watches, see internal/chain/watch.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type StateChange = chain.StateChange
+
+// What to watch; a change matching any of the lists is reported
+type Watch = chain.Watch
+
+type WatchNotification = chain.WatchNotification
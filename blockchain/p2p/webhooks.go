@@ -0,0 +1,31 @@
+// Webhooks, see internal/chain/webhooks.go
+
+package p2p
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	WEBHOOK_BLOCK            = chain.WEBHOOK_BLOCK
+	WEBHOOK_REVERTED_BLOCK   = chain.WEBHOOK_REVERTED_BLOCK
+	WEBHOOK_ATTEMPTS         = chain.WEBHOOK_ATTEMPTS    // deliveries of an event before it is dropped
+	WEBHOOK_RETRY_DELAY      = chain.WEBHOOK_RETRY_DELAY // before the second delivery, doubling after
+	WEBHOOK_TIMEOUT          = chain.WEBHOOK_TIMEOUT     // of a delivery
+	WEBHOOK_QUEUE            = chain.WEBHOOK_QUEUE       // events waiting for a webhook before new ones are dropped
+	WEBHOOK_EVENT_HEADER     = chain.WEBHOOK_EVENT_HEADER
+	WEBHOOK_SIGNATURE_HEADER = chain.WEBHOOK_SIGNATURE_HEADER
+)
+
+// Body posted to webhooks
+type WebhookEvent = chain.WebhookEvent
+
+type WebhookInfo = chain.WebhookInfo
+
+// Value of the WEBHOOK_SIGNATURE_HEADER of body signed with secret
+func SignWebhook(secret string, body []byte) string {
+	return chain.SignWebhook(secret, body)
+}
+
+// Whether signature, the WEBHOOK_SIGNATURE_HEADER of a delivery, signs body with secret
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	return chain.VerifyWebhook(secret, body, signature)
+}
@@ -0,0 +1,36 @@
+// Admin API, see internal/chain/admin.go
+
+package rpc
+
+import (
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+	"github.com/sagardixit84/elements/blockchain/p2p"
+)
+
+const (
+	LOG_DEBUG = chain.LOG_DEBUG
+	LOG_INFO  = chain.LOG_INFO // the default
+	LOG_QUIET = chain.LOG_QUIET
+)
+
+type AdminStatus = chain.AdminStatus
+
+// Admin API of a Node, see above
+type AdminServer = chain.AdminServer
+
+// Log as level says from now on
+func SetLogLevel(level string) error {
+	return chain.SetLogLevel(level)
+}
+
+func LogLevel() string {
+	return chain.LogLevel()
+}
+
+/*
+ * Admin API of node, starting and stopping miner, for requests bearing
+ * token, writing state snapshots to the directory snapshots
+ */
+func NewAdminServer(node *p2p.Node, miner *p2p.Miner, token, snapshots string) (*AdminServer, error) {
+	return chain.NewAdminServer(node, miner, token, snapshots)
+}
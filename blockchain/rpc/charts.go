@@ -0,0 +1,22 @@
+// Explorer charts, see internal/chain/charts.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	CHART_BUCKETS        = chain.CHART_BUCKETS        // of a histogram
+	CHART_MAX_HOURS      = chain.CHART_MAX_HOURS      // hours of the blocks per hour chart
+	CHART_MAX_FEE_BLOCKS = chain.CHART_MAX_FEE_BLOCKS // Blocks of the fee chart
+	CHART_FEE_BLOCKS     = chain.CHART_FEE_BLOCKS     // Blocks of the fee chart by default
+)
+
+type HourBucket = chain.HourBucket
+
+type HistogramBucket = chain.HistogramBucket
+
+type Histogram = chain.Histogram
+
+type BlockSizes = chain.BlockSizes
+
+type FeeChart = chain.FeeChart
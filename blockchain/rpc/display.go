@@ -0,0 +1,17 @@
+// Human and machine readable dumps of Blocks and BlockChains, see internal/chain/display.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	DisplayText    = chain.DisplayText    // multi-line text, one section per Block
+	DisplayJSON    = chain.DisplayJSON    // indented JSON, as served by the API
+	DisplayCompact = chain.DisplayCompact // one line per Block
+)
+
+type DisplayFormat = chain.DisplayFormat
+
+func ParseDisplayFormat(name string) (DisplayFormat, error) {
+	return chain.ParseDisplayFormat(name)
+}
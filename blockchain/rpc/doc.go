@@ -0,0 +1,6 @@
+/*
+ * Package rpc serves a Node to clients: the HTTP API of Server, the admin
+ * API, fee estimation, transaction receipts and statuses, tracing, charts,
+ * logging and the output modes of the command line tools.
+ */
+package rpc
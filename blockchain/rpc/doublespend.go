@@ -0,0 +1,12 @@
+// Double-spend demo, see internal/chain/doublespend.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type DoubleSpendStep = chain.DoubleSpendStep
+
+// Run the scenarios, each step recording whether the chain accepted it
+func RunDoubleSpendDemo() []DoubleSpendStep {
+	return chain.RunDoubleSpendDemo()
+}
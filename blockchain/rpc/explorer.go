@@ -0,0 +1,8 @@
+// Block explorer served by the node, see internal/chain/explorer.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Max number of blocks listed by GET /blocks
+const EXPLORER_MAX_BLOCKS = chain.EXPLORER_MAX_BLOCKS
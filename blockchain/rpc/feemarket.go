@@ -0,0 +1,26 @@
+// Fee market analytics, see internal/chain/feemarket.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Smallest fee step that outbids a pending transaction
+	FEE_INCREMENT = chain.FEE_INCREMENT
+
+	// Blocks ahead covered by the fee projection
+	FEE_PROJECTION_BLOCKS = chain.FEE_PROJECTION_BLOCKS
+
+	FEE_ESTIMATE_BLOCKS     = chain.FEE_ESTIMATE_BLOCKS     // recent Blocks the fee estimate learns from
+	FEE_ESTIMATE_CONFIDENCE = chain.FEE_ESTIMATE_CONFIDENCE // chance of inclusion within the target the estimate aims for
+	FULL_BLOCK_FULLNESS     = chain.FULL_BLOCK_FULLNESS     // Blocks this full are taken to have turned transactions away
+)
+
+// Fee percentiles reported per Block
+var FEE_PERCENTILES = chain.FEE_PERCENTILES
+
+type BlockFeeStats = chain.BlockFeeStats
+
+type FeeProjection = chain.FeeProjection
+
+type FeeEstimate = chain.FeeEstimate
@@ -0,0 +1,19 @@
+// gRPC API of a Node, described by toychain.proto, see internal/chain/grpc.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Max size of a request message
+	MAX_GRPC_MESSAGE = chain.MAX_GRPC_MESSAGE
+
+	GRPC_OK                  = chain.GRPC_OK
+	GRPC_INVALID_ARGUMENT    = chain.GRPC_INVALID_ARGUMENT
+	GRPC_NOT_FOUND           = chain.GRPC_NOT_FOUND
+	GRPC_PERMISSION_DENIED   = chain.GRPC_PERMISSION_DENIED
+	GRPC_RESOURCE_EXHAUSTED  = chain.GRPC_RESOURCE_EXHAUSTED
+	GRPC_FAILED_PRECONDITION = chain.GRPC_FAILED_PRECONDITION
+	GRPC_UNIMPLEMENTED       = chain.GRPC_UNIMPLEMENTED
+	GRPC_INTERNAL            = chain.GRPC_INTERNAL
+)
@@ -0,0 +1,23 @@
+// Load generator, see internal/chain/loadgen.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	LOADGEN_POLL    = chain.LOADGEN_POLL
+	LOADGEN_DRAIN   = chain.LOADGEN_DRAIN   // wait for the transfers sent to be included
+	LOADGEN_WORKERS = chain.LOADGEN_WORKERS // concurrent senders, each for its share of the wallets
+)
+
+type LoadGenConfig = chain.LoadGenConfig
+
+type LoadGenReport = chain.LoadGenReport
+
+func DefaultLoadGenConfig(node string) LoadGenConfig {
+	return chain.DefaultLoadGenConfig(node)
+}
+
+func RunLoadGen(cfg LoadGenConfig) (LoadGenReport, error) {
+	return chain.RunLoadGen(cfg)
+}
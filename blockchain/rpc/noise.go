@@ -0,0 +1,16 @@
+// Encrypted transport between nodes, see internal/chain/noise.go
+
+package rpc
+
+import (
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+	"github.com/sagardixit84/elements/blockchain/p2p"
+)
+
+/*
+ * Serve s on addr over Noise as id, to the peers whose key is in allowed,
+ * any peer if allowed is empty
+ */
+func ListenAndServeNoise(addr string, s *Server, id *p2p.NodeIdentity, allowed [][]byte) error {
+	return chain.ListenAndServeNoise(addr, s, id, allowed)
+}
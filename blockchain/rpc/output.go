@@ -0,0 +1,28 @@
+// Output of the CLI commands, see internal/chain/output.go
+
+package rpc
+
+import (
+	"io"
+
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	OutputTable = chain.OutputTable
+	OutputJSON  = chain.OutputJSON
+	OutputQuiet = chain.OutputQuiet
+	OutputCSV   = chain.OutputCSV
+)
+
+type OutputMode = chain.OutputMode
+
+type Output = chain.Output
+
+func ParseOutputMode(name string) (OutputMode, error) {
+	return chain.ParseOutputMode(name)
+}
+
+func NewOutput(mode OutputMode, w io.Writer) *Output {
+	return chain.NewOutput(mode, w)
+}
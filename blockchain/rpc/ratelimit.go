@@ -0,0 +1,10 @@
+// Rate limiting of transaction submission, see internal/chain/ratelimit.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Buckets a limit keeps before forgetting the full ones
+const RATE_LIMIT_BUCKETS = chain.RATE_LIMIT_BUCKETS
+
+type RateLimits = chain.RateLimits
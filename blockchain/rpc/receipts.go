@@ -0,0 +1,12 @@
+// Transaction receipts, see internal/chain/receipts.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	RECEIPT_APPLIED = chain.RECEIPT_APPLIED // committed in a Block
+	RECEIPT_PENDING = chain.RECEIPT_PENDING // waiting in the Mempool
+)
+
+type TxnReceipt = chain.TxnReceipt
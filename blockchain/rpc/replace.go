@@ -0,0 +1,10 @@
+// Replace-by-fee and cancellation, see internal/chain/replace.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	REPLACEMENT_FEE_BUMP = chain.REPLACEMENT_FEE_BUMP // percent of the replaced fee a replacement pays on top
+	REPLACEMENT_MIN_FEE  = chain.REPLACEMENT_MIN_FEE  // least fee a replacement pays on top, eg. of a free transaction
+)
@@ -0,0 +1,27 @@
+// HTTP API of a Node, see internal/chain/server.go
+
+package rpc
+
+import (
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+	"github.com/sagardixit84/elements/blockchain/p2p"
+)
+
+const (
+	// Max headers returned by GET /headers
+	MAX_HEADERS = chain.MAX_HEADERS
+
+	// Max Blocks returned by GET /bodies
+	MAX_BODIES = chain.MAX_BODIES
+)
+
+type Server = chain.Server
+
+func NewServer(node *p2p.Node) *Server {
+	return chain.NewServer(node)
+}
+
+// Serve s on addr over HTTP/1.1 and, for gRPC clients, HTTP/2 without TLS
+func ListenAndServe(addr string, s *Server) error {
+	return chain.ListenAndServe(addr, s)
+}
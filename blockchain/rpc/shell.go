@@ -0,0 +1,12 @@
+// Interactive shell, see internal/chain/shell.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	SHELL_PROMPT = chain.SHELL_PROMPT
+
+	// Blocks listed by the blocks command without a count
+	SHELL_BLOCKS = chain.SHELL_BLOCKS
+)
@@ -0,0 +1,7 @@
+// Graceful shutdown, see internal/chain/shutdown.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const SHUTDOWN_TIMEOUT = chain.SHUTDOWN_TIMEOUT // for the requests in flight
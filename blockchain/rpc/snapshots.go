@@ -0,0 +1,21 @@
+// Mempool snapshots, see internal/chain/snapshots.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Default time between two snapshots
+const SNAPSHOT_INTERVAL = chain.SNAPSHOT_INTERVAL
+
+var TXN_KIND_NAMES = chain.TXN_KIND_NAMES
+
+type MempoolSnapshot = chain.MempoolSnapshot
+
+/*
+ * Snapshots of the file at path taken between the unix microsecond
+ * timestamps from and to, both included, to being 0 for no end, at most
+ * the MAX_SNAPSHOTS latest
+ */
+func ReadSnapshots(path string, from, to int64) ([]MempoolSnapshot, error) {
+	return chain.ReadSnapshots(path, from, to)
+}
@@ -0,0 +1,18 @@
+// Chain monitor, see internal/chain/top.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Default time between two redraws of -top
+	TOP_INTERVAL = chain.TOP_INTERVAL
+
+	// Blocks listed by -top
+	TOP_BLOCKS = chain.TOP_BLOCKS
+
+	// Nonces tried between two updates of the mining meter
+	MINING_METER_BATCH = chain.MINING_METER_BATCH
+)
+
+type MiningProgress = chain.MiningProgress
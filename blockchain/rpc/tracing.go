@@ -0,0 +1,28 @@
+// OpenTelemetry tracing, see internal/chain/tracing.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	TRACE_FLUSH_INTERVAL = chain.TRACE_FLUSH_INTERVAL
+	TRACE_QUEUE          = chain.TRACE_QUEUE // spans waiting to be sent, later ones are dropped
+	TRACE_TXNS           = chain.TRACE_TXNS  // transactions followed to their Block, an arbitrary one is forgotten past it
+	TRACE_SERVICE        = chain.TRACE_SERVICE
+	SPAN_KIND_INTERNAL   = chain.SPAN_KIND_INTERNAL
+	SPAN_KIND_SERVER     = chain.SPAN_KIND_SERVER
+)
+
+// Span of a trace, zero for none
+type SpanContext = chain.SpanContext
+
+// Timed operation, whose methods are no-ops on a nil Span, as started by a nil Tracer
+type Span = chain.Span
+
+// Sends spans to an OTLP/HTTP collector, its methods are no-ops on a nil Tracer
+type Tracer = chain.Tracer
+
+// Tracer sending to the collector at endpoint, eg. http://localhost:4318
+func NewTracer(endpoint string) (*Tracer, error) {
+	return chain.NewTracer(endpoint)
+}
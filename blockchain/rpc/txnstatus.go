@@ -0,0 +1,21 @@
+// Transaction lifecycle, see internal/chain/txnstatus.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	TXN_RECEIVED  = chain.TXN_RECEIVED
+	TXN_PENDING   = chain.TXN_PENDING
+	TXN_INCLUDED  = chain.TXN_INCLUDED
+	TXN_CONFIRMED = chain.TXN_CONFIRMED
+	TXN_DROPPED   = chain.TXN_DROPPED
+	TXN_REPLACED  = chain.TXN_REPLACED
+
+	// Transactions whose steps are kept, the oldest one is forgotten past it
+	TXN_STATUSES = chain.TXN_STATUSES
+)
+
+type TxnStep = chain.TxnStep
+
+type TxnStatus = chain.TxnStatus
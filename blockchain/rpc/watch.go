@@ -0,0 +1,10 @@
+// State watches, see internal/chain/watch.go
+
+package rpc
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	ChangeBalance = chain.ChangeBalance
+	ChangeKV      = chain.ChangeKV
+)
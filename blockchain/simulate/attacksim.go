@@ -0,0 +1,17 @@
+// Simulation of a 51% attack, see internal/chain/attacksim.go
+
+package simulate
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type AttackSimConfig = chain.AttackSimConfig
+
+type AttackSimResult = chain.AttackSimResult
+
+func DefaultAttackSimConfig(share float64, confirmations int) AttackSimConfig {
+	return chain.DefaultAttackSimConfig(share, confirmations)
+}
+
+func SimulateAttack(cfg AttackSimConfig) (AttackSimResult, error) {
+	return chain.SimulateAttack(cfg)
+}
@@ -0,0 +1,18 @@
+// BFT consensus among a committee of validators, Tendermint-style, see internal/chain/bft.go
+
+package simulate
+
+import (
+	"github.com/sagardixit84/elements/blockchain/consensus"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+type BFTSimResult = chain.BFTSimResult
+
+/*
+ * Commit BFT_SIM_HEIGHTS heights, a transfer submitted for each, with a
+ * committee of n validators whose last faulty ones behave as fault
+ */
+func SimulateBFT(n, faulty int, fault consensus.BFTFault) (BFTSimResult, error) {
+	return chain.SimulateBFT(n, faulty, fault)
+}
@@ -0,0 +1,13 @@
+/*
+ * Package simulate runs the toy chain faster than real time, to see how its
+ * parameters play out: competing miners, mining pools, difficulty
+ * retargeting, selfish mining and double-spend attacks, block relay, shards,
+ * the BFT committee and changes of the consensus parameters.
+ *
+ * Its benchmarks mine real Blocks at difficulties 1 to
+ * MINING_BENCH_DIFFICULTY, reporting the hash rate and expected Block time
+ * of this machine:
+ *
+ *	go test -run '^$' -bench Mining -benchtime 5x ./simulate
+ */
+package simulate
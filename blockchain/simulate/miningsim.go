@@ -0,0 +1,30 @@
+// Mining benchmarks and simulation of competing miners, see internal/chain/miningsim.go
+
+package simulate
+
+import (
+	"github.com/sagardixit84/elements/blockchain/consensus"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	MINING_BENCH_DIFFICULTY        = chain.MINING_BENCH_DIFFICULTY        // highest difficulty benchmarked, from 1
+	MINING_BENCH_SCRYPT_DIFFICULTY = chain.MINING_BENCH_SCRYPT_DIFFICULTY // highest difficulty benchmarked with scrypt
+	MINER_SIM_BLOCKS               = chain.MINER_SIM_BLOCKS               // Blocks raced for by the simulated miners
+)
+
+type MinerSimConfig = chain.MinerSimConfig
+
+type MinerSimResult = chain.MinerSimResult
+
+/*
+ * Mine the i-th Block of the benchmark at difficulty with pow, SHA-256 if
+ * nil, returning the hashes it took
+ */
+func MineBenchBlock(difficulty, i int, pow *consensus.PowSpec) int64 {
+	return chain.MineBenchBlock(difficulty, i, pow)
+}
+
+func SimulateMiners(cfg MinerSimConfig) MinerSimResult {
+	return chain.SimulateMiners(cfg)
+}
@@ -0,0 +1,36 @@
+package simulate
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/sagardixit84/elements/blockchain/consensus"
+)
+
+// Mine Blocks at difficulties 1 to maxDifficulty with pow, SHA-256 if nil
+func benchmarkMining(b *testing.B, maxDifficulty int, pow *consensus.PowSpec) {
+	for difficulty := 1; difficulty <= maxDifficulty; difficulty++ {
+		b.Run(fmt.Sprintf("difficulty=%v", difficulty), func(b *testing.B) {
+			hashes := int64(0)
+			for i := 0; i < b.N; i++ {
+				hashes += MineBenchBlock(difficulty, i, pow)
+			}
+			rate := float64(hashes) / b.Elapsed().Seconds()
+			b.ReportMetric(rate, "hashes/s")
+			b.ReportMetric(math.Pow(16, float64(difficulty))/rate, "expected-s/block")
+		})
+	}
+}
+
+func BenchmarkMiningSHA256(b *testing.B) {
+	benchmarkMining(b, MINING_BENCH_DIFFICULTY, nil)
+}
+
+func BenchmarkMiningScrypt(b *testing.B) {
+	pow, err := consensus.NewPowSpec(consensus.POW_SCRYPT)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkMining(b, MINING_BENCH_SCRYPT_DIFFICULTY, pow)
+}
@@ -0,0 +1,29 @@
+// Consensus parameter experiments, see internal/chain/paramsim.go
+
+package simulate
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Most parameter sets simulated at once, besides the chain's
+	MAX_PARAM_SIMS = chain.MAX_PARAM_SIMS
+
+	// Most transactions of a synthetic workload
+	MAX_PARAM_SIM_TXNS = chain.MAX_PARAM_SIM_TXNS
+
+	// Most Blocks a simulation mines
+	MAX_PARAM_SIM_BLOCKS = chain.MAX_PARAM_SIM_BLOCKS
+)
+
+type ConsensusParams = chain.ConsensusParams
+
+type ParamSimWorkload = chain.ParamSimWorkload
+
+type ParamSimRequest = chain.ParamSimRequest
+
+type ParamSimResult = chain.ParamSimResult
+
+// Synthetic workload of an hour at a transaction every 10s
+func DefaultParamSimRequest() ParamSimRequest {
+	return chain.DefaultParamSimRequest()
+}
@@ -0,0 +1,49 @@
+// Simulation of a mining pool, see internal/chain/poolsim.go
+
+package simulate
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	// Account the pool mines to, paying its workers from
+	POOL_ACCOUNT = chain.POOL_ACCOUNT
+
+	POOL_NONCE_RANGE     = chain.POOL_NONCE_RANGE // nonces of each worker's range
+	POOL_MAX_WORKERS     = chain.POOL_MAX_WORKERS
+	POOL_SIM_REWARD      = chain.POOL_SIM_REWARD
+	POOL_SIM_BLOCKS      = chain.POOL_SIM_BLOCKS
+	POOL_SIM_DIFFICULTY  = chain.POOL_SIM_DIFFICULTY
+	POOL_SIM_SHARE_DELTA = chain.POOL_SIM_SHARE_DELTA // share difficulty below the chain's
+	POOL_SIM_TICK        = chain.POOL_SIM_TICK        // hashes of a step by a worker of hash power 1
+)
+
+// Work sent to a worker
+type PoolJob = chain.PoolJob
+
+// Nonce of a job meeting the share difficulty
+type PoolShare = chain.PoolShare
+
+// Coordinator of a pool mining on bc
+type MiningPool = chain.MiningPool
+
+type PoolSimConfig = chain.PoolSimConfig
+
+type PoolSimWorker = chain.PoolSimWorker
+
+type PoolSimResult = chain.PoolSimResult
+
+func NewMiningPool(bc *core.BlockChain, shareDifficulty int) (*MiningPool, error) {
+	return chain.NewMiningPool(bc, shareDifficulty)
+}
+
+func DefaultPoolSimConfig() PoolSimConfig {
+	return chain.DefaultPoolSimConfig()
+}
+
+// Mine cfg.Blocks Blocks with a pool of workers of the given hash powers
+func SimulatePool(cfg PoolSimConfig) (PoolSimResult, error) {
+	return chain.SimulatePool(cfg)
+}
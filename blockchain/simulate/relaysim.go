@@ -0,0 +1,20 @@
+// Simulation of the transaction relay of relay.go, see internal/chain/relaysim.go
+
+package simulate
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Mean time for a message to cross a link, in milliseconds
+const RELAY_SIM_LATENCY = chain.RELAY_SIM_LATENCY
+
+type RelaySimConfig = chain.RelaySimConfig
+
+type RelaySimResult = chain.RelaySimResult
+
+func DefaultRelaySimConfig(dandelion bool) RelaySimConfig {
+	return chain.DefaultRelaySimConfig(dandelion)
+}
+
+func SimulateRelay(cfg RelaySimConfig) RelaySimResult {
+	return chain.SimulateRelay(cfg)
+}
@@ -0,0 +1,24 @@
+// Simulation of the difficulty retargets of retarget.go, see internal/chain/retargetsim.go
+
+package simulate
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	RETARGET_SIM_STEADY    = chain.RETARGET_SIM_STEADY
+	RETARGET_SIM_RISE      = chain.RETARGET_SIM_RISE
+	RETARGET_SIM_DROP      = chain.RETARGET_SIM_DROP
+	RETARGET_SIM_SWITCHING = chain.RETARGET_SIM_SWITCHING
+)
+
+type RetargetSimConfig = chain.RetargetSimConfig
+
+type RetargetSimResult = chain.RetargetSimResult
+
+func DefaultRetargetSimConfig(algorithm, scenario string) RetargetSimConfig {
+	return chain.DefaultRetargetSimConfig(algorithm, scenario)
+}
+
+func SimulateRetarget(cfg RetargetSimConfig) RetargetSimResult {
+	return chain.SimulateRetarget(cfg)
+}
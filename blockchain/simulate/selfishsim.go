@@ -0,0 +1,17 @@
+// Simulation of selfish mining over a network with latency, see internal/chain/selfishsim.go
+
+package simulate
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type SelfishSimConfig = chain.SelfishSimConfig
+
+type SelfishSimResult = chain.SelfishSimResult
+
+func DefaultSelfishSimConfig(share float64, selfish bool, latency float64) SelfishSimConfig {
+	return chain.DefaultSelfishSimConfig(share, selfish, latency)
+}
+
+func SimulateSelfish(cfg SelfishSimConfig) (SelfishSimResult, error) {
+	return chain.SimulateSelfish(cfg)
+}
@@ -0,0 +1,38 @@
+// Sharding simulation, see internal/chain/shardsim.go
+
+package simulate
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	SHARD_BRIDGE        = chain.SHARD_BRIDGE        // account locking and paying out cross-shard transfers on each shard
+	SHARD_COORDINATOR   = chain.SHARD_COORDINATOR   // account crosslinking shard Blocks on the coordinator chain
+	CROSSLINK_NAMESPACE = chain.CROSSLINK_NAMESPACE // of the coordinator, shard/height -> Block hash
+	SHARD_SIM_MAX       = chain.SHARD_SIM_MAX       // shards of -shard-sim
+	SHARD_SIM_BALANCE   = chain.SHARD_SIM_BALANCE   // of each account at genesis
+)
+
+type ShardSimConfig = chain.ShardSimConfig
+
+type ShardSimResult = chain.ShardSimResult
+
+// Proof that a lock was committed in a crosslinked Block of shard From
+type CrossShardReceipt = chain.CrossShardReceipt
+
+func DefaultShardSimConfig(shards int) ShardSimConfig {
+	return chain.DefaultShardSimConfig(shards)
+}
+
+/*
+ * Shard of account among shards: the position in BECH32_CHARSET of the
+ * first character of its address after the prefix, of the first byte of
+ * plain names
+ */
+func ShardOf(account string, shards int) int {
+	return chain.ShardOf(account, shards)
+}
+
+// Run the transfers of cfg round by round until every one is paid out
+func SimulateShards(cfg ShardSimConfig) (ShardSimResult, error) {
+	return chain.SimulateShards(cfg)
+}
@@ -0,0 +1,14 @@
+/*
+ * Package testnet runs several nodes of the toy chain in the process, on
+ * in-memory transports, for tests of sync, forks and reorganizations.
+ * Nothing moves on its own: nodes mine when told to, Step and Settle have
+ * them sync from the peers they reach, and Partition, Heal and LinkFaults
+ * cut or degrade their links.
+ *
+ *	tn := testnet.NewTestNet(3, chaintest.TestGenesis(4))
+ *	defer tn.Close()
+ *	tn.MineOn(0)                        // node 0 mines a Block
+ *	tn.Settle()                         // the others sync it
+ *	tn.Partition([]int{0}, []int{1, 2}) // node 0 cut off from 1 and 2
+ */
+package testnet
@@ -0,0 +1,15 @@
+// Fault injection between the nodes of a TestNet, see internal/chain/netfaults.go
+
+package testnet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+type LinkFaults = chain.LinkFaults
+
+/*
+ * Faults of -testnet-faults, comma separated, eg.
+ * drop=0.2,duplicate=0.1,delay=2,latency=5ms
+ */
+func ParseLinkFaults(spec string) (LinkFaults, error) {
+	return chain.ParseLinkFaults(spec)
+}
@@ -0,0 +1,23 @@
+// In-process test network, see internal/chain/testnet.go
+
+package testnet
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+const (
+	// Time between two readings of the clock of a TestNet
+	TESTNET_CLOCK_STEP = chain.TESTNET_CLOCK_STEP
+
+	// Rounds of Step Settle runs at most before giving up
+	TESTNET_MAX_ROUNDS = chain.TESTNET_MAX_ROUNDS
+)
+
+type TestNet = chain.TestNet
+
+// Network of n Nodes on genesis, each mining to its own account, node0 to nodeN-1
+func NewTestNet(n int, genesis core.Genesis) *TestNet {
+	return chain.NewTestNet(n, genesis)
+}
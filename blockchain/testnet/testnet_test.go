@@ -0,0 +1,38 @@
+package testnet
+
+import (
+	"testing"
+
+	"github.com/sagardixit84/elements/blockchain/chaintest"
+)
+
+// Partitioned nodes diverge and converge on the longer branch once healed, through the public API
+func TestPartitionHeal(t *testing.T) {
+	tn := NewTestNet(3, chaintest.TestGenesis(4))
+	defer tn.Close()
+	mine := func(i int) {
+		t.Helper()
+		if _, err := tn.MineOn(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settle := func() {
+		t.Helper()
+		if _, err := tn.Settle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tn.Partition([]int{0}, []int{1, 2})
+	mine(0)
+	mine(1)
+	mine(1)
+	settle()
+	if _, heights := tn.Tips(); tn.Converged() || heights[0] != 1 || heights[2] != 2 {
+		t.Fatalf("partitioned heights %v, expected 1, 2, 2 apart", heights)
+	}
+	tn.Heal()
+	settle()
+	if _, heights := tn.Tips(); !tn.Converged() || heights[0] != 2 {
+		t.Fatalf("healed heights %v, expected 2 everywhere", heights)
+	}
+}
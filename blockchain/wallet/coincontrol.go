@@ -0,0 +1,11 @@
+// Coin control, see internal/chain/coincontrol.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Frozen outputs and labels of the outputs of an account
+type CoinControl = chain.CoinControl
+
+// Unspent output with its label, and whether it is frozen
+type Coin = chain.Coin
@@ -0,0 +1,6 @@
+/*
+ * Package wallet holds the keys of an account and signs with them: wallets
+ * and signature schemes, HD keys and mnemonics, keystores and coin control,
+ * remote signers, Schnorr aggregation, stealth addresses and price oracles.
+ */
+package wallet
@@ -0,0 +1,43 @@
+// Hierarchical deterministic wallets, see internal/chain/hdwallet.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	MNEMONIC_ROUNDS = chain.MNEMONIC_ROUNDS // PBKDF2 iterations of the seed
+	HD_HARDENED     = chain.HD_HARDENED     // first hardened index
+	HD_DEFAULT_PATH = chain.HD_DEFAULT_PATH // parent of the addresses, 1 being the testnet coin type
+	HD_SEED_KEY     = chain.HD_SEED_KEY     // SLIP-10 HMAC key of the master key
+)
+
+// Node of the key tree: a private key and the chain code deriving its children
+type HDKey = chain.HDKey
+
+// Mnemonic of bits of fresh entropy, 128 for 12 words up to 256 for 24
+func NewMnemonic(bits int) (string, error) {
+	return chain.NewMnemonic(bits)
+}
+
+func ValidateMnemonic(mnemonic string) error {
+	return chain.ValidateMnemonic(mnemonic)
+}
+
+/*
+ * Seed of mnemonic and passphrase, as BIP-39 without the Unicode
+ * normalization: the words are ASCII, a passphrase with accents must be
+ * typed the same way each time
+ */
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	return chain.MnemonicSeed(mnemonic, passphrase)
+}
+
+// Master key of seed, the root m of the paths
+func NewMasterKey(seed []byte) (*HDKey, error) {
+	return chain.NewMasterKey(seed)
+}
+
+// Master key of a mnemonic
+func MnemonicMasterKey(mnemonic, passphrase string) (*HDKey, error) {
+	return chain.MnemonicMasterKey(mnemonic, passphrase)
+}
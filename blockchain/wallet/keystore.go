@@ -0,0 +1,19 @@
+// Keystore of passphrase encrypted Wallet keys, see internal/chain/keystore.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	KEYSTORE_VERSION  = chain.KEYSTORE_VERSION
+	KEYSTORE_SCRYPT_N = chain.KEYSTORE_SCRYPT_N
+	KEYSTORE_SCRYPT_R = chain.KEYSTORE_SCRYPT_R
+	KEYSTORE_SCRYPT_P = chain.KEYSTORE_SCRYPT_P
+)
+
+type Keystore = chain.Keystore
+
+// Keystore in dir, created if missing
+func NewKeystore(dir string) (*Keystore, error) {
+	return chain.NewKeystore(dir)
+}
@@ -0,0 +1,36 @@
+// Price oracle, see internal/chain/oracle.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	// Default granularity of cached prices
+	PRICE_CACHE_BUCKET = chain.PRICE_CACHE_BUCKET
+
+	// Default max number of calls to the PriceSource per second
+	PRICE_RATE_LIMIT = chain.PRICE_RATE_LIMIT
+
+	// Prices cached at most, the first fetched dropped first
+	PRICE_CACHE_SIZE = chain.PRICE_CACHE_SIZE
+)
+
+// Source of fiat prices for one unit of the chain's coin
+type PriceSource = chain.PriceSource
+
+// PriceSource returning the same price regardless of time, handy for demos
+type FixedPriceSource = chain.FixedPriceSource
+
+type PriceOracle = chain.PriceOracle
+
+/*
+ * Fixed prices of -fiat-prices, comma separated currency=price, eg.
+ * USD=2.5,EUR=2.3, and their currencies in order
+ */
+func ParseFixedPrices(spec string) (FixedPriceSource, []string, error) {
+	return chain.ParseFixedPrices(spec)
+}
+
+func NewPriceOracle(source PriceSource, currencies ...string) *PriceOracle {
+	return chain.NewPriceOracle(source, currencies...)
+}
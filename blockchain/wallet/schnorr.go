@@ -0,0 +1,26 @@
+// Schnorr signatures and their aggregation, see internal/chain/schnorr.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	SCHNORR_POINT_SIZE    = chain.SCHNORR_POINT_SIZE  // compressed R
+	SCHNORR_SCALAR_SIZE   = chain.SCHNORR_SCALAR_SIZE // s
+	SCHNORR_NONCE_TAG     = chain.SCHNORR_NONCE_TAG
+	SCHNORR_CHALLENGE_TAG = chain.SCHNORR_CHALLENGE_TAG
+	SCHNORR_AGGREGATE_TAG = chain.SCHNORR_AGGREGATE_TAG
+
+	// Parties of the swap of -schnorr-demo unless set
+	SCHNORR_DEMO_PARTIES = chain.SCHNORR_DEMO_PARTIES
+)
+
+type AggregationDemo = chain.AggregationDemo
+
+/*
+ * Sign a swap passing a coin around parties accounts with Schnorr keys,
+ * then aggregate their signatures
+ */
+func SchnorrDemo(parties int) (AggregationDemo, error) {
+	return chain.SchnorrDemo(parties)
+}
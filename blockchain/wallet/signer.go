@@ -0,0 +1,27 @@
+// Remote signing, see internal/chain/signer.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+// Holder of the key of an account signing transactions
+type Signer = chain.Signer
+
+// What a signer process tells of its key, GET /signer
+type SignerInfo = chain.SignerInfo
+
+// Signer asking a signer process, see SignerServer
+type RemoteSigner = chain.RemoteSigner
+
+// HTTP API of a signer process, signing with one Wallet
+type SignerServer = chain.SignerServer
+
+// Client of the signer process at url, sending token unless empty
+func NewRemoteSigner(url, token string) (*RemoteSigner, error) {
+	return chain.NewRemoteSigner(url, token)
+}
+
+// Sign with w the transactions of requests carrying token, any if empty
+func NewSignerServer(w *Wallet, token string) *SignerServer {
+	return chain.NewSignerServer(w, token)
+}
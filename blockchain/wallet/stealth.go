@@ -0,0 +1,43 @@
+// Stealth addresses, see internal/chain/stealth.go
+
+package wallet
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+// Prefix of the data of the transactions announcing a payment to a stealth address
+const STEALTH_ANNOUNCEMENT = chain.STEALTH_ANNOUNCEMENT
+
+// Published by the payee in place of an address
+type StealthAddress = chain.StealthAddress
+
+// Keys behind a stealth address
+type StealthWallet = chain.StealthWallet
+
+// Output paid to a stealth address, found by Scan
+type StealthOutput = chain.StealthOutput
+
+type StealthStep = chain.StealthStep
+
+func NewStealthWallet(account string) (*StealthWallet, error) {
+	return chain.NewStealthWallet(account)
+}
+
+/*
+ * Deposit of amt by payer to a one-time address of to, on the network of
+ * prefix, announced in the data of the transaction
+ */
+func NewStealthPayment(payer string, nonce uint64, to StealthAddress, amt core.Amount, prefix string) (core.Transaction, error) {
+	return chain.NewStealthPayment(payer, nonce, to, amt, prefix)
+}
+
+/*
+ * Pay bob twice at his stealth address, let eve and bob scan the chain, eve
+ * try to spend bob's outputs and bob spend one, each step recording whether
+ * the chain accepted it and the outputs the party found
+ */
+func RunStealthDemo() ([]StealthStep, error) {
+	return chain.RunStealthDemo()
+}
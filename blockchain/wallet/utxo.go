@@ -0,0 +1,25 @@
+// UTXO transactions, living side by side with account balances, see internal/chain/utxo.go
+
+package wallet
+
+import (
+	"github.com/sagardixit84/elements/blockchain/core"
+	"github.com/sagardixit84/elements/blockchain/internal/chain"
+)
+
+/*
+ * Build and sign with s a transaction paying amt to the UTXO owner to out
+ * of the unspent outputs of the account of s, picking the largest outputs
+ * first and sending the change back to it
+ */
+func PayUTXO(s Signer, unspent []core.UTXO, to string, amt core.Amount, nonce uint64) (core.Transaction, error) {
+	return chain.PayUTXO(s, unspent, to, amt, nonce)
+}
+
+/*
+ * Like PayUTXO, but spending all the outputs inputs of unspent, eg. picked
+ * by hand, see coincontrol.go
+ */
+func PayUTXOFrom(s Signer, unspent []core.UTXO, inputs []string, to string, amt core.Amount, nonce uint64) (core.Transaction, error) {
+	return chain.PayUTXOFrom(s, unspent, inputs, to, amt, nonce)
+}
@@ -0,0 +1,39 @@
+// Wallets hold the key of an account and sign transactions, see internal/chain/wallet.go
+
+package wallet
+
+import "github.com/sagardixit84/elements/blockchain/internal/chain"
+
+const (
+	SchemeECDSA   = chain.SchemeECDSA   // ECDSA over P-256
+	SchemeEd25519 = chain.SchemeEd25519 // ed25519
+	SchemeSchnorr = chain.SchemeSchnorr // Schnorr over P-256, see schnorr.go
+)
+
+var SIG_SCHEMES = chain.SIG_SCHEMES
+
+// Signature schemes, numbered in the JSON and binary forms of transactions
+type SigScheme = chain.SigScheme
+
+type Wallet = chain.Wallet
+
+type SchemeComparison = chain.SchemeComparison
+
+// Scheme named name, ecdsa, ed25519 or schnorr
+func ParseSigScheme(name string) (SigScheme, error) {
+	return chain.ParseSigScheme(name)
+}
+
+func NewWallet(account string) (*Wallet, error) {
+	return chain.NewWallet(account)
+}
+
+// Wallet of account with a random key of scheme
+func NewSchemeWallet(account string, scheme SigScheme) (*Wallet, error) {
+	return chain.NewSchemeWallet(account, scheme)
+}
+
+// Sign and verify rounds digests with a fresh key of every scheme
+func CompareSchemes(rounds int) ([]SchemeComparison, error) {
+	return chain.CompareSchemes(rounds)
+}